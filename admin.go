@@ -0,0 +1,634 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxImportSize bounds the archive accepted by the import endpoint
+const maxImportSize = 32 << 20
+
+// Archive entry names used by export and import; backups use the first
+// three too
+const (
+	archiveTasksFile    = "tasks.json"
+	archiveProjectsFile = "projects.json"
+	archiveConfigFile   = "config.json"
+	// archiveAttachmentsDir holds the attachment files, each under its key
+	archiveAttachmentsDir = "attachments/"
+)
+
+// Replace swaps the entire task set for tasks, e.g. when restoring a backup,
+// and empties the trash. Tasks with an archived_at go to the archive. On
+// save failure the previous tasks are restored.
+func (ts *TaskStore) Replace(ctx context.Context, tasks []*Task) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	before := ts.storeCountsLocked()
+	prevTasks, prevTrash, prevArchive, prevNextID := ts.tasks, ts.trash, ts.archive, ts.nextID
+	removed := make([]int, 0, len(prevTasks)+len(prevTrash)+len(prevArchive))
+	for _, partition := range []map[int]*Task{prevTasks, prevTrash, prevArchive} {
+		for id := range partition {
+			removed = append(removed, id)
+		}
+	}
+	ids := make([]int, 0, len(tasks))
+	ts.tasks = make(map[int]*Task, len(tasks))
+	ts.trash = make(map[int]*Task)
+	ts.archive = make(map[int]*Task)
+	ts.nextID = 1
+	for _, task := range tasks {
+		task.DueDate = task.DueDate.resolveSavedDay(ts.dueLocation)
+		ts.partitionFor(task)[task.ID] = task
+		ids = append(ids, task.ID)
+		if task.ID >= ts.nextID {
+			ts.nextID = task.ID + 1
+		}
+	}
+
+	if err := ts.saveReplacing(ctx, removed, ids); err != nil {
+		ts.tasks, ts.trash, ts.archive, ts.nextID = prevTasks, prevTrash, prevArchive, prevNextID
+		return fmt.Errorf("save tasks: %w", err)
+	}
+	ts.resetChanges()
+	ts.recordMutation(ctx, AuditReplace, auditStore, 0, before, ts.storeCountsLocked())
+	return nil
+}
+
+// SanitizedConfig is the effective configuration with secrets redacted.
+// Fields are copied explicitly so that new Config fields stay hidden until
+// they are deliberately added here.
+type SanitizedConfig struct {
+	Port                         string           `json:"port"`
+	TimeZone                     string           `json:"time_zone"`
+	DisabledEndpoints            []string         `json:"disabled_endpoints"`
+	CORSAllowedOrigins           []string         `json:"cors_allowed_origins"`
+	CORSAllowedMethods           []string         `json:"cors_allowed_methods"`
+	CORSAllowedHeaders           []string         `json:"cors_allowed_headers"`
+	CORSAllowCredentials         bool             `json:"cors_allow_credentials"`
+	AutoProgressOnEdit           bool             `json:"auto_progress_on_edit"`
+	AutoDeleteCompletedAfterDays int              `json:"auto_delete_completed_after_days"`
+	TrashRetentionDays           int              `json:"trash_retention_days"`
+	ArchiveCompletedAfterDays    int              `json:"archive_completed_after_days"`
+	PasswordPolicy               PasswordPolicy   `json:"password_policy"`
+	EnablePprof                  bool             `json:"enable_pprof"`
+	DebugAllowedCIDRs            []string         `json:"debug_allowed_cidrs"`
+	ObfuscateIDs                 bool             `json:"obfuscate_ids"`
+	MaxTasks                     int              `json:"max_tasks"`
+	PriorityWeights              map[string]int   `json:"priority_weights"`
+	MaxConcurrentRequests        int              `json:"max_concurrent_requests"`
+	RateLimit                    RateLimitConfig  `json:"rate_limit"`
+	MaxPollTimeoutSeconds        int              `json:"max_poll_timeout_seconds"`
+	MaxEventStreams              int              `json:"max_event_streams"`
+	JWTTTLMinutes                int              `json:"jwt_ttl_minutes"`
+	TokenTTLMinutes              int              `json:"token_ttl_minutes"`
+	DefaultSort                  string           `json:"default_sort"`
+	DefaultOrder                 string           `json:"default_order"`
+	Storage                      string           `json:"storage"`
+	SQLitePath                   string           `json:"sqlite_path"`
+	Postgres                     PostgresConfig   `json:"postgres"`
+	OIDC                         OIDCConfig       `json:"oidc"`
+	TLS                          TLSConfig        `json:"tls"`
+	LogFormat                    string           `json:"log_format,omitempty"`
+	MaxTagsPerTask               int              `json:"max_tags_per_task"`
+	PreserveTagCase              bool             `json:"preserve_tag_case"`
+	Reminders                    ReminderConfig   `json:"reminders"`
+	SMTP                         SMTPConfig       `json:"smtp"`
+	Digest                       DigestConfig     `json:"digest"`
+	Telegram                     TelegramConfig   `json:"telegram"`
+	Webhooks                     []Webhook        `json:"webhooks"`
+	Integrations                 []Integration    `json:"integrations"`
+	SeedFile                     string           `json:"seed_file"`
+	TaskDefaults                 TaskDefaults     `json:"task_defaults"`
+	Backup                       BackupConfig     `json:"backup"`
+	AuditLog                     string           `json:"audit_log"`
+	RequireIfMatch               bool             `json:"require_if_match"`
+	Attachments                  AttachmentConfig `json:"attachments"`
+	Workspaces                   []Workspace      `json:"workspaces"`
+
+	APIKeySet                bool     `json:"api_key_set"`
+	PasswordHashSet          bool     `json:"password_hash_set"`
+	JWTSecretSet             bool     `json:"jwt_secret_set"`
+	IDSaltSet                bool     `json:"id_salt_set"`
+	PostgresURLSet           bool     `json:"postgres_url_set"`
+	OIDCClientSecretSet      bool     `json:"oidc_client_secret_set"`
+	ReminderWebhookSet       bool     `json:"reminder_webhook_set"`
+	ReminderEmailPasswordSet bool     `json:"reminder_email_password_set"`
+	SMTPPasswordSet          bool     `json:"smtp_password_set"`
+	TelegramBotTokenSet      bool     `json:"telegram_bot_token_set"`
+	ShareSecretSet           bool     `json:"share_secret_set"`
+	S3SecretAccessKeySet     bool     `json:"s3_secret_access_key_set"`
+	CalendarFeedPrivate      bool     `json:"calendar_feed_private"`
+	TokenCount               int      `json:"token_count"`
+	TokenFingerprints        []string `json:"token_fingerprints"`
+	// TokenRoles maps each token fingerprint to its role
+	TokenRoles map[string]string `json:"token_roles"`
+	// TokenScopes maps the fingerprints of tokens limited to some scopes to
+	// those scopes
+	TokenScopes map[string][]string `json:"token_scopes,omitempty"`
+	// TokenWorkspaces maps the fingerprints of tokens issued for a
+	// workspace to its ID
+	TokenWorkspaces map[string]string `json:"token_workspaces,omitempty"`
+	// UserTimeZones maps callers to the time zone of their dates
+	UserTimeZones map[string]string `json:"user_time_zones,omitempty"`
+	// PriorityLevels are the custom priorities
+	PriorityLevels []PriorityLevel `json:"priority_levels,omitempty"`
+	Workflow       WorkflowConfig  `json:"workflow"`
+}
+
+// Sanitized returns the config with secrets replaced by presence flags and
+// token hashes replaced by a count and short fingerprints. A fingerprint is
+// derived from the hash rather than being a prefix of it, so it reveals
+// nothing about the stored value.
+func (c *Config) Sanitized() SanitizedConfig {
+	fingerprints := make([]string, len(c.TokenHashes))
+	roles := make(map[string]string, len(c.TokenHashes))
+	scopes := make(map[string][]string)
+	workspaces := make(map[string]string)
+	for i, hash := range c.TokenHashes {
+		fingerprints[i] = tokenID(hash)
+		roles[fingerprints[i]] = RoleAdmin
+		if role, ok := c.TokenRoles[hash]; ok {
+			roles[fingerprints[i]] = role
+		}
+		if tokenScopes, ok := c.TokenScopes[hash]; ok {
+			scopes[fingerprints[i]] = append([]string{}, tokenScopes...)
+		}
+		if workspace, ok := c.TokenWorkspaces[hash]; ok {
+			workspaces[fingerprints[i]] = workspace
+		}
+	}
+	// The connection string usually embeds a password
+	postgres := c.Postgres
+	postgres.URL = ""
+	oidc := c.OIDC
+	oidc.ClientSecret = ""
+	// Webhook URLs often carry a token, and the SMTP password is a secret
+	reminders := c.Reminders
+	reminders.Channels = append([]string{}, c.Reminders.Channels...)
+	reminders.WebhookURL = ""
+	reminders.Email.Password = ""
+	smtpConfig := c.SMTP
+	smtpConfig.Password = ""
+	attachments := c.Attachments
+	attachments.S3.SecretAccessKey = ""
+	webhooks := make([]Webhook, len(c.Webhooks))
+	for i, hook := range c.Webhooks {
+		hook.Secret = ""
+		webhooks[i] = hook
+	}
+	// An integration's URL is what lets it post to the channel
+	integrations := make([]Integration, len(c.Integrations))
+	for i, in := range c.Integrations {
+		in.URL = ""
+		integrations[i] = in
+	}
+	return SanitizedConfig{
+		Port:                         c.Port,
+		TimeZone:                     c.TimeZone,
+		DisabledEndpoints:            append([]string{}, c.DisabledEndpoints...),
+		CORSAllowedOrigins:           append([]string{}, c.CORSAllowedOrigins...),
+		CORSAllowedMethods:           append([]string{}, c.CORSAllowedMethods...),
+		CORSAllowedHeaders:           append([]string{}, c.CORSAllowedHeaders...),
+		CORSAllowCredentials:         c.CORSAllowCredentials,
+		AutoProgressOnEdit:           c.AutoProgressOnEdit,
+		AutoDeleteCompletedAfterDays: c.AutoDeleteCompletedAfterDays,
+		TrashRetentionDays:           c.TrashRetentionDays,
+		ArchiveCompletedAfterDays:    c.ArchiveCompletedAfterDays,
+		PasswordPolicy:               c.PasswordPolicy,
+		EnablePprof:                  c.EnablePprof,
+		DebugAllowedCIDRs:            c.DebugAllowedCIDRs,
+		ObfuscateIDs:                 c.ObfuscateIDs,
+		MaxTasks:                     c.MaxTasks,
+		PriorityWeights:              c.PriorityWeights,
+		MaxConcurrentRequests:        c.MaxConcurrentRequests,
+		RateLimit:                    c.RateLimit,
+		MaxPollTimeoutSeconds:        c.MaxPollTimeoutSeconds,
+		MaxEventStreams:              c.MaxEventStreams,
+		JWTTTLMinutes:                c.JWTTTLMinutes,
+		TokenTTLMinutes:              c.TokenTTLMinutes,
+		DefaultSort:                  c.DefaultSort,
+		DefaultOrder:                 c.DefaultOrder,
+		Storage:                      c.Storage,
+		SQLitePath:                   c.SQLitePath,
+		Postgres:                     postgres,
+		OIDC:                         oidc,
+		TLS:                          c.TLS,
+		LogFormat:                    c.LogFormat,
+		MaxTagsPerTask:               c.MaxTagsPerTask,
+		PreserveTagCase:              c.PreserveTagCase,
+		Reminders:                    reminders,
+		SMTP:                         smtpConfig,
+		Digest:                       c.Digest,
+		Telegram:                     c.Telegram,
+		Webhooks:                     webhooks,
+		Integrations:                 integrations,
+		SeedFile:                     c.SeedFile,
+		TaskDefaults:                 c.TaskDefaults,
+		Backup:                       c.Backup,
+		AuditLog:                     c.auditLogPath(),
+		RequireIfMatch:               c.RequireIfMatch,
+		Attachments:                  attachments,
+		Workspaces:                   append([]Workspace{}, c.Workspaces...),
+
+		APIKeySet:                c.APIKey != "",
+		PasswordHashSet:          c.PasswordHash != "",
+		JWTSecretSet:             c.JWTSecret != "",
+		IDSaltSet:                c.IDSalt != "",
+		PostgresURLSet:           c.Postgres.URL != "",
+		OIDCClientSecretSet:      c.OIDC.ClientSecret != "",
+		ReminderWebhookSet:       c.Reminders.WebhookURL != "",
+		ReminderEmailPasswordSet: c.Reminders.Email.Password != "",
+		SMTPPasswordSet:          c.SMTP.Password != "",
+		TelegramBotTokenSet:      c.Telegram.BotToken != "",
+		ShareSecretSet:           c.ShareSecret != "",
+		S3SecretAccessKeySet:     c.Attachments.S3.SecretAccessKey != "",
+		CalendarFeedPrivate:      c.CalendarFeedPrivate,
+		TokenCount:               len(c.TokenHashes),
+		TokenFingerprints:        fingerprints,
+		TokenRoles:               roles,
+		TokenScopes:              scopes,
+		TokenWorkspaces:          workspaces,
+		UserTimeZones:            c.UserTimeZones,
+		PriorityLevels:           c.PriorityLevels,
+		Workflow:                 c.Workflow,
+	}
+}
+
+// sanitizedConfig returns the server's current config with secrets redacted
+func (s *Server) sanitizedConfig() SanitizedConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.config.Sanitized()
+}
+
+// handleGetConfig returns the effective configuration without secrets
+func (s *Server) handleGetConfig(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.sanitizedConfig())
+}
+
+// exportSnapshot returns the live and archived tasks in ID order and the
+// projects, read under one lock so an archive run can't drop a task
+// between the two and every task's project is there
+func (ts *TaskStore) exportSnapshot() ([]*Task, []*Project) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	tasks := make([]*Task, 0, len(ts.tasks)+len(ts.archive))
+	for _, partition := range []map[int]*Task{ts.tasks, ts.archive} {
+		for _, task := range partition {
+			tasks = append(tasks, task)
+		}
+	}
+	sortByID(tasks)
+	return tasks, ts.projectListLocked()
+}
+
+// handleExport serves a zip archive of all tasks, archived ones included,
+// the projects, the attachment files and the sanitized config. Tasks in
+// the trash are left out. The archive is buffered and served with
+// http.ServeContent so interrupted downloads can be resumed with Range
+// requests; the ETag and Last-Modified validators keep a resumed range
+// from mixing two different exports.
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	tasks, projects := s.store.exportSnapshot()
+	config := s.sanitizedConfig()
+	if s.store.files == nil && hasAttachments(tasks) {
+		writeError(w, http.StatusServiceUnavailable, ErrCodeAttachmentsUnavailable, "Attachment storage is not available")
+		return
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, entry := range []struct {
+		name string
+		v    interface{}
+	}{
+		{archiveTasksFile, tasks},
+		{archiveProjectsFile, projects},
+		{archiveConfigFile, config},
+	} {
+		f, err := zw.Create(entry.name)
+		if err != nil {
+			requestLogger(r.Context()).Error("Failed to write export", "error", err)
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to build export")
+			return
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(entry.v); err != nil {
+			requestLogger(r.Context()).Error("Failed to write export", "error", err)
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to build export")
+			return
+		}
+	}
+	for _, task := range tasks {
+		for _, attachment := range task.Attachments {
+			if err := s.exportAttachment(r.Context(), zw, attachment); err != nil {
+				requestLogger(r.Context()).Error("Failed to export attachment", "task_id", task.ID, "key", attachment.Key, "error", err)
+				writeError(w, http.StatusBadGateway, ErrCodeAttachmentStorage, "Failed to read an attachment")
+				return
+			}
+		}
+	}
+	if err := zw.Close(); err != nil {
+		requestLogger(r.Context()).Error("Failed to write export", "error", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to build export")
+		return
+	}
+
+	filename := fmt.Sprintf("taskmate-export-%s.zip", s.now().UTC().Format("20060102-150405"))
+	serveDownload(w, r, filename, "application/zip", buf.Bytes(), lastModified(tasks))
+}
+
+// hasAttachments reports whether any of tasks has an attachment
+func hasAttachments(tasks []*Task) bool {
+	for _, task := range tasks {
+		if len(task.Attachments) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// exportAttachment copies an attachment's file into the archive under
+// archiveAttachmentsDir. A file already missing from storage is left out,
+// as its download would fail too.
+func (s *Server) exportAttachment(ctx context.Context, zw *zip.Writer, attachment Attachment) error {
+	file, err := s.store.files.Open(ctx, attachment.Key)
+	if errors.Is(err, ErrAttachmentNotFound) {
+		requestLogger(ctx).Warn("Attachment file missing from export", "key", attachment.Key)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	f, err := zw.Create(archiveAttachmentsDir + attachment.Key)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, file)
+	return err
+}
+
+// serveDownload serves a generated file with Range support. The ETag is a
+// hash of the content, so it only changes when the content does.
+func serveDownload(w http.ResponseWriter, r *http.Request, filename, contentType string, content []byte, modTime time.Time) {
+	sum := sha256.Sum256(content)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	http.ServeContent(w, r, filename, modTime, bytes.NewReader(content))
+}
+
+// lastModified returns the most recent UpdatedAt among tasks, truncated to
+// seconds as HTTP dates are
+func lastModified(tasks []*Task) time.Time {
+	var latest time.Time
+	for _, task := range tasks {
+		if task.UpdatedAt.After(latest) {
+			latest = task.UpdatedAt
+		}
+	}
+	return latest.Truncate(time.Second)
+}
+
+// importArchive is the content of an export archive
+type importArchive struct {
+	tasks []*Task
+	// projects is nil for an archive from before exports held projects
+	projects []*Project
+	// files are the attachment files by key
+	files map[string][]byte
+}
+
+// readImportArchive parses and validates an export archive. Each
+// attachment file must belong to an attachment of the tasks and match its
+// size and digest.
+func readImportArchive(data []byte) (*importArchive, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("not a zip archive")
+	}
+	archive := &importArchive{files: make(map[string][]byte)}
+	if err := readArchiveFile(zr, archiveTasksFile, &archive.tasks); err != nil {
+		return nil, err
+	}
+	if err := validateArchiveTasks(archive.tasks); err != nil {
+		return nil, err
+	}
+	if findArchiveFile(zr, archiveProjectsFile) != nil {
+		archive.projects = []*Project{}
+		if err := readArchiveFile(zr, archiveProjectsFile, &archive.projects); err != nil {
+			return nil, err
+		}
+		if err := validateArchiveProjects(archive.projects, archive.tasks); err != nil {
+			return nil, err
+		}
+	}
+
+	attachments := make(map[string]Attachment)
+	for _, task := range archive.tasks {
+		for _, attachment := range task.Attachments {
+			attachments[attachment.Key] = attachment
+		}
+	}
+	var total int64
+	for _, f := range zr.File {
+		key, ok := strings.CutPrefix(f.Name, archiveAttachmentsDir)
+		if !ok {
+			continue
+		}
+		attachment, ok := attachments[key]
+		if !ok {
+			return nil, fmt.Errorf("%s belongs to no attachment", f.Name)
+		}
+		if _, dup := archive.files[key]; dup {
+			return nil, fmt.Errorf("duplicate %s", f.Name)
+		}
+		if total += attachment.Size; total > maxImportSize {
+			return nil, fmt.Errorf("attachment files exceed %d MB", maxImportSize>>20)
+		}
+		content, err := readArchiveAttachment(f, attachment)
+		if err != nil {
+			return nil, err
+		}
+		archive.files[key] = content
+	}
+	return archive, nil
+}
+
+// readArchiveAttachment reads an attachment file from an archive, checking
+// it against the attachment's size and digest
+func readArchiveAttachment(f *zip.File, attachment Attachment) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("cannot open %s", f.Name)
+	}
+	defer rc.Close()
+	content, err := io.ReadAll(io.LimitReader(rc, attachment.Size+1))
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s", f.Name)
+	}
+	sum := sha256.Sum256(content)
+	if int64(len(content)) != attachment.Size || hex.EncodeToString(sum[:]) != attachment.SHA256 {
+		return nil, fmt.Errorf("%s doesn't match its attachment's size and sha256", f.Name)
+	}
+	return content, nil
+}
+
+// findArchiveFile returns the entry called name in an archive, or nil
+func findArchiveFile(zr *zip.Reader, name string) *zip.File {
+	for _, f := range zr.File {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// readArchiveFile decodes the JSON file name in an archive into v
+func readArchiveFile(zr *zip.Reader, name string, v interface{}) error {
+	file := findArchiveFile(zr, name)
+	if file == nil {
+		return fmt.Errorf("archive has no %s", name)
+	}
+
+	rc, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("cannot open %s", name)
+	}
+	defer rc.Close()
+
+	if err := json.NewDecoder(io.LimitReader(rc, maxImportSize)).Decode(v); err != nil {
+		return fmt.Errorf("invalid %s: %v", name, err)
+	}
+	return nil
+}
+
+// validateArchiveTasks checks the tasks read from an archive and fills in
+// missing timestamps. Tasks with an archived_at are restored to the
+// archive and the rest as live tasks, even if they carry a deleted_at.
+func validateArchiveTasks(tasks []*Task) error {
+	seen := make(map[int]bool, len(tasks))
+	for i, task := range tasks {
+		switch {
+		case task == nil:
+			return fmt.Errorf("task %d is null", i)
+		case task.ID <= 0:
+			return fmt.Errorf("task %d has invalid id %d", i, task.ID)
+		case seen[task.ID]:
+			return fmt.Errorf("duplicate task id %d", task.ID)
+		case task.Title == "":
+			return fmt.Errorf("task %d has no title", task.ID)
+		}
+		seen[task.ID] = true
+		for _, attachment := range task.Attachments {
+			if !attachmentKeyPattern.MatchString(attachment.Key) {
+				return fmt.Errorf("task %d has attachment %d with invalid key %q", task.ID, attachment.ID, attachment.Key)
+			}
+		}
+		if task.CreatedAt.IsZero() {
+			task.CreatedAt = time.Now()
+		}
+		if task.UpdatedAt.IsZero() {
+			task.UpdatedAt = task.CreatedAt
+		}
+		task.DeletedAt = nil
+	}
+	return nil
+}
+
+// validateArchiveProjects checks the projects read from an archive, and
+// that every task's project is among them
+func validateArchiveProjects(projects []*Project, tasks []*Task) error {
+	projectIDs := make(map[int]bool, len(projects))
+	for i, project := range projects {
+		switch {
+		case project == nil:
+			return fmt.Errorf("project %d is null", i)
+		case project.ID <= 0:
+			return fmt.Errorf("project %d has invalid id %d", i, project.ID)
+		case projectIDs[project.ID]:
+			return fmt.Errorf("duplicate project id %d", project.ID)
+		case project.Name == "":
+			return fmt.Errorf("project %d has no name", project.ID)
+		}
+		projectIDs[project.ID] = true
+	}
+	for _, task := range tasks {
+		if task.ProjectID != 0 && !projectIDs[task.ProjectID] {
+			return fmt.Errorf("task %d is in missing project %d", task.ID, task.ProjectID)
+		}
+	}
+	return nil
+}
+
+// handleImport replaces all tasks with those from an export archive,
+// restoring archived ones to the archive. The projects are replaced too,
+// unless the archive predates exports holding them. Attachment files are
+// put in storage before the tasks are replaced, so no task refers to a
+// file that isn't there. The config in the archive is informational and
+// is not applied.
+func (s *Server) handleImport(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, ErrCodeArchiveTooLarge, "Archive too large")
+		return
+	}
+
+	archive, err := readImportArchive(data)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidArchive, "Invalid archive: "+err.Error())
+		return
+	}
+
+	if len(archive.files) > 0 && s.store.files == nil {
+		writeError(w, http.StatusServiceUnavailable, ErrCodeAttachmentsUnavailable, "Attachment storage is not available")
+		return
+	}
+	for _, task := range archive.tasks {
+		for _, attachment := range task.Attachments {
+			content, ok := archive.files[attachment.Key]
+			if !ok {
+				continue
+			}
+			if err := s.store.files.Put(r.Context(), attachment.Key, bytes.NewReader(content), attachment); err != nil {
+				requestLogger(r.Context()).Error("Failed to store attachment", "task_id", task.ID, "key", attachment.Key, "error", err)
+				writeError(w, http.StatusBadGateway, ErrCodeAttachmentStorage, "Failed to store an attachment")
+				return
+			}
+		}
+	}
+
+	if archive.projects != nil {
+		err = s.store.Restore(r.Context(), archive.tasks, archive.projects)
+	} else {
+		err = s.store.Replace(r.Context(), archive.tasks)
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"imported":    len(archive.tasks),
+		"projects":    len(archive.projects),
+		"attachments": len(archive.files),
+	})
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestExportImportRoundTrip(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.TokenHashes = []string{hashString("secret-token")}
+	server.config.APIKey = "legacy-key"
+
+	ctx := context.Background()
+	server.store.Add(ctx, "First", "One", dueOn("2024-12-31"), "high")
+	server.store.Add(ctx, "Second", "Two", DueTime{}, "low")
+
+	w := httptest.NewRecorder()
+	server.handleExport(w, httptest.NewRequest("GET", "/api/v1/admin/export", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("export status = %d; want %d", w.Code, http.StatusOK)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/zip" {
+		t.Errorf("Content-Type = %q; want application/zip", ct)
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, "attachment;") {
+		t.Errorf("Content-Disposition = %q; want attachment", cd)
+	}
+	archive := w.Body.Bytes()
+
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatalf("export is not a zip: %v", err)
+	}
+	for _, f := range zr.File {
+		if f.Name != archiveConfigFile {
+			continue
+		}
+		rc, _ := f.Open()
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		if bytes.Contains(data, []byte(hashString("secret-token"))) || bytes.Contains(data, []byte("legacy-key")) {
+			t.Errorf("exported config leaks secrets: %s", data)
+		}
+	}
+
+	// Wipe the store, then restore from the archive
+	server.store.Delete(ctx, 1)
+	server.store.Delete(ctx, 2)
+	server.store.Add(ctx, "Replaced", "", DueTime{}, "medium")
+
+	w = httptest.NewRecorder()
+	server.handleImport(w, httptest.NewRequest("POST", "/api/v1/admin/import", bytes.NewReader(archive)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("import status = %d; want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	tasks := server.store.GetAll()
+	if len(tasks) != 2 || tasks[0].Title != "First" || tasks[1].Title != "Second" {
+		t.Errorf("tasks after import = %+v; want First, Second", tasks)
+	}
+	next, _ := server.store.Add(ctx, "Next", "", DueTime{}, "medium")
+	if next.ID != 3 {
+		t.Errorf("next ID after import = %d; want 3", next.ID)
+	}
+}
+
+func TestExportImportKeepsArchive(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	ctx := context.Background()
+	server.store.Add(ctx, "Live", "", DueTime{}, "medium")
+	server.store.Add(ctx, "Done", "", DueTime{}, "medium")
+	server.store.Update(ctx, 2, "Done", "", DueTime{}, "medium", "completed")
+	if _, _, err := server.store.Archive(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	server.store.Add(ctx, "Trashed", "", DueTime{}, "medium")
+	server.store.Delete(ctx, 3)
+
+	w := httptest.NewRecorder()
+	server.handleExport(w, httptest.NewRequest("GET", "/api/v1/admin/export", nil))
+	archive := w.Body.Bytes()
+	contents, err := readImportArchive(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tasks := contents.tasks; len(tasks) != 2 || tasks[1].Title != "Done" || tasks[1].ArchivedAt == nil {
+		t.Fatalf("exported tasks = %+v; want Live and the archived Done", contents.tasks)
+	}
+
+	w = httptest.NewRecorder()
+	server.handleImport(w, httptest.NewRequest("POST", "/api/v1/admin/import", bytes.NewReader(archive)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("import status = %d; want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	if live := server.store.GetAll(); len(live) != 1 || live[0].Title != "Live" {
+		t.Errorf("live tasks after import = %+v; want only Live", live)
+	}
+	if archived := server.store.ListArchive(TaskFilter{}); len(archived) != 1 || archived[0].Title != "Done" {
+		t.Errorf("archive after import = %+v; want Done", archived)
+	}
+	if trashed := server.store.Trash(); len(trashed) != 0 {
+		t.Errorf("trash after import = %+v; want it empty", trashed)
+	}
+}
+
+func TestExportImportKeepsProjectsAndAttachments(t *testing.T) {
+	server, r, dir, cleanup := setupAttachmentServer(t)
+	defer cleanup()
+
+	ctx := context.Background()
+	project, _ := server.store.AddProject(ctx, "Home", "")
+	server.store.AddTask(ctx, Task{Title: "With file", Priority: "medium", ProjectID: project.ID})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, uploadRequest(t, "/api/v1/tasks/1/attachments", "notes.txt", "text/plain", []byte("hello")))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("upload status = %d; want %d: %s", w.Code, http.StatusCreated, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	server.handleExport(w, httptest.NewRequest("GET", "/api/v1/admin/export", nil))
+	archive := w.Body.Bytes()
+
+	// Lose the project and the file, then import
+	server.store.DeleteProject(ctx, project.ID)
+	server.store.AddProject(ctx, "Other", "")
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	server.handleImport(w, httptest.NewRequest("POST", "/api/v1/admin/import", bytes.NewReader(archive)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("import status = %d; want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var counts map[string]int
+	json.NewDecoder(w.Body).Decode(&counts)
+	if counts["imported"] != 1 || counts["projects"] != 1 || counts["attachments"] != 1 {
+		t.Errorf("import counts = %v; want 1 task, 1 project, 1 attachment", counts)
+	}
+
+	if projects := server.store.Projects(); len(projects) != 1 || projects[0].Name != "Home" {
+		t.Errorf("projects after import = %+v; want only Home", projects)
+	}
+	if task, _ := server.store.Get(1); task.ProjectID != project.ID {
+		t.Errorf("task project after import = %d; want %d", task.ProjectID, project.ID)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/tasks/1/attachments/1", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "hello" {
+		t.Errorf("download after import = %d %q; want %d hello", w.Code, w.Body.String(), http.StatusOK)
+	}
+}
+
+func TestExportWithoutAttachmentStorage(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.store.files = nil
+
+	ctx := context.Background()
+	server.store.Add(ctx, "With file", "", DueTime{}, "medium")
+	server.store.AddAttachment(ctx, 1, Attachment{Name: "notes.txt", Key: "tasks/1/" + strings.Repeat("ab", 16)})
+
+	w := httptest.NewRecorder()
+	server.handleExport(w, httptest.NewRequest("GET", "/api/v1/admin/export", nil))
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), ErrCodeAttachmentsUnavailable) {
+		t.Errorf("export = %d %s; want %d %s", w.Code, w.Body.String(), http.StatusServiceUnavailable, ErrCodeAttachmentsUnavailable)
+	}
+}
+
+func TestImportRejectsInvalidArchives(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.store.Add(context.Background(), "Keep me", "", DueTime{}, "medium")
+
+	// zipWith takes the entries as name, content pairs
+	zipWith := func(entries ...string) []byte {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		for i := 0; i < len(entries); i += 2 {
+			f, _ := zw.Create(entries[i])
+			f.Write([]byte(entries[i+1]))
+		}
+		zw.Close()
+		return buf.Bytes()
+	}
+	key := "tasks/1/" + strings.Repeat("ab", 16)
+	withFile := `[{"id":1,"title":"a","attachments":[{"id":1,"key":"` + key + `","size":5,"sha256":"` + hashString("hello") + `"}]}]`
+
+	tests := []struct {
+		name string
+		body []byte
+	}{
+		{"not a zip", []byte("hello")},
+		{"missing tasks.json", zipWith("other.json", "[]")},
+		{"malformed tasks.json", zipWith(archiveTasksFile, "{")},
+		{"duplicate ids", zipWith(archiveTasksFile, `[{"id":1,"title":"a"},{"id":1,"title":"b"}]`)},
+		{"missing title", zipWith(archiveTasksFile, `[{"id":1}]`)},
+		{"attachment key outside the store", zipWith(archiveTasksFile, `[{"id":1,"title":"a","attachments":[{"id":1,"key":"../../etc/passwd"}]}]`)},
+		{"task in missing project", zipWith(archiveTasksFile, `[{"id":1,"title":"a","project_id":4}]`, archiveProjectsFile, "[]")},
+		{"file without attachment", zipWith(archiveTasksFile, "[]", archiveAttachmentsDir+key, "hello")},
+		{"file not matching its digest", zipWith(archiveTasksFile, withFile, archiveAttachmentsDir+key, "hullo")},
+		{"file longer than its attachment", zipWith(archiveTasksFile, withFile, archiveAttachmentsDir+key, "hello!")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			server.handleImport(w, httptest.NewRequest("POST", "/api/v1/admin/import", bytes.NewReader(tt.body)))
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d; want %d", w.Code, http.StatusBadRequest)
+			}
+		})
+	}
+
+	tasks := server.store.GetAll()
+	if len(tasks) != 1 || tasks[0].Title != "Keep me" {
+		t.Errorf("store changed by rejected imports: %+v", tasks)
+	}
+}
+
+func TestExportRequiresToken(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	r, err := server.Router()
+	if err != nil {
+		t.Fatalf("Router() error = %v", err)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/admin/export", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("export without token status = %d; want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	var body map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&body)
+	if body["error"] != "Token required" {
+		t.Errorf("error = %v; want Token required", body["error"])
+	}
+}
+
+func TestExportSupportsRangeRequests(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.store.Add(context.Background(), "Resumable", "", DueTime{}, "medium")
+
+	w := httptest.NewRecorder()
+	server.handleExport(w, httptest.NewRequest("GET", "/api/v1/admin/export", nil))
+	full := w.Body.Bytes()
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" || w.Header().Get("Accept-Ranges") != "bytes" {
+		t.Fatalf("full export status = %d, ETag = %q, Accept-Ranges = %q", w.Code, etag, w.Header().Get("Accept-Ranges"))
+	}
+
+	req := httptest.NewRequest("GET", "/api/v1/admin/export", nil)
+	req.Header.Set("Range", "bytes=10-19")
+	req.Header.Set("If-Range", etag)
+	w = httptest.NewRecorder()
+	server.handleExport(w, req)
+
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("range status = %d; want %d", w.Code, http.StatusPartialContent)
+	}
+	if !bytes.Equal(w.Body.Bytes(), full[10:20]) {
+		t.Errorf("range body = %x; want %x", w.Body.Bytes(), full[10:20])
+	}
+
+	// A stale If-Range validator falls back to the full content
+	server.store.Add(context.Background(), "Changed", "", DueTime{}, "medium")
+	w = httptest.NewRecorder()
+	server.handleExport(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("stale If-Range status = %d; want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestConfigSanitized(t *testing.T) {
+	tokenHash := hashString("secret-token")
+	config := &Config{
+		APIKey:       "legacy-key",
+		Port:         "9090",
+		TokenHashes:  []string{tokenHash, hashString("other")},
+		ObfuscateIDs: true,
+		IDSalt:       "pepper",
+	}
+
+	sanitized := config.Sanitized()
+	if sanitized.Port != "9090" || !sanitized.ObfuscateIDs {
+		t.Errorf("non-secret fields not copied: %+v", sanitized)
+	}
+	if !sanitized.APIKeySet || !sanitized.IDSaltSet || sanitized.TokenCount != 2 {
+		t.Errorf("secret presence flags = %+v", sanitized)
+	}
+	if len(sanitized.TokenFingerprints) != 2 || len(sanitized.TokenFingerprints[0]) != 8 {
+		t.Errorf("fingerprints = %v; want 2 of length 8", sanitized.TokenFingerprints)
+	}
+
+	data, err := json.Marshal(sanitized)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	for _, secret := range []string{"legacy-key", "pepper", tokenHash, tokenHash[:8]} {
+		if bytes.Contains(data, []byte(secret)) {
+			t.Errorf("sanitized config leaks %q: %s", secret, data)
+		}
+	}
+}
+
+func TestGetConfigEndpoint(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.TokenHashes = []string{hashString("admin-token")}
+
+	r, err := server.Router()
+	if err != nil {
+		t.Fatalf("Router() error = %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/admin/config", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("without token status = %d; want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	req := httptest.NewRequest("GET", "/api/v1/admin/config", nil)
+	req.Header.Set("X-API-Token", "admin-token")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("with token status = %d; want %d", w.Code, http.StatusOK)
+	}
+	var got SanitizedConfig
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if got.TokenCount != 1 || got.Port != "8080" {
+		t.Errorf("config = %+v; want 1 token on port 8080", got)
+	}
+}
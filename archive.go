@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// archiveInterval is how often completed tasks are checked for archiving
+const archiveInterval = time.Hour
+
+// partitionFor returns the map a stored task belongs in: the trash, the
+// archive or the live tasks. The caller must hold the write lock.
+func (ts *TaskStore) partitionFor(task *Task) map[int]*Task {
+	switch {
+	case task.DeletedAt != nil:
+		return ts.trash
+	case task.ArchivedAt != nil:
+		return ts.archive
+	}
+	return ts.tasks
+}
+
+// Archive moves a completed task out of the live tasks into the archive.
+// It returns ErrTaskOpen if the task isn't completed. Like Update, the bool
+// reports whether the task exists. To everything following the change log
+// an archived task is deleted.
+func (ts *TaskStore) Archive(ctx context.Context, id int) (*Task, bool, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	task, exists := ts.tasks[id]
+	if !exists {
+		return nil, false, nil
+	}
+	if err := ts.checkProjectLocked(ctx, task.ProjectID, PermissionEdit); err != nil {
+		return nil, true, err
+	}
+	if task.Status != "completed" {
+		return nil, true, ErrTaskOpen
+	}
+
+	prev := *task
+	now := ts.now()
+	task.ArchivedAt = &now
+	delete(ts.tasks, id)
+	ts.archive[id] = task
+	if err := ts.save(ctx, id); err != nil {
+		task.ArchivedAt = nil
+		delete(ts.archive, id)
+		ts.tasks[id] = task
+		return nil, true, fmt.Errorf("save tasks: %w", err)
+	}
+	ts.recordChange(ctx, ChangeDeleted, task)
+	ts.recordMutation(ctx, AuditArchive, auditTask, id, &prev, task)
+	return task, true, nil
+}
+
+// ArchiveCompletedBefore archives the tasks completed before cutoff and
+// returns how many were archived. As for retention, tasks without a
+// CompletedAt fall back to UpdatedAt.
+func (ts *TaskStore) ArchiveCompletedBefore(ctx context.Context, cutoff time.Time) (int, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	if err := ts.refreshLocked(ctx); err != nil {
+		return 0, err
+	}
+	completed, err := ts.storage.Query(ctx, StorageQuery{State: TaskLive, Statuses: []string{"completed"}})
+	if err != nil {
+		return 0, fmt.Errorf("query completed tasks: %w", err)
+	}
+	now := ts.now()
+	var archived []*Task
+	for _, found := range completed {
+		task, exists := ts.tasks[found.ID]
+		if !exists || task.Status != "completed" || !completedBefore(task, cutoff) {
+			continue
+		}
+		task.ArchivedAt = &now
+		delete(ts.tasks, task.ID)
+		ts.archive[task.ID] = task
+		archived = append(archived, task)
+	}
+	if len(archived) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]int, len(archived))
+	for i, task := range archived {
+		ids[i] = task.ID
+	}
+	if err := ts.save(ctx, ids...); err != nil {
+		for _, task := range archived {
+			task.ArchivedAt = nil
+			delete(ts.archive, task.ID)
+			ts.tasks[task.ID] = task
+		}
+		return 0, fmt.Errorf("save tasks: %w", err)
+	}
+	for _, task := range archived {
+		ts.recordChange(ctx, ChangeDeleted, task)
+		before := *task
+		before.ArchivedAt = nil
+		ts.recordMutation(ctx, AuditArchive, auditTask, task.ID, &before, task)
+	}
+	return len(archived), nil
+}
+
+// completedBefore reports whether task was completed before cutoff, using
+// UpdatedAt for tasks completed before CompletedAt was tracked
+func completedBefore(task *Task, cutoff time.Time) bool {
+	completedAt := task.UpdatedAt
+	if task.CompletedAt != nil {
+		completedAt = *task.CompletedAt
+	}
+	return completedAt.Before(cutoff)
+}
+
+// ListArchive returns the archived tasks matching filter in ID order
+func (ts *TaskStore) ListArchive(filter TaskFilter) []*Task {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	tasks := make([]*Task, 0)
+	for _, task := range ts.archive {
+		if filter.matches(task) {
+			tasks = append(tasks, task)
+		}
+	}
+	sortByID(tasks)
+	return tasks
+}
+
+// archiveCompletedTasks archives completed tasks older than the configured
+// window, logging how many were moved
+func (s *Server) archiveCompletedTasks(ctx context.Context) {
+	days := s.config.ArchiveCompletedAfterDays
+	if days <= 0 {
+		return
+	}
+	count, err := s.store.ArchiveCompletedBefore(ctx, s.now().AddDate(0, 0, -days))
+	if err != nil {
+		slog.Error("Archiving completed tasks failed", "error", err)
+		return
+	}
+	if count > 0 {
+		slog.Info("Archived completed tasks", "count", count, "older_than_days", days)
+	}
+}
+
+// runArchiver archives once immediately and then on every tick of interval
+// until ctx is cancelled. It does nothing when archiving is off.
+func (s *Server) runArchiver(ctx context.Context, interval time.Duration) {
+	if s.config.ArchiveCompletedAfterDays <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	s.archiveCompletedTasks(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.archiveCompletedTasks(ctx)
+		}
+	}
+}
+
+// handleGetArchive lists archived tasks. It takes the same filter, sort,
+// pagination and format parameters as GET /tasks.
+func (s *Server) handleGetArchive(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseTaskFilter(r.URL.Query(), s.requestLocation(r))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidQuery, err.Error())
+		return
+	}
+	s.writeTaskList(w, r, s.store.ListArchive(filter))
+}
+
+// handleArchiveTask moves a completed task into the archive
+func (s *Server) handleArchiveTask(w http.ResponseWriter, r *http.Request) {
+	id, err := s.parseTaskID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidTaskID, "Invalid task ID")
+		return
+	}
+
+	task, exists, err := s.store.Archive(r.Context(), id)
+	if errors.Is(err, ErrTaskOpen) {
+		writeError(w, http.StatusConflict, ErrCodeTaskOpen, "Task is not completed")
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if !exists {
+		writeError(w, http.StatusNotFound, ErrCodeTaskNotFound, "Task not found")
+		return
+	}
+	taskOps.Add("archive", 1)
+
+	writeJSON(w, http.StatusOK, s.presentTask(task))
+}
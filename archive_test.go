@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestArchiveTask(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	ctx := context.Background()
+	server.store.Add(ctx, "Done", "", DueTime{}, "high")
+	server.store.Update(ctx, 1, "Done", "", DueTime{}, "high", "completed")
+	server.store.Add(ctx, "Open", "", DueTime{}, "medium")
+
+	archive := func(id string) *httptest.ResponseRecorder {
+		req := mux.SetURLVars(httptest.NewRequest("POST", "/api/v1/tasks/"+id+"/archive", nil), map[string]string{"id": id})
+		w := httptest.NewRecorder()
+		server.handleArchiveTask(w, req)
+		return w
+	}
+
+	if w := archive("2"); w.Code != http.StatusConflict {
+		t.Errorf("archive open task status = %d; want %d", w.Code, http.StatusConflict)
+	}
+	if w := archive("9"); w.Code != http.StatusNotFound {
+		t.Errorf("archive missing task status = %d; want %d", w.Code, http.StatusNotFound)
+	}
+	w := archive("1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("archive status = %d; want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var archived map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&archived)
+	if archived["archived_at"] == nil {
+		t.Errorf("archived task = %v; want archived_at", archived)
+	}
+
+	if _, exists := server.store.Get(1); exists {
+		t.Error("archived task still in the task list")
+	}
+	w = httptest.NewRecorder()
+	server.handleGetArchive(w, httptest.NewRequest("GET", "/api/v1/tasks/archive?priority=high", nil))
+	var list []map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&list)
+	if len(list) != 1 || list[0]["title"] != "Done" {
+		t.Errorf("archive = %v; want Done", list)
+	}
+	w = httptest.NewRecorder()
+	server.handleGetArchive(w, httptest.NewRequest("GET", "/api/v1/tasks/archive?priority=low", nil))
+	if body := w.Body.String(); body != "[]\n" {
+		t.Errorf("filtered archive = %s; want []", body)
+	}
+
+	reloaded := NewTaskStore("test_tasks.json")
+	if tasks := reloaded.ListArchive(TaskFilter{}); len(tasks) != 1 || tasks[0].ID != 1 {
+		t.Errorf("archive after reload = %+v; want task 1", tasks)
+	}
+	if _, exists := reloaded.Get(1); exists {
+		t.Error("archived task is live after reload")
+	}
+}
+
+func TestArchiverMovesAgedCompletedTasks(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.ArchiveCompletedAfterDays = 7
+
+	now := time.Date(2024, time.March, 20, 12, 0, 0, 0, time.UTC)
+	server.now = func() time.Time { return now }
+	completeAt(t, server.store, now.AddDate(0, 0, -10)) // aged, archived
+	completeAt(t, server.store, now.AddDate(0, 0, -2))  // fresh, kept
+	server.store.Add(context.Background(), "Pending", "", DueTime{}, "low")
+
+	server.archiveCompletedTasks(context.Background())
+
+	if _, exists := server.store.Get(1); exists {
+		t.Error("aged completed task should have been archived")
+	}
+	if _, exists := server.store.Get(2); !exists {
+		t.Error("recently completed task should stay in the task list")
+	}
+	if tasks := server.store.ListArchive(TaskFilter{}); len(tasks) != 1 || tasks[0].ID != 1 {
+		t.Errorf("archive = %+v; want task 1", tasks)
+	}
+}
+
+func TestArchiverDisabled(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	now := time.Date(2024, time.March, 20, 12, 0, 0, 0, time.UTC)
+	server.now = func() time.Time { return now }
+	completeAt(t, server.store, now.AddDate(-1, 0, 0))
+
+	server.archiveCompletedTasks(context.Background())
+
+	if _, exists := server.store.Get(1); !exists {
+		t.Error("task archived with archiving disabled")
+	}
+}
+
+func TestRetentionDeletesArchivedTasks(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	now := time.Date(2024, time.March, 20, 12, 0, 0, 0, time.UTC)
+	completeAt(t, server.store, now.AddDate(0, 0, -10))
+	if _, _, err := server.store.Archive(context.Background(), 1); err != nil {
+		t.Fatalf("Archive() error = %v", err)
+	}
+
+	count, err := server.store.DeleteCompletedBefore(context.Background(), now.AddDate(0, 0, -7))
+	if err != nil || count != 1 {
+		t.Fatalf("DeleteCompletedBefore() = %d, %v; want 1", count, err)
+	}
+	if tasks := server.store.ListArchive(TaskFilter{}); len(tasks) != 0 {
+		t.Errorf("archive = %+v; want empty", tasks)
+	}
+}
+
+func TestDeleteProjectWithArchivedTask(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	ctx := context.Background()
+	project, _ := server.store.AddProject(ctx, "Old", "")
+	server.store.AddTask(ctx, Task{Title: "Done", ProjectID: project.ID})
+	server.store.Update(ctx, 1, "Done", "", DueTime{}, "medium", "completed")
+	server.store.Archive(ctx, 1)
+
+	if _, err := server.store.DeleteProject(ctx, project.ID); err != ErrProjectNotEmpty {
+		t.Errorf("DeleteProject() error = %v; want ErrProjectNotEmpty", err)
+	}
+}
+
+func TestBackupKeepsArchive(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	ctx := context.Background()
+	server.store.Add(ctx, "Done", "", DueTime{}, "medium")
+	server.store.Update(ctx, 1, "Done", "", DueTime{}, "medium", "completed")
+	server.store.Archive(ctx, 1)
+	server.store.Add(ctx, "Open", "", DueTime{}, "medium")
+
+	archive, err := server.buildBackup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, tasks, projects, err := readBackupArchive(archive)
+	if err != nil {
+		t.Fatalf("readBackupArchive() error = %v", err)
+	}
+	if err := server.store.Restore(ctx, tasks, projects); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if live := server.store.GetAll(); len(live) != 1 || live[0].Title != "Open" {
+		t.Errorf("live tasks = %+v; want Open", live)
+	}
+	if archived := server.store.ListArchive(TaskFilter{}); len(archived) != 1 || archived[0].Title != "Done" {
+		t.Errorf("archive = %+v; want Done", archived)
+	}
+}
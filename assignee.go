@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// validateAssignee checks that assignee names a user as the audit log
+// does, "token:<id>" or "user:<subject>". Errors are *validationError.
+func validateAssignee(assignee string) error {
+	for _, prefix := range []string{"token:", "user:"} {
+		if rest, ok := strings.CutPrefix(assignee, prefix); ok && strings.TrimSpace(rest) != "" {
+			return nil
+		}
+	}
+	return &validationError{ErrCodeInvalidAssignee, "assignee must be token:<id> or user:<subject>"}
+}
+
+// Assign sets the task's assignee, named as in the audit log; "" unassigns
+// it. Like Update, the bool reports whether the task exists.
+func (ts *TaskStore) Assign(ctx context.Context, id int, assignee string) (*Task, bool, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	task, exists := ts.tasks[id]
+	if !exists {
+		return nil, false, nil
+	}
+	if err := ts.checkProjectLocked(ctx, task.ProjectID, PermissionEdit); err != nil {
+		return nil, true, err
+	}
+	if task.Assignee == assignee {
+		return task, true, nil
+	}
+
+	prev := *task
+	task.Assignee = assignee
+	task.UpdatedAt = ts.now()
+	if err := ts.save(ctx, id); err != nil {
+		*task = prev
+		return nil, true, fmt.Errorf("save tasks: %w", err)
+	}
+	ts.recordChange(ctx, ChangeUpdated, task)
+	ts.recordMutation(ctx, AuditUpdate, auditTask, id, &prev, task)
+	return task, true, nil
+}
+
+// notifyAssignee emails the task's assignee that by assigned it to them in
+// the background. Nothing is sent to users who assign themselves.
+func (s *Server) notifyAssignee(task *Task, by string) {
+	if task.Assignee == "" || task.Assignee == by {
+		return
+	}
+	assigned := *task
+	go func() {
+		if err := s.notifyAssigned(&assigned, assigned.Assignee, by); err != nil {
+			slog.Warn("Assignment email failed", "task_id", assigned.ID, "assignee", assigned.Assignee, "error", err)
+		}
+	}()
+}
+
+// assignRequest is the body accepted by the assign endpoint
+type assignRequest struct {
+	// Assignee is the user to assign, as in the audit log; omitted, the
+	// task is assigned to the caller
+	Assignee string `json:"assignee"`
+}
+
+// handleAssignTask assigns a task to a user, or to the caller
+func (s *Server) handleAssignTask(w http.ResponseWriter, r *http.Request) {
+	id, err := s.parseTaskID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidTaskID, "Invalid task ID")
+		return
+	}
+
+	var req assignRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	caller := auditActor(r.Context())
+	if req.Assignee == "" {
+		req.Assignee = caller
+	}
+	if err := validateAssignee(req.Assignee); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	var previous string
+	if task, exists := s.store.Get(id); exists {
+		previous = task.Assignee
+	}
+	task, exists, err := s.store.Assign(r.Context(), id, req.Assignee)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if !exists {
+		writeError(w, http.StatusNotFound, ErrCodeTaskNotFound, "Task not found")
+		return
+	}
+	taskOps.Add("assign", 1)
+	if previous != task.Assignee {
+		s.notifyAssignee(task, caller)
+	}
+
+	writeJSON(w, http.StatusOK, s.presentTask(task))
+}
+
+// handleUnassignTask clears a task's assignee
+func (s *Server) handleUnassignTask(w http.ResponseWriter, r *http.Request) {
+	id, err := s.parseTaskID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidTaskID, "Invalid task ID")
+		return
+	}
+
+	task, exists, err := s.store.Assign(r.Context(), id, "")
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if !exists {
+		writeError(w, http.StatusNotFound, ErrCodeTaskNotFound, "Task not found")
+		return
+	}
+	taskOps.Add("assign", 1)
+
+	writeJSON(w, http.StatusOK, s.presentTask(task))
+}
+
+// handleGetAssignedTasks returns the tasks assigned to the caller, taking
+// the same filters as the task list
+func (s *Server) handleGetAssignedTasks(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseTaskFilter(r.URL.Query(), s.requestLocation(r))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidQuery, err.Error())
+		return
+	}
+	filter.Assignee = auditActor(r.Context())
+	s.writeTaskList(w, r, s.store.List(filter))
+}
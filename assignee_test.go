@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAssignTasks(t *testing.T) {
+	server, _, cleanup := setupMailServer(t)
+	defer cleanup()
+	alice, bob := hashString("alice-token"), hashString("bob-token")
+	server.config.TokenHashes = []string{alice, bob}
+	aliceUser, bobUser := "token:"+tokenID(alice), "token:"+tokenID(bob)
+	server.config.SMTP.Recipients = map[string]string{bobUser: "bob@example.com"}
+	mailed := make(chan string, 4)
+	server.sendMail = func(_ string, _ smtp.Auth, _ string, to []string, msg []byte) error {
+		mailed <- to[0] + "\n" + string(msg)
+		return nil
+	}
+	r, err := server.Router()
+	if err != nil {
+		t.Fatal(err)
+	}
+	send := func(token, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("X-API-Token", token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	assignee := func(w *httptest.ResponseRecorder) string {
+		var task Task
+		json.NewDecoder(w.Body).Decode(&task)
+		return task.Assignee
+	}
+
+	ctx := context.Background()
+	server.store.Add(ctx, "Write docs", "", DueTime{}, "medium")
+	server.store.Add(ctx, "Fix login", "", DueTime{}, "high")
+
+	// Alice assigns a task to Bob, who is emailed
+	w := send("alice-token", "POST", "/api/v1/tasks/1/assign", `{"assignee": "`+bobUser+`"}`)
+	if w.Code != http.StatusOK || assignee(w) != bobUser {
+		t.Fatalf("assign to bob: status %d: %s", w.Code, w.Body.String())
+	}
+	select {
+	case msg := <-mailed:
+		if !strings.HasPrefix(msg, "bob@example.com\n") || !strings.Contains(msg, aliceUser+" assigned") {
+			t.Errorf("assignment email:\n%s", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no assignment email")
+	}
+
+	// Without a body the task is assigned to the caller, who isn't emailed
+	if w := send("alice-token", "POST", "/api/v1/tasks/2/assign", ""); w.Code != http.StatusOK || assignee(w) != aliceUser {
+		t.Fatalf("assign to self: status %d: %s", w.Code, w.Body.String())
+	}
+	if w := send("alice-token", "POST", "/api/v1/tasks", `{"title": "Review PR", "assignee": "`+bobUser+`"}`); w.Code != http.StatusCreated || assignee(w) != bobUser {
+		t.Fatalf("create assigned: status %d: %s", w.Code, w.Body.String())
+	}
+	select {
+	case <-mailed:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no email for a task created assigned")
+	}
+
+	w = send("bob-token", "GET", "/api/v1/tasks/assigned-to-me", "")
+	var mine []Task
+	json.NewDecoder(w.Body).Decode(&mine)
+	if w.Code != http.StatusOK || len(mine) != 2 || mine[0].Title != "Write docs" || mine[1].Title != "Review PR" {
+		t.Errorf("bob's tasks: status %d: %+v", w.Code, mine)
+	}
+	w = send("bob-token", "GET", "/api/v1/tasks/assigned-to-me?priority=high", "")
+	if json.NewDecoder(w.Body).Decode(&mine); len(mine) != 0 {
+		t.Errorf("bob's high-priority tasks = %+v; want none", mine)
+	}
+	if w := send("", "GET", "/api/v1/tasks/assigned-to-me", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("without a token: status %d; want 401", w.Code)
+	}
+	w = send("", "GET", "/api/v1/tasks?assignee="+aliceUser, "")
+	var listed []Task
+	if json.NewDecoder(w.Body).Decode(&listed); len(listed) != 1 || listed[0].Title != "Fix login" {
+		t.Errorf("?assignee=alice = %+v", listed)
+	}
+
+	if w := send("bob-token", "POST", "/api/v1/tasks/1/unassign", ""); w.Code != http.StatusOK || assignee(w) != "" {
+		t.Errorf("unassign: status %d: %s", w.Code, w.Body.String())
+	}
+	if revisions, _ := server.store.History(1); len(revisions) == 0 || revisions[0].Actor != bobUser {
+		t.Errorf("unassigning isn't in the task's history")
+	}
+
+	for _, tt := range []struct {
+		method, path, body string
+		want               int
+	}{
+		{"POST", "/api/v1/tasks/1/assign", `{"assignee": "bob"}`, http.StatusUnprocessableEntity},
+		{"POST", "/api/v1/tasks", `{"title": "X", "assignee": "user:"}`, http.StatusUnprocessableEntity},
+		{"POST", "/api/v1/tasks/1/assign", `{"assignee": 1}`, http.StatusBadRequest},
+		{"POST", "/api/v1/tasks/99/assign", "", http.StatusNotFound},
+		{"POST", "/api/v1/tasks/99/unassign", "", http.StatusNotFound},
+	} {
+		if w := send("alice-token", tt.method, tt.path, tt.body); w.Code != tt.want {
+			t.Errorf("%s %s %s: status %d; want %d", tt.method, tt.path, tt.body, w.Code, tt.want)
+		}
+	}
+}
+
+func TestAssigneeDefaultsAndStats(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.TaskDefaults.Assignee = "user:triage"
+
+	fields, err := server.newTaskFields(&createTaskRequest{Title: "Triage me"}, time.UTC)
+	if err != nil || fields.Assignee != "user:triage" {
+		t.Fatalf("default assignee = %q, %v", fields.Assignee, err)
+	}
+	fields, _ = server.newTaskFields(&createTaskRequest{Title: "Mine", Assignee: "user:alice"}, time.UTC)
+	if fields.Assignee != "user:alice" {
+		t.Errorf("request assignee = %q; want it to win over the default", fields.Assignee)
+	}
+
+	ctx := context.Background()
+	server.store.AddTask(ctx, Task{Title: "A", Priority: "medium", Assignee: "user:alice"})
+	server.store.AddTask(ctx, Task{Title: "B", Priority: "medium", Assignee: "user:alice"})
+	server.store.AddTask(ctx, Task{Title: "C", Priority: "medium", Assignee: "user:bob"})
+	server.store.AddTask(ctx, Task{Title: "D", Priority: "medium"})
+	groups, ok := server.store.StatsGrouped("assignee", time.Now())
+	if !ok || len(groups) != 2 || groups[0].Key != "user:alice" || groups[0].Total != 2 || groups[1].Key != "user:bob" {
+		t.Errorf("stats by assignee = %+v", groups)
+	}
+}
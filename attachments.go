@@ -0,0 +1,477 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Defaults for attachments
+const (
+	defaultAttachmentDir     = "attachments"
+	defaultAttachmentMaxSize = 10
+	// attachmentFormOverhead allows for the multipart framing around the
+	// file when limiting the request body
+	attachmentFormOverhead = 1 << 20
+	// attachmentMemory is how much of an upload is held in memory; the
+	// rest is spooled to a temporary file
+	attachmentMemory = 1 << 20
+)
+
+// ErrAttachmentNotFound is returned when a task has no attachment with the
+// given ID, or its file is missing from storage
+var ErrAttachmentNotFound = errors.New("attachment not found")
+
+// Attachment describes a file uploaded to a task. The file itself is kept
+// in the configured AttachmentStore under Key; IDs are unique within their
+// task only.
+type Attachment struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	// SHA256 is the hex digest of the file
+	SHA256 string `json:"sha256"`
+	// Key is where the file is kept in the attachment store
+	Key        string    `json:"key"`
+	UploadedBy string    `json:"uploaded_by"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// AttachmentConfig selects where uploaded files are kept
+type AttachmentConfig struct {
+	// Storage is "disk" (default, under Dir) or "s3"
+	Storage string `json:"storage,omitempty"`
+	// Dir is where disk storage keeps files (default: attachments)
+	Dir string `json:"dir,omitempty"`
+	// MaxSizeMB caps the size of one upload (default: 10)
+	MaxSizeMB int      `json:"max_size_mb,omitempty"`
+	S3        S3Config `json:"s3"`
+}
+
+// maxSize returns the upload limit in bytes
+func (c AttachmentConfig) maxSize() int64 {
+	if c.MaxSizeMB <= 0 {
+		return defaultAttachmentMaxSize << 20
+	}
+	return int64(c.MaxSizeMB) << 20
+}
+
+// AttachmentStore keeps the files of attachments, addressed by key
+type AttachmentStore interface {
+	// Put stores the file read from body, which holds attachment.Size
+	// bytes with the digest attachment.SHA256
+	Put(ctx context.Context, key string, body io.Reader, attachment Attachment) error
+	// Open returns the file under key, or ErrAttachmentNotFound
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the file under key; a missing file is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// AttachmentStoreOpener builds an attachment store from the config,
+// failing if the config is incomplete for it
+type AttachmentStoreOpener func(config *AttachmentConfig) (AttachmentStore, error)
+
+// attachmentStoreOpeners holds the stores selectable in
+// attachments.storage
+var attachmentStoreOpeners = make(map[string]AttachmentStoreOpener)
+
+// RegisterAttachmentStore makes an attachment store selectable by name.
+// Like RegisterBackend it is meant for init functions and panics on a
+// duplicate name.
+func RegisterAttachmentStore(name string, open AttachmentStoreOpener) {
+	if _, dup := attachmentStoreOpeners[name]; dup {
+		panic("attachments: store " + name + " registered twice")
+	}
+	attachmentStoreOpeners[name] = open
+}
+
+func init() {
+	RegisterAttachmentStore("disk", func(config *AttachmentConfig) (AttachmentStore, error) {
+		dir := config.Dir
+		if dir == "" {
+			dir = defaultAttachmentDir
+		}
+		return diskAttachmentStore{dir: dataPath(dir)}, nil
+	})
+}
+
+// openAttachmentStore builds the configured attachment store
+func openAttachmentStore(config *AttachmentConfig) (AttachmentStore, error) {
+	name := config.Storage
+	if name == "" {
+		name = "disk"
+	}
+	open, ok := attachmentStoreOpeners[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown attachment storage %q", name)
+	}
+	return open(config)
+}
+
+// diskAttachmentStore keeps files in a directory, one per key. The
+// directory is created on the first upload.
+type diskAttachmentStore struct {
+	dir string
+}
+
+// path returns the file for key, which attachment keys keep inside dir
+func (d diskAttachmentStore) path(key string) string {
+	return filepath.Join(d.dir, filepath.FromSlash(key))
+}
+
+// Put writes the file through a temporary file, so a failed upload leaves
+// nothing behind
+func (d diskAttachmentStore) Put(_ context.Context, key string, body io.Reader, _ Attachment) error {
+	path := d.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Open opens the file for key
+func (d diskAttachmentStore) Open(_ context.Context, key string) (io.ReadCloser, error) {
+	file, err := os.Open(d.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrAttachmentNotFound
+	}
+	return file, err
+}
+
+// Delete removes the file for key
+func (d diskAttachmentStore) Delete(_ context.Context, key string) error {
+	err := os.Remove(d.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// attachmentKeyPattern matches the keys newAttachmentKey makes. Keys read
+// from an archive must match it, so they can't point outside the store.
+var attachmentKeyPattern = regexp.MustCompile(`^tasks/[0-9]+/[0-9a-f]{32}$`)
+
+// newAttachmentKey returns a fresh storage key for a file on task id. The
+// random part keeps a key from being reused once its attachment is gone.
+func newAttachmentKey(id int) (string, error) {
+	suffix, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("tasks/%d/%s", id, suffix[:32]), nil
+}
+
+// changeAttachments replaces the task's attachments with the result of
+// change, which like the one passed to changeSubtasks must return a new
+// slice. Like Update, the bool reports whether the task exists.
+func (ts *TaskStore) changeAttachments(ctx context.Context, id int, change func([]Attachment) ([]Attachment, error)) (*Task, bool, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	task, exists := ts.tasks[id]
+	if !exists {
+		return nil, false, nil
+	}
+	if err := ts.checkProjectLocked(ctx, task.ProjectID, PermissionEdit); err != nil {
+		return nil, true, err
+	}
+	attachments, err := change(task.Attachments)
+	if err != nil {
+		return nil, true, err
+	}
+
+	prev := *task
+	task.Attachments = attachments
+	task.UpdatedAt = ts.now()
+	if err := ts.save(ctx, id); err != nil {
+		*task = prev
+		return nil, true, fmt.Errorf("save tasks: %w", err)
+	}
+	ts.recordChange(ctx, ChangeUpdated, task)
+	ts.recordMutation(ctx, AuditUpdate, auditTask, id, &prev, task)
+	return task, true, nil
+}
+
+// AddAttachment records a file already stored under attachment.Key on a
+// live task, giving it the next ID and the actor of ctx as its uploader
+func (ts *TaskStore) AddAttachment(ctx context.Context, id int, attachment Attachment) (*Attachment, bool, error) {
+	_, exists, err := ts.changeAttachments(ctx, id, func(current []Attachment) ([]Attachment, error) {
+		attachment.ID = 1
+		for _, a := range current {
+			if a.ID >= attachment.ID {
+				attachment.ID = a.ID + 1
+			}
+		}
+		attachment.UploadedBy = auditActor(ctx)
+		attachment.CreatedAt = ts.now()
+		return append(append(make([]Attachment, 0, len(current)+1), current...), attachment), nil
+	})
+	if err != nil || !exists {
+		return nil, exists, err
+	}
+	return &attachment, true, nil
+}
+
+// Attachment returns an attachment of a live task. It returns
+// ErrAttachmentNotFound if the task has no such attachment.
+func (ts *TaskStore) Attachment(id, attachmentID int) (*Attachment, bool, error) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	task, exists := ts.tasks[id]
+	if !exists {
+		return nil, false, nil
+	}
+	for _, a := range task.Attachments {
+		if a.ID == attachmentID {
+			attachment := a
+			return &attachment, true, nil
+		}
+	}
+	return nil, true, ErrAttachmentNotFound
+}
+
+// RemoveAttachment drops an attachment from a live task and returns it, so
+// the caller can delete its file. It returns ErrAttachmentNotFound if the
+// task has no such attachment.
+func (ts *TaskStore) RemoveAttachment(ctx context.Context, id, attachmentID int) (*Attachment, bool, error) {
+	var removed Attachment
+	_, exists, err := ts.changeAttachments(ctx, id, func(current []Attachment) ([]Attachment, error) {
+		attachments := make([]Attachment, 0, len(current))
+		for _, a := range current {
+			if a.ID == attachmentID {
+				removed = a
+				continue
+			}
+			attachments = append(attachments, a)
+		}
+		if len(attachments) == len(current) {
+			return nil, ErrAttachmentNotFound
+		}
+		return attachments, nil
+	})
+	if err != nil || !exists {
+		return nil, exists, err
+	}
+	return &removed, true, nil
+}
+
+// deleteAttachmentFiles removes the files of a purged task's attachments.
+// The task is gone by then, so failures are logged. The caller must hold
+// the write lock.
+func (ts *TaskStore) deleteAttachmentFiles(ctx context.Context, task *Task) {
+	if ts.files == nil || task == nil {
+		return
+	}
+	for _, a := range task.Attachments {
+		if err := ts.files.Delete(ctx, a.Key); err != nil {
+			requestLogger(ctx).Error("Failed to delete attachment file", "task_id", task.ID, "key", a.Key, "error", err)
+		}
+	}
+}
+
+// writeAttachmentError maps errors from the attachment store methods to
+// responses
+func writeAttachmentError(w http.ResponseWriter, exists bool, err error) {
+	switch {
+	case errors.Is(err, ErrAttachmentNotFound):
+		writeError(w, http.StatusNotFound, ErrCodeAttachmentNotFound, "Attachment not found")
+	case err != nil:
+		writeStoreError(w, err)
+	case !exists:
+		writeError(w, http.StatusNotFound, ErrCodeTaskNotFound, "Task not found")
+	}
+}
+
+// parseAttachmentIDs reads the task and attachment IDs from the URL,
+// writing a 400 response when either is invalid
+func (s *Server) parseAttachmentIDs(w http.ResponseWriter, r *http.Request) (id, attachmentID int, ok bool) {
+	id, err := s.parseTaskID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidTaskID, "Invalid task ID")
+		return 0, 0, false
+	}
+	attachmentID, err = strconv.Atoi(mux.Vars(r)["aid"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidAttachmentID, "Invalid attachment ID")
+		return 0, 0, false
+	}
+	return id, attachmentID, true
+}
+
+// handleUploadAttachment stores the file in the "file" field of a
+// multipart form and attaches it to a task
+func (s *Server) handleUploadAttachment(w http.ResponseWriter, r *http.Request) {
+	id, err := s.parseTaskID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidTaskID, "Invalid task ID")
+		return
+	}
+	if s.store.files == nil {
+		writeError(w, http.StatusServiceUnavailable, ErrCodeAttachmentsUnavailable, "Attachment storage is not available")
+		return
+	}
+	if _, exists := s.store.Get(id); !exists {
+		writeError(w, http.StatusNotFound, ErrCodeTaskNotFound, "Task not found")
+		return
+	}
+
+	maxSize := s.config.Attachments.maxSize()
+	tooLarge := fmt.Sprintf("Attachments must be at most %d MB", maxSize>>20)
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+attachmentFormOverhead)
+	if err := r.ParseMultipartForm(attachmentMemory); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			writeError(w, http.StatusRequestEntityTooLarge, ErrCodeAttachmentTooLarge, tooLarge)
+			return
+		}
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidAttachment, "Expected a multipart form with the file in a \"file\" field")
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidAttachment, "Expected a multipart form with the file in a \"file\" field")
+		return
+	}
+	defer file.Close()
+	if header.Size > maxSize {
+		writeError(w, http.StatusRequestEntityTooLarge, ErrCodeAttachmentTooLarge, tooLarge)
+		return
+	}
+
+	attachment := Attachment{
+		Name:        filepath.Base(strings.ReplaceAll(header.Filename, `\`, "/")),
+		ContentType: header.Header.Get("Content-Type"),
+		Size:        header.Size,
+	}
+	if attachment.Name == "." || attachment.Name == "/" {
+		attachment.Name = "attachment"
+	}
+	if _, _, err := mime.ParseMediaType(attachment.ContentType); err != nil {
+		attachment.ContentType = "application/octet-stream"
+	}
+	digest := sha256.New()
+	if _, err := io.Copy(digest, file); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidAttachment, "Could not read the uploaded file")
+		return
+	}
+	attachment.SHA256 = hex.EncodeToString(digest.Sum(nil))
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	attachment.Key, err = newAttachmentKey(id)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	if err := s.store.files.Put(r.Context(), attachment.Key, file, attachment); err != nil {
+		requestLogger(r.Context()).Error("Failed to store attachment", "task_id", id, "error", err)
+		writeError(w, http.StatusBadGateway, ErrCodeAttachmentStorage, "Failed to store the attachment")
+		return
+	}
+	added, exists, err := s.store.AddAttachment(r.Context(), id, attachment)
+	if err != nil || !exists {
+		// Deleted meanwhile, or the task couldn't be saved
+		if err := s.store.files.Delete(context.WithoutCancel(r.Context()), attachment.Key); err != nil {
+			requestLogger(r.Context()).Error("Failed to delete attachment file", "task_id", id, "key", attachment.Key, "error", err)
+		}
+		writeAttachmentError(w, exists, err)
+		return
+	}
+	taskOps.Add("update", 1)
+	writeJSON(w, http.StatusCreated, added)
+}
+
+// handleDownloadAttachment sends an attachment's file. It is always sent
+// as a download with sniffing off, so an uploaded page can't run as part
+// of the API's origin.
+func (s *Server) handleDownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	id, attachmentID, ok := s.parseAttachmentIDs(w, r)
+	if !ok {
+		return
+	}
+	attachment, exists, err := s.store.Attachment(id, attachmentID)
+	if err != nil || !exists {
+		writeAttachmentError(w, exists, err)
+		return
+	}
+	if s.store.files == nil {
+		writeError(w, http.StatusServiceUnavailable, ErrCodeAttachmentsUnavailable, "Attachment storage is not available")
+		return
+	}
+	file, err := s.store.files.Open(r.Context(), attachment.Key)
+	if errors.Is(err, ErrAttachmentNotFound) {
+		writeAttachmentError(w, true, err)
+		return
+	}
+	if err != nil {
+		requestLogger(r.Context()).Error("Failed to read attachment", "task_id", id, "key", attachment.Key, "error", err)
+		writeError(w, http.StatusBadGateway, ErrCodeAttachmentStorage, "Failed to read the attachment")
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("ETag", `"`+attachment.SHA256+`"`)
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, file); err != nil {
+		requestLogger(r.Context()).Warn("Attachment download interrupted", "task_id", id, "error", err)
+	}
+}
+
+// handleDeleteAttachment removes an attachment and its file
+func (s *Server) handleDeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	id, attachmentID, ok := s.parseAttachmentIDs(w, r)
+	if !ok {
+		return
+	}
+	removed, exists, err := s.store.RemoveAttachment(r.Context(), id, attachmentID)
+	if err != nil || !exists {
+		writeAttachmentError(w, exists, err)
+		return
+	}
+	// The attachment is gone from the task either way; a file left behind
+	// only takes up space
+	if s.store.files != nil {
+		if err := s.store.files.Delete(r.Context(), removed.Key); err != nil {
+			requestLogger(r.Context()).Error("Failed to delete attachment file", "task_id", id, "key", removed.Key, "error", err)
+		}
+	}
+	taskOps.Add("update", 1)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// uploadRequest builds a multipart POST of content as the "file" field
+func uploadRequest(t *testing.T, path, name, contentType string, content []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	header := make(map[string][]string)
+	header["Content-Disposition"] = []string{`form-data; name="file"; filename="` + name + `"`}
+	header["Content-Type"] = []string{contentType}
+	part, err := form.CreatePart(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(content)
+	form.Close()
+	req := httptest.NewRequest("POST", path, &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set("X-API-Token", "secret-token")
+	return req
+}
+
+// setupAttachmentServer returns a test server keeping attachments in a
+// temporary directory, and its router
+func setupAttachmentServer(t *testing.T) (*Server, http.Handler, string, func()) {
+	t.Helper()
+	server, cleanup := setupTestServer()
+	dir := t.TempDir()
+	server.store.files = diskAttachmentStore{dir: dir}
+	server.config.TokenHashes = []string{hashString("secret-token")}
+	r, err := server.Router()
+	if err != nil {
+		cleanup()
+		t.Fatalf("Router() error = %v", err)
+	}
+	return server, r, dir, cleanup
+}
+
+func TestTaskAttachments(t *testing.T) {
+	server, r, dir, cleanup := setupAttachmentServer(t)
+	defer cleanup()
+	server.store.Add(context.Background(), "With files", "", DueTime{}, "medium")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, uploadRequest(t, "/api/v1/tasks/1/attachments", "notes.txt", "text/plain", []byte("hello")))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("upload status = %d; want %d: %s", w.Code, http.StatusCreated, w.Body.String())
+	}
+	var uploaded Attachment
+	json.NewDecoder(w.Body).Decode(&uploaded)
+	if uploaded.ID != 1 || uploaded.Name != "notes.txt" || uploaded.Size != 5 || uploaded.ContentType != "text/plain" ||
+		uploaded.SHA256 != hashString("hello") || !strings.HasPrefix(uploaded.Key, "tasks/1/") || uploaded.UploadedBy == "system" {
+		t.Errorf("attachment = %+v; want notes.txt with its size, digest and uploader", uploaded)
+	}
+	if task, _ := server.store.Get(1); len(task.Attachments) != 1 || task.Version != 2 {
+		t.Errorf("task = %+v; want the attachment listed at version 2", task)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/tasks/1/attachments/1", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "hello" {
+		t.Fatalf("download = %d %q; want %d hello", w.Code, w.Body.String(), http.StatusOK)
+	}
+	if got := w.Header().Get("Content-Disposition"); got != `attachment; filename=notes.txt` {
+		t.Errorf("Content-Disposition = %q; want the file as a download", got)
+	}
+	if w.Header().Get("Content-Type") != "text/plain" || w.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("headers = %v; want text/plain with nosniff", w.Header())
+	}
+
+	req := httptest.NewRequest("DELETE", "/api/v1/tasks/1/attachments/1", nil)
+	req.Header.Set("X-API-Token", "secret-token")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("delete status = %d; want %d", w.Code, http.StatusNoContent)
+	}
+	if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(uploaded.Key))); !os.IsNotExist(err) {
+		t.Errorf("file still stored after delete: %v", err)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/tasks/1/attachments/1", nil))
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), ErrCodeAttachmentNotFound) {
+		t.Errorf("download after delete = %d %s; want %d %s", w.Code, w.Body.String(), http.StatusNotFound, ErrCodeAttachmentNotFound)
+	}
+}
+
+func TestAttachmentUploadLimits(t *testing.T) {
+	server, r, dir, cleanup := setupAttachmentServer(t)
+	defer cleanup()
+	server.config.Attachments.MaxSizeMB = 1
+	server.store.Add(context.Background(), "Small files only", "", DueTime{}, "medium")
+
+	tests := []struct {
+		name   string
+		req    *http.Request
+		status int
+		code   string
+	}{
+		{"too large", uploadRequest(t, "/api/v1/tasks/1/attachments", "big.bin", "application/octet-stream", make([]byte, 1<<20+1)), http.StatusRequestEntityTooLarge, ErrCodeAttachmentTooLarge},
+		{"missing task", uploadRequest(t, "/api/v1/tasks/9/attachments", "a.txt", "text/plain", []byte("a")), http.StatusNotFound, ErrCodeTaskNotFound},
+		{"not multipart", httptest.NewRequest("POST", "/api/v1/tasks/1/attachments", strings.NewReader(`{"file": "a"}`)), http.StatusBadRequest, ErrCodeInvalidAttachment},
+	}
+	for _, tt := range tests {
+		tt.req.Header.Set("X-API-Token", "secret-token")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, tt.req)
+		if w.Code != tt.status || !strings.Contains(w.Body.String(), tt.code) {
+			t.Errorf("%s: %d %s; want %d %s", tt.name, w.Code, w.Body.String(), tt.status, tt.code)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("files stored for rejected uploads: %v", entries)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/tasks/1/attachments/x", nil))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), ErrCodeInvalidAttachmentID) {
+		t.Errorf("bad attachment ID = %d %s; want %d %s", w.Code, w.Body.String(), http.StatusBadRequest, ErrCodeInvalidAttachmentID)
+	}
+}
+
+func TestAttachmentFilesGoWithPurge(t *testing.T) {
+	server, r, dir, cleanup := setupAttachmentServer(t)
+	defer cleanup()
+	ctx := context.Background()
+	server.store.Add(ctx, "Purged", "", DueTime{}, "medium")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, uploadRequest(t, "/api/v1/tasks/1/attachments", "a.txt", "text/plain", []byte("a")))
+	var uploaded Attachment
+	json.NewDecoder(w.Body).Decode(&uploaded)
+	path := filepath.Join(dir, filepath.FromSlash(uploaded.Key))
+
+	server.store.Delete(ctx, 1)
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("file removed when the task was trashed: %v", err)
+	}
+	server.store.PurgeTrashBefore(ctx, time.Now().Add(time.Hour))
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("file kept after the task was purged: %v", err)
+	}
+}
+
+func TestAttachmentUploadRemovesFileOnFailedSave(t *testing.T) {
+	backend := &memoryBackend{rows: map[int]Task{1: {ID: 1, Title: "Stored", Status: "pending"}}}
+	store, err := NewTaskStoreWithStorage(backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := NewServerWithStore(&Config{TokenHashes: []string{hashString("secret-token")}}, store)
+	dir := t.TempDir()
+	store.files = diskAttachmentStore{dir: dir}
+	r, err := server.Router()
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend.failing = true
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, uploadRequest(t, "/api/v1/tasks/1/attachments", "a.txt", "text/plain", []byte("a")))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d; want %d", w.Code, http.StatusInternalServerError)
+	}
+	if entries, _ := os.ReadDir(filepath.Join(dir, "tasks", "1")); len(entries) != 0 {
+		t.Errorf("files left after a failed save: %v", entries)
+	}
+}
+
+func TestOpenAttachmentStore(t *testing.T) {
+	if store, err := openAttachmentStore(&AttachmentConfig{}); err != nil || store.(diskAttachmentStore).dir != defaultAttachmentDir {
+		t.Errorf("default store = %+v, %v; want disk under %s", store, err, defaultAttachmentDir)
+	}
+	for _, config := range []AttachmentConfig{
+		{Storage: "ftp"},
+		{Storage: "s3", S3: S3Config{Endpoint: "http://localhost:9000", Bucket: "files"}},
+		{Storage: "s3", S3: S3Config{Endpoint: "localhost:9000", Bucket: "files", AccessKeyID: "id", SecretAccessKey: "secret"}},
+	} {
+		if _, err := openAttachmentStore(&config); err == nil {
+			t.Errorf("openAttachmentStore(%+v) error = nil; want an error", config)
+		}
+	}
+}
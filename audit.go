@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// defaultAuditLog is the audit log file used when audit_log is unset
+const defaultAuditLog = "audit.log"
+
+// Limits on the entries GET /audit returns
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// Audit actions. Deleting moves a task to the trash; purge removes it for
+// good, whether from the trash or by retention.
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+	AuditArchive = "archive"
+	AuditPurge   = "purge"
+	AuditReplace = "replace"
+	AuditRevert  = "revert"
+)
+
+// Kinds of audited records
+const (
+	auditTask    = "task"
+	auditProject = "project"
+	// auditStore is the whole store, for imports that replace everything
+	auditStore = "store"
+)
+
+// AuditEntry records one mutation: who made it, when, and how each field
+// changed
+type AuditEntry struct {
+	Time time.Time `json:"time"`
+	// Actor is "token:<id>" for a stored token, "user:<subject>" for a JWT
+	// and "system" for background jobs and the offline CLI
+	Actor     string `json:"actor"`
+	Action    string `json:"action"`
+	Type      string `json:"type"`
+	ID        int    `json:"id,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	// Changes maps the JSON names of the fields that changed to their
+	// values before and after
+	Changes map[string]auditChange `json:"changes,omitempty"`
+}
+
+// auditChange is a field's value before and after a mutation; null where
+// the record didn't exist
+type auditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// auditLog appends entries to a file, one JSON object per line. Entries are
+// only ever appended, never rewritten.
+type auditLog struct {
+	path string
+	file *os.File
+}
+
+// auditLogPath is the configured audit log file or the default, in the
+// data directory unless it is absolute
+func (c *Config) auditLogPath() string {
+	if c.AuditLog == "" {
+		return dataPath(defaultAuditLog)
+	}
+	return dataPath(c.AuditLog)
+}
+
+// openAuditLog opens the audit log at path for appending, creating it if
+// needed
+func openAuditLog(path string) (*auditLog, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+	return &auditLog{path: path, file: file}, nil
+}
+
+// append writes entry as one line
+func (a *auditLog) append(entry AuditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = a.file.Write(append(data, '\n'))
+	return err
+}
+
+// Close closes the file
+func (a *auditLog) Close() error {
+	return a.file.Close()
+}
+
+// auditActor names who made the request ctx belongs to
+func auditActor(ctx context.Context) string {
+	info, _ := ctx.Value(tokenKey{}).(tokenInfo)
+	return info.actor()
+}
+
+// actor names the caller holding the token as the audit log does: by the
+// OIDC subject for a JWT, by token ID for a stored token
+func (info tokenInfo) actor() string {
+	switch {
+	case info.subject != "":
+		return "user:" + info.subject
+	case info.hash != "":
+		return "token:" + tokenID(info.hash)
+	}
+	return "system"
+}
+
+// recordAudit appends an entry for a mutation of the record of kind with
+// id, given as it was before and after (either nil where it didn't exist).
+// A failed write is logged; the mutation has been saved by then and stands.
+// The caller must hold the write lock, which keeps entries in order.
+func (ts *TaskStore) recordAudit(ctx context.Context, action, kind string, id int, before, after interface{}) {
+	if ts.audit == nil {
+		return
+	}
+	entry := AuditEntry{
+		Time:      ts.now().UTC(),
+		Actor:     auditActor(ctx),
+		Action:    action,
+		Type:      kind,
+		ID:        id,
+		RequestID: requestID(ctx),
+		Changes:   auditDiff(before, after),
+	}
+	if err := ts.audit.append(entry); err != nil {
+		requestLogger(ctx).Error("Failed to write audit log", "error", err)
+	}
+}
+
+// auditDiff compares the JSON forms of before and after field by field
+func auditDiff(before, after interface{}) map[string]auditChange {
+	b, a := jsonFields(before), jsonFields(after)
+	changes := make(map[string]auditChange)
+	for name, value := range b {
+		if !reflect.DeepEqual(value, a[name]) {
+			changes[name] = auditChange{Before: value, After: a[name]}
+		}
+	}
+	for name, value := range a {
+		if _, seen := b[name]; !seen {
+			changes[name] = auditChange{Before: nil, After: value}
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	return changes
+}
+
+// jsonFields returns the fields v has in JSON, or none for a nil pointer
+func jsonFields(v interface{}) map[string]interface{} {
+	fields := make(map[string]interface{})
+	if v == nil || reflect.ValueOf(v).IsNil() {
+		return fields
+	}
+	data, err := json.Marshal(v)
+	if err == nil {
+		_ = json.Unmarshal(data, &fields)
+	}
+	return fields
+}
+
+// taskSnapshot copies task so later in-place changes don't alter it
+func taskSnapshot(task *Task) *Task {
+	snapshot := *task
+	return &snapshot
+}
+
+// storeCounts stands in for the whole store in AuditReplace entries, where
+// a diff of every record would swamp the log
+type storeCounts struct {
+	Tasks    int `json:"tasks"`
+	Projects int `json:"projects"`
+}
+
+// storeCountsLocked counts the stored tasks, including the trash and the
+// archive, and the projects. The caller must hold the lock.
+func (ts *TaskStore) storeCountsLocked() *storeCounts {
+	return &storeCounts{
+		Tasks:    len(ts.tasks) + len(ts.trash) + len(ts.archive),
+		Projects: len(ts.projects),
+	}
+}
+
+// auditFilter selects entries for GET /audit. Empty fields match every
+// entry; Since and Until are inclusive.
+type auditFilter struct {
+	Type   string
+	ID     int
+	Actor  string
+	Action string
+	Since  time.Time
+	Until  time.Time
+}
+
+func (f auditFilter) matches(entry AuditEntry) bool {
+	return (f.Type == "" || entry.Type == f.Type) &&
+		(f.ID == 0 || entry.ID == f.ID) &&
+		(f.Actor == "" || entry.Actor == f.Actor) &&
+		(f.Action == "" || entry.Action == f.Action) &&
+		(f.Since.IsZero() || !entry.Time.Before(f.Since)) &&
+		(f.Until.IsZero() || !entry.Time.After(f.Until))
+}
+
+// query returns the newest limit entries matching filter, newest first.
+// It reads the file from the start; a line being appended meanwhile may be
+// incomplete and is skipped.
+func (a *auditLog) query(filter auditFilter, limit int) ([]AuditEntry, error) {
+	file, err := os.Open(a.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Keep the last limit matches in a ring
+	ring := make([]AuditEntry, 0, limit)
+	next := 0
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || !filter.matches(entry) {
+			continue
+		}
+		if len(ring) < limit {
+			ring = append(ring, entry)
+		} else {
+			ring[next] = entry
+		}
+		next = (next + 1) % limit
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	entries := make([]AuditEntry, 0, len(ring))
+	for i := 1; i <= len(ring); i++ {
+		entries = append(entries, ring[(next-i+len(ring))%len(ring)])
+	}
+	return entries, nil
+}
+
+// parseAuditFilter reads ?type=, ?id=, ?actor=, ?action=, ?since=, ?until=
+// and ?limit=
+func parseAuditFilter(r *http.Request) (auditFilter, int, error) {
+	query := r.URL.Query()
+	filter := auditFilter{
+		Type:   query.Get("type"),
+		Actor:  query.Get("actor"),
+		Action: query.Get("action"),
+	}
+	if raw := query.Get("id"); raw != "" {
+		id, err := strconv.Atoi(raw)
+		if err != nil || id <= 0 {
+			return auditFilter{}, 0, fmt.Errorf("id must be a positive integer")
+		}
+		filter.ID = id
+	}
+	for name, bound := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		raw := query.Get(name)
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return auditFilter{}, 0, fmt.Errorf("%s must be an RFC 3339 time", name)
+		}
+		*bound = t
+	}
+	limit := defaultAuditLimit
+	if raw := query.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxAuditLimit {
+			return auditFilter{}, 0, fmt.Errorf("limit must be between 1 and %d", maxAuditLimit)
+		}
+		limit = n
+	}
+	return filter, limit, nil
+}
+
+// handleGetAudit returns audit log entries, newest first
+func (s *Server) handleGetAudit(w http.ResponseWriter, r *http.Request) {
+	if s.store.audit == nil {
+		writeError(w, http.StatusNotFound, ErrCodeOperationDisabled, "Audit log is not enabled")
+		return
+	}
+	filter, limit, err := parseAuditFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidQuery, err.Error())
+		return
+	}
+	entries, err := s.store.audit.query(filter, limit)
+	if err != nil {
+		requestLogger(r.Context()).Error("Failed to read audit log", "error", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to read audit log")
+		return
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
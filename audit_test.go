@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setupAuditServer returns a test server with an audit log in a temporary
+// directory
+func setupAuditServer(t *testing.T) (*Server, func()) {
+	t.Helper()
+	server, cleanup := setupTestServer()
+	audit, err := openAuditLog(filepath.Join(t.TempDir(), "audit.log"))
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	server.store.audit = audit
+	return server, func() {
+		audit.Close()
+		cleanup()
+	}
+}
+
+// queryAudit returns the entries GET /audit returns for query
+func queryAudit(t *testing.T, server *Server, query string) []AuditEntry {
+	t.Helper()
+	w := httptest.NewRecorder()
+	server.handleGetAudit(w, httptest.NewRequest("GET", "/api/v1/audit?"+query, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /audit?%s status = %d; want %d: %s", query, w.Code, http.StatusOK, w.Body.String())
+	}
+	var entries []AuditEntry
+	if err := json.NewDecoder(w.Body).Decode(&entries); err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestAuditRecordsRequestActorAndDiff(t *testing.T) {
+	server, cleanup := setupAuditServer(t)
+	defer cleanup()
+	server.config.TokenHashes = []string{hashString("secret-token")}
+	r, err := server.Router()
+	if err != nil {
+		t.Fatalf("Router() error = %v", err)
+	}
+
+	send := func(method, path, body string) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-API-Token", "secret-token")
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code >= 300 {
+			t.Fatalf("%s %s status = %d: %s", method, path, w.Code, w.Body.String())
+		}
+	}
+	send("POST", "/api/v1/tasks", `{"title": "Write report", "priority": "low"}`)
+	send("PUT", "/api/v1/tasks/1", `{"title": "Write report", "priority": "high", "status": "in_progress"}`)
+	send("DELETE", "/api/v1/tasks/1", "")
+
+	entries := queryAudit(t, server, "")
+	if len(entries) != 3 {
+		t.Fatalf("entries = %+v; want 3", entries)
+	}
+	deleted, updated, created := entries[0], entries[1], entries[2]
+	if created.Action != AuditCreate || updated.Action != AuditUpdate || deleted.Action != AuditDelete {
+		t.Errorf("actions = %s, %s, %s; want newest first", deleted.Action, updated.Action, created.Action)
+	}
+	want := "token:" + tokenID(hashString("secret-token"))
+	for _, entry := range entries {
+		if entry.Actor != want || entry.Type != auditTask || entry.ID != 1 || entry.RequestID == "" {
+			t.Errorf("entry = %+v; want task 1 by %s with a request ID", entry, want)
+		}
+	}
+
+	if change := created.Changes["title"]; change.Before != nil || change.After != "Write report" {
+		t.Errorf("create title change = %+v; want null to Write report", change)
+	}
+	if change := updated.Changes["priority"]; change.Before != "low" || change.After != "high" {
+		t.Errorf("update priority change = %+v; want low to high", change)
+	}
+	if _, ok := updated.Changes["title"]; ok {
+		t.Error("unchanged title recorded in update")
+	}
+	if change, ok := deleted.Changes["deleted_at"]; !ok || change.Before != nil || change.After == nil {
+		t.Errorf("delete changes = %+v; want deleted_at set", deleted.Changes)
+	}
+}
+
+func TestAuditPatchRecordsAllChangedFields(t *testing.T) {
+	server, cleanup := setupAuditServer(t)
+	defer cleanup()
+	ctx := context.Background()
+	project, _ := server.store.AddProject(ctx, "Home", "")
+	server.store.Add(ctx, "Paint", "", DueTime{}, "medium")
+
+	if _, _, err := server.store.Patch(ctx, 1, map[string]string{"project_id": "1", "title": "Paint fence"}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := queryAudit(t, server, "type=task&action=update")
+	if len(entries) != 1 {
+		t.Fatalf("entries = %+v; want 1", entries)
+	}
+	changes := entries[0].Changes
+	if changes["project_id"].After != float64(project.ID) || changes["title"].After != "Paint fence" {
+		t.Errorf("changes = %+v; want project_id and title", changes)
+	}
+	if entries[0].Actor != "system" {
+		t.Errorf("actor = %q; want system", entries[0].Actor)
+	}
+}
+
+func TestAuditRecordsProjectsAndPurges(t *testing.T) {
+	server, cleanup := setupAuditServer(t)
+	defer cleanup()
+	ctx := context.Background()
+	project, _ := server.store.AddProject(ctx, "Old", "")
+	server.store.UpdateProject(ctx, project.ID, "Older", "")
+	server.store.DeleteProject(ctx, project.ID)
+	server.store.Add(ctx, "Trashed", "", DueTime{}, "medium")
+	server.store.Delete(ctx, 1)
+	server.store.PurgeTrashBefore(ctx, time.Now().Add(time.Hour))
+
+	projects := queryAudit(t, server, "type=project")
+	if len(projects) != 3 || projects[0].Action != AuditDelete || projects[1].Changes["name"].After != "Older" {
+		t.Errorf("project entries = %+v; want create, rename and delete", projects)
+	}
+	purged := queryAudit(t, server, "action=purge")
+	if len(purged) != 1 || purged[0].ID != 1 || purged[0].Changes["title"].After != nil {
+		t.Errorf("purge entries = %+v; want task 1 removed", purged)
+	}
+}
+
+func TestAuditFilterAndLimit(t *testing.T) {
+	server, cleanup := setupAuditServer(t)
+	defer cleanup()
+	ctx := context.Background()
+	start := time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		now := start.Add(time.Duration(i) * time.Hour)
+		server.store.now = func() time.Time { return now }
+		server.store.Add(ctx, "Task", "", DueTime{}, "medium")
+	}
+
+	entries := queryAudit(t, server, "limit=2")
+	if len(entries) != 2 || entries[0].ID != 5 || entries[1].ID != 4 {
+		t.Errorf("limited entries = %+v; want tasks 5 and 4", entries)
+	}
+	entries = queryAudit(t, server, "since=2024-03-01T10:00:00Z&until=2024-03-01T12:00:00Z")
+	if len(entries) != 3 || entries[0].ID != 4 || entries[2].ID != 2 {
+		t.Errorf("entries in range = %+v; want tasks 4 to 2", entries)
+	}
+	if entries := queryAudit(t, server, "id=3"); len(entries) != 1 || entries[0].ID != 3 {
+		t.Errorf("entries for id 3 = %+v", entries)
+	}
+	if entries := queryAudit(t, server, "actor=token:abc"); len(entries) != 0 {
+		t.Errorf("entries for unknown actor = %+v; want none", entries)
+	}
+
+	for _, query := range []string{"limit=0", "limit=1001", "id=x", "since=yesterday"} {
+		w := httptest.NewRecorder()
+		server.handleGetAudit(w, httptest.NewRequest("GET", "/api/v1/audit?"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("GET /audit?%s status = %d; want %d", query, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestAuditLogIsAppendedAcrossReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	for i := 0; i < 2; i++ {
+		audit, err := openAuditLog(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := audit.append(AuditEntry{Action: AuditCreate, Type: auditTask, ID: i + 1}); err != nil {
+			t.Fatal(err)
+		}
+		audit.Close()
+	}
+
+	audit, _ := openAuditLog(path)
+	defer audit.Close()
+	entries, err := audit.query(auditFilter{}, defaultAuditLimit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].ID != 2 || entries[1].ID != 1 {
+		t.Errorf("entries = %+v; want both, newest first", entries)
+	}
+}
+
+func TestAuditRequiresAdmin(t *testing.T) {
+	server, cleanup := setupAuditServer(t)
+	defer cleanup()
+	server.config.TokenHashes = []string{hashString("admin-token"), hashString("editor-token")}
+	server.config.TokenRoles = map[string]string{hashString("editor-token"): RoleEditor}
+	r, err := server.Router()
+	if err != nil {
+		t.Fatalf("Router() error = %v", err)
+	}
+
+	for token, want := range map[string]int{"": http.StatusUnauthorized, "editor-token": http.StatusForbidden, "admin-token": http.StatusOK} {
+		req := httptest.NewRequest("GET", "/api/v1/audit", nil)
+		if token != "" {
+			req.Header.Set("X-API-Token", token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("GET /audit with %q status = %d; want %d", token, w.Code, want)
+		}
+	}
+}
+
+func TestAuditDisabled(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.store.Add(context.Background(), "Not audited", "", DueTime{}, "medium")
+
+	w := httptest.NewRecorder()
+	server.handleGetAudit(w, httptest.NewRequest("GET", "/api/v1/audit", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d; want %d", w.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,387 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// backupVersion is the format version written to backup manifests. Restore
+// accepts backups up to this version.
+const backupVersion = 1
+
+// backupManifestFile is the backup archive entry besides those an export
+// has
+const backupManifestFile = "manifest.json"
+
+// Defaults for scheduled backups
+const (
+	defaultBackupIntervalHours = 24
+	defaultBackupKeep          = 7
+)
+
+// scheduledBackupPrefix starts the names of scheduled backup files; the
+// timestamp after it makes the names sort oldest first
+const scheduledBackupPrefix = "taskmate-backup-"
+
+// BackupConfig writes backups to disk on a schedule
+type BackupConfig struct {
+	// Dir is where scheduled backups are written; empty turns them off
+	Dir string `json:"dir,omitempty"`
+	// IntervalHours is how often a backup is written (default: 24)
+	IntervalHours int `json:"interval_hours,omitempty"`
+	// Keep is how many scheduled backups are kept; older ones are deleted
+	// (default: 7)
+	Keep int `json:"keep,omitempty"`
+}
+
+// validateBackup checks the scheduled backup settings
+func validateBackup(c BackupConfig) error {
+	if c.IntervalHours < 0 {
+		return errors.New("interval_hours must not be negative")
+	}
+	if c.Keep < 0 {
+		return errors.New("keep must not be negative")
+	}
+	return nil
+}
+
+// backupManifest describes a backup archive. The counts let restore notice
+// a truncated or edited archive.
+type backupManifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Tasks     int       `json:"tasks"`
+	Projects  int       `json:"projects"`
+}
+
+// backupSnapshot encodes the tasks and projects under one read lock, so
+// the backup doesn't mix states from before and after a change. Archived
+// tasks are included; tasks in the trash are left out.
+func (ts *TaskStore) backupSnapshot() (tasks, projects []byte, taskCount, projectCount int, err error) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	list := make([]*Task, 0, len(ts.tasks)+len(ts.archive))
+	for _, partition := range []map[int]*Task{ts.tasks, ts.archive} {
+		for _, task := range partition {
+			list = append(list, task)
+		}
+	}
+	sortByID(list)
+	if tasks, err = json.MarshalIndent(list, "", "  "); err != nil {
+		return nil, nil, 0, 0, err
+	}
+	projectList := ts.projectListLocked()
+	if projects, err = json.MarshalIndent(projectList, "", "  "); err != nil {
+		return nil, nil, 0, 0, err
+	}
+	return tasks, projects, len(list), len(projectList), nil
+}
+
+// Restore replaces all tasks and projects, e.g. from a backup, and empties
+// the trash. Tasks with an archived_at go to the archive. Projects are
+// saved first; if the tasks then can't be saved, the previous projects and
+// tasks are put back.
+func (ts *TaskStore) Restore(ctx context.Context, tasks []*Task, projects []*Project) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	before := ts.storeCountsLocked()
+	prevProjects, prevNextProjectID := ts.projects, ts.nextProjectID
+	projectIDs := make([]int, 0, len(prevProjects)+len(projects))
+	for id := range prevProjects {
+		projectIDs = append(projectIDs, id)
+	}
+	for _, project := range projects {
+		projectIDs = append(projectIDs, project.ID)
+	}
+	ts.projects = make(map[int]*Project, len(projects))
+	ts.nextProjectID = 1
+	for _, project := range projects {
+		ts.projects[project.ID] = project
+		if project.ID >= ts.nextProjectID {
+			ts.nextProjectID = project.ID + 1
+		}
+	}
+	restoreProjects := func() {
+		ts.projects, ts.nextProjectID = prevProjects, prevNextProjectID
+	}
+	if err := ts.saveProjects(ctx, projectIDs...); err != nil {
+		restoreProjects()
+		return fmt.Errorf("save projects: %w", err)
+	}
+
+	prevTasks, prevTrash, prevArchive, prevNextID := ts.tasks, ts.trash, ts.archive, ts.nextID
+	removed := make([]int, 0, len(prevTasks)+len(prevTrash)+len(prevArchive))
+	for _, partition := range []map[int]*Task{prevTasks, prevTrash, prevArchive} {
+		for id := range partition {
+			removed = append(removed, id)
+		}
+	}
+	ids := make([]int, 0, len(tasks))
+	ts.tasks = make(map[int]*Task, len(tasks))
+	ts.trash = make(map[int]*Task)
+	ts.archive = make(map[int]*Task)
+	ts.nextID = 1
+	for _, task := range tasks {
+		task.DueDate = task.DueDate.resolveSavedDay(ts.dueLocation)
+		ts.partitionFor(task)[task.ID] = task
+		ids = append(ids, task.ID)
+		if task.ID >= ts.nextID {
+			ts.nextID = task.ID + 1
+		}
+	}
+
+	if err := ts.saveReplacing(ctx, removed, ids); err != nil {
+		ts.tasks, ts.trash, ts.archive, ts.nextID = prevTasks, prevTrash, prevArchive, prevNextID
+		restoreProjects()
+		if saveErr := ts.saveProjects(ctx, projectIDs...); saveErr != nil {
+			requestLogger(ctx).Error("Failed to put back projects after restore failed", "error", saveErr)
+		}
+		return fmt.Errorf("save tasks: %w", err)
+	}
+	ts.resetChanges()
+	ts.recordMutation(ctx, AuditReplace, auditStore, 0, before, ts.storeCountsLocked())
+	return nil
+}
+
+// buildBackup returns a backup archive of all tasks and projects with the
+// sanitized config, which has no secrets
+func (s *Server) buildBackup() ([]byte, error) {
+	tasks, projects, taskCount, projectCount, err := s.store.backupSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := json.MarshalIndent(backupManifest{
+		Version:   backupVersion,
+		CreatedAt: s.now().UTC(),
+		Tasks:     taskCount,
+		Projects:  projectCount,
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	config, err := json.MarshalIndent(s.sanitizedConfig(), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, entry := range []struct {
+		name string
+		data []byte
+	}{
+		{backupManifestFile, manifest},
+		{archiveTasksFile, tasks},
+		{archiveProjectsFile, projects},
+		{archiveConfigFile, config},
+	} {
+		f, err := zw.Create(entry.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Write(append(entry.data, '\n')); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// readBackupArchive parses and validates a backup archive
+func readBackupArchive(data []byte) (*backupManifest, []*Task, []*Project, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("not a zip archive")
+	}
+
+	var manifest backupManifest
+	if err := readArchiveFile(zr, backupManifestFile, &manifest); err != nil {
+		return nil, nil, nil, err
+	}
+	if manifest.Version < 1 || manifest.Version > backupVersion {
+		return nil, nil, nil, fmt.Errorf("unsupported backup version %d", manifest.Version)
+	}
+
+	var tasks []*Task
+	if err := readArchiveFile(zr, archiveTasksFile, &tasks); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := validateArchiveTasks(tasks); err != nil {
+		return nil, nil, nil, err
+	}
+	var projects []*Project
+	if err := readArchiveFile(zr, archiveProjectsFile, &projects); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := validateArchiveProjects(projects, tasks); err != nil {
+		return nil, nil, nil, err
+	}
+
+	if len(tasks) != manifest.Tasks || len(projects) != manifest.Projects {
+		return nil, nil, nil, fmt.Errorf("manifest lists %d tasks and %d projects but archive has %d and %d",
+			manifest.Tasks, manifest.Projects, len(tasks), len(projects))
+	}
+	return &manifest, tasks, projects, nil
+}
+
+// handleBackup serves a versioned backup archive of all tasks and projects
+// with the sanitized config
+func (s *Server) handleBackup(w http.ResponseWriter, r *http.Request) {
+	data, err := s.buildBackup()
+	if err != nil {
+		requestLogger(r.Context()).Error("Failed to build backup", "error", err)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to build backup")
+		return
+	}
+	filename := fmt.Sprintf("%s%s.zip", scheduledBackupPrefix, s.now().UTC().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if _, err := w.Write(data); err != nil {
+		requestLogger(r.Context()).Error("Failed to write backup", "error", err)
+	}
+}
+
+// handleRestore replaces all tasks and projects with those from a backup
+// archive. Nothing changes if the archive is invalid, and ?dry_run=true
+// only validates it. The config in the archive is informational and is
+// not applied.
+func (s *Server) handleRestore(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, ErrCodeArchiveTooLarge, "Archive too large")
+		return
+	}
+
+	manifest, tasks, projects, err := readBackupArchive(data)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidArchive, "Invalid backup: "+err.Error())
+		return
+	}
+
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+	if !dryRun {
+		if err := s.store.Restore(r.Context(), tasks, projects); err != nil {
+			writeStoreError(w, err)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"version":    manifest.Version,
+		"created_at": manifest.CreatedAt,
+		"tasks":      len(tasks),
+		"projects":   len(projects),
+		"dry_run":    dryRun,
+	})
+}
+
+// writeScheduledBackup writes a backup into the backup directory, then
+// deletes the oldest scheduled backups beyond the number to keep. The file
+// is written under a temporary name and renamed, so the directory never
+// holds a partial backup.
+func (s *Server) writeScheduledBackup() (string, error) {
+	dir := dataPath(s.config.Backup.Dir)
+	data, err := s.buildBackup()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(dir, ".backup-*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s%s.zip", scheduledBackupPrefix, s.now().UTC().Format("20060102-150405")))
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+
+	keep := s.config.Backup.Keep
+	if keep == 0 {
+		keep = defaultBackupKeep
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return path, err
+	}
+	var backups []string
+	for _, entry := range entries {
+		if name := entry.Name(); strings.HasPrefix(name, scheduledBackupPrefix) && strings.HasSuffix(name, ".zip") {
+			backups = append(backups, name)
+		}
+	}
+	sort.Strings(backups)
+	for len(backups) > keep {
+		if err := os.Remove(filepath.Join(dir, backups[0])); err != nil {
+			return path, err
+		}
+		backups = backups[1:]
+	}
+	return path, nil
+}
+
+// runBackupScheduler writes a backup on every tick of interval until ctx is
+// cancelled. It does nothing when no backup directory is configured.
+func (s *Server) runBackupScheduler(ctx context.Context, interval time.Duration) {
+	if s.config.Backup.Dir == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			path, err := s.writeScheduledBackup()
+			if err != nil {
+				slog.Error("Scheduled backup failed", "error", err)
+				continue
+			}
+			slog.Info("Wrote scheduled backup", "path", path)
+		}
+	}
+}
+
+// interval is how often scheduled backups are written
+func (c BackupConfig) interval() time.Duration {
+	hours := c.IntervalHours
+	if hours == 0 {
+		hours = defaultBackupIntervalHours
+	}
+	return time.Duration(hours) * time.Hour
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// backupZip builds a backup archive from raw file contents
+func backupZip(files map[string]string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, _ := zw.Create(name)
+		f.Write([]byte(content))
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestBackupRestoreRoundTrip(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.TokenHashes = []string{hashString("secret-token")}
+	server.config.ShareSecret = "share-secret"
+
+	ctx := context.Background()
+	project, _ := server.store.AddProject(ctx, "Work", "")
+	server.store.AddTask(ctx, Task{Title: "Report", Priority: "high", ProjectID: project.ID})
+	server.store.Add(ctx, "Groceries", "", DueTime{}, "low")
+
+	w := httptest.NewRecorder()
+	server.handleBackup(w, httptest.NewRequest("POST", "/api/v1/admin/backup", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("backup status = %d; want %d", w.Code, http.StatusOK)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/zip" {
+		t.Errorf("Content-Type = %q; want application/zip", ct)
+	}
+	archive := w.Body.Bytes()
+
+	zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatalf("backup is not a zip: %v", err)
+	}
+	var manifest backupManifest
+	if err := readArchiveFile(zr, backupManifestFile, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Version != backupVersion || manifest.Tasks != 2 || manifest.Projects != 1 {
+		t.Errorf("manifest = %+v; want version %d, 2 tasks, 1 project", manifest, backupVersion)
+	}
+	var config map[string]interface{}
+	if err := readArchiveFile(zr, archiveConfigFile, &config); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := json.Marshal(config); bytes.Contains(data, []byte(hashString("secret-token"))) || bytes.Contains(data, []byte("share-secret")) {
+		t.Errorf("backup config leaks secrets: %s", data)
+	}
+
+	// Change everything, then restore
+	server.store.Delete(ctx, 1)
+	server.store.Delete(ctx, 2)
+	server.store.DeleteProject(ctx, project.ID)
+	server.store.AddProject(ctx, "Other", "")
+
+	w = httptest.NewRecorder()
+	server.handleRestore(w, httptest.NewRequest("POST", "/api/v1/admin/restore", bytes.NewReader(archive)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("restore status = %d; want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var resp map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp["tasks"] != float64(2) || resp["projects"] != float64(1) || resp["version"] != float64(backupVersion) {
+		t.Errorf("response = %v; want 2 tasks, 1 project, version %d", resp, backupVersion)
+	}
+
+	tasks := server.store.GetAll()
+	if len(tasks) != 2 || tasks[0].Title != "Report" || tasks[0].ProjectID != project.ID {
+		t.Errorf("tasks after restore = %+v; want Report in project %d, Groceries", tasks, project.ID)
+	}
+	projects := server.store.Projects()
+	if len(projects) != 1 || projects[0].Name != "Work" {
+		t.Errorf("projects after restore = %+v; want Work", projects)
+	}
+	next, _ := server.store.AddProject(ctx, "Next", "")
+	if next.ID != project.ID+1 {
+		t.Errorf("next project ID = %d; want %d", next.ID, project.ID+1)
+	}
+}
+
+func TestRestoreDryRunChangesNothing(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	ctx := context.Background()
+	server.store.Add(ctx, "Backed up", "", DueTime{}, "medium")
+	archive, err := server.buildBackup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.store.Add(ctx, "Added later", "", DueTime{}, "medium")
+
+	w := httptest.NewRecorder()
+	server.handleRestore(w, httptest.NewRequest("POST", "/api/v1/admin/restore?dry_run=true", bytes.NewReader(archive)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"dry_run":true`) {
+		t.Errorf("body = %s; want dry_run true", w.Body.String())
+	}
+	if tasks := server.store.GetAll(); len(tasks) != 2 {
+		t.Errorf("dry run changed the store: %+v", tasks)
+	}
+}
+
+func TestRestoreRejectsInvalidBackups(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.store.Add(context.Background(), "Keep me", "", DueTime{}, "medium")
+
+	manifest := func(version, tasks, projects int) string {
+		return fmt.Sprintf(`{"version":%d,"tasks":%d,"projects":%d}`, version, tasks, projects)
+	}
+	tests := []struct {
+		name  string
+		files map[string]string
+	}{
+		{"export archive without manifest", map[string]string{archiveTasksFile: "[]"}},
+		{"newer version", map[string]string{backupManifestFile: manifest(backupVersion+1, 0, 0), archiveTasksFile: "[]", archiveProjectsFile: "[]"}},
+		{"missing version", map[string]string{backupManifestFile: `{}`, archiveTasksFile: "[]", archiveProjectsFile: "[]"}},
+		{"missing projects", map[string]string{backupManifestFile: manifest(1, 0, 0), archiveTasksFile: "[]"}},
+		{"task without title", map[string]string{backupManifestFile: manifest(1, 1, 0), archiveTasksFile: `[{"id":1}]`, archiveProjectsFile: "[]"}},
+		{"duplicate project ids", map[string]string{backupManifestFile: manifest(1, 0, 2), archiveTasksFile: "[]", archiveProjectsFile: `[{"id":1,"name":"a"},{"id":1,"name":"b"}]`}},
+		{"task in missing project", map[string]string{backupManifestFile: manifest(1, 1, 0), archiveTasksFile: `[{"id":1,"title":"a","project_id":4}]`, archiveProjectsFile: "[]"}},
+		{"counts don't match manifest", map[string]string{backupManifestFile: manifest(1, 2, 0), archiveTasksFile: `[{"id":1,"title":"a"}]`, archiveProjectsFile: "[]"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			server.handleRestore(w, httptest.NewRequest("POST", "/api/v1/admin/restore", bytes.NewReader(backupZip(tt.files))))
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d; want %d", w.Code, http.StatusBadRequest)
+			}
+			if !strings.Contains(w.Body.String(), ErrCodeInvalidArchive) {
+				t.Errorf("body = %s; want code %s", w.Body.String(), ErrCodeInvalidArchive)
+			}
+		})
+	}
+
+	tasks := server.store.GetAll()
+	if len(tasks) != 1 || tasks[0].Title != "Keep me" {
+		t.Errorf("store changed by rejected restores: %+v", tasks)
+	}
+}
+
+func TestBackupRequiresAdmin(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.TokenHashes = []string{hashString("viewer-token")}
+	server.config.TokenRoles = map[string]string{hashString("viewer-token"): RoleViewer}
+
+	r, err := server.Router()
+	if err != nil {
+		t.Fatalf("Router() error = %v", err)
+	}
+	for _, path := range []string{"/api/v1/admin/backup", "/api/v1/admin/restore"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", path, nil))
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s without token status = %d; want %d", path, w.Code, http.StatusUnauthorized)
+		}
+
+		w = httptest.NewRecorder()
+		req := httptest.NewRequest("POST", path, nil)
+		req.Header.Set("X-API-Token", "viewer-token")
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("%s with viewer token status = %d; want %d", path, w.Code, http.StatusForbidden)
+		}
+	}
+}
+
+func TestScheduledBackupKeepsNewest(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	dir := filepath.Join(t.TempDir(), "backups")
+	server.config.Backup = BackupConfig{Dir: dir, Keep: 2}
+	server.store.Add(context.Background(), "Backed up", "", DueTime{}, "medium")
+
+	clock := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	server.now = func() time.Time { return clock }
+	for i := 0; i < 3; i++ {
+		if _, err := server.writeScheduledBackup(); err != nil {
+			t.Fatalf("writeScheduledBackup() error = %v", err)
+		}
+		clock = clock.Add(time.Hour)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	want := []string{"taskmate-backup-20240301-130000.zip", "taskmate-backup-20240301-140000.zip"}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Fatalf("backup dir = %v; want %v", names, want)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(dir, want[1]))
+	if _, tasks, _, err := readBackupArchive(data); err != nil || len(tasks) != 1 {
+		t.Errorf("scheduled backup = %d tasks, %v; want a valid backup of 1 task", len(tasks), err)
+	}
+}
+
+func TestBackupSchedulerWritesOnTick(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	dir := t.TempDir()
+	server.config.Backup = BackupConfig{Dir: dir}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		server.runBackupScheduler(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		matches, _ := filepath.Glob(filepath.Join(dir, scheduledBackupPrefix+"*.zip"))
+		if len(matches) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no backup written")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+}
+
+func TestValidateBackup(t *testing.T) {
+	if err := validateBackup(BackupConfig{Dir: "backups"}); err != nil {
+		t.Errorf("validateBackup(defaults) = %v; want nil", err)
+	}
+	for _, c := range []BackupConfig{{IntervalHours: -1}, {Keep: -1}} {
+		if err := validateBackup(c); err == nil {
+			t.Errorf("validateBackup(%+v) = nil; want error", c)
+		}
+	}
+	if got := (BackupConfig{}).interval(); got != 24*time.Hour {
+		t.Errorf("default interval = %v; want 24h", got)
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// boardColumn is a status column of the board with its tasks in board
+// order
+type boardColumn struct {
+	Status string       `json:"status"`
+	Tasks  []publicTask `json:"tasks"`
+}
+
+// boardResponse is the body of GET /board
+type boardResponse struct {
+	Columns []boardColumn `json:"columns"`
+}
+
+// boardLess orders tasks within a column: by Position, with tasks that
+// have none after those that do, then by ID
+func boardLess(a, b *Task) bool {
+	if (a.Position == 0) != (b.Position == 0) {
+		return a.Position != 0
+	}
+	if a.Position != b.Position {
+		return a.Position < b.Position
+	}
+	return a.ID < b.ID
+}
+
+// sortBoard puts tasks in board order
+func sortBoard(tasks []*Task) {
+	sort.Slice(tasks, func(i, j int) bool { return boardLess(tasks[i], tasks[j]) })
+}
+
+// boardStatuses returns the columns of a board showing tasks: the
+// workflow's statuses, then any statuses tasks still have that are no
+// longer in it, by name. A non-empty only limits the columns to those
+// statuses.
+func boardStatuses(wf workflow, tasks []*Task, only []string) []string {
+	statuses := append([]string(nil), wf.statuses...)
+	var extra []string
+	for _, task := range tasks {
+		if !containsString(statuses, task.Status) && !containsString(extra, task.Status) {
+			extra = append(extra, task.Status)
+		}
+	}
+	sort.Strings(extra)
+	statuses = append(statuses, extra...)
+	if len(only) == 0 {
+		return statuses
+	}
+	filtered := statuses[:0]
+	for _, status := range statuses {
+		if containsString(only, status) {
+			filtered = append(filtered, status)
+		}
+	}
+	return filtered
+}
+
+// MoveOnBoard puts task id at position (counted from 0) in the board column
+// of status, changing its status first as Update would; an empty status
+// keeps the current one, and a negative or too large position puts the
+// task at the end. The column's tasks are renumbered, so tasks that shift
+// get a new Position and version too, but only the moved task gets an
+// audit entry and revision. Like Update, it returns ErrTaskBlocked or a
+// *TransitionError, and the bool reports whether the task exists.
+func (ts *TaskStore) MoveOnBoard(ctx context.Context, id int, status string, position int) (*Task, bool, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	task, exists := ts.tasks[id]
+	if !exists {
+		return nil, false, nil
+	}
+	if err := ts.checkProjectLocked(ctx, task.ProjectID, PermissionEdit); err != nil {
+		return nil, true, err
+	}
+	if status == "" {
+		status = task.Status
+	}
+	if err := ts.workflow.checkTransition(task, status); err != nil {
+		return nil, true, err
+	}
+	if err := ts.checkCompletionLocked(ctx, task, task.BlockedBy, status); err != nil {
+		return nil, true, err
+	}
+
+	column := make([]*Task, 0)
+	for _, other := range ts.tasks {
+		if other.ID != id && other.Status == status {
+			column = append(column, other)
+		}
+	}
+	sortBoard(column)
+	if position < 0 || position > len(column) {
+		position = len(column)
+	}
+	column = append(column[:position], append([]*Task{task}, column[position:]...)...)
+
+	prev := *task
+	originals := map[int]Task{id: prev}
+	if status != task.Status {
+		ts.applyUpdateLocked(task, task.Title, task.Description, task.DueDate, "", status)
+	} else {
+		task.UpdatedAt = ts.now()
+	}
+	changed := []int{id}
+	for i, t := range column {
+		if t == task {
+			t.Position = i + 1
+			continue
+		}
+		if t.Position != i+1 {
+			originals[t.ID] = *t
+			t.Position = i + 1
+			changed = append(changed, t.ID)
+		}
+	}
+	if err := ts.save(ctx, changed...); err != nil {
+		for changedID, original := range originals {
+			*ts.tasks[changedID] = original
+		}
+		return nil, true, fmt.Errorf("save tasks: %w", err)
+	}
+	for _, changedID := range changed {
+		ts.recordChange(ctx, ChangeUpdated, ts.tasks[changedID])
+	}
+	ts.recordMutation(ctx, AuditUpdate, auditTask, id, &prev, task)
+	return task, true, nil
+}
+
+// handleGetBoard returns the tasks matching the list filters in one column
+// per status, each in board order. Every workflow status gets a column,
+// even an empty one, unless ?status= picks the columns.
+func (s *Server) handleGetBoard(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseTaskFilter(r.URL.Query(), s.requestLocation(r))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidQuery, err.Error())
+		return
+	}
+	tasks := s.store.List(filter)
+	sortBoard(tasks)
+
+	byStatus := make(map[string][]*Task)
+	for _, task := range tasks {
+		byStatus[task.Status] = append(byStatus[task.Status], task)
+	}
+	resp := boardResponse{Columns: []boardColumn{}}
+	for _, status := range boardStatuses(s.store.workflow, tasks, filter.Statuses) {
+		resp.Columns = append(resp.Columns, boardColumn{Status: status, Tasks: s.presentTasks(byStatus[status])})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// boardMoveRequest is the body of POST /board/move
+type boardMoveRequest struct {
+	// TaskID is a number or, when IDs are obfuscated, a string
+	TaskID json.RawMessage `json:"task_id"`
+	// Status is the column to move the task to; empty keeps its status
+	Status string `json:"status,omitempty"`
+	// Position is where the task goes in the column, counted from 0;
+	// omitted puts it at the end
+	Position *int `json:"position,omitempty"`
+}
+
+// handleMoveOnBoard moves a task within its board column or to another
+// one
+func (s *Server) handleMoveOnBoard(w http.ResponseWriter, r *http.Request) {
+	var req boardMoveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	id, err := s.decodeTaskID(strings.Trim(string(req.TaskID), `"`))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidTaskID, "Invalid task ID")
+		return
+	}
+	if req.Status != "" {
+		if err := s.store.workflow.checkStatus(req.Status); err != nil {
+			writeValidationError(w, err)
+			return
+		}
+	}
+	position := -1
+	if req.Position != nil {
+		if *req.Position < 0 {
+			writeError(w, http.StatusUnprocessableEntity, ErrCodeValidation, "position must be 0 or more")
+			return
+		}
+		position = *req.Position
+	}
+
+	task, exists, err := s.store.MoveOnBoard(forceContext(r), id, req.Status, position)
+	if errors.Is(err, ErrTaskBlocked) {
+		writeTaskBlocked(w)
+		return
+	}
+	if errors.Is(err, ErrTransitionNotAllowed) {
+		writeTransitionNotAllowed(w, err)
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if !exists {
+		writeError(w, http.StatusNotFound, ErrCodeTaskNotFound, "Task not found")
+		return
+	}
+	taskOps.Add("move", 1)
+
+	w.Header().Set("ETag", taskETag(task))
+	writeJSON(w, http.StatusOK, s.presentTask(task))
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBoard(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.TokenHashes = []string{hashString("secret-token")}
+	ctx := context.Background()
+	for _, title := range []string{"A", "B", "C", "D"} {
+		server.store.Add(ctx, title, "", DueTime{}, "medium")
+	}
+	r, err := server.Router()
+	if err != nil {
+		t.Fatal(err)
+	}
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-API-Token", "secret-token")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	board := func(query string) map[string][]string {
+		t.Helper()
+		w := send("GET", "/api/v1/board"+query, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET /board%s: status %d", query, w.Code)
+		}
+		var resp boardResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+		columns := make(map[string][]string)
+		for _, column := range resp.Columns {
+			columns[column.Status] = []string{}
+			for _, task := range column.Tasks {
+				columns[column.Status] = append(columns[column.Status], task.Title)
+			}
+		}
+		return columns
+	}
+
+	want := map[string][]string{"pending": {"A", "B", "C", "D"}, "in_progress": {}, "completed": {}}
+	if got := board(""); !reflect.DeepEqual(got, want) {
+		t.Errorf("board = %v; want %v", got, want)
+	}
+
+	for _, move := range []string{
+		`{"task_id": 4, "position": 0}`,
+		`{"task_id": 2, "status": "in_progress"}`,
+		`{"task_id": 3, "status": "in_progress", "position": 0}`,
+	} {
+		if w := send("POST", "/api/v1/board/move", move); w.Code != http.StatusOK {
+			t.Fatalf("move %s: status %d: %s", move, w.Code, w.Body.String())
+		}
+	}
+	want = map[string][]string{"pending": {"D", "A"}, "in_progress": {"C", "B"}, "completed": {}}
+	if got := board(""); !reflect.DeepEqual(got, want) {
+		t.Errorf("board after moves = %v; want %v", got, want)
+	}
+
+	// Changing the status elsewhere puts the task at the end of its column
+	send("PATCH", "/api/v1/tasks/1", `{"status":"in_progress"}`)
+	want = map[string][]string{"in_progress": {"C", "B", "A"}}
+	if got := board("?status=in_progress"); !reflect.DeepEqual(got, want) {
+		t.Errorf("in_progress column = %v; want %v", got, want)
+	}
+
+	// Positions are saved with the tasks
+	reloaded := NewTaskStore("test_tasks.json")
+	var positions []int
+	for _, task := range reloaded.List(TaskFilter{Statuses: []string{"in_progress"}}) {
+		positions = append(positions, task.Position)
+	}
+	if !reflect.DeepEqual(positions, []int{0, 2, 1}) {
+		t.Errorf("reloaded positions of tasks 1-3 = %v; want [0 2 1]", positions)
+	}
+
+	server.store.PatchIfMatch(ctx, 4, nil, map[string]string{"blocked_by": "1"})
+	tests := []struct {
+		body string
+		want int
+	}{
+		{`{"task_id": 4, "status": "review"}`, http.StatusUnprocessableEntity},
+		{`{"task_id": 4, "position": -1}`, http.StatusUnprocessableEntity},
+		{`{"task_id": 99}`, http.StatusNotFound},
+		{`{"task_id": "x"}`, http.StatusBadRequest},
+		{`{"task_id": 4, "status": "completed"}`, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		if w := send("POST", "/api/v1/board/move", tt.body); w.Code != tt.want {
+			t.Errorf("move %s: status %d; want %d", tt.body, w.Code, tt.want)
+		}
+	}
+}
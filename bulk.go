@@ -0,0 +1,400 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxBulkOperations caps the operations in one POST /tasks/bulk
+const maxBulkOperations = 100
+
+// Bulk operation kinds
+const (
+	BulkCreate   = "create"
+	BulkUpdate   = "update"
+	BulkComplete = "complete"
+	BulkDelete   = "delete"
+)
+
+// ErrTaskNotFound is returned by ApplyBulk for an operation on a task that
+// doesn't exist, or no longer does after an earlier operation deleted it
+var ErrTaskNotFound = errors.New("task not found")
+
+// BulkOperation is one change in an ApplyBulk batch
+type BulkOperation struct {
+	// Op is BulkCreate, BulkUpdate, BulkComplete or BulkDelete
+	Op string
+	// ID is the task to change; unused for BulkCreate
+	ID int
+	// Versions are checked as by UpdateIfMatch; nil skips the check
+	Versions []int
+	// Fields are the new task's fields, as for AddTask (BulkCreate)
+	Fields Task
+	// Patch are the fields to set, as for Patch (BulkUpdate)
+	Patch map[string]string
+	// Force allows completing a task whose blockers are open
+	Force bool
+}
+
+// BulkOperationError is returned by ApplyBulk when one of the operations
+// fails; nothing in the batch is applied then
+type BulkOperationError struct {
+	Index int
+	Err   error
+}
+
+func (e *BulkOperationError) Error() string {
+	return fmt.Sprintf("operation %d: %v", e.Index, e.Err)
+}
+
+func (e *BulkOperationError) Unwrap() error {
+	return e.Err
+}
+
+// bulkRecord is an applied operation, kept to be recorded once the batch
+// is saved
+type bulkRecord struct {
+	change, action string
+	before, after  *Task
+}
+
+// ApplyBulk applies ops in order as one change: every operation is checked
+// and applied as its single-task counterpart would be, then all the tasks
+// are saved at once. If any operation fails, or the save does, the store is
+// left as it was. It returns each task as its operation left it; deleted
+// tasks are returned as they went to the trash.
+func (ts *TaskStore) ApplyBulk(ctx context.Context, ops []BulkOperation) ([]*Task, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// The state each touched task had before the batch, to put back on
+	// failure; tasks the batch creates have none and are removed
+	prevNextID := ts.nextID
+	creates := 0
+	for _, op := range ops {
+		if op.Op == BulkCreate {
+			creates++
+		}
+	}
+	if err := ts.reserveIDsLocked(ctx, TaskIDs, creates, &ts.nextID); err != nil {
+		return nil, err
+	}
+	originals := make(map[int]*Task)
+	touched := make([]int, 0, len(ops))
+	pointers := make(map[int]*Task)
+	touch := func(task *Task) {
+		if _, seen := pointers[task.ID]; seen {
+			return
+		}
+		pointers[task.ID] = task
+		if task.ID < prevNextID {
+			originals[task.ID] = taskSnapshot(task)
+		}
+		touched = append(touched, task.ID)
+	}
+	rollback := func() {
+		for id, task := range pointers {
+			delete(ts.trash, id)
+			original, existed := originals[id]
+			if !existed {
+				delete(ts.tasks, id)
+				continue
+			}
+			*task = *original
+			ts.tasks[id] = task
+		}
+		ts.nextID = prevNextID
+	}
+
+	records := make([]bulkRecord, len(ops))
+	results := make([]*Task, len(ops))
+	for i, op := range ops {
+		record, err := ts.applyBulkOperationLocked(ctx, op, touch)
+		if err != nil {
+			rollback()
+			return nil, &BulkOperationError{Index: i, Err: err}
+		}
+		records[i] = record
+		results[i] = record.after
+	}
+	if err := ts.save(ctx, touched...); err != nil {
+		rollback()
+		return nil, fmt.Errorf("save tasks: %w", err)
+	}
+
+	for _, record := range records {
+		// save bumped the versions after the snapshots were taken
+		record.after.Version = pointers[record.after.ID].Version
+		ts.recordChange(ctx, record.change, record.after)
+		ts.recordMutation(ctx, record.action, auditTask, record.after.ID, record.before, record.after)
+	}
+	return results, nil
+}
+
+// applyBulkOperationLocked applies op without saving, calling touch with
+// each task before changing it. The caller must hold the write lock.
+func (ts *TaskStore) applyBulkOperationLocked(ctx context.Context, op BulkOperation, touch func(*Task)) (bulkRecord, error) {
+	if op.Force {
+		ctx = allowBlockedCompletion(ctx)
+	}
+	if op.Op == BulkCreate {
+		task, err := ts.newTaskLocked(ctx, op.Fields)
+		if err != nil {
+			return bulkRecord{}, err
+		}
+		touch(task)
+		ts.tasks[task.ID] = task
+		ts.nextID++
+		return bulkRecord{change: ChangeCreated, action: AuditCreate, after: taskSnapshot(task)}, nil
+	}
+
+	task, exists := ts.tasks[op.ID]
+	if !exists {
+		return bulkRecord{}, ErrTaskNotFound
+	}
+	if op.Versions != nil && !versionIn(task.Version, op.Versions) {
+		return bulkRecord{}, ErrVersionMismatch
+	}
+	if err := ts.checkProjectLocked(ctx, task.ProjectID, PermissionEdit); err != nil {
+		return bulkRecord{}, err
+	}
+	touch(task)
+	prev := taskSnapshot(task)
+	switch op.Op {
+	case BulkUpdate:
+		if err := ts.applyPatchLocked(ctx, task, op.Patch); err != nil {
+			return bulkRecord{}, err
+		}
+	case BulkComplete:
+		if err := ts.workflow.checkTransition(task, "completed"); err != nil {
+			return bulkRecord{}, err
+		}
+		if err := ts.checkCompletionLocked(ctx, task, task.BlockedBy, "completed"); err != nil {
+			return bulkRecord{}, err
+		}
+		ts.applyUpdateLocked(task, task.Title, task.Description, task.DueDate, task.Priority, "completed")
+	case BulkDelete:
+		now := ts.now()
+		task.DeletedAt = &now
+		delete(ts.tasks, task.ID)
+		ts.trash[task.ID] = task
+		return bulkRecord{change: ChangeDeleted, action: AuditDelete, before: prev, after: taskSnapshot(task)}, nil
+	default:
+		return bulkRecord{}, &validationError{ErrCodeValidation, fmt.Sprintf("Unknown operation %q", op.Op)}
+	}
+	return bulkRecord{change: ChangeUpdated, action: AuditUpdate, before: prev, after: taskSnapshot(task)}, nil
+}
+
+// bulkRequest is the body of POST /tasks/bulk
+type bulkRequest struct {
+	Operations []bulkOperationRequest `json:"operations"`
+}
+
+// bulkOperationRequest is one operation in a bulk request, shaped like a
+// sync message: Task is a create request body (create) or a JSON merge
+// patch (update), and ID may be a number or, when IDs are obfuscated, a
+// string (update, complete, delete)
+type bulkOperationRequest struct {
+	Op   string          `json:"op"`
+	ID   json.RawMessage `json:"id,omitempty"`
+	Task json.RawMessage `json:"task,omitempty"`
+	// Version is the task's ETag value without quotes; if the task has been
+	// saved since, the batch fails as a PUT with If-Match would
+	Version *int `json:"version,omitempty"`
+	// Force completes the task even while its blockers are open, like
+	// ?force=true (update, complete)
+	Force bool `json:"force,omitempty"`
+}
+
+// bulkResult reports on one operation of a bulk request. Status is what
+// the operation would have returned on its own; when the batch fails, the
+// operations that would have succeeded get 424 Failed Dependency.
+type bulkResult struct {
+	Index  int         `json:"index"`
+	Op     string      `json:"op"`
+	ID     interface{} `json:"id,omitempty"`
+	Status int         `json:"status"`
+	Task   *publicTask `json:"task,omitempty"`
+	Code   string      `json:"code,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// bulkResponse is the body of a successful POST /tasks/bulk
+type bulkResponse struct {
+	Results []bulkResult `json:"results"`
+}
+
+// parseBulkOperation reads op into a store operation, with due days in
+// loc, failing with a *validationError for a 422 or a bulkStatusError for
+// another status
+func (s *Server) parseBulkOperation(op bulkOperationRequest, loc *time.Location) (BulkOperation, error) {
+	parsed := BulkOperation{Op: op.Op, Force: op.Force}
+	switch op.Op {
+	case BulkCreate:
+		var req createTaskRequest
+		if err := json.Unmarshal(op.Task, &req); err != nil {
+			return parsed, bulkStatusError{http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON"}
+		}
+		fields, err := s.newTaskFields(&req, loc)
+		if err != nil {
+			return parsed, err
+		}
+		parsed.Fields = fields
+		return parsed, nil
+	case BulkUpdate, BulkComplete, BulkDelete:
+	default:
+		return parsed, &validationError{ErrCodeValidation, "op must be one of: create, update, complete, delete"}
+	}
+
+	id, err := s.decodeTaskID(strings.Trim(string(op.ID), `"`))
+	if err != nil {
+		return parsed, bulkStatusError{http.StatusBadRequest, ErrCodeInvalidTaskID, "Invalid task ID"}
+	}
+	parsed.ID = id
+	if op.Version != nil {
+		parsed.Versions = []int{*op.Version}
+	} else if s.config.RequireIfMatch && op.Op != BulkDelete {
+		return parsed, bulkStatusError{http.StatusPreconditionRequired, ErrCodePreconditionRequired, "version is required"}
+	}
+	if op.Op == BulkUpdate {
+		fields, err := s.parseTaskPatch(op.Task, loc)
+		if err != nil {
+			var verr *validationError
+			if errors.As(err, &verr) {
+				return parsed, err
+			}
+			return parsed, bulkStatusError{http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON"}
+		}
+		parsed.Patch = fields
+	}
+	return parsed, nil
+}
+
+// bulkStatusError is a failed operation with the status and code to report
+// for it
+type bulkStatusError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e bulkStatusError) Error() string {
+	return e.message
+}
+
+// bulkErrorResult fills in result for an operation that failed with err
+func bulkErrorResult(result *bulkResult, err error) {
+	var serr bulkStatusError
+	var verr *validationError
+	switch {
+	case errors.As(err, &serr):
+		result.Status, result.Code, result.Error = serr.status, serr.code, serr.message
+	case errors.As(err, &verr):
+		result.Status, result.Code, result.Error = verr.status(), verr.code, verr.message
+	case errors.Is(err, ErrTaskNotFound):
+		result.Status, result.Code, result.Error = http.StatusNotFound, ErrCodeTaskNotFound, "Task not found"
+	case errors.Is(err, ErrVersionMismatch):
+		result.Status, result.Code, result.Error = http.StatusPreconditionFailed, ErrCodePreconditionFailed, "Task was modified; fetch it again for its current ETag"
+	case errors.Is(err, ErrProjectNotFound):
+		result.Status, result.Code, result.Error = http.StatusUnprocessableEntity, ErrCodeProjectNotFound, "Project not found"
+	case errors.Is(err, ErrProjectForbidden):
+		result.Status, result.Code, result.Error = http.StatusForbidden, ErrCodeForbidden, "Not permitted in this project"
+	case errors.Is(err, ErrQuotaExceeded):
+		result.Status, result.Code, result.Error = http.StatusInsufficientStorage, ErrCodeQuotaExceeded, "Task quota exceeded"
+	case errors.Is(err, ErrTaskBlocked):
+		result.Status, result.Code, result.Error = http.StatusConflict, ErrCodeTaskBlocked, "Task is blocked by open tasks; complete them first or set force"
+	case errors.Is(err, ErrTransitionNotAllowed):
+		result.Status, result.Code, result.Error = http.StatusConflict, ErrCodeTransitionNotAllowed, transitionMessage(err)
+	default:
+		result.Status, result.Code, result.Error = http.StatusUnprocessableEntity, ErrCodeValidation, err.Error()
+	}
+}
+
+// writeBulkFailure sends the 422 for a batch in which the operation at
+// index failed with err; the others are reported as not applied
+func writeBulkFailure(w http.ResponseWriter, ops []bulkOperationRequest, index int, err error) {
+	results := make([]bulkResult, len(ops))
+	for i, op := range ops {
+		results[i] = bulkResult{Index: i, Op: op.Op}
+		if i == index {
+			bulkErrorResult(&results[i], err)
+			continue
+		}
+		results[i].Status = http.StatusFailedDependency
+		results[i].Code = ErrCodeBulkFailed
+		results[i].Error = "Not applied because operation " + strconv.Itoa(index) + " failed"
+	}
+	writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+		"error":   "Operation " + strconv.Itoa(index) + " failed; nothing was applied",
+		"code":    ErrCodeBulkFailed,
+		"status":  http.StatusUnprocessableEntity,
+		"results": results,
+	})
+}
+
+// handleBulkTasks applies a batch of creates, updates, completions and
+// deletes atomically: either all of them are applied or none is
+func (s *Server) handleBulkTasks(w http.ResponseWriter, r *http.Request) {
+	var req bulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	if len(req.Operations) == 0 || len(req.Operations) > maxBulkOperations {
+		writeError(w, http.StatusUnprocessableEntity, ErrCodeValidation, fmt.Sprintf("operations must have between 1 and %d items", maxBulkOperations))
+		return
+	}
+
+	loc := s.requestLocation(r)
+	ops := make([]BulkOperation, len(req.Operations))
+	for i, op := range req.Operations {
+		parsed, err := s.parseBulkOperation(op, loc)
+		if err != nil {
+			writeBulkFailure(w, req.Operations, i, err)
+			return
+		}
+		ops[i] = parsed
+	}
+
+	tasks, err := s.store.ApplyBulk(r.Context(), ops)
+	var operr *BulkOperationError
+	if errors.As(err, &operr) {
+		writeBulkFailure(w, req.Operations, operr.Index, operr.Err)
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+
+	results := make([]bulkResult, len(ops))
+	for i, op := range ops {
+		results[i] = bulkResult{Index: i, Op: op.Op, ID: s.publicID(tasks[i].ID)}
+		switch op.Op {
+		case BulkCreate:
+			results[i].Status = http.StatusCreated
+			taskOps.Add("create", 1)
+		case BulkDelete:
+			results[i].Status = http.StatusNoContent
+			taskOps.Add("delete", 1)
+		default:
+			results[i].Status = http.StatusOK
+			taskOps.Add("update", 1)
+		}
+		if op.Op != BulkDelete {
+			presented := s.presentTask(tasks[i])
+			results[i].Task = &presented
+		}
+	}
+	writeJSON(w, http.StatusOK, bulkResponse{Results: results})
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// postBulk sends body to POST /tasks/bulk with a valid token
+func postBulk(t *testing.T, server *Server, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	server.config.TokenHashes = []string{hashString("secret-token")}
+	r, err := server.Router()
+	if err != nil {
+		t.Fatalf("Router() error = %v", err)
+	}
+	req := httptest.NewRequest("POST", "/api/v1/tasks/bulk", strings.NewReader(body))
+	req.Header.Set("X-API-Token", "secret-token")
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestBulkOperations(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	ctx := context.Background()
+	server.store.Add(ctx, "Edit me", "", DueTime{}, "low")
+	server.store.Add(ctx, "Finish me", "", DueTime{}, "medium")
+	server.store.Add(ctx, "Remove me", "", DueTime{}, "medium")
+
+	w := postBulk(t, server, `{"operations": [
+		{"op": "create", "task": {"title": "New", "tags": ["bulk"]}},
+		{"op": "update", "id": 1, "task": {"priority": "high", "description": "Edited"}},
+		{"op": "complete", "id": "2", "version": 1},
+		{"op": "delete", "id": 3}
+	]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var resp struct {
+		Results []struct {
+			Index  int                    `json:"index"`
+			Op     string                 `json:"op"`
+			ID     float64                `json:"id"`
+			Status int                    `json:"status"`
+			Task   map[string]interface{} `json:"task"`
+		} `json:"results"`
+	}
+	json.NewDecoder(w.Body).Decode(&resp)
+	if len(resp.Results) != 4 {
+		t.Fatalf("results = %+v; want 4", resp.Results)
+	}
+	for i, want := range []struct {
+		op     string
+		id     float64
+		status int
+	}{{"create", 4, http.StatusCreated}, {"update", 1, http.StatusOK}, {"complete", 2, http.StatusOK}, {"delete", 3, http.StatusNoContent}} {
+		got := resp.Results[i]
+		if got.Index != i || got.Op != want.op || got.ID != want.id || got.Status != want.status {
+			t.Errorf("result %d = %+v; want %s of task %v with status %d", i, got, want.op, want.id, want.status)
+		}
+	}
+	if resp.Results[2].Task["status"] != "completed" || resp.Results[2].Task["version"] != float64(2) {
+		t.Errorf("completed task = %v; want completed at version 2", resp.Results[2].Task)
+	}
+	if resp.Results[3].Task != nil {
+		t.Errorf("delete result has task %v; want none", resp.Results[3].Task)
+	}
+
+	if task, ok := server.store.Get(1); !ok || task.Priority != "high" || task.Description != "Edited" {
+		t.Errorf("task 1 = %+v; want updated", task)
+	}
+	if task, ok := server.store.Get(4); !ok || task.Title != "New" || len(task.Tags) != 1 {
+		t.Errorf("task 4 = %+v; want created with its tag", task)
+	}
+	if _, ok := server.store.Get(3); ok || len(server.store.Trash()) != 1 {
+		t.Error("task 3 not moved to the trash")
+	}
+
+	// Everything was written in one save
+	reloaded := NewTaskStore("test_tasks.json")
+	if task, ok := reloaded.Get(2); !ok || task.Status != "completed" || task.CompletedAt == nil {
+		t.Errorf("reloaded task 2 = %+v; want completed", task)
+	}
+}
+
+func TestBulkFailureAppliesNothing(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	ctx := context.Background()
+	server.store.Add(ctx, "Keep", "", DueTime{}, "medium")
+	revision := server.store.Revision()
+
+	w := postBulk(t, server, `{"operations": [
+		{"op": "create", "task": {"title": "Not created"}},
+		{"op": "delete", "id": 1},
+		{"op": "update", "id": 1, "task": {"title": "Deleted already"}},
+		{"op": "complete", "id": 1}
+	]}`)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d; want %d", w.Code, http.StatusUnprocessableEntity)
+	}
+	var resp struct {
+		Code    string `json:"code"`
+		Results []struct {
+			Status int    `json:"status"`
+			Code   string `json:"code"`
+		} `json:"results"`
+	}
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Code != ErrCodeBulkFailed || len(resp.Results) != 4 {
+		t.Fatalf("response = %+v; want BULK_FAILED with 4 results", resp)
+	}
+	for i, want := range []int{http.StatusFailedDependency, http.StatusFailedDependency, http.StatusNotFound, http.StatusFailedDependency} {
+		if resp.Results[i].Status != want {
+			t.Errorf("result %d status = %d; want %d", i, resp.Results[i].Status, want)
+		}
+	}
+	if resp.Results[2].Code != ErrCodeTaskNotFound {
+		t.Errorf("failed result code = %q; want %q", resp.Results[2].Code, ErrCodeTaskNotFound)
+	}
+
+	if tasks := server.store.GetAll(); len(tasks) != 1 || tasks[0].Title != "Keep" || tasks[0].DeletedAt != nil {
+		t.Errorf("tasks = %+v; want only the untouched task", tasks)
+	}
+	if len(server.store.Trash()) != 0 {
+		t.Error("trash not emptied again")
+	}
+	if server.store.Revision() != revision {
+		t.Error("changes recorded for a failed batch")
+	}
+	if task, _ := server.store.Add(ctx, "Next", "", DueTime{}, "medium"); task.ID != 2 {
+		t.Errorf("next ID = %d; want 2", task.ID)
+	}
+}
+
+func TestBulkRejectsInvalidOperations(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.store.Add(context.Background(), "Versioned", "", DueTime{}, "medium")
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		code   string
+	}{
+		{"unknown op", `{"operations": [{"op": "archive", "id": 1}]}`, http.StatusUnprocessableEntity, ErrCodeValidation},
+		{"missing title", `{"operations": [{"op": "create", "task": {}}]}`, http.StatusUnprocessableEntity, ErrCodeTitleRequired},
+		{"bad id", `{"operations": [{"op": "delete", "id": "x"}]}`, http.StatusBadRequest, ErrCodeInvalidTaskID},
+		{"bad patch", `{"operations": [{"op": "update", "id": 1, "task": {"colour": "red"}}]}`, http.StatusUnprocessableEntity, ErrCodeValidation},
+		{"stale version", `{"operations": [{"op": "complete", "id": 1, "version": 7}]}`, http.StatusPreconditionFailed, ErrCodePreconditionFailed},
+		{"missing project", `{"operations": [{"op": "update", "id": 1, "task": {"project_id": 9}}]}`, http.StatusUnprocessableEntity, ErrCodeProjectNotFound},
+	}
+	for _, tt := range tests {
+		w := postBulk(t, server, tt.body)
+		var resp struct {
+			Results []struct {
+				Status int    `json:"status"`
+				Code   string `json:"code"`
+			} `json:"results"`
+		}
+		json.NewDecoder(w.Body).Decode(&resp)
+		if w.Code != http.StatusUnprocessableEntity || len(resp.Results) != 1 || resp.Results[0].Status != tt.status || resp.Results[0].Code != tt.code {
+			t.Errorf("%s: status %d, results %+v; want 422 with %d %s", tt.name, w.Code, resp.Results, tt.status, tt.code)
+		}
+	}
+
+	for _, body := range []string{`{"operations": []}`, `{"operations": [` + strings.Repeat(`{"op": "delete", "id": 1},`, maxBulkOperations) + `{"op": "delete", "id": 1}]}`} {
+		if w := postBulk(t, server, body); w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("batch of wrong size status = %d; want %d", w.Code, http.StatusUnprocessableEntity)
+		}
+	}
+	if w := postBulk(t, server, `{"operations": `); w.Code != http.StatusBadRequest {
+		t.Errorf("malformed body status = %d; want %d", w.Code, http.StatusBadRequest)
+	}
+	if task, _ := server.store.Get(1); task.Version != 1 {
+		t.Errorf("version = %d; want the task unchanged at 1", task.Version)
+	}
+}
+
+func TestBulkRollsBackFailedSave(t *testing.T) {
+	backend := &memoryBackend{rows: map[int]Task{1: {ID: 1, Title: "Stored", Status: "pending", Version: 3}}}
+	store, err := NewTaskStoreWithStorage(backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend.failing = true
+
+	_, err = store.ApplyBulk(context.Background(), []BulkOperation{
+		{Op: BulkCreate, Fields: Task{Title: "Lost", Priority: "medium"}},
+		{Op: BulkComplete, ID: 1},
+		{Op: BulkDelete, ID: 1},
+	})
+	if err == nil {
+		t.Fatal("ApplyBulk() error = nil; want the backend's error")
+	}
+	task, ok := store.Get(1)
+	if !ok || task.Status != "pending" || task.CompletedAt != nil || task.DeletedAt != nil || task.Version != 3 {
+		t.Errorf("task 1 = %+v; want it as stored", task)
+	}
+	if _, ok := store.Get(2); ok || len(store.Trash()) != 0 {
+		t.Error("batch partly kept after a failed save")
+	}
+}
+
+func TestBulkAuditsEachOperation(t *testing.T) {
+	server, cleanup := setupAuditServer(t)
+	defer cleanup()
+	ctx := context.Background()
+	server.store.Add(ctx, "Audited", "", DueTime{}, "medium")
+
+	if _, err := server.store.ApplyBulk(ctx, []BulkOperation{
+		{Op: BulkUpdate, ID: 1, Patch: map[string]string{"title": "Renamed"}},
+		{Op: BulkComplete, ID: 1},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := queryAudit(t, server, "action=update")
+	if len(entries) != 2 || entries[1].Changes["title"].After != "Renamed" || entries[0].Changes["status"].After != "completed" {
+		t.Errorf("entries = %+v; want the rename, then the completion", entries)
+	}
+	if revisions, _ := server.store.History(1); len(revisions) != 3 {
+		t.Errorf("history = %d revisions; want 3", len(revisions))
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// calendarFeedPayload is what feed tokens sign. Share tokens always
+// contain a ".", so a feed token can't pass as one or the other way round.
+const calendarFeedPayload = "calendar-feed"
+
+// icsPriorities maps task priorities to iCalendar PRIORITY values
+// (1 highest, 9 lowest)
+var icsPriorities = map[string]int{"urgent": 1, "high": 2, "medium": 5, "low": 9}
+
+// icsStatuses maps task statuses to VTODO STATUS values
+var icsStatuses = map[string]string{"pending": "NEEDS-ACTION", "in_progress": "IN-PROCESS", "completed": "COMPLETED"}
+
+// icsEscaper escapes TEXT values (RFC 5545 section 3.3.11)
+var icsEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+// calendarFeedToken returns the token that unlocks the calendar feed. It
+// doesn't expire, since calendar apps can't renew it; changing
+// share_secret invalidates it.
+func (s *Server) calendarFeedToken() string {
+	return base64.RawURLEncoding.EncodeToString(s.shareMAC([]byte(calendarFeedPayload)))
+}
+
+// validCalendarFeedToken reports whether token unlocks the calendar feed
+func (s *Server) validCalendarFeedToken(token string) bool {
+	mac, err := base64.RawURLEncoding.DecodeString(token)
+	return err == nil && hmac.Equal(mac, s.shareMAC([]byte(calendarFeedPayload)))
+}
+
+// handleCalendarToken returns the calendar feed URL with its token
+func (s *Server) handleCalendarToken(w http.ResponseWriter, r *http.Request) {
+	token := s.calendarFeedToken()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"url":   s.linkURL("/api/v1/tasks/export.ics?token=" + token),
+		"token": token,
+	})
+}
+
+// handleCalendarFeed serves the tasks that have a due date as an
+// iCalendar feed of all-day events, or of to-dos with ?component=vtodo.
+// It takes the same filters as GET /tasks. Tasks fall on the day they are
+// due in the request's time zone. With calendar_feed_private set the feed
+// needs ?token= from /calendar/token, and so does a workspace's feed
+// requested without one of the workspace's tokens.
+func (s *Server) handleCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	private := s.config.CalendarFeedPrivate || (s.workspace != "" && r.Header.Get("X-API-Token") == "")
+	if private && !s.validCalendarFeedToken(query.Get("token")) {
+		writeError(w, http.StatusForbidden, ErrCodeFeedTokenInvalid, "Missing or invalid calendar feed token")
+		return
+	}
+	component := strings.ToUpper(query.Get("component"))
+	if component == "" {
+		component = "VEVENT"
+	}
+	if component != "VEVENT" && component != "VTODO" {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidQuery, "component must be vevent or vtodo")
+		return
+	}
+	loc := s.requestLocation(r)
+	filter, err := parseTaskFilter(query, loc)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidQuery, err.Error())
+		return
+	}
+
+	var tasks []*Task
+	for _, task := range s.store.List(filter) {
+		if !task.DueDate.IsZero() {
+			tasks = append(tasks, task)
+		}
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="tasks.ics"`)
+	if _, err := w.Write([]byte(s.renderCalendar(tasks, component, loc))); err != nil {
+		requestLogger(r.Context()).Error("Failed to write calendar feed", "error", err)
+	}
+}
+
+// renderCalendar formats tasks as an iCalendar object with one component
+// per task, dated by the day each is due in loc
+func (s *Server) renderCalendar(tasks []*Task, component string, loc *time.Location) string {
+	var b strings.Builder
+	line := func(format string, args ...interface{}) {
+		b.WriteString(foldICSLine(fmt.Sprintf(format, args...)))
+	}
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//TaskMate//TaskMate API//EN")
+	line("CALSCALE:GREGORIAN")
+	line("X-WR-CALNAME:TaskMate")
+	for _, task := range tasks {
+		if task.DueDate.IsZero() {
+			continue
+		}
+		due, _ := time.Parse(dueDateLayout, task.DueDate.Day(loc))
+		line("BEGIN:%s", component)
+		line("UID:task-%s@taskmate", s.formatID(task.ID))
+		line("DTSTAMP:%s", icsTime(task.UpdatedAt))
+		line("CREATED:%s", icsTime(task.CreatedAt))
+		line("LAST-MODIFIED:%s", icsTime(task.UpdatedAt))
+		line("SUMMARY:%s", icsEscaper.Replace(task.Title))
+		if task.Description != "" {
+			line("DESCRIPTION:%s", icsEscaper.Replace(task.Description))
+		}
+		if len(task.Tags) > 0 {
+			tags := make([]string, len(task.Tags))
+			for i, tag := range task.Tags {
+				tags[i] = icsEscaper.Replace(tag)
+			}
+			line("CATEGORIES:%s", strings.Join(tags, ","))
+		}
+		if priority, ok := icsPriorities[task.Priority]; ok {
+			line("PRIORITY:%d", priority)
+		}
+		if component == "VTODO" {
+			line("DUE;VALUE=DATE:%s", due.Format("20060102"))
+			if status, ok := icsStatuses[task.Status]; ok {
+				line("STATUS:%s", status)
+			}
+			if task.CompletedAt != nil {
+				line("COMPLETED:%s", icsTime(*task.CompletedAt))
+			}
+		} else {
+			line("DTSTART;VALUE=DATE:%s", due.Format("20060102"))
+			line("DTEND;VALUE=DATE:%s", due.AddDate(0, 0, 1).Format("20060102"))
+			line("TRANSP:TRANSPARENT")
+		}
+		line("END:%s", component)
+	}
+	line("END:VCALENDAR")
+	return b.String()
+}
+
+// icsTime formats t as a UTC DATE-TIME
+func icsTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// foldICSLine ends a content line with CRLF, folding it into lines of at
+// most 75 octets without splitting a UTF-8 character
+func foldICSLine(line string) string {
+	var b strings.Builder
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+		// Continuation lines start with the space
+		limit = 74
+	}
+	b.WriteString(line + "\r\n")
+	return b.String()
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCalendarFeed(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	ctx := context.Background()
+	server.store.Add(ctx, "Pay rent; call landlord, then relax", "Line one\nLine two", dueOn("2030-03-31"), "high", "home")
+	server.store.Add(ctx, "No due date", "", DueTime{}, "low")
+	r, _ := server.Router()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/tasks/export.ics", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/calendar; charset=utf-8" {
+		t.Fatalf("GET export.ics: status %d, Content-Type %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"BEGIN:VEVENT\r\nUID:task-1@taskmate\r\n",
+		`SUMMARY:Pay rent\; call landlord\, then relax` + "\r\n",
+		`DESCRIPTION:Line one\nLine two` + "\r\n",
+		"DTSTART;VALUE=DATE:20300331\r\nDTEND;VALUE=DATE:20300401\r\n",
+		"PRIORITY:2\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("feed lacks %q:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "No due date") {
+		t.Error("feed includes a task without a due date")
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/tasks/export.ics?component=vtodo", nil))
+	if body := w.Body.String(); !strings.Contains(body, "BEGIN:VTODO\r\n") || !strings.Contains(body, "DUE;VALUE=DATE:20300331\r\nSTATUS:NEEDS-ACTION\r\n") {
+		t.Errorf("vtodo feed:\n%s", body)
+	}
+}
+
+func TestCalendarFeedToken(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.CalendarFeedPrivate = true
+	server.config.TokenHashes = []string{hashString("secret-token")}
+	r, _ := server.Router()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/tasks/export.ics", nil))
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), ErrCodeFeedTokenInvalid) {
+		t.Errorf("private feed without a token: status %d; want 403 %s", w.Code, ErrCodeFeedTokenInvalid)
+	}
+
+	req := httptest.NewRequest("GET", "/api/v1/calendar/token", nil)
+	req.Header.Set("X-API-Token", "secret-token")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var resp struct{ URL, Token string }
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Token == "" {
+		t.Fatalf("GET /calendar/token: status %d, body %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", resp.URL, nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("GET %s: status %d; want 200", resp.URL, w.Code)
+	}
+	// A share link's token doesn't unlock the feed
+	share := server.signShareToken("1", server.now().Add(shareLinkTTL))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/tasks/export.ics?token="+share, nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("feed with a share token: status %d; want 403", w.Code)
+	}
+}
+
+func TestFoldICSLine(t *testing.T) {
+	line := "SUMMARY:" + strings.Repeat("é", 60)
+	folded := foldICSLine(line)
+	for _, part := range strings.Split(strings.TrimSuffix(folded, "\r\n"), "\r\n") {
+		if len(part) > 75 {
+			t.Errorf("folded line of %d octets: %q", len(part), part)
+		}
+	}
+	if unfolded := strings.ReplaceAll(strings.TrimSuffix(folded, "\r\n"), "\r\n ", ""); unfolded != line {
+		t.Errorf("unfolded %q; want %q", unfolded, line)
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxChangeLog is how many recent changes the store keeps for pollers.
+// Clients further behind than this must resync with a full GET /tasks.
+const maxChangeLog = 1000
+
+// defaultMaxPollTimeout caps ?timeout= when Config.MaxPollTimeoutSeconds is unset
+const defaultMaxPollTimeout = 60 * time.Second
+
+// Change types recorded in the change log
+const (
+	ChangeCreated = "created"
+	ChangeUpdated = "updated"
+	ChangeDeleted = "deleted"
+)
+
+// Change is one mutation in the store's change log. Task is a snapshot of
+// the task after the change and is omitted for deletions. RequestID is the
+// ID of the API request that made the change, if any.
+type Change struct {
+	Revision  int64  `json:"revision"`
+	Type      string `json:"type"`
+	TaskID    int    `json:"task_id"`
+	Task      *Task  `json:"task,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// recordChange bumps the revision, appends to the change log, updates the
+// search index and wakes any pollers. ctx is that of the mutating call, for
+// its request ID. The caller must hold the write lock and call it only
+// after the change has been saved.
+func (ts *TaskStore) recordChange(ctx context.Context, changeType string, task *Task) {
+	ts.revision++
+	change := Change{Revision: ts.revision, Type: changeType, TaskID: task.ID, RequestID: requestID(ctx)}
+	if changeType != ChangeDeleted {
+		snapshot := *task
+		change.Task = &snapshot
+	}
+	if ts.index != nil {
+		if changeType == ChangeDeleted {
+			ts.index.remove(task.ID)
+		} else {
+			ts.index.add(task)
+		}
+	}
+	ts.changes = append(ts.changes, change)
+	if len(ts.changes) > maxChangeLog {
+		ts.changes = append([]Change(nil), ts.changes[len(ts.changes)-maxChangeLog:]...)
+	}
+	ts.notifyChange()
+}
+
+// resetChanges discards the change log and rebuilds the search index after
+// a wholesale replacement of the task set, forcing every poller to resync.
+// The caller must hold the write lock.
+func (ts *TaskStore) resetChanges() {
+	ts.revision++
+	ts.changes = nil
+	ts.index = newTrigramIndex(ts.tasks)
+	ts.notifyChange()
+}
+
+// notifyChange wakes goroutines blocked in WaitForChanges
+func (ts *TaskStore) notifyChange() {
+	if ts.changed != nil {
+		close(ts.changed)
+	}
+	ts.changed = make(chan struct{})
+}
+
+// changesSinceLocked returns the changes after since. complete is false when
+// some of them are no longer in the log. The caller must hold a lock.
+func (ts *TaskStore) changesSinceLocked(since int64) (changes []Change, complete bool) {
+	changes = []Change{}
+	if since >= ts.revision {
+		return changes, true
+	}
+	if len(ts.changes) == 0 || ts.changes[0].Revision > since+1 {
+		return changes, false
+	}
+	for _, change := range ts.changes {
+		if change.Revision > since {
+			changes = append(changes, change)
+		}
+	}
+	return changes, true
+}
+
+// ChangesSince returns the changes after since without waiting for any,
+// the current revision and whether the changes are complete
+func (ts *TaskStore) ChangesSince(since int64) ([]Change, int64, bool) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	changes, complete := ts.changesSinceLocked(since)
+	return changes, ts.revision, complete
+}
+
+// Revision returns the store's current revision
+func (ts *TaskStore) Revision() int64 {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return ts.revision
+}
+
+// WaitForChanges blocks until there are changes after since or ctx is done,
+// then returns the changes (possibly none), the current revision and
+// whether the changes are complete.
+func (ts *TaskStore) WaitForChanges(ctx context.Context, since int64) ([]Change, int64, bool) {
+	for {
+		ts.mu.Lock()
+		if ts.changed == nil {
+			ts.changed = make(chan struct{})
+		}
+		if since < ts.revision || ctx.Err() != nil {
+			changes, complete := ts.changesSinceLocked(since)
+			revision := ts.revision
+			ts.mu.Unlock()
+			return changes, revision, complete
+		}
+		changed := ts.changed
+		ts.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+		}
+	}
+}
+
+// pollResponse is the body returned by the long-polling endpoint
+type pollResponse struct {
+	Revision int64        `json:"revision"`
+	Resync   bool         `json:"resync"`
+	Changes  []pollChange `json:"changes"`
+}
+
+// pollChange is a Change as shown to API clients
+type pollChange struct {
+	Revision int64       `json:"revision"`
+	Type     string      `json:"type"`
+	TaskID   interface{} `json:"task_id"`
+	Task     *publicTask `json:"task,omitempty"`
+}
+
+// handlePollChanges long-polls for changes after ?since=<revision>. It
+// returns as soon as there are changes, or with an empty list once
+// ?timeout= seconds pass. resync is true when the client is too far behind
+// the change log and must reload the full task list.
+func (s *Server) handlePollChanges(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	since, err := strconv.ParseInt(query.Get("since"), 10, 64)
+	if err != nil || since < 0 {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidQuery, "Query parameter since must be a revision number")
+		return
+	}
+
+	maxTimeout := defaultMaxPollTimeout
+	if s.config.MaxPollTimeoutSeconds > 0 {
+		maxTimeout = time.Duration(s.config.MaxPollTimeoutSeconds) * time.Second
+	}
+	timeout := 30 * time.Second
+	if v := query.Get("timeout"); v != "" {
+		seconds, err := strconv.Atoi(v)
+		if err != nil || seconds < 0 {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidQuery, "Invalid timeout")
+			return
+		}
+		timeout = time.Duration(seconds) * time.Second
+	}
+	if timeout > maxTimeout {
+		timeout = maxTimeout
+	}
+
+	// The server's WriteTimeout is shorter than a typical poll, so extend
+	// the deadline for this response. Recorders in tests don't support it.
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout + 10*time.Second))
+
+	streamCtx, stop := s.streamContext(r)
+	defer stop()
+	ctx, cancel := context.WithTimeout(streamCtx, timeout)
+	defer cancel()
+	changes, revision, complete := s.store.WaitForChanges(ctx, since)
+
+	response := pollResponse{Revision: revision, Resync: !complete, Changes: make([]pollChange, len(changes))}
+	for i, change := range changes {
+		response.Changes[i] = s.presentChange(change)
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// presentChange prepares a change for a response body
+func (s *Server) presentChange(change Change) pollChange {
+	item := pollChange{Revision: change.Revision, Type: change.Type, TaskID: s.presentTask(&Task{ID: change.TaskID}).ID}
+	if change.Task != nil {
+		task := s.presentTask(change.Task)
+		item.Task = &task
+	}
+	return item
+}
+
+// workspaceChangesResponse is the body returned by GET /changes: the
+// changes of each requested workspace, by workspace ID
+type workspaceChangesResponse struct {
+	Workspaces map[string]pollResponse `json:"workspaces"`
+}
+
+// parseWorkspaceSince reads ?since= for GET /changes. It is either one
+// revision for every workspace, or workspace:revision pairs separated by
+// commas, since each workspace counts its own revisions; workspaces
+// without a pair start from 0.
+func parseWorkspaceSince(raw string) (all int64, each map[string]int64, err error) {
+	if raw == "" || !strings.Contains(raw, ":") {
+		if raw != "" {
+			if all, err = strconv.ParseInt(raw, 10, 64); err != nil || all < 0 {
+				return 0, nil, errors.New("since must be a revision number or workspace:revision pairs")
+			}
+		}
+		return all, nil, nil
+	}
+	each = make(map[string]int64)
+	for _, pair := range strings.Split(raw, ",") {
+		id, rev, ok := strings.Cut(pair, ":")
+		revision, err := strconv.ParseInt(rev, 10, 64)
+		if !ok || id == "" || err != nil || revision < 0 {
+			return 0, nil, fmt.Errorf("invalid since pair %q", pair)
+		}
+		each[id] = revision
+	}
+	return 0, each, nil
+}
+
+// handleWorkspaceChanges returns what changed in several workspaces since
+// the given revisions, without waiting. ?workspaces= lists them, with
+// defaultWorkspaceID for the default one; without it every workspace is
+// included. A workspace whose since is older than its change log is
+// marked resync on its own, so the others still get their changes.
+func (s *Server) handleWorkspaceChanges(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	all, each, err := parseWorkspaceSince(query.Get("since"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidQuery, "Invalid since: "+err.Error())
+		return
+	}
+
+	var ids []string
+	if raw := query.Get("workspaces"); raw != "" {
+		seen := make(map[string]bool)
+		for _, id := range strings.Split(raw, ",") {
+			if id = strings.TrimSpace(id); id != "" && !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	} else {
+		ids = append(ids, defaultWorkspaceID)
+		s.mu.RLock()
+		for _, ws := range s.config.Workspaces {
+			ids = append(ids, ws.ID)
+		}
+		s.mu.RUnlock()
+	}
+
+	response := workspaceChangesResponse{Workspaces: make(map[string]pollResponse, len(ids))}
+	for _, id := range ids {
+		server, err := s.workspaceServerFor(id)
+		if errors.Is(err, errWorkspaceNotFound) {
+			writeError(w, http.StatusNotFound, ErrCodeWorkspaceNotFound, "Workspace not found: "+id)
+			return
+		}
+		if err != nil {
+			requestLogger(r.Context()).Error("Failed to open workspace", "workspace", id, "error", err)
+			writeError(w, http.StatusServiceUnavailable, ErrCodeInternal, "Workspace unavailable")
+			return
+		}
+		since, ok := each[id]
+		if !ok {
+			since = all
+		}
+		changes, revision, complete := server.store.ChangesSince(since)
+		result := pollResponse{Revision: revision, Resync: !complete, Changes: make([]pollChange, len(changes))}
+		for i, change := range changes {
+			result.Changes[i] = server.presentChange(change)
+		}
+		response.Workspaces[id] = result
+	}
+	writeJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPollUnblocksOnCreate(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	since := server.store.Revision()
+	req := httptest.NewRequest("GET", "/api/v1/tasks/poll?since=0&timeout=10", nil)
+	w := httptest.NewRecorder()
+	done := make(chan struct{})
+	start := time.Now()
+	go func() {
+		server.handlePollChanges(w, req)
+		close(done)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if _, err := server.store.Add(context.Background(), "Wake up", "", DueTime{}, "medium"); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("poll did not return after a task was created")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("poll took %v", elapsed)
+	}
+
+	var resp pollResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Revision != since+1 || resp.Resync {
+		t.Errorf("revision = %d, resync = %v; want %d, false", resp.Revision, resp.Resync, since+1)
+	}
+	if len(resp.Changes) != 1 || resp.Changes[0].Type != ChangeCreated || resp.Changes[0].Task == nil {
+		t.Fatalf("changes = %+v; want one created change with a task", resp.Changes)
+	}
+	if resp.Changes[0].Task.Title != "Wake up" {
+		t.Errorf("task title = %q; want %q", resp.Changes[0].Task.Title, "Wake up")
+	}
+}
+
+func TestPollTimeoutReturnsCurrentRevision(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	ctx := context.Background()
+	task, _ := server.store.Add(ctx, "First", "", DueTime{}, "medium")
+	server.store.Delete(ctx, task.ID)
+
+	req := httptest.NewRequest("GET", "/api/v1/tasks/poll?since=2&timeout=0", nil)
+	w := httptest.NewRecorder()
+	server.handlePollChanges(w, req)
+
+	var resp pollResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Revision != 2 || len(resp.Changes) != 0 || resp.Resync {
+		t.Errorf("response = %+v; want revision 2, no changes, no resync", resp)
+	}
+
+	req = httptest.NewRequest("GET", "/api/v1/tasks/poll?since=1&timeout=0", nil)
+	w = httptest.NewRecorder()
+	server.handlePollChanges(w, req)
+	resp = pollResponse{}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(resp.Changes) != 1 || resp.Changes[0].Type != ChangeDeleted || resp.Changes[0].Task != nil {
+		t.Errorf("changes = %+v; want one deleted change without a task", resp.Changes)
+	}
+}
+
+func TestPollResyncAfterReplace(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	ctx := context.Background()
+	server.store.Add(ctx, "First", "", DueTime{}, "medium")
+	if err := server.store.Replace(ctx, nil); err != nil {
+		t.Fatalf("Replace() error = %v", err)
+	}
+
+	changes, revision, complete := server.store.WaitForChanges(ctx, 0)
+	if complete || len(changes) != 0 || revision != 2 {
+		t.Errorf("WaitForChanges() = %v, %d, %v; want no changes, revision 2, incomplete", changes, revision, complete)
+	}
+}
+
+func TestPollRejectsInvalidSince(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	for _, query := range []string{"", "?since=abc", "?since=-1", "?since=0&timeout=x"} {
+		req := httptest.NewRequest("GET", "/api/v1/tasks/poll"+query, nil)
+		w := httptest.NewRecorder()
+		server.handlePollChanges(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%q: status = %d; want %d", query, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestWorkspaceChanges(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	defer os.RemoveAll(workspacesDir)
+	defer server.closeWorkspaces()
+	server.config.Workspaces = []Workspace{{ID: "acme"}, {ID: "beta"}}
+	server.config.TokenHashes = []string{hashString("admin"), hashString("edit")}
+	server.config.TokenRoles = map[string]string{hashString("edit"): RoleEditor}
+	r, err := server.Router()
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func(token, query string) (*httptest.ResponseRecorder, workspaceChangesResponse) {
+		req := httptest.NewRequest("GET", "/api/v1/changes"+query, nil)
+		req.Header.Set("X-API-Token", token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var body workspaceChangesResponse
+		json.NewDecoder(w.Body).Decode(&body)
+		return w, body
+	}
+
+	ctx := context.Background()
+	server.store.Add(ctx, "Default one", "", DueTime{}, "medium")
+	server.store.Add(ctx, "Default two", "", DueTime{}, "medium")
+	for id, title := range map[string]string{"acme": "Acme task", "beta": "Beta task"} {
+		ws, err := server.openWorkspace(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ws.server.store.Add(ctx, title, "", DueTime{}, "medium")
+	}
+	// beta's change log no longer reaches back to revision 0
+	beta, _ := server.openWorkspace("beta")
+	if err := beta.server.store.Replace(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	w, body := get("admin", "?since=default:1,acme:0&workspaces=default,acme,beta")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	if got := body.Workspaces["default"]; got.Revision != 2 || got.Resync || len(got.Changes) != 1 || got.Changes[0].Task.Title != "Default two" {
+		t.Errorf("default = %+v; want Default two at revision 2", got)
+	}
+	if got := body.Workspaces["acme"]; got.Revision != 1 || got.Resync || len(got.Changes) != 1 || got.Changes[0].Task.Title != "Acme task" {
+		t.Errorf("acme = %+v; want Acme task at revision 1", got)
+	}
+	if got := body.Workspaces["beta"]; !got.Resync || len(got.Changes) != 0 {
+		t.Errorf("beta = %+v; want resync without changes", got)
+	}
+
+	if _, body := get("admin", "?since=5"); len(body.Workspaces) != 3 || len(body.Workspaces["default"].Changes) != 0 {
+		t.Errorf("all workspaces since 5 = %+v; want default, acme and beta without changes", body.Workspaces)
+	}
+	for query, status := range map[string]int{
+		"?since=abc":                  http.StatusBadRequest,
+		"?since=acme:x":               http.StatusBadRequest,
+		"?since=0&workspaces=nope":    http.StatusNotFound,
+		"?since=0&workspaces=default": http.StatusOK,
+	} {
+		if w, _ := get("admin", query); w.Code != status {
+			t.Errorf("%s: status = %d; want %d", query, w.Code, status)
+		}
+	}
+	if w, _ := get("edit", "?since=0"); w.Code != http.StatusForbidden {
+		t.Errorf("editor token: status = %d; want %d", w.Code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,517 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// cliConfigFile is the CLI's settings file, relative to the home directory
+const cliConfigFile = ".taskmate/config"
+
+// cliTimeout bounds each API request the CLI makes
+const cliTimeout = 15 * time.Second
+
+// CLIConfig holds the settings of the taskmate client subcommands
+type CLIConfig struct {
+	// Server is the base URL of the TaskMate server (default:
+	// http://localhost:8080)
+	Server string `json:"server"`
+	Token  string `json:"token"`
+	// Offline makes the CLI read and write the tasks in the current
+	// directory directly instead of calling a server
+	Offline bool `json:"offline"`
+}
+
+// loadCLIConfig reads ~/.taskmate/config, if there is one, then applies the
+// TASKMATE_SERVER and TASKMATE_TOKEN environment variables
+func loadCLIConfig(getenv func(string) string) (*CLIConfig, error) {
+	config := &CLIConfig{}
+	if home, err := os.UserHomeDir(); err == nil {
+		data, err := os.ReadFile(filepath.Join(home, cliConfigFile))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if err == nil {
+			if err := json.Unmarshal(data, config); err != nil {
+				return nil, fmt.Errorf("%s: %w", cliConfigFile, err)
+			}
+		}
+	}
+	if server := getenv("TASKMATE_SERVER"); server != "" {
+		config.Server = server
+	}
+	if token := getenv("TASKMATE_TOKEN"); token != "" {
+		config.Token = token
+	}
+	if config.Server == "" {
+		config.Server = "http://localhost:8080"
+	}
+	return config, nil
+}
+
+// taskClient is what the CLI subcommands manage tasks through: the API of
+// a server, or the local store in offline mode. IDs are as the API shows
+// them, so they may be obfuscated.
+type taskClient interface {
+	Add(ctx context.Context, req createTaskRequest) (publicTask, error)
+	List(ctx context.Context, query url.Values) ([]publicTask, error)
+	// Patch applies a JSON merge patch, as PATCH /tasks/{id} does
+	Patch(ctx context.Context, id string, fields map[string]interface{}) (publicTask, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// apiClient calls a TaskMate server
+type apiClient struct {
+	base  string
+	token string
+	http  *http.Client
+}
+
+func newAPIClient(config *CLIConfig) *apiClient {
+	return &apiClient{
+		base:  strings.TrimRight(config.Server, "/") + "/api/v1",
+		token: config.Token,
+		http:  &http.Client{Timeout: cliTimeout},
+	}
+}
+
+// do sends a request with body encoded as JSON, if not nil, and decodes
+// the response into out, if not nil. Error responses are returned as
+// errors carrying the API's message and code.
+func (c *apiClient) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("X-API-Token", c.token)
+	}
+	if method == "PATCH" {
+		// Patches only send the fields being changed, so there is no stale
+		// copy to guard against; this keeps them working with
+		// require_if_match
+		req.Header.Set("If-Match", "*")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		var apiErr struct {
+			Error string `json:"error"`
+			Code  string `json:"code"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&apiErr) != nil || apiErr.Error == "" {
+			return fmt.Errorf("server returned %s", resp.Status)
+		}
+		return fmt.Errorf("%s (%s)", apiErr.Error, apiErr.Code)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *apiClient) Add(ctx context.Context, req createTaskRequest) (publicTask, error) {
+	var task publicTask
+	err := c.do(ctx, "POST", "/tasks", req, &task)
+	return task, err
+}
+
+func (c *apiClient) List(ctx context.Context, query url.Values) ([]publicTask, error) {
+	var tasks []publicTask
+	err := c.do(ctx, "GET", "/tasks?"+query.Encode(), nil, &tasks)
+	return tasks, err
+}
+
+func (c *apiClient) Patch(ctx context.Context, id string, fields map[string]interface{}) (publicTask, error) {
+	var task publicTask
+	err := c.do(ctx, "PATCH", "/tasks/"+url.PathEscape(id), fields, &task)
+	return task, err
+}
+
+func (c *apiClient) Delete(ctx context.Context, id string) error {
+	return c.do(ctx, "DELETE", "/tasks/"+url.PathEscape(id), nil, nil)
+}
+
+// localClient works on the store in the data directory, with the same
+// defaults and validation as the server configured there
+type localClient struct {
+	server *Server
+}
+
+// openLocalClient opens the store configured by config.json in the data
+// directory, as the server would
+func openLocalClient() (*localClient, error) {
+	config, err := LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("load config: %w", err)
+	}
+	store, err := OpenStore(config, dataPath("tasks.json"))
+	if err != nil {
+		return nil, fmt.Errorf("open storage: %w", err)
+	}
+	store.audit, err = openAuditLog(config.auditLogPath())
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	return &localClient{server: NewServerWithStore(config, store)}, nil
+}
+
+func (c *localClient) Close() error {
+	return c.server.store.Close()
+}
+
+func (c *localClient) Add(ctx context.Context, req createTaskRequest) (publicTask, error) {
+	fields, err := c.server.newTaskFields(&req, c.server.location)
+	if err != nil {
+		return publicTask{}, err
+	}
+	task, err := c.server.store.AddTask(ctx, fields)
+	if err != nil {
+		return publicTask{}, err
+	}
+	return c.server.presentTask(task), nil
+}
+
+func (c *localClient) List(ctx context.Context, query url.Values) ([]publicTask, error) {
+	filter, err := parseTaskFilter(query, c.server.location)
+	if err != nil {
+		return nil, err
+	}
+	tasks := c.server.store.List(filter)
+	sortTasks(tasks, c.server.config.DefaultSort, c.server.config.DefaultOrder, c.server.store.priorities)
+	return c.server.presentTasks(tasks), nil
+}
+
+func (c *localClient) Patch(ctx context.Context, id string, fields map[string]interface{}) (publicTask, error) {
+	taskID, err := c.server.decodeTaskID(id)
+	if err != nil {
+		return publicTask{}, fmt.Errorf("invalid task ID %q", id)
+	}
+	body, err := json.Marshal(fields)
+	if err != nil {
+		return publicTask{}, err
+	}
+	patch, err := c.server.parseTaskPatch(body, c.server.location)
+	if err != nil {
+		return publicTask{}, err
+	}
+	task, exists, err := c.server.store.Patch(ctx, taskID, patch)
+	if err != nil {
+		return publicTask{}, err
+	}
+	if !exists {
+		return publicTask{}, fmt.Errorf("task %s not found", id)
+	}
+	return c.server.presentTask(task), nil
+}
+
+func (c *localClient) Delete(ctx context.Context, id string) error {
+	taskID, err := c.server.decodeTaskID(id)
+	if err != nil {
+		return fmt.Errorf("invalid task ID %q", id)
+	}
+	deleted, err := c.server.store.Delete(ctx, taskID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return fmt.Errorf("task %s not found", id)
+	}
+	return nil
+}
+
+// cliEnv is what the client subcommands share: the environment they read
+// their settings from and the persistent --offline and --server flags
+type cliEnv struct {
+	getenv  func(string) string
+	offline bool
+	server  string
+}
+
+// cliRunFunc runs a client subcommand with its positional arguments
+type cliRunFunc func(ctx context.Context, c taskClient, args []string, out io.Writer) error
+
+// run returns a cobra RunE that opens the client the flags and settings
+// ask for, the server's API or the local store, and calls fn with it
+func (e *cliEnv) run(fn cliRunFunc) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		config, err := loadCLIConfig(e.getenv)
+		if err != nil {
+			return err
+		}
+		if e.server != "" {
+			config.Server = e.server
+		}
+
+		var client taskClient
+		if e.offline || config.Offline {
+			if err := configurePaths("", "", e.getenv); err != nil {
+				return err
+			}
+			local, err := openLocalClient()
+			if err != nil {
+				return err
+			}
+			defer local.Close()
+			client = local
+		} else {
+			client = newAPIClient(config)
+		}
+		return fn(cmd.Context(), client, args, cmd.OutOrStdout())
+	}
+}
+
+// errUsage is returned for a subcommand given the wrong arguments or flags
+var errUsage = errors.New("usage")
+
+// usageArgs wraps a cobra argument check so that its errors are usage
+// errors
+func usageArgs(check cobra.PositionalArgs) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if err := check(cmd, args); err != nil {
+			return fmt.Errorf("%w: %v", errUsage, err)
+		}
+		return nil
+	}
+}
+
+// newCLI builds the client subcommands, which make taskmate act as a
+// client instead of starting a server. Flags may come before or after the
+// positional arguments, as in "taskmate edit 3 --priority high".
+func newCLI(getenv func(string) string) *cobra.Command {
+	env := &cliEnv{getenv: getenv}
+	root := &cobra.Command{
+		Use:           "taskmate",
+		Short:         "Manage the tasks of a TaskMate server",
+		SilenceErrors: true,
+		SilenceUsage:  true,
+	}
+	root.CompletionOptions.DisableDefaultCmd = true
+	root.PersistentFlags().BoolVar(&env.offline, "offline", false, "Use the tasks in TASKMATE_DATA_DIR (default: the current directory) instead of the server")
+	root.PersistentFlags().StringVar(&env.server, "server", "", "Server URL (default from ~/.taskmate/config or TASKMATE_SERVER)")
+	root.SetFlagErrorFunc(func(_ *cobra.Command, err error) error {
+		return fmt.Errorf("%w: %v", errUsage, err)
+	})
+	root.AddCommand(cliAdd(env), cliList(env), cliDone(env), cliRemove(env), cliEdit(env), cliTUI(env))
+	return root
+}
+
+// isCLICommand reports whether name is a client subcommand
+func isCLICommand(name string) bool {
+	for _, cmd := range newCLI(os.Getenv).Commands() {
+		if cmd.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// runCLI runs the subcommand named by args[0] and returns the exit status:
+// 2 for usage errors and 1 for other failures
+func runCLI(args []string, stdout, stderr io.Writer, getenv func(string) string) int {
+	root := newCLI(getenv)
+	root.SetArgs(args)
+	root.SetOut(stdout)
+	root.SetErr(stderr)
+	cmd, err := root.ExecuteContextC(context.Background())
+	if errors.Is(err, errUsage) {
+		if err.Error() != errUsage.Error() {
+			fmt.Fprintf(stderr, "taskmate: %v\n", err)
+		}
+		fmt.Fprint(stderr, cmd.UsageString())
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "taskmate: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func cliAdd(env *cliEnv) *cobra.Command {
+	var description, due, priority, tags, recurrence string
+	var project int
+	cmd := &cobra.Command{
+		Use:   "add [flags] <title>",
+		Short: "Add a task",
+		Args:  usageArgs(cobra.MinimumNArgs(1)),
+	}
+	cmd.Flags().StringVar(&description, "description", "", "Task description")
+	cmd.Flags().StringVar(&due, "due", "", "Due date (YYYY-MM-DD or RFC 3339)")
+	cmd.Flags().StringVar(&priority, "priority", "", "Priority: low, medium, high, urgent or a configured level")
+	cmd.Flags().StringVar(&tags, "tags", "", "Comma-separated tags")
+	cmd.Flags().StringVar(&recurrence, "recurrence", "", "Recurrence, e.g. daily or weekly")
+	cmd.Flags().IntVar(&project, "project", 0, "Project ID")
+	cmd.RunE = env.run(func(ctx context.Context, c taskClient, args []string, out io.Writer) error {
+		task, err := c.Add(ctx, createTaskRequest{
+			Title:       strings.Join(args, " "),
+			Description: description,
+			DueDate:     due,
+			Priority:    priority,
+			Tags:        splitList(tags),
+			ProjectID:   project,
+			Recurrence:  recurrence,
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Created task %v: %s\n", task.ID, task.Title)
+		return nil
+	})
+	return cmd
+}
+
+func cliList(env *cliEnv) *cobra.Command {
+	var status, priority, tag string
+	var all bool
+	cmd := &cobra.Command{
+		Use:   "list [flags]",
+		Short: "List open tasks",
+		Args:  usageArgs(cobra.NoArgs),
+	}
+	cmd.Flags().StringVar(&status, "status", "", "Comma-separated statuses to show")
+	cmd.Flags().StringVar(&priority, "priority", "", "Comma-separated priorities to show")
+	cmd.Flags().StringVar(&tag, "tag", "", "Comma-separated tags; tasks with any of them are shown")
+	cmd.Flags().BoolVar(&all, "all", false, "Include completed tasks")
+	cmd.RunE = env.run(func(ctx context.Context, c taskClient, args []string, out io.Writer) error {
+		query := url.Values{}
+		for name, value := range map[string]string{"status": status, "priority": priority, "tag": tag} {
+			if value != "" {
+				query.Set(name, value)
+			}
+		}
+		if status == "" && !all {
+			query.Set("status", "pending,in_progress")
+		}
+		tasks, err := c.List(ctx, query)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tSTATUS\tPRIORITY\tDUE\tTITLE")
+		for _, task := range tasks {
+			fmt.Fprintf(tw, "%v\t%s\t%s\t%s\t%s\n", task.ID, task.Status, task.Priority, task.DueDate.Day(time.Local), task.Title)
+		}
+		return tw.Flush()
+	})
+	return cmd
+}
+
+func cliDone(env *cliEnv) *cobra.Command {
+	return &cobra.Command{
+		Use:   "done <id>...",
+		Short: "Complete tasks",
+		Args:  usageArgs(cobra.MinimumNArgs(1)),
+		RunE: env.run(func(ctx context.Context, c taskClient, args []string, out io.Writer) error {
+			for _, id := range args {
+				task, err := c.Patch(ctx, id, map[string]interface{}{"status": "completed"})
+				if err != nil {
+					return fmt.Errorf("task %s: %w", id, err)
+				}
+				fmt.Fprintf(out, "Completed task %v: %s\n", task.ID, task.Title)
+			}
+			return nil
+		}),
+	}
+}
+
+func cliRemove(env *cliEnv) *cobra.Command {
+	return &cobra.Command{
+		Use:   "rm <id>...",
+		Short: "Delete tasks",
+		Args:  usageArgs(cobra.MinimumNArgs(1)),
+		RunE: env.run(func(ctx context.Context, c taskClient, args []string, out io.Writer) error {
+			for _, id := range args {
+				if err := c.Delete(ctx, id); err != nil {
+					return fmt.Errorf("task %s: %w", id, err)
+				}
+				fmt.Fprintf(out, "Deleted task %s\n", id)
+			}
+			return nil
+		}),
+	}
+}
+
+func cliEdit(env *cliEnv) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "edit <id> [flags]",
+		Short: "Change fields of a task",
+		Args:  usageArgs(cobra.ExactArgs(1)),
+	}
+	cmd.Flags().String("title", "", "New title")
+	cmd.Flags().String("status", "", "Status: pending, in_progress or completed")
+	cmd.Flags().String("priority", "", "Priority: low, medium, high, urgent or a configured level")
+	cmd.Flags().String("description", "", "Task description; empty clears it")
+	cmd.Flags().String("due", "", "Due date (YYYY-MM-DD or RFC 3339); empty clears it")
+	cmd.Flags().String("recurrence", "", "Recurrence, e.g. daily or weekly; empty stops it")
+	project := cmd.Flags().Int("project", 0, "Project ID; 0 removes the task from its project")
+	cmd.RunE = env.run(func(ctx context.Context, c taskClient, args []string, out io.Writer) error {
+		// Only the flags given are changed
+		patch := make(map[string]interface{})
+		cmd.Flags().Visit(func(f *pflag.Flag) {
+			switch f.Name {
+			case "title", "status", "priority":
+				patch[f.Name] = f.Value.String()
+			case "description", "recurrence":
+				patch[f.Name] = nullIfEmpty(f.Value.String())
+			case "due":
+				patch["due_date"] = nullIfEmpty(f.Value.String())
+			case "project":
+				if *project == 0 {
+					patch["project_id"] = nil
+				} else {
+					patch["project_id"] = *project
+				}
+			}
+		})
+		if len(patch) == 0 {
+			return fmt.Errorf("%w: no fields to change", errUsage)
+		}
+		task, err := c.Patch(ctx, args[0], patch)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Updated task %v: %s\n", task.ID, task.Title)
+		return nil
+	})
+	return cmd
+}
+
+// nullIfEmpty returns nil, which clears a field in a merge patch, for an
+// empty value
+func nullIfEmpty(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+	return value
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// runCLITest runs a client subcommand and returns its output, failing the
+// test unless it exits with want
+func runCLITest(t *testing.T, env map[string]string, want int, args ...string) string {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	if code := runCLI(args, &stdout, &stderr, func(key string) string { return env[key] }); code != want {
+		t.Fatalf("taskmate %s: exit %d, stderr %q; want %d", strings.Join(args, " "), code, stderr.String(), want)
+	}
+	return stdout.String() + stderr.String()
+}
+
+func TestCLIAgainstServer(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.TokenHashes = []string{hashString("secret-token")}
+	r, _ := server.Router()
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	env := map[string]string{"TASKMATE_SERVER": ts.URL, "TASKMATE_TOKEN": "secret-token"}
+
+	if out := runCLITest(t, env, 0, "add", "Buy", "milk", "--priority", "high", "--tags", "home,errand"); out != "Created task 1: Buy milk\n" {
+		t.Errorf("add output %q", out)
+	}
+	runCLITest(t, env, 0, "add", "Write report")
+	runCLITest(t, env, 0, "done", "2")
+	out := runCLITest(t, env, 0, "list")
+	if !strings.Contains(out, "Buy milk") || strings.Contains(out, "Write report") {
+		t.Errorf("list output %q; want only the open task", out)
+	}
+	if out := runCLITest(t, env, 0, "list", "--all"); !strings.Contains(out, "Write report") {
+		t.Errorf("list --all output %q; want the completed task too", out)
+	}
+
+	runCLITest(t, env, 0, "edit", "1", "--title", "Buy oat milk", "--due", "2030-01-02")
+	task, _ := server.store.Get(1)
+	if task.Title != "Buy oat milk" || task.DueDate.Day(time.Local) != "2030-01-02" || task.Priority != "high" {
+		t.Errorf("after edit task = %+v; want the title and due date changed only", task)
+	}
+
+	runCLITest(t, env, 0, "rm", "1")
+	if _, ok := server.store.Get(1); ok {
+		t.Error("rm left the task in the store")
+	}
+	if out := runCLITest(t, env, 1, "rm", "1"); !strings.Contains(out, "TASK_NOT_FOUND") {
+		t.Errorf("rm of a missing task output %q; want the API's error code", out)
+	}
+	if out := runCLITest(t, map[string]string{"TASKMATE_SERVER": ts.URL}, 1, "add", "No token"); !strings.Contains(out, "TOKEN_REQUIRED") {
+		t.Errorf("add without a token output %q; want the server's refusal", out)
+	}
+}
+
+func TestCLIOffline(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	wd, _ := os.Getwd()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	env := map[string]string{"TASKMATE_SERVER": "http://127.0.0.1:1"}
+
+	runCLITest(t, env, 0, "add", "--offline", "Local task", "--due", "2030-05-01")
+	runCLITest(t, env, 0, "edit", "--offline", "1", "--priority", "low")
+	out := runCLITest(t, env, 0, "list", "--offline")
+	if !strings.Contains(out, "Local task") || !strings.Contains(out, "low") {
+		t.Errorf("list output %q; want the edited local task", out)
+	}
+
+	store := NewTaskStore("tasks.json")
+	if task, ok := store.Get(1); !ok || task.DueDate.Day(time.Local) != "2030-05-01" {
+		t.Errorf("tasks.json task = %+v; want the task added offline", task)
+	}
+	runCLITest(t, env, 1, "done", "--offline", "7")
+	runCLITest(t, env, 2, "add", "--offline")
+}
+
+func TestLoadCLIConfig(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := os.MkdirAll(filepath.Join(home, ".taskmate"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	data := `{"server": "https://tasks.example.com", "token": "from-file", "offline": true}`
+	if err := os.WriteFile(filepath.Join(home, cliConfigFile), []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := loadCLIConfig(func(key string) string {
+		return map[string]string{"TASKMATE_TOKEN": "from-env"}[key]
+	})
+	if err != nil {
+		t.Fatalf("loadCLIConfig() error = %v", err)
+	}
+	want := CLIConfig{Server: "https://tasks.example.com", Token: "from-env", Offline: true}
+	if *config != want {
+		t.Errorf("loadCLIConfig() = %+v; want %+v", *config, want)
+	}
+}
+
+func TestRunCLIUsage(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	env := map[string]string{"TASKMATE_SERVER": "http://127.0.0.1:1"}
+
+	out := runCLITest(t, env, 2, "edit", "3", "--colour", "red")
+	if !strings.Contains(out, "unknown flag: --colour") || !strings.Contains(out, "taskmate edit <id> [flags]") {
+		t.Errorf("unknown flag output %q; want the error and edit's usage", out)
+	}
+	if out := runCLITest(t, env, 2, "edit", "3"); !strings.Contains(out, "no fields to change") {
+		t.Errorf("edit without flags output %q; want a usage error", out)
+	}
+	runCLITest(t, env, 2, "list", "extra")
+	if out := runCLITest(t, env, 0, "add", "--help"); !strings.Contains(out, "--due string") || !strings.Contains(out, "--offline") {
+		t.Errorf("add --help output %q; want its flags and the shared ones", out)
+	}
+
+	for name, want := range map[string]bool{"add": true, "tui": true, "serve": false, "--help": false} {
+		if got := isCLICommand(name); got != want {
+			t.Errorf("isCLICommand(%q) = %v; want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,466 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// inviteLinkTTL is how long an invite link stays valid after it is minted
+const inviteLinkTTL = 7 * 24 * time.Hour
+
+// Permissions a collaborator can have on a project: viewers can only read
+// it, which anyone can, and editors can also change its tasks and rename
+// it. Only the owner, or an admin, can share or delete it.
+const (
+	PermissionView = "view"
+	PermissionEdit = "edit"
+	// permissionOwner is what the owner may do, more than any collaborator
+	permissionOwner = "owner"
+)
+
+// permissionRanks lists the permissions from least to most privileged
+var permissionRanks = map[string]int{
+	PermissionView:  1,
+	PermissionEdit:  2,
+	permissionOwner: 3,
+}
+
+// Collaborator is a user a project is shared with
+type Collaborator struct {
+	// User is named as in the audit log, "token:<id>" or "user:<subject>"
+	User       string    `json:"user"`
+	Permission string    `json:"permission"`
+	AddedAt    time.Time `json:"added_at"`
+}
+
+var (
+	// ErrProjectForbidden is returned when the caller lacks the permission
+	// a change to a project or its tasks takes
+	ErrProjectForbidden = errors.New("not permitted in project")
+	// ErrProjectUnowned is returned when sharing a project without an
+	// owner, which everyone can already change
+	ErrProjectUnowned = errors.New("project has no owner")
+	// ErrCollaboratorNotFound is returned when removing a user the project
+	// isn't shared with
+	ErrCollaboratorNotFound = errors.New("collaborator not found")
+
+	errInviteInvalid = errors.New("invite link is malformed or has been tampered with")
+	errInviteExpired = errors.New("invite link has expired")
+)
+
+// permission returns what user may do in the project: "owner", their
+// permission as a collaborator, or "" if it isn't shared with them
+func (p *Project) permission(user string) string {
+	if user == p.Owner {
+		return permissionOwner
+	}
+	for _, c := range p.Collaborators {
+		if c.User == user {
+			return c.Permission
+		}
+	}
+	return ""
+}
+
+// checkProjectLocked returns ErrProjectForbidden unless the caller may make
+// a change that takes need in the project with projectID. Changes outside
+// any project, in a project without an owner, by an admin or by the server
+// itself are always allowed. The caller must hold a lock.
+func (ts *TaskStore) checkProjectLocked(ctx context.Context, projectID int, need string) error {
+	project, exists := ts.projects[projectID]
+	if !exists || project.Owner == "" {
+		return nil
+	}
+	info, ok := ctx.Value(tokenKey{}).(tokenInfo)
+	if !ok || info.hasScope(ScopeAdmin) {
+		return nil
+	}
+	if permissionRanks[project.permission(info.actor())] < permissionRanks[need] {
+		return ErrProjectForbidden
+	}
+	return nil
+}
+
+// CheckProject returns ErrProjectForbidden unless the caller may make a
+// change that takes need in the project. Like GetProject, the bool reports
+// whether the project exists.
+func (ts *TaskStore) CheckProject(ctx context.Context, id int, need string) (bool, error) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	project, exists := ts.projects[id]
+	if !exists {
+		return false, nil
+	}
+	if need == permissionOwner && project.Owner == "" {
+		return true, ErrProjectUnowned
+	}
+	return true, ts.checkProjectLocked(ctx, id, need)
+}
+
+// changeCollaborators replaces a project's collaborators with what change
+// returns for them, saving the project and restoring it if the save fails.
+// The bool reports whether the project exists.
+func (ts *TaskStore) changeCollaborators(ctx context.Context, id int, change func(project *Project) ([]Collaborator, error)) (*Project, bool, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	project, exists := ts.projects[id]
+	if !exists {
+		return nil, false, nil
+	}
+	if project.Owner == "" {
+		return nil, true, ErrProjectUnowned
+	}
+	collaborators, err := change(project)
+	if err != nil {
+		return nil, true, err
+	}
+
+	prev := *project
+	project.Collaborators = collaborators
+	project.UpdatedAt = ts.now()
+	if err := ts.saveProjects(ctx, id); err != nil {
+		*project = prev
+		return nil, true, fmt.Errorf("save projects: %w", err)
+	}
+	ts.recordMutation(ctx, AuditUpdate, auditProject, id, &prev, project)
+	return project, true, nil
+}
+
+// withCollaborator returns collaborators with user given permission, added
+// at now if they weren't there already. It doesn't modify collaborators.
+func withCollaborator(collaborators []Collaborator, user, permission string, now time.Time) []Collaborator {
+	updated := make([]Collaborator, 0, len(collaborators)+1)
+	found := false
+	for _, c := range collaborators {
+		if c.User == user {
+			c.Permission = permission
+			found = true
+		}
+		updated = append(updated, c)
+	}
+	if !found {
+		updated = append(updated, Collaborator{User: user, Permission: permission, AddedAt: now})
+	}
+	return updated
+}
+
+// ShareProject shares a project with user, or changes the permission they
+// have. Only the owner or an admin may.
+func (ts *TaskStore) ShareProject(ctx context.Context, id int, user, permission string) (*Project, bool, error) {
+	return ts.changeCollaborators(ctx, id, func(project *Project) ([]Collaborator, error) {
+		if err := ts.checkProjectLocked(ctx, id, permissionOwner); err != nil {
+			return nil, err
+		}
+		if user == project.Owner {
+			return nil, &validationError{ErrCodeInvalidCollaborator, "The owner can't be a collaborator"}
+		}
+		return withCollaborator(project.Collaborators, user, permission, ts.now()), nil
+	})
+}
+
+// JoinProject makes the caller a collaborator with permission, as
+// accepting an invite does. It never lowers the permission they have.
+func (ts *TaskStore) JoinProject(ctx context.Context, id int, permission string) (*Project, bool, error) {
+	user := auditActor(ctx)
+	return ts.changeCollaborators(ctx, id, func(project *Project) ([]Collaborator, error) {
+		if permissionRanks[project.permission(user)] >= permissionRanks[permission] {
+			return project.Collaborators, nil
+		}
+		return withCollaborator(project.Collaborators, user, permission, ts.now()), nil
+	})
+}
+
+// UnshareProject removes user from a project's collaborators. The owner
+// or an admin may remove anyone, and collaborators may remove themselves.
+func (ts *TaskStore) UnshareProject(ctx context.Context, id int, user string) (bool, error) {
+	_, exists, err := ts.changeCollaborators(ctx, id, func(project *Project) ([]Collaborator, error) {
+		if user != auditActor(ctx) {
+			if err := ts.checkProjectLocked(ctx, id, permissionOwner); err != nil {
+				return nil, err
+			}
+		}
+		remaining := make([]Collaborator, 0, len(project.Collaborators))
+		for _, c := range project.Collaborators {
+			if c.User != user {
+				remaining = append(remaining, c)
+			}
+		}
+		if len(remaining) == len(project.Collaborators) {
+			return nil, ErrCollaboratorNotFound
+		}
+		return remaining, nil
+	})
+	return exists, err
+}
+
+// validatePermission checks a collaborator permission. Errors are
+// *validationError.
+func validatePermission(permission string) error {
+	if permission != PermissionView && permission != PermissionEdit {
+		return &validationError{ErrCodeInvalidPermission, "permission must be view or edit"}
+	}
+	return nil
+}
+
+// signInviteToken returns a token that lets whoever accepts it join the
+// project with permission until expires. It is built as share tokens are,
+// from the payload "<project id>.<permission>.<unix expiry>", with the MAC
+// taken over the payload prefixed by "invite." so that neither kind of
+// token passes for the other.
+func (s *Server) signInviteToken(projectID int, permission string, expires time.Time) string {
+	payload := strconv.Itoa(projectID) + "." + permission + "." + strconv.FormatInt(expires.Unix(), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(s.shareMAC([]byte("invite."+payload)))
+}
+
+// verifyInviteToken checks the token's signature and expiry and returns the
+// project and permission it invites to
+func (s *Server) verifyInviteToken(token string) (int, string, error) {
+	encodedPayload, encodedMAC, ok := strings.Cut(token, ".")
+	if !ok {
+		return 0, "", errInviteInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return 0, "", errInviteInvalid
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil || !hmac.Equal(mac, s.shareMAC(append([]byte("invite."), payload...))) {
+		return 0, "", errInviteInvalid
+	}
+
+	parts := strings.Split(string(payload), ".")
+	if len(parts) != 3 || validatePermission(parts[1]) != nil {
+		return 0, "", errInviteInvalid
+	}
+	projectID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, "", errInviteInvalid
+	}
+	expiry, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return 0, "", errInviteInvalid
+	}
+	if !s.now().Before(time.Unix(expiry, 0)) {
+		return 0, "", errInviteExpired
+	}
+	return projectID, parts[1], nil
+}
+
+// userByEmail returns the user smtp.recipients gives address to, ignoring
+// case
+func (s *Server) userByEmail(address string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for user, recipient := range s.config.SMTP.Recipients {
+		if strings.EqualFold(recipient, address) {
+			return user, true
+		}
+	}
+	return "", false
+}
+
+// writeProjectError writes the response for an error from a collaborator
+// change, falling back to writeStoreError
+func writeProjectError(w http.ResponseWriter, err error) {
+	var verr *validationError
+	switch {
+	case errors.As(err, &verr):
+		writeValidationError(w, err)
+	case errors.Is(err, ErrProjectUnowned):
+		writeError(w, http.StatusConflict, ErrCodeProjectUnowned, "Project has no owner, so everyone can already change it")
+	case errors.Is(err, ErrCollaboratorNotFound):
+		writeError(w, http.StatusNotFound, ErrCodeCollaboratorNotFound, "Collaborator not found")
+	default:
+		writeStoreError(w, err)
+	}
+}
+
+// collaboratorRequest is the body accepted when sharing a project
+type collaboratorRequest struct {
+	// User names the collaborator as in the audit log; Email can name them
+	// instead by their address in smtp.recipients
+	User  string `json:"user"`
+	Email string `json:"email"`
+	// Permission is view or edit; omitted, it is edit
+	Permission string `json:"permission"`
+}
+
+// handleAddCollaborator shares a project with a user
+func (s *Server) handleAddCollaborator(w http.ResponseWriter, r *http.Request) {
+	id, err := parseProjectID(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidProjectID, "Invalid project ID")
+		return
+	}
+	var req collaboratorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	if req.Permission == "" {
+		req.Permission = PermissionEdit
+	}
+	if err := validatePermission(req.Permission); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	if req.Email != "" {
+		user, ok := s.userByEmail(req.Email)
+		if !ok {
+			writeError(w, http.StatusUnprocessableEntity, ErrCodeUnknownUser, "No user has that email address; send them an invite instead")
+			return
+		}
+		req.User = user
+	}
+	if err := validateAssignee(req.User); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, ErrCodeInvalidCollaborator, "user must be token:<id> or user:<subject>")
+		return
+	}
+
+	project, exists, err := s.store.ShareProject(r.Context(), id, req.User, req.Permission)
+	if err != nil {
+		writeProjectError(w, err)
+		return
+	}
+	if !exists {
+		writeError(w, http.StatusNotFound, ErrCodeProjectNotFound, "Project not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, project)
+}
+
+// handleRemoveCollaborator stops sharing a project with a user
+func (s *Server) handleRemoveCollaborator(w http.ResponseWriter, r *http.Request) {
+	id, err := parseProjectID(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidProjectID, "Invalid project ID")
+		return
+	}
+	exists, err := s.store.UnshareProject(r.Context(), id, mux.Vars(r)["user"])
+	switch {
+	case err != nil:
+		writeProjectError(w, err)
+	case !exists:
+		writeError(w, http.StatusNotFound, ErrCodeProjectNotFound, "Project not found")
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// inviteRequest is the body accepted when inviting to a project
+type inviteRequest struct {
+	// Permission is view or edit; omitted, it is edit
+	Permission string `json:"permission"`
+	// Email, if set, is mailed the invite link
+	Email string `json:"email"`
+}
+
+// handleCreateInvite mints a link that lets whoever accepts it join a
+// project, mailing it to the given address
+func (s *Server) handleCreateInvite(w http.ResponseWriter, r *http.Request) {
+	id, err := parseProjectID(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidProjectID, "Invalid project ID")
+		return
+	}
+	var req inviteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	if req.Permission == "" {
+		req.Permission = PermissionEdit
+	}
+	if err := validatePermission(req.Permission); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	if req.Email != "" {
+		if _, err := mail.ParseAddress(req.Email); err != nil {
+			writeError(w, http.StatusUnprocessableEntity, ErrCodeValidation, "Invalid email address")
+			return
+		}
+		if s.emailTemplates == nil {
+			writeError(w, http.StatusUnprocessableEntity, ErrCodeValidation, "Emailing invites needs smtp.host")
+			return
+		}
+	}
+
+	exists, err := s.store.CheckProject(r.Context(), id, permissionOwner)
+	if err != nil {
+		writeProjectError(w, err)
+		return
+	}
+	if !exists {
+		writeError(w, http.StatusNotFound, ErrCodeProjectNotFound, "Project not found")
+		return
+	}
+
+	expires := s.now().Add(inviteLinkTTL).Truncate(time.Second)
+	token := s.signInviteToken(id, req.Permission, expires)
+	link := s.linkURL("/api/v1/invites/" + token)
+	response := map[string]interface{}{
+		"url":        link,
+		"token":      token,
+		"permission": req.Permission,
+		"expires_at": expires.UTC(),
+	}
+	if req.Email != "" {
+		project, _ := s.store.GetProject(id)
+		err := s.sendEmail(req.Email, emailInvite, "Invitation to "+project.Name, emailData{
+			Project:    project,
+			By:         auditActor(r.Context()),
+			Link:       link,
+			Permission: req.Permission,
+		})
+		if err != nil {
+			slog.Warn("Invite email failed", "project_id", id, "error", err)
+		} else {
+			response["emailed"] = req.Email
+		}
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleAcceptInvite makes the caller a collaborator on the project an
+// invite link is for
+func (s *Server) handleAcceptInvite(w http.ResponseWriter, r *http.Request) {
+	id, permission, err := s.verifyInviteToken(mux.Vars(r)["token"])
+	switch {
+	case errors.Is(err, errInviteExpired):
+		writeError(w, http.StatusForbidden, ErrCodeInviteExpired, "Invite link has expired")
+		return
+	case err != nil:
+		writeError(w, http.StatusForbidden, ErrCodeInviteInvalid, "Invalid invite link")
+		return
+	}
+
+	project, exists, err := s.store.JoinProject(r.Context(), id, permission)
+	if err != nil {
+		writeProjectError(w, err)
+		return
+	}
+	if !exists {
+		writeError(w, http.StatusNotFound, ErrCodeProjectNotFound, "Project not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, project)
+}
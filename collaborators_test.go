@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSharedProjects(t *testing.T) {
+	server, sent, cleanup := setupMailServer(t)
+	defer cleanup()
+	hashes := map[string]string{}
+	for _, name := range []string{"alice", "bob", "carol", "dave"} {
+		hashes[name] = hashString(name + "-token")
+		server.config.TokenHashes = append(server.config.TokenHashes, hashes[name])
+	}
+	server.config.TokenHashes = append(server.config.TokenHashes, hashString("admin-token"))
+	server.config.TokenRoles = map[string]string{}
+	users := map[string]string{}
+	for name, hash := range hashes {
+		server.config.TokenRoles[hash] = RoleEditor
+		users[name] = "token:" + tokenID(hash)
+	}
+	server.config.SMTP.Recipients = map[string]string{users["bob"]: "Bob@example.com"}
+	r, err := server.Router()
+	if err != nil {
+		t.Fatal(err)
+	}
+	send := func(name, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-API-Token", name+"-token")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	expect := func(w *httptest.ResponseRecorder, status int, what string) {
+		t.Helper()
+		if w.Code != status {
+			t.Fatalf("%s: status %d; want %d: %s", what, w.Code, status, w.Body.String())
+		}
+	}
+
+	w := send("alice", "POST", "/api/v1/projects", `{"name": "Groceries"}`)
+	var project Project
+	json.NewDecoder(w.Body).Decode(&project)
+	if w.Code != http.StatusCreated || project.Owner != users["alice"] {
+		t.Fatalf("create project: status %d, owner %q; want alice", w.Code, project.Owner)
+	}
+	expect(send("alice", "POST", "/api/v1/tasks", `{"title": "Milk", "project_id": 1}`), http.StatusCreated, "owner adds a task")
+	expect(send("bob", "POST", "/api/v1/tasks", `{"title": "Eggs", "project_id": 1}`), http.StatusForbidden, "stranger adds a task")
+	expect(send("bob", "PATCH", "/api/v1/tasks/1", `{"status": "completed"}`), http.StatusForbidden, "stranger completes a task")
+	expect(send("bob", "DELETE", "/api/v1/tasks/1", ""), http.StatusForbidden, "stranger deletes a task")
+	expect(send("bob", "POST", "/api/v1/tasks/1/comments", `{"body": "hi"}`), http.StatusForbidden, "stranger comments")
+	expect(send("bob", "PUT", "/api/v1/projects/1", `{"name": "Mine"}`), http.StatusForbidden, "stranger renames the project")
+	expect(send("admin", "PATCH", "/api/v1/tasks/1", `{"priority": "high"}`), http.StatusOK, "admin changes a task")
+
+	// A stranger can't move their own task into the project either
+	expect(send("bob", "POST", "/api/v1/tasks", `{"title": "Bread"}`), http.StatusCreated, "bob adds an unfiled task")
+	expect(send("bob", "PATCH", "/api/v1/tasks/2", `{"project_id": 1}`), http.StatusForbidden, "stranger moves a task in")
+
+	// Sharing by email, matched case-insensitively against smtp.recipients
+	w = send("alice", "POST", "/api/v1/projects/1/collaborators", `{"email": "bob@example.com"}`)
+	expect(w, http.StatusOK, "share with bob")
+	json.NewDecoder(w.Body).Decode(&project)
+	if len(project.Collaborators) != 1 || project.Collaborators[0].User != users["bob"] || project.Collaborators[0].Permission != PermissionEdit {
+		t.Fatalf("collaborators = %+v; want bob as editor", project.Collaborators)
+	}
+	expect(send("bob", "PATCH", "/api/v1/tasks/1", `{"status": "completed"}`), http.StatusOK, "collaborator completes a task")
+	expect(send("bob", "PATCH", "/api/v1/tasks/2", `{"project_id": 1}`), http.StatusOK, "collaborator moves a task in")
+	expect(send("bob", "POST", "/api/v1/projects/1/collaborators", `{"user": "`+users["carol"]+`"}`), http.StatusForbidden, "collaborator shares")
+	expect(send("bob", "POST", "/api/v1/projects/1/invites", `{}`), http.StatusForbidden, "collaborator invites")
+	expect(send("bob", "DELETE", "/api/v1/projects/1", ""), http.StatusForbidden, "collaborator deletes the project")
+
+	expect(send("alice", "POST", "/api/v1/projects/1/collaborators", `{"user": "`+users["carol"]+`", "permission": "view"}`), http.StatusOK, "share with carol")
+	expect(send("carol", "PATCH", "/api/v1/tasks/1", `{"title": "Oat milk"}`), http.StatusForbidden, "viewer changes a task")
+	for _, body := range []string{
+		`{"user": "` + users["carol"] + `", "permission": "admin"}`,
+		`{"user": "carol"}`,
+		`{"user": "` + users["alice"] + `"}`,
+	} {
+		if w := send("alice", "POST", "/api/v1/projects/1/collaborators", body); w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("share %s: status %d; want 422", body, w.Code)
+		}
+	}
+	w = send("alice", "POST", "/api/v1/projects/1/collaborators", `{"email": "erin@example.com"}`)
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), ErrCodeUnknownUser) {
+		t.Errorf("share with an unknown email: status %d: %s", w.Code, w.Body.String())
+	}
+
+	// Invites are mailed and joined with the invitee's own token
+	w = send("alice", "POST", "/api/v1/projects/1/invites", `{"permission": "edit", "email": "dave@example.com"}`)
+	expect(w, http.StatusOK, "invite dave")
+	var invite struct {
+		URL, Token, Emailed string
+	}
+	json.NewDecoder(w.Body).Decode(&invite)
+	if invite.Emailed != "dave@example.com" || len(*sent) != 1 || (*sent)[0].to[0] != "dave@example.com" || !strings.Contains((*sent)[0].msg, invite.URL) {
+		t.Fatalf("invite %+v, emails %+v; want the link mailed to dave", invite, *sent)
+	}
+	expect(send("dave", "PATCH", "/api/v1/tasks/1", `{"title": "Oat milk"}`), http.StatusForbidden, "dave before joining")
+	w = send("dave", "POST", invite.URL, "")
+	expect(w, http.StatusOK, "dave accepts")
+	expect(send("dave", "PATCH", "/api/v1/tasks/1", `{"title": "Oat milk"}`), http.StatusOK, "dave after joining")
+
+	// Accepting a view invite doesn't demote an editor
+	w = send("alice", "POST", "/api/v1/projects/1/invites", `{"permission": "view"}`)
+	json.NewDecoder(w.Body).Decode(&invite)
+	expect(send("bob", "POST", invite.URL, ""), http.StatusOK, "bob accepts a view invite")
+	if got, _ := server.store.GetProject(1); got.permission(users["bob"]) != PermissionEdit {
+		t.Errorf("bob's permission = %q; want edit", got.permission(users["bob"]))
+	}
+	w = send("dave", "POST", "/api/v1/invites/"+invite.Token+"x", "")
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), ErrCodeInviteInvalid) {
+		t.Errorf("tampered invite: status %d: %s", w.Code, w.Body.String())
+	}
+	now := time.Now().Add(inviteLinkTTL + time.Minute)
+	server.now = func() time.Time { return now }
+	w = send("carol", "POST", invite.URL, "")
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), ErrCodeInviteExpired) {
+		t.Errorf("expired invite: status %d: %s", w.Code, w.Body.String())
+	}
+
+	// Collaborators can leave; only the owner removes others
+	expect(send("bob", "DELETE", "/api/v1/projects/1/collaborators/"+users["dave"], ""), http.StatusForbidden, "bob removes dave")
+	expect(send("bob", "DELETE", "/api/v1/projects/1/collaborators/"+users["bob"], ""), http.StatusNoContent, "bob leaves")
+	expect(send("bob", "PATCH", "/api/v1/tasks/1", `{"title": "Milk"}`), http.StatusForbidden, "bob after leaving")
+	expect(send("alice", "DELETE", "/api/v1/projects/1/collaborators/"+users["bob"], ""), http.StatusNotFound, "remove bob again")
+	expect(send("alice", "DELETE", "/api/v1/projects/1/collaborators/"+users["dave"], ""), http.StatusNoContent, "alice removes dave")
+
+	// Projects without an owner stay open and can't be shared
+	if _, err := server.store.AddProject(context.Background(), "Legacy", ""); err != nil {
+		t.Fatal(err)
+	}
+	expect(send("bob", "POST", "/api/v1/tasks", `{"title": "Anything", "project_id": 2}`), http.StatusCreated, "task in an unowned project")
+	w = send("admin", "POST", "/api/v1/projects/2/collaborators", `{"user": "`+users["bob"]+`"}`)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), ErrCodeProjectUnowned) {
+		t.Errorf("share an unowned project: status %d: %s", w.Code, w.Body.String())
+	}
+	expect(send("alice", "POST", "/api/v1/projects/9/invites", `{}`), http.StatusNotFound, "invite to a missing project")
+}
+
+func TestInviteTokens(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	expires := time.Now().Add(time.Hour)
+
+	token := server.signInviteToken(3, PermissionView, expires)
+	if id, permission, err := server.verifyInviteToken(token); err != nil || id != 3 || permission != PermissionView {
+		t.Errorf("verify = %d, %q, %v; want 3, view", id, permission, err)
+	}
+	// A share link's token doesn't pass for an invite
+	if _, _, err := server.verifyInviteToken(server.signShareToken("3", expires)); err != errInviteInvalid {
+		t.Errorf("share token err = %v; want errInviteInvalid", err)
+	}
+	other, cleanupOther := setupTestServer()
+	defer cleanupOther()
+	if _, _, err := other.verifyInviteToken(token); err != errInviteInvalid {
+		t.Errorf("token from another key err = %v; want errInviteInvalid", err)
+	}
+}
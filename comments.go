@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+// maxCommentLength is the longest comment body accepted, in characters
+const maxCommentLength = 10000
+
+// auditComment is the audit kind of task comments
+const auditComment = "comment"
+
+// Errors returned by DeleteComment
+var (
+	ErrCommentNotFound  = errors.New("comment not found")
+	ErrCommentForbidden = errors.New("comment belongs to someone else")
+)
+
+// Comment is a note on a task. Body is Markdown and stored as written;
+// clients render it. IDs are unique across all tasks.
+type Comment struct {
+	ID     int `json:"id"`
+	TaskID int `json:"task_id"`
+	// Author is who posted the comment, named as the audit log's actor
+	Author    string    `json:"author"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CommentBackend is implemented by backends that also persist comments.
+// Like HistoryBackend it is optional; on other backends comments are kept
+// in memory only.
+type CommentBackend interface {
+	// LoadComments returns every stored comment
+	LoadComments() ([]*Comment, error)
+	// SaveComments persists the comments of the tasks in changed.
+	// comments is the complete set after the change; a task missing from
+	// it has no comments left.
+	SaveComments(comments map[int][]*Comment, changed []int) error
+}
+
+// loadComments reads the comments from the backend, if it stores them
+func (ts *TaskStore) loadComments() error {
+	backend, ok := ts.storage.(CommentBackend)
+	if !ok {
+		return nil
+	}
+	comments, err := backend.LoadComments()
+	if err != nil {
+		return fmt.Errorf("load comments: %w", err)
+	}
+	for _, comment := range comments {
+		ts.comments[comment.TaskID] = append(ts.comments[comment.TaskID], comment)
+		if comment.ID >= ts.nextCommentID {
+			ts.nextCommentID = comment.ID + 1
+		}
+	}
+	return nil
+}
+
+// saveComments persists the comments of the given tasks. The caller must
+// hold the write lock.
+func (ts *TaskStore) saveComments(ctx context.Context, changed ...int) error {
+	backend, ok := ts.storage.(CommentBackend)
+	if !ok || len(changed) == 0 {
+		return nil
+	}
+	_, span := startSpan(ctx, "storage.save_comments")
+	defer span.End()
+	err := backend.SaveComments(ts.comments, changed)
+	spanError(span, err)
+	return err
+}
+
+// dropComments removes the comments of the given tasks, or of every task
+// if ids is empty, after a purge or a store replace. As with history, a
+// failed save is logged rather than undoing the change that caused it. The
+// caller must hold the write lock.
+func (ts *TaskStore) dropComments(ctx context.Context, ids ...int) {
+	if len(ids) == 0 {
+		for id := range ts.comments {
+			ids = append(ids, id)
+		}
+	}
+	var dropped []int
+	for _, id := range ids {
+		if _, exists := ts.comments[id]; exists {
+			delete(ts.comments, id)
+			dropped = append(dropped, id)
+		}
+	}
+	if err := ts.saveComments(ctx, dropped...); err != nil {
+		requestLogger(ctx).Error("Failed to save comments", "error", err)
+	}
+}
+
+// Comments returns the comments on a live task, oldest first. The bool
+// reports whether the task exists.
+func (ts *TaskStore) Comments(id int) ([]*Comment, bool) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	if _, exists := ts.tasks[id]; !exists {
+		return nil, false
+	}
+	return append(make([]*Comment, 0, len(ts.comments[id])), ts.comments[id]...), true
+}
+
+// AddComment posts body on a live task as the actor of ctx. Comments don't
+// change the task, so its version stays as it is. Like Update, the bool
+// reports whether the task exists.
+func (ts *TaskStore) AddComment(ctx context.Context, id int, body string) (*Comment, bool, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	if _, exists := ts.tasks[id]; !exists {
+		return nil, false, nil
+	}
+	if err := ts.checkProjectLocked(ctx, ts.tasks[id].ProjectID, PermissionEdit); err != nil {
+		return nil, true, err
+	}
+	if err := ts.reserveIDsLocked(ctx, CommentIDs, 1, &ts.nextCommentID); err != nil {
+		return nil, true, err
+	}
+
+	comment := &Comment{
+		ID:        ts.nextCommentID,
+		TaskID:    id,
+		Author:    auditActor(ctx),
+		Body:      body,
+		CreatedAt: ts.now(),
+	}
+	prev := ts.comments[id]
+	ts.comments[id] = append(append(make([]*Comment, 0, len(prev)+1), prev...), comment)
+	if err := ts.saveComments(ctx, id); err != nil {
+		ts.comments[id] = prev
+		if len(prev) == 0 {
+			delete(ts.comments, id)
+		}
+		return nil, true, fmt.Errorf("save comments: %w", err)
+	}
+	ts.nextCommentID++
+	ts.recordAudit(ctx, AuditCreate, auditComment, comment.ID, nil, comment)
+	return comment, true, nil
+}
+
+// DeleteComment removes a comment from a live task. Unless author is
+// empty, only a comment posted by author may be removed; others give
+// ErrCommentForbidden. It returns ErrCommentNotFound if the task has no
+// such comment.
+func (ts *TaskStore) DeleteComment(ctx context.Context, id, commentID int, author string) (bool, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	if _, exists := ts.tasks[id]; !exists {
+		return false, nil
+	}
+	if err := ts.checkProjectLocked(ctx, ts.tasks[id].ProjectID, PermissionEdit); err != nil {
+		return true, err
+	}
+	prev := ts.comments[id]
+	var comment *Comment
+	kept := make([]*Comment, 0, len(prev))
+	for _, c := range prev {
+		if c.ID == commentID {
+			comment = c
+			continue
+		}
+		kept = append(kept, c)
+	}
+	if comment == nil {
+		return true, ErrCommentNotFound
+	}
+	if author != "" && comment.Author != author {
+		return true, ErrCommentForbidden
+	}
+
+	if len(kept) == 0 {
+		delete(ts.comments, id)
+	} else {
+		ts.comments[id] = kept
+	}
+	if err := ts.saveComments(ctx, id); err != nil {
+		ts.comments[id] = prev
+		return true, fmt.Errorf("save comments: %w", err)
+	}
+	ts.recordAudit(ctx, AuditDelete, auditComment, commentID, comment, nil)
+	return true, nil
+}
+
+// commentRequest is the body accepted when posting a comment
+type commentRequest struct {
+	Body string `json:"body"`
+}
+
+// publicComment is a Comment as the API returns it, with the task ID
+// encoded like the task's own
+type publicComment struct {
+	TaskID interface{} `json:"task_id"`
+	*Comment
+}
+
+// presentComments prepares comments for a response
+func (s *Server) presentComments(comments []*Comment) []publicComment {
+	public := make([]publicComment, len(comments))
+	for i, comment := range comments {
+		public[i] = publicComment{TaskID: s.publicID(comment.TaskID), Comment: comment}
+	}
+	return public
+}
+
+// writeCommentError maps errors from the comment store methods to responses
+func writeCommentError(w http.ResponseWriter, exists bool, err error) {
+	switch {
+	case errors.Is(err, ErrCommentNotFound):
+		writeError(w, http.StatusNotFound, ErrCodeCommentNotFound, "Comment not found")
+	case errors.Is(err, ErrCommentForbidden):
+		writeError(w, http.StatusForbidden, ErrCodeForbidden, "Only the author or an admin can delete a comment")
+	case err != nil:
+		writeStoreError(w, err)
+	case !exists:
+		writeError(w, http.StatusNotFound, ErrCodeTaskNotFound, "Task not found")
+	}
+}
+
+// handleGetComments lists a task's comments, oldest first
+func (s *Server) handleGetComments(w http.ResponseWriter, r *http.Request) {
+	id, err := s.parseTaskID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidTaskID, "Invalid task ID")
+		return
+	}
+
+	comments, exists := s.store.Comments(id)
+	if !exists {
+		writeError(w, http.StatusNotFound, ErrCodeTaskNotFound, "Task not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.presentComments(comments))
+}
+
+// handleCreateComment posts a comment on a task
+func (s *Server) handleCreateComment(w http.ResponseWriter, r *http.Request) {
+	id, err := s.parseTaskID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidTaskID, "Invalid task ID")
+		return
+	}
+	var req commentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	if strings.TrimSpace(req.Body) == "" {
+		writeError(w, http.StatusUnprocessableEntity, ErrCodeCommentRequired, "Comment body is required")
+		return
+	}
+	if utf8.RuneCountInString(req.Body) > maxCommentLength {
+		writeError(w, http.StatusUnprocessableEntity, ErrCodeValidation, fmt.Sprintf("Comment body must be at most %d characters", maxCommentLength))
+		return
+	}
+
+	comment, exists, err := s.store.AddComment(r.Context(), id, req.Body)
+	if err != nil || !exists {
+		writeCommentError(w, exists, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, s.presentComments([]*Comment{comment})[0])
+}
+
+// handleDeleteComment removes a comment. Tokens with the admin scope may
+// remove anyone's; others only their own.
+func (s *Server) handleDeleteComment(w http.ResponseWriter, r *http.Request) {
+	id, err := s.parseTaskID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidTaskID, "Invalid task ID")
+		return
+	}
+	commentID, err := strconv.Atoi(mux.Vars(r)["cid"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidCommentID, "Invalid comment ID")
+		return
+	}
+
+	author := auditActor(r.Context())
+	if requestToken(r).hasScope(ScopeAdmin) {
+		author = ""
+	}
+	exists, err := s.store.DeleteComment(r.Context(), id, commentID, author)
+	if err != nil || !exists {
+		writeCommentError(w, exists, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTaskComments(t *testing.T) {
+	server, cleanup := setupAuditServer(t)
+	defer cleanup()
+	server.config.TokenHashes = []string{hashString("alice-token"), hashString("bob-token"), hashString("admin-token")}
+	server.config.TokenRoles = map[string]string{
+		hashString("alice-token"): RoleEditor,
+		hashString("bob-token"):   RoleEditor,
+		hashString("admin-token"): RoleAdmin,
+	}
+	r, err := server.Router()
+	if err != nil {
+		t.Fatalf("Router() error = %v", err)
+	}
+	send := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-API-Token", token)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	server.store.Add(context.Background(), "Discuss me", "", DueTime{}, "medium")
+
+	w := send("POST", "/api/v1/tasks/1/comments", "alice-token", `{"body": "Needs **review**"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create status = %d; want %d: %s", w.Code, http.StatusCreated, w.Body.String())
+	}
+	var created Comment
+	json.NewDecoder(w.Body).Decode(&created)
+	if created.ID != 1 || created.TaskID != 1 || created.Body != "Needs **review**" || created.Author != "token:"+tokenID(hashString("alice-token")) || created.CreatedAt.IsZero() {
+		t.Errorf("comment = %+v; want Alice's comment on task 1", created)
+	}
+	send("POST", "/api/v1/tasks/1/comments", "bob-token", `{"body": "Agreed"}`)
+
+	w = send("GET", "/api/v1/tasks/1/comments", "", "")
+	var comments []Comment
+	json.NewDecoder(w.Body).Decode(&comments)
+	if w.Code != http.StatusOK || len(comments) != 2 || comments[0].Body != "Needs **review**" || comments[1].Body != "Agreed" {
+		t.Fatalf("GET comments = %d %+v; want both, oldest first", w.Code, comments)
+	}
+	if task, _ := server.store.Get(1); task.Version != 1 {
+		t.Errorf("task version = %d; want 1, as comments don't change the task", task.Version)
+	}
+
+	if w := send("DELETE", "/api/v1/tasks/1/comments/1", "bob-token", ""); w.Code != http.StatusForbidden {
+		t.Errorf("deleting someone else's comment status = %d; want %d", w.Code, http.StatusForbidden)
+	}
+	if w := send("DELETE", "/api/v1/tasks/1/comments/1", "alice-token", ""); w.Code != http.StatusNoContent {
+		t.Errorf("deleting own comment status = %d; want %d", w.Code, http.StatusNoContent)
+	}
+	if w := send("DELETE", "/api/v1/tasks/1/comments/2", "admin-token", ""); w.Code != http.StatusNoContent {
+		t.Errorf("admin deleting a comment status = %d; want %d", w.Code, http.StatusNoContent)
+	}
+	if w := send("DELETE", "/api/v1/tasks/1/comments/2", "admin-token", ""); w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), ErrCodeCommentNotFound) {
+		t.Errorf("deleting a missing comment = %d %s; want %d %s", w.Code, w.Body.String(), http.StatusNotFound, ErrCodeCommentNotFound)
+	}
+	if comments, _ := server.store.Comments(1); len(comments) != 0 {
+		t.Errorf("comments = %+v; want none", comments)
+	}
+
+	entries := queryAudit(t, server, "type=comment")
+	if len(entries) != 4 || entries[0].Action != AuditDelete || entries[3].Action != AuditCreate || entries[3].ID != 1 {
+		t.Errorf("audit entries = %+v; want two creates and two deletes", entries)
+	}
+}
+
+func TestCommentValidation(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.TokenHashes = []string{hashString("secret-token")}
+	r, err := server.Router()
+	if err != nil {
+		t.Fatalf("Router() error = %v", err)
+	}
+	server.store.Add(context.Background(), "Commented", "", DueTime{}, "medium")
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		code   string
+	}{
+		{"blank body", "POST", "/api/v1/tasks/1/comments", `{"body": "  "}`, http.StatusUnprocessableEntity, ErrCodeCommentRequired},
+		{"too long", "POST", "/api/v1/tasks/1/comments", `{"body": "` + strings.Repeat("x", maxCommentLength+1) + `"}`, http.StatusUnprocessableEntity, ErrCodeValidation},
+		{"bad JSON", "POST", "/api/v1/tasks/1/comments", `{"body": `, http.StatusBadRequest, ErrCodeInvalidJSON},
+		{"missing task", "POST", "/api/v1/tasks/9/comments", `{"body": "Hi"}`, http.StatusNotFound, ErrCodeTaskNotFound},
+		{"list missing task", "GET", "/api/v1/tasks/9/comments", "", http.StatusNotFound, ErrCodeTaskNotFound},
+		{"bad comment ID", "DELETE", "/api/v1/tasks/1/comments/x", "", http.StatusBadRequest, ErrCodeInvalidCommentID},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		req.Header.Set("X-API-Token", "secret-token")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.status || !strings.Contains(w.Body.String(), tt.code) {
+			t.Errorf("%s: %d %s; want %d %s", tt.name, w.Code, w.Body.String(), tt.status, tt.code)
+		}
+	}
+}
+
+func TestCommentsSurviveReloadAndGoWithPurge(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	ctx := context.Background()
+	server.store.Add(ctx, "Kept", "", DueTime{}, "medium")
+	server.store.Add(ctx, "Purged", "", DueTime{}, "medium")
+	server.store.AddComment(ctx, 1, "First")
+	server.store.AddComment(ctx, 2, "Second")
+
+	reloaded := NewTaskStore("test_tasks.json")
+	if comments, _ := reloaded.Comments(1); len(comments) != 1 || comments[0].Body != "First" || comments[0].Author != "system" {
+		t.Errorf("comments after reload = %+v; want the first comment", comments)
+	}
+	if comment, _, _ := reloaded.AddComment(ctx, 1, "Third"); comment.ID != 3 {
+		t.Errorf("next comment ID after reload = %d; want 3", comment.ID)
+	}
+
+	reloaded.Delete(ctx, 2)
+	if _, exists, _ := reloaded.AddComment(ctx, 2, "On a trashed task"); exists {
+		t.Error("AddComment() accepted a trashed task")
+	}
+	reloaded.PurgeTrashBefore(ctx, time.Now().Add(time.Hour))
+	if _, exists := reloaded.comments[2]; exists {
+		t.Error("comments kept after the task was purged")
+	}
+}
+
+func TestCommentsInSQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.db")
+	ctx := context.Background()
+	store, backend := openTestSQLiteStore(t, path)
+	store.Add(ctx, "Commented", "", DueTime{}, "medium")
+	store.AddComment(ctx, 1, "One")
+	store.AddComment(ctx, 1, "Two")
+	store.DeleteComment(ctx, 1, 1, "")
+	backend.Close()
+
+	reopened, _ := openTestSQLiteStore(t, path)
+	if comments, _ := reopened.Comments(1); len(comments) != 1 || comments[0].ID != 2 || comments[0].Body != "Two" {
+		t.Errorf("comments after reopen = %+v; want only comment 2", comments)
+	}
+}
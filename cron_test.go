@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	// A Monday
+	base := time.Date(2024, 3, 11, 8, 30, 0, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", base.Add(time.Minute)},
+		{"0 9 * * *", time.Date(2024, 3, 11, 9, 0, 0, 0, time.UTC)},
+		{"30 8 * * *", time.Date(2024, 3, 12, 8, 30, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 3, 11, 8, 45, 0, 0, time.UTC)},
+		{"5/20 8 * * *", time.Date(2024, 3, 11, 8, 45, 0, 0, time.UTC)},
+		{"0 7 * * 1-5", time.Date(2024, 3, 12, 7, 0, 0, 0, time.UTC)},
+		{"0 7 * * sat,sun", time.Date(2024, 3, 16, 7, 0, 0, 0, time.UTC)},
+		{"0 7 * * 7", time.Date(2024, 3, 17, 7, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Either day field matches when both are restricted
+		{"0 12 15 * fri", time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)},
+		{"0 12 13 * sun", time.Date(2024, 3, 13, 12, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 3, 12, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2024, 3, 17, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		schedule, err := parseCron(tt.expr)
+		if err != nil {
+			t.Errorf("%q: %v", tt.expr, err)
+			continue
+		}
+		if got := schedule.next(base, time.UTC); !got.Equal(tt.want) {
+			t.Errorf("%q: next = %v; want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestCronNextTimeZone(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	schedule, _ := parseCron("30 2 * * *")
+	// 02:30 doesn't exist on March 31st 2024, so the next run is a day later
+	got := schedule.next(time.Date(2024, 3, 30, 3, 0, 0, 0, berlin), berlin)
+	if want := time.Date(2024, 4, 1, 2, 30, 0, 0, berlin); !got.Equal(want) {
+		t.Errorf("across the spring change: next = %v; want %v", got, want)
+	}
+	// 02:30 happens twice on October 27th 2024 and runs only the first time
+	first := schedule.next(time.Date(2024, 10, 27, 0, 0, 0, 0, berlin), berlin)
+	if want := time.Date(2024, 10, 27, 0, 30, 0, 0, time.UTC); !first.Equal(want) {
+		t.Errorf("fall change: next = %v; want %v", first, want)
+	}
+	if got := schedule.next(first, berlin); !got.Equal(time.Date(2024, 10, 28, 2, 30, 0, 0, berlin)) {
+		t.Errorf("after the first 02:30: next = %v; want the next day", got)
+	}
+	// Fields are read in loc
+	daily, _ := parseCron("0 9 * * *")
+	if got := daily.next(time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC), berlin); !got.Equal(time.Date(2024, 3, 11, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("09:00 in Berlin: next = %v", got)
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "* * * * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "* * * foo *", "@sometimes"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("%q: no error", expr)
+		}
+	}
+}
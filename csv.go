@@ -0,0 +1,446 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxCSVImportSize caps the size of an uploaded CSV file
+const maxCSVImportSize = 10 << 20
+
+// maxCSVImportRows caps the tasks one import may create
+const maxCSVImportRows = 10000
+
+// csvExportColumns are the columns of an export, in order. An export can
+// be imported again as it is.
+var csvExportColumns = []string{
+	"id", "title", "description", "due_date", "priority", "status",
+	"tags", "project_id", "recurrence", "created_at", "updated_at", "completed_at",
+}
+
+// csvImportFields are the task fields an imported column can fill
+var csvImportFields = map[string]bool{
+	"title": true, "description": true, "due_date": true, "priority": true,
+	"status": true, "tags": true, "project_id": true, "recurrence": true,
+}
+
+// csvFormulaPrefixes start cells that spreadsheets run as formulas
+const csvFormulaPrefixes = "=+-@"
+
+// csvCell protects a value from being run as a formula when the export is
+// opened in a spreadsheet, by prefixing a quote; import removes it again
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune(csvFormulaPrefixes, rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// csvValue undoes csvCell
+func csvValue(cell string) string {
+	if len(cell) > 1 && cell[0] == '\'' && strings.ContainsRune(csvFormulaPrefixes, rune(cell[1])) {
+		return cell[1:]
+	}
+	return cell
+}
+
+// handleExportCSV writes the tasks matching the GET /tasks filters as CSV
+func (s *Server) handleExportCSV(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseTaskFilter(r.URL.Query(), s.requestLocation(r))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidQuery, err.Error())
+		return
+	}
+	tasks := s.store.List(filter)
+	sortTasks(tasks, s.config.DefaultSort, s.config.DefaultOrder, s.store.priorities)
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="tasks.csv"`)
+	cw := csv.NewWriter(w)
+	cw.Write(csvExportColumns)
+	for _, task := range tasks {
+		projectID, completedAt := "", ""
+		if task.ProjectID != 0 {
+			projectID = strconv.Itoa(task.ProjectID)
+		}
+		if task.CompletedAt != nil {
+			completedAt = task.CompletedAt.UTC().Format(time.RFC3339)
+		}
+		cw.Write([]string{
+			s.formatID(task.ID),
+			csvCell(task.Title),
+			csvCell(task.Description),
+			task.DueDate.String(),
+			task.Priority,
+			task.Status,
+			csvCell(strings.Join(task.Tags, ",")),
+			projectID,
+			task.Recurrence,
+			task.CreatedAt.UTC().Format(time.RFC3339),
+			task.UpdatedAt.UTC().Format(time.RFC3339),
+			completedAt,
+		})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		requestLogger(r.Context()).Error("Failed to write CSV export", "error", err)
+	}
+}
+
+// csvRowErrors are the problems found in one CSV row; Row is the line
+// the row starts on, counting the header as line 1
+type csvRowErrors struct {
+	Row    int      `json:"row"`
+	Errors []string `json:"errors"`
+}
+
+// csvImportResponse is the body of an import or dry run response
+type csvImportResponse struct {
+	DryRun bool `json:"dry_run"`
+	// Imported is the number of tasks created, or that would be in a dry
+	// run
+	Imported int `json:"imported"`
+	// IgnoredColumns are the CSV columns that don't map to a task field
+	IgnoredColumns []string       `json:"ignored_columns"`
+	Errors         []csvRowErrors `json:"errors,omitempty"`
+}
+
+// handleImportCSV creates tasks from the CSV file in the "file" field of
+// a multipart form. Columns are matched to task fields by header, ignoring
+// case and treating spaces as underscores, or by the "mapping" field: a
+// JSON object from header to field. If any row is invalid nothing is
+// imported and every row's errors are returned. With dry_run=true
+// (query or form field) rows are only checked.
+func (s *Server) handleImportCSV(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxCSVImportSize)
+	if err := r.ParseMultipartForm(maxCSVImportSize); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidCSV, "Expected a multipart form with the CSV in a \"file\" field")
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidCSV, "Expected a multipart form with the CSV in a \"file\" field")
+		return
+	}
+	defer file.Close()
+
+	var mapping map[string]string
+	if raw := r.FormValue("mapping"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidCSV, "mapping must be a JSON object from column to field")
+			return
+		}
+		for column, field := range mapping {
+			if !csvImportFields[field] {
+				writeError(w, http.StatusBadRequest, ErrCodeInvalidCSV, fmt.Sprintf("Column %q maps to unknown field %q", column, field))
+				return
+			}
+		}
+	}
+	dryRun := r.FormValue("dry_run") == "true"
+
+	rows, resp, err := parseCSVImport(file, mapping, s.requestLocation(r), s.store.workflow, s.store.priorities)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidCSV, err.Error())
+		return
+	}
+	resp.DryRun = dryRun
+
+	var fields []Task
+	for _, row := range rows {
+		fields = append(fields, row.task)
+	}
+	tasks, rowErrs, err := s.store.ImportTasks(r.Context(), fields, dryRun || len(resp.Errors) > 0)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	resp.Errors = mergeRowErrors(rows, resp.Errors, rowErrs)
+	if len(resp.Errors) > 0 {
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"error":           "Some rows are invalid; nothing was imported",
+			"code":            ErrCodeValidation,
+			"status":          http.StatusUnprocessableEntity,
+			"dry_run":         dryRun,
+			"ignored_columns": resp.IgnoredColumns,
+			"errors":          resp.Errors,
+		})
+		return
+	}
+
+	if dryRun {
+		resp.Imported = len(rows)
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+	resp.Imported = len(tasks)
+	taskOps.Add("create", int64(len(tasks)))
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+// csvImportRow is a parsed CSV row and the line it starts on
+type csvImportRow struct {
+	line int
+	task Task
+}
+
+// parseCSVImport reads the CSV into tasks, with due days in loc, statuses
+// from wf and priorities from priorities. Rows with problems are reported in the response's
+// Errors; an error is returned only if the file can't be read as CSV at
+// all.
+func parseCSVImport(r io.Reader, mapping map[string]string, loc *time.Location, wf workflow, priorities priorityRanking) ([]csvImportRow, csvImportResponse, error) {
+	resp := csvImportResponse{IgnoredColumns: []string{}}
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, resp, errors.New("CSV file is empty")
+	}
+	if err != nil {
+		return nil, resp, fmt.Errorf("invalid CSV: %v", err)
+	}
+	// Spreadsheet programs often start the file with a byte order mark
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+
+	columns := make([]string, len(header))
+	for i, name := range header {
+		field, ok := mapping[name]
+		if !ok {
+			field = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), " ", "_")
+		}
+		if csvImportFields[field] {
+			columns[i] = field
+		} else {
+			resp.IgnoredColumns = append(resp.IgnoredColumns, name)
+		}
+	}
+	if !containsString(columns, "title") {
+		return nil, resp, errors.New("no column maps to title")
+	}
+
+	var rows []csvImportRow
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, resp, fmt.Errorf("invalid CSV: %v", err)
+		}
+		if len(rows) == maxCSVImportRows {
+			return nil, resp, fmt.Errorf("CSV has more than %d rows", maxCSVImportRows)
+		}
+		line, _ := cr.FieldPos(0)
+		task, problems := parseCSVRecord(columns, record, loc, wf, priorities)
+		rows = append(rows, csvImportRow{line: line, task: task})
+		if len(problems) > 0 {
+			resp.Errors = append(resp.Errors, csvRowErrors{Row: line, Errors: problems})
+		}
+	}
+	return rows, resp, nil
+}
+
+// parseCSVRecord fills a task from a CSV record, reading a due day in loc
+// and checking the status against wf and the priority against priorities,
+// and returns the problems with it.
+// The store checks titles, tags, projects and the quota on import.
+func parseCSVRecord(columns, record []string, loc *time.Location, wf workflow, priorities priorityRanking) (Task, []string) {
+	task := Task{Priority: "medium", Status: "pending"}
+	var problems []string
+	for i, value := range record {
+		if i >= len(columns) || columns[i] == "" {
+			continue
+		}
+		value = csvValue(strings.TrimSpace(value))
+		switch columns[i] {
+		case "title":
+			task.Title = value
+		case "description":
+			task.Description = value
+		case "due_date":
+			dueDate, err := parseDueDate(value, loc)
+			if err != nil {
+				problems = append(problems, err.Error())
+			}
+			task.DueDate = dueDate
+		case "priority":
+			if value != "" {
+				task.Priority = strings.ToLower(value)
+			}
+			if err := priorities.check(task.Priority); err != nil {
+				problems = append(problems, err.Error())
+			}
+		case "status":
+			if value != "" {
+				task.Status = strings.ReplaceAll(strings.ToLower(value), " ", "_")
+			}
+			if err := wf.checkStatus(task.Status); err != nil {
+				problems = append(problems, err.Error())
+			}
+		case "tags":
+			task.Tags = splitList(value)
+		case "project_id":
+			if value != "" {
+				id, err := strconv.Atoi(value)
+				if err != nil || id <= 0 {
+					problems = append(problems, "project_id must be a positive integer")
+				}
+				task.ProjectID = id
+			}
+		case "recurrence":
+			if err := validateRecurrence(value); err != nil {
+				problems = append(problems, err.Error())
+			}
+			task.Recurrence = value
+		}
+	}
+	return task, problems
+}
+
+// mergeRowErrors adds the store's errors, by row index, to the parsing
+// errors, keeping rows in file order
+func mergeRowErrors(rows []csvImportRow, parsed []csvRowErrors, stored map[int]error) []csvRowErrors {
+	if len(stored) == 0 {
+		return parsed
+	}
+	byLine := make(map[int][]string)
+	for _, e := range parsed {
+		byLine[e.Row] = e.Errors
+	}
+	for i, err := range stored {
+		byLine[rows[i].line] = append(byLine[rows[i].line], importErrorMessage(err))
+	}
+	var merged []csvRowErrors
+	for _, row := range rows {
+		if problems, ok := byLine[row.line]; ok {
+			merged = append(merged, csvRowErrors{Row: row.line, Errors: problems})
+			delete(byLine, row.line)
+		}
+	}
+	return merged
+}
+
+// importErrorMessage describes an ImportTasks row error for a client
+func importErrorMessage(err error) string {
+	var verr *validationError
+	switch {
+	case errors.As(err, &verr):
+		return verr.message
+	case errors.Is(err, ErrProjectNotFound):
+		return "project_id names a project that doesn't exist"
+	case errors.Is(err, ErrProjectForbidden):
+		return "not permitted in the project project_id names"
+	case errors.Is(err, ErrQuotaExceeded):
+		return "task quota exceeded"
+	}
+	return err.Error()
+}
+
+// ImportTasks adds tasks, checking each as AddTask does, and saves them
+// all at once. Unlike AddTask it keeps each task's status and subtasks.
+// If any task fails a check nothing is added and the errors are returned
+// by index; with dryRun the checks run but nothing is added either way.
+func (ts *TaskStore) ImportTasks(ctx context.Context, fields []Task, dryRun bool) ([]*Task, map[int]error, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	return ts.importTasksLocked(ctx, fields, dryRun)
+}
+
+// importTasksLocked does the work of ImportTasks. The caller must hold the
+// write lock.
+func (ts *TaskStore) importTasksLocked(ctx context.Context, fields []Task, dryRun bool) ([]*Task, map[int]error, error) {
+	rowErrs := make(map[int]error)
+	used := ts.quotaUsedLocked()
+	now := ts.now()
+	tasks := make([]*Task, 0, len(fields))
+	for i, f := range fields {
+		if strings.TrimSpace(f.Title) == "" {
+			rowErrs[i] = &validationError{code: ErrCodeTitleRequired, message: "Title is required"}
+			continue
+		}
+		tags, err := ts.tags.normalize(f.Tags)
+		if err != nil {
+			rowErrs[i] = err
+			continue
+		}
+		if _, exists := ts.projects[f.ProjectID]; f.ProjectID != 0 && !exists {
+			rowErrs[i] = ErrProjectNotFound
+			continue
+		}
+		if err := ts.checkProjectLocked(ctx, f.ProjectID, PermissionEdit); err != nil {
+			rowErrs[i] = err
+			continue
+		}
+		if f.Status != "completed" {
+			used += ts.quota.weight(f.Priority)
+			if ts.quota.limit > 0 && used > ts.quota.limit {
+				rowErrs[i] = ErrQuotaExceeded
+				continue
+			}
+		}
+		task := &Task{
+			ID:          ts.nextID + len(tasks),
+			Title:       f.Title,
+			Description: f.Description,
+			DueDate:     f.DueDate,
+			Priority:    f.Priority,
+			Status:      f.Status,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+			Tags:        tags,
+			ProjectID:   f.ProjectID,
+			Recurrence:  f.Recurrence,
+		}
+		if task.Status == "completed" {
+			task.CompletedAt = &now
+		}
+		for j, sub := range f.Subtasks {
+			task.Subtasks = append(task.Subtasks, Subtask{ID: j + 1, Title: sub.Title, Done: sub.Done})
+		}
+		tasks = append(tasks, task)
+	}
+	if len(rowErrs) > 0 {
+		return nil, rowErrs, nil
+	}
+	if dryRun || len(tasks) == 0 {
+		return nil, nil, nil
+	}
+
+	prevNextID := ts.nextID
+	if err := ts.reserveIDsLocked(ctx, TaskIDs, len(tasks), &ts.nextID); err != nil {
+		return nil, nil, err
+	}
+	ids := make([]int, len(tasks))
+	for i, task := range tasks {
+		task.ID = ts.nextID + i
+		ts.tasks[task.ID] = task
+		ids[i] = task.ID
+	}
+	ts.nextID += len(tasks)
+	if err := ts.save(ctx, ids...); err != nil {
+		for _, id := range ids {
+			delete(ts.tasks, id)
+		}
+		ts.nextID = prevNextID
+		return nil, nil, fmt.Errorf("save tasks: %w", err)
+	}
+	for _, task := range tasks {
+		ts.recordChange(ctx, ChangeCreated, task)
+		ts.recordMutation(ctx, AuditCreate, auditTask, task.ID, nil, task)
+	}
+	return tasks, nil, nil
+}
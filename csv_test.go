@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// csvUpload builds a multipart import request for the CSV with the
+// given extra form fields
+func csvUpload(t *testing.T, query, data string, fields map[string]string) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("file", "tasks.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte(data))
+	for name, value := range fields {
+		mw.WriteField(name, value)
+	}
+	mw.Close()
+	req := httptest.NewRequest("POST", "/api/v1/tasks/import"+query, &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("X-API-Token", "secret-token")
+	return req
+}
+
+func TestImportCSV(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.TokenHashes = []string{hashString("secret-token")}
+	r, _ := server.Router()
+
+	data := "\ufeffName,Due Date,Priority,Status,Tags,Notes\n" +
+		"Buy milk,2030-01-02,High,pending,\"home,errand\",skip me\n" +
+		"Old report,,low,Completed,,\n"
+	mapping := map[string]string{"mapping": `{"Name": "title"}`}
+
+	// A dry run checks the rows without importing them
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, csvUpload(t, "?dry_run=true", data, mapping))
+	var resp csvImportResponse
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusOK || !resp.DryRun || resp.Imported != 2 || len(server.store.GetAll()) != 0 {
+		t.Fatalf("dry run: status %d, body %s, %d tasks stored", w.Code, w.Body.String(), len(server.store.GetAll()))
+	}
+	if len(resp.IgnoredColumns) != 1 || resp.IgnoredColumns[0] != "Notes" {
+		t.Errorf("ignored columns %v; want [Notes]", resp.IgnoredColumns)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, csvUpload(t, "", data, mapping))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("import: status %d, body %s", w.Code, w.Body.String())
+	}
+	task, _ := server.store.Get(1)
+	if task.Title != "Buy milk" || task.DueDate.Day(time.Local) != "2030-01-02" || task.Priority != "high" || len(task.Tags) != 2 {
+		t.Errorf("first task = %+v", task)
+	}
+	if task, _ := server.store.Get(2); task.Status != "completed" || task.CompletedAt == nil || task.Priority != "low" {
+		t.Errorf("second task = %+v; want completed", task)
+	}
+}
+
+func TestImportCSVReportsEveryBadRow(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.TokenHashes = []string{hashString("secret-token")}
+	r, _ := server.Router()
+
+	data := "title,due_date,priority,project_id\n" +
+		"Fine,2030-01-02,low,\n" +
+		",tomorrow,someday,\n" +
+		"\"Multi\nline\",,,42\n"
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, csvUpload(t, "", data, nil))
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("import: status %d, body %s; want 422", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Code   string
+		Errors []csvRowErrors
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Code != ErrCodeValidation || len(resp.Errors) != 2 {
+		t.Fatalf("errors = %+v; want two bad rows", resp)
+	}
+	if resp.Errors[0].Row != 3 || len(resp.Errors[0].Errors) != 3 {
+		t.Errorf("first bad row = %+v; want line 3 with title, due date and priority errors", resp.Errors[0])
+	}
+	if resp.Errors[1].Row != 4 || !strings.Contains(resp.Errors[1].Errors[0], "project") {
+		t.Errorf("second bad row = %+v; want line 4 with an unknown project", resp.Errors[1])
+	}
+	if len(server.store.GetAll()) != 0 {
+		t.Error("import with bad rows stored tasks")
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, csvUpload(t, "", "description\nno title column\n", nil))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), ErrCodeInvalidCSV) {
+		t.Errorf("CSV without a title column: status %d; want 400 %s", w.Code, ErrCodeInvalidCSV)
+	}
+}
+
+func TestExportCSVRoundTrip(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.TokenHashes = []string{hashString("secret-token")}
+	server.store.Add(context.Background(), "=HYPERLINK(\"http://evil\")", "Line one\nLine two", dueOn("2030-01-02"), "high", "work", "urgent")
+	r, _ := server.Router()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/tasks/export.csv", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/csv; charset=utf-8" {
+		t.Fatalf("export: status %d, Content-Type %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	records, err := csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+	if err != nil || len(records) != 2 {
+		t.Fatalf("export is not a CSV with one task: %v\n%s", err, w.Body.String())
+	}
+	if records[1][1] != `'=HYPERLINK("http://evil")` {
+		t.Errorf("title cell %q; want the formula defused", records[1][1])
+	}
+
+	export := w.Body.String()
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, csvUpload(t, "", export, nil))
+	imported, ok := server.store.Get(2)
+	if !ok {
+		t.Fatalf("re-import: status %d, body %s", w.Code, w.Body.String())
+	}
+	original, _ := server.store.Get(1)
+	if imported.Title != original.Title || imported.Description != original.Description || strings.Join(imported.Tags, ",") != strings.Join(original.Tags, ",") {
+		t.Errorf("re-imported task = %+v; want a copy of %+v", imported, original)
+	}
+}
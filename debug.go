@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// taskOps counts successful task mutations by operation, published at
+// /debug/vars when debug endpoints are enabled
+var taskOps = expvar.NewMap("task_operations")
+
+// defaultDebugAllowedCIDRs are the networks the debug endpoints answer
+// when Config.DebugAllowedCIDRs is empty: loopback and private addresses
+var defaultDebugAllowedCIDRs = []string{
+	"127.0.0.0/8", "::1/128",
+	"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7",
+}
+
+// debugWriteSlack is how long a profile or trace has to be written once
+// it has been collected
+const debugWriteSlack = 10 * time.Second
+
+// validateDebugCIDRs rejects debug_allowed_cidrs entries that aren't CIDR
+// networks
+func validateDebugCIDRs(cidrs []string) error {
+	_, err := parseCIDRs(cidrs)
+	return err
+}
+
+// parseCIDRs parses networks such as "10.0.0.0/8"
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid debug_allowed_cidrs: %w", err)
+		}
+		nets = append(nets, network)
+	}
+	return nets, nil
+}
+
+// registerDebugRoutes mounts pprof and expvar handlers, answering only
+// clients in Config.DebugAllowedCIDRs. It must only be called when
+// Config.EnablePprof is set.
+func (s *Server) registerDebugRoutes(r *mux.Router) error {
+	cidrs := s.config.DebugAllowedCIDRs
+	if len(cidrs) == 0 {
+		cidrs = defaultDebugAllowedCIDRs
+	}
+	allowed, err := parseCIDRs(cidrs)
+	if err != nil {
+		return err
+	}
+
+	debug := r.PathPrefix("/debug").Subrouter()
+	debug.Use(func(next http.Handler) http.Handler {
+		return s.debugAccessMiddleware(allowed, next)
+	})
+	debug.Handle("/vars", expvar.Handler()).Methods("GET")
+	debug.HandleFunc("/pprof/cmdline", pprof.Cmdline)
+	debug.HandleFunc("/pprof/profile", withoutWriteTimeout(30, pprof.Profile))
+	debug.HandleFunc("/pprof/symbol", pprof.Symbol)
+	debug.HandleFunc("/pprof/trace", withoutWriteTimeout(1, pprof.Trace))
+	// pprof.Index also serves the named profiles (heap, goroutine, ...),
+	// which take ?seconds= for a delta profile
+	debug.PathPrefix("/pprof/").HandlerFunc(withoutWriteTimeout(0, pprof.Index))
+	return nil
+}
+
+// debugAccessMiddleware answers 403 to clients outside allowed. The client
+// is identified as for rate limiting, so behind a trusted proxy it is the
+// address the proxy saw rather than the proxy's own.
+func (s *Server) debugAccessMiddleware(allowed []*net.IPNet, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := net.ParseIP(s.clientIP(r))
+		for _, network := range allowed {
+			if ip != nil && network.Contains(ip) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		writeError(w, http.StatusForbidden, ErrCodeForbidden, "Debug endpoints are only served to internal networks")
+	})
+}
+
+// withoutWriteTimeout lets a profile or trace run for its ?seconds=
+// (defaultSeconds when absent) despite the server's WriteTimeout. It
+// extends this response's write deadline, and hides the WriteTimeout from
+// pprof, which before Go 1.23 refuses with a 400 any duration longer than
+// it.
+func withoutWriteTimeout(defaultSeconds float64, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		seconds, err := strconv.ParseFloat(r.FormValue("seconds"), 64)
+		if err != nil || seconds <= 0 {
+			seconds = defaultSeconds
+		}
+		// Recorders in tests don't support it
+		_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(time.Duration(seconds*float64(time.Second)) + debugWriteSlack))
+		if srv, ok := r.Context().Value(http.ServerContextKey).(*http.Server); ok && srv.WriteTimeout > 0 {
+			r = r.WithContext(context.WithValue(r.Context(), http.ServerContextKey, &http.Server{Addr: srv.Addr}))
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// debugRequest is a request for path from remoteAddr
+func debugRequest(path, remoteAddr string) *http.Request {
+	req := httptest.NewRequest("GET", path, nil)
+	req.RemoteAddr = remoteAddr
+	return req
+}
+
+func TestDebugRoutesDisabledByDefault(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	r, err := server.Router()
+	if err != nil {
+		t.Fatalf("Router() error = %v", err)
+	}
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/heap", "/debug/vars"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("GET %s status = %d; want %d", path, w.Code, http.StatusNotFound)
+		}
+	}
+}
+
+func TestDebugRoutesEnabled(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.EnablePprof = true
+
+	r, err := server.Router()
+	if err != nil {
+		t.Fatalf("Router() error = %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, debugRequest("/debug/pprof/", "127.0.0.1:1234"))
+	if w.Code != http.StatusOK {
+		t.Errorf("GET /debug/pprof/ status = %d; want %d", w.Code, http.StatusOK)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, debugRequest("/debug/vars", "10.1.2.3:1234"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /debug/vars status = %d; want %d", w.Code, http.StatusOK)
+	}
+	var vars map[string]json.RawMessage
+	if err := json.NewDecoder(w.Body).Decode(&vars); err != nil {
+		t.Fatalf("Failed to decode /debug/vars: %v", err)
+	}
+	if _, ok := vars["task_operations"]; !ok {
+		t.Error("/debug/vars is missing task_operations")
+	}
+}
+
+func TestDebugRoutesRestrictedToInternalNetworks(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.EnablePprof = true
+
+	r, err := server.Router()
+	if err != nil {
+		t.Fatalf("Router() error = %v", err)
+	}
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/heap", "/debug/vars"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, debugRequest(path, "203.0.113.7:1234"))
+		if w.Code != http.StatusForbidden {
+			t.Errorf("GET %s from a public address status = %d; want %d", path, w.Code, http.StatusForbidden)
+		}
+	}
+
+	server.config.DebugAllowedCIDRs = []string{"203.0.113.0/24"}
+	r, err = server.Router()
+	if err != nil {
+		t.Fatalf("Router() error = %v", err)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, debugRequest("/debug/vars", "203.0.113.7:1234"))
+	if w.Code != http.StatusOK {
+		t.Errorf("GET /debug/vars from debug_allowed_cidrs status = %d; want %d", w.Code, http.StatusOK)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, debugRequest("/debug/vars", "127.0.0.1:1234"))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("GET /debug/vars from outside debug_allowed_cidrs status = %d; want %d", w.Code, http.StatusForbidden)
+	}
+
+	server.config.DebugAllowedCIDRs = []string{"10.0.0.0"}
+	if _, err := server.Router(); err == nil {
+		t.Error("Router() with an invalid debug_allowed_cidrs entry succeeded; want error")
+	}
+}
+
+func TestDebugProfileOutlastsWriteTimeout(t *testing.T) {
+	if testing.Short() {
+		t.Skip("collects a two-second CPU profile")
+	}
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.EnablePprof = true
+
+	r, err := server.Router()
+	if err != nil {
+		t.Fatalf("Router() error = %v", err)
+	}
+	ts := httptest.NewUnstartedServer(r)
+	ts.Config.WriteTimeout = time.Second
+	ts.Start()
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/debug/pprof/profile?seconds=2")
+	if err != nil {
+		t.Fatalf("GET /debug/pprof/profile error = %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Reading profile error = %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /debug/pprof/profile status = %d; want %d: %s", resp.StatusCode, http.StatusOK, body)
+	}
+	if len(body) == 0 {
+		t.Error("GET /debug/pprof/profile returned an empty profile")
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+)
+
+// ErrTaskBlocked is returned when a task would be completed while a task
+// it is blocked by is still open
+var ErrTaskBlocked = errors.New("task is blocked by open tasks")
+
+// blockedCompletionKey marks a context whose mutations may complete
+// blocked tasks
+type blockedCompletionKey struct{}
+
+// allowBlockedCompletion returns ctx with the check that blockers are
+// completed first turned off, for requests with ?force=true
+func allowBlockedCompletion(ctx context.Context) context.Context {
+	return context.WithValue(ctx, blockedCompletionKey{}, true)
+}
+
+// blockedCompletionAllowed reports whether ctx came from
+// allowBlockedCompletion
+func blockedCompletionAllowed(ctx context.Context) bool {
+	allowed, _ := ctx.Value(blockedCompletionKey{}).(bool)
+	return allowed
+}
+
+// lookupLocked finds a task in the task list, the trash or the archive.
+// The caller must hold a lock.
+func (ts *TaskStore) lookupLocked(id int) (*Task, bool) {
+	for _, partition := range []map[int]*Task{ts.tasks, ts.trash, ts.archive} {
+		if task, exists := partition[id]; exists {
+			return task, true
+		}
+	}
+	return nil, false
+}
+
+// normalizeBlockersLocked checks the blockers of task id and returns them
+// sorted and without duplicates. Every blocker must be in the task list,
+// and none may depend on the task, directly or through other tasks, as
+// that would leave neither able to be completed first. Dependencies of
+// trashed and archived tasks count too, since they can come back. The
+// caller must hold a lock.
+func (ts *TaskStore) normalizeBlockersLocked(id int, blockers []int) ([]int, error) {
+	if len(blockers) == 0 {
+		return nil, nil
+	}
+	seen := make(map[int]bool, len(blockers))
+	normalized := make([]int, 0, len(blockers))
+	for _, blocker := range blockers {
+		if seen[blocker] {
+			continue
+		}
+		seen[blocker] = true
+		if blocker == id {
+			return nil, &validationError{ErrCodeDependencyCycle, "A task can't be blocked by itself"}
+		}
+		if _, exists := ts.tasks[blocker]; !exists {
+			return nil, &validationError{ErrCodeBlockerNotFound, "blocked_by names a task that isn't in the task list"}
+		}
+		normalized = append(normalized, blocker)
+	}
+	sort.Ints(normalized)
+
+	// Walk everything the new blockers depend on, looking for the task
+	visited := make(map[int]bool)
+	pending := append([]int(nil), normalized...)
+	for len(pending) > 0 {
+		current := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if current == id {
+			return nil, &validationError{ErrCodeDependencyCycle, "blocked_by would make the tasks block each other"}
+		}
+		if visited[current] {
+			continue
+		}
+		visited[current] = true
+		if task, exists := ts.lookupLocked(current); exists {
+			pending = append(pending, task.BlockedBy...)
+		}
+	}
+	return normalized, nil
+}
+
+// checkCompletionLocked returns ErrTaskBlocked if setting status would
+// complete task while one of blockers is still open, unless ctx allows it.
+// Blockers that were deleted or archived don't count. The caller must hold
+// a lock.
+func (ts *TaskStore) checkCompletionLocked(ctx context.Context, task *Task, blockers []int, status string) error {
+	if status != "completed" || task.Status == "completed" || blockedCompletionAllowed(ctx) {
+		return nil
+	}
+	for _, id := range blockers {
+		if blocker, exists := ts.tasks[id]; exists && blocker.Status != "completed" {
+			return ErrTaskBlocked
+		}
+	}
+	return nil
+}
+
+// Blockers returns the tasks in the task list that task id is blocked by,
+// completed or not. The bool reports whether the task exists.
+func (ts *TaskStore) Blockers(id int) ([]*Task, bool) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	task, exists := ts.tasks[id]
+	if !exists {
+		return nil, false
+	}
+	blockers := make([]*Task, 0, len(task.BlockedBy))
+	for _, blockerID := range task.BlockedBy {
+		if blocker, exists := ts.tasks[blockerID]; exists {
+			blockers = append(blockers, blocker)
+		}
+	}
+	return blockers, true
+}
+
+// Blocking returns the tasks in the task list that are blocked by task id,
+// ordered by ID. The bool reports whether the task exists.
+func (ts *TaskStore) Blocking(id int) ([]*Task, bool) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	if _, exists := ts.tasks[id]; !exists {
+		return nil, false
+	}
+	blocked := make([]*Task, 0)
+	for _, task := range ts.tasks {
+		for _, blockerID := range task.BlockedBy {
+			if blockerID == id {
+				blocked = append(blocked, task)
+				break
+			}
+		}
+	}
+	sortByID(blocked)
+	return blocked, true
+}
+
+// handleGetBlockers lists the tasks a task is blocked by
+func (s *Server) handleGetBlockers(w http.ResponseWriter, r *http.Request) {
+	s.writeDependencies(w, r, s.store.Blockers)
+}
+
+// handleGetBlocking lists the tasks a task blocks
+func (s *Server) handleGetBlocking(w http.ResponseWriter, r *http.Request) {
+	s.writeDependencies(w, r, s.store.Blocking)
+}
+
+// writeDependencies responds with the tasks list returns for the task in
+// the request path
+func (s *Server) writeDependencies(w http.ResponseWriter, r *http.Request, list func(int) ([]*Task, bool)) {
+	id, err := s.parseTaskID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidTaskID, "Invalid task ID")
+		return
+	}
+	tasks, exists := list(id)
+	if !exists {
+		writeError(w, http.StatusNotFound, ErrCodeTaskNotFound, "Task not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.presentTasks(tasks))
+}
+
+// forceContext returns the request's context, allowing blocked tasks to be
+// completed when the request has ?force=true
+func forceContext(r *http.Request) context.Context {
+	if r.URL.Query().Get("force") == "true" {
+		return allowBlockedCompletion(r.Context())
+	}
+	return r.Context()
+}
+
+// writeTaskBlocked sends the 409 for completing a blocked task
+func writeTaskBlocked(w http.ResponseWriter) {
+	writeError(w, http.StatusConflict, ErrCodeTaskBlocked, "Task is blocked by open tasks; complete them first or add ?force=true")
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestTaskDependencies(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.TokenHashes = []string{hashString("secret-token")}
+	r, err := server.Router()
+	if err != nil {
+		t.Fatalf("Router() error = %v", err)
+	}
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-API-Token", "secret-token")
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	send("POST", "/api/v1/tasks", `{"title": "Design"}`)
+	send("POST", "/api/v1/tasks", `{"title": "Review"}`)
+	w := send("POST", "/api/v1/tasks", `{"title": "Ship", "blocked_by": [2, 1, 2]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create status = %d; want %d: %s", w.Code, http.StatusCreated, w.Body.String())
+	}
+	if task, _ := server.store.Get(3); len(task.BlockedBy) != 2 || task.BlockedBy[0] != 1 || task.BlockedBy[1] != 2 {
+		t.Errorf("blocked_by = %v; want [1 2]", task.BlockedBy)
+	}
+
+	ids := func(path string) []float64 {
+		w := send("GET", path, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s status = %d; want %d", path, w.Code, http.StatusOK)
+		}
+		var tasks []struct {
+			ID float64 `json:"id"`
+		}
+		json.NewDecoder(w.Body).Decode(&tasks)
+		ids := make([]float64, len(tasks))
+		for i, task := range tasks {
+			ids[i] = task.ID
+		}
+		return ids
+	}
+	if got := ids("/api/v1/tasks/3/blockers"); len(got) != 2 || got[0] != 1 {
+		t.Errorf("blockers = %v; want [1 2]", got)
+	}
+	if got := ids("/api/v1/tasks/1/blocking"); len(got) != 1 || got[0] != 3 {
+		t.Errorf("blocking = %v; want [3]", got)
+	}
+	if w := send("GET", "/api/v1/tasks/9/blockers", ""); w.Code != http.StatusNotFound {
+		t.Errorf("blockers of missing task status = %d; want %d", w.Code, http.StatusNotFound)
+	}
+
+	w = send("PATCH", "/api/v1/tasks/3", `{"status": "completed"}`)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), ErrCodeTaskBlocked) {
+		t.Errorf("completing blocked task status = %d: %s; want %d %s", w.Code, w.Body.String(), http.StatusConflict, ErrCodeTaskBlocked)
+	}
+	if w := send("PUT", "/api/v1/tasks/3", `{"title": "Ship", "status": "completed"}`); w.Code != http.StatusConflict {
+		t.Errorf("PUT completing blocked task status = %d; want %d", w.Code, http.StatusConflict)
+	}
+
+	send("PATCH", "/api/v1/tasks/1", `{"status": "completed"}`)
+	send("DELETE", "/api/v1/tasks/2", "")
+	if w := send("PATCH", "/api/v1/tasks/3", `{"status": "completed"}`); w.Code != http.StatusOK {
+		t.Errorf("completing task with completed and deleted blockers status = %d; want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestForceCompletesBlockedTask(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	ctx := context.Background()
+	server.store.Add(ctx, "Blocker", "", DueTime{}, "medium")
+	server.store.AddTask(ctx, Task{Title: "Blocked", Priority: "medium", BlockedBy: []int{1}})
+
+	req := httptest.NewRequest("PATCH", "/api/v1/tasks/2?force=true", strings.NewReader(`{"status": "completed"}`))
+	req = mux.SetURLVars(req, map[string]string{"id": "2"})
+	w := httptest.NewRecorder()
+	server.handlePatchTask(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("forced completion status = %d; want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	if task, _ := server.store.Get(2); task.Status != "completed" {
+		t.Errorf("status = %q; want completed", task.Status)
+	}
+
+	// A task that is already completed can be edited without force
+	if _, _, err := server.store.Update(ctx, 2, "Renamed", "", DueTime{}, "medium", "completed"); err != nil {
+		t.Errorf("Update() of completed blocked task error = %v", err)
+	}
+}
+
+func TestBlockersRejectCyclesAndMissingTasks(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	ctx := context.Background()
+	server.store.Add(ctx, "A", "", DueTime{}, "medium")
+	server.store.AddTask(ctx, Task{Title: "B", BlockedBy: []int{1}})
+	server.store.AddTask(ctx, Task{Title: "C", BlockedBy: []int{2}})
+
+	tests := []struct {
+		name string
+		id   int
+		list string
+		code string
+	}{
+		{"self", 1, "1", ErrCodeDependencyCycle},
+		{"direct", 1, "2", ErrCodeDependencyCycle},
+		{"transitive", 1, "3", ErrCodeDependencyCycle},
+		{"missing", 1, "9", ErrCodeBlockerNotFound},
+	}
+	for _, tt := range tests {
+		_, _, err := server.store.Patch(ctx, tt.id, map[string]string{"blocked_by": tt.list, "title": "Changed"})
+		verr, ok := err.(*validationError)
+		if !ok || verr.code != tt.code {
+			t.Errorf("%s: Patch() error = %v; want %s", tt.name, err, tt.code)
+		}
+	}
+	if task, _ := server.store.Get(1); task.Title != "A" || task.BlockedBy != nil {
+		t.Errorf("task 1 = %+v; want unchanged", task)
+	}
+
+	// A trashed task's dependencies still count, since it can be restored
+	server.store.Delete(ctx, 2)
+	if _, _, err := server.store.Patch(ctx, 1, map[string]string{"blocked_by": "3"}); err == nil {
+		t.Error("Patch() allowed a cycle through a trashed task")
+	}
+	if _, _, err := server.store.Patch(ctx, 3, map[string]string{"blocked_by": ""}); err != nil {
+		t.Errorf("Patch() clearing blocked_by error = %v", err)
+	}
+}
+
+func TestBlockedByUsesObfuscatedIDs(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.ids = newIDCodec("pepper")
+	ctx := context.Background()
+	server.store.Add(ctx, "Blocker", "", DueTime{}, "medium")
+	blocker := server.ids.encodeID(1)
+
+	fields, err := server.newTaskFields(&createTaskRequest{Title: "Blocked", BlockedBy: []json.RawMessage{json.RawMessage(`"` + blocker + `"`)}}, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	task, err := server.store.AddTask(ctx, fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(server.presentTask(task))
+	if !strings.Contains(string(data), `"blocked_by":["`+blocker+`"]`) {
+		t.Errorf("task JSON = %s; want blocked_by as the encoded ID", data)
+	}
+
+	patch, err := server.parseTaskPatch([]byte(`{"blocked_by": ["`+blocker+`"]}`), time.UTC)
+	if err != nil || patch["blocked_by"] != "1" {
+		t.Errorf("parseTaskPatch() = %v, %v; want blocked_by 1", patch, err)
+	}
+	if _, err := server.parseTaskPatch([]byte(`{"blocked_by": ["nope!"]}`), time.UTC); err == nil {
+		t.Error("parseTaskPatch() accepted an invalid ID")
+	}
+}
+
+func TestBulkCompleteRespectsBlockers(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	ctx := context.Background()
+	server.store.Add(ctx, "Blocker", "", DueTime{}, "medium")
+	server.store.AddTask(ctx, Task{Title: "Blocked", BlockedBy: []int{1}})
+
+	if _, err := server.store.ApplyBulk(ctx, []BulkOperation{{Op: BulkComplete, ID: 2}}); err == nil {
+		t.Error("ApplyBulk() completed a blocked task")
+	}
+	// Completing the blocker first in the same batch unblocks it
+	if _, err := server.store.ApplyBulk(ctx, []BulkOperation{{Op: BulkComplete, ID: 1}, {Op: BulkComplete, ID: 2}}); err != nil {
+		t.Errorf("ApplyBulk() error = %v", err)
+	}
+}
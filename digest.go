@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+// digestCompletedWindow is how far back the digest lists completed tasks
+const digestCompletedWindow = 24 * time.Hour
+
+// DigestConfig schedules the digest of overdue, due-today and recently
+// completed tasks
+type DigestConfig struct {
+	// Schedule is a cron expression read in the server's time zone, e.g.
+	// "0 8 * * 1-5"; empty sends no digest
+	Schedule string `json:"schedule,omitempty"`
+}
+
+// validateDigest checks the schedule and that there is a channel to send
+// the digest through
+func validateDigest(config *Config) error {
+	if config.Digest.Schedule == "" {
+		return nil
+	}
+	if _, err := parseCron(config.Digest.Schedule); err != nil {
+		return fmt.Errorf("invalid digest: %w", err)
+	}
+	if len(config.Reminders.Channels) == 0 && config.SMTP.Host == "" {
+		return fmt.Errorf("invalid digest: schedule needs reminders.channels or smtp.host")
+	}
+	return nil
+}
+
+// Digest summarizes the tasks that need attention
+type Digest struct {
+	// Date is the day the digest is for, in the server's time zone
+	Date      string  `json:"date"`
+	Overdue   []*Task `json:"overdue"`
+	DueToday  []*Task `json:"due_today"`
+	Completed []*Task `json:"completed"`
+}
+
+// empty reports whether there is nothing to send
+func (d Digest) empty() bool {
+	return len(d.Overdue) == 0 && len(d.DueToday) == 0 && len(d.Completed) == 0
+}
+
+// DigestNotifier is implemented by notifiers that can also deliver the
+// digest. Channels whose notifier doesn't implement it get reminders only.
+type DigestNotifier interface {
+	NotifyDigest(ctx context.Context, digest Digest) error
+}
+
+// digest collects the tasks for the digest sent at now: open tasks overdue
+// or due today in the server's time zone, and tasks completed in the last
+// day, each list soonest due first
+func (s *Server) digest(now time.Time) Digest {
+	digest := Digest{Date: now.In(s.location).Format(dueDateLayout)}
+	endOfToday := startOfDay(now.In(s.location)).AddDate(0, 0, 1)
+	for _, task := range s.store.List(TaskFilter{}) {
+		switch {
+		case task.Status == "completed":
+			if task.CompletedAt != nil && now.Sub(*task.CompletedAt) < digestCompletedWindow {
+				digest.Completed = append(digest.Completed, task)
+			}
+		case task.DueDate.IsZero():
+		case task.DueDate.Before(now):
+			digest.Overdue = append(digest.Overdue, task)
+		case task.DueDate.Before(endOfToday):
+			digest.DueToday = append(digest.DueToday, task)
+		}
+	}
+	for _, tasks := range [][]*Task{digest.Overdue, digest.DueToday} {
+		sort.SliceStable(tasks, func(i, j int) bool { return tasks[i].DueDate.Before(tasks[j].DueDate.Time) })
+	}
+	return digest
+}
+
+// sendDigest delivers the digest for now to every channel that takes it,
+// unless there is nothing to report. It fails only if every channel did.
+func (s *Server) sendDigest(ctx context.Context, notifiers map[string]Notifier, now time.Time) error {
+	digest := s.digest(now)
+	if digest.empty() {
+		return nil
+	}
+	names := make([]string, 0, len(notifiers))
+	for name := range notifiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	attempted := 0
+	for _, name := range names {
+		notifier, ok := notifiers[name].(DigestNotifier)
+		if !ok {
+			continue
+		}
+		attempted++
+		notifyCtx, cancel := context.WithTimeout(ctx, notifierTimeout)
+		err := notifier.NotifyDigest(notifyCtx, digest)
+		cancel()
+		if err != nil {
+			slog.Warn("Digest delivery failed", "channel", name, "error", err)
+			errs = append(errs, err)
+		}
+	}
+	if attempted > 0 && len(errs) == attempted {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// runDigestScheduler sends the digest at each time digest.schedule names
+// until ctx is cancelled. It does nothing without a schedule.
+func (s *Server) runDigestScheduler(ctx context.Context) {
+	if s.config.Digest.Schedule == "" {
+		return
+	}
+	schedule, err := parseCron(s.config.Digest.Schedule)
+	if err != nil {
+		slog.Error("Digest disabled", "error", err)
+		return
+	}
+	notifiers, err := s.openChannels()
+	if err != nil {
+		slog.Error("Digest disabled", "error", err)
+		return
+	}
+	for name, notifier := range notifiers {
+		if _, ok := notifier.(DigestNotifier); !ok {
+			slog.Warn("Channel doesn't send digests", "channel", name)
+		}
+	}
+
+	for {
+		now := s.now()
+		next := schedule.next(now, s.location)
+		if next.IsZero() {
+			slog.Error("Digest schedule never fires", "schedule", s.config.Digest.Schedule)
+			return
+		}
+		timer := time.NewTimer(next.Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+			if err := s.sendDigest(ctx, notifiers, next); err != nil {
+				slog.Error("Sending digest failed", "error", err)
+			}
+		}
+	}
+}
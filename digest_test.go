@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// digestRecorder collects digests, optionally failing every call
+type digestRecorder struct {
+	recordingNotifier
+	digests []Digest
+}
+
+func (n *digestRecorder) NotifyDigest(_ context.Context, digest Digest) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.failing {
+		return errors.New("channel down")
+	}
+	n.digests = append(n.digests, digest)
+	return nil
+}
+
+func TestSendDigest(t *testing.T) {
+	server, sent, cleanup := setupMailServer(t)
+	defer cleanup()
+	ctx := context.Background()
+	now := time.Date(2024, 3, 11, 8, 0, 0, 0, time.UTC)
+	recorder := &digestRecorder{}
+	down := &digestRecorder{recordingNotifier: recordingNotifier{failing: true}}
+	notifiers := map[string]Notifier{
+		"smtp":      smtpNotifier{server: server},
+		"recorder":  recorder,
+		"down":      down,
+		"reminders": &recordingNotifier{},
+	}
+
+	// Nothing to report sends nothing
+	if err := server.sendDigest(ctx, notifiers, now); err != nil || len(*sent) != 0 || len(recorder.digests) != 0 {
+		t.Fatalf("empty digest: err %v, sent %d", err, len(*sent))
+	}
+
+	server.store.now = func() time.Time { return now.Add(-time.Hour) }
+	server.store.Add(ctx, "Late", "", DueTime{now.Add(-24 * time.Hour)}, "medium")
+	server.store.Add(ctx, "Today", "", DueTime{now.Add(6 * time.Hour)}, "medium")
+	server.store.Add(ctx, "Tomorrow", "", DueTime{now.Add(24 * time.Hour)}, "medium")
+	server.store.Add(ctx, "Done", "", DueTime{}, "medium")
+	server.store.Update(ctx, 4, "Done", "", DueTime{}, "medium", "completed")
+	server.store.Add(ctx, "Earlier today", "", DueTime{now.Add(2 * time.Hour)}, "medium")
+
+	if err := server.sendDigest(ctx, notifiers, now); err != nil {
+		t.Fatalf("one failing channel: %v", err)
+	}
+	if len(recorder.digests) != 1 {
+		t.Fatalf("recorded %d digests; want 1", len(recorder.digests))
+	}
+	digest := recorder.digests[0]
+	titles := func(tasks []*Task) string {
+		var names []string
+		for _, task := range tasks {
+			names = append(names, task.Title)
+		}
+		return strings.Join(names, ",")
+	}
+	if digest.Date != "2024-03-11" || titles(digest.Overdue) != "Late" || titles(digest.DueToday) != "Earlier today,Today" || titles(digest.Completed) != "Done" {
+		t.Errorf("digest = %s overdue %q, today %q, completed %q", digest.Date, titles(digest.Overdue), titles(digest.DueToday), titles(digest.Completed))
+	}
+
+	if len(*sent) != 2 {
+		t.Fatalf("sent %d digest emails; want 2", len(*sent))
+	}
+	msg := (*sent)[0].msg
+	for _, want := range []string{"Subject: TaskMate digest for 2024-03-11", "<li>Late (due Sun Mar 10, 2024 08:00 UTC)</li>", "<li>Today", "<li>Done</li>"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("digest email lacks %q:\n%s", want, msg)
+		}
+	}
+	if strings.Contains(msg, "Tomorrow") {
+		t.Errorf("digest lists a task due tomorrow:\n%s", msg)
+	}
+
+	recorder.failing = true
+	server.sendMail = func(string, smtp.Auth, string, []string, []byte) error { return errors.New("mail down") }
+	if err := server.sendDigest(ctx, notifiers, now); err == nil {
+		t.Error("every channel failing: no error")
+	}
+}
+
+func TestDigestScheduler(t *testing.T) {
+	receiver := &webhookReceiver{}
+	hook := httptest.NewServer(receiver)
+	defer hook.Close()
+
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.location = time.UTC
+	server.config.Digest.Schedule = "0 9 * * *"
+	server.config.Reminders.Channels = []string{"webhook"}
+	server.config.Reminders.WebhookURL = hook.URL
+	// Just before the first run
+	now := time.Date(2024, 3, 11, 8, 59, 59, 900_000_000, time.UTC)
+	var mu sync.Mutex
+	server.now = func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}
+	server.store.Add(context.Background(), "Late", "", DueTime{now.Add(-time.Hour)}, "medium")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		server.runDigestScheduler(ctx)
+		close(done)
+	}()
+	receiver.waitFor(t, 1)
+	mu.Lock()
+	now = now.Add(time.Hour)
+	mu.Unlock()
+	cancel()
+	<-done
+
+	var payload struct {
+		Event string `json:"event"`
+		Digest
+	}
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	if err := json.Unmarshal(receiver.bodies[0], &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Event != "digest" || payload.Date != "2024-03-11" || len(payload.Overdue) != 1 || payload.Overdue[0].Title != "Late" {
+		t.Errorf("webhook payload = %s", receiver.bodies[0])
+	}
+}
+
+func TestValidateDigest(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{"off", Config{}, false},
+		{"reminder channel", Config{Digest: DigestConfig{Schedule: "30 7 * * mon-fri"}, Reminders: ReminderConfig{Channels: []string{"log"}}}, false},
+		{"smtp", Config{Digest: DigestConfig{Schedule: "@daily"}, SMTP: SMTPConfig{Host: "mail.example.com"}}, false},
+		{"no channel", Config{Digest: DigestConfig{Schedule: "@daily"}}, true},
+		{"bad schedule", Config{Digest: DigestConfig{Schedule: "7am"}, Reminders: ReminderConfig{Channels: []string{"log"}}}, true},
+	}
+	for _, tt := range tests {
+		if err := validateDigest(&tt.config); (err != nil) != tt.wantErr {
+			t.Errorf("%s: error %v; want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// dueDateLayout is the format of due dates given as a day
+const dueDateLayout = "2006-01-02"
+
+// timeZoneHeader names the IANA time zone that dates in a request are in
+const timeZoneHeader = "X-Time-Zone"
+
+// savedDayLocation marks due dates read from JSON as a YYYY-MM-DD day, as
+// tasks saved before due dates had a time hold them. The store that loads
+// them moves them to the end of that day in its own time zone with
+// resolveSavedDay, since JSON decoding can't know which zone that is.
+var savedDayLocation = time.FixedZone("saved-day", 0)
+
+// DueTime is when a task is due; the zero value means it has no due date.
+// In JSON it is an RFC 3339 time, or "" without a due date.
+type DueTime struct {
+	time.Time
+}
+
+// dueAtEndOfDay returns the last second of day's date in loc, when a task
+// given only a due day is due
+func dueAtEndOfDay(day time.Time, loc *time.Location) DueTime {
+	return DueTime{time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, loc).Add(-time.Second)}
+}
+
+// parseDueDate reads a due date given as an RFC 3339 time, or as a
+// YYYY-MM-DD day that ends in loc. An empty value is no due date; an
+// invalid one gives a *validationError.
+func parseDueDate(value string, loc *time.Location) (DueTime, error) {
+	if value == "" {
+		return DueTime{}, nil
+	}
+	if day, err := time.Parse(dueDateLayout, value); err == nil {
+		return dueAtEndOfDay(day, loc), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return DueTime{}, &validationError{ErrCodeInvalidDueDate, "due_date must be a date (YYYY-MM-DD) or an RFC 3339 time"}
+	}
+	return DueTime{t}, nil
+}
+
+// String formats d as RFC 3339, or "" without a due date
+func (d DueTime) String() string {
+	if d.IsZero() {
+		return ""
+	}
+	return d.Format(time.RFC3339Nano)
+}
+
+// Day returns the date d falls on in loc as YYYY-MM-DD, or "" without a
+// due date
+func (d DueTime) Day(loc *time.Location) string {
+	if d.IsZero() {
+		return ""
+	}
+	return d.In(loc).Format(dueDateLayout)
+}
+
+// Equal reports whether d and other are the same instant, or both unset
+func (d DueTime) Equal(other DueTime) bool {
+	return d.Time.Equal(other.Time)
+}
+
+func (d DueTime) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON reads what MarshalJSON writes. Tasks saved before due dates
+// had a time hold a YYYY-MM-DD day, which is read in savedDayLocation until
+// the store resolves it.
+func (d *DueTime) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*d = DueTime{}
+		return nil
+	}
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	due, err := parseDueDate(value, savedDayLocation)
+	if err != nil {
+		return err
+	}
+	*d = due
+	return nil
+}
+
+// resolveSavedDay returns d, or for a due date read from a saved day, the
+// end of that day in loc
+func (d DueTime) resolveSavedDay(loc *time.Location) DueTime {
+	if d.IsZero() || d.Location() != savedDayLocation {
+		return d
+	}
+	return dueAtEndOfDay(d.Time, loc)
+}
+
+// timeZoneKey is the context key under which timeZoneMiddleware stores the
+// zone named by the request's X-Time-Zone header
+type timeZoneKey struct{}
+
+// timeZoneMiddleware reads the X-Time-Zone header of every request,
+// answering 400 when it doesn't name an IANA time zone
+func (s *Server) timeZoneMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if name := r.Header.Get(timeZoneHeader); name != "" {
+			loc, err := time.LoadLocation(name)
+			if err != nil || name == "Local" {
+				writeError(w, http.StatusBadRequest, ErrCodeInvalidTimeZone, "X-Time-Zone must be an IANA time zone such as Europe/Berlin")
+				return
+			}
+			r = r.WithContext(context.WithValue(r.Context(), timeZoneKey{}, loc))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestLocation returns the time zone that dates in r are in: the one
+// named by its X-Time-Zone header, else the caller's zone in
+// user_time_zones, else the server's
+func (s *Server) requestLocation(r *http.Request) *time.Location {
+	if loc, ok := r.Context().Value(timeZoneKey{}).(*time.Location); ok {
+		return loc
+	}
+	info := requestToken(r)
+	if info.role == "" {
+		// Reads don't require a token, but the caller may send one
+		info, _ = s.lookupToken(r.Header.Get("X-API-Token"))
+	}
+	if info.role == "" {
+		return s.location
+	}
+	return s.actorLocation(info.actor())
+}
+
+// actorLocation returns the time zone of the caller named actor, as in the
+// audit log: their user_time_zones entry, or the server's
+func (s *Server) actorLocation(actor string) *time.Location {
+	s.mu.RLock()
+	name := s.config.UserTimeZones[actor]
+	s.mu.RUnlock()
+	if loc, err := time.LoadLocation(name); name != "" && err == nil {
+		return loc
+	}
+	return s.location
+}
+
+// validateUserTimeZones checks that every zone in Config.UserTimeZones is
+// an IANA time zone
+func validateUserTimeZones(zones map[string]string) error {
+	for caller, name := range zones {
+		if _, err := time.LoadLocation(name); err != nil || name == "" || name == "Local" {
+			return fmt.Errorf("unknown time zone %q for %s", name, caller)
+		}
+	}
+	return nil
+}
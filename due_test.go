@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dueOn returns the due date of a task due on day, as a request without a
+// time zone would set it on a test server
+func dueOn(day string) DueTime {
+	return dueIn(day, time.Local)
+}
+
+// dueIn returns the due date of a task due on day in loc
+func dueIn(day string, loc *time.Location) DueTime {
+	due, err := parseDueDate(day, loc)
+	if err != nil {
+		panic(err)
+	}
+	return due
+}
+
+func TestParseDueDate(t *testing.T) {
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{"2030-01-02", "2030-01-02T23:59:59+09:00", false},
+		{"2030-01-02T09:30:00Z", "2030-01-02T09:30:00Z", false},
+		{"2030-01-02T09:30:00-05:00", "2030-01-02T09:30:00-05:00", false},
+		{"2030-01-02T09:30:00", "", true},
+		{"02/01/2030", "", true},
+	}
+	for _, tt := range tests {
+		got, err := parseDueDate(tt.value, tokyo)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseDueDate(%q) error = %v; wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("parseDueDate(%q) = %q; want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestDueTimeJSON(t *testing.T) {
+	data, _ := json.Marshal(Task{ID: 1, DueDate: dueIn("2030-01-02T09:30:00+01:00", time.UTC)})
+	if !strings.Contains(string(data), `"due_date":"2030-01-02T09:30:00+01:00"`) {
+		t.Errorf("task JSON = %s; want the due date as RFC 3339", data)
+	}
+	if data, _ := json.Marshal(Task{ID: 1}); !strings.Contains(string(data), `"due_date":""`) {
+		t.Errorf("task JSON = %s; want an empty due date", data)
+	}
+
+	tests := []struct {
+		json string
+		want string
+	}{
+		{`{"due_date":"2030-01-02T09:30:00+01:00"}`, "2030-01-02T09:30:00+01:00"},
+		{`{"due_date":"2030-01-02"}`, "2030-01-02T23:59:59Z"},
+		{`{"due_date":""}`, ""},
+		{`{"due_date":null}`, ""},
+	}
+	for _, tt := range tests {
+		var task Task
+		if err := json.Unmarshal([]byte(tt.json), &task); err != nil || task.DueDate.String() != tt.want {
+			t.Errorf("Unmarshal(%s) due = %q, %v; want %q", tt.json, task.DueDate, err, tt.want)
+		}
+	}
+	var task Task
+	if err := json.Unmarshal([]byte(`{"due_date":"soon"}`), &task); err == nil {
+		t.Error("Unmarshal accepted an invalid due date")
+	}
+}
+
+func TestResolveSavedDay(t *testing.T) {
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+	var task Task
+	if err := json.Unmarshal([]byte(`{"due_date":"2030-01-02"}`), &task); err != nil {
+		t.Fatal(err)
+	}
+	if got := task.DueDate.resolveSavedDay(tokyo).String(); got != "2030-01-02T23:59:59+09:00" {
+		t.Errorf("saved day in Tokyo = %q; want the end of the day there", got)
+	}
+	// Due dates with a time stay as they are
+	due := dueIn("2030-01-02T09:30:00Z", time.UTC)
+	if got := due.resolveSavedDay(tokyo); got != due {
+		t.Errorf("resolveSavedDay(%v) = %v; want it unchanged", due, got)
+	}
+}
+
+func TestDueDatesInRequestTimeZone(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.location = time.UTC
+	server.config.TokenHashes = []string{hashString("secret-token"), hashString("other-token")}
+	server.config.UserTimeZones = map[string]string{"token:" + tokenID(hashString("other-token")): "America/New_York"}
+	r, err := server.Router()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	create := func(token, zone string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/v1/tasks", strings.NewReader(`{"title":"Ship","due_date":"2030-01-02"}`))
+		req.Header.Set("X-API-Token", token)
+		if zone != "" {
+			req.Header.Set(timeZoneHeader, zone)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	tests := []struct {
+		name, token, zone string
+		want              string
+	}{
+		{"server zone", "secret-token", "", "2030-01-02T23:59:59Z"},
+		{"header zone", "secret-token", "Asia/Tokyo", "2030-01-02T23:59:59+09:00"},
+		{"caller zone", "other-token", "", "2030-01-02T23:59:59-05:00"},
+		{"header over caller zone", "other-token", "Europe/Berlin", "2030-01-02T23:59:59+01:00"},
+	}
+	for _, tt := range tests {
+		w := create(tt.token, tt.zone)
+		var task Task
+		json.NewDecoder(w.Body).Decode(&task)
+		if w.Code != http.StatusCreated || task.DueDate.String() != tt.want {
+			t.Errorf("%s: %d due %q; want %d %q", tt.name, w.Code, task.DueDate, http.StatusCreated, tt.want)
+		}
+	}
+
+	for _, zone := range []string{"Mars/Olympus", "Local"} {
+		if w := create("secret-token", zone); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), ErrCodeInvalidTimeZone) {
+			t.Errorf("X-Time-Zone %s: %d %s; want %d %s", zone, w.Code, w.Body.String(), http.StatusBadRequest, ErrCodeInvalidTimeZone)
+		}
+	}
+}
+
+func TestValidateUserTimeZones(t *testing.T) {
+	if err := validateUserTimeZones(map[string]string{"user:alice": "Europe/Berlin"}); err != nil {
+		t.Errorf("validateUserTimeZones() error = %v; want nil", err)
+	}
+	for _, name := range []string{"", "Local", "Nowhere/City"} {
+		if err := validateUserTimeZones(map[string]string{"user:alice": name}); err == nil {
+			t.Errorf("validateUserTimeZones(%q) error = nil; want an error", name)
+		}
+	}
+}
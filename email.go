@@ -0,0 +1,375 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// defaultSMTPPort is the mail submission port, upgraded with STARTTLS when
+// the server offers it
+const defaultSMTPPort = 587
+
+// Kinds of notification email, which users can turn off one by one
+const (
+	NotifyDueSoon  = "due_soon"
+	NotifyAssigned = "assigned"
+	NotifyDigest   = "digest"
+)
+
+// notificationKinds lists the kinds of notification email, each also the
+// name of its template
+var notificationKinds = []string{NotifyDueSoon, NotifyAssigned, NotifyDigest}
+
+// emailInvite is the template of project invites, which are sent to the
+// address given rather than to a recipient and so can't be turned off
+const emailInvite = "invite"
+
+// SMTPConfig is the mail server notification emails are sent through and
+// who receives them
+type SMTPConfig struct {
+	Host string `json:"host,omitempty"`
+	// Port defaults to 587
+	Port     int    `json:"port,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	From     string `json:"from,omitempty"`
+	// Recipients maps users, named as in the audit log ("token:<id>" or
+	// "user:<subject>"), to their email addresses; only they get emails
+	Recipients map[string]string `json:"recipients,omitempty"`
+	// TemplateDir holds due_soon.html, assigned.html, digest.html or
+	// invite.html to use instead of the built-in templates
+	TemplateDir string `json:"template_dir,omitempty"`
+	// OptOuts maps users to the kinds of email they have turned off; it is
+	// managed through /notifications/preferences
+	OptOuts map[string][]string `json:"opt_outs,omitempty"`
+}
+
+// addr is the host:port to dial
+func (c SMTPConfig) addr() string {
+	port := c.Port
+	if port == 0 {
+		port = defaultSMTPPort
+	}
+	return net.JoinHostPort(c.Host, strconv.Itoa(port))
+}
+
+// validateSMTP checks the smtp config, including that any custom templates
+// parse
+func validateSMTP(config SMTPConfig) error {
+	if config.Host == "" {
+		if len(config.Recipients) > 0 {
+			return fmt.Errorf("invalid smtp: host is required")
+		}
+		return nil
+	}
+	if _, err := mail.ParseAddress(config.From); err != nil {
+		return fmt.Errorf("invalid smtp: from: %w", err)
+	}
+	if config.Port < 0 || config.Port > 65535 {
+		return fmt.Errorf("invalid smtp: port must be between 1 and 65535")
+	}
+	for user, address := range config.Recipients {
+		if _, err := mail.ParseAddress(address); err != nil {
+			return fmt.Errorf("invalid smtp: recipient %s: %w", user, err)
+		}
+	}
+	for user, kinds := range config.OptOuts {
+		for _, kind := range kinds {
+			if !containsString(notificationKinds, kind) {
+				return fmt.Errorf("invalid smtp: opt_outs of %s: unknown kind %q", user, kind)
+			}
+		}
+	}
+	if _, err := loadEmailTemplates(config.TemplateDir, time.UTC); err != nil {
+		return fmt.Errorf("invalid smtp: %w", err)
+	}
+	return nil
+}
+
+// emailData is what email templates are executed with. due_soon and
+// assigned use Task, Due and, for assigned, By; digest uses Date and the
+// three task lists; invite uses Project, By, Link and Permission.
+type emailData struct {
+	Task *Task
+	// Due is the task's due date written out in the server's time zone
+	Due string
+	// By is who assigned the task or sent the invite
+	By        string
+	Date      string
+	Overdue   []*Task
+	DueToday  []*Task
+	Completed []*Task
+	Project   *Project
+	// Link is the invite link to accept
+	Link       string
+	Permission string
+}
+
+// defaultEmailTemplates are the built-in bodies of each kind of email
+var defaultEmailTemplates = map[string]string{
+	NotifyDueSoon: `<html><body>
+<p><strong>{{.Task.Title}}</strong> is due {{.Due}}.</p>
+{{with .Task.Description}}<p>{{.}}</p>{{end}}
+<p style="color:#888">Priority: {{.Task.Priority}} · Status: {{.Task.Status}}</p>
+</body></html>`,
+	NotifyAssigned: `<html><body>
+<p>{{.By}} assigned <strong>{{.Task.Title}}</strong> to you.</p>
+{{with .Task.Description}}<p>{{.}}</p>{{end}}
+{{if .Due}}<p>Due {{.Due}}.</p>{{end}}
+</body></html>`,
+	NotifyDigest: `<html><body>
+<h2>Your tasks for {{.Date}}</h2>
+{{if .Overdue}}<h3>Overdue</h3><ul>{{range .Overdue}}<li>{{.Title}} (due {{due .DueDate}})</li>{{end}}</ul>{{end}}
+{{if .DueToday}}<h3>Due today</h3><ul>{{range .DueToday}}<li>{{.Title}} (due {{due .DueDate}})</li>{{end}}</ul>{{end}}
+{{if .Completed}}<h3>Completed in the last day</h3><ul>{{range .Completed}}<li>{{.Title}}</li>{{end}}</ul>{{end}}
+</body></html>`,
+	emailInvite: `<html><body>
+<p>{{.By}} invited you to {{if eq .Permission "view"}}view{{else}}edit{{end}} the project <strong>{{.Project.Name}}</strong>.</p>
+{{with .Project.Description}}<p>{{.}}</p>{{end}}
+<p>To join, accept the invite with your TaskMate token within a week: <code>POST {{.Link}}</code></p>
+</body></html>`,
+}
+
+// loadEmailTemplates parses the built-in templates, replacing any that
+// have a <kind>.html file in dir. The due function formats a DueTime in
+// loc.
+func loadEmailTemplates(dir string, loc *time.Location) (*template.Template, error) {
+	templates := template.New("email").Funcs(template.FuncMap{
+		"due": func(d DueTime) string { return formatEmailDue(d, loc) },
+	})
+	for _, kind := range append(notificationKinds, emailInvite) {
+		text := defaultEmailTemplates[kind]
+		if dir != "" {
+			data, err := os.ReadFile(filepath.Join(dir, kind+".html"))
+			if err == nil {
+				text = string(data)
+			} else if !errors.Is(err, os.ErrNotExist) {
+				return nil, err
+			}
+		}
+		if _, err := templates.New(kind).Parse(text); err != nil {
+			return nil, fmt.Errorf("template %s: %w", kind, err)
+		}
+	}
+	return templates, nil
+}
+
+// formatEmailDue writes out a due date for a reader in loc
+func formatEmailDue(d DueTime, loc *time.Location) string {
+	if d.IsZero() {
+		return ""
+	}
+	return d.In(loc).Format("Mon Jan 2, 2006 15:04 MST")
+}
+
+// buildEmail assembles an HTML message
+func buildEmail(from, to, subject string, body []byte, date time.Time) []byte {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/html; charset=UTF-8\r\n\r\n")
+	msg.Write(body)
+	return msg.Bytes()
+}
+
+// emailSubscribers returns the users who get emails of kind, with their
+// addresses, by user
+func (s *Server) emailSubscribers(kind string) map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	subscribers := make(map[string]string)
+	for user, address := range s.config.SMTP.Recipients {
+		if !containsString(s.config.SMTP.OptOuts[user], kind) {
+			subscribers[user] = address
+		}
+	}
+	return subscribers
+}
+
+// sendEmail renders the template of kind with data and mails it to address
+func (s *Server) sendEmail(address, kind, subject string, data emailData) error {
+	var body bytes.Buffer
+	if err := s.emailTemplates.ExecuteTemplate(&body, kind, data); err != nil {
+		return fmt.Errorf("render %s email: %w", kind, err)
+	}
+	s.mu.RLock()
+	config := s.config.SMTP
+	s.mu.RUnlock()
+	var auth smtp.Auth
+	if config.Username != "" {
+		auth = smtp.PlainAuth("", config.Username, config.Password, config.Host)
+	}
+	msg := buildEmail(config.From, address, subject, body.Bytes(), s.now())
+	return s.sendMail(config.addr(), auth, config.From, []string{address}, msg)
+}
+
+// sendToSubscribers mails an email of kind to every user who gets it. It
+// fails only if every send did.
+func (s *Server) sendToSubscribers(kind, subject string, data emailData) error {
+	subscribers := s.emailSubscribers(kind)
+	users := make([]string, 0, len(subscribers))
+	for user := range subscribers {
+		users = append(users, user)
+	}
+	sort.Strings(users)
+
+	var errs []error
+	for _, user := range users {
+		if err := s.sendEmail(subscribers[user], kind, subject, data); err != nil {
+			slog.Warn("Email delivery failed", "kind", kind, "user", user, "error", err)
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 && len(errs) == len(users) {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+// smtpNotifier mails reminders and the digest to every user who gets
+// due_soon or digest emails. It is added to the channels when an SMTP host
+// is configured.
+type smtpNotifier struct {
+	server *Server
+}
+
+func (n smtpNotifier) Notify(_ context.Context, reminder Reminder) error {
+	task := reminder.Task
+	return n.server.sendToSubscribers(NotifyDueSoon, "Due soon: "+task.Title, emailData{
+		Task: &task,
+		Due:  formatEmailDue(task.DueDate, n.server.location),
+	})
+}
+
+func (n smtpNotifier) NotifyDigest(_ context.Context, digest Digest) error {
+	return n.server.sendToSubscribers(NotifyDigest, "TaskMate digest for "+digest.Date, emailData{
+		Date:      digest.Date,
+		Overdue:   digest.Overdue,
+		DueToday:  digest.DueToday,
+		Completed: digest.Completed,
+	})
+}
+
+// notifyAssigned mails user that by assigned them task, unless they have
+// no address or turned assignment emails off
+func (s *Server) notifyAssigned(task *Task, user, by string) error {
+	if s.emailTemplates == nil {
+		return nil
+	}
+	address, ok := s.emailSubscribers(NotifyAssigned)[user]
+	if !ok {
+		return nil
+	}
+	return s.sendEmail(address, NotifyAssigned, "Assigned to you: "+task.Title, emailData{
+		Task: task,
+		Due:  formatEmailDue(task.DueDate, s.location),
+		By:   by,
+	})
+}
+
+// notificationPreferences is the body of the /notifications/preferences
+// endpoints: the caller's address and which emails they get
+type notificationPreferences struct {
+	// Email is the caller's address from smtp.recipients, if any
+	Email    string `json:"email,omitempty"`
+	DueSoon  bool   `json:"due_soon"`
+	Assigned bool   `json:"assigned"`
+	Digest   bool   `json:"digest"`
+}
+
+// notificationPreferencesRequest changes the emails the caller gets;
+// omitted kinds keep their setting
+type notificationPreferencesRequest struct {
+	DueSoon  *bool `json:"due_soon"`
+	Assigned *bool `json:"assigned"`
+	Digest   *bool `json:"digest"`
+}
+
+// preferencesLocked returns user's notification preferences. The caller
+// must hold s.mu.
+func (s *Server) preferencesLocked(user string) notificationPreferences {
+	optOuts := s.config.SMTP.OptOuts[user]
+	return notificationPreferences{
+		Email:    s.config.SMTP.Recipients[user],
+		DueSoon:  !containsString(optOuts, NotifyDueSoon),
+		Assigned: !containsString(optOuts, NotifyAssigned),
+		Digest:   !containsString(optOuts, NotifyDigest),
+	}
+}
+
+// handleGetNotificationPreferences returns which emails the caller gets
+func (s *Server) handleGetNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	prefs := s.preferencesLocked(auditActor(r.Context()))
+	s.mu.RUnlock()
+	writeJSON(w, http.StatusOK, prefs)
+}
+
+// handleUpdateNotificationPreferences turns kinds of email on or off for
+// the caller
+func (s *Server) handleUpdateNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	var req notificationPreferencesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	user := auditActor(r.Context())
+
+	s.mu.Lock()
+	prefs := s.preferencesLocked(user)
+	if req.DueSoon != nil {
+		prefs.DueSoon = *req.DueSoon
+	}
+	if req.Assigned != nil {
+		prefs.Assigned = *req.Assigned
+	}
+	if req.Digest != nil {
+		prefs.Digest = *req.Digest
+	}
+	on := map[string]bool{NotifyDueSoon: prefs.DueSoon, NotifyAssigned: prefs.Assigned, NotifyDigest: prefs.Digest}
+	var optOuts []string
+	for _, kind := range notificationKinds {
+		if !on[kind] {
+			optOuts = append(optOuts, kind)
+		}
+	}
+
+	prev := s.config.SMTP.OptOuts
+	next := make(map[string][]string, len(prev)+1)
+	for other, kinds := range prev {
+		next[other] = kinds
+	}
+	delete(next, user)
+	if len(optOuts) > 0 {
+		next[user] = optOuts
+	}
+	s.config.SMTP.OptOuts = next
+	if err := SaveConfig(s.config); err != nil {
+		s.config.SMTP.OptOuts = prev
+		s.mu.Unlock()
+		writeError(w, http.StatusInternalServerError, ErrCodeSaveFailed, "Failed to save preferences")
+		return
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, prefs)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sentMail is a message passed to Server.sendMail
+type sentMail struct {
+	addr string
+	to   []string
+	msg  string
+}
+
+// setupMailServer returns a test server with SMTP configured for alice and
+// bob, recording what it sends
+func setupMailServer(t *testing.T) (*Server, *[]sentMail, func()) {
+	server, cleanup := setupTestServer()
+	server.location = time.UTC
+	server.config.SMTP = SMTPConfig{
+		Host:       "mail.example.com",
+		From:       "taskmate@example.com",
+		Recipients: map[string]string{"user:alice": "alice@example.com", "user:bob": "bob@example.com"},
+	}
+	templates, err := loadEmailTemplates("", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.emailTemplates = templates
+	var sent []sentMail
+	server.sendMail = func(addr string, _ smtp.Auth, _ string, to []string, msg []byte) error {
+		sent = append(sent, sentMail{addr, to, string(msg)})
+		return nil
+	}
+	return server, &sent, cleanup
+}
+
+func TestEmailNotifications(t *testing.T) {
+	server, sent, cleanup := setupMailServer(t)
+	defer cleanup()
+	server.config.SMTP.OptOuts = map[string][]string{"user:bob": {NotifyDueSoon}}
+	ctx := context.Background()
+	now := time.Date(2024, 3, 11, 9, 0, 0, 0, time.UTC)
+	server.now = func() time.Time { return now }
+
+	due := DueTime{now.Add(2 * time.Hour)}
+	task, _ := server.store.Add(ctx, "Ship <b>v2</b>", "", due, "high")
+	if err := (smtpNotifier{server: server}).Notify(ctx, Reminder{Task: *task, DueAt: due.Time}); err != nil {
+		t.Fatal(err)
+	}
+	if len(*sent) != 1 || (*sent)[0].to[0] != "alice@example.com" || (*sent)[0].addr != "mail.example.com:587" {
+		t.Fatalf("due-soon emails = %+v; want one to alice on port 587", *sent)
+	}
+	msg := (*sent)[0].msg
+	for _, want := range []string{
+		"Subject: Due soon: Ship <b>v2</b>\r\n",
+		"Content-Type: text/html; charset=UTF-8\r\n",
+		"Ship &lt;b&gt;v2&lt;/b&gt;",
+		"Mon Mar 11, 2024 11:00 UTC",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("due-soon email lacks %q:\n%s", want, msg)
+		}
+	}
+
+	*sent = nil
+	if err := server.notifyAssigned(task, "user:bob", "user:alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.notifyAssigned(task, "user:carol", "user:alice"); err != nil {
+		t.Fatal(err)
+	}
+	if len(*sent) != 1 || (*sent)[0].to[0] != "bob@example.com" || !strings.Contains((*sent)[0].msg, "user:alice assigned") {
+		t.Errorf("assignment emails = %+v; want one to bob", *sent)
+	}
+}
+
+func TestNotificationPreferences(t *testing.T) {
+	server, sent, cleanup := setupMailServer(t)
+	defer cleanup()
+	defer os.Remove("config.json")
+	server.config.TokenHashes = []string{hashString("secret-token")}
+	user := "token:" + tokenID(hashString("secret-token"))
+	server.config.SMTP.Recipients[user] = "me@example.com"
+	r, err := server.Router()
+	if err != nil {
+		t.Fatal(err)
+	}
+	send := func(method, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/v1/notifications/preferences", strings.NewReader(body))
+		req.Header.Set("X-API-Token", "secret-token")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := send("GET", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"email":"me@example.com","due_soon":true,"assigned":true,"digest":true`) {
+		t.Errorf("GET: status %d: %s", w.Code, w.Body.String())
+	}
+	if w := send("PUT", `{"digest": false, "assigned": false}`); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"due_soon":true,"assigned":false,"digest":false`) {
+		t.Errorf("PUT: status %d: %s", w.Code, w.Body.String())
+	}
+	if w := send("PUT", `{"assigned": true}`); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"assigned":true,"digest":false`) {
+		t.Errorf("second PUT: status %d: %s", w.Code, w.Body.String())
+	}
+	if got := server.config.SMTP.OptOuts[user]; len(got) != 1 || got[0] != NotifyDigest {
+		t.Errorf("opt-outs = %v; want [digest]", got)
+	}
+	saved, err := os.ReadFile("config.json")
+	if err != nil || !strings.Contains(string(saved), `"opt_outs"`) {
+		t.Errorf("config.json doesn't have the opt-outs: %v", err)
+	}
+
+	server.store.Add(context.Background(), "Overdue", "", DueTime{time.Now().Add(-time.Hour)}, "medium")
+	server.sendDigest(context.Background(), map[string]Notifier{"smtp": smtpNotifier{server: server}}, time.Now())
+	for _, mail := range *sent {
+		if mail.to[0] == "me@example.com" {
+			t.Errorf("digest sent to a user who turned it off")
+		}
+	}
+	if w := send("PUT", `{"digest": "no"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid PUT: status %d; want 400", w.Code)
+	}
+}
+
+func TestValidateSMTP(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "digest.html"), []byte("{{.Date"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	valid := SMTPConfig{Host: "mail.example.com", From: "taskmate@example.com"}
+	if err := validateSMTP(valid); err != nil {
+		t.Errorf("valid config: %v", err)
+	}
+	tests := map[string]func(*SMTPConfig){
+		"no host":         func(c *SMTPConfig) { c.Host = ""; c.Recipients = map[string]string{"user:alice": "alice@example.com"} },
+		"bad from":        func(c *SMTPConfig) { c.From = "not an address" },
+		"bad port":        func(c *SMTPConfig) { c.Port = 70000 },
+		"bad recipient":   func(c *SMTPConfig) { c.Recipients = map[string]string{"user:alice": "alice"} },
+		"unknown kind":    func(c *SMTPConfig) { c.OptOuts = map[string][]string{"user:alice": {"weekly"}} },
+		"broken template": func(c *SMTPConfig) { c.TemplateDir = dir },
+	}
+	for name, change := range tests {
+		config := valid
+		change(&config)
+		if err := validateSMTP(config); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// Error codes returned in the "code" field of error responses. They are part
+// of the API contract: clients branch on them, so existing values must never
+// change meaning.
+const (
+	ErrCodeInvalidJSON            = "INVALID_JSON"
+	ErrCodeInvalidQuery           = "INVALID_QUERY"
+	ErrCodeInvalidTaskID          = "INVALID_TASK_ID"
+	ErrCodeInvalidProjectID       = "INVALID_PROJECT_ID"
+	ErrCodeInvalidRevision        = "INVALID_REVISION"
+	ErrCodeInvalidCommentID       = "INVALID_COMMENT_ID"
+	ErrCodeInvalidAttachmentID    = "INVALID_ATTACHMENT_ID"
+	ErrCodeTaskNotFound           = "TASK_NOT_FOUND"
+	ErrCodeSubtaskNotFound        = "SUBTASK_NOT_FOUND"
+	ErrCodeCommentNotFound        = "COMMENT_NOT_FOUND"
+	ErrCodeAttachmentNotFound     = "ATTACHMENT_NOT_FOUND"
+	ErrCodeTagNotFound            = "TAG_NOT_FOUND"
+	ErrCodeProjectNotFound        = "PROJECT_NOT_FOUND"
+	ErrCodeRevisionNotFound       = "REVISION_NOT_FOUND"
+	ErrCodeBlockerNotFound        = "BLOCKER_NOT_FOUND"
+	ErrCodeWebhookNotFound        = "WEBHOOK_NOT_FOUND"
+	ErrCodeIntegrationNotFound    = "INTEGRATION_NOT_FOUND"
+	ErrCodeCollaboratorNotFound   = "COLLABORATOR_NOT_FOUND"
+	ErrCodeWorkspaceNotFound      = "WORKSPACE_NOT_FOUND"
+	ErrCodeTokenNotFound          = "TOKEN_NOT_FOUND"
+	ErrCodeValidation             = "VALIDATION_FAILED"
+	ErrCodeBulkFailed             = "BULK_FAILED"
+	ErrCodeTitleRequired          = "TITLE_REQUIRED"
+	ErrCodeNameRequired           = "NAME_REQUIRED"
+	ErrCodeCommentRequired        = "COMMENT_REQUIRED"
+	ErrCodeInvalidTag             = "INVALID_TAG"
+	ErrCodeInvalidRecurrence      = "INVALID_RECURRENCE"
+	ErrCodeInvalidPriority        = "INVALID_PRIORITY"
+	ErrCodeInvalidStatus          = "INVALID_STATUS"
+	ErrCodeInvalidDueDate         = "INVALID_DUE_DATE"
+	ErrCodeInvalidTimeZone        = "INVALID_TIME_ZONE"
+	ErrCodeInvalidAssignee        = "INVALID_ASSIGNEE"
+	ErrCodeInvalidCollaborator    = "INVALID_COLLABORATOR"
+	ErrCodeInvalidPermission      = "INVALID_PERMISSION"
+	ErrCodeUnknownUser            = "UNKNOWN_USER"
+	ErrCodeInvalidWorkspace       = "INVALID_WORKSPACE"
+	ErrCodeTooManyTags            = "TOO_MANY_TAGS"
+	ErrCodePreconditionFailed     = "PRECONDITION_FAILED"
+	ErrCodePreconditionRequired   = "PRECONDITION_REQUIRED"
+	ErrCodeTaskConflict           = "TASK_CONFLICT"
+	ErrCodeTaskCompleted          = "TASK_COMPLETED"
+	ErrCodeTaskOpen               = "TASK_OPEN"
+	ErrCodeTaskBlocked            = "TASK_BLOCKED"
+	ErrCodeTransitionNotAllowed   = "TRANSITION_NOT_ALLOWED"
+	ErrCodeTimerRunning           = "TIMER_RUNNING"
+	ErrCodeTimerNotRunning        = "TIMER_NOT_RUNNING"
+	ErrCodeDependencyCycle        = "DEPENDENCY_CYCLE"
+	ErrCodeProjectNotEmpty        = "PROJECT_NOT_EMPTY"
+	ErrCodeProjectUnowned         = "PROJECT_UNOWNED"
+	ErrCodeWorkspaceExists        = "WORKSPACE_EXISTS"
+	ErrCodeTokenRequired          = "TOKEN_REQUIRED"
+	ErrCodeInvalidToken           = "INVALID_TOKEN"
+	ErrCodeTokenExpired           = "TOKEN_EXPIRED"
+	ErrCodeForbidden              = "FORBIDDEN"
+	ErrCodeInvalidRole            = "INVALID_ROLE"
+	ErrCodeInvalidScope           = "INVALID_SCOPE"
+	ErrCodePasswordRequired       = "PASSWORD_REQUIRED"
+	ErrCodeInvalidPassword        = "INVALID_PASSWORD"
+	ErrCodeWeakPassword           = "WEAK_PASSWORD"
+	ErrCodeOIDCNotConfigured      = "OIDC_NOT_CONFIGURED"
+	ErrCodeOIDCLoginFailed        = "OIDC_LOGIN_FAILED"
+	ErrCodeOIDCProviderError      = "OIDC_PROVIDER_ERROR"
+	ErrCodeInvalidArchive         = "INVALID_ARCHIVE"
+	ErrCodeInvalidUpgrade         = "INVALID_UPGRADE"
+	ErrCodeInvalidMessage         = "INVALID_MESSAGE"
+	ErrCodeArchiveTooLarge        = "ARCHIVE_TOO_LARGE"
+	ErrCodeInvalidAttachment      = "INVALID_ATTACHMENT"
+	ErrCodeAttachmentTooLarge     = "ATTACHMENT_TOO_LARGE"
+	ErrCodeAttachmentStorage      = "ATTACHMENT_STORAGE_FAILED"
+	ErrCodeAttachmentsUnavailable = "ATTACHMENTS_UNAVAILABLE"
+	ErrCodeInvalidCSV             = "INVALID_CSV"
+	ErrCodeInvalidExport          = "INVALID_EXPORT"
+	ErrCodeShareLinkInvalid       = "SHARE_LINK_INVALID"
+	ErrCodeShareLinkExpired       = "SHARE_LINK_EXPIRED"
+	ErrCodeInviteInvalid          = "INVITE_INVALID"
+	ErrCodeInviteExpired          = "INVITE_EXPIRED"
+	ErrCodeFeedTokenInvalid       = "FEED_TOKEN_INVALID"
+	ErrCodeRequestCancelled       = "REQUEST_CANCELLED"
+	ErrCodeQuotaExceeded          = "QUOTA_EXCEEDED"
+	ErrCodeServerBusy             = "SERVER_BUSY"
+	ErrCodeRateLimited            = "RATE_LIMITED"
+	ErrCodeOperationDisabled      = "OPERATION_DISABLED"
+	ErrCodeSaveFailed             = "SAVE_FAILED"
+	ErrCodeInternal               = "INTERNAL_ERROR"
+)
+
+// validationError is a business-rule violation in a well-formed request,
+// carrying the error code to report alongside its message
+type validationError struct {
+	code    string
+	message string
+}
+
+func (e *validationError) Error() string {
+	return e.message
+}
+
+// status is the HTTP status reported for e: 422, except 400 for a tag list
+// longer than max_tags_per_task
+func (e *validationError) status() int {
+	if e.code == ErrCodeTooManyTags {
+		return http.StatusBadRequest
+	}
+	return http.StatusUnprocessableEntity
+}
+
+// writeError sends a JSON error body of the form
+// {"error": "<message>", "code": "<ERROR_CODE>", "status": <http status>}
+//
+// Validation failures use two status codes:
+//   - 400 Bad Request when the request can't be parsed or has the wrong
+//     shape: malformed JSON, a non-numeric ID, an unknown query value
+//   - 422 Unprocessable Entity when the request is well-formed but breaks a
+//     business rule, such as a missing title
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error":  message,
+		"code":   code,
+		"status": status,
+	})
+}
+
+// writeValidationError sends a 422 for err, using its code and status when
+// it is a validationError
+func writeValidationError(w http.ResponseWriter, err error) {
+	var verr *validationError
+	if errors.As(err, &verr) {
+		writeError(w, verr.status(), verr.code, verr.message)
+		return
+	}
+	writeError(w, http.StatusUnprocessableEntity, ErrCodeValidation, err.Error())
+}
+
+// writeStoreError maps an error from a mutating TaskStore call to a response:
+// 403 when the caller lacks permission in the project, 503 when the request
+// was cancelled before the change was applied or the server is shutting
+// down, 409 when storage holds a newer version of the task, 500 when the
+// tasks could not be written
+func writeStoreError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrProjectForbidden) {
+		writeError(w, http.StatusForbidden, ErrCodeForbidden, "Not permitted in this project")
+		return
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		writeError(w, http.StatusServiceUnavailable, ErrCodeRequestCancelled, "Request cancelled")
+		return
+	}
+	if errors.Is(err, ErrStoreClosed) {
+		writeError(w, http.StatusServiceUnavailable, ErrCodeServerBusy, "Server is shutting down")
+		return
+	}
+	if errors.Is(err, ErrStorageConflict) {
+		writeError(w, http.StatusConflict, ErrCodeTaskConflict, "Task was changed in storage by someone else")
+		return
+	}
+	slog.Error("Failed to save tasks", "error", err)
+	writeError(w, http.StatusInternalServerError, ErrCodeSaveFailed, "Failed to save tasks")
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestErrorCodes(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	r, err := server.Router()
+	if err != nil {
+		t.Fatalf("Router() error = %v", err)
+	}
+	token := "test-token"
+	server.config.TokenHashes = []string{hashString(token)}
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		token      string
+		wantStatus int
+		wantCode   string
+	}{
+		{"missing task", "GET", "/api/v1/tasks/99", "", "", http.StatusNotFound, ErrCodeTaskNotFound},
+		{"bad task id", "GET", "/api/v1/tasks/abc", "", "", http.StatusBadRequest, ErrCodeInvalidTaskID},
+		{"no token", "POST", "/api/v1/tasks", `{"title":"x"}`, "", http.StatusUnauthorized, ErrCodeTokenRequired},
+		{"wrong token", "POST", "/api/v1/tasks", `{"title":"x"}`, "nope", http.StatusUnauthorized, ErrCodeInvalidToken},
+		{"malformed body", "POST", "/api/v1/tasks", `{`, token, http.StatusBadRequest, ErrCodeInvalidJSON},
+		{"missing title", "POST", "/api/v1/tasks", `{"title":""}`, token, http.StatusUnprocessableEntity, ErrCodeTitleRequired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			if tt.token != "" {
+				req.Header.Set("X-API-Token", tt.token)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d; want %d", w.Code, tt.wantStatus)
+			}
+			var body struct {
+				Error  string `json:"error"`
+				Code   string `json:"code"`
+				Status int    `json:"status"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatalf("Failed to decode error body: %v", err)
+			}
+			if body.Code != tt.wantCode || body.Status != tt.wantStatus || body.Error == "" {
+				t.Errorf("body = %+v; want code %s, status %d", body, tt.wantCode, tt.wantStatus)
+			}
+		})
+	}
+}
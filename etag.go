@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ErrVersionMismatch is returned by the IfMatch store methods when the task
+// has been saved since the version the client has
+var ErrVersionMismatch = errors.New("task version does not match")
+
+// versionIn reports whether version is one of versions
+func versionIn(version int, versions []int) bool {
+	for _, v := range versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// taskETag is the strong entity tag of a task: its quoted Version
+func taskETag(task *Task) string {
+	return `"` + strconv.Itoa(task.Version) + `"`
+}
+
+// parseIfMatch reads an If-Match header into the task versions it accepts.
+// It returns nil for "*", which any existing task matches. Weak and
+// malformed tags are skipped, since If-Match compares strongly; a header
+// of only those yields an empty list that matches nothing.
+func parseIfMatch(header string) []int {
+	versions := make([]int, 0)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return nil
+		}
+		if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+			continue
+		}
+		if version, err := strconv.Atoi(tag[1 : len(tag)-1]); err == nil {
+			versions = append(versions, version)
+		}
+	}
+	return versions
+}
+
+// ifMatchVersions returns the versions a PUT or PATCH is conditional on,
+// or nil for an unconditional one. Without an If-Match header it writes
+// 428 and returns false when require_if_match is set.
+func (s *Server) ifMatchVersions(w http.ResponseWriter, r *http.Request) ([]int, bool) {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		if s.config.RequireIfMatch {
+			writeError(w, http.StatusPreconditionRequired, ErrCodePreconditionRequired, "If-Match header is required")
+			return nil, false
+		}
+		return nil, true
+	}
+	return parseIfMatch(header), true
+}
+
+// writeVersionMismatch sends the 412 for a failed If-Match
+func writeVersionMismatch(w http.ResponseWriter) {
+	writeError(w, http.StatusPreconditionFailed, ErrCodePreconditionFailed, "Task was modified; fetch it again for its current ETag")
+}
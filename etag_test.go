@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestTaskETagAndIfMatch(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.TokenHashes = []string{hashString("secret-token")}
+	r, err := server.Router()
+	if err != nil {
+		t.Fatalf("Router() error = %v", err)
+	}
+
+	send := func(method, path, ifMatch, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-API-Token", "secret-token")
+		req.Header.Set("Content-Type", contentType)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	send("POST", "/api/v1/tasks", "", "application/json", `{"title": "Shared"}`)
+
+	w := send("GET", "/api/v1/tasks/1", "", "", "")
+	etag := w.Header().Get("ETag")
+	if etag != `"1"` {
+		t.Fatalf("ETag = %q; want %q", etag, `"1"`)
+	}
+
+	w = send("PUT", "/api/v1/tasks/1", etag, "application/json", `{"title": "Mine", "priority": "high"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT with current ETag status = %d; want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	if got := w.Header().Get("ETag"); got != `"2"` {
+		t.Errorf("ETag after PUT = %q; want %q", got, `"2"`)
+	}
+
+	// A second writer still holding the first ETag
+	w = send("PUT", "/api/v1/tasks/1", etag, "application/json", `{"title": "Theirs", "priority": "low"}`)
+	if w.Code != http.StatusPreconditionFailed {
+		t.Errorf("PUT with stale ETag status = %d; want %d", w.Code, http.StatusPreconditionFailed)
+	}
+	w = send("PATCH", "/api/v1/tasks/1", etag, "application/merge-patch+json", `{"title": "Theirs"}`)
+	if w.Code != http.StatusPreconditionFailed {
+		t.Errorf("PATCH with stale ETag status = %d; want %d", w.Code, http.StatusPreconditionFailed)
+	}
+	if task, _ := server.store.Get(1); task.Title != "Mine" || task.Version != 2 {
+		t.Errorf("task = %+v; want the first writer's change at version 2", task)
+	}
+
+	w = send("PATCH", "/api/v1/tasks/1", `W/"2", "2"`, "application/merge-patch+json", `{"title": "Patched"}`)
+	if w.Code != http.StatusOK || w.Header().Get("ETag") != `"3"` {
+		t.Errorf("PATCH with current ETag status = %d, ETag %q; want %d, %q", w.Code, w.Header().Get("ETag"), http.StatusOK, `"3"`)
+	}
+	w = send("PUT", "/api/v1/tasks/1", "*", "application/json", `{"title": "Any", "priority": "medium"}`)
+	if w.Code != http.StatusOK {
+		t.Errorf("PUT with If-Match * status = %d; want %d", w.Code, http.StatusOK)
+	}
+	w = send("PUT", "/api/v1/tasks/1", "", "application/json", `{"title": "Blind", "priority": "medium"}`)
+	if w.Code != http.StatusOK {
+		t.Errorf("PUT without If-Match status = %d; want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestRequireIfMatch(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.RequireIfMatch = true
+	server.store.Add(context.Background(), "Guarded", "", DueTime{}, "medium")
+
+	for _, method := range []string{"PUT", "PATCH"} {
+		req := httptest.NewRequest(method, "/api/v1/tasks/1", strings.NewReader(`{"title": "Changed"}`))
+		req = mux.SetURLVars(req, map[string]string{"id": "1"})
+		if method == "PATCH" {
+			req.Header.Set("Content-Type", "application/merge-patch+json")
+		}
+		w := httptest.NewRecorder()
+		if method == "PUT" {
+			server.handleUpdateTask(w, req)
+		} else {
+			server.handlePatchTask(w, req)
+		}
+		if w.Code != http.StatusPreconditionRequired {
+			t.Errorf("%s without If-Match status = %d; want %d", method, w.Code, http.StatusPreconditionRequired)
+		}
+	}
+	if task, _ := server.store.Get(1); task.Title != "Guarded" {
+		t.Errorf("title = %q; want Guarded", task.Title)
+	}
+}
+
+func TestParseIfMatch(t *testing.T) {
+	tests := []struct {
+		header string
+		want   []int
+	}{
+		{`"3"`, []int{3}},
+		{`"3", "5"`, []int{3, 5}},
+		{`*`, nil},
+		{`W/"3"`, []int{}},
+		{`3, "x", "4"`, []int{4}},
+	}
+	for _, tt := range tests {
+		if got := parseIfMatch(tt.header); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseIfMatch(%q) = %#v; want %#v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestVersionUnchangedByFailedSave(t *testing.T) {
+	backend := &memoryBackend{rows: map[int]Task{1: {ID: 1, Title: "Stored", Status: "pending", Version: 4}}}
+	store, err := NewTaskStoreWithStorage(backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	backend.failing = true
+	if _, _, err := store.Patch(ctx, 1, map[string]string{"title": "Lost"}); err == nil {
+		t.Fatal("Patch() error = nil; want the backend's error")
+	}
+	if task, _ := store.Get(1); task.Version != 4 {
+		t.Errorf("version after failed save = %d; want 4", task.Version)
+	}
+
+	backend.failing = false
+	if _, _, err := store.UpdateIfMatch(ctx, 1, []int{4}, "Saved", "", DueTime{}, "medium", ""); err != nil {
+		t.Fatalf("UpdateIfMatch() error = %v", err)
+	}
+	if backend.rows[1].Version != 5 {
+		t.Errorf("stored version = %d; want 5", backend.rows[1].Version)
+	}
+	if _, _, err := store.UpdateIfMatch(ctx, 1, []int{4}, "Stale", "", DueTime{}, "medium", ""); err != ErrVersionMismatch {
+		t.Errorf("UpdateIfMatch() with stale version error = %v; want ErrVersionMismatch", err)
+	}
+}
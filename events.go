@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// sseHeartbeatInterval is how often an idle event stream gets a comment
+	// line, so proxies don't close it
+	sseHeartbeatInterval = 30 * time.Second
+	// defaultMaxEventStreams caps open event streams when
+	// Config.MaxEventStreams is unset
+	defaultMaxEventStreams = 100
+)
+
+// newEventStreamSlots returns the semaphore limiting open event streams
+func newEventStreamSlots(config *Config) chan struct{} {
+	limit := config.MaxEventStreams
+	if limit <= 0 {
+		limit = defaultMaxEventStreams
+	}
+	return make(chan struct{}, limit)
+}
+
+// handleEvents streams task changes as Server-Sent Events. Each event's
+// id is the change's revision and its type is created, updated or
+// deleted, with the same JSON data as a long-poll change. A reconnecting
+// client resumes after its Last-Event-ID (or ?since=); a new one starts
+// from the current revision. If the client fell out of the change log it
+// gets a resync event and should reload /api/v1/tasks.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	since := s.store.Revision()
+	resume := r.Header.Get("Last-Event-ID")
+	if resume == "" {
+		resume = r.URL.Query().Get("since")
+	}
+	if resume != "" {
+		revision, err := strconv.ParseInt(resume, 10, 64)
+		if err != nil || revision < 0 {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidQuery, "Invalid Last-Event-ID or since")
+			return
+		}
+		since = revision
+	}
+
+	select {
+	case s.eventStreams <- struct{}{}:
+		defer func() { <-s.eventStreams }()
+	default:
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusServiceUnavailable, ErrCodeServerBusy, "Too many open event streams")
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	// Streams outlive the server's WriteTimeout; lift it for this response
+	_ = rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	streamCtx, stop := s.streamContext(r)
+	defer stop()
+	for {
+		ctx, cancel := context.WithTimeout(streamCtx, sseHeartbeatInterval)
+		changes, revision, complete := s.store.WaitForChanges(ctx, since)
+		cancel()
+		if streamCtx.Err() != nil {
+			return
+		}
+
+		switch {
+		case !complete:
+			fmt.Fprintf(w, "id: %d\nevent: resync\ndata: {\"revision\":%d}\n\n", revision, revision)
+		case len(changes) == 0:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		}
+		for _, change := range changes {
+			data, err := json.Marshal(s.presentChange(change))
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", change.Revision, change.Type, data)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+		since = revision
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readEvent reads one Server-Sent Event, skipping comment lines
+func readEvent(t *testing.T, r *bufio.Reader) (id, event, data string) {
+	t.Helper()
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read event: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			if event != "" {
+				return id, event, data
+			}
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func openEventStream(t *testing.T, server *Server, header http.Header) (*http.Response, *bufio.Reader) {
+	t.Helper()
+	router, err := server.Router()
+	if err != nil {
+		t.Fatalf("Router() error = %v", err)
+	}
+	ts := httptest.NewServer(router)
+	t.Cleanup(ts.Close)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL+"/api/v1/events", nil)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET /api/v1/events: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp, bufio.NewReader(resp.Body)
+}
+
+func TestEventsStreamsChanges(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	resp, r := openEventStream(t, server, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d; want 200", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q; want text/event-stream", ct)
+	}
+	// The connected comment means the handler has taken its revision
+	if line, _ := r.ReadString('\n'); line != ": connected\n" {
+		t.Fatalf("first line = %q; want connected comment", line)
+	}
+
+	ctx := context.Background()
+	task, err := server.store.Add(ctx, "Live", "", DueTime{}, "medium")
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	server.store.Delete(ctx, task.ID)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		id, event, data := readEvent(t, r)
+		var change pollChange
+		if err := json.Unmarshal([]byte(data), &change); err != nil {
+			t.Errorf("decode data %q: %v", data, err)
+			return
+		}
+		if id != "1" || event != ChangeCreated || change.Task == nil || change.Task.Title != "Live" {
+			t.Errorf("first event = %s %s %s; want id 1, created, task Live", id, event, data)
+		}
+		id, event, _ = readEvent(t, r)
+		if id != "2" || event != ChangeDeleted {
+			t.Errorf("second event = %s %s; want id 2, deleted", id, event)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("events were not streamed")
+	}
+}
+
+func TestEventsResumeFromLastEventID(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	ctx := context.Background()
+	server.store.Add(ctx, "Before", "", DueTime{}, "medium")
+	server.store.Add(ctx, "Missed", "", DueTime{}, "medium")
+
+	_, r := openEventStream(t, server, http.Header{"Last-Event-Id": {"1"}})
+	id, event, data := readEvent(t, r)
+	if id != "2" || event != ChangeCreated || !strings.Contains(data, "Missed") {
+		t.Errorf("event = %s %s %s; want the missed creation", id, event, data)
+	}
+}
+
+func TestEventsRejectsBadLastEventID(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	req := httptest.NewRequest("GET", "/api/v1/events?since=abc", nil)
+	w := httptest.NewRecorder()
+	server.handleEvents(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d; want 400", w.Code)
+	}
+}
+
+func TestEventsStreamLimit(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.eventStreams = make(chan struct{}, 1)
+	server.eventStreams <- struct{}{}
+
+	req := httptest.NewRequest("GET", "/api/v1/events", nil)
+	w := httptest.NewRecorder()
+	server.handleEvents(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d; want 503", w.Code)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TaskFilter selects tasks for List. Empty fields match every task; each
+// of Statuses, Priorities and Tags matches any of its values. Tags ignore
+// case.
+type TaskFilter struct {
+	Statuses   []string
+	Priorities []string
+	Tags       []string
+	ProjectID  int
+	// Assignee, when set, matches tasks assigned to that user
+	Assignee string
+	// DueBefore and DueAfter are exclusive YYYY-MM-DD bounds on the day a
+	// task is due in Location (UTC if nil); when either is set, tasks
+	// without a due date don't match
+	DueBefore string
+	DueAfter  string
+	Location  *time.Location
+}
+
+// matches reports whether task passes the filter
+func (f TaskFilter) matches(task *Task) bool {
+	if len(f.Statuses) > 0 && !containsString(f.Statuses, task.Status) {
+		return false
+	}
+	if len(f.Priorities) > 0 && !containsString(f.Priorities, task.Priority) {
+		return false
+	}
+	if len(f.Tags) > 0 && !hasAnyTag(task, f.Tags) {
+		return false
+	}
+	if f.ProjectID != 0 && task.ProjectID != f.ProjectID {
+		return false
+	}
+	if f.Assignee != "" && task.Assignee != f.Assignee {
+		return false
+	}
+	if f.DueBefore != "" || f.DueAfter != "" {
+		if task.DueDate.IsZero() {
+			return false
+		}
+		loc := f.Location
+		if loc == nil {
+			loc = time.UTC
+		}
+		day := task.DueDate.Day(loc)
+		if f.DueBefore != "" && day >= f.DueBefore {
+			return false
+		}
+		if f.DueAfter != "" && day <= f.DueAfter {
+			return false
+		}
+	}
+	return true
+}
+
+// containsString reports whether values contains s
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAnyTag reports whether task has at least one of tags
+func hasAnyTag(task *Task, tags []string) bool {
+	for _, tag := range tags {
+		if hasTag(task, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// List returns the tasks matching filter in ID order
+func (ts *TaskStore) List(filter TaskFilter) []*Task {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	tasks := make([]*Task, 0)
+	for _, task := range ts.tasks {
+		if filter.matches(task) {
+			tasks = append(tasks, task)
+		}
+	}
+	sortByID(tasks)
+	return tasks
+}
+
+// parseTaskFilter reads ?status=, ?priority=, ?tag=, ?project_id=,
+// ?assignee=, ?due_before= and ?due_after=, with due days taken in loc.
+// status, priority and tag take comma-separated lists.
+func parseTaskFilter(query url.Values, loc *time.Location) (TaskFilter, error) {
+	filter := TaskFilter{
+		Statuses:   splitList(query.Get("status")),
+		Priorities: splitList(query.Get("priority")),
+		Tags:       splitList(query.Get("tag")),
+		Assignee:   query.Get("assignee"),
+		DueBefore:  query.Get("due_before"),
+		DueAfter:   query.Get("due_after"),
+		Location:   loc,
+	}
+	if raw := query.Get("project_id"); raw != "" {
+		id, err := parseProjectID(raw)
+		if err != nil {
+			return TaskFilter{}, fmt.Errorf("project_id must be a positive integer")
+		}
+		filter.ProjectID = id
+	}
+	for name, value := range map[string]string{"due_before": filter.DueBefore, "due_after": filter.DueAfter} {
+		if value == "" {
+			continue
+		}
+		if _, err := time.Parse(dueDateLayout, value); err != nil {
+			return TaskFilter{}, fmt.Errorf("%s must be a date in YYYY-MM-DD format", name)
+		}
+	}
+	return filter, nil
+}
+
+// splitList splits a comma-separated query value, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestListFilters(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	ctx := context.Background()
+	server.store.Add(ctx, "A", "", dueOn("2024-01-10"), "high")
+	server.store.Add(ctx, "B", "", dueOn("2024-02-10"), "low")
+	server.store.Add(ctx, "C", "", DueTime{}, "high")
+	server.store.Add(ctx, "D", "", dueOn("2024-03-10"), "medium")
+	server.store.Update(ctx, 4, "D", "", dueOn("2024-03-10"), "medium", "completed")
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"?priority=high", "A,C"},
+		{"?priority=high,low", "A,B,C"},
+		{"?status=completed", "D"},
+		{"?status=pending&priority=low", "B"},
+		{"?due_before=2024-02-10", "A"},
+		{"?due_after=2024-01-10", "B,D"},
+		{"?due_after=2024-01-01&due_before=2024-03-01", "A,B"},
+		{"?priority=high&sort=due_date&order=desc", "C,A"},
+	}
+	for _, tt := range tests {
+		titles, w := listTitles(t, server, tt.query)
+		if w.Code != http.StatusOK {
+			t.Errorf("%q: status = %d", tt.query, w.Code)
+			continue
+		}
+		if got := strings.Join(titles, ","); got != tt.want {
+			t.Errorf("%q: got %s; want %s", tt.query, got, tt.want)
+		}
+	}
+
+	if _, w := listTitles(t, server, "?due_before=tomorrow"); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid due_before: status = %d; want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestPendingListKeepsStatusFilter(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	ctx := context.Background()
+	server.store.Add(ctx, "Open", "", DueTime{}, "high")
+	server.store.Add(ctx, "Done", "", DueTime{}, "high")
+	server.store.Update(ctx, 2, "Done", "", DueTime{}, "high", "completed")
+
+	w := httptest.NewRecorder()
+	server.handleGetPendingTasks(w, httptest.NewRequest("GET", "/api/v1/tasks/pending?status=completed&priority=high", nil))
+	var tasks []Task
+	if err := json.NewDecoder(w.Body).Decode(&tasks); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(tasks) != 1 || tasks[0].Title != "Open" {
+		t.Errorf("pending tasks = %+v; want only Open", tasks)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// healthCheckTimeout bounds each dependency check run by /readyz
+const healthCheckTimeout = 2 * time.Second
+
+// HealthChecker is implemented by dependencies that can report readiness
+type HealthChecker interface {
+	Ping(ctx context.Context) error
+}
+
+// healthCheck is a named dependency registered with the server. A failing
+// critical check makes the server unready; a failing non-critical one is
+// reported as degraded.
+type healthCheck struct {
+	name     string
+	checker  HealthChecker
+	critical bool
+}
+
+// RegisterHealthCheck adds a dependency to the readiness check
+func (s *Server) RegisterHealthCheck(name string, checker HealthChecker, critical bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.healthChecks = append(s.healthChecks, healthCheck{name: name, checker: checker, critical: critical})
+}
+
+// Ping checks that the store's backend is usable
+func (ts *TaskStore) Ping(ctx context.Context) error {
+	return ts.storage.Ping(ctx)
+}
+
+// checkReadiness runs all registered checks concurrently, each with its own
+// timeout, and reports per-dependency status and overall readiness
+func (s *Server) checkReadiness(ctx context.Context) (map[string]string, bool) {
+	s.mu.RLock()
+	checks := make([]healthCheck, len(s.healthChecks))
+	copy(checks, s.healthChecks)
+	s.mu.RUnlock()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]string, len(checks))
+	ready := true
+	for _, check := range checks {
+		wg.Add(1)
+		go func(check healthCheck) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			defer cancel()
+
+			status := "ok"
+			if err := pingWithContext(ctx, check.checker); err != nil {
+				status = "degraded"
+				if check.critical {
+					status = "failed"
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			results[check.name] = status
+			if status == "failed" {
+				ready = false
+			}
+		}(check)
+	}
+	wg.Wait()
+	return results, ready
+}
+
+// pingWithContext returns ctx's error if checker doesn't return in time,
+// even when the checker itself ignores cancellation
+func pingWithContext(ctx context.Context, checker HealthChecker) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- checker.Ping(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// handleReadiness reports dependency status, answering 503 when a critical
+// dependency is unavailable
+func (s *Server) handleReadiness(w http.ResponseWriter, r *http.Request) {
+	results, ready := s.checkReadiness(r.Context())
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, results)
+}
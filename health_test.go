@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeDependency is a HealthChecker returning a fixed error after an optional delay
+type fakeDependency struct {
+	err   error
+	delay time.Duration
+}
+
+func (f fakeDependency) Ping(ctx context.Context) error {
+	time.Sleep(f.delay)
+	return f.err
+}
+
+func readiness(t *testing.T, server *Server) (int, map[string]string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	server.handleReadiness(w, httptest.NewRequest("GET", "/readyz", nil))
+	var body map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	return w.Code, body
+}
+
+func TestReadinessAllHealthy(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	code, body := readiness(t, server)
+	if code != http.StatusOK {
+		t.Errorf("status = %d; want %d", code, http.StatusOK)
+	}
+	if body["storage"] != "ok" {
+		t.Errorf("storage = %q; want ok", body["storage"])
+	}
+}
+
+func TestReadinessNonCriticalFailureIsDegraded(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.RegisterHealthCheck("webhook_target", fakeDependency{err: errors.New("unreachable")}, false)
+
+	code, body := readiness(t, server)
+	if code != http.StatusOK {
+		t.Errorf("status = %d; want %d", code, http.StatusOK)
+	}
+	if body["webhook_target"] != "degraded" || body["storage"] != "ok" {
+		t.Errorf("body = %v; want storage ok, webhook_target degraded", body)
+	}
+}
+
+func TestReadinessCriticalFailure(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.RegisterHealthCheck("database", fakeDependency{err: errors.New("connection refused")}, true)
+
+	code, body := readiness(t, server)
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d; want %d", code, http.StatusServiceUnavailable)
+	}
+	if body["database"] != "failed" {
+		t.Errorf("database = %q; want failed", body["database"])
+	}
+}
+
+func TestReadinessTimesOutSlowDependency(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.RegisterHealthCheck("slow", fakeDependency{delay: healthCheckTimeout + time.Second}, true)
+
+	start := time.Now()
+	code, _ := readiness(t, server)
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d; want %d", code, http.StatusServiceUnavailable)
+	}
+	if elapsed := time.Since(start); elapsed > healthCheckTimeout+500*time.Millisecond {
+		t.Errorf("readiness took %v; want about %v", elapsed, healthCheckTimeout)
+	}
+}
+
+func TestStorePingMissingDirectory(t *testing.T) {
+	store := &TaskStore{storage: &jsonBackend{path: "missing-dir/tasks.json"}}
+	if err := store.Ping(context.Background()); err == nil {
+		t.Error("Ping() error = nil; want error for missing directory")
+	}
+}
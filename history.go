@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// maxTaskRevisions is how many revisions are kept per task; older ones are
+// dropped as new ones are added
+const maxTaskRevisions = 50
+
+// ErrRevisionNotFound is returned by Revert for a revision the task's
+// history doesn't have
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// TaskRevision is a task as it was saved at one revision. Revisions count
+// up from 1 per task; every create, update, restore from the trash and
+// revert adds one.
+type TaskRevision struct {
+	Revision int       `json:"revision"`
+	Time     time.Time `json:"time"`
+	// Actor is who made the change, as in the audit log; empty for the
+	// state a task had before its history was first recorded
+	Actor string `json:"actor,omitempty"`
+	Task  *Task  `json:"task"`
+}
+
+// HistoryBackend is implemented by backends that also persist task
+// history. Like ProjectBackend it is optional; on other backends history
+// is kept in memory only and starts empty after a restart.
+type HistoryBackend interface {
+	// LoadHistory returns every stored revision
+	LoadHistory() ([]*TaskRevision, error)
+	// SaveHistory persists the revisions of the tasks in changed. history
+	// is the complete set after the change; a task missing from it has no
+	// history left.
+	SaveHistory(history map[int][]*TaskRevision, changed []int) error
+}
+
+// loadHistory reads the task history from the backend, if it stores it
+func (ts *TaskStore) loadHistory() error {
+	backend, ok := ts.storage.(HistoryBackend)
+	if !ok {
+		return nil
+	}
+	revisions, err := backend.LoadHistory()
+	if err != nil {
+		return fmt.Errorf("load history: %w", err)
+	}
+	for _, rev := range revisions {
+		rev.Task.DueDate = rev.Task.DueDate.resolveSavedDay(ts.dueLocation)
+		ts.history[rev.Task.ID] = append(ts.history[rev.Task.ID], rev)
+	}
+	return nil
+}
+
+// saveHistory persists the history of the given tasks. History is saved
+// after the tasks themselves, so a failure is logged rather than undoing
+// the change. The caller must hold the write lock.
+func (ts *TaskStore) saveHistory(ctx context.Context, changed ...int) {
+	backend, ok := ts.storage.(HistoryBackend)
+	if !ok || len(changed) == 0 {
+		return
+	}
+	_, span := startSpan(ctx, "storage.save_history")
+	defer span.End()
+	err := backend.SaveHistory(ts.history, changed)
+	spanError(span, err)
+	if err != nil {
+		requestLogger(ctx).Error("Failed to save task history", "error", err)
+	}
+}
+
+// recordMutation records a saved mutation in the audit log and, for tasks,
+// in the task's history; purges and store replaces also drop comments.
+// before and after are the record as it was before and after the change,
+// nil where it didn't exist. The caller must hold the write lock.
+func (ts *TaskStore) recordMutation(ctx context.Context, action, kind string, id int, before, after interface{}) {
+	ts.recordAudit(ctx, action, kind, id, before, after)
+	switch kind {
+	case auditTask:
+		b, _ := before.(*Task)
+		a, _ := after.(*Task)
+		ts.recordRevision(ctx, action, id, b, a)
+		if action == AuditPurge {
+			ts.dropComments(ctx, id)
+			ts.deleteAttachmentFiles(ctx, b)
+		}
+	case auditStore:
+		// The tasks were replaced wholesale; their history no longer
+		// applies
+		ids := make([]int, 0, len(ts.history))
+		for taskID := range ts.history {
+			ids = append(ids, taskID)
+		}
+		ts.history = make(map[int][]*TaskRevision)
+		ts.saveHistory(ctx, ids...)
+		ts.dropComments(ctx)
+	}
+}
+
+// recordRevision adds the task's new state to its history, or drops the
+// history of a purged task. Deleting and archiving leave the history as it
+// is. The caller must hold the write lock.
+func (ts *TaskStore) recordRevision(ctx context.Context, action string, id int, before, after *Task) {
+	switch action {
+	case AuditCreate, AuditUpdate, AuditRestore, AuditRevert:
+	case AuditPurge:
+		if _, exists := ts.history[id]; exists {
+			delete(ts.history, id)
+			ts.saveHistory(ctx, id)
+		}
+		return
+	default:
+		return
+	}
+
+	revisions := ts.history[id]
+	// A task saved before history was kept gets its previous state as the
+	// first revision, so the first recorded change can be reverted
+	if len(revisions) == 0 && before != nil {
+		revisions = append(revisions, &TaskRevision{Revision: 1, Time: before.UpdatedAt, Task: taskSnapshot(before)})
+	}
+	next := 1
+	if len(revisions) > 0 {
+		next = revisions[len(revisions)-1].Revision + 1
+	}
+	revisions = append(revisions, &TaskRevision{
+		Revision: next,
+		Time:     after.UpdatedAt,
+		Actor:    auditActor(ctx),
+		Task:     taskSnapshot(after),
+	})
+	if len(revisions) > maxTaskRevisions {
+		revisions = append([]*TaskRevision(nil), revisions[len(revisions)-maxTaskRevisions:]...)
+	}
+	ts.history[id] = revisions
+	ts.saveHistory(ctx, id)
+}
+
+// History returns the kept revisions of a live task, newest first. The bool
+// reports whether the task exists.
+func (ts *TaskStore) History(id int) ([]*TaskRevision, bool) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	if _, exists := ts.tasks[id]; !exists {
+		return nil, false
+	}
+	revisions := ts.history[id]
+	newest := make([]*TaskRevision, len(revisions))
+	for i, rev := range revisions {
+		newest[len(revisions)-1-i] = rev
+	}
+	return newest, true
+}
+
+// Revert puts a task's fields back as they were at revision, which becomes
+// a new revision itself. The ID, creation time, snooze count, blockers and
+// sent reminders are kept. As in RestoreTask, a task whose project was deleted
+// since comes back without a project. Like Update, the bool reports
+// whether the task exists.
+func (ts *TaskStore) Revert(ctx context.Context, id, revision int) (*Task, bool, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	task, exists := ts.tasks[id]
+	if !exists {
+		return nil, false, nil
+	}
+	if err := ts.checkProjectLocked(ctx, task.ProjectID, PermissionEdit); err != nil {
+		return nil, true, err
+	}
+	var target *Task
+	for _, rev := range ts.history[id] {
+		if rev.Revision == revision {
+			target = rev.Task
+		}
+	}
+	if target == nil {
+		return nil, true, ErrRevisionNotFound
+	}
+	if err := ts.checkProjectLocked(ctx, target.ProjectID, PermissionEdit); err != nil {
+		return nil, true, err
+	}
+	// The tag rules may have changed since
+	tags, err := ts.tags.normalize(target.Tags)
+	if err != nil {
+		return nil, true, err
+	}
+
+	prev := *task
+	task.Title = target.Title
+	task.Description = target.Description
+	task.DueDate = target.DueDate
+	task.Priority = target.Priority
+	task.Status = target.Status
+	task.CompletedAt = target.CompletedAt
+	task.Subtasks = target.Subtasks
+	task.Tags = tags
+	task.ProjectID = target.ProjectID
+	if _, exists := ts.projects[task.ProjectID]; task.ProjectID != 0 && !exists {
+		task.ProjectID = 0
+	}
+	task.Recurrence = target.Recurrence
+	task.ReminderOffsets = target.ReminderOffsets
+	task.UpdatedAt = ts.now()
+	if err := ts.save(ctx, id); err != nil {
+		*task = prev
+		return nil, true, fmt.Errorf("save tasks: %w", err)
+	}
+	ts.recordChange(ctx, ChangeUpdated, task)
+	ts.recordMutation(ctx, AuditRevert, auditTask, id, &prev, task)
+	return task, true, nil
+}
+
+// historyEntry is one revision in a GET /tasks/{id}/history response.
+// Changes compares it with the revision before; it is omitted for the
+// oldest kept revision.
+type historyEntry struct {
+	Revision int                    `json:"revision"`
+	Time     time.Time              `json:"time"`
+	Actor    string                 `json:"actor,omitempty"`
+	Changes  map[string]auditChange `json:"changes,omitempty"`
+	Task     publicTask             `json:"task"`
+}
+
+// handleGetHistory lists a task's revisions, newest first
+func (s *Server) handleGetHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := s.parseTaskID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidTaskID, "Invalid task ID")
+		return
+	}
+
+	revisions, exists := s.store.History(id)
+	if !exists {
+		writeError(w, http.StatusNotFound, ErrCodeTaskNotFound, "Task not found")
+		return
+	}
+	entries := make([]historyEntry, len(revisions))
+	for i, rev := range revisions {
+		entries[i] = historyEntry{Revision: rev.Revision, Time: rev.Time, Actor: rev.Actor, Task: s.presentTask(rev.Task)}
+		if i+1 < len(revisions) {
+			entries[i].Changes = auditDiff(revisions[i+1].Task, rev.Task)
+		}
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// handleRevertTask puts a task back to an earlier revision
+func (s *Server) handleRevertTask(w http.ResponseWriter, r *http.Request) {
+	id, err := s.parseTaskID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidTaskID, "Invalid task ID")
+		return
+	}
+	revision, err := strconv.Atoi(mux.Vars(r)["rev"])
+	if err != nil || revision <= 0 {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRevision, "Invalid revision")
+		return
+	}
+
+	task, exists, err := s.store.Revert(r.Context(), id, revision)
+	var verr *validationError
+	switch {
+	case errors.Is(err, ErrRevisionNotFound):
+		writeError(w, http.StatusNotFound, ErrCodeRevisionNotFound, "Revision not found")
+		return
+	case errors.As(err, &verr):
+		writeValidationError(w, err)
+		return
+	case err != nil:
+		writeStoreError(w, err)
+		return
+	case !exists:
+		writeError(w, http.StatusNotFound, ErrCodeTaskNotFound, "Task not found")
+		return
+	}
+	taskOps.Add("revert", 1)
+
+	writeJSON(w, http.StatusOK, s.presentTask(task))
+}
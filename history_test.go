@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTaskHistoryAndRevert(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.TokenHashes = []string{hashString("secret-token")}
+	r, err := server.Router()
+	if err != nil {
+		t.Fatalf("Router() error = %v", err)
+	}
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-API-Token", "secret-token")
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	send("POST", "/api/v1/tasks", `{"title": "Draft", "priority": "low", "tags": ["docs"]}`)
+	send("PUT", "/api/v1/tasks/1", `{"title": "Final", "priority": "high"}`)
+	send("PATCH", "/api/v1/tasks/1", `{"status": "completed"}`)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/tasks/1/history", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("history status = %d; want %d", w.Code, http.StatusOK)
+	}
+	var history []struct {
+		Revision int                    `json:"revision"`
+		Actor    string                 `json:"actor"`
+		Changes  map[string]auditChange `json:"changes"`
+		Task     map[string]interface{} `json:"task"`
+	}
+	json.NewDecoder(w.Body).Decode(&history)
+	if len(history) != 3 || history[0].Revision != 3 || history[2].Revision != 1 {
+		t.Fatalf("history = %+v; want revisions 3 to 1", history)
+	}
+	if change := history[1].Changes["title"]; change.Before != "Draft" || change.After != "Final" {
+		t.Errorf("revision 2 title change = %+v; want Draft to Final", change)
+	}
+	if history[2].Changes != nil || history[2].Task["title"] != "Draft" {
+		t.Errorf("revision 1 = %+v; want Draft without changes", history[2])
+	}
+	if want := "token:" + tokenID(hashString("secret-token")); history[0].Actor != want {
+		t.Errorf("actor = %q; want %q", history[0].Actor, want)
+	}
+
+	w = send("POST", "/api/v1/tasks/1/revert/1", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("revert status = %d; want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	task, _ := server.store.Get(1)
+	if task.Title != "Draft" || task.Priority != "low" || task.Status != "pending" || task.CompletedAt != nil || len(task.Tags) != 1 {
+		t.Errorf("reverted task = %+v; want revision 1", task)
+	}
+	if revisions, _ := server.store.History(1); len(revisions) != 4 || revisions[0].Task.Title != "Draft" {
+		t.Errorf("history after revert = %d revisions; want the revert as revision 4", len(revisions))
+	}
+
+	if w := send("POST", "/api/v1/tasks/1/revert/9", ""); w.Code != http.StatusNotFound {
+		t.Errorf("revert to missing revision status = %d; want %d", w.Code, http.StatusNotFound)
+	}
+	if w := send("POST", "/api/v1/tasks/1/revert/x", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("revert to invalid revision status = %d; want %d", w.Code, http.StatusBadRequest)
+	}
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/tasks/9/history", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("history of missing task status = %d; want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestTaskHistorySurvivesReload(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	ctx := context.Background()
+	server.store.Add(ctx, "Before", "", DueTime{}, "medium")
+	server.store.Update(ctx, 1, "After", "", DueTime{}, "medium", "")
+
+	reloaded := NewTaskStore("test_tasks.json")
+	revisions, _ := reloaded.History(1)
+	if len(revisions) != 2 || revisions[1].Task.Title != "Before" {
+		t.Fatalf("history after reload = %+v; want two revisions", revisions)
+	}
+	if _, _, err := reloaded.Revert(ctx, 1, 1); err != nil {
+		t.Fatalf("Revert() error = %v", err)
+	}
+	if task, _ := reloaded.Get(1); task.Title != "Before" {
+		t.Errorf("title = %q; want Before", task.Title)
+	}
+}
+
+func TestTaskHistoryInSQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.db")
+	ctx := context.Background()
+	store, backend := openTestSQLiteStore(t, path)
+	store.Add(ctx, "Before", "", DueTime{}, "medium")
+	store.Update(ctx, 1, "After", "", DueTime{}, "medium", "")
+	backend.Close()
+
+	reopened, _ := openTestSQLiteStore(t, path)
+	if revisions, _ := reopened.History(1); len(revisions) != 2 || revisions[0].Revision != 2 {
+		t.Errorf("history after reopen = %+v; want revisions 2 and 1", revisions)
+	}
+}
+
+func TestTaskHistoryStartsFromPreviousState(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	ctx := context.Background()
+	server.store.Add(ctx, "Old", "", DueTime{}, "medium")
+	// As for a task saved before history was kept
+	server.store.history = make(map[int][]*TaskRevision)
+
+	server.store.Update(ctx, 1, "New", "", DueTime{}, "medium", "")
+
+	revisions, _ := server.store.History(1)
+	if len(revisions) != 2 || revisions[1].Task.Title != "Old" || revisions[1].Actor != "" {
+		t.Fatalf("history = %+v; want the previous state as revision 1", revisions)
+	}
+}
+
+func TestTaskHistoryLimitAndPurge(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	ctx := context.Background()
+	server.store.Add(ctx, "Edited", "", DueTime{}, "medium")
+	for i := 0; i < maxTaskRevisions+5; i++ {
+		server.store.Update(ctx, 1, "Edited", strings.Repeat("x", i), DueTime{}, "medium", "")
+	}
+
+	revisions, _ := server.store.History(1)
+	if len(revisions) != maxTaskRevisions || revisions[0].Revision != maxTaskRevisions+6 {
+		t.Errorf("history = %d revisions, newest %d; want %d, newest %d", len(revisions), revisions[0].Revision, maxTaskRevisions, maxTaskRevisions+6)
+	}
+	if _, _, err := server.store.Revert(ctx, 1, 1); err != ErrRevisionNotFound {
+		t.Errorf("Revert() to dropped revision error = %v; want ErrRevisionNotFound", err)
+	}
+
+	server.store.Delete(ctx, 1)
+	server.store.PurgeTrashBefore(ctx, time.Now().Add(time.Hour))
+	if _, exists := server.store.history[1]; exists {
+		t.Error("history kept after the task was purged")
+	}
+}
+
+func TestRevertClearsDeletedProject(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	ctx := context.Background()
+	project, _ := server.store.AddProject(ctx, "Gone", "")
+	server.store.AddTask(ctx, Task{Title: "Moved", ProjectID: project.ID})
+	server.store.Patch(ctx, 1, map[string]string{"project_id": ""})
+	server.store.DeleteProject(ctx, project.ID)
+
+	task, _, err := server.store.Revert(ctx, 1, 1)
+	if err != nil {
+		t.Fatalf("Revert() error = %v", err)
+	}
+	if task.ProjectID != 0 {
+		t.Errorf("project_id = %d; want 0", task.ProjectID)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// idAlphabet is shuffled per salt to form the digits of obfuscated IDs
+const idAlphabet = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// errInvalidID is returned when an obfuscated ID can't be decoded
+var errInvalidID = errors.New("invalid id")
+
+// idCodec reversibly maps task IDs to short opaque strings, hashid-style.
+// IDs are permuted with a salt-keyed Feistel network so consecutive IDs
+// don't look consecutive, then written in base 62 over a salt-shuffled
+// alphabet. It hides counts from casual inspection; it is not encryption.
+type idCodec struct {
+	alphabet string
+	keys     [4]uint16
+}
+
+// newIDCodec derives the permutation keys and alphabet from salt
+func newIDCodec(salt string) *idCodec {
+	sum := sha256.Sum256([]byte(salt))
+	c := &idCodec{}
+	for i := range c.keys {
+		c.keys[i] = binary.BigEndian.Uint16(sum[i*2:])
+	}
+
+	// Deterministic shuffle; math/rand is fine since this isn't a secret
+	letters := []byte(idAlphabet)
+	rng := rand.New(rand.NewSource(int64(binary.BigEndian.Uint64(sum[8:])))) //nolint:gosec
+	rng.Shuffle(len(letters), func(i, j int) {
+		letters[i], letters[j] = letters[j], letters[i]
+	})
+	c.alphabet = string(letters)
+	return c
+}
+
+// round is the Feistel round function
+func round(half, key uint16) uint16 {
+	x := uint32(half)*0x9E37 + uint32(key)
+	return uint16(x ^ x>>7)
+}
+
+// permute applies the keyed permutation to a 32-bit value
+func (c *idCodec) permute(v uint32) uint32 {
+	l, r := uint16(v>>16), uint16(v)
+	for _, k := range c.keys {
+		l, r = r, l^round(r, k)
+	}
+	return uint32(l)<<16 | uint32(r)
+}
+
+// unpermute reverses permute
+func (c *idCodec) unpermute(v uint32) uint32 {
+	l, r := uint16(v>>16), uint16(v)
+	for i := len(c.keys) - 1; i >= 0; i-- {
+		l, r = r^round(l, c.keys[i]), l
+	}
+	return uint32(l)<<16 | uint32(r)
+}
+
+// encodeID returns the opaque form of a positive task ID
+func (c *idCodec) encodeID(id int) string {
+	v := c.permute(uint32(id))
+	base := uint32(len(c.alphabet))
+	var buf [6]byte // 62^6 > 2^32
+	i := len(buf)
+	for {
+		i--
+		buf[i] = c.alphabet[v%base]
+		v /= base
+		if v == 0 {
+			break
+		}
+	}
+	return string(buf[i:])
+}
+
+// decodeID reverses encodeID, rejecting strings that encodeID would never
+// produce
+func (c *idCodec) decodeID(s string) (int, error) {
+	if s == "" || len(s) > 6 {
+		return 0, errInvalidID
+	}
+	var v uint64
+	for i := 0; i < len(s); i++ {
+		digit := strings.IndexByte(c.alphabet, s[i])
+		if digit < 0 {
+			return 0, errInvalidID
+		}
+		v = v*uint64(len(c.alphabet)) + uint64(digit)
+	}
+	if v > 1<<32-1 {
+		return 0, errInvalidID
+	}
+	id := int(c.unpermute(uint32(v)))
+	if id <= 0 || c.encodeID(id) != s {
+		return 0, errInvalidID
+	}
+	return id, nil
+}
+
+// publicTask is a task as shown to API clients. Its ID and BlockedBy
+// fields shadow the embedded integer ones in JSON, holding either the plain
+// integers or, when IDs are obfuscated, the encoded strings.
+type publicTask struct {
+	ID        interface{}   `json:"id"`
+	BlockedBy []interface{} `json:"blocked_by,omitempty"`
+	// TrackedSeconds is the time tracked on the task, running timers
+	// included
+	TrackedSeconds int64 `json:"tracked_seconds,omitempty"`
+	*Task
+}
+
+// parseTaskID reads the {id} path parameter, decoding it when IDs are
+// obfuscated
+func (s *Server) parseTaskID(r *http.Request) (int, error) {
+	return s.decodeTaskID(mux.Vars(r)["id"])
+}
+
+// decodeTaskID converts an ID as clients see it back to the stored ID
+func (s *Server) decodeTaskID(raw string) (int, error) {
+	if s.ids != nil {
+		return s.ids.decodeID(raw)
+	}
+	return strconv.Atoi(raw)
+}
+
+// decodeTaskIDs converts a JSON list of task IDs, each a number or, when
+// IDs are obfuscated, a string, back to stored IDs
+func (s *Server) decodeTaskIDs(raw []json.RawMessage) ([]int, error) {
+	ids := make([]int, len(raw))
+	for i, r := range raw {
+		id, err := s.decodeTaskID(strings.Trim(string(r), `"`))
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// formatID returns the task ID as clients see it
+func (s *Server) formatID(id int) string {
+	if s.ids != nil {
+		return s.ids.encodeID(id)
+	}
+	return strconv.Itoa(id)
+}
+
+// presentTask prepares a task for a response body
+func (s *Server) presentTask(task *Task) publicTask {
+	public := publicTask{ID: s.publicID(task.ID), Task: task, TrackedSeconds: int64(trackedTime(task, s.now()).Seconds())}
+	for _, id := range task.BlockedBy {
+		public.BlockedBy = append(public.BlockedBy, s.publicID(id))
+	}
+	return public
+}
+
+// publicID is a task ID as it appears in JSON: the integer, or its encoded
+// string when IDs are obfuscated
+func (s *Server) publicID(id int) interface{} {
+	if s.ids == nil {
+		return id
+	}
+	return s.ids.encodeID(id)
+}
+
+// presentTasks prepares a task list for a response body
+func (s *Server) presentTasks(tasks []*Task) []publicTask {
+	public := make([]publicTask, len(tasks))
+	for i, task := range tasks {
+		public[i] = s.presentTask(task)
+	}
+	return public
+}
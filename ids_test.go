@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestIDCodecRoundTrip(t *testing.T) {
+	codec := newIDCodec("pepper")
+	seen := make(map[string]bool)
+	for _, id := range []int{1, 2, 3, 42, 1000, 65535, 65536, 1 << 20, 1<<31 - 1} {
+		encoded := codec.encodeID(id)
+		if len(encoded) > 6 {
+			t.Errorf("encodeID(%d) = %q; want at most 6 characters", id, encoded)
+		}
+		if seen[encoded] {
+			t.Errorf("encodeID(%d) = %q collides with another ID", id, encoded)
+		}
+		seen[encoded] = true
+
+		decoded, err := codec.decodeID(encoded)
+		if err != nil || decoded != id {
+			t.Errorf("decodeID(encodeID(%d)) = %d, %v; want %d", id, decoded, err, id)
+		}
+	}
+}
+
+func TestIDCodecSaltChangesEncoding(t *testing.T) {
+	a, b := newIDCodec("salt-a"), newIDCodec("salt-b")
+	if a.encodeID(1) == b.encodeID(1) {
+		t.Error("different salts produced the same encoding")
+	}
+	if id, err := b.decodeID(a.encodeID(1)); err == nil && id == 1 {
+		t.Error("ID encoded with one salt decoded with another")
+	}
+}
+
+func TestIDCodecRejectsGarbage(t *testing.T) {
+	codec := newIDCodec("pepper")
+	for _, s := range []string{"", "?", "a-b", "toolongvalue"} {
+		if id, err := codec.decodeID(s); err == nil {
+			t.Errorf("decodeID(%q) = %d; want error", s, id)
+		}
+	}
+}
+
+func TestObfuscatedIDsInResponses(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.ids = newIDCodec("pepper")
+	task, _ := server.store.Add(context.Background(), "Secret count", "", DueTime{}, "medium")
+	publicID := server.ids.encodeID(task.ID)
+
+	w := httptest.NewRecorder()
+	server.handleGetTasks(w, httptest.NewRequest("GET", "/api/v1/tasks", nil))
+	var tasks []map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&tasks); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(tasks) != 1 || tasks[0]["id"] != publicID {
+		t.Errorf("listed id = %v; want %q", tasks[0]["id"], publicID)
+	}
+
+	req := mux.SetURLVars(httptest.NewRequest("GET", "/api/v1/tasks/"+publicID, nil), map[string]string{"id": publicID})
+	w = httptest.NewRecorder()
+	server.handleGetTask(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("GET by obfuscated id status = %d; want %d", w.Code, http.StatusOK)
+	}
+
+	req = mux.SetURLVars(httptest.NewRequest("GET", "/api/v1/tasks/1", nil), map[string]string{"id": "1"})
+	w = httptest.NewRecorder()
+	server.handleGetTask(w, req)
+	if w.Code == http.StatusOK {
+		t.Error("GET by raw integer id succeeded with obfuscation enabled")
+	}
+}
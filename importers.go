@@ -0,0 +1,462 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// importBatch is what an import adapter makes of another app's export:
+// projects to create and tasks to add. A task's ProjectID is the 1-based
+// index of its project in Projects, or 0 for none, until the batch is
+// imported.
+type importBatch struct {
+	Projects []Project
+	Tasks    []Task
+}
+
+// importAdapters parse exports from other apps, by ?format= name. Dates
+// without a zone are read in loc.
+var importAdapters = map[string]func(data []byte, loc *time.Location) (*importBatch, error){
+	"todoist": parseTodoistExport,
+	"trello":  parseTrelloExport,
+}
+
+// importFormats returns the names of the import adapters, sorted
+func importFormats() []string {
+	formats := make([]string, 0, len(importAdapters))
+	for name := range importAdapters {
+		formats = append(formats, name)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// importTag turns a label or list name into a valid tag: commas become
+// spaces and long names are cut to maxTagLength
+func importTag(name string) string {
+	tag := []rune(strings.TrimSpace(strings.ReplaceAll(name, ",", " ")))
+	if len(tag) > maxTagLength {
+		tag = tag[:maxTagLength]
+	}
+	return strings.TrimSpace(string(tag))
+}
+
+// importDate reads a due date or date-time, taking those without a zone
+// in loc. A value that only starts with a date is due at the end of that
+// day; anything else is no due date.
+func importDate(value string, loc *time.Location) DueTime {
+	if due, err := parseDueDate(value, loc); err == nil {
+		return due
+	}
+	if t, err := time.ParseInLocation("2006-01-02T15:04:05", value, loc); err == nil {
+		return DueTime{t}
+	}
+	if len(value) < len(dueDateLayout) {
+		return DueTime{}
+	}
+	day, err := time.Parse(dueDateLayout, value[:len(dueDateLayout)])
+	if err != nil {
+		return DueTime{}
+	}
+	return dueAtEndOfDay(day, loc)
+}
+
+// flexibleID is an ID that some exports write as a number and others as a
+// string
+type flexibleID string
+
+func (id *flexibleID) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		*id = ""
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*id = flexibleID(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("ID must be a string or number")
+	}
+	*id = flexibleID(n.String())
+	return nil
+}
+
+// flexibleBool is a flag that some exports write as 0 or 1
+type flexibleBool bool
+
+func (b *flexibleBool) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case "true", "1":
+		*b = true
+	case "false", "0", "null":
+		*b = false
+	default:
+		return fmt.Errorf("flag must be a boolean, 0 or 1")
+	}
+	return nil
+}
+
+// todoistExport is the part of a Todoist Sync API export that is imported
+type todoistExport struct {
+	Projects []struct {
+		ID        flexibleID   `json:"id"`
+		Name      string       `json:"name"`
+		IsDeleted flexibleBool `json:"is_deleted"`
+	} `json:"projects"`
+	Items []struct {
+		ID          flexibleID   `json:"id"`
+		Content     string       `json:"content"`
+		Description string       `json:"description"`
+		ProjectID   flexibleID   `json:"project_id"`
+		ParentID    flexibleID   `json:"parent_id"`
+		Priority    int          `json:"priority"`
+		Checked     flexibleBool `json:"checked"`
+		IsDeleted   flexibleBool `json:"is_deleted"`
+		Labels      []string     `json:"labels"`
+		Due         *struct {
+			Date string `json:"date"`
+		} `json:"due"`
+	} `json:"items"`
+}
+
+// todoistPriorities maps Todoist priorities, where 4 is the most urgent
+// (p1) and 1 the default, to task priorities
+var todoistPriorities = map[int]string{4: "high", 3: "medium", 2: "low", 1: "low"}
+
+// parseTodoistExport maps Todoist projects to projects and items to
+// tasks. Sub-items become subtasks of their top-level item.
+func parseTodoistExport(data []byte, loc *time.Location) (*importBatch, error) {
+	var export todoistExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, err
+	}
+	if export.Projects == nil && export.Items == nil {
+		return nil, errors.New("no projects or items; expected a Todoist Sync API export")
+	}
+
+	batch := &importBatch{}
+	projects := make(map[flexibleID]int)
+	for _, p := range export.Projects {
+		if p.IsDeleted {
+			continue
+		}
+		batch.Projects = append(batch.Projects, Project{Name: p.Name})
+		projects[p.ID] = len(batch.Projects)
+	}
+
+	tasks := make(map[flexibleID]int)
+	for _, item := range export.Items {
+		if item.IsDeleted || item.ParentID != "" {
+			continue
+		}
+		task := Task{
+			Title:       item.Content,
+			Description: item.Description,
+			Priority:    todoistPriorities[item.Priority],
+			Status:      "pending",
+			ProjectID:   projects[item.ProjectID],
+		}
+		if task.Priority == "" {
+			task.Priority = "medium"
+		}
+		if item.Checked {
+			task.Status = "completed"
+		}
+		if item.Due != nil {
+			task.DueDate = importDate(item.Due.Date, loc)
+		}
+		for _, label := range item.Labels {
+			if tag := importTag(label); tag != "" {
+				task.Tags = append(task.Tags, tag)
+			}
+		}
+		batch.Tasks = append(batch.Tasks, task)
+		tasks[item.ID] = len(batch.Tasks) - 1
+	}
+
+	// Sub-items of sub-items are attached to the top-level item
+	parents := make(map[flexibleID]flexibleID)
+	for _, item := range export.Items {
+		if item.ParentID != "" {
+			parents[item.ID] = item.ParentID
+		}
+	}
+	for _, item := range export.Items {
+		if item.IsDeleted || item.ParentID == "" {
+			continue
+		}
+		root := item.ParentID
+		for depth := 0; parents[root] != "" && depth < len(export.Items); depth++ {
+			root = parents[root]
+		}
+		if i, ok := tasks[root]; ok {
+			batch.Tasks[i].Subtasks = append(batch.Tasks[i].Subtasks, Subtask{Title: item.Content, Done: bool(item.Checked)})
+		}
+	}
+	return batch, nil
+}
+
+// trelloExport is the part of a Trello board's JSON export that is
+// imported
+type trelloExport struct {
+	Name  string `json:"name"`
+	Desc  string `json:"desc"`
+	Lists []struct {
+		ID     string `json:"id"`
+		Name   string `json:"name"`
+		Closed bool   `json:"closed"`
+	} `json:"lists"`
+	Cards []struct {
+		ID          string  `json:"id"`
+		Name        string  `json:"name"`
+		Desc        string  `json:"desc"`
+		IDList      string  `json:"idList"`
+		Due         *string `json:"due"`
+		DueComplete bool    `json:"dueComplete"`
+		Closed      bool    `json:"closed"`
+		Labels      []struct {
+			Name  string `json:"name"`
+			Color string `json:"color"`
+		} `json:"labels"`
+	} `json:"cards"`
+	Checklists []struct {
+		IDCard     string `json:"idCard"`
+		CheckItems []struct {
+			Name  string `json:"name"`
+			State string `json:"state"`
+		} `json:"checkItems"`
+	} `json:"checklists"`
+}
+
+// trelloListStatuses gives the status of cards in lists with these names,
+// ignoring case; cards in other lists are pending
+var trelloListStatuses = map[string]string{
+	"done":        "completed",
+	"completed":   "completed",
+	"complete":    "completed",
+	"finished":    "completed",
+	"doing":       "in_progress",
+	"in progress": "in_progress",
+	"in-progress": "in_progress",
+	"wip":         "in_progress",
+}
+
+// parseTrelloExport maps a Trello board to a project and its open cards
+// to tasks. A card's list becomes a tag and, for lists such as "Doing" and
+// "Done", its status; labels become tags and checklist items subtasks.
+// Archived lists and cards are skipped.
+func parseTrelloExport(data []byte, loc *time.Location) (*importBatch, error) {
+	var export trelloExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, err
+	}
+	if export.Name == "" || export.Lists == nil {
+		return nil, errors.New("no board name or lists; expected a Trello board export")
+	}
+
+	batch := &importBatch{Projects: []Project{{Name: export.Name, Description: export.Desc}}}
+	lists := make(map[string]string)
+	for _, list := range export.Lists {
+		if !list.Closed {
+			lists[list.ID] = list.Name
+		}
+	}
+
+	cards := make(map[string]int)
+	for _, card := range export.Cards {
+		list, open := lists[card.IDList]
+		if card.Closed || !open {
+			continue
+		}
+		task := Task{
+			Title:       card.Name,
+			Description: card.Desc,
+			Priority:    "medium",
+			Status:      "pending",
+			ProjectID:   1,
+		}
+		if status, ok := trelloListStatuses[strings.ToLower(strings.TrimSpace(list))]; ok {
+			task.Status = status
+		}
+		if card.DueComplete {
+			task.Status = "completed"
+		}
+		if card.Due != nil {
+			task.DueDate = importDate(*card.Due, loc)
+		}
+		if tag := importTag(list); tag != "" {
+			task.Tags = append(task.Tags, tag)
+		}
+		for _, label := range card.Labels {
+			name := label.Name
+			if name == "" {
+				name = label.Color
+			}
+			if tag := importTag(name); tag != "" {
+				task.Tags = append(task.Tags, tag)
+			}
+		}
+		batch.Tasks = append(batch.Tasks, task)
+		cards[card.ID] = len(batch.Tasks) - 1
+	}
+
+	for _, checklist := range export.Checklists {
+		i, ok := cards[checklist.IDCard]
+		if !ok {
+			continue
+		}
+		for _, item := range checklist.CheckItems {
+			batch.Tasks[i].Subtasks = append(batch.Tasks[i].Subtasks, Subtask{Title: item.Name, Done: item.State == "complete"})
+		}
+	}
+	return batch, nil
+}
+
+// ImportBatch creates the batch's projects and adds its tasks, with the
+// checks and all-or-nothing behavior of ImportTasks. Projects are saved
+// first; if the tasks then can't be saved the projects are removed again.
+func (ts *TaskStore) ImportBatch(ctx context.Context, batch *importBatch, dryRun bool) ([]*Project, []*Task, map[int]error, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Add the projects so that the tasks' project checks pass, then take
+	// them out again unless everything is saved
+	if !dryRun {
+		if err := ts.reserveIDsLocked(ctx, ProjectIDs, len(batch.Projects), &ts.nextProjectID); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	now := ts.now()
+	firstProjectID := ts.nextProjectID
+	projects := make([]*Project, len(batch.Projects))
+	projectIDs := make([]int, len(batch.Projects))
+	for i, p := range batch.Projects {
+		projects[i] = &Project{ID: firstProjectID + i, Name: p.Name, Description: p.Description, CreatedAt: now, UpdatedAt: now}
+		projectIDs[i] = projects[i].ID
+		ts.projects[projects[i].ID] = projects[i]
+	}
+	ts.nextProjectID += len(projects)
+	removeProjects := func() {
+		for _, p := range projects {
+			delete(ts.projects, p.ID)
+		}
+		ts.nextProjectID = firstProjectID
+	}
+
+	fields := make([]Task, len(batch.Tasks))
+	for i, task := range batch.Tasks {
+		fields[i] = task
+		if task.ProjectID != 0 {
+			fields[i].ProjectID = firstProjectID + task.ProjectID - 1
+		}
+	}
+	if _, rowErrs, err := ts.importTasksLocked(ctx, fields, true); err != nil || len(rowErrs) > 0 || dryRun {
+		removeProjects()
+		return nil, nil, rowErrs, err
+	}
+
+	if len(projects) > 0 {
+		if err := ts.saveProjects(ctx, projectIDs...); err != nil {
+			removeProjects()
+			return nil, nil, nil, fmt.Errorf("save projects: %w", err)
+		}
+	}
+	tasks, _, err := ts.importTasksLocked(ctx, fields, false)
+	if err != nil {
+		removeProjects()
+		if len(projects) > 0 {
+			if saveErr := ts.saveProjects(ctx, projectIDs...); saveErr != nil {
+				requestLogger(ctx).Error("Failed to remove imported projects", "error", saveErr)
+			}
+		}
+		return nil, nil, nil, err
+	}
+	for _, project := range projects {
+		ts.recordMutation(ctx, AuditCreate, auditProject, project.ID, nil, project)
+	}
+	return projects, tasks, nil, nil
+}
+
+// importItemError is a problem with one task of an import
+type importItemError struct {
+	Title string `json:"title"`
+	Error string `json:"error"`
+}
+
+// handleImportFrom imports another app's export, chosen with ?format=.
+// Like the CSV import, nothing is imported if any task is invalid, and
+// ?dry_run=true only checks the export.
+func (s *Server) handleImportFrom(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	parse, ok := importAdapters[format]
+	if !ok {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidQuery, "format must be one of: "+strings.Join(importFormats(), ", "))
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxImportSize))
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, ErrCodeArchiveTooLarge, "Export too large")
+		return
+	}
+	batch, err := parse(data, s.requestLocation(r))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidExport, "Invalid "+format+" export: "+err.Error())
+		return
+	}
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	projects, tasks, rowErrs, err := s.store.ImportBatch(r.Context(), batch, dryRun)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if len(rowErrs) > 0 {
+		indexes := make([]int, 0, len(rowErrs))
+		for i := range rowErrs {
+			indexes = append(indexes, i)
+		}
+		sort.Ints(indexes)
+		errs := make([]importItemError, len(indexes))
+		for j, i := range indexes {
+			errs[j] = importItemError{Title: batch.Tasks[i].Title, Error: importErrorMessage(rowErrs[i])}
+		}
+		writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"error":  "Some tasks are invalid; nothing was imported",
+			"code":   ErrCodeValidation,
+			"status": http.StatusUnprocessableEntity,
+			"errors": errs,
+		})
+		return
+	}
+
+	if dryRun {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"format":   format,
+			"dry_run":  true,
+			"projects": len(batch.Projects),
+			"imported": len(batch.Tasks),
+		})
+		return
+	}
+	taskOps.Add("create", int64(len(tasks)))
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"format":   format,
+		"dry_run":  false,
+		"projects": len(projects),
+		"imported": len(tasks),
+	})
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const todoistExportJSON = `{
+  "projects": [
+    {"id": "220474322", "name": "Inbox"},
+    {"id": 220474323, "name": "Work"},
+    {"id": "1", "name": "Gone", "is_deleted": true}
+  ],
+  "items": [
+    {"id": "1", "content": "Ship release", "description": "v2", "project_id": 220474323, "priority": 4,
+     "labels": ["release", "a,b"], "due": {"date": "2030-02-03T10:00:00"}},
+    {"id": "2", "content": "Write notes", "project_id": "220474323", "parent_id": "1", "checked": 1},
+    {"id": "3", "content": "Proofread", "project_id": "220474323", "parent_id": "2", "checked": false},
+    {"id": "4", "content": "Buy milk", "project_id": "220474322", "priority": 1, "checked": true}
+  ]
+}`
+
+const trelloExportJSON = `{
+  "name": "Launch", "desc": "Launch board",
+  "lists": [
+    {"id": "l1", "name": "To Do"},
+    {"id": "l2", "name": "Doing"},
+    {"id": "l3", "name": "Done"},
+    {"id": "l4", "name": "Old", "closed": true}
+  ],
+  "cards": [
+    {"id": "c1", "name": "Design", "idList": "l2", "due": "2030-04-05T12:00:00.000Z",
+     "labels": [{"name": "ux", "color": "green"}, {"name": "", "color": "red"}]},
+    {"id": "c2", "name": "Plan", "idList": "l3"},
+    {"id": "c3", "name": "Archived", "idList": "l1", "closed": true},
+    {"id": "c4", "name": "In closed list", "idList": "l4"},
+    {"id": "c5", "name": "Announce", "idList": "l1", "dueComplete": true}
+  ],
+  "checklists": [
+    {"idCard": "c1", "checkItems": [{"name": "Sketch", "state": "complete"}, {"name": "Review", "state": "incomplete"}]}
+  ]
+}`
+
+func TestParseTodoistExport(t *testing.T) {
+	batch, err := parseTodoistExport([]byte(todoistExportJSON), time.UTC)
+	if err != nil {
+		t.Fatalf("parseTodoistExport() error = %v", err)
+	}
+	if len(batch.Projects) != 2 || len(batch.Tasks) != 2 {
+		t.Fatalf("batch = %+v; want 2 projects and 2 top-level tasks", batch)
+	}
+	ship := batch.Tasks[0]
+	if ship.ProjectID != 2 || ship.Priority != "high" || ship.DueDate.Day(time.UTC) != "2030-02-03" || strings.Join(ship.Tags, "|") != "release|a b" {
+		t.Errorf("first task = %+v", ship)
+	}
+	if len(ship.Subtasks) != 2 || !ship.Subtasks[0].Done || ship.Subtasks[1].Title != "Proofread" {
+		t.Errorf("subtasks = %+v; want both sub-items, the nested one included", ship.Subtasks)
+	}
+	if milk := batch.Tasks[1]; milk.Status != "completed" || milk.ProjectID != 1 || milk.Priority != "low" {
+		t.Errorf("second task = %+v", milk)
+	}
+	if _, err := parseTodoistExport([]byte(`{"name": "board"}`), time.UTC); err == nil {
+		t.Error("parseTodoistExport() accepted JSON that isn't a Todoist export")
+	}
+}
+
+func TestParseTrelloExport(t *testing.T) {
+	batch, err := parseTrelloExport([]byte(trelloExportJSON), time.UTC)
+	if err != nil {
+		t.Fatalf("parseTrelloExport() error = %v", err)
+	}
+	if len(batch.Projects) != 1 || batch.Projects[0].Name != "Launch" || len(batch.Tasks) != 3 {
+		t.Fatalf("batch = %+v; want the board and its 3 open cards", batch)
+	}
+	design := batch.Tasks[0]
+	if design.Status != "in_progress" || design.DueDate.Day(time.UTC) != "2030-04-05" || strings.Join(design.Tags, "|") != "Doing|ux|red" || len(design.Subtasks) != 2 {
+		t.Errorf("first task = %+v", design)
+	}
+	if batch.Tasks[1].Status != "completed" || batch.Tasks[2].Status != "completed" {
+		t.Errorf("statuses %q, %q; want cards in Done and with a completed due date completed", batch.Tasks[1].Status, batch.Tasks[2].Status)
+	}
+}
+
+func TestImportFromEndpoint(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.TokenHashes = []string{hashString("secret-token")}
+	r, _ := server.Router()
+	post := func(query, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/v1/import"+query, strings.NewReader(body))
+		req.Header.Set("X-API-Token", "secret-token")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := post("?format=asana", "{}"); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "todoist, trello") {
+		t.Errorf("unknown format: status %d, body %s", w.Code, w.Body.String())
+	}
+	if w := post("?format=trello", todoistExportJSON); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), ErrCodeInvalidExport) {
+		t.Errorf("Todoist export as trello: status %d, body %s", w.Code, w.Body.String())
+	}
+
+	if w := post("?format=trello&dry_run=true", trelloExportJSON); w.Code != http.StatusOK || len(server.store.Projects()) != 0 {
+		t.Errorf("dry run: status %d, %d projects stored", w.Code, len(server.store.Projects()))
+	}
+
+	w := post("?format=trello", trelloExportJSON)
+	var resp struct{ Projects, Imported int }
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusCreated || resp.Projects != 1 || resp.Imported != 3 {
+		t.Fatalf("import: status %d, body %s", w.Code, w.Body.String())
+	}
+	project := server.store.Projects()[0]
+	task, _ := server.store.Get(1)
+	if task.ProjectID != project.ID || len(task.Subtasks) != 2 || task.Subtasks[1].ID != 2 {
+		t.Errorf("imported task = %+v; want it in project %d with numbered subtasks", task, project.ID)
+	}
+
+	// A task the store rejects stops the whole import, projects included
+	server.store.tags.max = 1
+	w = post("?format=todoist", todoistExportJSON)
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "Ship release") {
+		t.Errorf("import with too many tags: status %d, body %s", w.Code, w.Body.String())
+	}
+	if len(server.store.Projects()) != 1 || len(server.store.GetAll()) != 3 {
+		t.Errorf("rejected import left %d projects and %d tasks; want 1 and 3", len(server.store.Projects()), len(server.store.GetAll()))
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import "strings"
+
+// trigramIndex maps every three-rune sequence of a task's lowercased title,
+// description and tags to the tasks containing it. Any substring query of three
+// or more runes can only match tasks that contain all of its trigrams, so
+// searches check a few candidates instead of every task.
+type trigramIndex struct {
+	postings map[string]map[int]struct{}
+	grams    map[int][]string
+}
+
+// newTrigramIndex returns an index of tasks
+func newTrigramIndex(tasks map[int]*Task) *trigramIndex {
+	ix := &trigramIndex{
+		postings: make(map[string]map[int]struct{}),
+		grams:    make(map[int][]string),
+	}
+	for _, task := range tasks {
+		ix.add(task)
+	}
+	return ix
+}
+
+// searchText is the text indexed for a task. The NUL separator keeps
+// trigrams from spanning fields, and can't appear in a query.
+func searchText(task *Task) string {
+	fields := append([]string{task.Title, task.Description}, task.Tags...)
+	return strings.ToLower(strings.Join(fields, "\x00"))
+}
+
+// trigrams returns the distinct three-rune sequences of s
+func trigrams(s string) []string {
+	runes := []rune(s)
+	seen := make(map[string]bool)
+	var grams []string
+	for i := 0; i+3 <= len(runes); i++ {
+		gram := string(runes[i : i+3])
+		if !seen[gram] {
+			seen[gram] = true
+			grams = append(grams, gram)
+		}
+	}
+	return grams
+}
+
+// add indexes task, replacing any previous entry for its ID
+func (ix *trigramIndex) add(task *Task) {
+	ix.remove(task.ID)
+	grams := trigrams(searchText(task))
+	for _, gram := range grams {
+		ids := ix.postings[gram]
+		if ids == nil {
+			ids = make(map[int]struct{})
+			ix.postings[gram] = ids
+		}
+		ids[task.ID] = struct{}{}
+	}
+	ix.grams[task.ID] = grams
+}
+
+// remove drops the task with the given ID from the index
+func (ix *trigramIndex) remove(id int) {
+	for _, gram := range ix.grams[id] {
+		delete(ix.postings[gram], id)
+		if len(ix.postings[gram]) == 0 {
+			delete(ix.postings, gram)
+		}
+	}
+	delete(ix.grams, id)
+}
+
+// candidates returns the IDs of tasks that may contain the normalized
+// query. ok is false when the query is too short to narrow the search.
+func (ix *trigramIndex) candidates(query string) (ids []int, ok bool) {
+	grams := trigrams(query)
+	if len(grams) == 0 {
+		return nil, false
+	}
+	// Intersect starting from the rarest trigram
+	smallest := grams[0]
+	for _, gram := range grams[1:] {
+		if len(ix.postings[gram]) < len(ix.postings[smallest]) {
+			smallest = gram
+		}
+	}
+	for id := range ix.postings[smallest] {
+		inAll := true
+		for _, gram := range grams {
+			if _, found := ix.postings[gram][id]; !found {
+				inAll = false
+				break
+			}
+		}
+		if inAll {
+			ids = append(ids, id)
+		}
+	}
+	return ids, true
+}
+
+// searchCandidatesLocked returns, in ID order, the tasks that may match
+// query: the index's candidates, or every task for short queries. Callers
+// still check each task. The caller must hold a lock.
+func (ts *TaskStore) searchCandidatesLocked(query string) []*Task {
+	var tasks []*Task
+	ids, ok := []int(nil), false
+	if ts.index != nil {
+		ids, ok = ts.index.candidates(normalizeQuery(query))
+	}
+	if ok {
+		tasks = make([]*Task, 0, len(ids))
+		for _, id := range ids {
+			tasks = append(tasks, ts.tasks[id])
+		}
+	} else {
+		tasks = make([]*Task, 0, len(ts.tasks))
+		for _, task := range ts.tasks {
+			tasks = append(tasks, task)
+		}
+	}
+	sortByID(tasks)
+	return tasks
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestTrigramIndexCandidates(t *testing.T) {
+	ix := newTrigramIndex(map[int]*Task{
+		1: {ID: 1, Title: "Invoice ACME", Description: "due friday"},
+		2: {ID: 2, Title: "Call accounting", Description: "About the acme invoice"},
+		3: {ID: 3, Title: "Groceries"},
+	})
+
+	tests := []struct {
+		query  string
+		want   []int
+		wantOK bool
+	}{
+		{"acme", []int{1, 2}, true},
+		{"groc", []int{3}, true},
+		{"zzz", nil, true},
+		{"ac", nil, false},
+	}
+	for _, tt := range tests {
+		got, ok := ix.candidates(tt.query)
+		sort.Ints(got)
+		if ok != tt.wantOK || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("candidates(%q) = %v, %v; want %v, %v", tt.query, got, ok, tt.want, tt.wantOK)
+		}
+	}
+
+	// Trigrams don't span the title/description boundary
+	if got, _ := ix.candidates("acmedue"); len(got) != 0 {
+		t.Errorf("candidates spanning fields = %v; want none", got)
+	}
+
+	ix.add(&Task{ID: 3, Title: "ACME groceries"})
+	ix.remove(1)
+	got, _ := ix.candidates("acme")
+	sort.Ints(got)
+	if !reflect.DeepEqual(got, []int{2, 3}) {
+		t.Errorf("candidates after update = %v; want [2 3]", got)
+	}
+}
+
+func TestSearchIndexFollowsStoreChanges(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	ctx := context.Background()
+	first, _ := server.store.Add(ctx, "Write report", "", DueTime{}, "medium")
+	server.store.Add(ctx, "Read mail", "", DueTime{}, "medium")
+
+	if results := server.store.SearchAll("report"); len(results) != 1 {
+		t.Fatalf("SearchAll(report) = %d results; want 1", len(results))
+	}
+	server.store.Update(ctx, first.ID, "Write summary", "", DueTime{}, "medium", "")
+	if results := server.store.SearchAll("report"); len(results) != 0 {
+		t.Errorf("SearchAll(report) after rename = %d results; want 0", len(results))
+	}
+	if tasks := server.store.Search("summary"); len(tasks) != 1 {
+		t.Errorf("Search(summary) = %d tasks; want 1", len(tasks))
+	}
+	server.store.Delete(ctx, first.ID)
+	if tasks := server.store.Search("summary"); len(tasks) != 0 {
+		t.Errorf("Search(summary) after delete = %d tasks; want 0", len(tasks))
+	}
+
+	if err := server.store.Replace(ctx, []*Task{{ID: 5, Title: "Imported report"}}); err != nil {
+		t.Fatalf("Replace() error = %v", err)
+	}
+	if tasks := server.store.Search("report"); len(tasks) != 1 || tasks[0].ID != 5 {
+		t.Errorf("Search(report) after import = %v; want task 5", tasks)
+	}
+}
+
+func BenchmarkSearchAll(b *testing.B) {
+	store := NewTaskStore("test_bench_tasks.json")
+	store.storage = &memoryBackend{rows: map[int]Task{}}
+	ctx := context.Background()
+	for i := 0; i < 5000; i++ {
+		store.Add(ctx, fmt.Sprintf("Task %d quarterly planning", i), fmt.Sprintf("notes %d", i), DueTime{}, "medium")
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		store.SearchAll("4242")
+	}
+}
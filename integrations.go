@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// EventTaskOverdue is sent to integrations once a task's due time passes
+// while it is still open. Webhooks don't receive it.
+const EventTaskOverdue = "task.overdue"
+
+// integrationEvents lists the events an integration can post
+var integrationEvents = []string{EventTaskCreated, EventTaskCompleted, EventTaskOverdue}
+
+// integrationKinds are the chat services an integration can post to
+var integrationKinds = []string{"slack", "discord"}
+
+// overdueNotifyWindow is how recently a task must have become overdue to
+// be posted, so that enabling an integration doesn't post every task that
+// was overdue long before
+const overdueNotifyWindow = 24 * time.Hour
+
+// defaultIntegrationTemplates are the messages posted for each event when
+// an integration has no template of its own
+var defaultIntegrationTemplates = map[string]string{
+	EventTaskCreated:   `New task in {{.Project}}: {{.Task.Title}}{{with .Due}} (due {{.}}){{end}}`,
+	EventTaskCompleted: `Completed in {{.Project}}: {{.Task.Title}}`,
+	EventTaskOverdue:   `Overdue in {{.Project}}: {{.Task.Title}} was due {{.Due}}`,
+}
+
+// Integration posts the task events of one project to a Slack or Discord
+// incoming webhook
+type Integration struct {
+	ID        int    `json:"id"`
+	ProjectID int    `json:"project_id"`
+	Kind      string `json:"kind"`
+	// URL is the incoming webhook URL. It grants posting to the channel, so
+	// it is only shown when the integration is created.
+	URL string `json:"url,omitempty"`
+	// Events filters the posts; empty means every integration event
+	Events []string `json:"events,omitempty"`
+	// Templates maps events to Go text/template messages replacing the
+	// defaults
+	Templates map[string]string `json:"templates,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// wants reports whether the integration posts event
+func (in Integration) wants(event string) bool {
+	return len(in.Events) == 0 || containsString(in.Events, event)
+}
+
+// integrationMessage is what message templates are executed with
+type integrationMessage struct {
+	Event string
+	Task  *Task
+	// Project is the project's name
+	Project string
+	// Due is the task's due date written out in the server's time zone, or
+	// "" without one
+	Due string
+}
+
+// parseTemplate parses the integration's template for event, or the
+// default one
+func (in Integration) parseTemplate(event string) (*template.Template, error) {
+	text, ok := in.Templates[event]
+	if !ok {
+		text = defaultIntegrationTemplates[event]
+	}
+	return template.New(event).Parse(text)
+}
+
+// validateIntegration checks an integration's kind, URL, events and
+// templates; errors are *validationError
+func validateIntegration(in Integration) error {
+	if !containsString(integrationKinds, in.Kind) {
+		return &validationError{code: ErrCodeValidation, message: "kind must be slack or discord"}
+	}
+	u, err := url.Parse(in.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return &validationError{code: ErrCodeValidation, message: "url must be an absolute http or https URL"}
+	}
+	for _, event := range in.Events {
+		if !containsString(integrationEvents, event) {
+			return &validationError{
+				code:    ErrCodeValidation,
+				message: fmt.Sprintf("Unknown event %q (want one of %s)", event, strings.Join(integrationEvents, ", ")),
+			}
+		}
+	}
+	for event := range in.Templates {
+		if !containsString(integrationEvents, event) {
+			return &validationError{code: ErrCodeValidation, message: fmt.Sprintf("Template for unknown event %q", event)}
+		}
+		if _, err := in.parseTemplate(event); err != nil {
+			return &validationError{code: ErrCodeValidation, message: fmt.Sprintf("Invalid template for %s: %v", event, err)}
+		}
+	}
+	return nil
+}
+
+// validateIntegrations checks the integrations in the config
+func validateIntegrations(integrations []Integration) error {
+	for _, in := range integrations {
+		if err := validateIntegration(in); err != nil {
+			return fmt.Errorf("invalid integration %d: %w", in.ID, err)
+		}
+	}
+	return nil
+}
+
+// integrations returns a copy of the configured integrations
+func (s *Server) integrations() []Integration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Integration(nil), s.config.Integrations...)
+}
+
+// dispatchIntegrations posts event for task to every integration of the
+// task's project that wants it. Like webhook deliveries, posts run
+// concurrently and are retried.
+func (s *Server) dispatchIntegrations(ctx context.Context, event string, task *Task) {
+	if task == nil || task.ProjectID == 0 || !containsString(integrationEvents, event) {
+		return
+	}
+	msg := integrationMessage{Event: event, Task: task, Due: formatEmailDue(task.DueDate, s.location)}
+	if project, exists := s.store.GetProject(task.ProjectID); exists {
+		msg.Project = project.Name
+	}
+	for _, in := range s.integrations() {
+		if in.ProjectID != task.ProjectID || !in.wants(event) {
+			continue
+		}
+		body, err := in.render(msg)
+		if err != nil {
+			slog.Error("Rendering integration message failed", "integration_id", in.ID, "event", event, "error", err)
+			continue
+		}
+		go func(in Integration) {
+			attempts, err := retryDelivery(ctx, func() error { return postIntegration(ctx, in.URL, body) })
+			if err != nil {
+				slog.Warn("Integration post failed", "integration_id", in.ID, "event", event, "attempts", attempts, "error", err)
+			}
+		}(in)
+	}
+}
+
+// render builds the JSON body posting msg: Slack takes the text in "text",
+// Discord in "content"
+func (in Integration) render(msg integrationMessage) ([]byte, error) {
+	tmpl, err := in.parseTemplate(msg.Event)
+	if err != nil {
+		return nil, err
+	}
+	var text bytes.Buffer
+	if err := tmpl.Execute(&text, msg); err != nil {
+		return nil, err
+	}
+	field := "text"
+	if in.Kind == "discord" {
+		field = "content"
+	}
+	return json.Marshal(map[string]string{field: text.String()})
+}
+
+// postIntegration makes one post attempt; any non-2xx response is a
+// failure
+func postIntegration(ctx context.Context, hookURL string, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, notifierTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", hookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("integration returned %s", resp.Status)
+	}
+	return nil
+}
+
+// NewlyOverdue returns open tasks in a project whose due time passed in
+// the window before now and that haven't been posted as overdue. Posting is
+// recorded like a reminder at offset 0 with MarkReminderSent.
+func (ts *TaskStore) NewlyOverdue(now time.Time, window time.Duration) []Task {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	var tasks []Task
+	for _, task := range ts.tasks {
+		if task.Status == "completed" || task.ProjectID == 0 || task.DueDate.IsZero() {
+			continue
+		}
+		if task.DueDate.After(now) || !task.DueDate.After(now.Add(-window)) || reminderSent(task, 0, ts.dueLocation) {
+			continue
+		}
+		tasks = append(tasks, *task)
+	}
+	return tasks
+}
+
+// postOverdue posts every newly overdue task to its project's
+// integrations, if any of them want task.overdue
+func (s *Server) postOverdue(ctx context.Context) {
+	projects := make(map[int]bool)
+	for _, in := range s.integrations() {
+		if in.wants(EventTaskOverdue) {
+			projects[in.ProjectID] = true
+		}
+	}
+	if len(projects) == 0 {
+		return
+	}
+	for _, task := range s.store.NewlyOverdue(s.now(), overdueNotifyWindow) {
+		if !projects[task.ProjectID] {
+			continue
+		}
+		task := task
+		s.dispatchIntegrations(ctx, EventTaskOverdue, &task)
+		if err := s.store.MarkReminderSent(ctx, Reminder{Task: task, DueAt: task.DueDate.Time}); err != nil {
+			slog.Error("Recording overdue post failed", "task_id", task.ID, "error", err)
+		}
+	}
+}
+
+// runOverdueScanner posts newly overdue tasks on every tick of interval
+// until ctx is cancelled
+func (s *Server) runOverdueScanner(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.postOverdue(ctx)
+		}
+	}
+}
+
+// integrationRequest is the body of an integration registration
+type integrationRequest struct {
+	Kind      string            `json:"kind"`
+	URL       string            `json:"url"`
+	Events    []string          `json:"events"`
+	Templates map[string]string `json:"templates"`
+}
+
+// projectForIntegrations parses the project ID in the path and checks the
+// project exists, writing the error response if not
+func (s *Server) projectForIntegrations(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := parseProjectID(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidProjectID, "Invalid project ID")
+		return 0, false
+	}
+	if _, exists := s.store.GetProject(id); !exists {
+		writeError(w, http.StatusNotFound, ErrCodeProjectNotFound, "Project not found")
+		return 0, false
+	}
+	return id, true
+}
+
+// handleGetIntegrations lists a project's integrations without their URLs
+func (s *Server) handleGetIntegrations(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := s.projectForIntegrations(w, r)
+	if !ok {
+		return
+	}
+	integrations := make([]Integration, 0)
+	for _, in := range s.integrations() {
+		if in.ProjectID == projectID {
+			in.URL = ""
+			integrations = append(integrations, in)
+		}
+	}
+	writeJSON(w, http.StatusOK, integrations)
+}
+
+// handleCreateIntegration adds an integration to a project
+func (s *Server) handleCreateIntegration(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := s.projectForIntegrations(w, r)
+	if !ok {
+		return
+	}
+	var req integrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	in := Integration{
+		ProjectID: projectID,
+		Kind:      req.Kind,
+		URL:       req.URL,
+		Events:    req.Events,
+		Templates: req.Templates,
+		CreatedAt: s.now(),
+	}
+	if err := validateIntegration(in); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	s.mu.Lock()
+	in.ID = 1
+	for _, existing := range s.config.Integrations {
+		if existing.ID >= in.ID {
+			in.ID = existing.ID + 1
+		}
+	}
+	prev := s.config.Integrations
+	s.config.Integrations = append(append([]Integration(nil), prev...), in)
+	if err := SaveConfig(s.config); err != nil {
+		s.config.Integrations = prev
+		s.mu.Unlock()
+		writeError(w, http.StatusInternalServerError, ErrCodeSaveFailed, "Failed to save integration")
+		return
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusCreated, in)
+}
+
+// handleDeleteIntegration removes an integration from a project
+func (s *Server) handleDeleteIntegration(w http.ResponseWriter, r *http.Request) {
+	projectID, ok := s.projectForIntegrations(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(mux.Vars(r)["iid"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidQuery, "Invalid integration ID")
+		return
+	}
+
+	s.mu.Lock()
+	prev := s.config.Integrations
+	remaining := make([]Integration, 0, len(prev))
+	for _, in := range prev {
+		if in.ID != id || in.ProjectID != projectID {
+			remaining = append(remaining, in)
+		}
+	}
+	if len(remaining) == len(prev) {
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, ErrCodeIntegrationNotFound, "Integration not found")
+		return
+	}
+	s.config.Integrations = remaining
+	if err := SaveConfig(s.config); err != nil {
+		s.config.Integrations = prev
+		s.mu.Unlock()
+		writeError(w, http.StatusInternalServerError, ErrCodeSaveFailed, "Failed to save integrations")
+		return
+	}
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
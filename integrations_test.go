@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIntegrations(t *testing.T) {
+	receiver := &webhookReceiver{}
+	hook := httptest.NewServer(receiver)
+	defer hook.Close()
+
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	defer os.Remove("config.json")
+	server.location = time.UTC
+	server.config.TokenHashes = []string{hashString("secret-token")}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	website, _ := server.store.AddProject(ctx, "Website", "")
+	r, err := server.Router()
+	if err != nil {
+		t.Fatal(err)
+	}
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-API-Token", "secret-token")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("POST", "/api/v1/projects/1/integrations", `{"kind": "slack", "url": "`+hook.URL+`", "events": ["task.created", "task.completed"], "templates": {"task.completed": "Done: {{.Task.Title}} :tada:"}}`)
+	if w.Code != http.StatusCreated || !strings.Contains(w.Body.String(), hook.URL) {
+		t.Fatalf("create slack: status %d: %s", w.Code, w.Body.String())
+	}
+	if w := send("POST", "/api/v1/projects/1/integrations", `{"kind": "discord", "url": "`+hook.URL+`/discord", "events": ["task.overdue"]}`); w.Code != http.StatusCreated {
+		t.Fatalf("create discord: status %d: %s", w.Code, w.Body.String())
+	}
+	for _, body := range []string{
+		`{"kind": "teams", "url": "https://example.com"}`,
+		`{"kind": "slack", "url": "https://example.com", "events": ["task.deleted"]}`,
+		`{"kind": "slack", "url": "https://example.com", "templates": {"task.created": "{{.Task"}}`,
+	} {
+		if w := send("POST", "/api/v1/projects/1/integrations", body); w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("create %s: status %d; want 422", body, w.Code)
+		}
+	}
+	if w := send("POST", "/api/v1/projects/9/integrations", `{"kind": "slack", "url": "https://example.com"}`); w.Code != http.StatusNotFound {
+		t.Errorf("create on a missing project: status %d; want 404", w.Code)
+	}
+
+	w = send("GET", "/api/v1/projects/1/integrations", "")
+	var listed []Integration
+	json.NewDecoder(w.Body).Decode(&listed)
+	if len(listed) != 2 || listed[0].URL != "" || listed[1].Kind != "discord" {
+		t.Errorf("integrations = %+v; want both without URLs", listed)
+	}
+
+	go server.dispatchWebhooksSince(ctx, server.store.Revision(), map[int]string{})
+	server.store.Add(ctx, "Elsewhere", "", DueTime{}, "high")
+	task, _ := server.store.AddTask(ctx, Task{Title: "Launch", Priority: "high", ProjectID: website.ID})
+	server.store.Update(ctx, task.ID, task.Title, "", DueTime{}, task.Priority, "in_progress")
+	server.store.Update(ctx, task.ID, task.Title, "", DueTime{}, task.Priority, "completed")
+	receiver.waitFor(t, 2)
+	receiver.mu.Lock()
+	posts := []string{string(receiver.bodies[0]), string(receiver.bodies[1])}
+	receiver.mu.Unlock()
+	if posts[0] > posts[1] {
+		posts[0], posts[1] = posts[1], posts[0]
+	}
+	want := []string{`{"text":"Done: Launch :tada:"}`, `{"text":"New task in Website: Launch"}`}
+	if strings.TrimSpace(posts[0]) != want[0] || strings.TrimSpace(posts[1]) != want[1] {
+		t.Errorf("slack posts = %q; want %q", posts, want)
+	}
+
+	// Overdue tasks are posted once, to the integrations that want them
+	now := time.Now()
+	server.now = func() time.Time { return now }
+	server.store.AddTask(ctx, Task{Title: "Renew domain", Priority: "medium", ProjectID: website.ID, DueDate: DueTime{now.Add(-time.Hour)}})
+	server.store.AddTask(ctx, Task{Title: "Long overdue", Priority: "medium", ProjectID: website.ID, DueDate: DueTime{now.Add(-48 * time.Hour)}})
+	server.postOverdue(ctx)
+	server.postOverdue(ctx)
+	// Two more created posts to Slack and one overdue post to Discord
+	receiver.waitFor(t, 5)
+	time.Sleep(50 * time.Millisecond)
+	receiver.mu.Lock()
+	var overdue []string
+	for i, req := range receiver.deliveries {
+		if req.URL.Path == "/discord" {
+			overdue = append(overdue, string(receiver.bodies[i]))
+		}
+	}
+	receiver.mu.Unlock()
+	if len(overdue) != 1 || !strings.Contains(overdue[0], `"content":"Overdue in Website: Renew domain was due`) {
+		t.Errorf("overdue posts = %q; want one to discord", overdue)
+	}
+
+	if w := send("DELETE", "/api/v1/projects/1/integrations/2", ""); w.Code != http.StatusNoContent {
+		t.Errorf("delete: status %d", w.Code)
+	}
+	if w := send("DELETE", "/api/v1/projects/1/integrations/2", ""); w.Code != http.StatusNotFound {
+		t.Errorf("second delete: status %d; want 404", w.Code)
+	}
+}
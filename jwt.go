@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// defaultJWTTTL is how long issued JWTs last when Config.JWTTTLMinutes is unset
+const defaultJWTTTL = 24 * time.Hour
+
+// jwtHeader is the encoded header of every JWT the server issues. Tokens
+// with any other header are rejected, which rules out "alg": "none" and
+// algorithm confusion.
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// Errors from parseJWT
+var (
+	errJWTMalformed = errors.New("malformed jwt")
+	errJWTSignature = errors.New("invalid jwt signature")
+	errJWTExpired   = errors.New("jwt expired")
+)
+
+// jwtClaims are the claims of an issued JWT. Scopes decide access and are
+// at most those of Role.
+type jwtClaims struct {
+	Subject   string   `json:"sub"`
+	Role      string   `json:"role"`
+	Scopes    []string `json:"scopes"`
+	IssuedAt  int64    `json:"iat"`
+	ExpiresAt int64    `json:"exp"`
+}
+
+// signJWT encodes claims as an HS256 JWT signed with key
+func signJWT(key []byte, claims jwtClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	unsigned := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + jwtSignature(key, unsigned), nil
+}
+
+// jwtSignature returns the encoded HMAC-SHA256 of the header and payload
+func jwtSignature(key []byte, unsigned string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// parseJWT verifies token's signature and expiry at now and returns its
+// claims
+func parseJWT(key []byte, token string, now time.Time) (jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != jwtHeader {
+		return jwtClaims{}, errJWTMalformed
+	}
+	want := jwtSignature(key, parts[0]+"."+parts[1])
+	if !hmac.Equal([]byte(parts[2]), []byte(want)) {
+		return jwtClaims{}, errJWTSignature
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return jwtClaims{}, errJWTMalformed
+	}
+	var claims jwtClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return jwtClaims{}, errJWTMalformed
+	}
+	if _, ok := roleRanks[claims.Role]; !ok || claims.Subject == "" {
+		return jwtClaims{}, errJWTMalformed
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return claims, errJWTExpired
+	}
+	return claims, nil
+}
+
+// jwtTTL returns how long issued JWTs last
+func (c *Config) jwtTTL() time.Duration {
+	if c.JWTTTLMinutes > 0 {
+		return time.Duration(c.JWTTTLMinutes) * time.Minute
+	}
+	return defaultJWTTTL
+}
+
+// issueJWT returns a new JWT for role with a random subject, limited to
+// scopes unless that is nil
+func issueJWT(config *Config, role string, scopes []string, now time.Time) (string, jwtClaims, error) {
+	if scopes == nil {
+		scopes = roleScopes(role)
+	}
+	subject, err := generateToken()
+	if err != nil {
+		return "", jwtClaims{}, err
+	}
+	claims := jwtClaims{
+		// A short subject is enough to tell tokens apart in logs
+		Subject:   "tok_" + subject[:16],
+		Role:      role,
+		Scopes:    scopes,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(config.jwtTTL()).Unix(),
+	}
+	token, err := signJWT([]byte(config.JWTSecret), claims)
+	return token, claims, err
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseJWT(t *testing.T) {
+	key := []byte("secret")
+	now := time.Unix(1700000000, 0)
+	claims := jwtClaims{Subject: "tok_1", Role: RoleEditor, Scopes: roleScopes(RoleEditor), IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix()}
+	token, err := signJWT(key, claims)
+	if err != nil {
+		t.Fatalf("signJWT() error = %v", err)
+	}
+
+	got, err := parseJWT(key, token, now)
+	if err != nil || got.Subject != "tok_1" || got.Role != RoleEditor {
+		t.Fatalf("parseJWT() = %+v, %v; want the signed claims", got, err)
+	}
+	if _, err := parseJWT([]byte("other"), token, now); err != errJWTSignature {
+		t.Errorf("wrong key: error = %v; want %v", err, errJWTSignature)
+	}
+	if _, err := parseJWT(key, token, now.Add(2*time.Hour)); err != errJWTExpired {
+		t.Errorf("after expiry: error = %v; want %v", err, errJWTExpired)
+	}
+
+	// Changing the role in the payload breaks the signature
+	parts := strings.Split(token, ".")
+	forged, _ := json.Marshal(jwtClaims{Subject: "tok_1", Role: RoleAdmin, ExpiresAt: claims.ExpiresAt})
+	parts[1] = base64.RawURLEncoding.EncodeToString(forged)
+	if _, err := parseJWT(key, strings.Join(parts, "."), now); err != errJWTSignature {
+		t.Errorf("forged payload: error = %v; want %v", err, errJWTSignature)
+	}
+
+	// An unsigned token is rejected whatever it claims
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`))
+	if _, err := parseJWT(key, none+"."+parts[1]+".", now); err != errJWTMalformed {
+		t.Errorf("alg none: error = %v; want %v", err, errJWTMalformed)
+	}
+}
+
+func TestJWTTokens(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.JWTSecret = "test-secret"
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	server.now = func() time.Time { return now }
+	r, err := server.Router()
+	if err != nil {
+		t.Fatalf("Router() error = %v", err)
+	}
+
+	do := func(method, path, body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		if token != "" {
+			req.Header.Set("X-API-Token", token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("POST", "/api/v1/auth/token", "", "")
+	var issued map[string]string
+	json.NewDecoder(w.Body).Decode(&issued)
+	if w.Code != http.StatusCreated || issued["role"] != RoleEditor || strings.Count(issued["token"], ".") != 2 {
+		t.Fatalf("issue: status %d, body %v; want an editor JWT", w.Code, issued)
+	}
+	if issued["expires_at"] != "2024-01-11T12:00:00Z" {
+		t.Errorf("expires_at = %q; want a day later", issued["expires_at"])
+	}
+	if len(server.config.TokenHashes) != 0 {
+		t.Errorf("TokenHashes = %v; JWTs should not be stored", server.config.TokenHashes)
+	}
+
+	if w := do("POST", "/api/v1/tasks", `{"title":"With JWT"}`, issued["token"]); w.Code != http.StatusCreated {
+		t.Errorf("create with JWT: status %d; want 201", w.Code)
+	}
+	if w := do("POST", "/api/v1/auth/token", `{"role":"admin"}`, issued["token"]); w.Code != http.StatusForbidden {
+		t.Errorf("admin JWT from editor: status %d; want 403", w.Code)
+	}
+
+	admin, _, _ := issueJWT(server.config, RoleAdmin, nil, now)
+	if w := do("GET", "/api/v1/admin/config", "", admin); w.Code != http.StatusOK {
+		t.Errorf("admin config with admin JWT: status %d; want 200", w.Code)
+	}
+
+	now = now.Add(25 * time.Hour)
+	w = do("POST", "/api/v1/tasks", `{"title":"Too late"}`, issued["token"])
+	var body struct {
+		Code string `json:"code"`
+	}
+	json.NewDecoder(w.Body).Decode(&body)
+	if w.Code != http.StatusUnauthorized || body.Code != ErrCodeTokenExpired {
+		t.Errorf("expired JWT: status %d, code %q; want 401 %s", w.Code, body.Code, ErrCodeTokenExpired)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"expvar"
+	"net/http"
+	"strings"
+)
+
+// inFlightRequests is the number of requests currently counted against
+// Config.MaxConcurrentRequests, published at /debug/vars when debug
+// endpoints are enabled
+var inFlightRequests = expvar.NewInt("in_flight_requests")
+
+// limitExempt reports whether a request bypasses the concurrency limit, so
+// that health probes and metrics keep answering while the server is busy.
+// Event streams and sync connections stay open indefinitely and have their
+// own cap (Config.MaxEventStreams).
+func limitExempt(path string) bool {
+	return path == "/health" || path == "/readyz" || path == "/api/v1/events" || path == "/api/v1/ws" || strings.HasPrefix(path, "/debug/")
+}
+
+// concurrencyLimitMiddleware rejects requests with 503 and Retry-After once
+// Config.MaxConcurrentRequests are already being served. A limit of 0 or
+// less disables it.
+func (s *Server) concurrencyLimitMiddleware(next http.Handler) http.Handler {
+	if s.config.MaxConcurrentRequests <= 0 {
+		return next
+	}
+	slots := make(chan struct{}, s.config.MaxConcurrentRequests)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if limitExempt(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		select {
+		case slots <- struct{}{}:
+		default:
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusServiceUnavailable, ErrCodeServerBusy, "Too many concurrent requests")
+			return
+		}
+		inFlightRequests.Add(1)
+		defer func() {
+			inFlightRequests.Add(-1)
+			<-slots
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
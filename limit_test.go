@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestConcurrencyLimitRejectsWhenSaturated(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.MaxConcurrentRequests = 2
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	blocking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			entered <- struct{}{}
+			<-release
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := server.concurrencyLimitMiddleware(blocking)
+
+	done := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		go func() {
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/v1/tasks", nil))
+			done <- struct{}{}
+		}()
+		<-entered
+	}
+	if got := inFlightRequests.Value(); got != 2 {
+		t.Errorf("in_flight_requests = %d; want 2", got)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/tasks", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d; want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Retry-After header missing")
+	}
+
+	// Probes bypass the limit
+	probe := httptest.NewRecorder()
+	handler.ServeHTTP(probe, httptest.NewRequest("GET", "/health", nil))
+	if probe.Code != http.StatusOK {
+		t.Errorf("/health status = %d; want %d", probe.Code, http.StatusOK)
+	}
+
+	close(release)
+	<-done
+	<-done
+	if got := inFlightRequests.Value(); got != 0 {
+		t.Errorf("in_flight_requests after release = %d; want 0", got)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// requestIDHeader carries a request's ID. A client or proxy may send
+	// its own, which is used if valid; the response always has one.
+	requestIDHeader = "X-Request-ID"
+	// maxRequestIDLength bounds client-supplied request IDs
+	maxRequestIDLength = 64
+)
+
+// Log formats for Config.LogFormat
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+// validateLogFormat rejects unknown log formats
+func validateLogFormat(format string) error {
+	if format != "" && format != LogFormatJSON && format != LogFormatText {
+		return fmt.Errorf("unknown log_format %q (want %s or %s)", format, LogFormatJSON, LogFormatText)
+	}
+	return nil
+}
+
+// newLogger returns a logger writing to w in format (JSON by default)
+func newLogger(format string, w io.Writer) *slog.Logger {
+	if format == LogFormatText {
+		return slog.New(slog.NewTextHandler(w, nil))
+	}
+	return slog.New(slog.NewJSONHandler(w, nil))
+}
+
+// requestIDKey is the context key for the request ID
+type requestIDKey struct{}
+
+// withRequestID returns ctx carrying the request ID id
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// requestID returns the ID of the request ctx belongs to, or "" outside a
+// request
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestLogger returns the default logger, tagged with the request ID if
+// ctx belongs to a request
+func requestLogger(ctx context.Context) *slog.Logger {
+	if id := requestID(ctx); id != "" {
+		return slog.Default().With("request_id", id)
+	}
+	return slog.Default()
+}
+
+// newRequestID returns a random 16 character hex ID
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%016x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// validRequestID reports whether a client-supplied request ID is safe to
+// echo and log: short, and only letters, digits, '-', '_' and '.'
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	return strings.IndexFunc(id, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.')
+	}) < 0
+}
+
+// statusRecorder remembers the status code and size of a response. Unwrap
+// lets http.ResponseController reach the underlying writer, so streaming
+// and WebSocket upgrades keep working.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// loggingMiddleware gives every request an ID, available to handlers
+// through requestID and returned in the X-Request-ID header, and writes an
+// access log entry once the request is done. It runs outside every other
+// middleware so rejected requests are logged too.
+func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		r = r.WithContext(withRequestID(r.Context(), id))
+		span := trace.SpanFromContext(r.Context())
+		span.SetAttributes(attribute.String("taskmate.request_id", id))
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		status := rec.status
+		switch {
+		case status == 0 && strings.EqualFold(r.Header.Get("Upgrade"), "websocket"):
+			// The connection was hijacked; the upgrade wrote its own status
+			status = http.StatusSwitchingProtocols
+		case status == 0:
+			status = http.StatusOK
+		}
+		level := slog.LevelInfo
+		if status >= 500 {
+			level = slog.LevelError
+		}
+		attrs := []slog.Attr{
+			slog.String("request_id", id),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", status),
+			slog.Int("bytes", rec.bytes),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("remote_ip", s.clientIP(r)),
+		}
+		if sc := span.SpanContext(); sc.HasTraceID() {
+			attrs = append(attrs, slog.String("trace_id", sc.TraceID().String()))
+		}
+		slog.LogAttrs(r.Context(), level, "request", attrs...)
+	})
+}
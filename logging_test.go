@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// captureLogs sends the default logger's output to a buffer until the test
+// ends
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(newLogger(LogFormatJSON, &buf))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+func TestRequestIDAndAccessLog(t *testing.T) {
+	logs := captureLogs(t)
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	r, _ := server.Router()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/tasks/999", nil))
+	id := w.Header().Get(requestIDHeader)
+	if !validRequestID(id) {
+		t.Fatalf("%s = %q; want a generated ID", requestIDHeader, id)
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+		t.Fatalf("access log %q is not one JSON entry: %v", logs.String(), err)
+	}
+	want := map[string]interface{}{
+		"msg": "request", "request_id": id, "method": "GET", "path": "/api/v1/tasks/999", "status": float64(http.StatusNotFound),
+	}
+	for key, value := range want {
+		if entry[key] != value {
+			t.Errorf("access log %s = %v; want %v", key, entry[key], value)
+		}
+	}
+	if _, ok := entry["duration_ms"].(float64); !ok {
+		t.Errorf("access log has no duration_ms: %v", entry)
+	}
+
+	// A valid ID from the client is kept; anything else is replaced
+	tests := map[string]bool{"edge-7f3a.1": true, "bad id\n": false, strings.Repeat("a", maxRequestIDLength+1): false}
+	for sent, kept := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/health", nil)
+		req.Header.Set(requestIDHeader, sent)
+		r.ServeHTTP(w, req)
+		if got := w.Header().Get(requestIDHeader); (got == sent) != kept || got == "" {
+			t.Errorf("sent %q: %s = %q; want kept %v", sent, requestIDHeader, got, kept)
+		}
+	}
+}
+
+func TestValidateLogFormat(t *testing.T) {
+	for _, format := range []string{"", LogFormatJSON, LogFormatText} {
+		if err := validateLogFormat(format); err != nil {
+			t.Errorf("validateLogFormat(%q) error = %v", format, err)
+		}
+	}
+	if err := validateLogFormat("xml"); err == nil {
+		t.Error("validateLogFormat accepted xml")
+	}
+}
@@ -1,32 +1,76 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
 	"log"
+	"log/slog"
 	"net/http"
+	"net/smtp"
 	"os"
-	"strconv"
+	"os/signal"
+	"sort"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Task represents a pending task
 type Task struct {
-	ID          int       `json:"id"`
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	DueDate     string    `json:"due_date"`
-	Priority    string    `json:"priority"`
-	Status      string    `json:"status"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          int        `json:"id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	DueDate     DueTime    `json:"due_date"`
+	Priority    string     `json:"priority"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	SnoozeCount int        `json:"snooze_count,omitempty"`
+	Subtasks    []Subtask  `json:"subtasks,omitempty"`
+	// Attachments are the files uploaded to the task, oldest first
+	Attachments []Attachment `json:"attachments,omitempty"`
+	Tags        []string     `json:"tags,omitempty"`
+	// ProjectID is the project the task belongs to; 0 means none
+	ProjectID int `json:"project_id,omitempty"`
+	// Assignee is the user the task is assigned to, named as in the audit
+	// log ("token:<id>" or "user:<subject>"); empty means unassigned
+	Assignee string `json:"assignee,omitempty"`
+	// BlockedBy lists the tasks that must be completed before this one can
+	// be, by ID
+	BlockedBy []int `json:"blocked_by,omitempty"`
+	// Recurrence makes completing the task create its next occurrence;
+	// see parseRecurrence for the accepted values
+	Recurrence string `json:"recurrence,omitempty"`
+	// ReminderOffsets are the minutes before the due date at which to send
+	// reminders, largest first; empty uses the configured window
+	ReminderOffsets []int `json:"reminder_offsets,omitempty"`
+	// RemindersSent records sent reminders as "due_date/offset"
+	RemindersSent []string `json:"reminders_sent,omitempty"`
+	// DeletedAt is when the task was moved to the trash; nil for live tasks
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// ArchivedAt is when the completed task was moved to the archive
+	ArchivedAt *time.Time `json:"archived_at,omitempty"`
+	// TimeEntries are the spans of time tracked on the task, oldest first
+	TimeEntries []TimeEntry `json:"time_entries,omitempty"`
+	// Position orders the task within its status column on the board,
+	// from 1; 0 puts it after the positioned tasks
+	Position int `json:"position,omitempty"`
+	// Version counts the saves of the task and is its ETag
+	Version int `json:"version"`
 }
 
 // Config holds application configuration
@@ -34,17 +78,234 @@ type Config struct {
 	APIKey      string   `json:"api_key"`
 	Port        string   `json:"port"`
 	TokenHashes []string `json:"token_hashes"`
+	TimeZone    string   `json:"time_zone,omitempty"`
+	// UserTimeZones maps callers, named as in the audit log ("token:<id>"
+	// or "user:<subject>"), to the IANA time zone their dates are in when
+	// a request doesn't send X-Time-Zone
+	UserTimeZones map[string]string `json:"user_time_zones,omitempty"`
+	// TokenRoles maps token hashes to "viewer", "editor" or "admin"; a
+	// token without an entry is an admin
+	TokenRoles map[string]string `json:"token_roles,omitempty"`
+	// TokenScopes limits tokens issued with explicit scopes to those scopes;
+	// other tokens have every scope of their role
+	TokenScopes map[string][]string `json:"token_scopes,omitempty"`
+	// TokenMetadata holds the label, creation, last use and expiry time of
+	// tokens by hash
+	TokenMetadata map[string]TokenMetadata `json:"token_metadata,omitempty"`
+	// TokenWorkspaces maps the hashes of tokens issued for a workspace to
+	// its ID; other tokens belong to the default workspace
+	TokenWorkspaces map[string]string `json:"token_workspaces,omitempty"`
+	// TokenTTLMinutes is how long newly issued stored tokens stay valid;
+	// 0 means they don't expire
+	TokenTTLMinutes int `json:"token_ttl_minutes,omitempty"`
+	// JWTSecret, when set, makes /auth/token issue signed JWTs instead of
+	// storing token hashes
+	JWTSecret string `json:"jwt_secret,omitempty"`
+	// JWTTTLMinutes is how long issued JWTs stay valid (default: 1440)
+	JWTTTLMinutes int `json:"jwt_ttl_minutes,omitempty"`
+	// RevokedJWTs maps the subjects of revoked JWTs to when they can be
+	// forgotten (Unix seconds), because the JWT has expired by then
+	RevokedJWTs map[string]int64 `json:"revoked_jwts,omitempty"`
+	// DisabledEndpoints lists API route names (e.g. "auth.token",
+	// "tasks.create") that are not registered
+	DisabledEndpoints []string `json:"disabled_endpoints,omitempty"`
+	// CORSAllowedOrigins lists origins allowed to call the API from a
+	// browser; "*" allows any origin
+	CORSAllowedOrigins []string `json:"cors_allowed_origins,omitempty"`
+	// CORSAllowedMethods and CORSAllowedHeaders are what preflight
+	// responses allow (default: every method the API uses, and
+	// Content-Type and X-API-Token)
+	CORSAllowedMethods []string `json:"cors_allowed_methods,omitempty"`
+	CORSAllowedHeaders []string `json:"cors_allowed_headers,omitempty"`
+	// CORSAllowCredentials lets browsers send cookies and HTTP auth with
+	// cross-origin requests; it can't be combined with the "*" origin
+	CORSAllowCredentials bool `json:"cors_allow_credentials,omitempty"`
+	// AutoProgressOnEdit moves pending tasks to in_progress when they are
+	// edited without an explicit status change
+	AutoProgressOnEdit bool `json:"auto_progress_on_edit,omitempty"`
+	// AutoDeleteCompletedAfterDays permanently deletes completed tasks this
+	// many days after completion; 0 keeps them forever
+	AutoDeleteCompletedAfterDays int `json:"auto_delete_completed_after_days,omitempty"`
+	// TrashRetentionDays is how long deleted tasks can be restored before
+	// they are purged (default: 30)
+	TrashRetentionDays int `json:"trash_retention_days,omitempty"`
+	// ArchiveCompletedAfterDays moves completed tasks to the archive this
+	// many days after completion; 0 leaves them in the task list
+	ArchiveCompletedAfterDays int `json:"archive_completed_after_days,omitempty"`
+	// PasswordPolicy applies to any endpoint that sets a password
+	PasswordPolicy PasswordPolicy `json:"password_policy"`
+	// PasswordHash is the bcrypt hash of the master password that token
+	// generation requires; without one anyone can generate tokens
+	PasswordHash string `json:"password_hash,omitempty"`
+	// EnablePprof mounts /debug/pprof/ and /debug/vars; these expose process
+	// internals and must not be reachable from the public internet
+	EnablePprof bool `json:"enable_pprof,omitempty"`
+	// DebugAllowedCIDRs are the networks served the debug endpoints
+	// (default: loopback and private addresses)
+	DebugAllowedCIDRs []string `json:"debug_allowed_cidrs,omitempty"`
+	// ObfuscateIDs shows task IDs to clients as short opaque strings derived
+	// from IDSalt instead of sequential integers
+	ObfuscateIDs bool   `json:"obfuscate_ids,omitempty"`
+	IDSalt       string `json:"id_salt,omitempty"`
+	// ShareSecret signs read-only share links; when empty a random key is
+	// used and links stop working on restart
+	ShareSecret string `json:"share_secret,omitempty"`
+	// CalendarFeedPrivate makes the iCalendar feed require the token from
+	// /calendar/token, which is signed with ShareSecret
+	CalendarFeedPrivate bool `json:"calendar_feed_private,omitempty"`
+	// MaxTasks caps the open (not completed) tasks, each counted by its
+	// PriorityWeights entry (default 1); 0 means no limit
+	MaxTasks        int            `json:"max_tasks,omitempty"`
+	PriorityWeights map[string]int `json:"priority_weights,omitempty"`
+	// PriorityLevels are priorities accepted besides low, medium, high and
+	// urgent, each with a SortWeight placing it among them
+	PriorityLevels []PriorityLevel `json:"priority_levels,omitempty"`
+	// MaxConcurrentRequests caps the requests served at once; further
+	// requests get 503. Health and debug endpoints are not counted. 0 means
+	// no limit.
+	MaxConcurrentRequests int `json:"max_concurrent_requests,omitempty"`
+	// RateLimit caps how fast each client may send requests
+	RateLimit RateLimitConfig `json:"rate_limit"`
+	// MaxPollTimeoutSeconds caps how long a long-poll request may wait
+	// (default: 60)
+	MaxPollTimeoutSeconds int `json:"max_poll_timeout_seconds,omitempty"`
+	// MaxEventStreams caps open /api/v1/events and /api/v1/ws connections,
+	// which are not counted against MaxConcurrentRequests (default: 100)
+	MaxEventStreams int `json:"max_event_streams,omitempty"`
+	// DefaultSort and DefaultOrder set the ordering of task listings when a
+	// request has no ?sort= or ?order= (default: id, asc)
+	DefaultSort  string `json:"default_sort,omitempty"`
+	DefaultOrder string `json:"default_order,omitempty"`
+	// Storage selects the task backend: "json" (default, tasks.json),
+	// "sqlite" (SQLitePath, default tasks.db) or "postgres" (Postgres)
+	Storage    string         `json:"storage,omitempty"`
+	SQLitePath string         `json:"sqlite_path,omitempty"`
+	Postgres   PostgresConfig `json:"postgres"`
+	// MaxTagsPerTask caps the distinct tags on a task; 0 means no limit
+	MaxTagsPerTask int `json:"max_tags_per_task,omitempty"`
+	// PreserveTagCase stores tags as sent instead of lowercasing them; tag
+	// filters and counts ignore case either way
+	PreserveTagCase bool `json:"preserve_tag_case,omitempty"`
+	// Webhooks receive task events; they are managed through the API
+	Webhooks []Webhook `json:"webhooks,omitempty"`
+	// Integrations post project events to Slack or Discord; they are
+	// managed through the API
+	Integrations []Integration `json:"integrations,omitempty"`
+	// Reminders sends notifications as tasks come due
+	Reminders ReminderConfig `json:"reminders"`
+	// SMTP sends due-soon, assignment and digest emails to users
+	SMTP SMTPConfig `json:"smtp"`
+	// Digest sends a summary of overdue, due-today and recently completed
+	// tasks through the reminder channels and SMTP on a schedule
+	Digest DigestConfig `json:"digest"`
+	// Telegram lets linked users manage tasks from a Telegram chat
+	Telegram TelegramConfig `json:"telegram"`
+	// OIDC lets users sign in through an external identity provider
+	OIDC OIDCConfig `json:"oidc"`
+	// TLS serves the API over HTTPS
+	TLS TLSConfig `json:"tls"`
+	// LogFormat is json (default) or text
+	LogFormat string `json:"log_format,omitempty"`
+	// SeedFile holds tasks loaded on startup when the store is empty
+	// (default: seed.json, skipped if missing)
+	SeedFile string `json:"seed_file,omitempty"`
+	// TaskDefaults fills in fields omitted from create requests
+	TaskDefaults TaskDefaults `json:"task_defaults"`
+	// Backup writes backup archives to disk on a schedule
+	Backup BackupConfig `json:"backup"`
+	// RequireIfMatch rejects PUT and PATCH requests on tasks that have no
+	// If-Match header
+	RequireIfMatch bool `json:"require_if_match,omitempty"`
+	// AuditLog is the file every task and project change is appended to
+	// (default: audit.log)
+	AuditLog string `json:"audit_log,omitempty"`
+	// Attachments sets where files uploaded to tasks are kept and how
+	// large they may be
+	Attachments AttachmentConfig `json:"attachments"`
+	// Workflow sets the task statuses and the moves allowed between them
+	Workflow WorkflowConfig `json:"workflow"`
+	// Workspaces are teams served besides the default workspace, each with
+	// its own tasks under workspaces/<id>; they are managed through the API
+	Workspaces []Workspace `json:"workspaces,omitempty"`
+
+	// fromEnv holds the settings environment variables replaced, so that
+	// SaveConfig doesn't write them to the config file
+	fromEnv map[string]envValue
 }
 
-// LoadConfig reads configuration from config.json or environment variables
-// LoadConfig reads configuration from config.json or environment variables
+// envValue is a setting replaced by an environment variable: the value
+// from the config file and the one from the environment
+type envValue struct {
+	file, env string
+}
+
+// envSettings are the settings environment variables override, by
+// variable name
+var envSettings = []struct {
+	name    string
+	setting func(*Config) *string
+}{
+	{"TASKMATE_PORT", func(c *Config) *string { return &c.Port }},
+	{"TASKMATE_API_KEY", func(c *Config) *string { return &c.APIKey }},
+	{"TASKMATE_DB_URL", func(c *Config) *string { return &c.Postgres.URL }},
+	{"TASKMATE_JWT_SECRET", func(c *Config) *string { return &c.JWTSecret }},
+	{"TASKMATE_PASSWORD_HASH", func(c *Config) *string { return &c.PasswordHash }},
+	{"TASKMATE_OIDC_CLIENT_SECRET", func(c *Config) *string { return &c.OIDC.ClientSecret }},
+	{"TASKMATE_SMTP_PASSWORD", func(c *Config) *string { return &c.SMTP.Password }},
+	{"TASKMATE_TIME_ZONE", func(c *Config) *string { return &c.TimeZone }},
+}
+
+// applyEnv overrides the settings in envSettings whose variable is set,
+// remembering the config file's values
+func (c *Config) applyEnv(getenv func(string) string) {
+	for _, s := range envSettings {
+		value := getenv(s.name)
+		if value == "" {
+			continue
+		}
+		if c.fromEnv == nil {
+			c.fromEnv = make(map[string]envValue)
+		}
+		setting := s.setting(c)
+		c.fromEnv[s.name] = envValue{file: *setting, env: value}
+		*setting = value
+	}
+}
+
+// withoutEnv returns a copy of c with the config file's values in place of
+// those from the environment, so secrets passed as environment variables
+// never end up in the file. A setting changed since loading, such as a new
+// password, keeps its new value.
+func (c *Config) withoutEnv() *Config {
+	saved := *c
+	for _, s := range envSettings {
+		if v, ok := c.fromEnv[s.name]; ok && *s.setting(&saved) == v.env {
+			*s.setting(&saved) = v.file
+		}
+	}
+	return &saved
+}
+
+// TaskDefaults holds org-wide values for new tasks. Empty fields have no
+// effect; a value supplied in the create request always takes precedence,
+// except Tags, which are added to the request's tags.
+type TaskDefaults struct {
+	Description string   `json:"description,omitempty"`
+	Priority    string   `json:"priority,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	// Assignee is named as in the audit log, e.g. a triage user
+	Assignee string `json:"assignee,omitempty"`
+}
+
+// LoadConfig reads configuration from config.json in the data directory, or
+// the file configurePaths was given, and environment variables
 func LoadConfig() (*Config, error) {
 	config := &Config{
 		TokenHashes: []string{},
 	}
 
 	// Try to load from file first
-	data, err := os.ReadFile("config.json")
+	data, err := os.ReadFile(configPath())
 	if err == nil {
 		if err := json.Unmarshal(data, config); err != nil {
 			return nil, err
@@ -52,15 +313,94 @@ func LoadConfig() (*Config, error) {
 	}
 
 	// Override with environment variables if set (for containers)
-	if port := os.Getenv("TASKMATE_PORT"); port != "" {
-		config.Port = port
-	}
+	config.applyEnv(os.Getenv)
 	if config.Port == "" {
 		config.Port = "8080" // Default port
 	}
+	config.Telegram.BotToken = os.Getenv("TASKMATE_TELEGRAM_TOKEN")
 
-	if apiKey := os.Getenv("TASKMATE_API_KEY"); apiKey != "" {
-		config.APIKey = apiKey
+	if _, err := config.Location(); err != nil {
+		return nil, fmt.Errorf("invalid time_zone %q: %w", config.TimeZone, err)
+	}
+	if err := validateUserTimeZones(config.UserTimeZones); err != nil {
+		return nil, fmt.Errorf("invalid user_time_zones: %w", err)
+	}
+	if err := validateSort(config.DefaultSort, config.DefaultOrder); err != nil {
+		return nil, fmt.Errorf("invalid default sort: %w", err)
+	}
+	if err := validateStorage(config.Storage); err != nil {
+		return nil, err
+	}
+	if err := validatePriorityWeights(config.PriorityWeights); err != nil {
+		return nil, fmt.Errorf("invalid priority_weights: %w", err)
+	}
+	if err := validatePriorityLevels(config.PriorityLevels); err != nil {
+		return nil, fmt.Errorf("invalid priority_levels: %w", err)
+	}
+	if err := validateWorkflow(config.Workflow); err != nil {
+		return nil, fmt.Errorf("invalid workflow: %w", err)
+	}
+	if _, ok := priorityRanks(config.PriorityLevels)[config.TaskDefaults.Priority]; config.TaskDefaults.Priority != "" && !ok {
+		return nil, fmt.Errorf("invalid task_defaults: unknown priority %q", config.TaskDefaults.Priority)
+	}
+	if config.TaskDefaults.Assignee != "" {
+		if err := validateAssignee(config.TaskDefaults.Assignee); err != nil {
+			return nil, fmt.Errorf("invalid task_defaults: %w", err)
+		}
+	}
+	if _, err := openNotifiers(&config.Reminders); err != nil {
+		return nil, fmt.Errorf("invalid reminders: %w", err)
+	}
+	if err := validateSMTP(config.SMTP); err != nil {
+		return nil, err
+	}
+	if err := validateDigest(config); err != nil {
+		return nil, err
+	}
+	if err := validateIntegrations(config.Integrations); err != nil {
+		return nil, err
+	}
+	if err := validateTelegram(config.Telegram); err != nil {
+		return nil, err
+	}
+	if err := validateTokenRoles(config.TokenRoles); err != nil {
+		return nil, fmt.Errorf("invalid token_roles: %w", err)
+	}
+	if err := validateTokenScopes(config.TokenScopes, config.TokenRoles); err != nil {
+		return nil, fmt.Errorf("invalid token_scopes: %w", err)
+	}
+	if err := validateWorkspaces(config); err != nil {
+		return nil, err
+	}
+	if err := validateCORS(config); err != nil {
+		return nil, err
+	}
+	if err := validateLogFormat(config.LogFormat); err != nil {
+		return nil, err
+	}
+	if err := validateDebugCIDRs(config.DebugAllowedCIDRs); err != nil {
+		return nil, err
+	}
+	if err := validateOIDC(config.OIDC); err != nil {
+		return nil, fmt.Errorf("invalid oidc: %w", err)
+	}
+	if err := validateTLS(config.TLS); err != nil {
+		return nil, fmt.Errorf("invalid tls: %w", err)
+	}
+	if err := validateBackup(config.Backup); err != nil {
+		return nil, fmt.Errorf("invalid backup: %w", err)
+	}
+	if _, err := openAttachmentStore(&config.Attachments); err != nil {
+		return nil, fmt.Errorf("invalid attachments: %w", err)
+	}
+	if config.Attachments.MaxSizeMB < 0 {
+		return nil, errors.New("attachments.max_size_mb must not be negative")
+	}
+	if config.TrashRetentionDays < 0 {
+		return nil, errors.New("trash_retention_days must not be negative")
+	}
+	if config.ArchiveCompletedAfterDays < 0 {
+		return nil, errors.New("archive_completed_after_days must not be negative")
 	}
 
 	// Initialize token_hashes if nil
@@ -71,13 +411,23 @@ func LoadConfig() (*Config, error) {
 	return config, nil
 }
 
-// SaveConfig writes configuration to config.json
+// Location returns the time zone used for day boundaries (server local time
+// when time_zone is unset)
+func (c *Config) Location() (*time.Location, error) {
+	if c.TimeZone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(c.TimeZone)
+}
+
+// SaveConfig writes configuration to the file LoadConfig reads. Settings
+// taken from environment variables keep their value from the file.
 func SaveConfig(config *Config) error {
-	data, err := json.MarshalIndent(config, "", "  ")
+	data, err := json.MarshalIndent(config.withoutEnv(), "", "  ")
 	if err != nil {
 		return err
 	}
-	return os.WriteFile("config.json", data, 0600)
+	return os.WriteFile(configPath(), data, 0600)
 }
 
 // hashString creates SHA-256 hash of input string
@@ -95,83 +445,329 @@ func generateToken() (string, error) {
 	return hex.EncodeToString(bytes), nil
 }
 
-// TaskStore manages tasks with JSON persistence
+// TaskStore manages tasks in memory, writing every change through to its
+// Storage
 type TaskStore struct {
-	mu       sync.RWMutex
-	tasks    map[int]*Task
-	nextID   int
-	filePath string
+	mu      sync.RWMutex
+	tasks   map[int]*Task
+	nextID  int
+	storage Storage
+	// stored holds the IDs of the tasks in storage, telling the tasks a
+	// save has to add from those it updates
+	stored map[int]bool
+	// storageRevision is the revision of shared storage the store last
+	// caught up with; see Refresh
+	storageRevision int64
+	now             func() time.Time
+
+	// revision counts saved mutations; changes holds the most recent ones
+	// and changed is closed and replaced whenever a change is recorded
+	revision int64
+	changes  []Change
+	changed  chan struct{}
+
+	autoProgressOnEdit bool
+	quota              taskQuota
+	tags               tagPolicy
+	workflow           workflow
+	priorities         priorityRanking
+	// dueLocation is the time zone due dates given only as a day are read
+	// in when no request says otherwise: in seed files and in tasks saved
+	// before due dates had a time
+	dueLocation *time.Location
+
+	// index speeds up text search; it is kept current by recordChange
+	// and resetChanges
+	index *trigramIndex
+
+	// trash holds deleted tasks until they are restored or purged. The
+	// backend stores them with the live tasks, marked by DeletedAt.
+	trash map[int]*Task
+	// archive holds completed tasks moved out of the live ones, stored
+	// like the trash and marked by ArchivedAt
+	archive map[int]*Task
+
+	// projects are saved through the backend's ProjectBackend
+	projects      map[int]*Project
+	nextProjectID int
+
+	// audit records every mutation when set
+	audit *auditLog
+	// files keeps the files of attachments; nil when the configured
+	// attachment storage couldn't be opened
+	files AttachmentStore
+	// history holds the kept revisions of each task, oldest first
+	history map[int][]*TaskRevision
+	// comments holds each task's comments, oldest first
+	comments      map[int][]*Comment
+	nextCommentID int
+
+	// closed is set by Close; later saves fail
+	closed bool
 }
 
-// NewTaskStore creates a new task store
+// NewTaskStore creates a task store backed by the JSON file at filePath. An
+// unreadable file is logged and the store starts empty.
 func NewTaskStore(filePath string) *TaskStore {
-	store := &TaskStore{
-		tasks:    make(map[int]*Task),
-		nextID:   1,
-		filePath: filePath,
+	store, err := NewTaskStoreWithStorage(&jsonBackend{path: filePath})
+	if err != nil {
+		slog.Error("Failed to load tasks", "error", err)
 	}
-	store.loadFromFile()
 	return store
 }
 
-// loadFromFile loads tasks from JSON file
-func (ts *TaskStore) loadFromFile() {
-	data, err := os.ReadFile(ts.filePath)
-	if err != nil {
-		return // File doesn't exist yet
-	}
+// NewTaskStoreWithStorage creates a task store holding the tasks listed by
+// storage, reading due days in local time. On a load error the returned
+// store is empty.
+func NewTaskStoreWithStorage(storage Storage) (*TaskStore, error) {
+	return newTaskStore(storage, time.Local)
+}
 
-	var tasks []*Task
-	if err := json.Unmarshal(data, &tasks); err != nil {
-		return
+// newTaskStore is NewTaskStoreWithStorage with due days read in dueLocation
+func newTaskStore(storage Storage, dueLocation *time.Location) (*TaskStore, error) {
+	store := &TaskStore{
+		tasks:         make(map[int]*Task),
+		trash:         make(map[int]*Task),
+		archive:       make(map[int]*Task),
+		nextID:        1,
+		storage:       storage,
+		stored:        make(map[int]bool),
+		now:           time.Now,
+		projects:      make(map[int]*Project),
+		nextProjectID: 1,
+		history:       make(map[int][]*TaskRevision),
+		comments:      make(map[int][]*Comment),
+		nextCommentID: 1,
+		workflow:      newWorkflow(WorkflowConfig{}),
+		priorities:    priorityRanks(nil),
+		dueLocation:   dueLocation,
+	}
+	// Writes landing while the tasks are listed are read again by the
+	// first Refresh
+	if shared, ok := storage.(SharedStorage); ok {
+		revision, err := shared.Revision(context.Background())
+		if err != nil {
+			store.index = newTrigramIndex(store.tasks)
+			return store, fmt.Errorf("read storage revision: %w", err)
+		}
+		store.storageRevision = revision
+	}
+	tasks, err := storage.List(context.Background())
+	if err != nil {
+		store.index = newTrigramIndex(store.tasks)
+		return store, err
 	}
-
 	for _, task := range tasks {
-		ts.tasks[task.ID] = task
-		if task.ID >= ts.nextID {
-			ts.nextID = task.ID + 1
+		task.DueDate = task.DueDate.resolveSavedDay(dueLocation)
+		store.partitionFor(task)[task.ID] = task
+		store.stored[task.ID] = true
+		if task.ID >= store.nextID {
+			store.nextID = task.ID + 1
 		}
 	}
+	store.index = newTrigramIndex(store.tasks)
+	if err := store.loadProjects(); err != nil {
+		return store, err
+	}
+	if err := store.loadHistory(); err != nil {
+		return store, err
+	}
+	if err := store.loadComments(); err != nil {
+		return store, err
+	}
+	return store, nil
 }
 
-// saveToFile persists tasks to JSON file
-func (ts *TaskStore) saveToFile() error {
-	tasks := make([]*Task, 0, len(ts.tasks))
-	for _, task := range ts.tasks {
-		tasks = append(tasks, task)
+// save writes the tasks with the given IDs to storage after a change,
+// first bumping the Version of each that is still kept. Tasks storage
+// doesn't hold yet are added, those no longer kept are deleted, and the
+// rest are updated. If the save fails the versions are put back. The
+// caller must hold the write lock.
+func (ts *TaskStore) save(ctx context.Context, changed ...int) error {
+	return ts.saveReplacing(ctx, nil, changed)
+}
+
+// saveReplacing is save, but first deletes the stored tasks removed, so
+// that changed tasks reusing their IDs are added anew. Replace and Restore
+// use it to swap the whole task set.
+func (ts *TaskStore) saveReplacing(ctx context.Context, removed, changed []int) error {
+	if ts.closed {
+		return ErrStoreClosed
+	}
+	ctx, span := startSpan(ctx, "storage.save")
+	defer span.End()
+	span.SetAttributes(attribute.Int("taskmate.changed_tasks", len(changed)))
+	persisted := ts.persistedLocked()
+	seen := make(map[int]bool, len(changed))
+	unique := changed[:0:0]
+	for _, id := range changed {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	changed = unique
+	for _, id := range changed {
+		if task, exists := persisted.Get(id); exists {
+			task.Version++
+		}
 	}
 
-	data, err := json.MarshalIndent(tasks, "", "  ")
+	isRemoved := make(map[int]bool, len(removed))
+	for _, id := range removed {
+		isRemoved[id] = true
+	}
+	write := func(w TaskWriter) error {
+		for _, id := range removed {
+			if err := w.Delete(ctx, id); err != nil {
+				return err
+			}
+		}
+		for _, id := range changed {
+			task, exists := persisted.Get(id)
+			inStorage := ts.stored[id] && !isRemoved[id]
+			var err error
+			switch {
+			case exists && inStorage:
+				err = w.Update(ctx, task)
+			case exists:
+				err = w.Add(ctx, task)
+			case inStorage:
+				err = w.Delete(ctx, id)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var err error
+	if tx, ok := ts.storage.(Transactor); ok && len(removed)+len(changed) > 1 {
+		err = tx.Atomically(ctx, write)
+	} else {
+		err = write(ts.storage)
+	}
 	if err != nil {
+		for _, id := range changed {
+			if task, exists := persisted.Get(id); exists {
+				task.Version--
+			}
+		}
+		spanError(span, err)
 		return err
 	}
 
-	return os.WriteFile(ts.filePath, data, 0600)
+	for _, id := range removed {
+		delete(ts.stored, id)
+	}
+	for _, id := range changed {
+		if _, exists := persisted.Get(id); exists {
+			ts.stored[id] = true
+		} else {
+			delete(ts.stored, id)
+		}
+	}
+	return nil
 }
 
-// Add creates a new task
-func (ts *TaskStore) Add(title, description, dueDate, priority string) *Task {
-	ts.mu.Lock()
-	defer ts.mu.Unlock()
+// sortByID orders tasks by ascending ID so that listings built from the
+// task map serialize identically for identical data
+func sortByID(tasks []*Task) {
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].ID < tasks[j].ID
+	})
+}
 
-	now := time.Now()
-	task := &Task{
-		ID:          ts.nextID,
+// Add creates a new task. It returns ctx's error without touching the store
+// if the context is done by the time the write lock is acquired.
+//
+// Add, Update and Delete return an error if the tasks file could not be
+// written; the in-memory change is rolled back in that case so the store
+// never diverges from what is on disk.
+func (ts *TaskStore) Add(ctx context.Context, title, description string, dueDate DueTime, priority string, tags ...string) (*Task, error) {
+	return ts.AddTask(ctx, Task{
 		Title:       title,
 		Description: description,
 		DueDate:     dueDate,
 		Priority:    priority,
-		Status:      "pending",
-		CreatedAt:   now,
-		UpdatedAt:   now,
+		Tags:        tags,
+	})
+}
+
+// AddTask creates a new pending task from the client-settable fields of
+// fields: title, description, due date, priority, tags, project, blockers,
+// recurrence and reminder offsets. The project and blockers must exist.
+func (ts *TaskStore) AddTask(ctx context.Context, fields Task) (*Task, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
+	if err := ts.reserveIDsLocked(ctx, TaskIDs, 1, &ts.nextID); err != nil {
+		return nil, err
+	}
+	task, err := ts.newTaskLocked(ctx, fields)
+	if err != nil {
+		return nil, err
+	}
 	ts.tasks[ts.nextID] = task
 	ts.nextID++
-	if err := ts.saveToFile(); err != nil {
-		log.Printf("Failed to save tasks: %v", err)
+	if err := ts.save(ctx, task.ID); err != nil {
+		delete(ts.tasks, task.ID)
+		ts.nextID = task.ID
+		return nil, fmt.Errorf("save tasks: %w", err)
+	}
+	ts.recordChange(ctx, ChangeCreated, task)
+	ts.recordMutation(ctx, AuditCreate, auditTask, task.ID, nil, task)
+	return task, nil
+}
+
+// newTaskLocked checks fields as AddTask does and returns the task it would
+// add under the next ID, without adding it. The caller must hold the write
+// lock.
+func (ts *TaskStore) newTaskLocked(ctx context.Context, fields Task) (*Task, error) {
+	tags, err := ts.tags.normalize(fields.Tags)
+	if err != nil {
+		return nil, err
+	}
+	if _, exists := ts.projects[fields.ProjectID]; fields.ProjectID != 0 && !exists {
+		return nil, ErrProjectNotFound
+	}
+	if err := ts.checkProjectLocked(ctx, fields.ProjectID, PermissionEdit); err != nil {
+		return nil, err
+	}
+	offsets, err := normalizeReminderOffsets(fields.ReminderOffsets)
+	if err != nil {
+		return nil, err
+	}
+	blockers, err := ts.normalizeBlockersLocked(ts.nextID, fields.BlockedBy)
+	if err != nil {
+		return nil, err
+	}
+
+	if ts.quota.limit > 0 && ts.quotaUsedLocked()+ts.quota.weight(fields.Priority) > ts.quota.limit {
+		return nil, ErrQuotaExceeded
 	}
-	return task
+
+	now := ts.now()
+	return &Task{
+		ID:              ts.nextID,
+		Title:           fields.Title,
+		Description:     fields.Description,
+		DueDate:         fields.DueDate,
+		Priority:        fields.Priority,
+		Status:          "pending",
+		CreatedAt:       now,
+		UpdatedAt:       now,
+		Tags:            tags,
+		ProjectID:       fields.ProjectID,
+		Assignee:        fields.Assignee,
+		BlockedBy:       blockers,
+		Recurrence:      fields.Recurrence,
+		ReminderOffsets: offsets,
+	}, nil
 }
 
 // Get retrieves a task by ID
@@ -191,239 +787,806 @@ func (ts *TaskStore) GetAll() []*Task {
 	for _, task := range ts.tasks {
 		tasks = append(tasks, task)
 	}
+	sortByID(tasks)
 	return tasks
 }
 
 // GetPending returns only pending tasks
 func (ts *TaskStore) GetPending() []*Task {
+	return ts.List(TaskFilter{Statuses: []string{"pending"}})
+}
+
+// Search returns tasks whose title or description contains query
+// (case-insensitive), ordered by ID
+func (ts *TaskStore) Search(query string) []*Task {
 	ts.mu.RLock()
 	defer ts.mu.RUnlock()
 
 	tasks := make([]*Task, 0)
-	for _, task := range ts.tasks {
-		if task.Status == "pending" {
+	for _, task := range ts.searchCandidatesLocked(query) {
+		if scoreMatch(task, query) > 0 {
 			tasks = append(tasks, task)
 		}
 	}
 	return tasks
 }
 
-// Update modifies an existing task
-func (ts *TaskStore) Update(id int, title, description, dueDate, priority, status string) (*Task, bool) {
+// Relevance scores returned by scoreMatch, highest first
+const (
+	scoreTitleExact  = 100
+	scoreTitlePrefix = 75
+	scoreTitle       = 50
+	scoreDescription = 10
+)
+
+// scoreMatch rates how well task matches query, ignoring case. An exact
+// title match outranks a title prefix, which outranks the query appearing
+// elsewhere in the title, which outranks a description-only match. It
+// returns 0 when the task does not match at all.
+func scoreMatch(task *Task, query string) int {
+	query = normalizeQuery(query)
+	if query == "" {
+		return 0
+	}
+	title := strings.ToLower(task.Title)
+	switch {
+	case title == query:
+		return scoreTitleExact
+	case strings.HasPrefix(title, query):
+		return scoreTitlePrefix
+	case strings.Contains(title, query):
+		return scoreTitle
+	case strings.Contains(strings.ToLower(task.Description), query):
+		return scoreDescription
+	}
+	return 0
+}
+
+// Update modifies an existing task. An empty priority or status keeps the
+// current one. With autoProgressOnEdit set, editing any other field of a
+// pending task moves it to in_progress unless a different status was
+// requested or the workflow doesn't allow it. A status change the workflow
+// doesn't allow fails with a *TransitionError, and completing a task fails
+// with ErrTaskBlocked while a task it is blocked by is open, unless ctx is
+// from allowBlockedCompletion.
+func (ts *TaskStore) Update(ctx context.Context, id int, title, description string, dueDate DueTime, priority, status string) (*Task, bool, error) {
+	return ts.UpdateIfMatch(ctx, id, nil, title, description, dueDate, priority, status)
+}
+
+// UpdateIfMatch is Update, but fails with ErrVersionMismatch unless the
+// task's Version is one of versions; nil versions skip the check. The
+// check and the update happen under the same write lock.
+func (ts *TaskStore) UpdateIfMatch(ctx context.Context, id int, versions []int, title, description string, dueDate DueTime, priority, status string) (*Task, bool, error) {
 	ts.mu.Lock()
 	defer ts.mu.Unlock()
 
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+
 	task, exists := ts.tasks[id]
 	if !exists {
-		return nil, false
+		return nil, false, nil
+	}
+	if versions != nil && !versionIn(task.Version, versions) {
+		return nil, true, ErrVersionMismatch
+	}
+	if err := ts.checkProjectLocked(ctx, task.ProjectID, PermissionEdit); err != nil {
+		return nil, true, err
+	}
+	if err := ts.workflow.checkTransition(task, status); err != nil {
+		return nil, true, err
 	}
+	if err := ts.checkCompletionLocked(ctx, task, task.BlockedBy, status); err != nil {
+		return nil, true, err
+	}
+	prev := *task
+	if err := ts.updateLocked(ctx, task, title, description, dueDate, priority, status); err != nil {
+		return nil, true, err
+	}
+	ts.recordMutation(ctx, AuditUpdate, auditTask, id, &prev, task)
+	return task, true, nil
+}
+
+// updateLocked applies an update to task, saves it and records the
+// change, restoring the task if the save fails. The caller must hold the
+// write lock.
+func (ts *TaskStore) updateLocked(ctx context.Context, task *Task, title, description string, dueDate DueTime, priority, status string) error {
+	prev := *task
+	ts.applyUpdateLocked(task, title, description, dueDate, priority, status)
+	if err := ts.save(ctx, task.ID); err != nil {
+		*task = prev
+		return fmt.Errorf("save tasks: %w", err)
+	}
+	ts.recordChange(ctx, ChangeUpdated, task)
+	return nil
+}
 
+// applyUpdateLocked sets task's fields and status as updateLocked does,
+// without saving. The caller must hold the write lock.
+func (ts *TaskStore) applyUpdateLocked(task *Task, title, description string, dueDate DueTime, priority, status string) {
+	prev := *task
 	task.Title = title
 	task.Description = description
 	task.DueDate = dueDate
-	task.Priority = priority
+	if priority != "" {
+		task.Priority = priority
+	}
+	if status == "" {
+		status = prev.Status
+	}
+	// A status equal to the current one is not an explicit transition, so
+	// clients that resend the whole task still get the auto behavior
+	if ts.autoProgressOnEdit && prev.Status == "pending" && status == "pending" && fieldsChanged(&prev, task) &&
+		ts.workflow.known("in_progress") && ts.workflow.allows("pending", "in_progress") {
+		status = "in_progress"
+	}
+	now := ts.now()
+	if status == "completed" && task.Status != "completed" {
+		task.CompletedAt = &now
+	} else if status != "completed" {
+		task.CompletedAt = nil
+	}
+	// A task that changes column goes to the end of the new one
+	if status != task.Status {
+		task.Position = 0
+	}
 	task.Status = status
-	task.UpdatedAt = time.Now()
-	if err := ts.saveToFile(); err != nil {
-		log.Printf("Failed to save tasks: %v", err)
+	task.UpdatedAt = now
+}
+
+// fieldsChanged reports whether any editable field other than status differs
+func fieldsChanged(a, b *Task) bool {
+	return a.Title != b.Title ||
+		a.Description != b.Description ||
+		!a.DueDate.Equal(b.DueDate) ||
+		a.Priority != b.Priority
+}
+
+// Delete moves a task to the trash
+func (ts *TaskStore) Delete(ctx context.Context, id int) (bool, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return false, err
 	}
-	return task, true
+	return ts.deleteLocked(ctx, id)
 }
 
-// Delete removes a task
-func (ts *TaskStore) Delete(id int) bool {
+// ErrTaskModified is returned by DeleteIfUnmodified when the task changed
+// after the caller's copy
+var ErrTaskModified = errors.New("task modified since given time")
+
+// DeleteIfUnmodified removes a task only if it has not been updated after
+// since. The check and the delete happen under the same write lock, so a
+// concurrent update can't slip in between them. UpdatedAt is compared at
+// second precision, matching HTTP dates.
+func (ts *TaskStore) DeleteIfUnmodified(ctx context.Context, id int, since time.Time) (bool, error) {
 	ts.mu.Lock()
 	defer ts.mu.Unlock()
 
-	_, exists := ts.tasks[id]
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	task, exists := ts.tasks[id]
+	if !exists {
+		return false, nil
+	}
+	if task.UpdatedAt.Truncate(time.Second).After(since) {
+		return true, ErrTaskModified
+	}
+	return ts.deleteLocked(ctx, id)
+}
+
+// deleteLocked moves a task to the trash and saves, restoring it if the
+// save fails. To everything but the trash the task is deleted. The caller
+// must hold the write lock.
+func (ts *TaskStore) deleteLocked(ctx context.Context, id int) (bool, error) {
+	task, exists := ts.tasks[id]
 	if exists {
+		if err := ts.checkProjectLocked(ctx, task.ProjectID, PermissionEdit); err != nil {
+			return true, err
+		}
+		prev := *task
+		now := ts.now()
+		task.DeletedAt = &now
 		delete(ts.tasks, id)
-		if err := ts.saveToFile(); err != nil {
-			log.Printf("Failed to save tasks: %v", err)
+		ts.trash[id] = task
+		if err := ts.save(ctx, id); err != nil {
+			task.DeletedAt = nil
+			delete(ts.trash, id)
+			ts.tasks[id] = task
+			return true, fmt.Errorf("save tasks: %w", err)
 		}
+		ts.recordChange(ctx, ChangeDeleted, task)
+		ts.recordMutation(ctx, AuditDelete, auditTask, id, &prev, task)
 	}
-	return exists
+	return exists, nil
 }
 
 // Server holds our application state
 type Server struct {
 	store  *TaskStore
 	config *Config
-	mu     sync.RWMutex
+	// mu guards config, which every workspace's server shares
+	mu       *sync.RWMutex
+	location *time.Location
+	now      func() time.Time
+
+	healthChecks []healthCheck
+	ids          *idCodec
+	shareKey     []byte
+	// static holds the web UI files served at / and /static/
+	static       fs.FS
+	eventStreams chan struct{}
+	oidc         *oidcClient
+	// emailTemplates is nil unless an SMTP host is configured
+	emailTemplates *template.Template
+	sendMail       func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+
+	// closing is closed when Shutdown starts, ending long-lived requests
+	closing   chan struct{}
+	closeOnce sync.Once
+	// stopBackground stops the workers started by startBackground
+	stopBackground context.CancelFunc
+	background     sync.WaitGroup
+
+	// workspace is the ID of the workspace the server is for, "" for the
+	// default workspace
+	workspace string
+	// workspaces are the open workspaces besides the default one, and
+	// backgroundStarted whether their background workers should run
+	workspaces        map[string]*workspaceServer
+	workspacesMu      sync.Mutex
+	backgroundStarted bool
 }
 
-// NewServer creates a new server instance
+// NewServer creates a new server instance storing tasks in the JSON file
+// dataFile
 func NewServer(config *Config, dataFile string) *Server {
-	return &Server{
-		store:  NewTaskStore(dataFile),
-		config: config,
-	}
+	return NewServerWithStore(config, NewTaskStore(dataFile))
 }
 
-// tokenAuthMiddleware checks for valid token (for POST/DELETE operations)
-func (s *Server) tokenAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		token := r.Header.Get("X-API-Token")
-		if token == "" {
-			http.Error(w, "Token required", http.StatusUnauthorized)
-			return
+// NewServerWithStore creates a new server instance around store
+func NewServerWithStore(config *Config, store *TaskStore) *Server {
+	location, err := config.Location()
+	if err != nil {
+		slog.Warn("Invalid time zone, using local time", "time_zone", config.TimeZone, "error", err)
+		location = time.Local
+	}
+	store.autoProgressOnEdit = config.AutoProgressOnEdit
+	store.quota = taskQuota{limit: config.MaxTasks, weights: config.PriorityWeights}
+	store.priorities = priorityRanks(config.PriorityLevels)
+	store.workflow = newWorkflow(config.Workflow)
+	store.tags = tagPolicy{max: config.MaxTagsPerTask, preserveCase: config.PreserveTagCase}
+	files, err := openAttachmentStore(&config.Attachments)
+	if err != nil {
+		slog.Warn("Attachment storage unavailable", "error", err)
+	}
+	store.files = files
+	server := &Server{
+		store:        store,
+		config:       config,
+		mu:           new(sync.RWMutex),
+		location:     location,
+		now:          time.Now,
+		shareKey:     newShareKey(config.ShareSecret),
+		static:       staticFiles(""),
+		eventStreams: newEventStreamSlots(config),
+		oidc:         newOIDCClient(config.OIDC),
+		sendMail:     smtp.SendMail,
+		closing:      make(chan struct{}),
+	}
+	if config.SMTP.Host != "" {
+		templates, err := loadEmailTemplates(config.SMTP.TemplateDir, location)
+		if err != nil {
+			slog.Warn("Email notifications disabled", "error", err)
 		}
+		server.emailTemplates = templates
+	}
+	if config.ObfuscateIDs {
+		server.ids = newIDCodec(config.IDSalt)
+	}
+	server.RegisterHealthCheck("storage", store, true)
+	return server
+}
 
-		// Hash the provided token
-		tokenHash := hashString(token)
+// writeJSON encodes v as the JSON response body with the given status code.
+// encoding/json sorts map keys, so map-shaped responses are byte-identical
+// for identical data and safe to cache behind ETag-aware proxies.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to encode response", "error", err)
+	}
+}
 
-		// Check if token hash exists in config
-		s.mu.RLock()
-		valid := false
-		for _, storedHash := range s.config.TokenHashes {
-			if storedHash == tokenHash {
-				valid = true
-				break
-			}
+// corsMiddleware adds CORS headers for allowed origins and answers preflight
+// OPTIONS requests itself, before routing, so they are never subject to
+// token authentication
+func (s *Server) corsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin != "" && s.originAllowed(origin) {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Add("Vary", "Origin")
+		}
+
+		if origin != "" && s.originAllowed(origin) && s.config.CORSAllowCredentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
 		}
-		s.mu.RUnlock()
 
-		if !valid {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			if origin != "" && s.originAllowed(origin) {
+				methods, headers := s.config.CORSAllowedMethods, s.config.CORSAllowedHeaders
+				if len(methods) == 0 {
+					methods = defaultCORSMethods
+				}
+				if len(headers) == 0 {
+					headers = defaultCORSHeaders
+				}
+				w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+				w.Header().Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+				w.Header().Set("Access-Control-Max-Age", "600")
+			}
+			w.WriteHeader(http.StatusNoContent)
 			return
 		}
 
-		next(w, r)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Defaults for Config.CORSAllowedMethods and Config.CORSAllowedHeaders
+var (
+	defaultCORSMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	defaultCORSHeaders = []string{"Content-Type", "X-API-Token"}
+)
+
+// validateCORS rejects credentials for any origin, which would let every
+// website make requests as the user
+func validateCORS(c *Config) error {
+	if c.CORSAllowCredentials && containsString(c.CORSAllowedOrigins, "*") {
+		return errors.New(`cors_allow_credentials can't be used with the "*" origin`)
 	}
+	return nil
 }
 
-// handleGetTasks returns all tasks
+// originAllowed reports whether origin is listed in CORSAllowedOrigins
+func (s *Server) originAllowed(origin string) bool {
+	for _, allowed := range s.config.CORSAllowedOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenAuthMiddleware checks for a token allowed to change tasks (for
+// POST/DELETE operations)
+func (s *Server) tokenAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return s.requireScope(ScopeTasksWrite, next)
+}
+
+// handleGetTasks returns all tasks matching the filter parameters
 func (s *Server) handleGetTasks(w http.ResponseWriter, r *http.Request) {
-	tasks := s.store.GetAll()
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(tasks); err != nil {
-		log.Printf("Failed to encode tasks: %v", err)
+	filter, err := parseTaskFilter(r.URL.Query(), s.requestLocation(r))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidQuery, err.Error())
+		return
 	}
+	s.writeTaskList(w, r, s.store.List(filter))
 }
 
-// handleGetPendingTasks returns only pending tasks
+// handleGetPendingTasks returns only pending tasks; ?status= is ignored
 func (s *Server) handleGetPendingTasks(w http.ResponseWriter, r *http.Request) {
-	tasks := s.store.GetPending()
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(tasks); err != nil {
-		log.Printf("Failed to encode tasks: %v", err)
+	filter, err := parseTaskFilter(r.URL.Query(), s.requestLocation(r))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidQuery, err.Error())
+		return
 	}
+	filter.Statuses = []string{"pending"}
+	s.writeTaskList(w, r, s.store.List(filter))
+}
+
+// writeTaskList writes tasks as JSON, or as tab-separated text when the
+// request asks for ?format=text. Tasks are ordered by ?sort= and ?order=,
+// falling back to the configured default sort, then paginated.
+func (s *Server) writeTaskList(w http.ResponseWriter, r *http.Request, tasks []*Task) {
+	field, order := r.URL.Query().Get("sort"), r.URL.Query().Get("order")
+	if field == "" {
+		field = s.config.DefaultSort
+	}
+	if order == "" {
+		order = s.config.DefaultOrder
+	}
+	if err := validateSort(field, order); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidQuery, "Invalid sort or order")
+		return
+	}
+	sortTasks(tasks, field, order, s.store.priorities)
+	tasks, err := paginateTasks(w, r, tasks, field, order, s.store.priorities)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidQuery, err.Error())
+		return
+	}
+
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		writeJSON(w, http.StatusOK, s.presentTasks(tasks))
+	case "text":
+		s.writeTaskText(w, tasks)
+	default:
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidQuery, "Invalid format")
+	}
+}
+
+// textEscaper keeps each task on one tab-separated line
+var textEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// writeTaskText writes one line per task with the columns
+// id, status, priority, due_date and title separated by tabs
+func (s *Server) writeTaskText(w http.ResponseWriter, tasks []*Task) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	for _, task := range tasks {
+		if _, err := fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			s.formatID(task.ID),
+			textEscaper.Replace(task.Status),
+			textEscaper.Replace(task.Priority),
+			task.DueDate,
+			textEscaper.Replace(task.Title)); err != nil {
+			slog.Error("Failed to write response", "error", err)
+			return
+		}
+	}
+}
+
+// handleSearchTasks returns tasks matching ?q= in created order, or ranked
+// by scoreMatch when ?sort=relevance is given
+func (s *Server) handleSearchTasks(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	if strings.TrimSpace(query) == "" {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidQuery, "Query parameter q is required")
+		return
+	}
+
+	tasks := s.store.Search(query)
+	switch r.URL.Query().Get("sort") {
+	case "":
+	case "relevance":
+		sort.SliceStable(tasks, func(i, j int) bool {
+			return scoreMatch(tasks[i], query) > scoreMatch(tasks[j], query)
+		})
+	default:
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidQuery, "Invalid sort")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.presentTasks(tasks))
 }
 
 // handleGetTask returns a specific task
 func (s *Server) handleGetTask(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id, err := strconv.Atoi(vars["id"])
+	id, err := s.parseTaskID(r)
 	if err != nil {
-		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidTaskID, "Invalid task ID")
 		return
 	}
 
 	task, exists := s.store.Get(id)
 	if !exists {
-		http.Error(w, "Task not found", http.StatusNotFound)
+		writeError(w, http.StatusNotFound, ErrCodeTaskNotFound, "Task not found")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(task); err != nil {
-		log.Printf("Failed to encode task: %v", err)
+	w.Header().Set("ETag", taskETag(task))
+	writeJSON(w, http.StatusOK, s.presentTask(task))
+}
+
+// createTaskRequest is the body accepted when creating a task; due_date is
+// read as by parseDueDate
+type createTaskRequest struct {
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	DueDate     string   `json:"due_date"`
+	Priority    string   `json:"priority"`
+	Tags        []string `json:"tags"`
+	ProjectID   int      `json:"project_id"`
+	Assignee    string   `json:"assignee"`
+	// BlockedBy holds task IDs as numbers or, when IDs are obfuscated,
+	// strings
+	BlockedBy       []json.RawMessage `json:"blocked_by"`
+	Recurrence      string            `json:"recurrence"`
+	ReminderOffsets []int             `json:"reminder_offsets"`
+}
+
+// prepare fills omitted fields from defaults and validates the result,
+// with the priorities in priorities, returning a *validationError for a
+// 422 response
+func (req *createTaskRequest) prepare(defaults TaskDefaults, priorities priorityRanking) error {
+	// Defaults only fill in omitted fields; values in the request win
+	if req.Description == "" {
+		req.Description = defaults.Description
+	}
+	if req.Priority == "" {
+		req.Priority = defaults.Priority
+	}
+	if req.Priority == "" {
+		req.Priority = "medium"
 	}
+	if req.Assignee == "" {
+		req.Assignee = defaults.Assignee
+	}
+	req.Tags = append(req.Tags, defaults.Tags...)
+
+	if strings.TrimSpace(req.Title) == "" {
+		return &validationError{code: ErrCodeTitleRequired, message: "Title is required"}
+	}
+	if err := priorities.check(req.Priority); err != nil {
+		return err
+	}
+	if req.Assignee != "" {
+		if err := validateAssignee(req.Assignee); err != nil {
+			return err
+		}
+	}
+	return validateRecurrence(req.Recurrence)
 }
 
-// handleCreateTask creates a new task
-func (s *Server) handleCreateTask(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Title       string `json:"title"`
-		Description string `json:"description"`
-		DueDate     string `json:"due_date"`
-		Priority    string `json:"priority"`
+// newTaskFields prepares req and converts it to the fields AddTask takes,
+// reading a due day in loc. It returns a *validationError for a 422
+// response.
+func (s *Server) newTaskFields(req *createTaskRequest, loc *time.Location) (Task, error) {
+	if err := req.prepare(s.config.TaskDefaults, s.store.priorities); err != nil {
+		return Task{}, err
+	}
+	dueDate, err := parseDueDate(req.DueDate, loc)
+	if err != nil {
+		return Task{}, err
+	}
+	blockers, err := s.decodeTaskIDs(req.BlockedBy)
+	if err != nil {
+		return Task{}, &validationError{ErrCodeBlockerNotFound, "blocked_by names a task that isn't in the task list"}
 	}
+	return Task{
+		Title:           req.Title,
+		Description:     req.Description,
+		DueDate:         dueDate,
+		Priority:        req.Priority,
+		Tags:            req.Tags,
+		ProjectID:       req.ProjectID,
+		Assignee:        req.Assignee,
+		BlockedBy:       blockers,
+		Recurrence:      req.Recurrence,
+		ReminderOffsets: req.ReminderOffsets,
+	}, nil
+}
 
+// handleCreateTask creates a new task
+func (s *Server) handleCreateTask(w http.ResponseWriter, r *http.Request) {
+	var req createTaskRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON")
 		return
 	}
 
-	if strings.TrimSpace(req.Title) == "" {
-		http.Error(w, "Title is required", http.StatusBadRequest)
+	fields, err := s.newTaskFields(&req, s.requestLocation(r))
+	if err != nil {
+		writeValidationError(w, err)
 		return
 	}
 
-	if req.Priority == "" {
-		req.Priority = "medium"
+	task, err := s.store.AddTask(r.Context(), fields)
+	var verr *validationError
+	if errors.As(err, &verr) {
+		writeValidationError(w, err)
+		return
 	}
-
-	task := s.store.Add(req.Title, req.Description, req.DueDate, req.Priority)
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	if err := json.NewEncoder(w).Encode(task); err != nil {
-		log.Printf("Failed to encode task: %v", err)
+	if errors.Is(err, ErrProjectNotFound) {
+		writeError(w, http.StatusUnprocessableEntity, ErrCodeProjectNotFound, "Project not found")
+		return
+	}
+	if errors.Is(err, ErrQuotaExceeded) {
+		writeError(w, http.StatusInsufficientStorage, ErrCodeQuotaExceeded, "Task quota exceeded")
+		return
 	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	taskOps.Add("create", 1)
+	s.notifyAssignee(task, auditActor(r.Context()))
+	writeJSON(w, http.StatusCreated, s.presentTask(task))
+}
+
+// updateTaskRequest is the body accepted when replacing a task. An empty
+// priority or status keeps the current one; due_date is read as by
+// parseDueDate.
+type updateTaskRequest struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	DueDate     string `json:"due_date"`
+	Priority    string `json:"priority"`
+	Status      string `json:"status"`
 }
 
 // handleUpdateTask updates an existing task
 func (s *Server) handleUpdateTask(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id, err := strconv.Atoi(vars["id"])
+	id, err := s.parseTaskID(r)
 	if err != nil {
-		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidTaskID, "Invalid task ID")
 		return
 	}
 
-	var req struct {
-		Title       string `json:"title"`
-		Description string `json:"description"`
-		DueDate     string `json:"due_date"`
-		Priority    string `json:"priority"`
-		Status      string `json:"status"`
-	}
-
+	var req updateTaskRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON")
 		return
 	}
 
 	if strings.TrimSpace(req.Title) == "" {
-		http.Error(w, "Title is required", http.StatusBadRequest)
+		writeError(w, http.StatusUnprocessableEntity, ErrCodeTitleRequired, "Title is required")
+		return
+	}
+	if err := s.store.priorities.check(req.Priority); req.Priority != "" && err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	if err := s.store.workflow.checkStatus(req.Status); req.Status != "" && err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	dueDate, err := parseDueDate(req.DueDate, s.requestLocation(r))
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	versions, ok := s.ifMatchVersions(w, r)
+	if !ok {
 		return
 	}
 
-	task, exists := s.store.Update(id, req.Title, req.Description, req.DueDate, req.Priority, req.Status)
+	task, exists, err := s.store.UpdateIfMatch(forceContext(r), id, versions, req.Title, req.Description, dueDate, req.Priority, req.Status)
+	if errors.Is(err, ErrVersionMismatch) {
+		writeVersionMismatch(w)
+		return
+	}
+	if errors.Is(err, ErrTaskBlocked) {
+		writeTaskBlocked(w)
+		return
+	}
+	if errors.Is(err, ErrTransitionNotAllowed) {
+		writeTransitionNotAllowed(w, err)
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
 	if !exists {
-		http.Error(w, "Task not found", http.StatusNotFound)
+		writeError(w, http.StatusNotFound, ErrCodeTaskNotFound, "Task not found")
 		return
 	}
+	taskOps.Add("update", 1)
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(task); err != nil {
-		log.Printf("Failed to encode task: %v", err)
-	}
+	w.Header().Set("ETag", taskETag(task))
+	writeJSON(w, http.StatusOK, updateResponse{
+		publicTask:          s.presentTask(task),
+		OverdueOnCompletion: completedLate(task),
+	})
 }
 
-// handleDeleteTask deletes a task
+// updateResponse is a task as returned from an update, with fields that are
+// computed rather than stored
+type updateResponse struct {
+	publicTask
+	OverdueOnCompletion bool `json:"overdue_on_completion"`
+}
+
+// handleDeleteTask deletes a task. With an If-Unmodified-Since header the
+// delete only happens if the task hasn't changed since that time.
 func (s *Server) handleDeleteTask(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id, err := strconv.Atoi(vars["id"])
+	id, err := s.parseTaskID(r)
 	if err != nil {
-		http.Error(w, "Invalid task ID", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidTaskID, "Invalid task ID")
 		return
 	}
 
-	if !s.store.Delete(id) {
-		http.Error(w, "Task not found", http.StatusNotFound)
+	// An unparseable date is ignored, as HTTP requires
+	var deleted bool
+	if since, parseErr := http.ParseTime(r.Header.Get("If-Unmodified-Since")); parseErr == nil {
+		deleted, err = s.store.DeleteIfUnmodified(r.Context(), id, since)
+	} else {
+		deleted, err = s.store.Delete(r.Context(), id)
+	}
+	if errors.Is(err, ErrTaskModified) {
+		writeError(w, http.StatusPreconditionFailed, ErrCodePreconditionFailed, "Task was modified after If-Unmodified-Since")
 		return
 	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if !deleted {
+		writeError(w, http.StatusNotFound, ErrCodeTaskNotFound, "Task not found")
+		return
+	}
+	taskOps.Add("delete", 1)
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// handleGenerateToken generates a new API token without password verification (educational use only)
+// tokenRequest is the optional body of a token generation request
+type tokenRequest struct {
+	Role     string   `json:"role"`
+	Scopes   []string `json:"scopes"`
+	Label    string   `json:"label"`
+	Password string   `json:"password"`
+}
+
+// handleGenerateToken generates a new API token. Once a master password is
+// configured the body must include it; without one anyone can generate
+// tokens (educational use only). The body may ask for a role; the default is editor, except that the first
+// token issued is an admin so that someone can manage the server. Issuing
+// an admin token after that takes an admin's X-API-Token. With a JWT secret
+// configured the token is a signed JWT and nothing is stored; there is no
+// first token then, and admin JWTs come from an admin or taskmate
+// --admin-token. The response's id is what DELETE /auth/tokens/{id} takes.
+//
+// The body may also limit the token to some scopes; these must be granted
+// by the role, and without a role the token gets the least privileged role
+// that grants them.
 func (s *Server) handleGenerateToken(w http.ResponseWriter, r *http.Request) {
+	var req tokenRequest
+	// The body is optional
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	if s.passwordSet() && !s.checkRequestPassword(w, req.Password) {
+		return
+	}
+	if _, ok := roleRanks[req.Role]; req.Role != "" && !ok {
+		writeError(w, http.StatusUnprocessableEntity, ErrCodeInvalidRole, "Role must be viewer, editor or admin")
+		return
+	}
+	var scopes []string
+	if len(req.Scopes) > 0 {
+		if req.Role == "" {
+			req.Role = scopesRole(req.Scopes)
+		}
+		var ok bool
+		if scopes, ok = normalizeScopes(req.Scopes, req.Role); !ok {
+			writeError(w, http.StatusUnprocessableEntity, ErrCodeInvalidScope, "Scopes must be tasks:read, tasks:write or admin and allowed for the role")
+			return
+		}
+	}
+	caller, _ := s.lookupToken(r.Header.Get("X-API-Token"))
+
+	if s.config.JWTSecret != "" {
+		role := req.Role
+		if role == "" {
+			role = RoleEditor
+		}
+		if role == RoleAdmin && caller.role != RoleAdmin {
+			writeError(w, http.StatusForbidden, ErrCodeForbidden, "Issuing an admin token requires the admin role")
+			return
+		}
+		token, claims, err := issueJWT(s.config, role, scopes, s.now())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to generate token")
+			return
+		}
+		writeJSON(w, http.StatusCreated, tokenResponse(token, claims.Subject, role, scopes, time.Unix(claims.ExpiresAt, 0)))
+		return
+	}
+
 	// Generate new token
 	token, err := generateToken()
 	if err != nil {
-		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to generate token")
 		return
 	}
 
@@ -431,29 +1594,258 @@ func (s *Server) handleGenerateToken(w http.ResponseWriter, r *http.Request) {
 	tokenHash := hashString(token)
 
 	s.mu.Lock()
-	s.config.TokenHashes = append(s.config.TokenHashes, tokenHash)
-	if err := SaveConfig(s.config); err != nil {
+	first := len(s.config.TokenHashes) == 0
+	role := req.Role
+	if role == "" {
+		role = RoleEditor
+		if first {
+			role = RoleAdmin
+		}
+	}
+	if role == RoleAdmin && !first && caller.role != RoleAdmin {
 		s.mu.Unlock()
-		http.Error(w, "Failed to save token", http.StatusInternalServerError)
+		writeError(w, http.StatusForbidden, ErrCodeForbidden, "Issuing an admin token requires the admin role")
 		return
 	}
+	meta, err := s.storeTokenLocked(tokenHash, role, scopes, req.Label, "")
 	s.mu.Unlock()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrCodeSaveFailed, "Failed to save token")
+		return
+	}
 
 	// Return the token to the user (only time they'll see it)
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	if err := json.NewEncoder(w).Encode(map[string]string{
-		"token":   token,
-		"message": "Token generated successfully. Save this token securely, it won't be shown again.",
-	}); err != nil {
-		log.Printf("Failed to encode response: %v", err)
+	writeJSON(w, http.StatusCreated, tokenResponse(token, tokenID(tokenHash), role, scopes, meta.expiresAt()))
+}
+
+// handleVerifyToken reports that the request's token is valid, its role
+// and its scopes. It runs behind requireScope, which answers 401 for
+// missing, unknown or expired tokens. The older scope field is write for
+// tokens that can change tasks and read otherwise. Tokens that never expire
+// have no expires_at.
+func (s *Server) handleVerifyToken(w http.ResponseWriter, r *http.Request) {
+	info := requestToken(r)
+	scope := "read"
+	if info.hasScope(ScopeTasksWrite) {
+		scope = "write"
+	}
+	response := map[string]interface{}{
+		"valid":  true,
+		"role":   info.role,
+		"scope":  scope,
+		"scopes": info.scopes,
 	}
+	if !info.expiresAt.IsZero() {
+		response["expires_at"] = info.expiresAt.UTC().Format(time.RFC3339)
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// Router builds the HTTP routes for the server. API endpoints listed in
+// Config.DisabledEndpoints are not registered at all; an unknown name in that
+// list is a configuration error. The routes are wrapped in the CORS
+// middleware so preflight requests never reach token authentication, and
+// rate limiting comes before the concurrency limit so that rejected clients
+// don't take up slots. Requests for other workspaces are handed to their
+// routes last.
+func (s *Server) Router() (http.Handler, error) {
+	r, err := s.routes()
+	if err != nil {
+		return nil, err
+	}
+	return tracingMiddleware(s.loggingMiddleware(s.corsMiddleware(s.rateLimitMiddleware(s.concurrencyLimitMiddleware(s.timeZoneMiddleware(s.workspaceMiddleware(s.storageRefreshMiddleware(r)))))))), nil
+}
+
+// routes registers the server's routes without middleware. A workspace's
+// server leaves out rootOnlyRoutes.
+func (s *Server) routes() (*mux.Router, error) {
+	disabled := make(map[string]bool)
+	for _, name := range s.config.DisabledEndpoints {
+		disabled[name] = true
+	}
+	known := make(map[string]bool)
+
+	r := mux.NewRouter()
+
+	// Serve static files (HTML/CSS/JS)
+	files := http.FileServer(http.FS(s.static))
+	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", files))
+
+	// Serve UI at root; the file server answers / with index.html
+	r.Handle("/", files).Methods("GET")
+
+	// API routes
+	api := r.PathPrefix("/api/v1").Subrouter()
+	var routes []apiRoute
+	handle := func(name, method, path string, handler http.HandlerFunc) {
+		known[name] = true
+		if disabled[name] || (s.workspace != "" && rootOnlyRoutes[name]) {
+			return
+		}
+		routes = append(routes, apiRoute{name: name, method: method, path: path})
+		api.HandleFunc(path, traceRoute(method, "/api/v1"+path, handler)).Methods(method).Name(name)
+	}
+
+	// Token generation endpoint (requires the password once one is set)
+	handle("auth.token", "POST", "/auth/token", s.handleGenerateToken)
+	handle("auth.password", "POST", "/auth/password", s.requireScope(ScopeAdmin, s.handleChangePassword))
+	handle("auth.refresh", "POST", "/auth/token/refresh", s.requireScope("", s.handleRefreshToken))
+	handle("auth.verify", "GET", "/auth/verify", s.requireScope("", s.handleVerifyToken))
+	handle("auth.tokens", "GET", "/auth/tokens", s.requireScope(ScopeAdmin, s.handleListTokens))
+	handle("auth.revoke", "DELETE", "/auth/tokens/{id}", s.requireScope(ScopeAdmin, s.handleRevokeToken))
+	handle("auth.oidc.login", "GET", "/auth/oidc/login", s.handleOIDCLogin)
+	handle("auth.oidc.callback", "GET", "/auth/oidc/callback", s.handleOIDCCallback)
+
+	// GET requests - no authentication required
+	handle("tasks.list", "GET", "/tasks", s.handleGetTasks)
+	handle("tasks.pending", "GET", "/tasks/pending", s.handleGetPendingTasks)
+	handle("tasks.overdue", "GET", "/tasks/overdue", s.handleGetOverdueTasks)
+	handle("tasks.today", "GET", "/tasks/today", s.handleGetTodayTasks)
+	handle("tasks.search", "GET", "/tasks/search", s.handleSearchTasks)
+	handle("tasks.poll", "GET", "/tasks/poll", s.handlePollChanges)
+	handle("calendar.feed", "GET", "/tasks/export.ics", s.handleCalendarFeed)
+	handle("tasks.export", "GET", "/tasks/export.csv", s.handleExportCSV)
+	handle("tasks.export.md", "GET", "/tasks/export.md", s.handleExportMarkdown)
+	handle("tasks.trash", "GET", "/tasks/trash", s.handleGetTrash)
+	handle("tasks.archived", "GET", "/tasks/archive", s.handleGetArchive)
+	// Resolved from the caller's token, so it needs one
+	handle("tasks.assigned", "GET", "/tasks/assigned-to-me", s.requireScope(ScopeTasksRead, s.handleGetAssignedTasks))
+	handle("tasks.get", "GET", "/tasks/{id}", s.handleGetTask)
+	handle("tasks.history", "GET", "/tasks/{id}/history", s.handleGetHistory)
+	handle("tasks.blockers", "GET", "/tasks/{id}/blockers", s.handleGetBlockers)
+	handle("tasks.blocking", "GET", "/tasks/{id}/blocking", s.handleGetBlocking)
+	handle("comments.list", "GET", "/tasks/{id}/comments", s.handleGetComments)
+	handle("attachments.get", "GET", "/tasks/{id}/attachments/{aid}", s.handleDownloadAttachment)
+	handle("events", "GET", "/events", s.handleEvents)
+	handle("sync", "GET", "/ws", s.handleSync)
+	handle("stats", "GET", "/stats", s.handleGetStats)
+	handle("stats.streak", "GET", "/stats/streak", s.handleGetStreak)
+	handle("workflow", "GET", "/workflow", s.handleGetWorkflow)
+	handle("board", "GET", "/board", s.handleGetBoard)
+	handle("timesheet", "GET", "/timesheet", s.handleGetTimesheet)
+	handle("search", "GET", "/search", s.handleSearch)
+
+	// POST/PUT/DELETE requests - require a token with the tasks:write scope,
+	// or admin for webhooks and admin endpoints
+	handle("tasks.create", "POST", "/tasks", s.tokenAuthMiddleware(s.handleCreateTask))
+	handle("tasks.import", "POST", "/tasks/import", s.tokenAuthMiddleware(s.handleImportCSV))
+	handle("tasks.bulk", "POST", "/tasks/bulk", s.tokenAuthMiddleware(s.handleBulkTasks))
+	handle("import", "POST", "/import", s.tokenAuthMiddleware(s.handleImportFrom))
+	handle("tasks.update", "PUT", "/tasks/{id}", s.tokenAuthMiddleware(s.handleUpdateTask))
+	handle("tasks.patch", "PATCH", "/tasks/{id}", s.tokenAuthMiddleware(s.handlePatchTask))
+	handle("tasks.delete", "DELETE", "/tasks/{id}", s.tokenAuthMiddleware(s.handleDeleteTask))
+	handle("subtasks.create", "POST", "/tasks/{id}/subtasks", s.tokenAuthMiddleware(s.handleCreateSubtask))
+	handle("subtasks.update", "PUT", "/tasks/{id}/subtasks/{sid}", s.tokenAuthMiddleware(s.handleUpdateSubtask))
+	handle("subtasks.delete", "DELETE", "/tasks/{id}/subtasks/{sid}", s.tokenAuthMiddleware(s.handleDeleteSubtask))
+	handle("timer.start", "POST", "/tasks/{id}/timer/start", s.tokenAuthMiddleware(s.handleStartTimer))
+	handle("timer.stop", "POST", "/tasks/{id}/timer/stop", s.tokenAuthMiddleware(s.handleStopTimer))
+	handle("comments.create", "POST", "/tasks/{id}/comments", s.tokenAuthMiddleware(s.handleCreateComment))
+	handle("comments.delete", "DELETE", "/tasks/{id}/comments/{cid}", s.tokenAuthMiddleware(s.handleDeleteComment))
+	handle("attachments.upload", "POST", "/tasks/{id}/attachments", s.tokenAuthMiddleware(s.handleUploadAttachment))
+	handle("attachments.delete", "DELETE", "/tasks/{id}/attachments/{aid}", s.tokenAuthMiddleware(s.handleDeleteAttachment))
+	handle("tags.list", "GET", "/tags", s.handleGetTags)
+	handle("tags.add", "POST", "/tasks/{id}/tags", s.tokenAuthMiddleware(s.handleAddTags))
+	handle("tags.remove", "DELETE", "/tasks/{id}/tags/{tag}", s.tokenAuthMiddleware(s.handleRemoveTag))
+	handle("projects.list", "GET", "/projects", s.handleGetProjects)
+	handle("projects.get", "GET", "/projects/{id}", s.handleGetProject)
+	handle("projects.tasks", "GET", "/projects/{id}/tasks", s.handleGetProjectTasks)
+	handle("projects.create", "POST", "/projects", s.tokenAuthMiddleware(s.handleCreateProject))
+	handle("projects.update", "PUT", "/projects/{id}", s.tokenAuthMiddleware(s.handleUpdateProject))
+	handle("projects.delete", "DELETE", "/projects/{id}", s.tokenAuthMiddleware(s.handleDeleteProject))
+	handle("collaborators.create", "POST", "/projects/{id}/collaborators", s.tokenAuthMiddleware(s.handleAddCollaborator))
+	handle("collaborators.delete", "DELETE", "/projects/{id}/collaborators/{user}", s.requireScope("", s.handleRemoveCollaborator))
+	handle("invites.create", "POST", "/projects/{id}/invites", s.tokenAuthMiddleware(s.handleCreateInvite))
+	handle("invites.accept", "POST", "/invites/{token}", s.requireScope("", s.handleAcceptInvite))
+	handle("tasks.reopen", "POST", "/tasks/{id}/reopen", s.tokenAuthMiddleware(s.handleReopenTask))
+	handle("tasks.snooze", "POST", "/tasks/{id}/snooze", s.tokenAuthMiddleware(s.handleSnoozeTask))
+	handle("tasks.assign", "POST", "/tasks/{id}/assign", s.tokenAuthMiddleware(s.handleAssignTask))
+	handle("tasks.unassign", "POST", "/tasks/{id}/unassign", s.tokenAuthMiddleware(s.handleUnassignTask))
+	handle("tasks.restore", "POST", "/tasks/{id}/restore", s.tokenAuthMiddleware(s.handleRestoreTask))
+	handle("tasks.archive", "POST", "/tasks/{id}/archive", s.tokenAuthMiddleware(s.handleArchiveTask))
+	handle("tasks.revert", "POST", "/tasks/{id}/revert/{rev}", s.tokenAuthMiddleware(s.handleRevertTask))
+	handle("board.move", "POST", "/board/move", s.tokenAuthMiddleware(s.handleMoveOnBoard))
+	handle("tasks.share", "GET", "/tasks/{id}/share", s.requireScope(ScopeTasksRead, s.handleShareTask))
+	handle("shared.get", "GET", "/shared/{token}", s.handleGetSharedTask)
+	handle("calendar.token", "GET", "/calendar/token", s.requireScope(ScopeTasksRead, s.handleCalendarToken))
+	handle("preferences", "GET", "/notifications/preferences", s.requireScope("", s.handleGetNotificationPreferences))
+	handle("preferences.update", "PUT", "/notifications/preferences", s.requireScope("", s.handleUpdateNotificationPreferences))
+	handle("webhooks.list", "GET", "/webhooks", s.requireScope(ScopeAdmin, s.handleGetWebhooks))
+	handle("webhooks.create", "POST", "/webhooks", s.requireScope(ScopeAdmin, s.handleCreateWebhook))
+	handle("webhooks.delete", "DELETE", "/webhooks/{id}", s.requireScope(ScopeAdmin, s.handleDeleteWebhook))
+	handle("integrations.list", "GET", "/projects/{id}/integrations", s.requireScope(ScopeAdmin, s.handleGetIntegrations))
+	handle("integrations.create", "POST", "/projects/{id}/integrations", s.requireScope(ScopeAdmin, s.handleCreateIntegration))
+	handle("integrations.delete", "DELETE", "/projects/{id}/integrations/{iid}", s.requireScope(ScopeAdmin, s.handleDeleteIntegration))
+	handle("admin.config", "GET", "/admin/config", s.requireScope(ScopeAdmin, s.handleGetConfig))
+	handle("admin.export", "GET", "/admin/export", s.requireScope(ScopeAdmin, s.handleExport))
+	handle("admin.import", "POST", "/admin/import", s.requireScope(ScopeAdmin, s.handleImport))
+	handle("admin.backup", "POST", "/admin/backup", s.requireScope(ScopeAdmin, s.handleBackup))
+	handle("admin.restore", "POST", "/admin/restore", s.requireScope(ScopeAdmin, s.handleRestore))
+	handle("audit", "GET", "/audit", s.requireScope(ScopeAdmin, s.handleGetAudit))
+	handle("workspaces.list", "GET", "/workspaces", s.requireScope(ScopeAdmin, s.handleGetWorkspaces))
+	handle("workspaces.create", "POST", "/workspaces", s.requireScope(ScopeAdmin, s.handleCreateWorkspace))
+	handle("workspaces.delete", "DELETE", "/workspaces/{id}", s.requireScope(ScopeAdmin, s.handleDeleteWorkspace))
+	handle("workspaces.tokens", "POST", "/workspaces/{id}/tokens", s.requireScope(ScopeAdmin, s.handleCreateWorkspaceToken))
+	handle("workspaces.move", "POST", "/workspaces/{src}/tasks/{id}/move", s.requireScope(ScopeAdmin, s.handleMoveWorkspaceTask))
+	handle("workspaces.changes", "GET", "/changes", s.requireScope(ScopeAdmin, s.handleWorkspaceChanges))
+
+	// OpenAPI document of the enabled routes, built once they are all
+	// registered, and Swagger UI to browse it
+	var spec map[string]interface{}
+	handle("openapi", "GET", "/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, spec)
+	})
+	spec = buildOpenAPI(routes)
+	if !disabled["openapi"] {
+		r.HandleFunc("/docs", handleDocs).Methods("GET")
+	}
+
+	for _, name := range s.config.DisabledEndpoints {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown endpoint %q in disabled_endpoints", name)
+		}
+	}
+
+	// Serve config endpoint for UI (deprecated - will be removed)
+	r.HandleFunc("/api/config", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"message": "Use token-based authentication"})
+	}).Methods("GET")
+
+	// Health check endpoint (no auth required)
+	r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		if _, err := w.Write([]byte("OK")); err != nil {
+			requestLogger(r.Context()).Error("Failed to write response", "error", err)
+		}
+	}).Methods("GET")
+
+	// Profiling and runtime counters, only when explicitly enabled
+	if s.config.EnablePprof {
+		if err := s.registerDebugRoutes(r); err != nil {
+			return nil, err
+		}
+	}
+
+	// Readiness check of registered dependencies (no auth required)
+	r.HandleFunc("/readyz", s.handleReadiness).Methods("GET")
+
+	return r, nil
 }
 
 func main() {
+	// Client subcommands talk to a server instead of being one
+	if len(os.Args) > 1 {
+		if isCLICommand(os.Args[1]) {
+			os.Exit(runCLI(os.Args[1:], os.Stdout, os.Stderr, os.Getenv))
+		}
+	}
+
 	// Parse command line flags
 	helpFlag := false
 	versionFlag := false
+	adminTokenFlag := false
+	hashPasswordFlag := false
+	staticDir := ""
+	dataDirFlag, configFlag := "", ""
 	for _, arg := range os.Args[1:] {
 		if arg == "-h" || arg == "--help" {
 			helpFlag = true
@@ -461,29 +1853,153 @@ func main() {
 		if arg == "-v" || arg == "--version" {
 			versionFlag = true
 		}
+		if arg == "--admin-token" {
+			adminTokenFlag = true
+		}
+		if arg == "--hash-password" {
+			hashPasswordFlag = true
+		}
+		if dir, ok := strings.CutPrefix(arg, "--static-dir="); ok {
+			staticDir = dir
+		}
+		if dir, ok := strings.CutPrefix(arg, "--data-dir="); ok {
+			dataDirFlag = dir
+		}
+		if file, ok := strings.CutPrefix(arg, "--config="); ok {
+			configFlag = file
+		}
 	}
 
 	if helpFlag {
 		fmt.Println("TaskMate - Simple Task Management API")
 		fmt.Println("\nUsage:")
 		fmt.Println("  taskmate [options]")
+		fmt.Println("  taskmate <command> [flags]")
+		fmt.Println("\nCommands (client for a running server, or --offline for the local files):")
+		fmt.Println("  add <title>    Create a task (--description, --due, --priority, --tags, --project, --recurrence)")
+		fmt.Println("  list           List open tasks (--all, --status, --priority, --tag)")
+		fmt.Println("  done <id>...   Mark tasks completed")
+		fmt.Println("  rm <id>...     Delete tasks")
+		fmt.Println("  edit <id>      Change a task (--title, --status, --priority, --description, --due, --project, --recurrence)")
+		fmt.Println("  tui            Browse and edit tasks in an interactive terminal UI")
+		fmt.Println("  Server URL and token come from ~/.taskmate/config, TASKMATE_SERVER and TASKMATE_TOKEN")
+		fmt.Println("  taskmate <command> --help lists a command's flags")
 		fmt.Println("\nOptions:")
 		fmt.Println("  -h, --help     Show this help message")
 		fmt.Println("  -v, --version  Show version information")
+		fmt.Println("  --admin-token  Print an admin JWT signed with jwt_secret and exit")
+		fmt.Println("  --hash-password Read a password from stdin, print its hash for password_hash and exit")
+		fmt.Println("  --static-dir=DIR Serve the web UI from DIR instead of the copy built in, for development")
+		fmt.Println("  --data-dir=DIR Keep tasks, config and other data in DIR (default: current directory)")
+		fmt.Println("  --config=FILE  Config file (default: config.json in the data directory)")
 		fmt.Println("\nEnvironment Variables:")
-		fmt.Println("  TASKMATE_PORT     Server port (default: 8080)")
-		fmt.Println("  TASKMATE_API_KEY  Legacy API key (optional)")
+		fmt.Println("  TASKMATE_PORT       Server port (default: 8080)")
+		fmt.Println("  TASKMATE_API_KEY    Legacy API key (optional)")
+		fmt.Println("  TASKMATE_TIME_ZONE  IANA time zone for day boundaries (default: local)")
+		fmt.Println("  TASKMATE_JWT_SECRET Key for signing JWTs issued by /auth/token (optional)")
+		fmt.Println("  TASKMATE_PASSWORD_HASH Hash of the password /auth/token requires (optional)")
+		fmt.Println("  TASKMATE_TELEGRAM_TOKEN Bot token; runs the Telegram bot (optional)")
+		fmt.Println("  TASKMATE_DATA_DIR   Directory for tasks, config and other data (default: current directory)")
+		fmt.Println("  TASKMATE_CONFIG     Config file (default: config.json in the data directory)")
 		fmt.Println("\nConfiguration:")
-		fmt.Println("  Config file: config.json")
-		fmt.Println("  Data file:   tasks.json")
+		fmt.Println("  Config file: config.json in the data directory")
+		fmt.Println("  Data file:   tasks.json in the data directory")
 		fmt.Println("\nEndpoints:")
-		fmt.Println("  POST   /api/v1/auth/token     - Generate token (no auth required)")
+		fmt.Println("  POST   /api/v1/auth/token     - Generate token (password once one is set)")
+		fmt.Println("  POST   /api/v1/auth/token/refresh - Replace a token with a new one (requires token)")
+		fmt.Println("  POST   /api/v1/auth/password  - Change the master password (requires admin token)")
+		fmt.Println("  GET    /api/v1/auth/verify    - Check that a token is valid (requires token)")
+		fmt.Println("  GET    /api/v1/auth/oidc/login - Sign in through the OIDC provider (no auth)")
+		fmt.Println("  GET    /api/v1/auth/tokens    - List stored tokens (requires admin token)")
+		fmt.Println("  DELETE /api/v1/auth/tokens/{id} - Revoke a token (requires admin token)")
 		fmt.Println("  GET    /api/v1/tasks          - List all tasks (no auth)")
 		fmt.Println("  GET    /api/v1/tasks/pending  - List pending tasks (no auth)")
+		fmt.Println("  GET    /api/v1/tasks/overdue  - List open tasks past their due time (no auth)")
+		fmt.Println("  GET    /api/v1/tasks/today    - List open tasks due today in your time zone (no auth)")
+		fmt.Println("  GET    /api/v1/tasks/search   - Search tasks by ?q= (no auth)")
+		fmt.Println("  GET    /api/v1/tasks/poll     - Long-poll for changes since ?since= (no auth)")
+		fmt.Println("  GET    /api/v1/tasks/export.ics - iCalendar feed of due dates (no auth, or feed token)")
+		fmt.Println("  GET    /api/v1/tasks/export.csv - Download tasks as CSV (no auth)")
+		fmt.Println("  GET    /api/v1/tasks/export.md - Tasks as a Markdown checklist (no auth)")
 		fmt.Println("  GET    /api/v1/tasks/{id}     - Get task (no auth)")
+		fmt.Println("  GET    /api/v1/tasks/{id}/history - Task revisions (no auth)")
+		fmt.Println("  GET    /api/v1/tasks/{id}/blockers - Tasks this task is blocked by (no auth)")
+		fmt.Println("  GET    /api/v1/tasks/{id}/blocking - Tasks blocked by this task (no auth)")
+		fmt.Println("  GET    /api/v1/tasks/{id}/comments - Task comments, oldest first (no auth)")
+		fmt.Println("  GET    /api/v1/tasks/{id}/attachments/{aid} - Download an attachment (no auth)")
+		fmt.Println("  GET    /api/v1/events         - Stream task changes as Server-Sent Events (no auth)")
+		fmt.Println("  GET    /api/v1/ws             - WebSocket sync: subscribe to changes, mutations need a token")
+		fmt.Println("  GET    /api/v1/stats          - Task counts (no auth)")
+		fmt.Println("  GET    /api/v1/stats/streak   - Completion streak (no auth)")
+		fmt.Println("  GET    /api/v1/workflow       - Task statuses and allowed transitions (no auth)")
+		fmt.Println("  GET    /api/v1/board          - Tasks in one column per status (no auth)")
+		fmt.Println("  GET    /api/v1/timesheet      - Time tracked by day and project (no auth)")
+		fmt.Println("  GET    /api/v1/search         - Search all task fields by ?q= (no auth)")
 		fmt.Println("  POST   /api/v1/tasks          - Create task (requires token)")
+		fmt.Println("  POST   /api/v1/tasks/import   - Create tasks from a CSV upload (requires token)")
+		fmt.Println("  POST   /api/v1/tasks/bulk     - Apply a batch of creates, updates, completions and deletes (requires token)")
+		fmt.Println("  POST   /api/v1/import?format= - Import a Todoist or Trello export (requires token)")
 		fmt.Println("  PUT    /api/v1/tasks/{id}     - Update task (requires token)")
-		fmt.Println("  DELETE /api/v1/tasks/{id}     - Delete task (requires token)")
+		fmt.Println("  PATCH  /api/v1/tasks/{id}     - Update only the given fields (requires token)")
+		fmt.Println("  DELETE /api/v1/tasks/{id}     - Move task to the trash (requires token)")
+		fmt.Println("  GET    /api/v1/tasks/trash    - List deleted tasks")
+		fmt.Println("  GET    /api/v1/tasks/archive  - List archived tasks")
+		fmt.Println("  GET    /api/v1/tasks/assigned-to-me - List the tasks assigned to you (requires token)")
+		fmt.Println("  POST   /api/v1/tasks/{id}/subtasks - Add a checklist item (requires token)")
+		fmt.Println("  PUT    /api/v1/tasks/{id}/subtasks/{sid} - Update a checklist item (requires token)")
+		fmt.Println("  DELETE /api/v1/tasks/{id}/subtasks/{sid} - Delete a checklist item (requires token)")
+		fmt.Println("  POST   /api/v1/tasks/{id}/timer/start - Start tracking time on a task (requires token)")
+		fmt.Println("  POST   /api/v1/tasks/{id}/timer/stop - Stop your timer on a task (requires token)")
+		fmt.Println("  POST   /api/v1/tasks/{id}/comments - Comment on a task (requires token)")
+		fmt.Println("  DELETE /api/v1/tasks/{id}/comments/{cid} - Delete a comment (requires token)")
+		fmt.Println("  POST   /api/v1/tasks/{id}/attachments - Upload a file to a task (requires token)")
+		fmt.Println("  DELETE /api/v1/tasks/{id}/attachments/{aid} - Delete an attachment (requires token)")
+		fmt.Println("  GET    /api/v1/tags - Tag usage counts (no auth)")
+		fmt.Println("  POST   /api/v1/tasks/{id}/tags - Add tags to a task (requires token)")
+		fmt.Println("  DELETE /api/v1/tasks/{id}/tags/{tag} - Remove a tag from a task (requires token)")
+		fmt.Println("  GET    /api/v1/projects - List projects (no auth)")
+		fmt.Println("  GET    /api/v1/projects/{id} - Get a project (no auth)")
+		fmt.Println("  GET    /api/v1/projects/{id}/tasks - Get a project's tasks (no auth)")
+		fmt.Println("  POST   /api/v1/projects - Create a project (requires token)")
+		fmt.Println("  PUT    /api/v1/projects/{id} - Update a project (requires token)")
+		fmt.Println("  DELETE /api/v1/projects/{id} - Delete an empty project (requires token)")
+		fmt.Println("  POST   /api/v1/projects/{id}/collaborators - Share a project with a user (requires token, owner)")
+		fmt.Println("  DELETE /api/v1/projects/{id}/collaborators/{user} - Stop sharing a project with a user (requires token, owner or that user)")
+		fmt.Println("  POST   /api/v1/projects/{id}/invites - Create a link to join a project (requires token, owner)")
+		fmt.Println("  POST   /api/v1/invites/{token} - Join a project through an invite link (requires token)")
+		fmt.Println("  POST   /api/v1/tasks/{id}/reopen - Reopen a completed task (requires token)")
+		fmt.Println("  POST   /api/v1/tasks/{id}/snooze - Push the due date forward (requires token)")
+		fmt.Println("  POST   /api/v1/tasks/{id}/assign - Assign a task to a user or yourself (requires token)")
+		fmt.Println("  POST   /api/v1/tasks/{id}/unassign - Clear a task's assignee (requires token)")
+		fmt.Println("  POST   /api/v1/tasks/{id}/restore - Restore a deleted task (requires token)")
+		fmt.Println("  POST   /api/v1/tasks/{id}/archive - Archive a completed task (requires token)")
+		fmt.Println("  POST   /api/v1/tasks/{id}/revert/{rev} - Revert a task to a revision (requires token)")
+		fmt.Println("  POST   /api/v1/board/move     - Move a task within or between board columns (requires token)")
+		fmt.Println("  GET    /api/v1/tasks/{id}/share - Create a read-only share link (requires token)")
+		fmt.Println("  GET    /api/v1/shared/{token} - Get a shared task (no auth)")
+		fmt.Println("  GET    /api/v1/calendar/token - Calendar feed URL with its token (requires token)")
+		fmt.Println("  GET    /api/v1/notifications/preferences - Which emails you get (requires token)")
+		fmt.Println("  PUT    /api/v1/notifications/preferences - Turn emails on or off for yourself (requires token)")
+		fmt.Println("  GET    /api/v1/webhooks - List webhooks (requires admin token)")
+		fmt.Println("  POST   /api/v1/webhooks - Register a webhook for task events (requires admin token)")
+		fmt.Println("  DELETE /api/v1/webhooks/{id} - Delete a webhook (requires admin token)")
+		fmt.Println("  GET    /api/v1/projects/{id}/integrations - List a project's Slack and Discord integrations (requires admin token)")
+		fmt.Println("  POST   /api/v1/projects/{id}/integrations - Post a project's events to Slack or Discord (requires admin token)")
+		fmt.Println("  DELETE /api/v1/projects/{id}/integrations/{iid} - Delete an integration (requires admin token)")
+		fmt.Println("  GET    /api/v1/admin/config   - Effective config, secrets redacted (requires admin token)")
+		fmt.Println("  GET    /api/v1/admin/export   - Download zip backup (requires admin token)")
+		fmt.Println("  POST   /api/v1/admin/import   - Restore zip backup (requires admin token)")
+		fmt.Println("  POST   /api/v1/admin/backup   - Download versioned backup (requires admin token)")
+		fmt.Println("  POST   /api/v1/admin/restore  - Restore versioned backup (requires admin token)")
+		fmt.Println("  GET    /api/v1/audit          - Audit log of changes (requires admin token)")
+		fmt.Println("  GET    /api/v1/workspaces     - List workspaces (requires admin token)")
+		fmt.Println("  POST   /api/v1/workspaces     - Create a workspace with its own tasks and tokens (requires admin token)")
+		fmt.Println("  DELETE /api/v1/workspaces/{id} - Delete a workspace and revoke its tokens (requires admin token)")
+		fmt.Println("  POST   /api/v1/workspaces/{id}/tokens - Issue a token for a workspace (requires admin token)")
+		fmt.Println("  POST   /api/v1/workspaces/{src}/tasks/{id}/move - Move a task to another workspace (requires admin token)")
+		fmt.Println("  GET    /api/v1/changes?since=&workspaces= - Changes in several workspaces since a revision (requires admin token)")
+		fmt.Println("  GET    /api/v1/openapi.json   - OpenAPI document (no auth)")
+		fmt.Println("  GET    /docs                  - Swagger UI for the API (no auth)")
 		os.Exit(0)
 	}
 
@@ -494,70 +2010,197 @@ func main() {
 	}
 
 	// Load configuration
+	if err := configurePaths(dataDirFlag, configFlag, os.Getenv); err != nil {
+		log.Fatalf("Failed to create data directory: %v", err)
+	}
 	config, err := LoadConfig()
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
+	// The log package writes through this too
+	slog.SetDefault(newLogger(config.LogFormat, os.Stderr))
+	if tracing, err = newTracingFromEnv(context.Background()); err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
 
-	port := config.Port
-	dataFile := "tasks.json"
-	server := NewServer(config, dataFile)
-
-	r := mux.NewRouter()
-
-	// Serve static files (HTML/CSS/JS)
-	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
-
-	// Serve UI at root
-	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, "static/index.html")
-	}).Methods("GET")
-
-	// API routes
-	api := r.PathPrefix("/api/v1").Subrouter()
+	if hashPasswordFlag {
+		pw, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			log.Fatalf("Failed to read password: %v", err)
+		}
+		pw = strings.TrimRight(pw, "\r\n")
+		if err := config.PasswordPolicy.validatePassword(pw); err != nil {
+			log.Fatalf("Invalid password: %v", err)
+		}
+		hash, err := hashPassword(pw)
+		if err != nil {
+			log.Fatalf("Failed to hash password: %v", err)
+		}
+		fmt.Println(hash)
+		os.Exit(0)
+	}
 
-	// Token generation endpoint (requires password)
-	api.HandleFunc("/auth/token", server.handleGenerateToken).Methods("POST")
+	// With JWTs nothing records a first token, so the first admin token
+	// comes from whoever can read the secret
+	if adminTokenFlag {
+		if config.JWTSecret == "" {
+			log.Fatal("--admin-token needs jwt_secret or TASKMATE_JWT_SECRET")
+		}
+		token, _, err := issueJWT(config, RoleAdmin, nil, time.Now())
+		if err != nil {
+			log.Fatalf("Failed to issue token: %v", err)
+		}
+		fmt.Println(token)
+		os.Exit(0)
+	}
 
-	// GET requests - no authentication required
-	api.HandleFunc("/tasks", server.handleGetTasks).Methods("GET")
-	api.HandleFunc("/tasks/pending", server.handleGetPendingTasks).Methods("GET")
-	api.HandleFunc("/tasks/{id}", server.handleGetTask).Methods("GET")
+	port := config.Port
+	dataFile := dataPath("tasks.json")
+	store, err := OpenStore(config, dataFile)
+	if err != nil {
+		log.Fatalf("Failed to open storage: %v", err)
+	}
+	store.audit, err = openAuditLog(config.auditLogPath())
+	if err != nil {
+		log.Fatalf("Failed to open audit log: %v", err)
+	}
+	server := NewServerWithStore(config, store)
+	if staticDir != "" {
+		server.static = staticFiles(staticDir)
+	}
+	if err := server.openWorkspaces(); err != nil {
+		log.Fatalf("Failed to open workspaces: %v", err)
+	}
 
-	// POST/PUT/DELETE requests - require token authentication
-	api.HandleFunc("/tasks", server.tokenAuthMiddleware(server.handleCreateTask)).Methods("POST")
-	api.HandleFunc("/tasks/{id}", server.tokenAuthMiddleware(server.handleUpdateTask)).Methods("PUT")
-	api.HandleFunc("/tasks/{id}", server.tokenAuthMiddleware(server.handleDeleteTask)).Methods("DELETE")
+	r, err := server.Router()
+	if err != nil {
+		log.Fatalf("Failed to build router: %v", err)
+	}
 
-	// Serve config endpoint for UI (deprecated - will be removed)
-	r.HandleFunc("/api/config", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(map[string]string{"message": "Use token-based authentication"}); err != nil {
-			log.Printf("Failed to encode response: %v", err)
-		}
-	}).Methods("GET")
+	seedFile := config.SeedFile
+	if seedFile == "" {
+		seedFile = defaultSeedFile
+	}
+	seedFile = dataPath(seedFile)
+	seeded, err := server.store.SeedIfEmpty(seedFile)
+	switch {
+	case errors.Is(err, os.ErrNotExist) && config.SeedFile == "":
+		// No seed file configured or present
+	case err != nil:
+		log.Fatalf("Failed to seed tasks from %s: %v", seedFile, err)
+	case seeded > 0:
+		fmt.Printf("Seeded %d task(s) from %s\n", seeded, seedFile)
+	}
 
-	// Health check endpoint (no auth required)
-	r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-		if _, err := w.Write([]byte("OK")); err != nil {
-			log.Printf("Failed to write response: %v", err)
-		}
-	}).Methods("GET")
+	server.startBackground()
 
+	scheme := "http"
+	if config.TLS.enabled() {
+		scheme = "https"
+	}
 	fmt.Println("TaskMate API server starting on :" + port)
 	fmt.Printf("Data File: %s\n", dataFile)
-	fmt.Println("\n🌐 Web UI: http://localhost:" + port)
-	fmt.Println("Health check: http://localhost:" + port + "/health")
-	fmt.Println("API Base URL: http://localhost:" + port + "/api/v1")
+	fmt.Println("\n🌐 Web UI: " + scheme + "://localhost:" + port)
+	fmt.Println("Health check: " + scheme + "://localhost:" + port + "/health")
+	fmt.Println("Readiness:    " + scheme + "://localhost:" + port + "/readyz")
+	fmt.Println("API Base URL: " + scheme + "://localhost:" + port + "/api/v1")
+	fmt.Println("API Docs:     " + scheme + "://localhost:" + port + "/docs")
 	fmt.Println("\nEndpoints:")
-	fmt.Println("  POST   /api/v1/auth/token     - Generate token (no auth required)")
+	fmt.Println("  POST   /api/v1/auth/token     - Generate token (password once one is set)")
+	fmt.Println("  POST   /api/v1/auth/token/refresh - Replace a token with a new one (requires token)")
+	fmt.Println("  POST   /api/v1/auth/password  - Change the master password (requires admin token)")
+	fmt.Println("  GET    /api/v1/auth/verify    - Check that a token is valid (requires token)")
+	fmt.Println("  GET    /api/v1/auth/oidc/login - Sign in through the OIDC provider (no auth)")
+	fmt.Println("  GET    /api/v1/auth/tokens    - List stored tokens (requires admin token)")
+	fmt.Println("  DELETE /api/v1/auth/tokens/{id} - Revoke a token (requires admin token)")
 	fmt.Println("  GET    /api/v1/tasks          - List all tasks (no auth)")
 	fmt.Println("  GET    /api/v1/tasks/pending  - List pending tasks (no auth)")
+	fmt.Println("  GET    /api/v1/tasks/overdue  - List open tasks past their due time (no auth)")
+	fmt.Println("  GET    /api/v1/tasks/today    - List open tasks due today in your time zone (no auth)")
+	fmt.Println("  GET    /api/v1/tasks/search   - Search tasks by ?q= (no auth)")
+	fmt.Println("  GET    /api/v1/tasks/poll     - Long-poll for changes since ?since= (no auth)")
+	fmt.Println("  GET    /api/v1/tasks/export.ics - iCalendar feed of due dates (no auth, or feed token)")
+	fmt.Println("  GET    /api/v1/tasks/export.csv - Download tasks as CSV (no auth)")
+	fmt.Println("  GET    /api/v1/tasks/export.md - Tasks as a Markdown checklist (no auth)")
 	fmt.Println("  GET    /api/v1/tasks/{id}     - Get task (no auth)")
+	fmt.Println("  GET    /api/v1/tasks/{id}/history - Task revisions (no auth)")
+	fmt.Println("  GET    /api/v1/tasks/{id}/blockers - Tasks this task is blocked by (no auth)")
+	fmt.Println("  GET    /api/v1/tasks/{id}/blocking - Tasks blocked by this task (no auth)")
+	fmt.Println("  GET    /api/v1/tasks/{id}/comments - Task comments, oldest first (no auth)")
+	fmt.Println("  GET    /api/v1/tasks/{id}/attachments/{aid} - Download an attachment (no auth)")
+	fmt.Println("  GET    /api/v1/events         - Stream task changes as Server-Sent Events (no auth)")
+	fmt.Println("  GET    /api/v1/ws             - WebSocket sync: subscribe to changes, mutations need a token")
+	fmt.Println("  GET    /api/v1/stats          - Task counts (no auth)")
+	fmt.Println("  GET    /api/v1/stats/streak   - Completion streak (no auth)")
+	fmt.Println("  GET    /api/v1/workflow       - Task statuses and allowed transitions (no auth)")
+	fmt.Println("  GET    /api/v1/board          - Tasks in one column per status (no auth)")
+	fmt.Println("  GET    /api/v1/timesheet      - Time tracked by day and project (no auth)")
+	fmt.Println("  GET    /api/v1/search         - Search all task fields by ?q= (no auth)")
 	fmt.Println("  POST   /api/v1/tasks          - Create task (requires token)")
+	fmt.Println("  POST   /api/v1/tasks/import   - Create tasks from a CSV upload (requires token)")
+	fmt.Println("  POST   /api/v1/tasks/bulk     - Apply a batch of creates, updates, completions and deletes (requires token)")
+	fmt.Println("  POST   /api/v1/import?format= - Import a Todoist or Trello export (requires token)")
 	fmt.Println("  PUT    /api/v1/tasks/{id}     - Update task (requires token)")
-	fmt.Println("  DELETE /api/v1/tasks/{id}     - Delete task (requires token)")
+	fmt.Println("  PATCH  /api/v1/tasks/{id}     - Update only the given fields (requires token)")
+	fmt.Println("  DELETE /api/v1/tasks/{id}     - Move task to the trash (requires token)")
+	fmt.Println("  GET    /api/v1/tasks/trash    - List deleted tasks")
+	fmt.Println("  GET    /api/v1/tasks/archive  - List archived tasks")
+	fmt.Println("  GET    /api/v1/tasks/assigned-to-me - List the tasks assigned to you (requires token)")
+	fmt.Println("  POST   /api/v1/tasks/{id}/subtasks - Add a checklist item (requires token)")
+	fmt.Println("  PUT    /api/v1/tasks/{id}/subtasks/{sid} - Update a checklist item (requires token)")
+	fmt.Println("  DELETE /api/v1/tasks/{id}/subtasks/{sid} - Delete a checklist item (requires token)")
+	fmt.Println("  POST   /api/v1/tasks/{id}/timer/start - Start tracking time on a task (requires token)")
+	fmt.Println("  POST   /api/v1/tasks/{id}/timer/stop - Stop your timer on a task (requires token)")
+	fmt.Println("  POST   /api/v1/tasks/{id}/comments - Comment on a task (requires token)")
+	fmt.Println("  DELETE /api/v1/tasks/{id}/comments/{cid} - Delete a comment (requires token)")
+	fmt.Println("  POST   /api/v1/tasks/{id}/attachments - Upload a file to a task (requires token)")
+	fmt.Println("  DELETE /api/v1/tasks/{id}/attachments/{aid} - Delete an attachment (requires token)")
+	fmt.Println("  GET    /api/v1/tags - Tag usage counts (no auth)")
+	fmt.Println("  POST   /api/v1/tasks/{id}/tags - Add tags to a task (requires token)")
+	fmt.Println("  DELETE /api/v1/tasks/{id}/tags/{tag} - Remove a tag from a task (requires token)")
+	fmt.Println("  GET    /api/v1/projects - List projects (no auth)")
+	fmt.Println("  GET    /api/v1/projects/{id} - Get a project (no auth)")
+	fmt.Println("  GET    /api/v1/projects/{id}/tasks - Get a project's tasks (no auth)")
+	fmt.Println("  POST   /api/v1/projects - Create a project (requires token)")
+	fmt.Println("  PUT    /api/v1/projects/{id} - Update a project (requires token)")
+	fmt.Println("  DELETE /api/v1/projects/{id} - Delete an empty project (requires token)")
+	fmt.Println("  POST   /api/v1/projects/{id}/collaborators - Share a project with a user (requires token, owner)")
+	fmt.Println("  DELETE /api/v1/projects/{id}/collaborators/{user} - Stop sharing a project with a user (requires token, owner or that user)")
+	fmt.Println("  POST   /api/v1/projects/{id}/invites - Create a link to join a project (requires token, owner)")
+	fmt.Println("  POST   /api/v1/invites/{token} - Join a project through an invite link (requires token)")
+	fmt.Println("  POST   /api/v1/tasks/{id}/reopen - Reopen a completed task (requires token)")
+	fmt.Println("  POST   /api/v1/tasks/{id}/snooze - Push the due date forward (requires token)")
+	fmt.Println("  POST   /api/v1/tasks/{id}/assign - Assign a task to a user or yourself (requires token)")
+	fmt.Println("  POST   /api/v1/tasks/{id}/unassign - Clear a task's assignee (requires token)")
+	fmt.Println("  POST   /api/v1/tasks/{id}/restore - Restore a deleted task (requires token)")
+	fmt.Println("  POST   /api/v1/tasks/{id}/archive - Archive a completed task (requires token)")
+	fmt.Println("  POST   /api/v1/tasks/{id}/revert/{rev} - Revert a task to a revision (requires token)")
+	fmt.Println("  POST   /api/v1/board/move     - Move a task within or between board columns (requires token)")
+	fmt.Println("  GET    /api/v1/tasks/{id}/share - Create a read-only share link (requires token)")
+	fmt.Println("  GET    /api/v1/shared/{token} - Get a shared task (no auth)")
+	fmt.Println("  GET    /api/v1/calendar/token - Calendar feed URL with its token (requires token)")
+	fmt.Println("  GET    /api/v1/notifications/preferences - Which emails you get (requires token)")
+	fmt.Println("  PUT    /api/v1/notifications/preferences - Turn emails on or off for yourself (requires token)")
+	fmt.Println("  GET    /api/v1/webhooks - List webhooks (requires admin token)")
+	fmt.Println("  POST   /api/v1/webhooks - Register a webhook for task events (requires admin token)")
+	fmt.Println("  DELETE /api/v1/webhooks/{id} - Delete a webhook (requires admin token)")
+	fmt.Println("  GET    /api/v1/projects/{id}/integrations - List a project's Slack and Discord integrations (requires admin token)")
+	fmt.Println("  POST   /api/v1/projects/{id}/integrations - Post a project's events to Slack or Discord (requires admin token)")
+	fmt.Println("  DELETE /api/v1/projects/{id}/integrations/{iid} - Delete an integration (requires admin token)")
+	fmt.Println("  GET    /api/v1/admin/config   - Effective config, secrets redacted (requires admin token)")
+	fmt.Println("  GET    /api/v1/admin/export   - Download zip backup (requires admin token)")
+	fmt.Println("  POST   /api/v1/admin/import   - Restore zip backup (requires admin token)")
+	fmt.Println("  POST   /api/v1/admin/backup   - Download versioned backup (requires admin token)")
+	fmt.Println("  POST   /api/v1/admin/restore  - Restore versioned backup (requires admin token)")
+	fmt.Println("  GET    /api/v1/audit          - Audit log of changes (requires admin token)")
+	fmt.Println("  GET    /api/v1/workspaces     - List workspaces (requires admin token)")
+	fmt.Println("  POST   /api/v1/workspaces     - Create a workspace with its own tasks and tokens (requires admin token)")
+	fmt.Println("  DELETE /api/v1/workspaces/{id} - Delete a workspace and revoke its tokens (requires admin token)")
+	fmt.Println("  POST   /api/v1/workspaces/{id}/tokens - Issue a token for a workspace (requires admin token)")
+	fmt.Println("  POST   /api/v1/workspaces/{src}/tasks/{id}/move - Move a task to another workspace (requires admin token)")
+	fmt.Println("  GET    /api/v1/changes?since=&workspaces= - Changes in several workspaces since a revision (requires admin token)")
+	fmt.Println("  GET    /api/v1/openapi.json   - OpenAPI document (no auth)")
+	fmt.Println("  GET    /docs                  - Swagger UI for the API (no auth)")
 
 	srv := &http.Server{
 		Addr:         ":" + port,
@@ -567,5 +2210,23 @@ func main() {
 		IdleTimeout:  60 * time.Second,
 	}
 
-	log.Fatal(srv.ListenAndServe())
+	stopped := make(chan error, 1)
+	go func() { stopped <- serveHTTP(srv, config.TLS) }()
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	select {
+	case err := <-stopped:
+		log.Fatal(err)
+	case sig := <-signals:
+		slog.Info("Shutting down", "signal", sig.String())
+	}
+	// A second signal skips draining
+	signal.Stop(signals)
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx, srv); err != nil {
+		log.Fatalf("Shutdown failed: %v", err)
+	}
+	slog.Info("Server stopped")
 }
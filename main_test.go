@@ -2,11 +2,13 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -24,6 +26,9 @@ func setupTestServer() (*Server, func()) {
 
 	cleanup := func() {
 		os.Remove(tmpFile)
+		os.Remove("test_tasks_projects.json")
+		os.Remove("test_tasks_history.json")
+		os.Remove("test_tasks_comments.json")
 	}
 
 	return server, cleanup
@@ -39,6 +44,56 @@ func TestHashString(t *testing.T) {
 	}
 }
 
+func TestSaveConfigLeavesOutEnvSettings(t *testing.T) {
+	dir := t.TempDir()
+	usePaths(t, dir, "", nil)
+	file := `{"port": "9090", "jwt_secret": "file-secret", "password_hash": "file-hash"}`
+	if err := os.WriteFile(configPath(), []byte(file), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range map[string]string{
+		"TASKMATE_PORT":               "",
+		"TASKMATE_JWT_SECRET":         "env-secret",
+		"TASKMATE_DB_URL":             "postgres://user:env-password@db/taskmate",
+		"TASKMATE_OIDC_CLIENT_SECRET": "env-oidc-secret",
+		"TASKMATE_SMTP_PASSWORD":      "env-smtp-password",
+		"TASKMATE_PASSWORD_HASH":      "env-hash",
+	} {
+		t.Setenv(name, value)
+	}
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.JWTSecret != "env-secret" || config.SMTP.Password != "env-smtp-password" {
+		t.Fatalf("config = %+v; want the environment's secrets", config)
+	}
+
+	// A setting changed after loading is saved
+	config.PasswordHash = "new-hash"
+	config.TokenHashes = append(config.TokenHashes, hashString("token"))
+	if err := SaveConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(configPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"env-secret", "env-password", "env-oidc-secret", "env-smtp-password"} {
+		if bytes.Contains(data, []byte(secret)) {
+			t.Errorf("saved config contains %q: %s", secret, data)
+		}
+	}
+	for _, kept := range []string{"file-secret", "new-hash", hashString("token")} {
+		if !bytes.Contains(data, []byte(kept)) {
+			t.Errorf("saved config lacks %q: %s", kept, data)
+		}
+	}
+	if config.JWTSecret != "env-secret" {
+		t.Errorf("JWTSecret = %q after saving; want the environment's", config.JWTSecret)
+	}
+}
+
 func TestGenerateTokenFunction(t *testing.T) {
 	token, err := generateToken()
 	if err != nil {
@@ -118,6 +173,49 @@ func TestGenerateToken(t *testing.T) {
 	}
 }
 
+func TestVerifyToken(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.TokenHashes = []string{hashString("stored-token")}
+
+	r, err := server.Router()
+	if err != nil {
+		t.Fatalf("Router() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		wantCode int
+	}{
+		{"valid", "stored-token", http.StatusOK},
+		{"invalid", "other-token", http.StatusUnauthorized},
+		{"missing", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/api/v1/auth/verify", nil)
+		if tt.token != "" {
+			req.Header.Set("X-API-Token", tt.token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.wantCode {
+			t.Errorf("%s: status = %d; want %d", tt.name, w.Code, tt.wantCode)
+			continue
+		}
+		if tt.wantCode != http.StatusOK {
+			continue
+		}
+		var response map[string]interface{}
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if response["valid"] != true || response["scope"] != "write" {
+			t.Errorf("response = %v; want valid write token", response)
+		}
+	}
+}
+
 func TestCreateTaskWithoutToken(t *testing.T) {
 	server, cleanup := setupTestServer()
 	defer cleanup()
@@ -143,11 +241,16 @@ func TestCreateTaskWithoutToken(t *testing.T) {
 func TestTaskStoreOperations(t *testing.T) {
 	tmpFile := "test_store.json"
 	defer os.Remove(tmpFile)
+	defer os.Remove("test_store_history.json")
 
 	store := NewTaskStore(tmpFile)
+	ctx := context.Background()
 
 	// Test Add
-	task := store.Add("Test Task", "Description", "2024-12-31", "high")
+	task, err := store.Add(ctx, "Test Task", "Description", dueOn("2024-12-31"), "high")
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
 	if task.ID != 1 {
 		t.Errorf("First task ID = %d; want 1", task.ID)
 	}
@@ -171,7 +274,10 @@ func TestTaskStoreOperations(t *testing.T) {
 	}
 
 	// Test Update
-	updated, exists := store.Update(1, "Updated Task", "New Description", "2024-12-31", "low", "completed")
+	updated, exists, err := store.Update(ctx, 1, "Updated Task", "New Description", dueOn("2024-12-31"), "low", "completed")
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
 	if !exists {
 		t.Error("Task should exist for update")
 	}
@@ -189,7 +295,10 @@ func TestTaskStoreOperations(t *testing.T) {
 	}
 
 	// Test Delete
-	deleted := store.Delete(1)
+	deleted, err := store.Delete(ctx, 1)
+	if err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
 	if !deleted {
 		t.Error("Task should be deleted")
 	}
@@ -199,3 +308,510 @@ func TestTaskStoreOperations(t *testing.T) {
 		t.Error("Deleted task should not exist")
 	}
 }
+
+func TestResponsesAreByteStable(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	for i := 0; i < 5; i++ {
+		server.store.Add(context.Background(), "Task", "Description", DueTime{}, "medium")
+	}
+
+	render := func() []byte {
+		w := httptest.NewRecorder()
+		server.handleGetTasks(w, httptest.NewRequest("GET", "/api/v1/tasks", nil))
+		return w.Body.Bytes()
+	}
+
+	first := render()
+	for i := 0; i < 10; i++ {
+		if !bytes.Equal(first, render()) {
+			t.Fatal("GET /tasks output differs between identical requests")
+		}
+	}
+
+	stats := map[string]int{"pending": 3, "completed": 2, "cancelled": 0, "in_progress": 1}
+	a := httptest.NewRecorder()
+	b := httptest.NewRecorder()
+	writeJSON(a, http.StatusOK, stats)
+	writeJSON(b, http.StatusOK, stats)
+	if !bytes.Equal(a.Body.Bytes(), b.Body.Bytes()) {
+		t.Errorf("map response not byte-identical: %s vs %s", a.Body.String(), b.Body.String())
+	}
+}
+
+func TestStoreRespectsCancelledContext(t *testing.T) {
+	tmpFile := "test_cancel.json"
+	defer os.Remove(tmpFile)
+	defer os.Remove("test_cancel_history.json")
+
+	store := NewTaskStore(tmpFile)
+	task, _ := store.Add(context.Background(), "Keep", "", DueTime{}, "medium")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := store.Add(ctx, "Dropped", "", DueTime{}, "medium"); err != context.Canceled {
+		t.Errorf("Add() error = %v; want context.Canceled", err)
+	}
+	if _, _, err := store.Update(ctx, task.ID, "Changed", "", DueTime{}, "low", "completed"); err != context.Canceled {
+		t.Errorf("Update() error = %v; want context.Canceled", err)
+	}
+	if _, err := store.Delete(ctx, task.ID); err != context.Canceled {
+		t.Errorf("Delete() error = %v; want context.Canceled", err)
+	}
+
+	all := store.GetAll()
+	if len(all) != 1 || all[0].Title != "Keep" {
+		t.Errorf("store modified by cancelled calls: %+v", all)
+	}
+}
+
+func TestDisabledEndpoints(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.DisabledEndpoints = []string{"auth.token", "tasks.create"}
+
+	r, err := server.Router()
+	if err != nil {
+		t.Fatalf("Router() error = %v", err)
+	}
+
+	for _, path := range []string{"/api/v1/auth/token", "/api/v1/tasks"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("POST", path, nil))
+		if w.Code != http.StatusNotFound && w.Code != http.StatusMethodNotAllowed {
+			t.Errorf("POST %s status = %d; want 404 or 405", path, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/tasks", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("GET /api/v1/tasks status = %d; want %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestDisabledEndpointsRejectsUnknownName(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.DisabledEndpoints = []string{"tasks.explode"}
+
+	if _, err := server.Router(); err == nil {
+		t.Error("Router() error = nil; want error for unknown endpoint name")
+	}
+}
+
+func TestSaveFailureReturns500(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	if _, err := server.store.Add(context.Background(), "Existing", "", DueTime{}, "medium"); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	// Point the store at a directory that doesn't exist so writes fail
+	server.store.storage.(*jsonBackend).path = "missing-dir/tasks.json"
+
+	update, _ := json.Marshal(map[string]string{"title": "Changed", "priority": "low", "status": "pending"})
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    []byte
+		handler http.HandlerFunc
+	}{
+		{"create", "POST", "/api/v1/tasks", []byte(`{"title":"New"}`), server.handleCreateTask},
+		{"update", "PUT", "/api/v1/tasks/1", update, server.handleUpdateTask},
+		{"delete", "DELETE", "/api/v1/tasks/1", nil, server.handleDeleteTask},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewReader(tt.body))
+			req = mux.SetURLVars(req, map[string]string{"id": "1"})
+			w := httptest.NewRecorder()
+			tt.handler(w, req)
+
+			if w.Code != http.StatusInternalServerError {
+				t.Fatalf("status = %d; want %d", w.Code, http.StatusInternalServerError)
+			}
+			var body map[string]interface{}
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatalf("Failed to decode error body: %v", err)
+			}
+			if body["error"] == "" || body["status"] != float64(http.StatusInternalServerError) {
+				t.Errorf("error body = %v", body)
+			}
+		})
+	}
+}
+
+func TestStoreRollsBackOnSaveFailure(t *testing.T) {
+	tmpFile := "test_rollback.json"
+	defer os.Remove(tmpFile)
+	defer os.Remove("test_rollback_history.json")
+
+	ctx := context.Background()
+	store := NewTaskStore(tmpFile)
+	original, err := store.Add(ctx, "Original", "Description", dueOn("2024-12-31"), "high")
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	store.storage.(*jsonBackend).path = "missing-dir/tasks.json"
+
+	t.Run("add", func(t *testing.T) {
+		if _, err := store.Add(ctx, "Lost", "", DueTime{}, "medium"); err == nil {
+			t.Fatal("Add() error = nil; want save error")
+		}
+		if n := len(store.GetAll()); n != 1 {
+			t.Errorf("task count after failed Add = %d; want 1", n)
+		}
+		if store.nextID != 2 {
+			t.Errorf("nextID after failed Add = %d; want 2", store.nextID)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		if _, _, err := store.Update(ctx, original.ID, "Changed", "", DueTime{}, "low", "completed"); err == nil {
+			t.Fatal("Update() error = nil; want save error")
+		}
+		task, _ := store.Get(original.ID)
+		if task.Title != "Original" || task.Priority != "high" || task.Status != "pending" || task.CompletedAt != nil {
+			t.Errorf("task after failed Update = %+v; want unchanged", task)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		if _, err := store.Delete(ctx, original.ID); err == nil {
+			t.Fatal("Delete() error = nil; want save error")
+		}
+		if _, exists := store.Get(original.ID); !exists {
+			t.Error("task missing after failed Delete")
+		}
+	})
+
+	// Once the file is writable again the next Add reuses the rolled-back ID
+	store.storage.(*jsonBackend).path = tmpFile
+	task, err := store.Add(ctx, "Next", "", DueTime{}, "medium")
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if task.ID != 2 {
+		t.Errorf("ID after recovery = %d; want 2", task.ID)
+	}
+}
+
+func TestPreflightSkipsTokenAuth(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.CORSAllowedOrigins = []string{"https://app.example.com"}
+
+	r, err := server.Router()
+	if err != nil {
+		t.Fatalf("Router() error = %v", err)
+	}
+
+	req := httptest.NewRequest("OPTIONS", "/api/v1/tasks", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", "X-API-Token, Content-Type")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("OPTIONS /api/v1/tasks status = %d; want %d", w.Code, http.StatusNoContent)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("Access-Control-Allow-Origin = %q; want https://app.example.com", got)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Headers"); got == "" {
+		t.Error("Access-Control-Allow-Headers missing from preflight response")
+	}
+
+	// Disallowed origins still get a successful preflight, just without CORS headers
+	req.Header.Set("Origin", "https://evil.example.com")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("OPTIONS from other origin status = %d; want %d", w.Code, http.StatusNoContent)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Access-Control-Allow-Origin = %q; want empty", got)
+	}
+}
+
+func TestCORSConfiguration(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.CORSAllowedOrigins = []string{"https://app.example.com"}
+	server.config.CORSAllowedMethods = []string{"GET", "POST"}
+	server.config.CORSAllowedHeaders = []string{"Content-Type", "X-API-Token", "If-Unmodified-Since"}
+	server.config.CORSAllowCredentials = true
+
+	r, err := server.Router()
+	if err != nil {
+		t.Fatalf("Router() error = %v", err)
+	}
+
+	req := httptest.NewRequest("OPTIONS", "/api/v1/tasks", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if got := w.Header().Get("Access-Control-Allow-Methods"); got != "GET, POST" {
+		t.Errorf("Access-Control-Allow-Methods = %q; want %q", got, "GET, POST")
+	}
+	if got := w.Header().Get("Access-Control-Allow-Headers"); got != "Content-Type, X-API-Token, If-Unmodified-Since" {
+		t.Errorf("Access-Control-Allow-Headers = %q", got)
+	}
+
+	req = httptest.NewRequest("GET", "/api/v1/tasks", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Errorf("Access-Control-Allow-Credentials = %q; want true", got)
+	}
+
+	req.Header.Set("Origin", "https://evil.example.com")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if got := w.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Errorf("Access-Control-Allow-Credentials for other origin = %q; want empty", got)
+	}
+
+	if err := validateCORS(&Config{CORSAllowedOrigins: []string{"*"}, CORSAllowCredentials: true}); err == nil {
+		t.Error("validateCORS accepted credentials with the * origin")
+	}
+}
+
+func TestScoreMatch(t *testing.T) {
+	tests := []struct {
+		title       string
+		description string
+		want        int
+	}{
+		{"Deploy", "", scoreTitleExact},
+		{"deploy to production", "", scoreTitlePrefix},
+		{"Production deploy", "", scoreTitle},
+		{"Release", "Deploy v2.0", scoreDescription},
+		{"Release", "Tag v2.0", 0},
+	}
+	for _, tt := range tests {
+		task := &Task{Title: tt.title, Description: tt.description}
+		if got := scoreMatch(task, "DEPLOY"); got != tt.want {
+			t.Errorf("scoreMatch(%q, %q) = %d; want %d", tt.title, tt.description, got, tt.want)
+		}
+	}
+}
+
+func TestSearchRelevanceSort(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	ctx := context.Background()
+	server.store.Add(ctx, "Write notes", "Prepare the deploy checklist", DueTime{}, "medium")
+	server.store.Add(ctx, "Unrelated", "Nothing to see", DueTime{}, "medium")
+	server.store.Add(ctx, "Deploy", "", DueTime{}, "high")
+
+	search := func(url string) []Task {
+		w := httptest.NewRecorder()
+		server.handleSearchTasks(w, httptest.NewRequest("GET", url, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s status = %d; want %d", url, w.Code, http.StatusOK)
+		}
+		var tasks []Task
+		if err := json.NewDecoder(w.Body).Decode(&tasks); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return tasks
+	}
+
+	created := search("/api/v1/tasks/search?q=deploy")
+	if len(created) != 2 || created[0].ID != 1 || created[1].ID != 3 {
+		t.Errorf("default order = %+v; want IDs [1 3]", created)
+	}
+
+	ranked := search("/api/v1/tasks/search?q=deploy&sort=relevance")
+	if len(ranked) != 2 || ranked[0].ID != 3 || ranked[1].ID != 1 {
+		t.Errorf("relevance order = %+v; want IDs [3 1]", ranked)
+	}
+}
+
+func TestAutoProgressOnEdit(t *testing.T) {
+	tmpFile := "test_autoprogress.json"
+	defer os.Remove(tmpFile)
+	defer os.Remove("test_autoprogress_history.json")
+
+	ctx := context.Background()
+	store := NewTaskStore(tmpFile)
+	store.autoProgressOnEdit = true
+
+	tests := []struct {
+		name       string
+		title      string
+		status     string
+		wantStatus string
+	}{
+		{"edit without status", "Edited", "", "in_progress"},
+		{"edit resending current status", "Edited", "pending", "in_progress"},
+		{"explicit status wins", "Edited", "completed", "completed"},
+		{"no field change", "Task", "pending", "pending"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task, err := store.Add(ctx, "Task", "", DueTime{}, "medium")
+			if err != nil {
+				t.Fatalf("Add() error = %v", err)
+			}
+			updated, _, err := store.Update(ctx, task.ID, tt.title, "", DueTime{}, "medium", tt.status)
+			if err != nil {
+				t.Fatalf("Update() error = %v", err)
+			}
+			if updated.Status != tt.wantStatus {
+				t.Errorf("status = %s; want %s", updated.Status, tt.wantStatus)
+			}
+		})
+	}
+
+	store.autoProgressOnEdit = false
+	task, _ := store.Add(ctx, "Task", "", DueTime{}, "medium")
+	updated, _, _ := store.Update(ctx, task.ID, "Edited", "", DueTime{}, "medium", "pending")
+	if updated.Status != "pending" {
+		t.Errorf("status with auto progress disabled = %s; want pending", updated.Status)
+	}
+}
+
+func TestGetTasksTextFormat(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	ctx := context.Background()
+	server.store.Add(ctx, "Plain", "", dueIn("2024-12-31", time.UTC), "high")
+	server.store.Add(ctx, "Tab\there\nand newline", "", DueTime{}, "low")
+
+	w := httptest.NewRecorder()
+	server.handleGetTasks(w, httptest.NewRequest("GET", "/api/v1/tasks?format=text", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d; want %d", w.Code, http.StatusOK)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Errorf("Content-Type = %q; want text/plain", ct)
+	}
+	want := "1\tpending\thigh\t2024-12-31T23:59:59Z\tPlain\n" +
+		"2\tpending\tlow\t\tTab\\there\\nand newline\n"
+	if w.Body.String() != want {
+		t.Errorf("body = %q; want %q", w.Body.String(), want)
+	}
+}
+
+func TestValidationStatusCodes(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	if _, err := server.store.Add(context.Background(), "Existing", "", DueTime{}, "medium"); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		body    string
+		handler http.HandlerFunc
+		want    int
+	}{
+		{"create malformed JSON", "POST", `{"title":`, server.handleCreateTask, http.StatusBadRequest},
+		{"create missing title", "POST", `{"title":"  "}`, server.handleCreateTask, http.StatusUnprocessableEntity},
+		{"update malformed JSON", "PUT", `not json`, server.handleUpdateTask, http.StatusBadRequest},
+		{"update missing title", "PUT", `{"description":"x"}`, server.handleUpdateTask, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/api/v1/tasks/1", bytes.NewBufferString(tt.body))
+			req = mux.SetURLVars(req, map[string]string{"id": "1"})
+			w := httptest.NewRecorder()
+			tt.handler(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d; want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateTaskAppliesDefaults(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.TaskDefaults = TaskDefaults{
+		Description: "## Acceptance criteria\n",
+		Priority:    "low",
+	}
+
+	create := func(body string) Task {
+		t.Helper()
+		w := httptest.NewRecorder()
+		server.handleCreateTask(w, httptest.NewRequest("POST", "/api/v1/tasks", bytes.NewBufferString(body)))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create status = %d; want %d", w.Code, http.StatusCreated)
+		}
+		var task Task
+		if err := json.NewDecoder(w.Body).Decode(&task); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return task
+	}
+
+	task := create(`{"title":"Defaults"}`)
+	if task.Description != "## Acceptance criteria\n" || task.Priority != "low" {
+		t.Errorf("task = %+v; want default description and priority", task)
+	}
+
+	task = create(`{"title":"Explicit","description":"Mine","priority":"high"}`)
+	if task.Description != "Mine" || task.Priority != "high" {
+		t.Errorf("task = %+v; want request values to win", task)
+	}
+
+	server.config.TaskDefaults = TaskDefaults{}
+	task = create(`{"title":"No defaults"}`)
+	if task.Description != "" || task.Priority != "medium" {
+		t.Errorf("task = %+v; want empty description and medium priority", task)
+	}
+}
+
+func TestDeleteIfUnmodifiedSince(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	updatedAt := time.Date(2024, time.March, 1, 12, 0, 0, 500, time.UTC)
+	server.store.now = func() time.Time { return updatedAt }
+	ctx := context.Background()
+	server.store.Add(ctx, "Shared", "", DueTime{}, "medium")
+	server.store.Add(ctx, "Other", "", DueTime{}, "medium")
+
+	del := func(id, header string) int {
+		req := httptest.NewRequest("DELETE", "/api/v1/tasks/"+id, nil)
+		req = mux.SetURLVars(req, map[string]string{"id": id})
+		req.Header.Set("If-Unmodified-Since", header)
+		w := httptest.NewRecorder()
+		server.handleDeleteTask(w, req)
+		return w.Code
+	}
+
+	before := updatedAt.Add(-time.Minute).Format(http.TimeFormat)
+	if code := del("1", before); code != http.StatusPreconditionFailed {
+		t.Errorf("delete with stale date status = %d; want %d", code, http.StatusPreconditionFailed)
+	}
+	if _, exists := server.store.Get(1); !exists {
+		t.Error("task deleted despite failed precondition")
+	}
+
+	// HTTP dates have second precision, so the exact second of the update matches
+	if code := del("1", updatedAt.Format(http.TimeFormat)); code != http.StatusNoContent {
+		t.Errorf("delete with matching date status = %d; want %d", code, http.StatusNoContent)
+	}
+	if _, exists := server.store.Get(1); exists {
+		t.Error("task still exists after successful conditional delete")
+	}
+
+	if code := del("2", "not a date"); code != http.StatusNoContent {
+		t.Errorf("delete with invalid date status = %d; want %d", code, http.StatusNoContent)
+	}
+}
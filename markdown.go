@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// markdownEscaper escapes the characters that would format a title in
+// GitHub-flavored Markdown, and keeps each task on one line
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "[", `\[`, "]", `\]`,
+	"<", `\<`, ">", `\>`, "#", `\#`, "|", `\|`,
+	"\r\n", " ", "\n", " ", "\r", " ",
+)
+
+// markdownStatusHeading returns the section heading of ?group_by=status
+// for status, e.g. "In progress" for in_progress
+func markdownStatusHeading(status string) string {
+	heading := strings.ReplaceAll(status, "_", " ")
+	return strings.ToUpper(heading[:1]) + heading[1:]
+}
+
+// handleExportMarkdown writes the tasks matching the GET /tasks filters as
+// a GitHub-style checklist under a heading per project (the default) or,
+// with ?group_by=status, per status. Subtasks are nested checklist items.
+func (s *Server) handleExportMarkdown(w http.ResponseWriter, r *http.Request) {
+	groupBy := r.URL.Query().Get("group_by")
+	if groupBy == "" {
+		groupBy = "project"
+	}
+	if groupBy != "project" && groupBy != "status" {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidQuery, "group_by must be project or status")
+		return
+	}
+	loc := s.requestLocation(r)
+	filter, err := parseTaskFilter(r.URL.Query(), loc)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidQuery, err.Error())
+		return
+	}
+	tasks := s.store.List(filter)
+	sortTasks(tasks, s.config.DefaultSort, s.config.DefaultOrder, s.store.priorities)
+
+	var b strings.Builder
+	b.WriteString("# Tasks\n")
+	if groupBy == "status" {
+		for _, status := range s.store.workflow.statuses {
+			writeMarkdownSection(&b, loc, markdownStatusHeading(status), tasks, func(t *Task) bool { return t.Status == status })
+		}
+	} else {
+		for _, project := range s.store.Projects() {
+			id := project.ID
+			writeMarkdownSection(&b, loc, project.Name, tasks, func(t *Task) bool { return t.ProjectID == id })
+		}
+		writeMarkdownSection(&b, loc, "No project", tasks, func(t *Task) bool {
+			_, exists := s.store.GetProject(t.ProjectID)
+			return !exists
+		})
+	}
+	if len(tasks) == 0 {
+		b.WriteString("\nNo tasks.\n")
+	}
+
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	if _, err := w.Write([]byte(b.String())); err != nil {
+		requestLogger(r.Context()).Error("Failed to write Markdown export", "error", err)
+	}
+}
+
+// writeMarkdownSection writes a heading and the tasks in it, or nothing if
+// no task is in it. Due dates are given as days in loc.
+func writeMarkdownSection(b *strings.Builder, loc *time.Location, heading string, tasks []*Task, in func(*Task) bool) {
+	wrote := false
+	for _, task := range tasks {
+		if !in(task) {
+			continue
+		}
+		if !wrote {
+			fmt.Fprintf(b, "\n## %s\n\n", markdownEscaper.Replace(heading))
+			wrote = true
+		}
+		b.WriteString(markdownTaskLine(task, loc) + "\n")
+		for _, sub := range task.Subtasks {
+			fmt.Fprintf(b, "  - %s %s\n", markdownCheckbox(sub.Done), markdownEscaper.Replace(sub.Title))
+		}
+	}
+}
+
+// markdownTaskLine formats a task as a checklist item with the day it is
+// due in loc, its priority and tags
+func markdownTaskLine(task *Task, loc *time.Location) string {
+	line := "- " + markdownCheckbox(task.Status == "completed") + " " + markdownEscaper.Replace(task.Title)
+	if !task.DueDate.IsZero() {
+		line += " (due " + task.DueDate.Day(loc) + ")"
+	}
+	if task.Status == "in_progress" {
+		line += " *in progress*"
+	}
+	if task.Priority != "" {
+		line += " `" + task.Priority + "`"
+	}
+	for _, tag := range task.Tags {
+		line += " `#" + strings.ReplaceAll(tag, "`", "'") + "`"
+	}
+	return line
+}
+
+// markdownCheckbox is a GitHub task list checkbox
+func markdownCheckbox(checked bool) string {
+	if checked {
+		return "[x]"
+	}
+	return "[ ]"
+}
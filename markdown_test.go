@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExportMarkdown(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	ctx := context.Background()
+	project, _ := server.store.AddProject(ctx, "Release 2.0", "")
+	server.store.AddTask(ctx, Task{Title: "Fix *all* the bugs", Priority: "high", DueDate: dueOn("2030-01-02"), ProjectID: project.ID, Tags: []string{"qa"}})
+	server.store.AddSubtask(ctx, 1, "Triage")
+	server.store.Add(ctx, "Water plants", "", DueTime{}, "low")
+	server.store.Patch(ctx, 2, map[string]string{"status": "completed"})
+	r, _ := server.Router()
+
+	tests := []struct {
+		query, want string
+	}{
+		{"", "# Tasks\n\n## Release 2.0\n\n- [ ] Fix \\*all\\* the bugs (due 2030-01-02) `high` `#qa`\n  - [ ] Triage\n\n## No project\n\n- [x] Water plants `low`\n"},
+		{"?group_by=status", "# Tasks\n\n## Pending\n\n- [ ] Fix \\*all\\* the bugs (due 2030-01-02) `high` `#qa`\n  - [ ] Triage\n\n## Completed\n\n- [x] Water plants `low`\n"},
+		{"?status=in_progress", "# Tasks\n\nNo tasks.\n"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/tasks/export.md"+tt.query, nil))
+		if w.Code != http.StatusOK || w.Body.String() != tt.want {
+			t.Errorf("GET export.md%s: status %d, body\n%s\nwant\n%s", tt.query, w.Code, w.Body.String(), tt.want)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/tasks/export.md?group_by=tag", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("group_by=tag: status %d; want 400", w.Code)
+	}
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// oidcStateTTL is how long a login may take between the redirect to the
+	// provider and the callback
+	oidcStateTTL = 10 * time.Minute
+	// oidcTimeout bounds a single request to the provider
+	oidcTimeout = 10 * time.Second
+	// oidcLabelPrefix starts the label of tokens issued by OIDC login; the
+	// rest is the identity
+	oidcLabelPrefix = "oidc:"
+)
+
+// OIDCConfig configures signing in through an OpenID Connect provider such
+// as Google or Keycloak. A successful login gets a TaskMate token whose role
+// comes from the identity.
+type OIDCConfig struct {
+	// Issuer is the provider's issuer URL, e.g. https://accounts.google.com.
+	// OIDC login is off when it is empty.
+	Issuer       string `json:"issuer,omitempty"`
+	ClientID     string `json:"client_id,omitempty"`
+	ClientSecret string `json:"client_secret,omitempty"`
+	// RedirectURL is this server's callback as registered with the provider,
+	// e.g. https://tasks.example.com/api/v1/auth/oidc/callback
+	RedirectURL string `json:"redirect_url,omitempty"`
+	// Users maps email addresses or subjects to roles
+	Users map[string]string `json:"users,omitempty"`
+	// DefaultRole is the role of identities not in Users; they are refused
+	// when it is empty
+	DefaultRole string `json:"default_role,omitempty"`
+}
+
+// validateOIDC checks that an enabled OIDC config is complete and only
+// names known roles
+func validateOIDC(c OIDCConfig) error {
+	if c.Issuer == "" {
+		return nil
+	}
+	if c.ClientID == "" || c.RedirectURL == "" {
+		return errors.New("client_id and redirect_url are required")
+	}
+	if _, ok := roleRanks[c.DefaultRole]; c.DefaultRole != "" && !ok {
+		return fmt.Errorf("unknown default_role %q", c.DefaultRole)
+	}
+	for identity, role := range c.Users {
+		if _, ok := roleRanks[role]; !ok {
+			return fmt.Errorf("unknown role %q for %s", role, identity)
+		}
+	}
+	return nil
+}
+
+// oidcProvider is the part of the provider's discovery document we use
+type oidcProvider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcClaims are the ID token claims we check
+type oidcClaims struct {
+	Issuer        string       `json:"iss"`
+	Subject       string       `json:"sub"`
+	Audience      oidcAudience `json:"aud"`
+	ExpiresAt     int64        `json:"exp"`
+	Nonce         string       `json:"nonce"`
+	Email         string       `json:"email"`
+	EmailVerified *bool        `json:"email_verified"`
+}
+
+// oidcAudience is the aud claim, which may be a string or a list
+type oidcAudience []string
+
+func (a *oidcAudience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = oidcAudience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// oidcClient talks to the provider. The discovery document and signing
+// keys are fetched on first use and the keys again when a token is signed
+// with one we don't know, so the provider can rotate them.
+type oidcClient struct {
+	config OIDCConfig
+	http   *http.Client
+
+	mu       sync.Mutex
+	provider *oidcProvider
+	keys     map[string]*rsa.PublicKey
+	// states holds the state of each login in progress and when it expires
+	states map[string]time.Time
+}
+
+// newOIDCClient returns a client for config, or nil if OIDC is off
+func newOIDCClient(config OIDCConfig) *oidcClient {
+	if config.Issuer == "" {
+		return nil
+	}
+	return &oidcClient{
+		config: config,
+		http:   &http.Client{Timeout: oidcTimeout},
+		states: make(map[string]time.Time),
+	}
+}
+
+// getJSON fetches rawURL and decodes the JSON response into v
+func (c *oidcClient) getJSON(ctx context.Context, rawURL string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", rawURL, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// discover returns the provider's endpoints
+func (c *oidcClient) discover(ctx context.Context) (*oidcProvider, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.provider != nil {
+		return c.provider, nil
+	}
+	issuer := strings.TrimSuffix(c.config.Issuer, "/")
+	var provider oidcProvider
+	if err := c.getJSON(ctx, issuer+"/.well-known/openid-configuration", &provider); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(provider.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("discovery document is for issuer %q", provider.Issuer)
+	}
+	c.provider = &provider
+	return c.provider, nil
+}
+
+// key returns the provider's RSA signing key with ID kid
+func (c *oidcClient) key(ctx context.Context, provider *oidcProvider, kid string) (*rsa.PublicKey, error) {
+	c.mu.Lock()
+	key, ok := c.keys[kid]
+	c.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := c.getJSON(ctx, provider.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+
+	c.mu.Lock()
+	c.keys = keys
+	c.mu.Unlock()
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("no signing key %q", kid)
+}
+
+// newState starts a login and returns its state, which is also used as the
+// ID token nonce
+func (c *oidcClient) newState(now time.Time) (string, error) {
+	state, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for stored, expiresAt := range c.states {
+		if !now.Before(expiresAt) {
+			delete(c.states, stored)
+		}
+	}
+	c.states[state] = now.Add(oidcStateTTL)
+	return state, nil
+}
+
+// takeState ends the login with state and reports whether it was started
+// here and hasn't expired
+func (c *oidcClient) takeState(state string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expiresAt, ok := c.states[state]
+	delete(c.states, state)
+	return ok && now.Before(expiresAt)
+}
+
+// exchange trades an authorization code for the provider's ID token
+func (c *oidcClient) exchange(ctx context.Context, provider *oidcProvider, code string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {c.config.RedirectURL},
+		"client_id":     {c.config.ClientID},
+		"client_secret": {c.config.ClientSecret},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("token endpoint: status %d: %s", resp.StatusCode, body)
+	}
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokens); err != nil {
+		return "", err
+	}
+	if tokens.IDToken == "" {
+		return "", errors.New("token endpoint returned no id_token")
+	}
+	return tokens.IDToken, nil
+}
+
+// errIDTokenInvalid is returned by verifyIDToken for tokens that fail a check
+var errIDTokenInvalid = errors.New("invalid id token")
+
+// verifyIDToken checks an RS256 ID token's signature, issuer, audience,
+// expiry at now and nonce, and returns its claims
+func (c *oidcClient) verifyIDToken(ctx context.Context, provider *oidcProvider, token, nonce string, now time.Time) (oidcClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return oidcClaims{}, errIDTokenInvalid
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || json.Unmarshal(headerJSON, &header) != nil || header.Alg != "RS256" {
+		return oidcClaims{}, errIDTokenInvalid
+	}
+	key, err := c.key(ctx, provider, header.Kid)
+	if err != nil {
+		return oidcClaims{}, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return oidcClaims{}, errIDTokenInvalid
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) != nil {
+		return oidcClaims{}, errIDTokenInvalid
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return oidcClaims{}, errIDTokenInvalid
+	}
+	var claims oidcClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return oidcClaims{}, errIDTokenInvalid
+	}
+	if claims.Issuer != provider.Issuer || !containsString(claims.Audience, c.config.ClientID) ||
+		now.Unix() >= claims.ExpiresAt || claims.Nonce != nonce || claims.Subject == "" {
+		return oidcClaims{}, errIDTokenInvalid
+	}
+	return claims, nil
+}
+
+// identity returns who the claims are for, the email address if the
+// provider vouches for it and the subject otherwise, and the role they map
+// to; the role is "" if the identity isn't allowed in
+func (c OIDCConfig) identity(claims oidcClaims) (string, string) {
+	identity := claims.Subject
+	if claims.Email != "" && (claims.EmailVerified == nil || *claims.EmailVerified) {
+		identity = claims.Email
+		if role, ok := c.Users[claims.Email]; ok {
+			return identity, role
+		}
+	}
+	if role, ok := c.Users[claims.Subject]; ok {
+		return identity, role
+	}
+	return identity, c.DefaultRole
+}
+
+// handleOIDCLogin redirects the browser to the provider to sign in
+func (s *Server) handleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if s.oidc == nil {
+		writeError(w, http.StatusNotFound, ErrCodeOIDCNotConfigured, "OIDC login is not configured")
+		return
+	}
+	provider, err := s.oidc.discover(r.Context())
+	if err != nil {
+		writeError(w, http.StatusBadGateway, ErrCodeOIDCProviderError, "Failed to reach the OIDC provider")
+		return
+	}
+	state, err := s.oidc.newState(s.now())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to start login")
+		return
+	}
+	query := url.Values{
+		"response_type": {"code"},
+		"client_id":     {s.oidc.config.ClientID},
+		"redirect_uri":  {s.oidc.config.RedirectURL},
+		"scope":         {"openid email"},
+		"state":         {state},
+		"nonce":         {state},
+	}
+	target := provider.AuthorizationEndpoint + "?" + query.Encode()
+	if strings.Contains(provider.AuthorizationEndpoint, "?") {
+		target = provider.AuthorizationEndpoint + "&" + query.Encode()
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// handleOIDCCallback finishes a login: it checks the state, trades the code
+// for an ID token, and issues a TaskMate token with the identity's role.
+// Logging in again replaces the token from the identity's last login.
+func (s *Server) handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if s.oidc == nil {
+		writeError(w, http.StatusNotFound, ErrCodeOIDCNotConfigured, "OIDC login is not configured")
+		return
+	}
+	query := r.URL.Query()
+	if reason := query.Get("error"); reason != "" {
+		writeError(w, http.StatusUnauthorized, ErrCodeOIDCLoginFailed, "Login failed: "+reason)
+		return
+	}
+	state := query.Get("state")
+	if !s.oidc.takeState(state, s.now()) {
+		writeError(w, http.StatusUnauthorized, ErrCodeOIDCLoginFailed, "Unknown or expired login state")
+		return
+	}
+	provider, err := s.oidc.discover(r.Context())
+	if err != nil {
+		writeError(w, http.StatusBadGateway, ErrCodeOIDCProviderError, "Failed to reach the OIDC provider")
+		return
+	}
+	idToken, err := s.oidc.exchange(r.Context(), provider, query.Get("code"))
+	if err != nil {
+		writeError(w, http.StatusBadGateway, ErrCodeOIDCProviderError, "Failed to exchange the authorization code")
+		return
+	}
+	claims, err := s.oidc.verifyIDToken(r.Context(), provider, idToken, state, s.now())
+	if errors.Is(err, errIDTokenInvalid) {
+		writeError(w, http.StatusUnauthorized, ErrCodeOIDCLoginFailed, "Invalid ID token")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, ErrCodeOIDCProviderError, "Failed to fetch the provider's signing keys")
+		return
+	}
+	identity, role := s.oidc.config.identity(claims)
+	if role == "" {
+		writeError(w, http.StatusForbidden, ErrCodeForbidden, "Identity not allowed")
+		return
+	}
+
+	var response map[string]interface{}
+	if s.config.JWTSecret != "" {
+		token, jwt, err := issueJWT(s.config, role, nil, s.now())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to generate token")
+			return
+		}
+		response = tokenResponse(token, jwt.Subject, role, nil, time.Unix(jwt.ExpiresAt, 0))
+	} else {
+		token, err := generateToken()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to generate token")
+			return
+		}
+		tokenHash := hashString(token)
+		label := oidcLabelPrefix + identity
+
+		s.mu.Lock()
+		var previous string
+		for hash, meta := range s.config.TokenMetadata {
+			if meta.Label == label {
+				previous = hash
+			}
+		}
+		meta, err := s.storeTokenLocked(tokenHash, role, nil, label, previous)
+		s.mu.Unlock()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeSaveFailed, "Failed to save token")
+			return
+		}
+		response = tokenResponse(token, tokenID(tokenHash), role, nil, meta.expiresAt())
+	}
+	response["identity"] = identity
+	writeJSON(w, http.StatusCreated, response)
+}
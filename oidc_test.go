@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// fakeOIDCProvider serves discovery, keys and a token endpoint that answers
+// every code with an ID token for claims, using the nonce of the last login
+type fakeOIDCProvider struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	claims map[string]interface{}
+}
+
+func newFakeOIDCProvider(t *testing.T) *fakeOIDCProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	p := &fakeOIDCProvider{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.URL,
+			"authorization_endpoint": p.URL + "/authorize",
+			"token_endpoint":         p.URL + "/token",
+			"jwks_uri":               p.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "good-code" || r.FormValue("client_secret") != "shh" {
+			http.Error(w, "invalid_grant", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": p.sign(t, p.claims)})
+	})
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *fakeOIDCProvider) sign(t *testing.T, claims map[string]interface{}) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","kid":"k1"}`))
+	payload, _ := json.Marshal(claims)
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("SignPKCS1v15() error = %v", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestOIDCLogin(t *testing.T) {
+	provider := newFakeOIDCProvider(t)
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.OIDC = OIDCConfig{
+		Issuer:       provider.URL,
+		ClientID:     "taskmate",
+		ClientSecret: "shh",
+		RedirectURL:  "http://tasks.example.com/api/v1/auth/oidc/callback",
+		Users:        map[string]string{"ada@example.com": RoleAdmin},
+	}
+	server.oidc = newOIDCClient(server.config.OIDC)
+	r, _ := server.Router()
+
+	login := func() string {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/auth/oidc/login", nil))
+		if w.Code != http.StatusFound {
+			t.Fatalf("login: status %d; want 302", w.Code)
+		}
+		location, _ := url.Parse(w.Header().Get("Location"))
+		if location.Path != "/authorize" || location.Query().Get("client_id") != "taskmate" {
+			t.Fatalf("login redirect = %s", location)
+		}
+		return location.Query().Get("state")
+	}
+	callback := func(state, email string) *httptest.ResponseRecorder {
+		provider.claims = map[string]interface{}{
+			"iss": provider.URL, "sub": "user-1", "aud": "taskmate", "nonce": state,
+			"exp": time.Now().Add(time.Hour).Unix(), "email": email, "email_verified": true,
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/auth/oidc/callback?code=good-code&state="+state, nil))
+		return w
+	}
+
+	w := callback(login(), "ada@example.com")
+	var body map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&body)
+	if w.Code != http.StatusCreated || body["identity"] != "ada@example.com" || body["role"] != RoleAdmin {
+		t.Fatalf("callback: status %d, body %v; want 201 admin token for ada", w.Code, body)
+	}
+	first := body["token"].(string)
+	if info, err := server.lookupToken(first); err != nil || info.role != RoleAdmin {
+		t.Errorf("lookupToken() = %+v, %v; want admin", info, err)
+	}
+
+	// Logging in again replaces the previous token
+	if w := callback(login(), "ada@example.com"); w.Code != http.StatusCreated {
+		t.Fatalf("second login: status %d; want 201", w.Code)
+	}
+	if _, err := server.lookupToken(first); err != errInvalidToken {
+		t.Errorf("first token after second login: error = %v; want %v", err, errInvalidToken)
+	}
+	if len(server.config.TokenHashes) != 1 {
+		t.Errorf("stored %d tokens; want 1", len(server.config.TokenHashes))
+	}
+
+	if w := callback(login(), "eve@example.com"); w.Code != http.StatusForbidden {
+		t.Errorf("unmapped identity: status %d; want 403", w.Code)
+	}
+	if w := callback("forged", "ada@example.com"); w.Code != http.StatusUnauthorized {
+		t.Errorf("unknown state: status %d; want 401", w.Code)
+	}
+	state := login()
+	callback(state, "ada@example.com")
+	if w := callback(state, "ada@example.com"); w.Code != http.StatusUnauthorized {
+		t.Errorf("reused state: status %d; want 401", w.Code)
+	}
+}
+
+func TestOIDCRejectsBadIDToken(t *testing.T) {
+	provider := newFakeOIDCProvider(t)
+	client := newOIDCClient(OIDCConfig{Issuer: provider.URL, ClientID: "taskmate"})
+	ctx := context.Background()
+	discovered, err := client.discover(ctx)
+	if err != nil {
+		t.Fatalf("discover() error = %v", err)
+	}
+	now := time.Now()
+	valid := map[string]interface{}{
+		"iss": provider.URL, "sub": "user-1", "aud": []string{"taskmate"}, "nonce": "n",
+		"exp": now.Add(time.Hour).Unix(),
+	}
+	if _, err := client.verifyIDToken(ctx, discovered, provider.sign(t, valid), "n", now); err != nil {
+		t.Fatalf("verifyIDToken(valid) error = %v", err)
+	}
+
+	tests := map[string]func(map[string]interface{}){
+		"other audience": func(c map[string]interface{}) { c["aud"] = "someone-else" },
+		"other issuer":   func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" },
+		"expired":        func(c map[string]interface{}) { c["exp"] = now.Add(-time.Minute).Unix() },
+		"wrong nonce":    func(c map[string]interface{}) { c["nonce"] = "other" },
+	}
+	for name, change := range tests {
+		claims := make(map[string]interface{})
+		for k, v := range valid {
+			claims[k] = v
+		}
+		change(claims)
+		if _, err := client.verifyIDToken(ctx, discovered, provider.sign(t, claims), "n", now); err != errIDTokenInvalid {
+			t.Errorf("%s: error = %v; want %v", name, err, errIDTokenInvalid)
+		}
+	}
+
+	token := provider.sign(t, valid)
+	if _, err := client.verifyIDToken(ctx, discovered, token[:len(token)-4]+"AAAA", "n", now); err != errIDTokenInvalid {
+		t.Errorf("tampered signature: error = %v; want %v", err, errIDTokenInvalid)
+	}
+}
+
+func TestValidateOIDC(t *testing.T) {
+	if err := validateOIDC(OIDCConfig{}); err != nil {
+		t.Errorf("validateOIDC(disabled) error = %v", err)
+	}
+	if err := validateOIDC(OIDCConfig{Issuer: "https://id.example.com"}); err == nil {
+		t.Error("validateOIDC accepted a config without client_id")
+	}
+	config := OIDCConfig{Issuer: "https://id.example.com", ClientID: "c", RedirectURL: "https://x/cb", DefaultRole: "owner"}
+	if err := validateOIDC(config); err == nil {
+		t.Error("validateOIDC accepted an unknown default_role")
+	}
+}
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// apiRoute is an endpoint registered by Router, as /api/v1 path
+type apiRoute struct {
+	name, method, path string
+}
+
+// anyToken in routeDoc.scope means any valid token is accepted
+const anyToken = "token"
+
+// routeDoc describes an API endpoint for the OpenAPI document. body and
+// response are zero values of the JSON request and response types, which
+// are reflected into schemas; nil means there is no JSON body.
+type routeDoc struct {
+	summary string
+	// scope is the scope the endpoint requires: empty for none, anyToken
+	// for any valid token
+	scope string
+	// query lists the query parameters as "name: description"
+	query []string
+	body  interface{}
+	// bodyContentType is the request body type when it isn't JSON, with
+	// bodySchema describing it (default: binary)
+	bodyContentType string
+	bodySchema      map[string]interface{}
+	// status is the success status (default 200)
+	status   int
+	response interface{}
+	// contentType is the success response type when it isn't JSON
+	contentType string
+}
+
+// taskListQuery are the query parameters of the task list endpoints
+var taskListQuery = []string{
+	"status: Comma-separated statuses to include",
+	"priority: Comma-separated priorities to include",
+	"tag: Comma-separated tags; tasks must have all of them",
+	"due_before: Only tasks due before this date (YYYY-MM-DD) in the request's time zone",
+	"due_after: Only tasks due after this date (YYYY-MM-DD) in the request's time zone",
+	"project_id: Only tasks in this project",
+	"assignee: Only tasks assigned to this user (token:<id> or user:<subject>)",
+	"sort: Field to sort by",
+	"order: asc or desc",
+	"page: Page number, starting at 1",
+	"limit: Page size",
+	"cursor: Cursor from X-Next-Cursor for the next page",
+	"format: json (default) or text",
+}
+
+// forceQuery is the query parameter of the task update endpoints
+var forceQuery = []string{"force: true to complete the task while its blockers are open"}
+
+// auditQuery are the query parameters of GET /audit
+var auditQuery = []string{
+	"type: task, project, comment or store",
+	"id: Record ID",
+	"actor: token:<id>, user:<subject> or system",
+	"action: create, update, delete, restore, archive, purge, revert or replace",
+	"since: Earliest entry time (RFC 3339)",
+	"until: Latest entry time (RFC 3339)",
+	"limit: Entries to return (default 100, at most 1000)",
+}
+
+// routeDocs documents every API route by name. A route without an entry
+// still appears in the document, with no summary.
+var routeDocs = map[string]routeDoc{
+	"auth.token":         {summary: "Generate a token (needs the master password once one is set)", body: tokenRequest{}, status: http.StatusCreated, response: map[string]interface{}{}},
+	"auth.password":      {summary: "Change the master password", scope: ScopeAdmin, body: passwordRequest{}, status: http.StatusNoContent},
+	"auth.refresh":       {summary: "Replace the request's token with a new one", scope: anyToken, status: http.StatusCreated, response: map[string]interface{}{}},
+	"auth.verify":        {summary: "Show the role and scopes of the request's token", scope: anyToken, response: map[string]interface{}{}},
+	"auth.tokens":        {summary: "List stored tokens", scope: ScopeAdmin, response: []tokenListItem{}},
+	"auth.revoke":        {summary: "Revoke a token by ID, or a JWT by its sub claim", scope: ScopeAdmin, status: http.StatusNoContent},
+	"auth.oidc.login":    {summary: "Start signing in with the OpenID Connect provider", status: http.StatusFound},
+	"auth.oidc.callback": {summary: "Finish an OpenID Connect sign-in and issue a token", query: []string{"code: Authorization code", "state: State from the login redirect"}, status: http.StatusCreated, response: map[string]interface{}{}},
+	"tasks.list":         {summary: "List tasks", query: taskListQuery, response: []publicTask{}},
+	"tasks.pending":      {summary: "List pending tasks", query: taskListQuery, response: []publicTask{}},
+	"tasks.overdue":      {summary: "List open tasks whose due time has passed", query: taskListQuery, response: []publicTask{}},
+	"tasks.today":        {summary: "List open tasks due today in the request's time zone", query: taskListQuery, response: []publicTask{}},
+	"tasks.search":       {summary: "Search task titles and descriptions", query: []string{"q: Search text", "sort: relevance or a task field"}, response: []publicTask{}},
+	"tasks.poll":         {summary: "Wait for task changes after a revision", query: []string{"since: Revision to wait for changes after", "timeout: Seconds to wait at most"}, response: pollResponse{}},
+	"tasks.assigned":     {summary: "List the tasks assigned to the caller", scope: ScopeTasksRead, query: taskListQuery, response: []publicTask{}},
+	"tasks.get":          {summary: "Get a task", response: publicTask{}},
+	"tasks.history":      {summary: "List a task's revisions, newest first", response: []historyEntry{}},
+	"tasks.blockers":     {summary: "List the tasks a task is blocked by", response: []publicTask{}},
+	"tasks.blocking":     {summary: "List the tasks blocked by a task", response: []publicTask{}},
+	"comments.list":      {summary: "List a task's comments, oldest first", response: []publicComment{}},
+	"attachments.get":    {summary: "Download an attachment", contentType: "application/octet-stream"},
+	"tasks.trash":        {summary: "List deleted tasks, most recently deleted first", response: []publicTask{}},
+	"tasks.archived":     {summary: "List archived tasks", query: taskListQuery, response: []publicTask{}},
+	"calendar.feed":      {summary: "iCalendar feed of tasks with due dates", query: append([]string{"component: vevent (default) or vtodo", "token: Feed token, required when calendar_feed_private is set"}, taskListQuery[:7]...), contentType: "text/calendar"},
+	"calendar.token":     {summary: "Calendar feed URL with its token", scope: ScopeTasksRead, response: map[string]interface{}{}},
+	"tasks.export":       {summary: "Download tasks as CSV", query: taskListQuery[:7], contentType: "text/csv"},
+	"tasks.export.md":    {summary: "Tasks as a Markdown checklist", query: append([]string{"group_by: project (default) or status"}, taskListQuery[:7]...), contentType: "text/markdown"},
+	"tasks.import": {summary: "Create tasks from a CSV file", scope: ScopeTasksWrite, bodyContentType: "multipart/form-data", bodySchema: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"file":    map[string]interface{}{"type": "string", "format": "binary"},
+			"mapping": map[string]interface{}{"type": "string", "description": "JSON object from CSV column to task field"},
+			"dry_run": map[string]interface{}{"type": "string", "description": "true to only check the rows"},
+		},
+		"required": []string{"file"},
+	}, status: http.StatusCreated, response: csvImportResponse{}},
+	"import":          {summary: "Import a Todoist or Trello export as projects and tasks", scope: ScopeTasksWrite, query: []string{"format: todoist or trello", "dry_run: true to only check the export"}, body: map[string]interface{}{}, status: http.StatusCreated, response: map[string]interface{}{}},
+	"events":          {summary: "Stream task changes as Server-Sent Events", query: []string{"since: Revision to resume after"}, contentType: "text/event-stream"},
+	"sync":            {summary: "WebSocket sync connection", status: http.StatusSwitchingProtocols},
+	"stats":           {summary: "Task counts and completion statistics", query: []string{"group_by: Group the statistics by this field", "from: First day of the activity period (YYYY-MM-DD) in the request's time zone", "to: Last day of the activity period (YYYY-MM-DD)", "interval: day or week"}, response: TaskStats{}},
+	"stats.streak":    {summary: "Daily completion streak", response: StreakStats{}},
+	"workflow":        {summary: "Task statuses and the transitions allowed between them", response: workflowResponse{}},
+	"timesheet":       {summary: "Time tracked by day, project and task", query: []string{"from: First day (YYYY-MM-DD) in the request's time zone", "to: Last day (YYYY-MM-DD)", "user: Only this user's time, named as in the audit log"}, response: timesheetResponse{}},
+	"board":           {summary: "Tasks in one column per status, in board order", query: taskListQuery, response: boardResponse{}},
+	"search":          {summary: "Ranked full-text search", query: []string{"q: Search text", "status: Only tasks with this status", "limit: Results per page", "offset: Results to skip"}, response: []searchResponseItem{}},
+	"tasks.create":    {summary: "Create a task", scope: ScopeTasksWrite, body: createTaskRequest{}, status: http.StatusCreated, response: publicTask{}},
+	"tasks.update":    {summary: "Replace a task's fields", scope: ScopeTasksWrite, query: forceQuery, body: updateTaskRequest{}, response: updateResponse{}},
+	"tasks.patch":     {summary: "Change some of a task's fields (JSON merge patch)", scope: ScopeTasksWrite, query: forceQuery, body: map[string]interface{}{}, response: updateResponse{}},
+	"tasks.delete":    {summary: "Move a task to the trash", scope: ScopeTasksWrite, status: http.StatusNoContent},
+	"tasks.bulk":      {summary: "Create, update, complete and delete tasks in one all-or-nothing batch", scope: ScopeTasksWrite, body: bulkRequest{}, response: bulkResponse{}},
+	"subtasks.create": {summary: "Add a checklist item", scope: ScopeTasksWrite, body: subtaskRequest{}, status: http.StatusCreated, response: Subtask{}},
+	"subtasks.update": {summary: "Update a checklist item", scope: ScopeTasksWrite, body: subtaskRequest{}, response: Subtask{}},
+	"subtasks.delete": {summary: "Delete a checklist item", scope: ScopeTasksWrite, status: http.StatusNoContent},
+	"timer.start":     {summary: "Start tracking time on a task", scope: ScopeTasksWrite, status: http.StatusCreated, response: TimeEntry{}},
+	"timer.stop":      {summary: "Stop the caller's timer on a task", scope: ScopeTasksWrite, response: TimeEntry{}},
+	"comments.create": {summary: "Comment on a task", scope: ScopeTasksWrite, body: commentRequest{}, status: http.StatusCreated, response: publicComment{}},
+	"comments.delete": {summary: "Delete a comment (its author or an admin)", scope: ScopeTasksWrite, status: http.StatusNoContent},
+	"attachments.upload": {summary: "Upload a file to a task", scope: ScopeTasksWrite, bodyContentType: "multipart/form-data", bodySchema: map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"file": map[string]interface{}{"type": "string", "format": "binary"}},
+		"required":   []string{"file"},
+	}, status: http.StatusCreated, response: Attachment{}},
+	"attachments.delete":   {summary: "Delete an attachment and its file", scope: ScopeTasksWrite, status: http.StatusNoContent},
+	"tags.list":            {summary: "Tag usage counts", response: []TagCount{}},
+	"tags.add":             {summary: "Add tags to a task", scope: ScopeTasksWrite, body: tagsRequest{}, response: publicTask{}},
+	"tags.remove":          {summary: "Remove a tag from a task", scope: ScopeTasksWrite, response: publicTask{}},
+	"projects.list":        {summary: "List projects", response: []Project{}},
+	"projects.get":         {summary: "Get a project", response: Project{}},
+	"projects.tasks":       {summary: "List a project's tasks", query: taskListQuery, response: []publicTask{}},
+	"projects.create":      {summary: "Create a project", scope: ScopeTasksWrite, body: projectRequest{}, status: http.StatusCreated, response: Project{}},
+	"projects.update":      {summary: "Update a project", scope: ScopeTasksWrite, body: projectRequest{}, response: Project{}},
+	"projects.delete":      {summary: "Delete an empty project", scope: ScopeTasksWrite, status: http.StatusNoContent},
+	"collaborators.create": {summary: "Share a project with a user, by name or email", scope: ScopeTasksWrite, body: collaboratorRequest{}, response: Project{}},
+	"collaborators.delete": {summary: "Stop sharing a project with a user", scope: anyToken, status: http.StatusNoContent},
+	"invites.create":       {summary: "Create a link to join a project, optionally emailing it", scope: ScopeTasksWrite, body: inviteRequest{}, response: map[string]interface{}{}},
+	"invites.accept":       {summary: "Join the project an invite link is for", scope: anyToken, response: Project{}},
+	"tasks.reopen":         {summary: "Reopen a completed task", scope: ScopeTasksWrite, query: []string{"to: Status to reopen to"}, response: publicTask{}},
+	"tasks.snooze":         {summary: "Push the due date forward", scope: ScopeTasksWrite, body: snoozeRequest{}, response: publicTask{}},
+	"tasks.assign":         {summary: "Assign a task to a user, or to the caller", scope: ScopeTasksWrite, body: assignRequest{}, response: publicTask{}},
+	"tasks.unassign":       {summary: "Clear a task's assignee", scope: ScopeTasksWrite, response: publicTask{}},
+	"tasks.restore":        {summary: "Restore a task from the trash", scope: ScopeTasksWrite, response: publicTask{}},
+	"tasks.archive":        {summary: "Move a completed task to the archive", scope: ScopeTasksWrite, response: publicTask{}},
+	"tasks.revert":         {summary: "Put a task back as it was at a revision", scope: ScopeTasksWrite, response: publicTask{}},
+	"board.move":           {summary: "Move a task within or between board columns", scope: ScopeTasksWrite, query: forceQuery, body: boardMoveRequest{}, response: publicTask{}},
+	"tasks.share":          {summary: "Create a read-only share link", scope: ScopeTasksRead, response: map[string]interface{}{}},
+	"shared.get":           {summary: "Get a shared task", response: publicTask{}},
+	"preferences":          {summary: "Which notification emails the caller gets", scope: anyToken, response: notificationPreferences{}},
+	"preferences.update":   {summary: "Turn notification emails on or off for the caller", scope: anyToken, body: notificationPreferencesRequest{}, response: notificationPreferences{}},
+	"webhooks.list":        {summary: "List webhooks", scope: ScopeAdmin, response: []Webhook{}},
+	"webhooks.create":      {summary: "Register a webhook", scope: ScopeAdmin, body: webhookRequest{}, status: http.StatusCreated, response: Webhook{}},
+	"webhooks.delete":      {summary: "Delete a webhook", scope: ScopeAdmin, status: http.StatusNoContent},
+	"integrations.list":    {summary: "List a project's Slack and Discord integrations", scope: ScopeAdmin, response: []Integration{}},
+	"integrations.create":  {summary: "Post a project's task events to Slack or Discord", scope: ScopeAdmin, body: integrationRequest{}, status: http.StatusCreated, response: Integration{}},
+	"integrations.delete":  {summary: "Delete an integration", scope: ScopeAdmin, status: http.StatusNoContent},
+	"admin.config":         {summary: "Effective configuration with secrets redacted", scope: ScopeAdmin, response: SanitizedConfig{}},
+	"admin.export":         {summary: "Download a zip export of tasks, projects, attachment files and config", scope: ScopeAdmin, contentType: "application/zip"},
+	"admin.import":         {summary: "Replace all tasks and projects from a zip export", scope: ScopeAdmin, bodyContentType: "application/zip", response: map[string]interface{}{}},
+	"admin.backup":         {summary: "Download a versioned backup of tasks, projects and config", scope: ScopeAdmin, contentType: "application/zip"},
+	"admin.restore":        {summary: "Replace all tasks and projects from a backup", scope: ScopeAdmin, query: []string{"dry_run: true to only validate the backup"}, bodyContentType: "application/zip", response: map[string]interface{}{}},
+	"audit":                {summary: "List audit log entries, newest first", scope: ScopeAdmin, query: auditQuery, response: []AuditEntry{}},
+	"workspaces.list":      {summary: "List workspaces besides the default one", scope: ScopeAdmin, response: []Workspace{}},
+	"workspaces.create":    {summary: "Create a workspace with its own tasks and tokens", scope: ScopeAdmin, body: workspaceRequest{}, status: http.StatusCreated, response: Workspace{}},
+	"workspaces.delete":    {summary: "Delete a workspace and revoke its tokens", scope: ScopeAdmin, status: http.StatusNoContent},
+	"workspaces.tokens":    {summary: "Issue a viewer or editor token for a workspace", scope: ScopeAdmin, body: workspaceTokenRequest{}, status: http.StatusCreated, response: map[string]interface{}{}},
+	"workspaces.move":      {summary: "Move a task to another workspace, where it gets a new ID", scope: ScopeAdmin, body: workspaceMoveRequest{}, response: publicTask{}},
+	"workspaces.changes":   {summary: "List the changes in several workspaces since a revision", scope: ScopeAdmin, query: []string{"since: Revision for every workspace, or workspace:revision pairs separated by commas", "workspaces: Workspace IDs separated by commas, default for the default one (default: all)"}, response: workspaceChangesResponse{}},
+	"openapi":              {summary: "This OpenAPI document", response: map[string]interface{}{}},
+}
+
+// pathParamPattern matches the {name} parameters of a route path
+var pathParamPattern = regexp.MustCompile(`\{([a-z]+)\}`)
+
+// buildOpenAPI returns the OpenAPI 3.0 document for routes
+func buildOpenAPI(routes []apiRoute) map[string]interface{} {
+	schemas := map[string]interface{}{
+		"Error": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"error":  map[string]interface{}{"type": "string"},
+				"code":   map[string]interface{}{"type": "string"},
+				"status": map[string]interface{}{"type": "integer"},
+			},
+		},
+	}
+	paths := make(map[string]map[string]interface{})
+	for _, route := range routes {
+		doc := routeDocs[route.name]
+		op := map[string]interface{}{
+			"operationId": operationID(route.name),
+			"tags":        []string{strings.SplitN(route.name, ".", 2)[0]},
+		}
+		if doc.summary != "" {
+			op["summary"] = doc.summary
+		}
+
+		var params []interface{}
+		for _, match := range pathParamPattern.FindAllStringSubmatch(route.path, -1) {
+			params = append(params, map[string]interface{}{
+				"name": match[1], "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"},
+			})
+		}
+		for _, q := range doc.query {
+			name, description, _ := strings.Cut(q, ": ")
+			params = append(params, map[string]interface{}{
+				"name": name, "in": "query", "description": description, "schema": map[string]interface{}{"type": "string"},
+			})
+		}
+		if params != nil {
+			op["parameters"] = params
+		}
+
+		if doc.body != nil {
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": schemaFor(reflect.TypeOf(doc.body), schemas)},
+				},
+			}
+		}
+		if doc.bodyContentType != "" {
+			schema := doc.bodySchema
+			if schema == nil {
+				schema = map[string]interface{}{"type": "string", "format": "binary"}
+			}
+			op["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  map[string]interface{}{doc.bodyContentType: map[string]interface{}{"schema": schema}},
+			}
+		}
+
+		status := doc.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := map[string]interface{}{"description": http.StatusText(status)}
+		switch {
+		case doc.contentType != "":
+			success["content"] = map[string]interface{}{
+				doc.contentType: map[string]interface{}{"schema": map[string]interface{}{"type": "string", "format": "binary"}},
+			}
+		case doc.response != nil:
+			success["content"] = map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": schemaFor(reflect.TypeOf(doc.response), schemas)},
+			}
+		}
+		op["responses"] = map[string]interface{}{
+			strconv.Itoa(status): success,
+			"default": map[string]interface{}{
+				"description": "Error",
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": map[string]interface{}{"$ref": "#/components/schemas/Error"}},
+				},
+			},
+		}
+
+		if doc.scope != "" {
+			op["security"] = []interface{}{map[string]interface{}{"apiToken": []string{}}}
+			if doc.scope != anyToken {
+				op["description"] = "Requires a token with the " + doc.scope + " scope."
+			}
+		}
+
+		if paths[route.path] == nil {
+			paths[route.path] = make(map[string]interface{})
+		}
+		paths[route.path][strings.ToLower(route.method)] = op
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "TaskMate API",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"apiToken": map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-API-Token"},
+			},
+		},
+	}
+}
+
+// operationID turns a route name such as "auth.oidc.login" into
+// "authOidcLogin"
+func operationID(name string) string {
+	parts := strings.Split(name, ".")
+	for i := 1; i < len(parts); i++ {
+		parts[i] = upperFirst(parts[i])
+	}
+	return strings.Join(parts, "")
+}
+
+// upperFirst capitalizes the first letter of s
+func upperFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	r := []rune(s)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	dueTimeType    = reflect.TypeOf(DueTime{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// schemaFor returns the JSON schema of values of t as encoding/json writes
+// them. Named struct types are added to schemas and referenced, so each is
+// described once.
+func schemaFor(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t == dueTimeType:
+		// An RFC 3339 time, or "" without a due date
+		return map[string]interface{}{"type": "string"}
+	case t == rawMessageType:
+		// Raw JSON, such as a bulk operation's task, can be any value
+		return map[string]interface{}{}
+	case t.Kind() == reflect.Struct && t.Name() != "":
+		name := schemaName(t)
+		if _, seen := schemas[name]; !seen {
+			// Reserve the name first so recursive types terminate
+			schemas[name] = map[string]interface{}{}
+			schemas[name] = structSchema(t, schemas)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		return structSchema(t, schemas)
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaFor(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaFor(t.Elem(), schemas)}
+	}
+	// interface{} fields, such as task IDs that are integers or encoded
+	// strings, can hold anything
+	return map[string]interface{}{}
+}
+
+// schemaName is the component name of a struct type: its Go name with the
+// first letter capitalized, except that publicTask is shown as Task
+func schemaName(t reflect.Type) string {
+	if t == reflect.TypeOf(publicTask{}) {
+		return "Task"
+	}
+	return upperFirst(t.Name())
+}
+
+// structSchema describes a struct's JSON fields, including those of
+// embedded structs. As in encoding/json, a field of the outer struct hides
+// one with the same name in an embedded struct.
+func structSchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var embedded []reflect.Type
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			embedded = append(embedded, ft)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = schemaFor(field.Type, schemas)
+	}
+	for _, et := range embedded {
+		inner := structSchema(et, schemas)["properties"].(map[string]interface{})
+		for name, schema := range inner {
+			if _, hidden := properties[name]; !hidden {
+				properties[name] = schema
+			}
+		}
+	}
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+// handleDocs serves Swagger UI for the OpenAPI document
+func handleDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(swaggerUIPage))
+}
+
+// swaggerUIPage loads Swagger UI from a CDN and points it at the OpenAPI
+// document
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>TaskMate API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js" crossorigin></script>
+  <script>
+    window.ui = SwaggerUIBundle({ url: "/api/v1/openapi.json", dom_id: "#swagger-ui" });
+  </script>
+</body>
+</html>
+`
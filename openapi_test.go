@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// getSpec fetches the OpenAPI document from r
+func getSpec(t *testing.T, r http.Handler) map[string]interface{} {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/openapi.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /api/v1/openapi.json: status %d; want 200", w.Code)
+	}
+	var spec map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &spec); err != nil {
+		t.Fatalf("spec is not JSON: %v", err)
+	}
+	return spec
+}
+
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	r, _ := server.Router()
+	spec := getSpec(t, r)
+
+	if spec["openapi"] != "3.0.3" {
+		t.Errorf("openapi = %v; want 3.0.3", spec["openapi"])
+	}
+	paths := spec["paths"].(map[string]interface{})
+	count := 0
+	for path, item := range paths {
+		for method, op := range item.(map[string]interface{}) {
+			count++
+			if _, ok := op.(map[string]interface{})["summary"]; !ok {
+				t.Errorf("%s %s has no summary; add it to routeDocs", strings.ToUpper(method), path)
+			}
+		}
+	}
+	if count != len(routeDocs) {
+		t.Errorf("spec has %d operations; want %d", count, len(routeDocs))
+	}
+
+	schemas := spec["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	task, ok := schemas["Task"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("schemas = %v; want a Task schema", schemas)
+	}
+	properties := task["properties"].(map[string]interface{})
+	for _, field := range []string{"id", "title", "status", "created_at"} {
+		if _, ok := properties[field]; !ok {
+			t.Errorf("Task schema has no %q property", field)
+		}
+	}
+	if created := properties["created_at"].(map[string]interface{}); created["format"] != "date-time" {
+		t.Errorf("created_at schema = %v; want a date-time string", created)
+	}
+}
+
+// Endpoints documented as needing a token must reject requests without
+// one, and the others must not
+func TestOpenAPISecurityMatchesRoutes(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.TokenHashes = []string{hashString("secret-token")}
+	r, _ := server.Router()
+	spec := getSpec(t, r)
+
+	streaming := map[string]bool{"/events": true, "/ws": true, "/tasks/poll": true}
+	for path, item := range spec["paths"].(map[string]interface{}) {
+		if streaming[path] {
+			continue
+		}
+		for method, op := range item.(map[string]interface{}) {
+			_, secured := op.(map[string]interface{})["security"]
+			url := "/api/v1" + pathParamPattern.ReplaceAllString(path, "1")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(strings.ToUpper(method), url, nil))
+			if unauthorized := w.Code == http.StatusUnauthorized; unauthorized != secured {
+				t.Errorf("%s %s without a token: status %d; documented as secured %v", strings.ToUpper(method), url, w.Code, secured)
+			}
+		}
+	}
+}
+
+func TestOpenAPIOmitsDisabledRoutes(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.DisabledEndpoints = []string{"tasks.delete", "admin.export"}
+	r, err := server.Router()
+	if err != nil {
+		t.Fatalf("Router() error = %v", err)
+	}
+	paths := getSpec(t, r)["paths"].(map[string]interface{})
+	if _, ok := paths["/tasks/{id}"].(map[string]interface{})["delete"]; ok {
+		t.Error("spec documents disabled DELETE /tasks/{id}")
+	}
+	if _, ok := paths["/admin/export"]; ok {
+		t.Error("spec documents disabled GET /admin/export")
+	}
+
+	server.config.DisabledEndpoints = []string{"openapi"}
+	r, _ = server.Router()
+	for _, path := range []string{"/api/v1/openapi.json", "/docs"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("GET %s with openapi disabled: status %d; want 404", path, w.Code)
+		}
+	}
+}
+
+func TestDocsServesSwaggerUI(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	r, _ := server.Router()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/docs", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "/api/v1/openapi.json") {
+		t.Errorf("GET /docs: status %d; want Swagger UI pointed at the spec", w.Code)
+	}
+}
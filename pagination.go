@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// defaultPageSize is the page size used when ?page= or ?cursor= is given
+// without ?limit=
+const defaultPageSize = 50
+
+// listCursor marks the last task of a page for cursor pagination. It keeps
+// the task's sortable fields rather than its position, so pages stay
+// consistent when tasks are added or deleted between requests.
+type listCursor struct {
+	Sort  string `json:"s"`
+	Order string `json:"o"`
+	Last  Task   `json:"t"`
+}
+
+// encodeCursor returns an opaque cursor pointing after task
+func encodeCursor(field, order string, task *Task) string {
+	last := *task
+	last.Description = ""
+	data, err := json.Marshal(listCursor{Sort: field, Order: order, Last: last})
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor parses a cursor and checks it was issued for the same sort
+func decodeCursor(raw, field, order string) (*listCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, errors.New("malformed cursor")
+	}
+	var cursor listCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, errors.New("malformed cursor")
+	}
+	if cursor.Sort != field || cursor.Order != order {
+		return nil, errors.New("cursor was issued for a different sort")
+	}
+	return &cursor, nil
+}
+
+// after reports whether task comes after the cursor in the listing order,
+// with priorities weighed by priorities. sortTasks keeps ties in ascending
+// ID order for both directions.
+func (c *listCursor) after(task *Task, priorities priorityRanking) bool {
+	cmp := taskComparison(c.Sort, priorities)(task, &c.Last)
+	if c.Order == "desc" {
+		cmp = -cmp
+	}
+	return cmp > 0 || (cmp == 0 && task.ID > c.Last.ID)
+}
+
+// paginateTasks applies ?page=&limit= or ?cursor=&limit= to tasks, which
+// must already be sorted by field and order. It sets X-Total-Count and a
+// Link header with the neighbouring pages. Without any of those parameters
+// every task is returned. priorities weighs priorities as when sorting.
+func paginateTasks(w http.ResponseWriter, r *http.Request, tasks []*Task, field, order string, priorities priorityRanking) ([]*Task, error) {
+	query := r.URL.Query()
+	rawPage, rawCursor, rawLimit := query.Get("page"), query.Get("cursor"), query.Get("limit")
+	if rawPage == "" && rawCursor == "" && rawLimit == "" {
+		return tasks, nil
+	}
+	if rawPage != "" && rawCursor != "" {
+		return nil, errors.New("use either page or cursor, not both")
+	}
+
+	limit := defaultPageSize
+	if rawLimit != "" {
+		n, err := strconv.Atoi(rawLimit)
+		if err != nil || n < 1 {
+			return nil, errors.New("limit must be a positive number")
+		}
+		limit = n
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(tasks)))
+
+	if rawCursor != "" {
+		cursor, err := decodeCursor(rawCursor, field, order)
+		if err != nil {
+			return nil, err
+		}
+		start := len(tasks)
+		for i, task := range tasks {
+			if cursor.after(task, priorities) {
+				start = i
+				break
+			}
+		}
+		return cursorPage(w, r, tasks[start:], limit, field, order), nil
+	}
+	if rawPage == "" {
+		return cursorPage(w, r, tasks, limit, field, order), nil
+	}
+
+	page, err := strconv.Atoi(rawPage)
+	if err != nil || page < 1 {
+		return nil, errors.New("page must be a positive number")
+	}
+	lastPage := (len(tasks) + limit - 1) / limit
+	if lastPage == 0 {
+		lastPage = 1
+	}
+	links := []string{pageLink(r, "first", "page", "1"), pageLink(r, "last", "page", strconv.Itoa(lastPage))}
+	if page > 1 {
+		links = append(links, pageLink(r, "prev", "page", strconv.Itoa(min(page-1, lastPage))))
+	}
+	if page < lastPage {
+		links = append(links, pageLink(r, "next", "page", strconv.Itoa(page+1)))
+	}
+	w.Header().Set("Link", strings.Join(links, ", "))
+
+	start := min((page-1)*limit, len(tasks))
+	end := min(start+limit, len(tasks))
+	return tasks[start:end], nil
+}
+
+// cursorPage returns the first limit tasks and, when more follow, links to
+// the next page and sets X-Next-Cursor
+func cursorPage(w http.ResponseWriter, r *http.Request, tasks []*Task, limit int, field, order string) []*Task {
+	if len(tasks) <= limit {
+		return tasks
+	}
+	tasks = tasks[:limit]
+	next := encodeCursor(field, order, tasks[len(tasks)-1])
+	w.Header().Set("X-Next-Cursor", next)
+	w.Header().Set("Link", pageLink(r, "next", "cursor", next))
+	return tasks
+}
+
+// pageLink formats one Link header entry for the request's URL with param
+// set to value
+func pageLink(r *http.Request, rel, param, value string) string {
+	query := r.URL.Query()
+	query.Set(param, value)
+	u := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	return fmt.Sprintf("<%s>; rel=%q", u.String(), rel)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// listTitles calls the list handler and returns the titles and response
+func listTitles(t *testing.T, server *Server, query string) ([]string, *httptest.ResponseRecorder) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	server.handleGetTasks(w, httptest.NewRequest("GET", "/api/v1/tasks"+query, nil))
+	if w.Code != http.StatusOK {
+		return nil, w
+	}
+	var tasks []Task
+	if err := json.NewDecoder(w.Body).Decode(&tasks); err != nil {
+		t.Fatalf("%q: decode response: %v", query, err)
+	}
+	titles := make([]string, len(tasks))
+	for i, task := range tasks {
+		titles[i] = task.Title
+	}
+	return titles, w
+}
+
+func TestListPagePagination(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	for i := 1; i <= 5; i++ {
+		server.store.Add(context.Background(), fmt.Sprintf("Task %d", i), "", DueTime{}, "medium")
+	}
+
+	titles, w := listTitles(t, server, "?page=2&limit=2")
+	if strings.Join(titles, ",") != "Task 3,Task 4" {
+		t.Errorf("page 2 = %v; want Task 3, Task 4", titles)
+	}
+	if got := w.Header().Get("X-Total-Count"); got != "5" {
+		t.Errorf("X-Total-Count = %q; want 5", got)
+	}
+	link := w.Header().Get("Link")
+	for _, want := range []string{
+		`</api/v1/tasks?limit=2&page=1>; rel="first"`,
+		`</api/v1/tasks?limit=2&page=3>; rel="last"`,
+		`</api/v1/tasks?limit=2&page=1>; rel="prev"`,
+		`</api/v1/tasks?limit=2&page=3>; rel="next"`,
+	} {
+		if !strings.Contains(link, want) {
+			t.Errorf("Link = %q; missing %s", link, want)
+		}
+	}
+
+	titles, w = listTitles(t, server, "?page=3&limit=2")
+	if strings.Join(titles, ",") != "Task 5" || strings.Contains(w.Header().Get("Link"), `rel="next"`) {
+		t.Errorf("last page = %v, Link %q; want Task 5 and no next", titles, w.Header().Get("Link"))
+	}
+
+	// No pagination parameters keeps the full list
+	if titles, _ := listTitles(t, server, ""); len(titles) != 5 {
+		t.Errorf("unpaginated list has %d tasks; want 5", len(titles))
+	}
+}
+
+func TestListCursorPagination(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	ctx := context.Background()
+	for _, due := range []string{"2024-03-01", "2024-01-01", "2024-02-01", "2024-01-01"} {
+		server.store.Add(ctx, "Due "+due, "", dueOn(due), "medium")
+	}
+
+	var seen []string
+	query := "?sort=due_date&limit=2"
+	for pages := 0; pages < 5; pages++ {
+		titles, w := listTitles(t, server, query)
+		if titles == nil {
+			t.Fatalf("%q: status = %d", query, w.Code)
+		}
+		seen = append(seen, titles...)
+		next := w.Header().Get("X-Next-Cursor")
+		if next == "" {
+			break
+		}
+		if pages == 0 {
+			// A task deleted between pages doesn't shift the next page
+			server.store.Delete(ctx, 2)
+		}
+		query = "?sort=due_date&limit=2&cursor=" + url.QueryEscape(next)
+	}
+	want := "Due 2024-01-01,Due 2024-01-01,Due 2024-02-01,Due 2024-03-01"
+	if strings.Join(seen, ",") != want {
+		t.Errorf("pages = %v; want %s", seen, want)
+	}
+}
+
+func TestListPaginationRejectsInvalidParams(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.store.Add(context.Background(), "Task", "", DueTime{}, "medium")
+
+	for _, query := range []string{
+		"?page=0",
+		"?limit=-1",
+		"?page=1&cursor=abc",
+		"?cursor=not-base64!",
+		"?sort=due_date&cursor=" + encodeCursor("title", "", &Task{ID: 1}),
+	} {
+		if _, w := listTitles(t, server, query); w.Code != http.StatusBadRequest {
+			t.Errorf("%q: status = %d; want %d", query, w.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// defaultPasswordMinLength applies when PasswordPolicy.MinLength is unset
+	defaultPasswordMinLength = 8
+	// maxPasswordBytes is the most bcrypt hashes; it ignores anything after
+	maxPasswordBytes = 72
+)
+
+// PasswordPolicy configures the requirements for new passwords
+type PasswordPolicy struct {
+	MinLength     int  `json:"min_length,omitempty"`
+	RequireDigit  bool `json:"require_digit,omitempty"`
+	RequireSymbol bool `json:"require_symbol,omitempty"`
+}
+
+// validatePassword returns an error naming the first requirement pw fails.
+// Every flow that sets a password must go through it.
+func (p PasswordPolicy) validatePassword(pw string) error {
+	minLength := p.MinLength
+	if minLength <= 0 {
+		minLength = defaultPasswordMinLength
+	}
+	if len([]rune(pw)) < minLength {
+		return fmt.Errorf("password must be at least %d characters", minLength)
+	}
+	if len(pw) > maxPasswordBytes {
+		return fmt.Errorf("password must be at most %d bytes", maxPasswordBytes)
+	}
+
+	var hasDigit, hasSymbol bool
+	for _, r := range pw {
+		switch {
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSymbol = true
+		}
+	}
+	if p.RequireDigit && !hasDigit {
+		return fmt.Errorf("password must contain a digit")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		return fmt.Errorf("password must contain a symbol")
+	}
+	return nil
+}
+
+// passwordHashCost is the bcrypt cost of new password hashes; tests lower it
+var passwordHashCost = bcrypt.DefaultCost
+
+// hashPassword returns a bcrypt hash of pw, which carries its own salt
+func hashPassword(pw string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(pw), passwordHashCost)
+	return string(hash), err
+}
+
+// checkPassword reports whether pw matches hash, and whether hash should be
+// replaced. Hashes from before bcrypt are unsalted SHA-256 hex; they still
+// match so that existing configs keep working, but need replacing.
+func checkPassword(hash, pw string) (ok, legacy bool) {
+	if len(hash) == 64 {
+		return subtle.ConstantTimeCompare([]byte(hashString(pw)), []byte(hash)) == 1, true
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(pw)) == nil, false
+}
+
+// passwordSet reports whether a master password is configured
+func (s *Server) passwordSet() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.config.PasswordHash != ""
+}
+
+// verifyPassword reports whether pw is the master password. A legacy
+// SHA-256 hash is replaced with a bcrypt one the first time it matches.
+func (s *Server) verifyPassword(pw string) bool {
+	s.mu.RLock()
+	hash := s.config.PasswordHash
+	s.mu.RUnlock()
+	ok, legacy := checkPassword(hash, pw)
+	if !ok || !legacy {
+		return ok
+	}
+
+	upgraded, err := hashPassword(pw)
+	if err != nil {
+		slog.Error("Failed to rehash password", "error", err)
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Leave a password changed in the meantime alone
+	if s.config.PasswordHash == hash {
+		s.config.PasswordHash = upgraded
+		if err := SaveConfig(s.config); err != nil {
+			s.config.PasswordHash = hash
+			slog.Error("Failed to save rehashed password", "error", err)
+		}
+	}
+	return true
+}
+
+// checkRequestPassword answers 401 and returns false unless pw is the
+// master password
+func (s *Server) checkRequestPassword(w http.ResponseWriter, pw string) bool {
+	if pw == "" {
+		writeError(w, http.StatusUnauthorized, ErrCodePasswordRequired, "Password required")
+		return false
+	}
+	if !s.verifyPassword(pw) {
+		writeError(w, http.StatusUnauthorized, ErrCodeInvalidPassword, "Invalid password")
+		return false
+	}
+	return true
+}
+
+// passwordRequest is the body of a password change
+type passwordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// handleChangePassword sets the master password. It takes an admin token
+// and, once a password is set, the current one as well. The new password
+// must satisfy Config.PasswordPolicy.
+func (s *Server) handleChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req passwordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	if s.passwordSet() && !s.checkRequestPassword(w, req.CurrentPassword) {
+		return
+	}
+	if err := s.config.PasswordPolicy.validatePassword(req.NewPassword); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, ErrCodeWeakPassword, err.Error())
+		return
+	}
+	hash, err := hashPassword(req.NewPassword)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to hash password")
+		return
+	}
+
+	s.mu.Lock()
+	prev := s.config.PasswordHash
+	s.config.PasswordHash = hash
+	if err := SaveConfig(s.config); err != nil {
+		s.config.PasswordHash = prev
+		s.mu.Unlock()
+		writeError(w, http.StatusInternalServerError, ErrCodeSaveFailed, "Failed to save password")
+		return
+	}
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestValidatePassword(t *testing.T) {
+	strict := PasswordPolicy{MinLength: 10, RequireDigit: true, RequireSymbol: true}
+
+	tests := []struct {
+		name    string
+		policy  PasswordPolicy
+		pw      string
+		wantErr string
+	}{
+		{"default min length too short", PasswordPolicy{}, "short", "password must be at least 8 characters"},
+		{"default min length ok", PasswordPolicy{}, "longenough", ""},
+		{"custom min length", strict, "abc1!", "password must be at least 10 characters"},
+		{"missing digit", strict, "abcdefghij!", "password must contain a digit"},
+		{"missing symbol", strict, "abcdefghij1", "password must contain a symbol"},
+		{"compliant", strict, "correct-horse-9", ""},
+		{"length counts characters not bytes", PasswordPolicy{MinLength: 4}, "äöü", "password must be at least 4 characters"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.validatePassword(tt.pw)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validatePassword(%q) error = %v; want nil", tt.pw, err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("validatePassword(%q) error = %v; want %q", tt.pw, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// fastPasswordHashing lowers the bcrypt cost for the rest of the test
+func fastPasswordHashing(t *testing.T) {
+	cost := passwordHashCost
+	passwordHashCost = bcrypt.MinCost
+	t.Cleanup(func() { passwordHashCost = cost })
+}
+
+func TestCheckPassword(t *testing.T) {
+	fastPasswordHashing(t)
+	hash, err := hashPassword("correct-horse-9")
+	if err != nil {
+		t.Fatalf("hashPassword() error = %v", err)
+	}
+	if other, _ := hashPassword("correct-horse-9"); other == hash {
+		t.Error("hashPassword gave the same hash twice; want a fresh salt each time")
+	}
+	if ok, legacy := checkPassword(hash, "correct-horse-9"); !ok || legacy {
+		t.Errorf("checkPassword(bcrypt) = %v, %v; want true, false", ok, legacy)
+	}
+	if ok, _ := checkPassword(hash, "wrong"); ok {
+		t.Error("checkPassword accepted a wrong password")
+	}
+	if ok, legacy := checkPassword(hashString("old-password"), "old-password"); !ok || !legacy {
+		t.Errorf("checkPassword(sha256) = %v, %v; want true, true", ok, legacy)
+	}
+}
+
+func TestTokenGenerationRequiresPassword(t *testing.T) {
+	fastPasswordHashing(t)
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	// A hash from before bcrypt
+	server.config.PasswordHash = hashString("old-password")
+	server.config.TokenHashes = []string{hashString("admin")}
+	r, _ := server.Router()
+
+	do := func(path, body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, bytes.NewBufferString(body))
+		if token != "" {
+			req.Header.Set("X-API-Token", token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	code := func(w *httptest.ResponseRecorder) string {
+		var body struct {
+			Code string `json:"code"`
+		}
+		json.NewDecoder(w.Body).Decode(&body)
+		return body.Code
+	}
+
+	if w := do("/api/v1/auth/token", "", ""); w.Code != http.StatusUnauthorized || code(w) != ErrCodePasswordRequired {
+		t.Errorf("no password: status %d; want 401 %s", w.Code, ErrCodePasswordRequired)
+	}
+	if w := do("/api/v1/auth/token", `{"password":"wrong"}`, ""); w.Code != http.StatusUnauthorized || code(w) != ErrCodeInvalidPassword {
+		t.Errorf("wrong password: status %d; want 401 %s", w.Code, ErrCodeInvalidPassword)
+	}
+	if w := do("/api/v1/auth/token", `{"password":"old-password"}`, ""); w.Code != http.StatusCreated {
+		t.Fatalf("right password: status %d; want 201", w.Code)
+	}
+	if _, legacy := checkPassword(server.config.PasswordHash, "old-password"); legacy {
+		t.Error("legacy hash was not replaced after a successful login")
+	}
+
+	if w := do("/api/v1/auth/password", `{"current_password":"wrong","new_password":"new-password"}`, "admin"); w.Code != http.StatusUnauthorized {
+		t.Errorf("change with wrong password: status %d; want 401", w.Code)
+	}
+	if w := do("/api/v1/auth/password", `{"current_password":"old-password","new_password":"short"}`, "admin"); w.Code != http.StatusUnprocessableEntity || code(w) != ErrCodeWeakPassword {
+		t.Errorf("weak password: status %d; want 422 %s", w.Code, ErrCodeWeakPassword)
+	}
+	if w := do("/api/v1/auth/password", `{"current_password":"old-password","new_password":"new-password"}`, "admin"); w.Code != http.StatusNoContent {
+		t.Fatalf("change: status %d; want 204", w.Code)
+	}
+	if w := do("/api/v1/auth/token", `{"password":"old-password"}`, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("old password after change: status %d; want 401", w.Code)
+	}
+	if w := do("/api/v1/auth/token", `{"password":"new-password"}`, ""); w.Code != http.StatusCreated {
+		t.Errorf("new password: status %d; want 201", w.Code)
+	}
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// patchableFields are the task fields a PATCH request may set. Fields
+// marked true may also be cleared with null.
+var patchableFields = map[string]bool{
+	"title":            false,
+	"description":      true,
+	"due_date":         true,
+	"priority":         false,
+	"status":           false,
+	"project_id":       true,
+	"blocked_by":       true,
+	"recurrence":       true,
+	"reminder_offsets": true,
+}
+
+// Patch changes only the given fields of a task and keeps the rest, with
+// the same status handling as Update. A due_date is read as by
+// parseDueDate, with a day ending in UTC. A project_id must name an existing
+// project; empty removes the task from its project. blocked_by is a
+// comma-separated list of task IDs, checked as for AddTask. An empty recurrence
+// stops the task recurring, and empty reminder_offsets go back to the
+// configured window. Like Update, the bool reports whether the
+// task exists.
+func (ts *TaskStore) Patch(ctx context.Context, id int, fields map[string]string) (*Task, bool, error) {
+	return ts.PatchIfMatch(ctx, id, nil, fields)
+}
+
+// PatchIfMatch is Patch with the version check of UpdateIfMatch
+func (ts *TaskStore) PatchIfMatch(ctx context.Context, id int, versions []int, fields map[string]string) (*Task, bool, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	task, exists := ts.tasks[id]
+	if !exists {
+		return nil, false, nil
+	}
+	if versions != nil && !versionIn(task.Version, versions) {
+		return nil, true, ErrVersionMismatch
+	}
+	return ts.patchLocked(ctx, task, fields)
+}
+
+// patchLocked applies fields to task and saves. The caller must hold the
+// write lock.
+func (ts *TaskStore) patchLocked(ctx context.Context, task *Task, fields map[string]string) (*Task, bool, error) {
+	prev := *task
+	if err := ts.applyPatchLocked(ctx, task, fields); err != nil {
+		return nil, true, err
+	}
+	if err := ts.save(ctx, task.ID); err != nil {
+		*task = prev
+		return nil, true, fmt.Errorf("save tasks: %w", err)
+	}
+	ts.recordChange(ctx, ChangeUpdated, task)
+	ts.recordMutation(ctx, AuditUpdate, auditTask, task.ID, &prev, task)
+	return task, true, nil
+}
+
+// applyPatchLocked sets the given fields of task as patchLocked does,
+// without saving. It changes nothing if the fields fail a check. The caller
+// must hold the write lock.
+func (ts *TaskStore) applyPatchLocked(ctx context.Context, task *Task, fields map[string]string) error {
+	if err := ts.checkProjectLocked(ctx, task.ProjectID, PermissionEdit); err != nil {
+		return err
+	}
+	projectID := task.ProjectID
+	if raw, ok := fields["project_id"]; ok {
+		projectID = 0
+		if raw != "" {
+			projectID, _ = strconv.Atoi(raw)
+		}
+		if _, exists := ts.projects[projectID]; projectID != 0 && !exists {
+			return ErrProjectNotFound
+		}
+		if err := ts.checkProjectLocked(ctx, projectID, PermissionEdit); err != nil {
+			return err
+		}
+	}
+	blockers := task.BlockedBy
+	if raw, ok := fields["blocked_by"]; ok {
+		var err error
+		if blockers, err = ts.normalizeBlockersLocked(task.ID, splitInts(raw)); err != nil {
+			return err
+		}
+	}
+	if err := ts.workflow.checkTransition(task, fields["status"]); err != nil {
+		return err
+	}
+	if err := ts.checkCompletionLocked(ctx, task, blockers, fields["status"]); err != nil {
+		return err
+	}
+	dueDate := task.DueDate
+	if raw, ok := fields["due_date"]; ok {
+		var err error
+		if dueDate, err = parseDueDate(raw, time.UTC); err != nil {
+			return err
+		}
+	}
+	offsets := task.ReminderOffsets
+	if raw, ok := fields["reminder_offsets"]; ok {
+		// Already validated by parseMergePatch
+		offsets, _ = normalizeReminderOffsets(splitInts(raw))
+	}
+
+	value := func(name, current string) string {
+		if v, ok := fields[name]; ok {
+			return v
+		}
+		return current
+	}
+	task.ProjectID = projectID
+	task.BlockedBy = blockers
+	task.Recurrence = value("recurrence", task.Recurrence)
+	task.ReminderOffsets = offsets
+	// An omitted status is passed as empty so that auto-progress applies
+	// as it does for a PUT without a status
+	ts.applyUpdateLocked(task,
+		value("title", task.Title),
+		value("description", task.Description),
+		dueDate,
+		value("priority", task.Priority),
+		fields["status"])
+	return nil
+}
+
+// parseMergePatch reads a JSON merge patch (RFC 7396) for a task into the
+// fields to set, with null turned into an empty value. The numeric fields
+// are returned in decimal: project_id as one number and reminder_offsets
+// as a comma-separated list. blocked_by is a comma-separated list of the
+// task IDs as sent; parseTaskPatch decodes them.
+func parseMergePatch(body []byte) (map[string]string, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+	fields := make(map[string]string, len(raw))
+	for name, value := range raw {
+		nullable, known := patchableFields[name]
+		if !known {
+			return nil, &validationError{ErrCodeValidation, fmt.Sprintf("Unknown field %q", name)}
+		}
+		if bytes.Equal(bytes.TrimSpace(value), []byte("null")) {
+			if !nullable {
+				return nil, &validationError{ErrCodeValidation, fmt.Sprintf("Field %q can't be null", name)}
+			}
+			fields[name] = ""
+			continue
+		}
+		if name == "reminder_offsets" {
+			var offsets []int
+			if err := json.Unmarshal(value, &offsets); err != nil {
+				return nil, &validationError{ErrCodeValidation, `Field "reminder_offsets" must be an array of minutes`}
+			}
+			if _, err := normalizeReminderOffsets(offsets); err != nil {
+				return nil, err
+			}
+			fields[name] = joinInts(offsets)
+			continue
+		}
+		if name == "blocked_by" {
+			var ids []json.RawMessage
+			if err := json.Unmarshal(value, &ids); err != nil {
+				return nil, &validationError{ErrCodeValidation, `Field "blocked_by" must be an array of task IDs`}
+			}
+			raw := make([]string, len(ids))
+			for i, id := range ids {
+				raw[i] = strings.Trim(string(id), `"`)
+				if raw[i] == "" || strings.Contains(raw[i], ",") {
+					return nil, &validationError{ErrCodeValidation, `Field "blocked_by" must be an array of task IDs`}
+				}
+			}
+			fields[name] = strings.Join(raw, ",")
+			continue
+		}
+		if name == "project_id" {
+			var id int
+			if err := json.Unmarshal(value, &id); err != nil || id <= 0 {
+				return nil, &validationError{ErrCodeValidation, `Field "project_id" must be a positive integer`}
+			}
+			fields[name] = strconv.Itoa(id)
+			continue
+		}
+		var s string
+		if err := json.Unmarshal(value, &s); err != nil {
+			return nil, &validationError{ErrCodeValidation, fmt.Sprintf("Field %q must be a string", name)}
+		}
+		fields[name] = s
+	}
+	if title, ok := fields["title"]; ok && strings.TrimSpace(title) == "" {
+		return nil, &validationError{ErrCodeTitleRequired, "Title is required"}
+	}
+	if err := validateRecurrence(fields["recurrence"]); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// parseTaskPatch is parseMergePatch with the status and priority checked
+// against the workflow and priority levels, the blocked_by IDs decoded to stored IDs in decimal and a
+// due_date day read in loc, as RFC 3339
+func (s *Server) parseTaskPatch(body []byte, loc *time.Location) (map[string]string, error) {
+	fields, err := parseMergePatch(body)
+	if err != nil {
+		return nil, err
+	}
+	if status, ok := fields["status"]; ok {
+		if err := s.store.workflow.checkStatus(status); err != nil {
+			return nil, err
+		}
+	}
+	if priority, ok := fields["priority"]; ok {
+		if err := s.store.priorities.check(priority); err != nil {
+			return nil, err
+		}
+	}
+	if raw, ok := fields["due_date"]; ok {
+		dueDate, err := parseDueDate(raw, loc)
+		if err != nil {
+			return nil, err
+		}
+		fields["due_date"] = dueDate.String()
+	}
+	if raw, ok := fields["blocked_by"]; ok {
+		ids := make([]int, 0)
+		for _, part := range splitList(raw) {
+			id, err := s.decodeTaskID(part)
+			if err != nil {
+				return nil, &validationError{ErrCodeBlockerNotFound, "blocked_by names a task that isn't in the task list"}
+			}
+			ids = append(ids, id)
+		}
+		fields["blocked_by"] = joinInts(ids)
+	}
+	return fields, nil
+}
+
+// joinInts formats values as a comma-separated list
+func joinInts(values []int) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts, ",")
+}
+
+// splitInts parses a list made by joinInts, skipping invalid items
+func splitInts(list string) []int {
+	var values []int
+	for _, part := range splitList(list) {
+		if v, err := strconv.Atoi(part); err == nil {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// handlePatchTask applies a JSON merge patch to a task: fields in the body
+// are set, null clears a field and omitted fields keep their value
+func (s *Server) handlePatchTask(w http.ResponseWriter, r *http.Request) {
+	id, err := s.parseTaskID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidTaskID, "Invalid task ID")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	fields, err := s.parseTaskPatch(body, s.requestLocation(r))
+	if err != nil {
+		var verr *validationError
+		if errors.As(err, &verr) {
+			writeValidationError(w, err)
+		} else {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON")
+		}
+		return
+	}
+	versions, ok := s.ifMatchVersions(w, r)
+	if !ok {
+		return
+	}
+
+	task, exists, err := s.store.PatchIfMatch(forceContext(r), id, versions, fields)
+	var verr *validationError
+	if errors.As(err, &verr) {
+		writeValidationError(w, err)
+		return
+	}
+	if errors.Is(err, ErrVersionMismatch) {
+		writeVersionMismatch(w)
+		return
+	}
+	if errors.Is(err, ErrTaskBlocked) {
+		writeTaskBlocked(w)
+		return
+	}
+	if errors.Is(err, ErrTransitionNotAllowed) {
+		writeTransitionNotAllowed(w, err)
+		return
+	}
+	if errors.Is(err, ErrProjectNotFound) {
+		writeError(w, http.StatusUnprocessableEntity, ErrCodeProjectNotFound, "Project not found")
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if !exists {
+		writeError(w, http.StatusNotFound, ErrCodeTaskNotFound, "Task not found")
+		return
+	}
+	taskOps.Add("update", 1)
+
+	w.Header().Set("ETag", taskETag(task))
+	writeJSON(w, http.StatusOK, updateResponse{
+		publicTask:          s.presentTask(task),
+		OverdueOnCompletion: completedLate(task),
+	})
+}
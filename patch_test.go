@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// patchTask sends a PATCH for task 1 and returns the response
+func patchTask(server *Server, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("PATCH", "/api/v1/tasks/1", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	req = mux.SetURLVars(req, map[string]string{"id": "1"})
+	w := httptest.NewRecorder()
+	server.handlePatchTask(w, req)
+	return w
+}
+
+func TestPatchTaskChangesOnlyGivenFields(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.store.Add(context.Background(), "Report", "Quarterly numbers", dueOn("2024-06-30"), "high")
+
+	w := patchTask(server, `{"status":"completed"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status code = %d; want %d (%s)", w.Code, http.StatusOK, w.Body.String())
+	}
+	var task Task
+	if err := json.NewDecoder(w.Body).Decode(&task); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if task.Status != "completed" || task.CompletedAt == nil {
+		t.Errorf("status = %q, completed_at = %v; want completed with a time", task.Status, task.CompletedAt)
+	}
+	if task.Title != "Report" || task.Description != "Quarterly numbers" || task.DueDate.Day(time.Local) != "2024-06-30" || task.Priority != "high" {
+		t.Errorf("task = %+v; want other fields unchanged", task)
+	}
+
+	// null clears a nullable field
+	w = patchTask(server, `{"due_date":null,"title":"Final report"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status code = %d; want %d", w.Code, http.StatusOK)
+	}
+	got, _ := server.store.Get(1)
+	if !got.DueDate.IsZero() || got.Title != "Final report" || got.Status != "completed" {
+		t.Errorf("task = %+v; want due date cleared, title changed, still completed", got)
+	}
+}
+
+func TestPatchTaskRejectsInvalidPatches(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.store.Add(context.Background(), "Report", "", DueTime{}, "high")
+
+	tests := []struct {
+		body string
+		want int
+	}{
+		{`{`, http.StatusBadRequest},
+		{`[]`, http.StatusBadRequest},
+		{`{"title":""}`, http.StatusUnprocessableEntity},
+		{`{"title":null}`, http.StatusUnprocessableEntity},
+		{`{"priority":3}`, http.StatusUnprocessableEntity},
+		{`{"owner":"sam"}`, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		if w := patchTask(server, tt.body); w.Code != tt.want {
+			t.Errorf("%s: status = %d; want %d", tt.body, w.Code, tt.want)
+		}
+	}
+	if got, _ := server.store.Get(1); got.Title != "Report" || got.Priority != "high" {
+		t.Errorf("task = %+v; want unchanged", got)
+	}
+}
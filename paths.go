@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Where the server keeps its files. configurePaths sets them before the
+// config is loaded; the defaults keep everything in the working directory.
+var (
+	// dataDir holds the tasks, the config and every other file the server
+	// writes, so it is the only directory that needs to be writable
+	dataDir = "."
+	// configFile is the config file when it isn't config.json in dataDir
+	configFile = ""
+)
+
+// dataPath resolves name, a file or directory the server keeps, against
+// dataDir. Absolute paths are left as they are.
+func dataPath(name string) string {
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(dataDir, name)
+}
+
+// configPath returns the file the config is loaded from and saved to
+func configPath() string {
+	if configFile != "" {
+		return configFile
+	}
+	return dataPath("config.json")
+}
+
+// configurePaths sets the data directory and config file from the
+// --data-dir and --config flags, or when those are empty the
+// TASKMATE_DATA_DIR and TASKMATE_CONFIG environment variables, and creates
+// the data directory if it doesn't exist
+func configurePaths(dir, config string, getenv func(string) string) error {
+	if dir == "" {
+		dir = getenv("TASKMATE_DATA_DIR")
+	}
+	if config == "" {
+		config = getenv("TASKMATE_CONFIG")
+	}
+	if dir != "" {
+		dataDir = dir
+	}
+	configFile = config
+	return os.MkdirAll(dataDir, 0700)
+}
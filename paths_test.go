@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// usePaths points the data directory and config file at dir and file for
+// the rest of the test
+func usePaths(t *testing.T, dir, file string, env map[string]string) {
+	t.Helper()
+	prevDir, prevConfig := dataDir, configFile
+	t.Cleanup(func() { dataDir, configFile = prevDir, prevConfig })
+	if err := configurePaths(dir, file, func(key string) string { return env[key] }); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfigurePaths(t *testing.T) {
+	root := t.TempDir()
+	data := filepath.Join(root, "data", "nested")
+
+	usePaths(t, "", "", map[string]string{"TASKMATE_DATA_DIR": data})
+	if info, err := os.Stat(data); err != nil || !info.IsDir() {
+		t.Fatalf("data directory not created: %v", err)
+	}
+	if got := dataPath("tasks.json"); got != filepath.Join(data, "tasks.json") {
+		t.Errorf("dataPath(tasks.json) = %q", got)
+	}
+	if got := dataPath("/var/lib/audit.log"); got != "/var/lib/audit.log" {
+		t.Errorf("dataPath kept absolute path as %q", got)
+	}
+	if got := configPath(); got != filepath.Join(data, "config.json") {
+		t.Errorf("configPath = %q; want config.json in the data directory", got)
+	}
+
+	// Flags win over the environment
+	flagDir := filepath.Join(root, "flag")
+	usePaths(t, flagDir, filepath.Join(root, "taskmate.json"), map[string]string{"TASKMATE_DATA_DIR": data, "TASKMATE_CONFIG": "ignored.json"})
+	if dataDir != flagDir || configPath() != filepath.Join(root, "taskmate.json") {
+		t.Errorf("paths = %q, %q; want the flags", dataDir, configPath())
+	}
+}
+
+func TestConfigInDataDir(t *testing.T) {
+	dir := t.TempDir()
+	usePaths(t, dir, "", nil)
+
+	if err := SaveConfig(&Config{Port: "9090", TokenHashes: []string{}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "config.json")); err != nil {
+		t.Fatalf("config not saved in the data directory: %v", err)
+	}
+	t.Setenv("TASKMATE_PORT", "")
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Port != "9090" {
+		t.Errorf("port = %q; want the saved 9090", config.Port)
+	}
+	if got := config.auditLogPath(); got != filepath.Join(dir, defaultAuditLog) {
+		t.Errorf("audit log = %q; want it in the data directory", got)
+	}
+}
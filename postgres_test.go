@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+// openTestPostgresStore opens a store on the disposable database named by
+// TASKMATE_TEST_DB_URL, skipping the test when it is unset. With truncate
+// the tasks and projects tables are emptied first.
+func openTestPostgresStore(t *testing.T, truncate bool) *TaskStore {
+	t.Helper()
+	url := os.Getenv("TASKMATE_TEST_DB_URL")
+	if url == "" {
+		t.Skip("TASKMATE_TEST_DB_URL not set")
+	}
+	backend, err := openPostgresBackend(PostgresConfig{URL: url})
+	if err != nil {
+		t.Fatalf("openPostgresBackend() error = %v", err)
+	}
+	t.Cleanup(func() { backend.Close() })
+	if truncate {
+		if _, err := backend.db.Exec(`TRUNCATE tasks, projects, task_revisions, task_comments`); err != nil {
+			t.Fatalf("truncate tasks: %v", err)
+		}
+	}
+	store, err := NewTaskStoreWithStorage(backend)
+	if err != nil {
+		t.Fatalf("NewTaskStoreWithStorage() error = %v", err)
+	}
+	return store
+}
+
+func TestPostgresBackendPersistsChanges(t *testing.T) {
+	store := openTestPostgresStore(t, true)
+	ctx := context.Background()
+
+	first, _ := store.Add(ctx, "First", "", DueTime{}, "high")
+	second, _ := store.Add(ctx, "Second", "", DueTime{}, "low")
+	if _, _, err := store.Update(ctx, first.ID, "First", "", DueTime{}, "high", "completed"); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if _, err := store.Delete(ctx, second.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	// A second instance on the same database sees the changes, and running
+	// the migrations again is a no-op
+	reopened := openTestPostgresStore(t, false)
+	tasks := reopened.GetAll()
+	if len(tasks) != 1 || tasks[0].Title != "First" || tasks[0].Status != "completed" {
+		t.Errorf("tasks = %+v; want only the completed First task", tasks)
+	}
+}
+
+func TestPostgresInstancesShareTasks(t *testing.T) {
+	first := openTestPostgresStore(t, true)
+	second := openTestPostgresStore(t, false)
+	ctx := context.Background()
+
+	// IDs come from the database, so neither instance reuses the other's
+	a, err := first.Add(ctx, "From first", "", DueTime{}, "medium")
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	b, err := second.Add(ctx, "From second", "", DueTime{}, "medium")
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if a.ID == b.ID {
+		t.Fatalf("both instances added task %d", a.ID)
+	}
+	p, err := first.AddProject(ctx, "First", "")
+	if err != nil {
+		t.Fatalf("AddProject() error = %v", err)
+	}
+	if _, err := second.AddProject(ctx, "Second", ""); err != nil {
+		t.Fatalf("AddProject() error = %v", err)
+	}
+
+	if err := second.Refresh(ctx); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if got, ok := second.Get(a.ID); !ok || got.Title != "From first" {
+		t.Errorf("Get() after Refresh = %+v, %v; want the first instance's task", got, ok)
+	}
+	// Saving its own project left the first instance's row alone
+	if _, ok := second.GetProject(p.ID); !ok {
+		t.Error("first instance's project missing after Refresh")
+	}
+
+	if _, _, err := second.Patch(ctx, a.ID, map[string]string{"title": "Renamed"}); err != nil {
+		t.Fatalf("Patch() error = %v", err)
+	}
+	// The first instance hasn't seen the rename, so its update conflicts
+	_, _, err = first.Patch(ctx, a.ID, map[string]string{"title": "Stale"})
+	if !errors.Is(err, ErrStorageConflict) {
+		t.Fatalf("Patch() of a stale task error = %v; want ErrStorageConflict", err)
+	}
+	if err := first.Refresh(ctx); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if got, _ := first.Get(a.ID); got.Title != "Renamed" {
+		t.Errorf("title after Refresh = %q; want Renamed", got.Title)
+	}
+}
+
+func TestPostgresRequiresURL(t *testing.T) {
+	if _, err := OpenStore(&Config{Storage: "postgres"}, "test_tasks.json"); err == nil {
+		t.Error("OpenStore() error = nil; want error without a database URL")
+	}
+}
+
+func TestSanitizedConfigRedactsPostgresURL(t *testing.T) {
+	config := &Config{Postgres: PostgresConfig{URL: "postgres://taskmate:secret@db/taskmate", MaxOpenConns: 20}}
+	got := config.Sanitized()
+	if got.Postgres.URL != "" || !got.PostgresURLSet || got.Postgres.MaxOpenConns != 20 {
+		t.Errorf("sanitized postgres = %+v, url set %v; want URL removed, pool kept", got.Postgres, got.PostgresURLSet)
+	}
+	if !strings.Contains(config.Postgres.URL, "secret") {
+		t.Error("Sanitized() modified the original config")
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// PriorityLevel is a custom task priority and where it sorts among the
+// others
+type PriorityLevel struct {
+	Name string `json:"name"`
+	// SortWeight places the level in priority order; higher is more
+	// urgent. The built-in levels weigh low 10, medium 20, high 30 and
+	// urgent 40.
+	SortWeight int `json:"sort_weight"`
+}
+
+// builtinPriorities are the priorities every server accepts
+var builtinPriorities = []PriorityLevel{
+	{Name: "low", SortWeight: 10},
+	{Name: "medium", SortWeight: 20},
+	{Name: "high", SortWeight: 30},
+	{Name: "urgent", SortWeight: 40},
+}
+
+// priorityRanking maps each accepted priority to its sort weight; unknown
+// priorities, such as those stored before priorities were checked, sort
+// before low. Each store has its own, with the configured priority_levels
+// added by NewServerWithStore.
+type priorityRanking map[string]int
+
+// priorityRanks returns the sort weights of the built-in priorities and
+// custom, which may also reweigh a built-in one
+func priorityRanks(custom []PriorityLevel) priorityRanking {
+	ranks := make(priorityRanking, len(builtinPriorities)+len(custom))
+	for _, level := range builtinPriorities {
+		ranks[level.Name] = level.SortWeight
+	}
+	for _, level := range custom {
+		ranks[level.Name] = level.SortWeight
+	}
+	return ranks
+}
+
+// names lists the accepted priorities from least to most urgent
+func (p priorityRanking) names() []string {
+	names := make([]string, 0, len(p))
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if p[names[i]] != p[names[j]] {
+			return p[names[i]] < p[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// check returns a *validationError unless priority is a built-in or
+// configured priority
+func (p priorityRanking) check(priority string) error {
+	if _, ok := p[priority]; ok {
+		return nil
+	}
+	return &validationError{ErrCodeInvalidPriority, "priority must be one of: " + strings.Join(p.names(), ", ")}
+}
+
+// validatePriorityLevels checks the configured priority_levels: names must
+// be lowercase, without commas (filters take comma-separated lists), and
+// listed once, and weights positive so that they sort after unknown ones
+func validatePriorityLevels(levels []PriorityLevel) error {
+	seen := make(map[string]bool, len(levels))
+	for _, level := range levels {
+		switch {
+		case level.Name == "":
+			return errors.New("every level needs a name")
+		case level.Name != strings.ToLower(strings.TrimSpace(level.Name)) || strings.Contains(level.Name, ","):
+			return fmt.Errorf("name %q must be lowercase, without commas or surrounding spaces", level.Name)
+		case seen[level.Name]:
+			return fmt.Errorf("%q is listed twice", level.Name)
+		case level.SortWeight <= 0:
+			return fmt.Errorf("sort_weight for %q must be positive", level.Name)
+		}
+		seen[level.Name] = true
+	}
+	return nil
+}
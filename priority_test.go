@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPriorityValidation(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.TokenHashes = []string{hashString("secret-token")}
+	server.store.Add(context.Background(), "Existing", "", DueTime{}, "high")
+	r, err := server.Router()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, method, path, body string
+		want                     int
+	}{
+		{"create urgent", "POST", "/api/v1/tasks", `{"title":"Fire","priority":"urgent"}`, http.StatusCreated},
+		{"create unknown", "POST", "/api/v1/tasks", `{"title":"Fire","priority":"critical"}`, http.StatusUnprocessableEntity},
+		{"create wrong case", "POST", "/api/v1/tasks", `{"title":"Fire","priority":"High"}`, http.StatusUnprocessableEntity},
+		{"put unknown", "PUT", "/api/v1/tasks/1", `{"title":"Existing","priority":"asap"}`, http.StatusUnprocessableEntity},
+		{"patch unknown", "PATCH", "/api/v1/tasks/1", `{"priority":"asap"}`, http.StatusUnprocessableEntity},
+		{"put without priority", "PUT", "/api/v1/tasks/1", `{"title":"Existing"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		req.Header.Set("X-API-Token", "secret-token")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d; want %d (%s)", tt.name, w.Code, tt.want, w.Body.String())
+		}
+		if tt.want == http.StatusUnprocessableEntity && !strings.Contains(w.Body.String(), ErrCodeInvalidPriority) {
+			t.Errorf("%s: body %s; want %s", tt.name, w.Body.String(), ErrCodeInvalidPriority)
+		}
+	}
+	if task, _ := server.store.Get(1); task.Priority != "high" {
+		t.Errorf("priority = %q; want high kept by the PUT without one", task.Priority)
+	}
+}
+
+func TestCustomPriorityLevels(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	config := &Config{PriorityLevels: []PriorityLevel{{Name: "blocker", SortWeight: 50}, {Name: "someday", SortWeight: 5}}}
+	server = NewServerWithStore(config, server.store)
+
+	if got := server.store.priorities.names(); !reflect.DeepEqual(got, []string{"someday", "low", "medium", "high", "urgent", "blocker"}) {
+		t.Errorf("priority names = %q; want the custom levels by weight", got)
+	}
+	for _, priority := range []string{"someday", "medium", "blocker", "urgent"} {
+		req := &createTaskRequest{Title: priority, Priority: priority}
+		fields, err := server.newTaskFields(req, server.location)
+		if err != nil {
+			t.Fatalf("newTaskFields(%s) error = %v", priority, err)
+		}
+		server.store.AddTask(context.Background(), fields)
+	}
+	titles, _ := listTitles(t, server, "?sort=priority&order=desc")
+	if want := []string{"blocker", "urgent", "medium", "someday"}; !reflect.DeepEqual(titles, want) {
+		t.Errorf("sorted by priority = %q; want %q", titles, want)
+	}
+
+	err := server.store.priorities.check("critical")
+	if err == nil || !strings.Contains(err.Error(), "someday, low, medium, high, urgent, blocker") {
+		t.Errorf("check(critical) error = %v; want the accepted levels listed", err)
+	}
+
+	// Other servers keep their own levels
+	other, cleanupOther := setupTestServer()
+	defer cleanupOther()
+	if err := other.store.priorities.check("blocker"); err == nil {
+		t.Error("a custom level leaked into another server")
+	}
+}
+
+func TestValidatePriorityLevels(t *testing.T) {
+	if err := validatePriorityLevels([]PriorityLevel{{Name: "blocker", SortWeight: 50}, {Name: "high", SortWeight: 35}}); err != nil {
+		t.Errorf("validatePriorityLevels() error = %v; want nil", err)
+	}
+	for _, levels := range [][]PriorityLevel{
+		{{Name: "", SortWeight: 1}},
+		{{Name: "Blocker", SortWeight: 1}},
+		{{Name: "a,b", SortWeight: 1}},
+		{{Name: "blocker", SortWeight: 1}, {Name: "blocker", SortWeight: 2}},
+		{{Name: "blocker", SortWeight: 0}},
+	} {
+		if err := validatePriorityLevels(levels); err == nil {
+			t.Errorf("validatePriorityLevels(%+v) error = nil; want an error", levels)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Project is a named list that tasks can be filed under
+type Project struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Owner is the user who created the project, as in the audit log.
+	// Projects without one, created before projects had owners or from
+	// the command line, are open to everyone.
+	Owner string `json:"owner,omitempty"`
+	// Collaborators are the other users the owner shared the project with
+	Collaborators []Collaborator `json:"collaborators,omitempty"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+}
+
+var (
+	// ErrProjectNotFound is returned when a project ID doesn't exist
+	ErrProjectNotFound = errors.New("project not found")
+	// ErrProjectNotEmpty is returned when deleting a project that still
+	// has tasks
+	ErrProjectNotEmpty = errors.New("project has tasks")
+	// errProjectsUnsupported is returned when the storage backend can't
+	// persist projects
+	errProjectsUnsupported = errors.New("storage backend does not support projects")
+)
+
+// loadProjects reads the projects from the backend, if it stores them
+func (ts *TaskStore) loadProjects() error {
+	backend, ok := ts.storage.(ProjectBackend)
+	if !ok {
+		return nil
+	}
+	projects, err := backend.LoadProjects()
+	if err != nil {
+		return fmt.Errorf("load projects: %w", err)
+	}
+	for _, project := range projects {
+		ts.projects[project.ID] = project
+		if project.ID >= ts.nextProjectID {
+			ts.nextProjectID = project.ID + 1
+		}
+	}
+	return nil
+}
+
+// saveProjects persists the projects with the given IDs, deleting those
+// that no longer exist. The caller must hold the write lock.
+func (ts *TaskStore) saveProjects(ctx context.Context, changed ...int) error {
+	if ts.closed {
+		return ErrStoreClosed
+	}
+	backend, ok := ts.storage.(ProjectBackend)
+	if !ok {
+		return errProjectsUnsupported
+	}
+	_, span := startSpan(ctx, "storage.save_projects")
+	defer span.End()
+	err := backend.SaveProjects(ts.projects, changed)
+	spanError(span, err)
+	return err
+}
+
+// projectListLocked returns the projects in ID order
+func (ts *TaskStore) projectListLocked() []*Project {
+	projects := make([]*Project, 0, len(ts.projects))
+	for _, project := range ts.projects {
+		projects = append(projects, project)
+	}
+	sort.Slice(projects, func(i, j int) bool {
+		return projects[i].ID < projects[j].ID
+	})
+	return projects
+}
+
+// Projects returns all projects in ID order
+func (ts *TaskStore) Projects() []*Project {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return ts.projectListLocked()
+}
+
+// GetProject retrieves a project by ID
+func (ts *TaskStore) GetProject(id int) (*Project, bool) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	project, exists := ts.projects[id]
+	return project, exists
+}
+
+// AddProject creates a project owned by the caller. Like Add, it rolls
+// back if the project can't be saved.
+func (ts *TaskStore) AddProject(ctx context.Context, name, description string) (*Project, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := ts.reserveIDsLocked(ctx, ProjectIDs, 1, &ts.nextProjectID); err != nil {
+		return nil, err
+	}
+	now := ts.now()
+	project := &Project{
+		ID:          ts.nextProjectID,
+		Name:        name,
+		Description: description,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if actor := auditActor(ctx); actor != "system" {
+		project.Owner = actor
+	}
+	ts.projects[project.ID] = project
+	ts.nextProjectID++
+	if err := ts.saveProjects(ctx, project.ID); err != nil {
+		delete(ts.projects, project.ID)
+		ts.nextProjectID = project.ID
+		return nil, fmt.Errorf("save projects: %w", err)
+	}
+	ts.recordMutation(ctx, AuditCreate, auditProject, project.ID, nil, project)
+	return project, nil
+}
+
+// UpdateProject renames a project, which takes edit permission. Like
+// Update, the bool reports whether the project exists.
+func (ts *TaskStore) UpdateProject(ctx context.Context, id int, name, description string) (*Project, bool, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	project, exists := ts.projects[id]
+	if !exists {
+		return nil, false, nil
+	}
+	if err := ts.checkProjectLocked(ctx, id, PermissionEdit); err != nil {
+		return nil, true, err
+	}
+	prev := *project
+	project.Name = name
+	project.Description = description
+	project.UpdatedAt = ts.now()
+	if err := ts.saveProjects(ctx, id); err != nil {
+		*project = prev
+		return nil, true, fmt.Errorf("save projects: %w", err)
+	}
+	ts.recordMutation(ctx, AuditUpdate, auditProject, id, &prev, project)
+	return project, true, nil
+}
+
+// DeleteProject removes an empty project, which only its owner may do. It
+// returns ErrProjectNotEmpty while any task, live or archived, still
+// belongs to it, so tasks are never orphaned.
+func (ts *TaskStore) DeleteProject(ctx context.Context, id int) (bool, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	project, exists := ts.projects[id]
+	if !exists {
+		return false, nil
+	}
+	if err := ts.checkProjectLocked(ctx, id, permissionOwner); err != nil {
+		return true, err
+	}
+	for _, partition := range []map[int]*Task{ts.tasks, ts.archive} {
+		for _, task := range partition {
+			if task.ProjectID == id {
+				return true, ErrProjectNotEmpty
+			}
+		}
+	}
+	delete(ts.projects, id)
+	if err := ts.saveProjects(ctx, id); err != nil {
+		ts.projects[id] = project
+		return true, fmt.Errorf("save projects: %w", err)
+	}
+	ts.recordMutation(ctx, AuditDelete, auditProject, id, project, nil)
+	return true, nil
+}
+
+// parseProjectID converts a project ID from a URL, query or patch value
+func parseProjectID(raw string) (int, error) {
+	id, err := strconv.Atoi(raw)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid project ID %q", raw)
+	}
+	return id, nil
+}
+
+// projectRequest is the body accepted when creating or replacing a project
+type projectRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// parseProjectRequest decodes and validates a project body, writing the
+// error response itself when it fails
+func parseProjectRequest(w http.ResponseWriter, r *http.Request) (projectRequest, bool) {
+	var req projectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON")
+		return req, false
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		writeError(w, http.StatusUnprocessableEntity, ErrCodeNameRequired, "Name is required")
+		return req, false
+	}
+	return req, true
+}
+
+// projectFromURL looks up the {id} project, writing a 400 or 404 when it
+// can't be found
+func (s *Server) projectFromURL(w http.ResponseWriter, r *http.Request) (*Project, bool) {
+	id, err := parseProjectID(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidProjectID, "Invalid project ID")
+		return nil, false
+	}
+	project, exists := s.store.GetProject(id)
+	if !exists {
+		writeError(w, http.StatusNotFound, ErrCodeProjectNotFound, "Project not found")
+		return nil, false
+	}
+	return project, true
+}
+
+// handleGetProjects lists all projects
+func (s *Server) handleGetProjects(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.store.Projects())
+}
+
+// handleGetProject returns one project
+func (s *Server) handleGetProject(w http.ResponseWriter, r *http.Request) {
+	if project, ok := s.projectFromURL(w, r); ok {
+		writeJSON(w, http.StatusOK, project)
+	}
+}
+
+// handleGetProjectTasks lists a project's tasks, with the same filters,
+// sorting, pagination and formats as /tasks
+func (s *Server) handleGetProjectTasks(w http.ResponseWriter, r *http.Request) {
+	project, ok := s.projectFromURL(w, r)
+	if !ok {
+		return
+	}
+	filter, err := parseTaskFilter(r.URL.Query(), s.requestLocation(r))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidQuery, err.Error())
+		return
+	}
+	filter.ProjectID = project.ID
+	s.writeTaskList(w, r, s.store.List(filter))
+}
+
+// handleCreateProject creates a project
+func (s *Server) handleCreateProject(w http.ResponseWriter, r *http.Request) {
+	req, ok := parseProjectRequest(w, r)
+	if !ok {
+		return
+	}
+	project, err := s.store.AddProject(r.Context(), req.Name, req.Description)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, project)
+}
+
+// handleUpdateProject replaces a project's name and description
+func (s *Server) handleUpdateProject(w http.ResponseWriter, r *http.Request) {
+	id, err := parseProjectID(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidProjectID, "Invalid project ID")
+		return
+	}
+	req, ok := parseProjectRequest(w, r)
+	if !ok {
+		return
+	}
+	project, exists, err := s.store.UpdateProject(r.Context(), id, req.Name, req.Description)
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if !exists {
+		writeError(w, http.StatusNotFound, ErrCodeProjectNotFound, "Project not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, project)
+}
+
+// handleDeleteProject deletes an empty project
+func (s *Server) handleDeleteProject(w http.ResponseWriter, r *http.Request) {
+	id, err := parseProjectID(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidProjectID, "Invalid project ID")
+		return
+	}
+	exists, err := s.store.DeleteProject(r.Context(), id)
+	switch {
+	case errors.Is(err, ErrProjectNotEmpty):
+		writeError(w, http.StatusConflict, ErrCodeProjectNotEmpty, "Project still has tasks")
+	case err != nil:
+		writeStoreError(w, err)
+	case !exists:
+		writeError(w, http.StatusNotFound, ErrCodeProjectNotFound, "Project not found")
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestProjectCRUD(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	w := httptest.NewRecorder()
+	server.handleCreateProject(w, httptest.NewRequest("POST", "/api/v1/projects",
+		bytes.NewBufferString(`{"name":"Home"}`)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create status = %d; want %d", w.Code, http.StatusCreated)
+	}
+	var project Project
+	if err := json.NewDecoder(w.Body).Decode(&project); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+
+	req := mux.SetURLVars(httptest.NewRequest("PUT", "/api/v1/projects/1",
+		bytes.NewBufferString(`{"name":"House","description":"Chores"}`)), map[string]string{"id": "1"})
+	w = httptest.NewRecorder()
+	server.handleUpdateProject(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update status = %d; want %d", w.Code, http.StatusOK)
+	}
+	if got, _ := server.store.GetProject(project.ID); got.Name != "House" || got.Description != "Chores" {
+		t.Errorf("project = %+v; want renamed", got)
+	}
+
+	req = mux.SetURLVars(httptest.NewRequest("DELETE", "/api/v1/projects/1", nil), map[string]string{"id": "1"})
+	w = httptest.NewRecorder()
+	server.handleDeleteProject(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("delete status = %d; want %d", w.Code, http.StatusNoContent)
+	}
+	if projects := server.store.Projects(); len(projects) != 0 {
+		t.Errorf("projects = %+v; want none", projects)
+	}
+}
+
+func TestProjectTasks(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	ctx := context.Background()
+	project, _ := server.store.AddProject(ctx, "Work", "")
+	server.store.AddTask(ctx, Task{Title: "Report", Priority: "high", ProjectID: project.ID})
+	server.store.Add(ctx, "Groceries", "", DueTime{}, "medium")
+	if _, err := server.store.AddTask(ctx, Task{Title: "Lost", ProjectID: 99}); err != ErrProjectNotFound {
+		t.Errorf("AddTask with missing project err = %v; want ErrProjectNotFound", err)
+	}
+
+	req := mux.SetURLVars(httptest.NewRequest("GET", "/api/v1/projects/1/tasks", nil), map[string]string{"id": "1"})
+	w := httptest.NewRecorder()
+	server.handleGetProjectTasks(w, req)
+	var tasks []Task
+	if err := json.NewDecoder(w.Body).Decode(&tasks); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(tasks) != 1 || tasks[0].Title != "Report" || tasks[0].ProjectID != project.ID {
+		t.Errorf("project tasks = %+v; want Report", tasks)
+	}
+
+	// A project with tasks can't be deleted until they are moved out
+	if _, err := server.store.DeleteProject(ctx, project.ID); err != ErrProjectNotEmpty {
+		t.Fatalf("DeleteProject err = %v; want ErrProjectNotEmpty", err)
+	}
+	req = mux.SetURLVars(httptest.NewRequest("PATCH", "/api/v1/tasks/2",
+		bytes.NewBufferString(`{"project_id":1}`)), map[string]string{"id": "2"})
+	w = httptest.NewRecorder()
+	server.handlePatchTask(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("patch status = %d; want %d", w.Code, http.StatusOK)
+	}
+	if got, _ := listTitles(t, server, "?project_id=1"); len(got) != 2 {
+		t.Errorf("tasks in project = %q; want both", got)
+	}
+
+	for _, id := range []int{1, 2} {
+		if _, _, err := server.store.Patch(ctx, id, map[string]string{"project_id": ""}); err != nil {
+			t.Fatalf("Patch: %v", err)
+		}
+	}
+	if _, err := server.store.DeleteProject(ctx, project.ID); err != nil {
+		t.Errorf("DeleteProject after emptying: %v", err)
+	}
+}
+
+func TestPatchProjectValidation(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.store.Add(context.Background(), "Task", "", DueTime{}, "medium")
+
+	for body, wantCode := range map[string]string{
+		`{"project_id":"1"}`: ErrCodeValidation,
+		`{"project_id":0}`:   ErrCodeValidation,
+		`{"project_id":5}`:   ErrCodeProjectNotFound,
+	} {
+		req := mux.SetURLVars(httptest.NewRequest("PATCH", "/api/v1/tasks/1", bytes.NewBufferString(body)),
+			map[string]string{"id": "1"})
+		w := httptest.NewRecorder()
+		server.handlePatchTask(w, req)
+		var resp struct {
+			Code string `json:"code"`
+		}
+		json.NewDecoder(w.Body).Decode(&resp)
+		if w.Code != http.StatusUnprocessableEntity || resp.Code != wantCode {
+			t.Errorf("%s: status %d code %q; want 422 %s", body, w.Code, resp.Code, wantCode)
+		}
+	}
+}
+
+func TestProjectsPersist(t *testing.T) {
+	for name, open := range map[string]func(dir string) (Storage, error){
+		"json": func(dir string) (Storage, error) {
+			return &jsonBackend{path: filepath.Join(dir, "tasks.json")}, nil
+		},
+		"sqlite": func(dir string) (Storage, error) {
+			return openSQLiteBackend(filepath.Join(dir, "tasks.db"))
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			backend, err := open(dir)
+			if err != nil {
+				t.Fatalf("open: %v", err)
+			}
+			store, _ := NewTaskStoreWithStorage(backend)
+			ctx := context.Background()
+			store.AddProject(ctx, "First", "")
+			store.AddProject(ctx, "Second", "")
+			store.DeleteProject(ctx, 1)
+
+			reloaded, err := NewTaskStoreWithStorage(backend)
+			if err != nil {
+				t.Fatalf("reload: %v", err)
+			}
+			projects := reloaded.Projects()
+			if len(projects) != 1 || projects[0].Name != "Second" {
+				t.Fatalf("projects = %+v; want only Second", projects)
+			}
+			if project, _ := reloaded.AddProject(ctx, "Third", ""); project.ID != 3 {
+				t.Errorf("next project ID = %d; want 3", project.ID)
+			}
+		})
+	}
+}
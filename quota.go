@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrQuotaExceeded is returned by Add when the new task would push the
+// weighted count of open tasks past Config.MaxTasks
+var ErrQuotaExceeded = errors.New("task quota exceeded")
+
+// taskQuota limits open tasks by the sum of their priority weights
+type taskQuota struct {
+	// limit is the largest allowed weighted total; 0 means unlimited
+	limit int
+	// weights maps priorities to their cost; missing priorities cost 1
+	weights map[string]int
+}
+
+// weight returns what a task with the given priority counts against the
+// quota
+func (q taskQuota) weight(priority string) int {
+	if w, ok := q.weights[priority]; ok {
+		return w
+	}
+	return 1
+}
+
+// QuotaUsage is the weighted size of open tasks against the configured
+// limit, which is omitted when there is none
+type QuotaUsage struct {
+	Used  int `json:"used"`
+	Limit int `json:"limit,omitempty"`
+}
+
+// quotaUsedLocked sums the weights of tasks that aren't completed. The
+// caller must hold a lock.
+func (ts *TaskStore) quotaUsedLocked() int {
+	used := 0
+	for _, task := range ts.tasks {
+		if task.Status != "completed" {
+			used += ts.quota.weight(task.Priority)
+		}
+	}
+	return used
+}
+
+// validatePriorityWeights rejects negative weights
+func validatePriorityWeights(weights map[string]int) error {
+	for priority, w := range weights {
+		if w < 0 {
+			return fmt.Errorf("weight for priority %q must not be negative", priority)
+		}
+	}
+	return nil
+}
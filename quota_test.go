@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWeightedQuota(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.store.quota = taskQuota{limit: 5, weights: map[string]int{"high": 3, "medium": 2}}
+
+	create := func(priority string) int {
+		body := `{"title":"Task","priority":"` + priority + `"}`
+		w := httptest.NewRecorder()
+		server.handleCreateTask(w, httptest.NewRequest("POST", "/api/v1/tasks", bytes.NewBufferString(body)))
+		return w.Code
+	}
+
+	if code := create("high"); code != http.StatusCreated {
+		t.Fatalf("first high: status = %d; want %d", code, http.StatusCreated)
+	}
+	// 3 used; another high would need 6
+	if code := create("high"); code != http.StatusInsufficientStorage {
+		t.Errorf("second high: status = %d; want %d", code, http.StatusInsufficientStorage)
+	}
+	if code := create("medium"); code != http.StatusCreated {
+		t.Errorf("medium: status = %d; want %d", code, http.StatusCreated)
+	}
+	// 5 used; even an unweighted priority no longer fits
+	if code := create("low"); code != http.StatusInsufficientStorage {
+		t.Errorf("low: status = %d; want %d", code, http.StatusInsufficientStorage)
+	}
+
+	// Completed tasks don't count
+	server.store.Update(context.Background(), 1, "Task", "", DueTime{}, "high", "completed")
+	if code := create("low"); code != http.StatusCreated {
+		t.Errorf("low after completing: status = %d; want %d", code, http.StatusCreated)
+	}
+
+	w := httptest.NewRecorder()
+	server.handleGetStats(w, httptest.NewRequest("GET", "/api/v1/stats", nil))
+	var stats TaskStats
+	if err := json.NewDecoder(w.Body).Decode(&stats); err != nil {
+		t.Fatalf("decode stats: %v", err)
+	}
+	if stats.Quota != (QuotaUsage{Used: 3, Limit: 5}) {
+		t.Errorf("quota = %+v; want used 3, limit 5", stats.Quota)
+	}
+}
+
+func TestQuotaDefaultsToPlainCount(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.store.quota = taskQuota{limit: 2}
+
+	ctx := context.Background()
+	for _, priority := range []string{"high", "low"} {
+		if _, err := server.store.Add(ctx, "Task", "", DueTime{}, priority); err != nil {
+			t.Fatalf("Add(%s) error = %v", priority, err)
+		}
+	}
+	if _, err := server.store.Add(ctx, "Task", "", DueTime{}, "low"); err != ErrQuotaExceeded {
+		t.Errorf("third Add() error = %v; want %v", err, ErrQuotaExceeded)
+	}
+}
+
+func TestValidatePriorityWeights(t *testing.T) {
+	if err := validatePriorityWeights(map[string]int{"high": 3, "low": 0}); err != nil {
+		t.Errorf("valid weights: error = %v", err)
+	}
+	if err := validatePriorityWeights(map[string]int{"high": -1}); err == nil {
+		t.Error("negative weight: expected an error")
+	}
+}
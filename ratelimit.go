@@ -0,0 +1,187 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimitSweepInterval is how often idle clients are forgotten
+const rateLimitSweepInterval = time.Minute
+
+// RateLimitConfig limits how fast each client may send requests. A client
+// is its API token when it sends a valid one and its IP address otherwise.
+type RateLimitConfig struct {
+	// RequestsPerMinute is the sustained rate allowed per client; 0 turns
+	// the limit off
+	RequestsPerMinute int `json:"requests_per_minute,omitempty"`
+	// Burst is how many requests a client may send at once after being
+	// idle (default: RequestsPerMinute)
+	Burst int `json:"burst,omitempty"`
+	// AuthRequestsPerMinute limits token generation, password changes and
+	// OIDC logins per IP address, on top of RequestsPerMinute; 0 turns the
+	// limit off
+	AuthRequestsPerMinute int `json:"auth_requests_per_minute,omitempty"`
+	// TrustProxy takes the client IP from X-Forwarded-For. Only enable it
+	// behind a proxy that appends to the header, or clients can pick their
+	// own IP.
+	TrustProxy bool `json:"trust_proxy,omitempty"`
+	// ProxyHops is how many proxies in front of the server append to
+	// X-Forwarded-For (default: 1). The client IP is the entry that many
+	// from the right; entries left of it come from the client and aren't
+	// trusted.
+	ProxyHops int `json:"proxy_hops,omitempty"`
+}
+
+// tokenBucket holds a client's remaining requests as of updated
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// rateLimiter is a token bucket per client key
+type rateLimiter struct {
+	perSecond float64
+	burst     float64
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+// newRateLimiter returns a limiter allowing perMinute requests a minute in
+// bursts of up to burst, or nil if perMinute is 0 or less
+func newRateLimiter(perMinute, burst int) *rateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = perMinute
+	}
+	return &rateLimiter{
+		perSecond: float64(perMinute) / 60,
+		burst:     float64(burst),
+		buckets:   make(map[string]*tokenBucket),
+	}
+}
+
+// allow takes a request from key's bucket at now. If the bucket is empty
+// it returns false and how long until the next request is allowed.
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastSweep) >= rateLimitSweepInterval {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, updated: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.updated).Seconds()*l.perSecond)
+	b.updated = now
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.perSecond * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep forgets clients whose buckets have refilled, since a new bucket
+// would be the same. The caller must hold l.mu.
+func (l *rateLimiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*l.perSecond >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// authRateLimited reports whether a request counts against
+// RateLimitConfig.AuthRequestsPerMinute: those that guess at credentials
+// or start a login
+func authRateLimited(r *http.Request) bool {
+	return (r.Method == "POST" && (r.URL.Path == "/api/v1/auth/token" || r.URL.Path == "/api/v1/auth/password")) ||
+		strings.HasPrefix(r.URL.Path, "/api/v1/auth/oidc/")
+}
+
+// clientIP returns the IP address a request came from. Behind trusted
+// proxies that is the X-Forwarded-For entry added by the outermost one,
+// ProxyHops entries from the right, since a client can put anything in
+// the entries before it.
+func (s *Server) clientIP(r *http.Request) string {
+	if s.config.RateLimit.TrustProxy {
+		var entries []string
+		for _, value := range r.Header.Values("X-Forwarded-For") {
+			for _, entry := range strings.Split(value, ",") {
+				if entry = strings.TrimSpace(entry); entry != "" {
+					entries = append(entries, entry)
+				}
+			}
+		}
+		if len(entries) > 0 {
+			hops := s.config.RateLimit.ProxyHops
+			if hops <= 0 {
+				hops = 1
+			}
+			// With fewer entries than proxies, every entry was added by
+			// one of them
+			return entries[max(len(entries)-hops, 0)]
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// rateLimitMiddleware rejects requests with 429 and Retry-After once their
+// client has used up its rate (Config.RateLimit). Only valid tokens count as
+// clients of their own, so a client can't dodge its IP's limit by making up
+// tokens. Requests exempt from the concurrency limit are exempt here too.
+func (s *Server) rateLimitMiddleware(next http.Handler) http.Handler {
+	limits := newRateLimiter(s.config.RateLimit.RequestsPerMinute, s.config.RateLimit.Burst)
+	authLimits := newRateLimiter(s.config.RateLimit.AuthRequestsPerMinute, 0)
+	if limits == nil && authLimits == nil {
+		return next
+	}
+	reject := func(w http.ResponseWriter, wait time.Duration) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		writeError(w, http.StatusTooManyRequests, ErrCodeRateLimited, "Too many requests")
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if limitExempt(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		now := s.now()
+		ip := "ip:" + s.clientIP(r)
+		if authLimits != nil && authRateLimited(r) {
+			if ok, wait := authLimits.allow(ip, now); !ok {
+				reject(w, wait)
+				return
+			}
+		}
+		if limits != nil {
+			key := ip
+			if token := r.Header.Get("X-API-Token"); token != "" {
+				if _, err := s.lookupToken(token); err == nil {
+					key = "token:" + hashString(token)
+				}
+			}
+			if ok, wait := limits.allow(key, now); !ok {
+				reject(w, wait)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
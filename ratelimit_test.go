@@ -0,0 +1,136 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterRefills(t *testing.T) {
+	limiter := newRateLimiter(60, 2)
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := limiter.allow("a", now); !ok {
+			t.Fatalf("request %d within burst rejected", i+1)
+		}
+	}
+	ok, wait := limiter.allow("a", now)
+	if ok || wait != time.Second {
+		t.Errorf("allow() after burst = %v, %v; want false, 1s", ok, wait)
+	}
+	if ok, _ := limiter.allow("b", now); !ok {
+		t.Error("another client shares the first client's bucket")
+	}
+	if ok, _ := limiter.allow("a", now.Add(time.Second)); !ok {
+		t.Error("request after refill rejected")
+	}
+
+	limiter.allow("b", now.Add(2*time.Minute))
+	if _, ok := limiter.buckets["a"]; ok {
+		t.Error("idle client not swept")
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	server.now = func() time.Time { return now }
+	server.config.TokenHashes = []string{hashString("secret")}
+	server.config.RateLimit = RateLimitConfig{RequestsPerMinute: 2, AuthRequestsPerMinute: 1}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	handler := server.rateLimitMiddleware(ok)
+
+	do := func(method, path, ip, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = ip + ":1234"
+		if token != "" {
+			req.Header.Set("X-API-Token", token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	do("GET", "/api/v1/tasks", "10.0.0.1", "")
+	do("GET", "/api/v1/tasks", "10.0.0.1", "")
+	w := do("GET", "/api/v1/tasks", "10.0.0.1", "")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "30" {
+		t.Errorf("third request: status %d, Retry-After %q; want 429, 30", w.Code, w.Header().Get("Retry-After"))
+	}
+	if w := do("GET", "/api/v1/tasks", "10.0.0.1", "made-up"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("unknown token: status %d; want the IP's limit to apply", w.Code)
+	}
+	if w := do("GET", "/api/v1/tasks", "10.0.0.1", "secret"); w.Code != http.StatusOK {
+		t.Errorf("valid token: status %d; want its own limit", w.Code)
+	}
+	if w := do("GET", "/health", "10.0.0.1", ""); w.Code != http.StatusOK {
+		t.Errorf("health check: status %d; want exempt", w.Code)
+	}
+
+	if w := do("POST", "/api/v1/auth/token", "10.0.0.2", ""); w.Code != http.StatusOK {
+		t.Fatalf("first token request: status %d; want 200", w.Code)
+	}
+	if w := do("POST", "/api/v1/auth/token", "10.0.0.2", ""); w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "60" {
+		t.Errorf("second token request: status %d, Retry-After %q; want 429, 60", w.Code, w.Header().Get("Retry-After"))
+	}
+}
+
+func TestClientIPBehindProxies(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	tests := []struct {
+		name      string
+		hops      int
+		forwarded []string
+		want      string
+	}{
+		{"no header", 1, nil, "10.0.0.9"},
+		{"one proxy", 1, []string{"203.0.113.7"}, "203.0.113.7"},
+		{"spoofed entry", 1, []string{"198.51.100.1, 203.0.113.7"}, "203.0.113.7"},
+		{"two proxies", 2, []string{"198.51.100.1, 203.0.113.7, 10.0.0.2"}, "203.0.113.7"},
+		{"split header", 2, []string{"198.51.100.1", "203.0.113.7, 10.0.0.2"}, "203.0.113.7"},
+		{"fewer entries than proxies", 3, []string{"203.0.113.7, 10.0.0.2"}, "203.0.113.7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server.config.RateLimit = RateLimitConfig{TrustProxy: true, ProxyHops: tt.hops}
+			req := httptest.NewRequest("GET", "/api/v1/tasks", nil)
+			req.RemoteAddr = "10.0.0.9:1234"
+			for _, value := range tt.forwarded {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			if got := server.clientIP(req); got != tt.want {
+				t.Errorf("clientIP = %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimitIgnoresSpoofedForwardedFor(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.now = func() time.Time { return time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC) }
+	server.config.RateLimit = RateLimitConfig{AuthRequestsPerMinute: 1, TrustProxy: true}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	handler := server.rateLimitMiddleware(ok)
+
+	// The proxy appends the address it saw; the client makes up the rest
+	login := func(spoofed string) int {
+		req := httptest.NewRequest("POST", "/api/v1/auth/token", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-Forwarded-For", spoofed+", 203.0.113.7")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := login("198.51.100.1"); code != http.StatusOK {
+		t.Fatalf("first login: status %d; want 200", code)
+	}
+	if code := login("198.51.100.2"); code != http.StatusTooManyRequests {
+		t.Errorf("login with a new spoofed entry: status %d; want 429 from the same bucket", code)
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// recurrenceRule is a parsed Task.Recurrence: every interval units of
+// freq, optionally ending on until (inclusive, YYYY-MM-DD)
+type recurrenceRule struct {
+	freq     string
+	interval int
+	until    string
+}
+
+// recurrenceShorthands are the accepted non-RRULE recurrence values
+var recurrenceShorthands = map[string]string{
+	"daily":   "DAILY",
+	"weekly":  "WEEKLY",
+	"monthly": "MONTHLY",
+	"yearly":  "YEARLY",
+}
+
+// parseRecurrence accepts "daily", "weekly", "monthly", "yearly" or an
+// iCalendar RRULE limited to FREQ (one of those), INTERVAL and UNTIL, e.g.
+// "FREQ=WEEKLY;INTERVAL=2" or "RRULE:FREQ=MONTHLY;UNTIL=20251231"
+func parseRecurrence(value string) (recurrenceRule, error) {
+	if freq, ok := recurrenceShorthands[strings.ToLower(value)]; ok {
+		return recurrenceRule{freq: freq, interval: 1}, nil
+	}
+
+	rule := recurrenceRule{interval: 1}
+	for _, part := range strings.Split(strings.TrimPrefix(value, "RRULE:"), ";") {
+		name, v, ok := strings.Cut(part, "=")
+		if !ok {
+			return rule, fmt.Errorf("invalid RRULE part %q", part)
+		}
+		switch strings.ToUpper(name) {
+		case "FREQ":
+			rule.freq = strings.ToUpper(v)
+			if _, ok := recurrenceShorthands[strings.ToLower(v)]; !ok {
+				return rule, fmt.Errorf("unsupported FREQ %q", v)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				return rule, fmt.Errorf("invalid INTERVAL %q", v)
+			}
+			rule.interval = n
+		case "UNTIL":
+			// Only the date matters; a time part such as T235959Z is dropped
+			until, err := time.Parse("20060102", v[:min(len(v), 8)])
+			if err != nil {
+				return rule, fmt.Errorf("invalid UNTIL %q", v)
+			}
+			rule.until = until.Format(dueDateLayout)
+		default:
+			return rule, fmt.Errorf("unsupported RRULE part %q", name)
+		}
+	}
+	if rule.freq == "" {
+		return rule, fmt.Errorf("RRULE needs FREQ")
+	}
+	return rule, nil
+}
+
+// validateRecurrence returns a *validationError for an unparseable
+// recurrence; empty means the task doesn't recur
+func validateRecurrence(value string) error {
+	if value == "" {
+		return nil
+	}
+	if _, err := parseRecurrence(value); err != nil {
+		return &validationError{code: ErrCodeInvalidRecurrence, message: "Invalid recurrence: " + err.Error()}
+	}
+	return nil
+}
+
+// step returns the occurrence after date, at the same time of day.
+// Monthly and yearly steps keep the day of month, clamped to the end of
+// shorter months.
+func (r recurrenceRule) step(date time.Time) time.Time {
+	switch r.freq {
+	case "DAILY":
+		return date.AddDate(0, 0, r.interval)
+	case "WEEKLY":
+		return date.AddDate(0, 0, 7*r.interval)
+	}
+	months := r.interval
+	if r.freq == "YEARLY" {
+		months *= 12
+	}
+	first := time.Date(date.Year(), date.Month(), 1, date.Hour(), date.Minute(), date.Second(), date.Nanosecond(), date.Location()).AddDate(0, months, 0)
+	lastDay := first.AddDate(0, 1, -1).Day()
+	return first.AddDate(0, 0, min(date.Day(), lastDay)-1)
+}
+
+// nextDueDate returns the due date of the occurrence after a task
+// completed at completedAt: one step after its due date (or the end of its
+// completion day if it had none), skipping days that were already over at
+// completion. Steps keep the time of day in completedAt's location. ok is
+// false once the rule's UNTIL is passed.
+func (r recurrenceRule) nextDueDate(dueDate DueTime, completedAt time.Time) (next DueTime, ok bool) {
+	loc := completedAt.Location()
+	completedDay := dueAtEndOfDay(completedAt, loc).Time
+	date := completedDay
+	if !dueDate.IsZero() {
+		date = dueDate.In(loc)
+	}
+	date = r.step(date)
+	for !date.After(completedDay) {
+		date = r.step(date)
+	}
+	if r.until != "" && date.Format(dueDateLayout) > r.until {
+		return DueTime{}, false
+	}
+	return DueTime{date}, true
+}
+
+// MaterializeRecurrences creates the next occurrence of every completed
+// recurring task and returns how many were created. The new task copies
+// the completed one with a new due date and unfinished subtasks; the
+// completed task's recurrence moves to it, so each completion produces at
+// most one successor and a series ends when UNTIL is passed. Completion
+// days are taken in loc.
+func (ts *TaskStore) MaterializeRecurrences(ctx context.Context, loc *time.Location) (int, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	var due []*Task
+	for _, task := range ts.tasks {
+		if task.Status == "completed" && task.Recurrence != "" && task.CompletedAt != nil {
+			due = append(due, task)
+		}
+	}
+	if len(due) == 0 {
+		return 0, nil
+	}
+	// Visit in ID order so successors get predictable IDs
+	sortByID(due)
+
+	// Successors are allocated IDs for every due task, since some may not
+	// recur again
+	prevNextID := ts.nextID
+	if err := ts.reserveIDsLocked(ctx, TaskIDs, len(due), &ts.nextID); err != nil {
+		return 0, err
+	}
+	prev := make(map[int]Task, len(due))
+	var created []*Task
+	for _, task := range due {
+		id := task.ID
+		prev[id] = *task
+		rule, err := parseRecurrence(task.Recurrence)
+		if err != nil {
+			// Stored before validation existed or edited by hand; stop the
+			// series rather than retry it forever
+			slog.Warn("Task has invalid recurrence", "task_id", id, "recurrence", task.Recurrence, "error", err)
+			task.Recurrence = ""
+			continue
+		}
+		dueDate, ok := rule.nextDueDate(task.DueDate, task.CompletedAt.In(loc))
+		if ok {
+			created = append(created, ts.nextOccurrenceLocked(task, dueDate))
+		}
+		task.Recurrence = ""
+	}
+
+	ids := make([]int, 0, len(prev)+len(created))
+	for id := range prev {
+		ids = append(ids, id)
+	}
+	for _, task := range created {
+		ids = append(ids, task.ID)
+	}
+	if err := ts.save(ctx, ids...); err != nil {
+		for id, task := range prev {
+			*ts.tasks[id] = task
+		}
+		for _, task := range created {
+			delete(ts.tasks, task.ID)
+		}
+		ts.nextID = prevNextID
+		return 0, fmt.Errorf("save tasks: %w", err)
+	}
+	for id, before := range prev {
+		ts.recordChange(ctx, ChangeUpdated, ts.tasks[id])
+		ts.recordMutation(ctx, AuditUpdate, auditTask, id, &before, ts.tasks[id])
+	}
+	for _, task := range created {
+		ts.recordChange(ctx, ChangeCreated, task)
+		ts.recordMutation(ctx, AuditCreate, auditTask, task.ID, nil, task)
+	}
+	return len(created), nil
+}
+
+// nextOccurrenceLocked adds the pending successor of a completed
+// recurring task. The caller must hold the write lock and save.
+func (ts *TaskStore) nextOccurrenceLocked(task *Task, dueDate DueTime) *Task {
+	now := ts.now()
+	subtasks := make([]Subtask, len(task.Subtasks))
+	for i, sub := range task.Subtasks {
+		subtasks[i] = Subtask{ID: sub.ID, Title: sub.Title}
+	}
+	if len(subtasks) == 0 {
+		subtasks = nil
+	}
+	next := &Task{
+		ID:              ts.nextID,
+		Title:           task.Title,
+		Description:     task.Description,
+		DueDate:         dueDate,
+		Priority:        task.Priority,
+		Status:          "pending",
+		CreatedAt:       now,
+		UpdatedAt:       now,
+		Subtasks:        subtasks,
+		Tags:            task.Tags,
+		ProjectID:       task.ProjectID,
+		Assignee:        task.Assignee,
+		Recurrence:      task.Recurrence,
+		ReminderOffsets: task.ReminderOffsets,
+	}
+	ts.tasks[next.ID] = next
+	ts.nextID++
+	return next
+}
+
+// materializeRecurrences runs MaterializeRecurrences, logging the outcome
+func (s *Server) materializeRecurrences(ctx context.Context) {
+	count, err := s.store.MaterializeRecurrences(ctx, s.location)
+	if err != nil {
+		slog.Error("Creating recurring tasks failed", "error", err)
+		return
+	}
+	if count > 0 {
+		slog.Info("Created recurring task occurrences", "count", count)
+	}
+}
+
+// runRecurrenceScheduler creates next occurrences as soon as recurring
+// tasks are completed, waking on every store change until ctx is
+// cancelled
+func (s *Server) runRecurrenceScheduler(ctx context.Context) {
+	for {
+		// Read the revision first so a completion during the pass is
+		// picked up by the next one
+		revision := s.store.Revision()
+		s.materializeRecurrences(ctx)
+		s.store.WaitForChanges(ctx, revision)
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseRecurrence(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    recurrenceRule
+		wantErr bool
+	}{
+		{"daily", recurrenceRule{freq: "DAILY", interval: 1}, false},
+		{"Weekly", recurrenceRule{freq: "WEEKLY", interval: 1}, false},
+		{"FREQ=MONTHLY;INTERVAL=3", recurrenceRule{freq: "MONTHLY", interval: 3}, false},
+		{"RRULE:FREQ=DAILY;UNTIL=20240131T235959Z", recurrenceRule{freq: "DAILY", interval: 1, until: "2024-01-31"}, false},
+		{"FREQ=HOURLY", recurrenceRule{}, true},
+		{"FREQ=WEEKLY;BYDAY=MO", recurrenceRule{}, true},
+		{"INTERVAL=2", recurrenceRule{}, true},
+		{"FREQ=DAILY;INTERVAL=0", recurrenceRule{}, true},
+		{"sometimes", recurrenceRule{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseRecurrence(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseRecurrence(%q) error = %v; wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("parseRecurrence(%q) = %+v; want %+v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestNextDueDate(t *testing.T) {
+	completed := time.Date(2024, 1, 10, 15, 0, 0, 0, time.UTC)
+	day := func(value string) DueTime {
+		due, _ := parseDueDate(value, time.UTC)
+		return due
+	}
+	tests := []struct {
+		name   string
+		rule   string
+		due    string
+		want   string
+		wantOK bool
+	}{
+		{"daily from due date", "daily", "2024-01-10", "2024-01-11T23:59:59Z", true},
+		{"weekly on time", "weekly", "2024-01-12", "2024-01-19T23:59:59Z", true},
+		{"late daily skips past dates", "daily", "2024-01-05", "2024-01-11T23:59:59Z", true},
+		{"no due date uses completion day", "FREQ=DAILY;INTERVAL=2", "", "2024-01-12T23:59:59Z", true},
+		{"keeps the time of day", "daily", "2024-01-10T09:30:00Z", "2024-01-11T09:30:00Z", true},
+		{"month end clamps", "monthly", "2024-01-31", "2024-02-29T23:59:59Z", true},
+		{"yearly leap day", "yearly", "2024-02-29", "2025-02-28T23:59:59Z", true},
+		{"until reached", "FREQ=DAILY;UNTIL=20240110", "2024-01-10", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := parseRecurrence(tt.rule)
+			if err != nil {
+				t.Fatalf("parseRecurrence: %v", err)
+			}
+			got, ok := rule.nextDueDate(day(tt.due), completed)
+			if got.String() != tt.want || ok != tt.wantOK {
+				t.Errorf("nextDueDate = %q, %v; want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestMaterializeRecurrences(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	ctx := context.Background()
+	task, _ := server.store.AddTask(ctx, Task{
+		Title:      "Water plants",
+		DueDate:    dueOn("2024-01-10"),
+		Priority:   "low",
+		Tags:       []string{"home"},
+		Recurrence: "weekly",
+	})
+	server.store.AddSubtask(ctx, task.ID, "Balcony")
+	server.store.UpdateSubtask(ctx, task.ID, 1, "Balcony", true)
+	server.store.Update(ctx, task.ID, task.Title, "", task.DueDate, task.Priority, "completed")
+
+	count, err := server.store.MaterializeRecurrences(ctx, time.UTC)
+	if err != nil || count != 1 {
+		t.Fatalf("MaterializeRecurrences = %d, %v; want 1", count, err)
+	}
+	next, exists := server.store.Get(2)
+	if !exists {
+		t.Fatal("next occurrence was not created")
+	}
+	if next.Status != "pending" || next.Recurrence != "weekly" || next.Tags[0] != "home" {
+		t.Errorf("next = %+v; want a pending weekly copy", next)
+	}
+	if len(next.Subtasks) != 1 || next.Subtasks[0].Done {
+		t.Errorf("subtasks = %+v; want one unfinished", next.Subtasks)
+	}
+	if old, _ := server.store.Get(task.ID); old.Recurrence != "" {
+		t.Errorf("completed task still recurs: %q", old.Recurrence)
+	}
+
+	// A second pass finds nothing left to do
+	if count, _ := server.store.MaterializeRecurrences(ctx, time.UTC); count != 0 {
+		t.Errorf("second pass created %d; want 0", count)
+	}
+}
+
+func TestRecurrenceScheduler(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		server.runRecurrenceScheduler(ctx)
+		close(done)
+	}()
+
+	task, _ := server.store.AddTask(ctx, Task{Title: "Standup", Priority: "medium", Recurrence: "daily"})
+	server.store.Update(ctx, task.ID, task.Title, "", DueTime{}, task.Priority, "completed")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, exists := server.store.Get(2); exists {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("scheduler did not create the next occurrence")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("scheduler did not stop after cancel")
+	}
+}
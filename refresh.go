@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// storageRefreshInterval is how often a store on shared storage looks for
+// writes by other instances between requests, so that event streams and
+// long polls hear of them
+const storageRefreshInterval = time.Second
+
+// Refresh brings the store up to date with writes other instances made to
+// shared storage since it last looked. It is a no-op on storage that isn't
+// shared, and takes the write lock only when something changed.
+func (ts *TaskStore) Refresh(ctx context.Context) error {
+	shared, ok := ts.storage.(SharedStorage)
+	if !ok {
+		return nil
+	}
+	revision, err := shared.Revision(ctx)
+	if err != nil {
+		return fmt.Errorf("read storage revision: %w", err)
+	}
+	ts.mu.RLock()
+	current := ts.storageRevision
+	ts.mu.RUnlock()
+	if revision <= current {
+		return nil
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if revision <= ts.storageRevision {
+		return nil
+	}
+	return ts.refreshLocked(ctx)
+}
+
+// refreshLocked is Refresh without the revision check. The caller must
+// hold the write lock.
+func (ts *TaskStore) refreshLocked(ctx context.Context) error {
+	shared, ok := ts.storage.(SharedStorage)
+	if !ok || ts.closed {
+		return nil
+	}
+	changes, err := shared.ChangesSince(ctx, ts.storageRevision)
+	if err != nil {
+		return fmt.Errorf("read storage changes: %w", err)
+	}
+	ts.applyStorageChangesLocked(ctx, changes)
+	return nil
+}
+
+// applyStorageChangesLocked puts the tasks, projects, history and comments
+// another instance wrote in place of the store's own, recording changes to
+// live tasks for pollers and the search index. Tasks the store already has
+// at the stored version, such as those it wrote itself, are left alone.
+// The caller must hold the write lock.
+func (ts *TaskStore) applyStorageChangesLocked(ctx context.Context, changes *StorageChanges) {
+	ids := make([]int, 0, len(changes.Tasks))
+	for id := range changes.Tasks {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	persisted := ts.persistedLocked()
+	for _, id := range ids {
+		task := changes.Tasks[id]
+		old, had := persisted.Get(id)
+		if task == nil && !had {
+			continue
+		}
+		if task != nil && had && old.Version == task.Version {
+			continue
+		}
+		_, wasLive := ts.tasks[id]
+		delete(ts.tasks, id)
+		delete(ts.trash, id)
+		delete(ts.archive, id)
+		if task == nil {
+			delete(ts.stored, id)
+			if wasLive {
+				ts.recordChange(ctx, ChangeDeleted, old)
+			}
+			continue
+		}
+
+		task.DueDate = task.DueDate.resolveSavedDay(ts.dueLocation)
+		ts.partitionFor(task)[id] = task
+		ts.stored[id] = true
+		if id >= ts.nextID {
+			ts.nextID = id + 1
+		}
+		switch {
+		case taskState(task) == TaskLive && wasLive:
+			ts.recordChange(ctx, ChangeUpdated, task)
+		case taskState(task) == TaskLive:
+			ts.recordChange(ctx, ChangeCreated, task)
+		case wasLive:
+			ts.recordChange(ctx, ChangeDeleted, task)
+		}
+	}
+
+	for id, project := range changes.Projects {
+		if project == nil {
+			delete(ts.projects, id)
+			continue
+		}
+		ts.projects[id] = project
+		if id >= ts.nextProjectID {
+			ts.nextProjectID = id + 1
+		}
+	}
+	for id, revisions := range changes.History {
+		if len(revisions) == 0 {
+			delete(ts.history, id)
+			continue
+		}
+		for _, rev := range revisions {
+			rev.Task.DueDate = rev.Task.DueDate.resolveSavedDay(ts.dueLocation)
+		}
+		ts.history[id] = revisions
+	}
+	for id, comments := range changes.Comments {
+		if len(comments) == 0 {
+			delete(ts.comments, id)
+			continue
+		}
+		ts.comments[id] = comments
+		for _, comment := range comments {
+			if comment.ID >= ts.nextCommentID {
+				ts.nextCommentID = comment.ID + 1
+			}
+		}
+	}
+	ts.storageRevision = changes.Revision
+}
+
+// reserveIDsLocked points *next at n IDs of kind handed out by the
+// storage, when it allocates them, so that another instance can't give the
+// same IDs to its own additions. Elsewhere *next is left alone. The caller
+// must hold the write lock.
+func (ts *TaskStore) reserveIDsLocked(ctx context.Context, kind IDKind, n int, next *int) error {
+	allocator, ok := ts.storage.(IDAllocator)
+	if !ok || n <= 0 {
+		return nil
+	}
+	first, err := allocator.AllocateIDs(ctx, kind, n)
+	if err != nil {
+		return fmt.Errorf("allocate %s IDs: %w", kind, err)
+	}
+	*next = first
+	return nil
+}
+
+// storageRefreshMiddleware refreshes the store from shared storage before
+// each API request, so that every instance answers with what the database
+// holds. Requests are refused with 503 while the database can't be read.
+// Health probes, debug endpoints and streams, which runStorageRefresher
+// keeps current, skip it.
+func (s *Server) storageRefreshMiddleware(next http.Handler) http.Handler {
+	if _, ok := s.store.storage.(SharedStorage); !ok {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/api/") || limitExempt(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if err := s.store.Refresh(r.Context()); err != nil {
+			requestLogger(r.Context()).Error("Failed to refresh tasks from storage", "error", err)
+			writeError(w, http.StatusServiceUnavailable, ErrCodeInternal, "Storage unavailable")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// runStorageRefresher refreshes the store from shared storage on every
+// tick of interval until ctx is cancelled. It does nothing on storage that
+// isn't shared.
+func (s *Server) runStorageRefresher(ctx context.Context, interval time.Duration) {
+	if _, ok := s.store.storage.(SharedStorage); !ok {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.store.Refresh(ctx); err != nil {
+				slog.Warn("Storage refresh failed", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// sharedBackend is a memoryBackend that several stores use as if they ran
+// in different instances, like the Postgres backend: it hands out IDs and
+// reports the tasks and projects written after a revision
+type sharedBackend struct {
+	*memoryBackend
+	projects map[int]Project
+	revision int64
+	// changed holds the revision each task ("tasks" key) or project was
+	// last written in
+	changed map[string]map[int]int64
+	nextIDs map[IDKind]int
+	// unreadable makes Revision fail
+	unreadable bool
+}
+
+func newSharedBackend() *sharedBackend {
+	return &sharedBackend{
+		memoryBackend: &memoryBackend{rows: map[int]Task{}},
+		projects:      map[int]Project{},
+		changed:       map[string]map[int]int64{"tasks": {}, "projects": {}},
+		nextIDs:       map[IDKind]int{},
+	}
+}
+
+func (b *sharedBackend) touch(kind string, id int) {
+	b.revision++
+	b.changed[kind][id] = b.revision
+}
+
+func (b *sharedBackend) Add(ctx context.Context, task *Task) error {
+	if err := b.memoryBackend.Add(ctx, task); err != nil {
+		return err
+	}
+	b.touch("tasks", task.ID)
+	return nil
+}
+
+func (b *sharedBackend) Update(ctx context.Context, task *Task) error {
+	if err := b.memoryBackend.Update(ctx, task); err != nil {
+		return err
+	}
+	b.touch("tasks", task.ID)
+	return nil
+}
+
+func (b *sharedBackend) Delete(ctx context.Context, id int) error {
+	if err := b.memoryBackend.Delete(ctx, id); err != nil {
+		return err
+	}
+	b.touch("tasks", id)
+	return nil
+}
+
+func (b *sharedBackend) LoadProjects() ([]*Project, error) {
+	projects := make([]*Project, 0, len(b.projects))
+	for _, project := range b.projects {
+		project := project
+		projects = append(projects, &project)
+	}
+	return projects, nil
+}
+
+func (b *sharedBackend) SaveProjects(projects map[int]*Project, changed []int) error {
+	for _, id := range changed {
+		if project, exists := projects[id]; exists {
+			b.projects[id] = *project
+		} else {
+			delete(b.projects, id)
+		}
+		b.touch("projects", id)
+	}
+	return nil
+}
+
+func (b *sharedBackend) AllocateIDs(ctx context.Context, kind IDKind, n int) (int, error) {
+	if b.nextIDs[kind] == 0 {
+		b.nextIDs[kind] = 1
+	}
+	first := b.nextIDs[kind]
+	b.nextIDs[kind] += n
+	return first, nil
+}
+
+func (b *sharedBackend) Revision(ctx context.Context) (int64, error) {
+	if b.unreadable {
+		return 0, errors.New("database unavailable")
+	}
+	return b.revision, nil
+}
+
+func (b *sharedBackend) ChangesSince(ctx context.Context, revision int64) (*StorageChanges, error) {
+	changes := &StorageChanges{Revision: b.revision, Tasks: map[int]*Task{}, Projects: map[int]*Project{}}
+	for id, rev := range b.changed["tasks"] {
+		if rev <= revision {
+			continue
+		}
+		changes.Tasks[id] = nil
+		if row, exists := b.rows[id]; exists {
+			changes.Tasks[id] = &row
+		}
+	}
+	for id, rev := range b.changed["projects"] {
+		if rev <= revision {
+			continue
+		}
+		changes.Projects[id] = nil
+		if project, exists := b.projects[id]; exists {
+			changes.Projects[id] = &project
+		}
+	}
+	return changes, nil
+}
+
+func TestRefreshReadsOtherInstancesWrites(t *testing.T) {
+	backend := newSharedBackend()
+	first, _ := NewTaskStoreWithStorage(backend)
+	second, _ := NewTaskStoreWithStorage(backend)
+	ctx := context.Background()
+
+	project, err := first.AddProject(ctx, "Home", "")
+	if err != nil {
+		t.Fatalf("AddProject() error = %v", err)
+	}
+	task, err := first.AddTask(ctx, Task{Title: "Shared", Priority: "medium", ProjectID: project.ID})
+	if err != nil {
+		t.Fatalf("AddTask() error = %v", err)
+	}
+	if _, ok := second.Get(task.ID); ok {
+		t.Fatal("second store has the task before refreshing")
+	}
+	since := second.Revision()
+	if err := second.Refresh(ctx); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if got, ok := second.Get(task.ID); !ok || got.Title != "Shared" {
+		t.Fatalf("Get() after Refresh = %+v, %v; want the task", got, ok)
+	}
+	if _, ok := second.GetProject(project.ID); !ok {
+		t.Error("project missing after Refresh")
+	}
+	if found := second.Search("shared"); len(found) != 1 {
+		t.Errorf("Search() = %d tasks; want the refreshed task indexed", len(found))
+	}
+	changes, _, _ := second.ChangesSince(since)
+	if len(changes) != 1 || changes[0].Type != ChangeCreated {
+		t.Errorf("changes = %+v; want one created", changes)
+	}
+
+	// The second store now updates it, and the first catches up
+	if _, _, err := second.Patch(ctx, task.ID, map[string]string{"title": "Renamed"}); err != nil {
+		t.Fatalf("Patch() error = %v", err)
+	}
+	if err := first.Refresh(ctx); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if got, _ := first.Get(task.ID); got.Title != "Renamed" {
+		t.Errorf("title after Refresh = %q; want Renamed", got.Title)
+	}
+
+	if _, err := first.Delete(ctx, task.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if err := second.Refresh(ctx); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if _, ok := second.Get(task.ID); ok {
+		t.Error("deleted task still live after Refresh")
+	}
+	if trash := second.Trash(); len(trash) != 1 || trash[0].ID != task.ID {
+		t.Errorf("trash after Refresh = %+v; want the deleted task", trash)
+	}
+}
+
+func TestSharedStorageAllocatesIDs(t *testing.T) {
+	backend := newSharedBackend()
+	first, _ := NewTaskStoreWithStorage(backend)
+	second, _ := NewTaskStoreWithStorage(backend)
+	ctx := context.Background()
+
+	a, err := first.Add(ctx, "From first", "", DueTime{}, "medium")
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	// Without refreshing, the second store's own counter would also say 1
+	b, err := second.Add(ctx, "From second", "", DueTime{}, "medium")
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if a.ID == b.ID {
+		t.Fatalf("both stores added task %d", a.ID)
+	}
+	p, _ := first.AddProject(ctx, "First", "")
+	q, _ := second.AddProject(ctx, "Second", "")
+	if p.ID == q.ID {
+		t.Errorf("both stores added project %d", p.ID)
+	}
+	if len(backend.rows) != 2 || len(backend.projects) != 2 {
+		t.Errorf("stored %d tasks and %d projects; want 2 of each", len(backend.rows), len(backend.projects))
+	}
+}
+
+func TestStorageRefreshMiddleware(t *testing.T) {
+	backend := newSharedBackend()
+	store, _ := NewTaskStoreWithStorage(backend)
+	other, _ := NewTaskStoreWithStorage(backend)
+	server := NewServerWithStore(&Config{}, store)
+	router, err := server.Router()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Add(context.Background(), "Written elsewhere", "", DueTime{}, "medium"); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/tasks", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Written elsewhere") {
+		t.Errorf("GET /tasks = %d %s; want the other instance's task", w.Code, w.Body)
+	}
+
+	backend.unreadable = true
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/tasks", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("GET /tasks with the database down = %d; want 503", w.Code)
+	}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("GET /health with the database down = %d; want 200", w.Code)
+	}
+}
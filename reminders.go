@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/smtp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// reminderScanInterval is how often tasks are checked for due reminders
+	reminderScanInterval = time.Minute
+	// defaultReminderWindowMinutes is how long before a task is due it is
+	// reminded about when it has no reminder_offsets of its own
+	defaultReminderWindowMinutes = 24 * 60
+	// maxReminderOffsetMinutes bounds reminder_offsets to 30 days
+	maxReminderOffsetMinutes = 30 * 24 * 60
+	// notifierTimeout bounds a single webhook or email delivery
+	notifierTimeout = 10 * time.Second
+)
+
+// ReminderConfig controls due-date reminders
+type ReminderConfig struct {
+	// Channels lists where reminders and the digest go: "log", "webhook"
+	// and/or "email". Reminders are off when it is empty.
+	Channels []string `json:"channels,omitempty"`
+	// WindowMinutes is how long before its due date a task without
+	// reminder_offsets is reminded about (default: 1440, one day)
+	WindowMinutes int         `json:"window_minutes,omitempty"`
+	WebhookURL    string      `json:"webhook_url,omitempty"`
+	Email         EmailConfig `json:"email"`
+}
+
+// EmailConfig is the SMTP server reminders are mailed through
+type EmailConfig struct {
+	// SMTPAddr is host:port, e.g. "smtp.example.com:587"
+	SMTPAddr string   `json:"smtp_addr,omitempty"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	From     string   `json:"from,omitempty"`
+	To       []string `json:"to,omitempty"`
+}
+
+// Reminder is a notification that a task is coming due
+type Reminder struct {
+	Task Task `json:"task"`
+	// DueAt is when the task is due
+	DueAt time.Time `json:"due_at"`
+	// OffsetMinutes is how long before DueAt the reminder was scheduled
+	OffsetMinutes int `json:"offset_minutes"`
+}
+
+// Notifier delivers reminders over one channel
+type Notifier interface {
+	Notify(ctx context.Context, reminder Reminder) error
+}
+
+// NotifierOpener builds a notifier from the reminder config, failing if
+// the config is incomplete for that channel
+type NotifierOpener func(config *ReminderConfig) (Notifier, error)
+
+// notifierOpeners holds the channels selectable in reminders.channels
+var notifierOpeners = make(map[string]NotifierOpener)
+
+// RegisterNotifier makes a reminder channel selectable by name. Like
+// RegisterBackend it is meant for init functions and panics on a
+// duplicate name.
+func RegisterNotifier(name string, open NotifierOpener) {
+	if _, dup := notifierOpeners[name]; dup {
+		panic("reminders: notifier " + name + " registered twice")
+	}
+	notifierOpeners[name] = open
+}
+
+func init() {
+	RegisterNotifier("log", func(*ReminderConfig) (Notifier, error) {
+		return logNotifier{}, nil
+	})
+	RegisterNotifier("webhook", func(config *ReminderConfig) (Notifier, error) {
+		if config.WebhookURL == "" {
+			return nil, fmt.Errorf("webhook channel needs reminders.webhook_url")
+		}
+		return &webhookNotifier{url: config.WebhookURL, client: &http.Client{Timeout: notifierTimeout}}, nil
+	})
+	RegisterNotifier("email", func(config *ReminderConfig) (Notifier, error) {
+		email := config.Email
+		if email.SMTPAddr == "" || email.From == "" || len(email.To) == 0 {
+			return nil, fmt.Errorf("email channel needs reminders.email smtp_addr, from and to")
+		}
+		return &emailNotifier{config: email}, nil
+	})
+}
+
+// openNotifiers builds the configured channels
+func openNotifiers(config *ReminderConfig) (map[string]Notifier, error) {
+	notifiers := make(map[string]Notifier, len(config.Channels))
+	for _, name := range config.Channels {
+		open, ok := notifierOpeners[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown reminder channel %q", name)
+		}
+		notifier, err := open(config)
+		if err != nil {
+			return nil, err
+		}
+		notifiers[name] = notifier
+	}
+	return notifiers, nil
+}
+
+// openChannels builds the configured reminder channels, plus the "smtp"
+// channel emailing users when SMTP is set up
+func (s *Server) openChannels() (map[string]Notifier, error) {
+	notifiers, err := openNotifiers(&s.config.Reminders)
+	if err != nil {
+		return nil, err
+	}
+	if s.emailTemplates != nil {
+		notifiers["smtp"] = smtpNotifier{server: s}
+	}
+	return notifiers, nil
+}
+
+// logNotifier writes reminders and digests to the server log
+type logNotifier struct{}
+
+func (logNotifier) Notify(_ context.Context, reminder Reminder) error {
+	slog.Info("Reminder", "task_id", reminder.Task.ID, "title", reminder.Task.Title, "due_date", reminder.Task.DueDate)
+	return nil
+}
+
+func (logNotifier) NotifyDigest(_ context.Context, digest Digest) error {
+	slog.Info("Digest", "date", digest.Date, "overdue", taskIDs(digest.Overdue), "due_today", taskIDs(digest.DueToday), "completed", taskIDs(digest.Completed))
+	return nil
+}
+
+// taskIDs returns the IDs of tasks
+func taskIDs(tasks []*Task) []int {
+	ids := make([]int, len(tasks))
+	for i, task := range tasks {
+		ids[i] = task.ID
+	}
+	return ids
+}
+
+// webhookNotifier POSTs each reminder and digest as JSON
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func (n *webhookNotifier) Notify(ctx context.Context, reminder Reminder) error {
+	return n.post(ctx, struct {
+		Event string `json:"event"`
+		Reminder
+	}{"task.reminder", reminder})
+}
+
+func (n *webhookNotifier) NotifyDigest(ctx context.Context, digest Digest) error {
+	return n.post(ctx, struct {
+		Event string `json:"event"`
+		Digest
+	}{"digest", digest})
+}
+
+// post sends payload as JSON, failing on a non-2xx response
+func (n *webhookNotifier) post(ctx context.Context, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", n.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// emailNotifier mails each reminder through SMTP
+type emailNotifier struct {
+	config EmailConfig
+}
+
+func (n *emailNotifier) Notify(_ context.Context, reminder Reminder) error {
+	return n.send("Reminder: "+reminder.Task.Title, fmt.Sprintf("%q is due %s.\r\n", reminder.Task.Title, reminder.Task.DueDate))
+}
+
+func (n *emailNotifier) NotifyDigest(_ context.Context, digest Digest) error {
+	var body strings.Builder
+	for _, section := range []struct {
+		heading string
+		tasks   []*Task
+	}{{"Overdue", digest.Overdue}, {"Due today", digest.DueToday}, {"Completed in the last day", digest.Completed}} {
+		if len(section.tasks) == 0 {
+			continue
+		}
+		fmt.Fprintf(&body, "%s:\r\n", section.heading)
+		for _, task := range section.tasks {
+			fmt.Fprintf(&body, "- %s\r\n", task.Title)
+		}
+		body.WriteString("\r\n")
+	}
+	return n.send("TaskMate digest for "+digest.Date, body.String())
+}
+
+// send mails a plain text message to the configured addresses
+func (n *emailNotifier) send(subject, body string) error {
+	var auth smtp.Auth
+	if n.config.Username != "" {
+		host, _, _ := strings.Cut(n.config.SMTPAddr, ":")
+		auth = smtp.PlainAuth("", n.config.Username, n.config.Password, host)
+	}
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\n\r\n%s",
+		n.config.From, strings.Join(n.config.To, ", "), subject, body)
+	return smtp.SendMail(n.config.SMTPAddr, auth, n.config.From, n.config.To, []byte(msg))
+}
+
+// normalizeReminderOffsets validates minutes-before-due offsets and
+// returns them de-duplicated, largest first. Errors are *validationError.
+func normalizeReminderOffsets(offsets []int) ([]int, error) {
+	seen := make(map[int]bool, len(offsets))
+	var normalized []int
+	for _, offset := range offsets {
+		if offset < 1 || offset > maxReminderOffsetMinutes {
+			return nil, &validationError{
+				code:    ErrCodeValidation,
+				message: fmt.Sprintf("Reminder offsets must be between 1 and %d minutes", maxReminderOffsetMinutes),
+			}
+		}
+		if !seen[offset] {
+			seen[offset] = true
+			normalized = append(normalized, offset)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(normalized)))
+	return normalized, nil
+}
+
+// reminderKey identifies a sent reminder. It includes the due date so that
+// moving the due date makes its reminders due again.
+func reminderKey(dueDate DueTime, offset int) string {
+	return dueDate.UTC().Format(time.RFC3339) + "/" + strconv.Itoa(offset)
+}
+
+// legacyReminderKey is how a reminder was recorded before due dates had a
+// time, by the due day in the server's time zone loc
+func legacyReminderKey(dueDate DueTime, offset int, loc *time.Location) string {
+	return dueDate.Day(loc) + "/" + strconv.Itoa(offset)
+}
+
+// reminderSent reports whether task's reminder at offset before its
+// current due date has gone out. Reminders recorded by due day are read in
+// loc.
+func reminderSent(task *Task, offset int, loc *time.Location) bool {
+	return containsString(task.RemindersSent, reminderKey(task.DueDate, offset)) ||
+		containsString(task.RemindersSent, legacyReminderKey(task.DueDate, offset, loc))
+}
+
+// DueReminders returns the reminders that should have been sent by now and
+// haven't been. A task is reminded at each of its offsets (or
+// defaultOffset) before its due date, until the due date passes; completed
+// tasks are skipped.
+func (ts *TaskStore) DueReminders(now time.Time, defaultOffset int) []Reminder {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	var reminders []Reminder
+	for _, task := range ts.tasks {
+		if task.Status == "completed" || task.DueDate.IsZero() || !now.Before(task.DueDate.Time) {
+			continue
+		}
+		dueAt := task.DueDate.Time
+		offsets := task.ReminderOffsets
+		if len(offsets) == 0 {
+			offsets = []int{defaultOffset}
+		}
+		for _, offset := range offsets {
+			if now.Before(dueAt.Add(-time.Duration(offset)*time.Minute)) || reminderSent(task, offset, ts.dueLocation) {
+				continue
+			}
+			reminders = append(reminders, Reminder{Task: *task, DueAt: dueAt, OffsetMinutes: offset})
+		}
+	}
+	sort.Slice(reminders, func(i, j int) bool {
+		if reminders[i].Task.ID != reminders[j].Task.ID {
+			return reminders[i].Task.ID < reminders[j].Task.ID
+		}
+		return reminders[i].OffsetMinutes > reminders[j].OffsetMinutes
+	})
+	return reminders
+}
+
+// MarkReminderSent records that a reminder went out, unless the task has
+// since been deleted or given a different due date. Keys for earlier due
+// dates are dropped.
+func (ts *TaskStore) MarkReminderSent(ctx context.Context, reminder Reminder) error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	task, exists := ts.tasks[reminder.Task.ID]
+	if !exists || !task.DueDate.Equal(reminder.Task.DueDate) {
+		return nil
+	}
+
+	sent := []string{reminderKey(task.DueDate, reminder.OffsetMinutes)}
+	current, _, _ := strings.Cut(sent[0], "/")
+	legacy, _, _ := strings.Cut(legacyReminderKey(task.DueDate, 0, ts.dueLocation), "/")
+	for _, key := range task.RemindersSent {
+		due, _, _ := strings.Cut(key, "/")
+		if (due == current || due == legacy) && key != sent[0] {
+			sent = append(sent, key)
+		}
+	}
+	prev := *task
+	task.RemindersSent = sent
+	if err := ts.save(ctx, task.ID); err != nil {
+		task.RemindersSent = prev.RemindersSent
+		return fmt.Errorf("save tasks: %w", err)
+	}
+	ts.recordChange(ctx, ChangeUpdated, task)
+	// Sent reminders are bookkeeping rather than an edit, so they are
+	// audited but add no revision to the task's history
+	ts.recordAudit(ctx, AuditUpdate, auditTask, task.ID, &prev, task)
+	return nil
+}
+
+// sendReminders dispatches every due reminder to all channels. A reminder
+// counts as sent once any channel delivers it; if all fail it is retried
+// on the next scan.
+func (s *Server) sendReminders(ctx context.Context, notifiers map[string]Notifier) {
+	window := s.config.Reminders.WindowMinutes
+	if window <= 0 {
+		window = defaultReminderWindowMinutes
+	}
+	for _, reminder := range s.store.DueReminders(s.now(), window) {
+		delivered := false
+		for name, notifier := range notifiers {
+			notifyCtx, cancel := context.WithTimeout(ctx, notifierTimeout)
+			err := notifier.Notify(notifyCtx, reminder)
+			cancel()
+			if err != nil {
+				slog.Warn("Reminder delivery failed", "task_id", reminder.Task.ID, "channel", name, "error", err)
+				continue
+			}
+			delivered = true
+		}
+		if !delivered {
+			continue
+		}
+		if err := s.store.MarkReminderSent(ctx, reminder); err != nil {
+			slog.Error("Recording reminder failed", "task_id", reminder.Task.ID, "error", err)
+		}
+	}
+}
+
+// runReminderScheduler sends due reminders once immediately and then on
+// every tick of interval until ctx is cancelled. Besides the configured
+// channels, reminders are emailed to users when SMTP is set up; it does
+// nothing when neither is.
+func (s *Server) runReminderScheduler(ctx context.Context, interval time.Duration) {
+	if len(s.config.Reminders.Channels) == 0 && s.emailTemplates == nil {
+		return
+	}
+	notifiers, err := s.openChannels()
+	if err != nil {
+		slog.Error("Reminders disabled", "error", err)
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	s.sendReminders(ctx, notifiers)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.sendReminders(ctx, notifiers)
+		}
+	}
+}
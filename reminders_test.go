@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingNotifier collects reminders, optionally failing every call
+type recordingNotifier struct {
+	mu        sync.Mutex
+	reminders []Reminder
+	failing   bool
+}
+
+func (n *recordingNotifier) Notify(_ context.Context, reminder Reminder) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.failing {
+		return errors.New("channel down")
+	}
+	n.reminders = append(n.reminders, reminder)
+	return nil
+}
+
+func TestDueReminders(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	ctx := context.Background()
+	server.store.AddTask(ctx, Task{Title: "Tomorrow", DueDate: dueIn("2024-01-11", time.UTC), Priority: "medium"})
+	server.store.AddTask(ctx, Task{Title: "Next week", DueDate: dueIn("2024-01-17", time.UTC), Priority: "medium"})
+	server.store.AddTask(ctx, Task{Title: "Offsets", DueDate: dueIn("2024-01-12", time.UTC), Priority: "medium", ReminderOffsets: []int{60, 2 * 24 * 60}})
+	server.store.AddTask(ctx, Task{Title: "Yesterday", DueDate: dueIn("2024-01-09", time.UTC), Priority: "medium"})
+	server.store.AddTask(ctx, Task{Title: "No due date", Priority: "medium"})
+	done, _ := server.store.AddTask(ctx, Task{Title: "Done", DueDate: dueIn("2024-01-11", time.UTC), Priority: "medium"})
+	server.store.Update(ctx, done.ID, done.Title, "", done.DueDate, done.Priority, "completed")
+
+	// Each task is due at the end of its day
+	now := time.Date(2024, 1, 11, 0, 0, 0, 0, time.UTC)
+	var got []string
+	for _, reminder := range server.store.DueReminders(now, defaultReminderWindowMinutes) {
+		got = append(got, reminder.Task.Title)
+		if reminder.Task.Title == "Offsets" && reminder.OffsetMinutes != 2*24*60 {
+			t.Errorf("Offsets reminder offset = %d; want the two-day one", reminder.OffsetMinutes)
+		}
+	}
+	want := []string{"Tomorrow", "Offsets"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("due reminders = %q; want %q", got, want)
+	}
+}
+
+func TestSendRemindersOnce(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.now = func() time.Time { return time.Date(2024, 1, 11, 6, 0, 0, 0, time.UTC) }
+	server.location = time.UTC
+
+	ctx := context.Background()
+	task, _ := server.store.AddTask(ctx, Task{Title: "Call", DueDate: dueIn("2024-01-11", time.UTC), Priority: "medium"})
+
+	failing := &recordingNotifier{failing: true}
+	server.sendReminders(ctx, map[string]Notifier{"down": failing})
+	if got, _ := server.store.Get(task.ID); len(got.RemindersSent) != 0 {
+		t.Fatalf("reminder marked sent although every channel failed")
+	}
+
+	notifier := &recordingNotifier{}
+	channels := map[string]Notifier{"down": failing, "test": notifier}
+	server.sendReminders(ctx, channels)
+	server.sendReminders(ctx, channels)
+	if len(notifier.reminders) != 1 {
+		t.Fatalf("sent %d reminders; want 1", len(notifier.reminders))
+	}
+
+	// Moving the due date makes the reminder due again
+	server.store.Update(ctx, task.ID, task.Title, "", dueIn("2024-01-11T18:00:00Z", time.UTC), task.Priority, "pending")
+	server.sendReminders(ctx, channels)
+	if len(notifier.reminders) != 2 || notifier.reminders[1].Task.DueDate.String() != "2024-01-11T18:00:00Z" {
+		t.Errorf("reminders = %+v; want a second one for the new due date", notifier.reminders)
+	}
+	if got, _ := server.store.Get(task.ID); !reflect.DeepEqual(got.RemindersSent, []string{"2024-01-11T18:00:00Z/1440"}) {
+		t.Errorf("reminders_sent = %q; want only the current due date", got.RemindersSent)
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var body map[string]interface{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	notifiers, err := openNotifiers(&ReminderConfig{Channels: []string{"webhook"}, WebhookURL: ts.URL})
+	if err != nil {
+		t.Fatalf("openNotifiers: %v", err)
+	}
+	err = notifiers["webhook"].Notify(context.Background(), Reminder{Task: Task{ID: 3, Title: "Pay rent"}, OffsetMinutes: 60})
+	if err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if body["event"] != "task.reminder" || body["offset_minutes"] != float64(60) {
+		t.Errorf("webhook body = %v", body)
+	}
+}
+
+func TestOpenNotifiersValidation(t *testing.T) {
+	for _, config := range []ReminderConfig{
+		{Channels: []string{"pager"}},
+		{Channels: []string{"webhook"}},
+		{Channels: []string{"email"}, Email: EmailConfig{SMTPAddr: "localhost:25"}},
+	} {
+		if _, err := openNotifiers(&config); err == nil {
+			t.Errorf("openNotifiers(%+v) succeeded; want error", config)
+		}
+	}
+}
+
+func TestReminderOffsetsValidation(t *testing.T) {
+	if got, err := normalizeReminderOffsets([]int{60, 1440, 60}); err != nil || !reflect.DeepEqual(got, []int{1440, 60}) {
+		t.Errorf("normalizeReminderOffsets = %v, %v; want [1440 60]", got, err)
+	}
+	for _, offsets := range [][]int{{0}, {-5}, {maxReminderOffsetMinutes + 1}} {
+		if _, err := normalizeReminderOffsets(offsets); err == nil {
+			t.Errorf("normalizeReminderOffsets(%v) succeeded; want error", offsets)
+		}
+	}
+}
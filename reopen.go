@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrTaskOpen is returned by Reopen when the task is not completed
+var ErrTaskOpen = errors.New("task is already open")
+
+// Reopen moves a completed task back to status, which must be an open
+// status of the workflow, and clears CompletedAt. It returns ErrTaskOpen
+// if the task isn't completed, and a *TransitionError if the workflow
+// doesn't allow the move. Like Update, the bool reports whether the task
+// exists.
+func (ts *TaskStore) Reopen(ctx context.Context, id int, status string) (*Task, bool, error) {
+	if status == "completed" || !ts.workflow.known(status) {
+		return nil, false, fmt.Errorf("can't reopen to status %q", status)
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	task, exists := ts.tasks[id]
+	if !exists {
+		return nil, false, nil
+	}
+	if err := ts.checkProjectLocked(ctx, task.ProjectID, PermissionEdit); err != nil {
+		return nil, true, err
+	}
+	if task.Status != "completed" {
+		return nil, true, ErrTaskOpen
+	}
+	if err := ts.workflow.checkTransition(task, status); err != nil {
+		return nil, true, err
+	}
+
+	prev := *task
+	task.Status = status
+	task.CompletedAt = nil
+	task.Position = 0
+	task.UpdatedAt = ts.now()
+	if err := ts.save(ctx, id); err != nil {
+		*task = prev
+		return nil, true, fmt.Errorf("save tasks: %w", err)
+	}
+	ts.recordChange(ctx, ChangeUpdated, task)
+	ts.recordMutation(ctx, AuditUpdate, auditTask, id, &prev, task)
+	return task, true, nil
+}
+
+// handleReopenTask moves a completed task back to pending, or to the
+// status given by ?to=
+func (s *Server) handleReopenTask(w http.ResponseWriter, r *http.Request) {
+	id, err := s.parseTaskID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidTaskID, "Invalid task ID")
+		return
+	}
+	status := r.URL.Query().Get("to")
+	if status == "" {
+		status = "pending"
+	}
+	if status == "completed" || !s.store.workflow.known(status) {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidQuery, "to must be a status other than completed")
+		return
+	}
+
+	task, exists, err := s.store.Reopen(r.Context(), id, status)
+	if errors.Is(err, ErrTaskOpen) {
+		writeError(w, http.StatusConflict, ErrCodeTaskOpen, "Task is not completed")
+		return
+	}
+	if errors.Is(err, ErrTransitionNotAllowed) {
+		writeTransitionNotAllowed(w, err)
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if !exists {
+		writeError(w, http.StatusNotFound, ErrCodeTaskNotFound, "Task not found")
+		return
+	}
+	taskOps.Add("reopen", 1)
+
+	writeJSON(w, http.StatusOK, s.presentTask(task))
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestReopenTask(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     string
+		to         string
+		wantCode   int
+		wantStatus string
+	}{
+		{"completed to pending", "completed", "", http.StatusOK, "pending"},
+		{"completed to in_progress", "completed", "in_progress", http.StatusOK, "in_progress"},
+		{"pending", "pending", "", http.StatusConflict, "pending"},
+		{"in_progress", "in_progress", "", http.StatusConflict, "in_progress"},
+		{"invalid target", "completed", "completed", http.StatusBadRequest, "completed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, cleanup := setupTestServer()
+			defer cleanup()
+
+			ctx := context.Background()
+			task, _ := server.store.Add(ctx, "Task", "", DueTime{}, "medium")
+			server.store.Update(ctx, task.ID, task.Title, "", DueTime{}, task.Priority, tt.status)
+
+			url := "/api/v1/tasks/1/reopen"
+			if tt.to != "" {
+				url += "?to=" + tt.to
+			}
+			req := mux.SetURLVars(httptest.NewRequest("POST", url, nil), map[string]string{"id": "1"})
+			w := httptest.NewRecorder()
+			server.handleReopenTask(w, req)
+			if w.Code != tt.wantCode {
+				t.Fatalf("status code = %d; want %d", w.Code, tt.wantCode)
+			}
+
+			got, _ := server.store.Get(task.ID)
+			if got.Status != tt.wantStatus {
+				t.Errorf("status = %q; want %q", got.Status, tt.wantStatus)
+			}
+			if tt.wantCode == http.StatusOK {
+				var body Task
+				if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+					t.Fatalf("decode response: %v", err)
+				}
+				if body.CompletedAt != nil || got.CompletedAt != nil {
+					t.Error("completed_at was not cleared")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// retentionSweepInterval is how often completed tasks are checked for expiry
+const retentionSweepInterval = time.Hour
+
+// DeleteCompletedBefore permanently removes completed tasks, live or
+// archived, that were completed before cutoff and returns how many were
+// removed. Tasks without a CompletedAt (completed before it was tracked)
+// fall back to UpdatedAt.
+func (ts *TaskStore) DeleteCompletedBefore(ctx context.Context, cutoff time.Time) (int, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	if err := ts.refreshLocked(ctx); err != nil {
+		return 0, err
+	}
+	completed, err := ts.storage.Query(ctx, StorageQuery{Statuses: []string{"completed"}})
+	if err != nil {
+		return 0, fmt.Errorf("query completed tasks: %w", err)
+	}
+	removed := make(map[int]*Task)
+	removedArchived := make(map[int]*Task)
+	for _, found := range completed {
+		if task, exists := ts.tasks[found.ID]; exists && task.Status == "completed" && completedBefore(task, cutoff) {
+			removed[task.ID] = task
+			delete(ts.tasks, task.ID)
+		} else if task, exists := ts.archive[found.ID]; exists && completedBefore(task, cutoff) {
+			removedArchived[task.ID] = task
+			delete(ts.archive, task.ID)
+		}
+	}
+	if len(removed)+len(removedArchived) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]int, 0, len(removed)+len(removedArchived))
+	for id := range removed {
+		ids = append(ids, id)
+	}
+	for id := range removedArchived {
+		ids = append(ids, id)
+	}
+	if err := ts.save(ctx, ids...); err != nil {
+		for id, task := range removed {
+			ts.tasks[id] = task
+		}
+		for id, task := range removedArchived {
+			ts.archive[id] = task
+		}
+		return 0, fmt.Errorf("save tasks: %w", err)
+	}
+	for id, task := range removed {
+		ts.recordChange(ctx, ChangeDeleted, task)
+		ts.recordMutation(ctx, AuditPurge, auditTask, id, task, nil)
+	}
+	for id, task := range removedArchived {
+		ts.recordMutation(ctx, AuditPurge, auditTask, id, task, nil)
+	}
+	return len(removed) + len(removedArchived), nil
+}
+
+// sweepCompletedTasks deletes completed tasks older than the configured
+// retention window, logging how many were removed
+func (s *Server) sweepCompletedTasks(ctx context.Context) {
+	days := s.config.AutoDeleteCompletedAfterDays
+	if days <= 0 {
+		return
+	}
+	cutoff := s.now().AddDate(0, 0, -days)
+	count, err := s.store.DeleteCompletedBefore(ctx, cutoff)
+	if err != nil {
+		slog.Error("Retention sweep failed", "error", err)
+		return
+	}
+	slog.Info("Retention sweep removed completed tasks", "count", count, "older_than_days", days)
+}
+
+// runRetentionSweeper sweeps once immediately and then on every tick of
+// interval until ctx is cancelled. It does nothing when retention is off.
+func (s *Server) runRetentionSweeper(ctx context.Context, interval time.Duration) {
+	if s.config.AutoDeleteCompletedAfterDays <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	s.sweepCompletedTasks(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.sweepCompletedTasks(ctx)
+		}
+	}
+}
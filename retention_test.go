@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRetentionSweepDeletesAgedCompletedTasks(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.AutoDeleteCompletedAfterDays = 7
+
+	now := time.Date(2024, time.March, 20, 12, 0, 0, 0, time.UTC)
+	server.now = func() time.Time { return now }
+
+	completeAt(t, server.store, now.AddDate(0, 0, -10)) // aged, deleted
+	completeAt(t, server.store, now.AddDate(0, 0, -2))  // fresh, kept
+	server.store.now = func() time.Time { return now.AddDate(0, 0, -30) }
+	if _, err := server.store.Add(context.Background(), "Old but pending", "", DueTime{}, "low"); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	server.sweepCompletedTasks(context.Background())
+
+	if _, exists := server.store.Get(1); exists {
+		t.Error("aged completed task should have been deleted")
+	}
+	if _, exists := server.store.Get(2); !exists {
+		t.Error("recently completed task should be kept")
+	}
+	if _, exists := server.store.Get(3); !exists {
+		t.Error("pending task should never be swept")
+	}
+}
+
+func TestRetentionSweepDisabled(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	now := time.Date(2024, time.March, 20, 12, 0, 0, 0, time.UTC)
+	server.now = func() time.Time { return now }
+	completeAt(t, server.store, now.AddDate(-1, 0, 0))
+
+	server.sweepCompletedTasks(context.Background())
+
+	if _, exists := server.store.Get(1); !exists {
+		t.Error("task deleted with retention disabled")
+	}
+}
+
+func TestRetentionSweeperStopsOnCancel(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.AutoDeleteCompletedAfterDays = 1
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		server.runRetentionSweeper(ctx, time.Millisecond)
+		close(done)
+	}()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("sweeper did not stop after cancel")
+	}
+}
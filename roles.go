@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Roles a token can have. Each role may do everything the roles before it
+// may: viewers can only call endpoints that read, editors can also change
+// tasks and projects, and admins can also manage webhooks, config and
+// admin tokens.
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
+
+// roleRanks lists the known roles from least to most privileged
+var roleRanks = map[string]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleAdmin:  3,
+}
+
+// validateTokenRoles checks that every role in Config.TokenRoles is known
+func validateTokenRoles(roles map[string]string) error {
+	for hash, role := range roles {
+		if _, ok := roleRanks[role]; !ok {
+			return fmt.Errorf("unknown role %q for token %s", role, tokenID(hash))
+		}
+	}
+	return nil
+}
+
+// Scopes are what each route checks for. A token gets the scopes of its
+// role unless it was issued with fewer, so that a script can be given only
+// what it needs.
+const (
+	ScopeTasksRead  = "tasks:read"
+	ScopeTasksWrite = "tasks:write"
+	ScopeAdmin      = "admin"
+)
+
+// roleScopes returns the scopes granted by role
+func roleScopes(role string) []string {
+	switch role {
+	case RoleViewer:
+		return []string{ScopeTasksRead}
+	case RoleEditor:
+		return []string{ScopeTasksRead, ScopeTasksWrite}
+	}
+	return []string{ScopeTasksRead, ScopeTasksWrite, ScopeAdmin}
+}
+
+// normalizeScopes returns scopes without duplicates in the order of
+// roleScopes, and whether they are all granted by role
+func normalizeScopes(scopes []string, role string) ([]string, bool) {
+	granted := roleScopes(role)
+	normalized := make([]string, 0, len(granted))
+	for _, scope := range granted {
+		for _, requested := range scopes {
+			if requested == scope {
+				normalized = append(normalized, scope)
+				break
+			}
+		}
+	}
+	for _, requested := range scopes {
+		if !containsString(normalized, requested) {
+			return nil, false
+		}
+	}
+	return normalized, true
+}
+
+// scopesRole returns the least privileged role that grants all of scopes,
+// or "" if a scope is unknown
+func scopesRole(scopes []string) string {
+	for _, role := range []string{RoleViewer, RoleEditor, RoleAdmin} {
+		if _, ok := normalizeScopes(scopes, role); ok {
+			return role
+		}
+	}
+	return ""
+}
+
+// validateTokenScopes checks that every token in Config.TokenScopes has
+// scopes its role grants
+func validateTokenScopes(scopes map[string][]string, roles map[string]string) error {
+	for hash, tokenScopes := range scopes {
+		role, ok := roles[hash]
+		if !ok {
+			role = RoleAdmin
+		}
+		if _, ok := normalizeScopes(tokenScopes, role); !ok || len(tokenScopes) == 0 {
+			return fmt.Errorf("scopes %q not allowed for %s token %s", tokenScopes, role, tokenID(hash))
+		}
+	}
+	return nil
+}
+
+// tokenInfo is what a token grants
+type tokenInfo struct {
+	role   string
+	scopes []string
+	// hash identifies a stored token and subject a JWT; the other is empty
+	hash    string
+	subject string
+	// expiresAt is zero for tokens that don't expire
+	expiresAt time.Time
+}
+
+// hasScope reports whether the token grants scope
+func (info tokenInfo) hasScope(scope string) bool {
+	return containsString(info.scopes, scope)
+}
+
+// lookupToken returns what token grants. With a JWT secret configured,
+// JWTs are checked by signature, expiry and revocation. Other tokens must
+// have their hash in Config.TokenHashes and not be past their expiry;
+// those without an entry in Config.TokenRoles were issued before roles
+// existed and keep the full access they had, as admins. Tokens have the
+// scopes they were issued with, or all those of their role. An expired
+// token of either kind gives errTokenExpired. Stored tokens only work in
+// the workspace they were issued for, and JWTs only in the default one.
+func (s *Server) lookupToken(token string) (tokenInfo, error) {
+	if token == "" {
+		return tokenInfo{}, errInvalidToken
+	}
+	if s.config.JWTSecret != "" && strings.Count(token, ".") == 2 {
+		if s.workspace != "" {
+			return tokenInfo{}, errInvalidToken
+		}
+		claims, err := parseJWT([]byte(s.config.JWTSecret), token, s.now())
+		if errors.Is(err, errJWTExpired) {
+			return tokenInfo{}, errTokenExpired
+		}
+		if err != nil || s.jwtRevoked(claims.Subject) {
+			return tokenInfo{}, errInvalidToken
+		}
+		// JWTs from before scopes were enforced named them differently
+		scopes, ok := normalizeScopes(claims.Scopes, claims.Role)
+		if !ok || len(scopes) == 0 {
+			scopes = roleScopes(claims.Role)
+		}
+		return tokenInfo{role: claims.Role, scopes: scopes, subject: claims.Subject, expiresAt: time.Unix(claims.ExpiresAt, 0)}, nil
+	}
+	tokenHash := hashString(token)
+	now := s.now()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, storedHash := range s.config.TokenHashes {
+		if storedHash != tokenHash {
+			continue
+		}
+		if s.config.TokenWorkspaces[tokenHash] != s.workspace {
+			return tokenInfo{}, errInvalidToken
+		}
+		info := s.storedTokenLocked(tokenHash)
+		if !info.expiresAt.IsZero() && !now.Before(info.expiresAt) {
+			return tokenInfo{}, errTokenExpired
+		}
+		return info, nil
+	}
+	return tokenInfo{}, errInvalidToken
+}
+
+// storedTokenLocked returns what the stored token with hash grants,
+// without checking that it exists or hasn't expired. The caller must hold
+// s.mu.
+func (s *Server) storedTokenLocked(hash string) tokenInfo {
+	info := tokenInfo{role: RoleAdmin, hash: hash}
+	if role, ok := s.config.TokenRoles[hash]; ok {
+		info.role = role
+	}
+	info.scopes = s.config.TokenScopes[hash]
+	if info.scopes == nil {
+		info.scopes = roleScopes(info.role)
+	}
+	info.expiresAt = s.config.TokenMetadata[hash].expiresAt()
+	return info
+}
+
+// Errors from lookupToken
+var (
+	errInvalidToken = errors.New("invalid token")
+	errTokenExpired = errors.New("token expired")
+)
+
+// tokenKey is the context key under which requireScope stores the caller's
+// tokenInfo
+type tokenKey struct{}
+
+// requestToken returns what the request's token grants as established by
+// requireScope; the role is "" for an unauthenticated request
+func requestToken(r *http.Request) tokenInfo {
+	info, _ := r.Context().Value(tokenKey{}).(tokenInfo)
+	return info
+}
+
+// requireScope lets a request through only with an X-API-Token that grants
+// scope, or any valid token if scope is "": 401 without a valid token or
+// with an expired one, 403 when the scope is missing
+func (s *Server) requireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get("X-API-Token")
+		if token == "" {
+			writeError(w, http.StatusUnauthorized, ErrCodeTokenRequired, "Token required")
+			return
+		}
+
+		info, err := s.lookupToken(token)
+		if errors.Is(err, errTokenExpired) {
+			writeError(w, http.StatusUnauthorized, ErrCodeTokenExpired, "Token expired")
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, ErrCodeInvalidToken, "Invalid token")
+			return
+		}
+		if scope != "" && !info.hasScope(scope) {
+			writeError(w, http.StatusForbidden, ErrCodeForbidden, fmt.Sprintf("Requires the %s scope", scope))
+			return
+		}
+
+		s.touchToken(info.hash)
+		next(w, r.WithContext(context.WithValue(r.Context(), tokenKey{}, info)))
+	}
+}
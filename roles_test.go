@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRoleAccess(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.TokenHashes = []string{hashString("view"), hashString("edit"), hashString("admin"), hashString("legacy")}
+	server.config.TokenRoles = map[string]string{
+		hashString("view"):  RoleViewer,
+		hashString("edit"):  RoleEditor,
+		hashString("admin"): RoleAdmin,
+	}
+	r, err := server.Router()
+	if err != nil {
+		t.Fatalf("Router() error = %v", err)
+	}
+
+	tests := []struct {
+		token      string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+	}{
+		{"view", "GET", "/api/v1/auth/verify", "", http.StatusOK},
+		{"view", "POST", "/api/v1/tasks", `{"title":"x"}`, http.StatusForbidden},
+		{"edit", "POST", "/api/v1/tasks", `{"title":"x"}`, http.StatusCreated},
+		{"edit", "GET", "/api/v1/admin/config", "", http.StatusForbidden},
+		{"edit", "GET", "/api/v1/webhooks", "", http.StatusForbidden},
+		{"admin", "GET", "/api/v1/admin/config", "", http.StatusOK},
+		{"legacy", "GET", "/api/v1/admin/config", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+		req.Header.Set("X-API-Token", tt.token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s %s as %s: status = %d; want %d", tt.method, tt.path, tt.token, w.Code, tt.wantStatus)
+		}
+		if tt.wantStatus == http.StatusForbidden {
+			var body struct {
+				Code string `json:"code"`
+			}
+			json.NewDecoder(w.Body).Decode(&body)
+			if body.Code != ErrCodeForbidden {
+				t.Errorf("%s %s as %s: code = %q; want %s", tt.method, tt.path, tt.token, body.Code, ErrCodeForbidden)
+			}
+		}
+	}
+}
+
+func TestVerifyTokenReportsRole(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.TokenHashes = []string{hashString("view")}
+	server.config.TokenRoles = map[string]string{hashString("view"): RoleViewer}
+	r, _ := server.Router()
+
+	req := httptest.NewRequest("GET", "/api/v1/auth/verify", nil)
+	req.Header.Set("X-API-Token", "view")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	var body map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&body)
+	if body["role"] != RoleViewer || body["scope"] != "read" {
+		t.Errorf("body = %v; want role viewer, scope read", body)
+	}
+}
+
+func TestGenerateTokenRoles(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	generate := func(body, token string) (int, map[string]string) {
+		req := httptest.NewRequest("POST", "/api/v1/auth/token", bytes.NewBufferString(body))
+		if token != "" {
+			req.Header.Set("X-API-Token", token)
+		}
+		w := httptest.NewRecorder()
+		server.handleGenerateToken(w, req)
+		var resp map[string]string
+		json.NewDecoder(w.Body).Decode(&resp)
+		return w.Code, resp
+	}
+
+	code, first := generate("", "")
+	if code != http.StatusCreated || first["role"] != RoleAdmin {
+		t.Fatalf("first token: status %d, role %q; want 201, admin", code, first["role"])
+	}
+	if _, second := generate("", ""); second["role"] != RoleEditor {
+		t.Errorf("second token role = %q; want editor", second["role"])
+	}
+	if _, viewer := generate(`{"role":"viewer"}`, ""); viewer["role"] != RoleViewer {
+		t.Errorf("viewer token role = %q; want viewer", viewer["role"])
+	}
+	if code, _ := generate(`{"role":"admin"}`, ""); code != http.StatusForbidden {
+		t.Errorf("admin token without admin: status %d; want 403", code)
+	}
+	if code, resp := generate(`{"role":"admin"}`, first["token"]); code != http.StatusCreated || resp["role"] != RoleAdmin {
+		t.Errorf("admin token from admin: status %d, role %q; want 201, admin", code, resp["role"])
+	}
+	if code, _ := generate(`{"role":"owner"}`, ""); code != http.StatusUnprocessableEntity {
+		t.Errorf("unknown role: status %d; want 422", code)
+	}
+
+	if info, err := server.lookupToken(first["token"]); err != nil || info.role != RoleAdmin {
+		t.Errorf("lookupToken(first) = %+v, %v; want admin", info, err)
+	}
+}
+
+func TestValidateTokenRoles(t *testing.T) {
+	if err := validateTokenRoles(map[string]string{"abc": "owner"}); err == nil {
+		t.Error("validateTokenRoles accepted unknown role")
+	} else if !strings.Contains(err.Error(), tokenID("abc")) {
+		t.Errorf("validateTokenRoles() error = %v; want it to name token %s", err, tokenID("abc"))
+	}
+	if err := validateTokenRoles(map[string]string{"abc": RoleViewer}); err != nil {
+		t.Errorf("validateTokenRoles() error = %v", err)
+	}
+}
+
+func TestScopedTokens(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.TokenHashes = []string{hashString("admin")}
+	r, err := server.Router()
+	if err != nil {
+		t.Fatalf("Router() error = %v", err)
+	}
+
+	do := func(method, path, body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("X-API-Token", token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	generate := func(body string) (int, map[string]interface{}) {
+		w := do("POST", "/api/v1/auth/token", body, "admin")
+		var resp map[string]interface{}
+		json.NewDecoder(w.Body).Decode(&resp)
+		return w.Code, resp
+	}
+
+	code, writer := generate(`{"scopes":["tasks:write","tasks:write"]}`)
+	if code != http.StatusCreated || writer["role"] != RoleEditor {
+		t.Fatalf("write-only token: status %d, body %v; want 201, editor", code, writer)
+	}
+	token := writer["token"].(string)
+	if w := do("POST", "/api/v1/tasks", `{"title":"x"}`, token); w.Code != http.StatusCreated {
+		t.Errorf("create with tasks:write: status %d; want 201", w.Code)
+	}
+	if w := do("GET", "/api/v1/tasks/1/share", "", token); w.Code != http.StatusForbidden {
+		t.Errorf("share without tasks:read: status %d; want 403", w.Code)
+	}
+	if info, _ := server.lookupToken(token); len(info.scopes) != 1 || info.scopes[0] != ScopeTasksWrite {
+		t.Errorf("scopes = %v; want [tasks:write]", info.scopes)
+	}
+
+	_, reader := generate(`{"role":"admin","scopes":["tasks:read"]}`)
+	if w := do("GET", "/api/v1/admin/config", "", reader["token"].(string)); w.Code != http.StatusForbidden {
+		t.Errorf("admin role without admin scope: status %d; want 403", w.Code)
+	}
+
+	for _, body := range []string{`{"role":"viewer","scopes":["tasks:write"]}`, `{"scopes":["tasks:delete"]}`} {
+		code, resp := generate(body)
+		if code != http.StatusUnprocessableEntity || resp["code"] != ErrCodeInvalidScope {
+			t.Errorf("generate %s: status %d, body %v; want 422 %s", body, code, resp, ErrCodeInvalidScope)
+		}
+	}
+}
+
+func TestValidateTokenScopes(t *testing.T) {
+	roles := map[string]string{"abc": RoleViewer}
+	if err := validateTokenScopes(map[string][]string{"abc": {ScopeTasksWrite}}, roles); err == nil {
+		t.Error("validateTokenScopes accepted a scope the role doesn't grant")
+	}
+	// Tokens without a role are admins
+	if err := validateTokenScopes(map[string][]string{"def": {ScopeAdmin}}, roles); err != nil {
+		t.Errorf("validateTokenScopes() error = %v", err)
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// s3Timeout bounds a single request to the object store; uploads of the
+// largest allowed attachment must fit in it
+const s3Timeout = 5 * time.Minute
+
+// emptyPayloadHash is the SHA-256 of an empty body, signed for requests
+// without one
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3Config is an S3-compatible object store (AWS S3, MinIO, Cloudflare R2,
+// ...) that attachments are kept in. Objects are addressed path-style,
+// as Endpoint/Bucket/key.
+type S3Config struct {
+	// Endpoint is the service URL, e.g. https://s3.eu-west-1.amazonaws.com
+	// or http://localhost:9000
+	Endpoint string `json:"endpoint,omitempty"`
+	// Region is used for request signing (default: us-east-1)
+	Region          string `json:"region,omitempty"`
+	Bucket          string `json:"bucket,omitempty"`
+	AccessKeyID     string `json:"access_key_id,omitempty"`
+	SecretAccessKey string `json:"secret_access_key,omitempty"`
+	// Prefix is put before every object key, e.g. "taskmate/"
+	Prefix string `json:"prefix,omitempty"`
+}
+
+func init() {
+	RegisterAttachmentStore("s3", func(config *AttachmentConfig) (AttachmentStore, error) {
+		return newS3AttachmentStore(config.S3)
+	})
+}
+
+// s3AttachmentStore keeps attachment files as objects in a bucket, signing
+// requests with AWS Signature Version 4
+type s3AttachmentStore struct {
+	config   S3Config
+	endpoint *url.URL
+	client   *http.Client
+	now      func() time.Time
+}
+
+// newS3AttachmentStore checks config and returns a store for its bucket
+func newS3AttachmentStore(config S3Config) (*s3AttachmentStore, error) {
+	if config.Endpoint == "" || config.Bucket == "" || config.AccessKeyID == "" || config.SecretAccessKey == "" {
+		return nil, errors.New("s3 storage needs attachments.s3 endpoint, bucket, access_key_id and secret_access_key")
+	}
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid attachments.s3 endpoint %q", config.Endpoint)
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	return &s3AttachmentStore{
+		config:   config,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: s3Timeout},
+		now:      time.Now,
+	}, nil
+}
+
+// Put uploads the file as an object with the attachment's content type
+func (s *s3AttachmentStore) Put(ctx context.Context, key string, body io.Reader, attachment Attachment) error {
+	req, err := s.newRequest(ctx, http.MethodPut, key, body, attachment.SHA256)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = attachment.Size
+	req.Header.Set("Content-Type", attachment.ContentType)
+	resp, err := s.do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Open downloads the object, returning ErrAttachmentNotFound if the bucket
+// doesn't have it
+func (s *s3AttachmentStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	req, err := s.newRequest(ctx, http.MethodGet, key, nil, emptyPayloadHash)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Delete removes the object; S3 treats a missing one as deleted
+func (s *s3AttachmentStore) Delete(ctx context.Context, key string) error {
+	req, err := s.newRequest(ctx, http.MethodDelete, key, nil, emptyPayloadHash)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(req)
+	if errors.Is(err, ErrAttachmentNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// do sends a signed request. Error responses are closed and returned as
+// errors, 404 as ErrAttachmentNotFound.
+func (s *s3AttachmentStore) do(req *http.Request) (*http.Response, error) {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrAttachmentNotFound
+	}
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return nil, fmt.Errorf("s3 %s %s: %s: %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(detail)))
+}
+
+// newRequest builds a request for the object key, signed for a body with
+// the hex SHA-256 payloadHash
+func (s *s3AttachmentStore) newRequest(ctx context.Context, method, key string, body io.Reader, payloadHash string) (*http.Request, error) {
+	u := *s.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.config.Bucket + "/" + s.config.Prefix + key
+	u.RawPath = ""
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, payloadHash, s.now().UTC())
+	return req, nil
+}
+
+// sign adds the AWS Signature Version 4 headers to req, signing the host,
+// the payload hash and the date
+func (s *s3AttachmentStore) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		"",
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + s.config.Region + "/s3/aws4_request"
+	canonicalHash := sha256.Sum256([]byte(canonical))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	key := sigV4Key(s.config.SecretAccessKey, day, s.config.Region, "s3")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.config.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// sigV4Key derives the Signature Version 4 signing key for a day, region
+// and service
+func sigV4Key(secret, day, region, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secret), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data under key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
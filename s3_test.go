@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is an object store that keeps objects in memory and checks that
+// each request is signed as store would sign it
+type fakeS3 struct {
+	store   *s3AttachmentStore
+	mu      sync.Mutex
+	objects map[string][]byte
+	types   map[string]string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Re-sign the request as received; the signatures must match
+	check, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.EscapedPath(), nil)
+	date, _ := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+	f.store.sign(check, r.Header.Get("X-Amz-Content-Sha256"), date)
+	if check.Header.Get("Authorization") != r.Header.Get("Authorization") {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		if hashString(string(data)) != r.Header.Get("X-Amz-Content-Sha256") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.objects[r.URL.Path] = data
+		f.types[r.URL.Path] = r.Header.Get("Content-Type")
+	case http.MethodGet:
+		data, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestS3AttachmentStore(t *testing.T) {
+	fake := &fakeS3{objects: make(map[string][]byte), types: make(map[string]string)}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	config := S3Config{Endpoint: srv.URL, Bucket: "files", AccessKeyID: "AKID", SecretAccessKey: "secret", Prefix: "taskmate/"}
+	store, err := newS3AttachmentStore(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.store, _ = newS3AttachmentStore(config)
+	ctx := context.Background()
+
+	content := "report contents"
+	attachment := Attachment{Size: int64(len(content)), ContentType: "text/plain", SHA256: hashString(content)}
+	if err := store.Put(ctx, "tasks/1/abc", strings.NewReader(content), attachment); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if fake.types["/files/taskmate/tasks/1/abc"] != "text/plain" {
+		t.Errorf("objects = %v; want the file under the bucket and prefix", fake.types)
+	}
+
+	file, err := store.Open(ctx, "tasks/1/abc")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	data, _ := io.ReadAll(file)
+	file.Close()
+	if string(data) != content {
+		t.Errorf("Open() read %q; want %q", data, content)
+	}
+
+	if err := store.Delete(ctx, "tasks/1/abc"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := store.Open(ctx, "tasks/1/abc"); !errors.Is(err, ErrAttachmentNotFound) {
+		t.Errorf("Open() after Delete() error = %v; want ErrAttachmentNotFound", err)
+	}
+
+	store.config.SecretAccessKey = "wrong"
+	if err := store.Put(ctx, "tasks/1/def", strings.NewReader(content), attachment); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Put() with the wrong secret error = %v; want the 403", err)
+	}
+}
+
+func TestSigV4Key(t *testing.T) {
+	// The example from the AWS Signature Version 4 documentation
+	key := sigV4Key("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "20150830", "us-east-1", "iam")
+	if got := hex.EncodeToString(key); got != "c4afb1cc5771d871763a393e44b703571b55cc28424d1a5e86da6ed3c154a4b9" {
+		t.Errorf("sigV4Key() = %s", got)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// SearchResult is a task matched by SearchAll along with the fields that
+// contained the query
+type SearchResult struct {
+	*Task
+	MatchedFields []string `json:"matched_fields"`
+}
+
+// normalizeQuery prepares user input for case-insensitive matching
+func normalizeQuery(query string) string {
+	return strings.ToLower(strings.TrimSpace(query))
+}
+
+// SearchAll returns every task with a field containing query, ordered by ID.
+// It covers all searchable text fields and reports which ones matched.
+func (ts *TaskStore) SearchAll(query string) []SearchResult {
+	query = normalizeQuery(query)
+	if query == "" {
+		return []SearchResult{}
+	}
+
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	results := make([]SearchResult, 0)
+	for _, task := range ts.searchCandidatesLocked(query) {
+		var matched []string
+		if strings.Contains(strings.ToLower(task.Title), query) {
+			matched = append(matched, "title")
+		}
+		if strings.Contains(strings.ToLower(task.Description), query) {
+			matched = append(matched, "description")
+		}
+		for _, tag := range task.Tags {
+			if strings.Contains(tagKey(tag), query) {
+				matched = append(matched, "tags")
+				break
+			}
+		}
+		if len(matched) > 0 {
+			results = append(results, SearchResult{Task: task, MatchedFields: matched})
+		}
+	}
+	return results
+}
+
+// parsePagination reads ?limit= and ?offset=; a missing or zero limit means
+// no limit
+func parsePagination(r *http.Request) (limit, offset int, ok bool) {
+	q := r.URL.Query()
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, 0, false
+		}
+		limit = n
+	}
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, 0, false
+		}
+		offset = n
+	}
+	return limit, offset, true
+}
+
+// handleSearch is the unified search across all task text fields, with
+// optional ?status= filtering and ?limit=/?offset= pagination. The total
+// number of matches before pagination is sent in X-Total-Count.
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	if strings.TrimSpace(query) == "" {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidQuery, "Query parameter q is required")
+		return
+	}
+	limit, offset, ok := parsePagination(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidQuery, "Invalid limit or offset")
+		return
+	}
+
+	results := s.store.SearchAll(query)
+	if status := r.URL.Query().Get("status"); status != "" {
+		filtered := results[:0]
+		for _, result := range results {
+			if result.Status == status {
+				filtered = append(filtered, result)
+			}
+		}
+		results = filtered
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(results)))
+	if offset > len(results) {
+		offset = len(results)
+	}
+	results = results[offset:]
+	if limit > 0 && limit < len(results) {
+		results = results[:limit]
+	}
+	response := make([]searchResponseItem, len(results))
+	for i, result := range results {
+		response[i] = searchResponseItem{
+			publicTask:    s.presentTask(result.Task),
+			MatchedFields: result.MatchedFields,
+		}
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// searchResponseItem is a SearchResult as shown to API clients
+type searchResponseItem struct {
+	publicTask
+	MatchedFields []string `json:"matched_fields"`
+}
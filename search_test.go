@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestSearchAllMatchedFields(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	ctx := context.Background()
+	server.store.Add(ctx, "Invoice ACME", "", DueTime{}, "medium")
+	server.store.Add(ctx, "Call accounting", "About the acme invoice", DueTime{}, "medium")
+	server.store.Add(ctx, "Groceries", "", DueTime{}, "low")
+
+	results := server.store.SearchAll("  ACME ")
+	if len(results) != 2 {
+		t.Fatalf("SearchAll() returned %d results; want 2", len(results))
+	}
+	if results[0].ID != 1 || !reflect.DeepEqual(results[0].MatchedFields, []string{"title"}) {
+		t.Errorf("results[0] = %d %v; want 1 [title]", results[0].ID, results[0].MatchedFields)
+	}
+	if results[1].ID != 2 || !reflect.DeepEqual(results[1].MatchedFields, []string{"description"}) {
+		t.Errorf("results[1] = %d %v; want 2 [description]", results[1].ID, results[1].MatchedFields)
+	}
+}
+
+func TestSearchEndpointFiltersAndPaginates(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	ctx := context.Background()
+	for i := 0; i < 5; i++ {
+		server.store.Add(ctx, "Report", "", DueTime{}, "medium")
+	}
+	server.store.Update(ctx, 2, "Report", "", DueTime{}, "medium", "completed")
+
+	search := func(url string) ([]SearchResult, string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		server.handleSearch(w, httptest.NewRequest("GET", url, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s status = %d; want %d", url, w.Code, http.StatusOK)
+		}
+		var results []SearchResult
+		if err := json.NewDecoder(w.Body).Decode(&results); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return results, w.Header().Get("X-Total-Count")
+	}
+
+	results, total := search("/api/v1/search?q=report&status=pending&limit=2&offset=1")
+	if total != "4" {
+		t.Errorf("X-Total-Count = %s; want 4", total)
+	}
+	if len(results) != 2 || results[0].ID != 3 || results[1].ID != 4 {
+		t.Errorf("page = %+v; want IDs [3 4]", results)
+	}
+
+	results, _ = search("/api/v1/search?q=report&offset=10")
+	if len(results) != 0 {
+		t.Errorf("offset past end returned %d results; want 0", len(results))
+	}
+
+	for _, url := range []string{"/api/v1/search", "/api/v1/search?q=x&limit=-1", "/api/v1/search?q=x&offset=abc"} {
+		w := httptest.NewRecorder()
+		server.handleSearch(w, httptest.NewRequest("GET", url, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("GET %s status = %d; want %d", url, w.Code, http.StatusBadRequest)
+		}
+	}
+}
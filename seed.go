@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// defaultSeedFile is loaded on startup when no seed_file is configured
+const defaultSeedFile = "seed.json"
+
+// SeedIfEmpty loads tasks from a JSON array at path, but only when the store
+// has no tasks; an existing store is never touched. Entries are validated
+// like create requests, with due days in the store's time zone, and either
+// all of them are added or none are.
+// It returns the number of tasks added.
+func (ts *TaskStore) SeedIfEmpty(path string) (int, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if len(ts.tasks) > 0 {
+		return 0, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	var entries []createTaskRequest
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return 0, fmt.Errorf("parse seed file: %w", err)
+	}
+	dueDates := make([]DueTime, len(entries))
+	for i := range entries {
+		err := entries[i].prepare(TaskDefaults{}, ts.priorities)
+		if err == nil {
+			entries[i].Tags, err = ts.tags.normalize(entries[i].Tags)
+		}
+		if err == nil {
+			dueDates[i], err = parseDueDate(entries[i].DueDate, ts.dueLocation)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("seed entry %d: %v", i, err)
+		}
+	}
+
+	now := ts.now()
+	ids := make([]int, 0, len(entries))
+	for i, entry := range entries {
+		ids = append(ids, ts.nextID)
+		ts.tasks[ts.nextID] = &Task{
+			ID:          ts.nextID,
+			Title:       entry.Title,
+			Description: entry.Description,
+			DueDate:     dueDates[i],
+			Priority:    entry.Priority,
+			Status:      "pending",
+			CreatedAt:   now,
+			UpdatedAt:   now,
+			Tags:        entry.Tags,
+		}
+		ts.nextID++
+	}
+
+	if err := ts.save(context.Background(), ids...); err != nil {
+		ts.tasks = make(map[int]*Task)
+		ts.nextID = 1
+		return 0, fmt.Errorf("save tasks: %w", err)
+	}
+	ts.resetChanges()
+	return len(entries), nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+)
+
+func writeSeedFile(t *testing.T, content string) string {
+	t.Helper()
+	path := "test_seed.json"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("write seed file: %v", err)
+	}
+	t.Cleanup(func() { os.Remove(path) })
+	return path
+}
+
+func TestSeedIfEmptySeedsEmptyStore(t *testing.T) {
+	tmpFile := "test_seeded_store.json"
+	defer os.Remove(tmpFile)
+	defer os.Remove("test_seeded_store_history.json")
+
+	seed := writeSeedFile(t, `[
+		{"title": "Welcome to TaskMate", "priority": "high"},
+		{"title": "Create your first task"}
+	]`)
+	store := NewTaskStore(tmpFile)
+
+	n, err := store.SeedIfEmpty(seed)
+	if err != nil {
+		t.Fatalf("SeedIfEmpty() error = %v", err)
+	}
+	if n != 2 {
+		t.Errorf("SeedIfEmpty() = %d; want 2", n)
+	}
+
+	tasks := store.GetAll()
+	if len(tasks) != 2 || tasks[0].Priority != "high" || tasks[1].Priority != "medium" || tasks[1].Status != "pending" {
+		t.Errorf("seeded tasks = %+v", tasks)
+	}
+
+	// Seeded tasks are persisted
+	if reloaded := NewTaskStore(tmpFile).GetAll(); len(reloaded) != 2 {
+		t.Errorf("reloaded %d tasks; want 2", len(reloaded))
+	}
+}
+
+func TestSeedIfEmptySkipsNonEmptyStore(t *testing.T) {
+	tmpFile := "test_seeded_store.json"
+	defer os.Remove(tmpFile)
+	defer os.Remove("test_seeded_store_history.json")
+
+	seed := writeSeedFile(t, `[{"title": "Seed"}]`)
+	store := NewTaskStore(tmpFile)
+	store.Add(context.Background(), "Existing", "", DueTime{}, "medium")
+
+	n, err := store.SeedIfEmpty(seed)
+	if err != nil || n != 0 {
+		t.Errorf("SeedIfEmpty() = %d, %v; want 0, nil", n, err)
+	}
+	if tasks := store.GetAll(); len(tasks) != 1 || tasks[0].Title != "Existing" {
+		t.Errorf("tasks = %+v; want only Existing", tasks)
+	}
+}
+
+func TestSeedIfEmptyValidatesEntries(t *testing.T) {
+	tmpFile := "test_seeded_store.json"
+	defer os.Remove(tmpFile)
+	defer os.Remove("test_seeded_store_history.json")
+
+	seed := writeSeedFile(t, `[{"title": "Fine"}, {"title": "  "}]`)
+	store := NewTaskStore(tmpFile)
+
+	if _, err := store.SeedIfEmpty(seed); err == nil {
+		t.Error("SeedIfEmpty() error = nil; want validation error")
+	}
+	if n := len(store.GetAll()); n != 0 {
+		t.Errorf("store has %d tasks after invalid seed; want 0", n)
+	}
+
+	if _, err := store.SeedIfEmpty("missing-seed.json"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("SeedIfEmpty(missing) error = %v; want os.ErrNotExist", err)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// shareLinkTTL is how long a share link stays valid after it is minted
+const shareLinkTTL = time.Hour
+
+var (
+	errShareLinkInvalid = errors.New("share link is malformed or has been tampered with")
+	errShareLinkExpired = errors.New("share link has expired")
+)
+
+// newShareKey returns the HMAC key for share links: the configured secret,
+// or a random key when none is set, in which case links stop working when
+// the server restarts
+func newShareKey(secret string) []byte {
+	if secret != "" {
+		return []byte(secret)
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic("share key: " + err.Error())
+	}
+	return key
+}
+
+// signShareToken returns a token granting read access to the task with the
+// given public ID until expires. The token is the base64url payload
+// "<id>.<unix expiry>" followed by "." and its base64url HMAC-SHA256.
+func (s *Server) signShareToken(publicID string, expires time.Time) string {
+	payload := publicID + "." + strconv.FormatInt(expires.Unix(), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(s.shareMAC([]byte(payload)))
+}
+
+// verifyShareToken checks the token's signature and expiry and returns the
+// public ID of the shared task
+func (s *Server) verifyShareToken(token string) (string, error) {
+	encodedPayload, encodedMAC, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", errShareLinkInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return "", errShareLinkInvalid
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil || !hmac.Equal(mac, s.shareMAC(payload)) {
+		return "", errShareLinkInvalid
+	}
+
+	publicID, rawExpiry, ok := strings.Cut(string(payload), ".")
+	if !ok {
+		return "", errShareLinkInvalid
+	}
+	expiry, err := strconv.ParseInt(rawExpiry, 10, 64)
+	if err != nil {
+		return "", errShareLinkInvalid
+	}
+	if !s.now().Before(time.Unix(expiry, 0)) {
+		return "", errShareLinkExpired
+	}
+	return publicID, nil
+}
+
+// shareMAC returns the HMAC-SHA256 of payload under the server's share key
+func (s *Server) shareMAC(payload []byte) []byte {
+	mac := hmac.New(sha256.New, s.shareKey)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// handleShareTask mints a read-only link to a single task
+func (s *Server) handleShareTask(w http.ResponseWriter, r *http.Request) {
+	id, err := s.parseTaskID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidTaskID, "Invalid task ID")
+		return
+	}
+	if _, exists := s.store.Get(id); !exists {
+		writeError(w, http.StatusNotFound, ErrCodeTaskNotFound, "Task not found")
+		return
+	}
+
+	expires := s.now().Add(shareLinkTTL).Truncate(time.Second)
+	token := s.signShareToken(s.formatID(id), expires)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"url":        s.linkURL("/api/v1/shared/" + token),
+		"token":      token,
+		"expires_at": expires.UTC(),
+	})
+}
+
+// handleGetSharedTask returns the task a share link points to. The link
+// itself is the credential, so no API token is required.
+func (s *Server) handleGetSharedTask(w http.ResponseWriter, r *http.Request) {
+	publicID, err := s.verifyShareToken(mux.Vars(r)["token"])
+	switch {
+	case errors.Is(err, errShareLinkExpired):
+		writeError(w, http.StatusForbidden, ErrCodeShareLinkExpired, "Share link has expired")
+		return
+	case err != nil:
+		writeError(w, http.StatusForbidden, ErrCodeShareLinkInvalid, "Invalid share link")
+		return
+	}
+
+	id, err := s.decodeTaskID(publicID)
+	if err != nil {
+		writeError(w, http.StatusForbidden, ErrCodeShareLinkInvalid, "Invalid share link")
+		return
+	}
+	task, exists := s.store.Get(id)
+	if !exists {
+		writeError(w, http.StatusNotFound, ErrCodeTaskNotFound, "Task not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.presentTask(task))
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// shareTask mints a share link for the task with the given ID and returns
+// its token
+func shareTask(t *testing.T, server *Server, id string) string {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/api/v1/tasks/"+id+"/share", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": id})
+	w := httptest.NewRecorder()
+	server.handleShareTask(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("share status = %d; want %d", w.Code, http.StatusOK)
+	}
+	var resp struct {
+		URL   string `json:"url"`
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode share response: %v", err)
+	}
+	if resp.URL != "/api/v1/shared/"+resp.Token {
+		t.Errorf("url = %q; want it to end in the token", resp.URL)
+	}
+	return resp.Token
+}
+
+// getShared fetches a shared task by token
+func getShared(server *Server, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/api/v1/shared/"+token, nil)
+	req = mux.SetURLVars(req, map[string]string{"token": token})
+	w := httptest.NewRecorder()
+	server.handleGetSharedTask(w, req)
+	return w
+}
+
+func TestSharedTaskLinks(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	server.now = func() time.Time { return now }
+	server.store.Add(context.Background(), "Shared", "", DueTime{}, "medium")
+	token := shareTask(t, server, "1")
+
+	w := getShared(server, token)
+	if w.Code != http.StatusOK {
+		t.Fatalf("valid link: status = %d; want %d", w.Code, http.StatusOK)
+	}
+	var task Task
+	if err := json.NewDecoder(w.Body).Decode(&task); err != nil {
+		t.Fatalf("decode task: %v", err)
+	}
+	if task.ID != 1 || task.Title != "Shared" {
+		t.Errorf("task = %d %q; want 1 %q", task.ID, task.Title, "Shared")
+	}
+
+	payload, mac, _ := strings.Cut(token, ".")
+	flipped := "A" + mac[1:]
+	if mac[0] == 'A' {
+		flipped = "B" + mac[1:]
+	}
+	other := server.signShareToken("2", now.Add(time.Hour))
+	otherPayload, _, _ := strings.Cut(other, ".")
+	tampered := []string{
+		otherPayload + "." + mac,
+		payload + "." + flipped,
+		payload,
+		"not-a-token",
+	}
+	for _, bad := range tampered {
+		w := getShared(server, bad)
+		if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), ErrCodeShareLinkInvalid) {
+			t.Errorf("tampered %q: status = %d body = %s; want 403 %s", bad, w.Code, w.Body.String(), ErrCodeShareLinkInvalid)
+		}
+	}
+
+	now = now.Add(shareLinkTTL)
+	w = getShared(server, token)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), ErrCodeShareLinkExpired) {
+		t.Errorf("expired link: status = %d body = %s; want 403 %s", w.Code, w.Body.String(), ErrCodeShareLinkExpired)
+	}
+}
+
+func TestShareLinkFromAnotherKeyIsRejected(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	server.store.Add(context.Background(), "Shared", "", DueTime{}, "medium")
+	token := shareTask(t, server, "1")
+
+	server.shareKey = newShareKey("rotated")
+	if w := getShared(server, token); w.Code != http.StatusForbidden {
+		t.Errorf("status = %d; want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestShareMissingTask(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	req := httptest.NewRequest("GET", "/api/v1/tasks/9/share", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "9"})
+	w := httptest.NewRecorder()
+	server.handleShareTask(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d; want %d", w.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// shutdownTimeout is how long in-flight requests get to finish after
+// SIGINT or SIGTERM
+const shutdownTimeout = 30 * time.Second
+
+// ErrStoreClosed is returned for changes made after the store was closed
+var ErrStoreClosed = errors.New("task store closed")
+
+// Close waits for any save in progress, then makes further changes fail
+// with ErrStoreClosed, closes the audit log and closes the backend if it
+// implements io.Closer. Every change is saved before its call returns, so
+// nothing is left to write.
+func (ts *TaskStore) Close() error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.closed {
+		return nil
+	}
+	ts.closed = true
+	var auditErr error
+	if ts.audit != nil {
+		auditErr = ts.audit.Close()
+	}
+	if closer, ok := ts.storage.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			return err
+		}
+	}
+	return auditErr
+}
+
+// startBackground runs the storage refresher, the retention sweeper, the
+// archiver, the trash purger, the recurrence, reminder, digest and backup
+// schedulers, the webhook dispatcher, the overdue scanner and the Telegram
+// bot until Shutdown. Workspaces other than the default one only get the
+// first five, which look after their own tasks; the rest are set up in the
+// server-wide config for the default workspace.
+func (s *Server) startBackground() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopBackground = cancel
+	workers := []func(){
+		func() { s.runStorageRefresher(ctx, storageRefreshInterval) },
+		func() { s.runRetentionSweeper(ctx, retentionSweepInterval) },
+		func() { s.runArchiver(ctx, archiveInterval) },
+		func() { s.runTrashPurger(ctx, trashPurgeInterval) },
+		func() { s.runRecurrenceScheduler(ctx) },
+	}
+	if s.workspace == "" {
+		workers = append(workers,
+			func() { s.runReminderScheduler(ctx, reminderScanInterval) },
+			func() { s.runDigestScheduler(ctx) },
+			func() { s.runWebhookDispatcher(ctx) },
+			func() { s.runOverdueScanner(ctx, reminderScanInterval) },
+			func() { s.runTelegramBot(ctx) },
+			func() { s.runBackupScheduler(ctx, s.config.Backup.interval()) },
+		)
+	}
+	s.background.Add(len(workers))
+	for _, run := range workers {
+		go func(run func()) {
+			defer s.background.Done()
+			run()
+		}(run)
+	}
+
+	s.workspacesMu.Lock()
+	defer s.workspacesMu.Unlock()
+	s.backgroundStarted = true
+	for _, ws := range s.workspaces {
+		ws.server.startBackground()
+	}
+}
+
+// streamContext returns a context for a long-lived request (an event
+// stream, long poll or sync connection) that is also done once Shutdown
+// starts, so those requests don't hold up draining. The caller must call
+// the cancel function.
+func (s *Server) streamContext(r *http.Request) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(r.Context())
+	go func() {
+		select {
+		case <-s.closing:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// Shutdown stops srv gracefully: it ends long-lived requests, waits until
+// ctx is done for the other in-flight requests to finish, stops the
+// background workers, closes the store and those of the other workspaces
+// and sends any remaining spans. The stores are closed even if
+// draining timed out, so requests still running then fail to save rather
+// than racing the backend's close.
+func (s *Server) Shutdown(ctx context.Context, srv *http.Server) error {
+	s.closeOnce.Do(func() { close(s.closing) })
+	err := srv.Shutdown(ctx)
+	if err != nil {
+		slog.Warn("Requests still running after shutdown timeout", "error", err)
+	}
+
+	if s.stopBackground != nil {
+		s.stopBackground()
+	}
+	s.background.Wait()
+
+	if closeErr := s.closeWorkspaces(); closeErr != nil {
+		slog.Error("Closing workspaces failed", "error", closeErr)
+	}
+	if closeErr := s.store.Close(); closeErr != nil {
+		return closeErr
+	}
+	if tracing != nil {
+		if traceErr := tracing.Shutdown(ctx); traceErr != nil {
+			slog.Warn("Unsent spans dropped at shutdown", "error", traceErr)
+		}
+	}
+	return err
+}
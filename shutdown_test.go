@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// closingBackend records whether it was closed
+type closingBackend struct {
+	jsonBackend
+	closed bool
+}
+
+func (b *closingBackend) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestShutdownDrainsAndClosesStore(t *testing.T) {
+	backend := &closingBackend{jsonBackend: jsonBackend{path: t.TempDir() + "/tasks.json"}}
+	store, err := NewTaskStoreWithStorage(backend)
+	if err != nil {
+		t.Fatalf("NewTaskStoreWithStorage() error = %v", err)
+	}
+	server := NewServerWithStore(&Config{}, store)
+	r, _ := server.Router()
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+	server.startBackground()
+
+	// An open event stream must not hold up the shutdown
+	resp, err := http.Get(ts.URL + "/api/v1/events")
+	if err != nil {
+		t.Fatalf("GET /api/v1/events error = %v", err)
+	}
+	defer resp.Body.Close()
+	line, _ := bufio.NewReader(resp.Body).ReadString('\n')
+	if line != ": connected\n" {
+		t.Fatalf("event stream started with %q", line)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := server.Shutdown(ctx, ts.Config); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Shutdown() took %v; want the event stream ended straight away", elapsed)
+	}
+	if !backend.closed {
+		t.Error("backend not closed")
+	}
+	if _, err := store.Add(context.Background(), "Late", "", DueTime{}, "low"); !errors.Is(err, ErrStoreClosed) {
+		t.Errorf("Add() after shutdown error = %v; want %v", err, ErrStoreClosed)
+	}
+	if len(store.GetAll()) != 0 {
+		t.Error("Add() after shutdown kept the task in memory")
+	}
+
+	w := httptest.NewRecorder()
+	writeStoreError(w, ErrStoreClosed)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("writeStoreError(ErrStoreClosed) status %d; want 503", w.Code)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// ErrTaskCompleted is returned when an action only applies to open tasks
+var ErrTaskCompleted = errors.New("task is completed")
+
+// Snooze moves the task's due date to newDue and counts the snooze.
+// Completed tasks are left alone and ErrTaskCompleted is returned. Like
+// Update, the bool reports whether the task exists.
+func (ts *TaskStore) Snooze(ctx context.Context, id int, newDue DueTime) (*Task, bool, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	task, exists := ts.tasks[id]
+	if !exists {
+		return nil, false, nil
+	}
+	if err := ts.checkProjectLocked(ctx, task.ProjectID, PermissionEdit); err != nil {
+		return nil, true, err
+	}
+	if task.Status == "completed" {
+		return nil, true, ErrTaskCompleted
+	}
+
+	prev := *task
+	task.DueDate = newDue
+	task.SnoozeCount++
+	task.UpdatedAt = ts.now()
+	if err := ts.save(ctx, id); err != nil {
+		*task = prev
+		return nil, true, fmt.Errorf("save tasks: %w", err)
+	}
+	ts.recordChange(ctx, ChangeUpdated, task)
+	ts.recordMutation(ctx, AuditUpdate, auditTask, id, &prev, task)
+	return task, true, nil
+}
+
+// snoozeDurationPattern matches snooze durations such as "1d" or "2w"
+var snoozeDurationPattern = regexp.MustCompile(`^([1-9][0-9]{0,3})([dw])$`)
+
+// snoozeRequest is the body accepted by the snooze endpoint; exactly one
+// field must be set
+type snoozeRequest struct {
+	Duration string `json:"duration"`
+	Until    string `json:"until"`
+}
+
+// newDueDate returns the due date the request asks for, with days in
+// now's location. A duration is added to the current due date, or to the
+// end of today when the task has none.
+func (req *snoozeRequest) newDueDate(task *Task, now time.Time) (DueTime, error) {
+	switch {
+	case req.Duration != "" && req.Until != "":
+		return DueTime{}, &validationError{ErrCodeValidation, "Send either duration or until, not both"}
+	case req.Until != "":
+		until, err := parseDueDate(req.Until, now.Location())
+		if err != nil {
+			return DueTime{}, &validationError{ErrCodeValidation, "until must be a date (YYYY-MM-DD) or an RFC 3339 time"}
+		}
+		if !task.DueDate.IsZero() && !until.After(task.DueDate.Time) {
+			return DueTime{}, &validationError{ErrCodeValidation, "until must be after the current due date"}
+		}
+		return until, nil
+	case req.Duration != "":
+		match := snoozeDurationPattern.FindStringSubmatch(req.Duration)
+		if match == nil {
+			return DueTime{}, &validationError{ErrCodeValidation, `duration must look like "1d" or "2w"`}
+		}
+		days, _ := strconv.Atoi(match[1])
+		if match[2] == "w" {
+			days *= 7
+		}
+		base := dueAtEndOfDay(now, now.Location()).Time
+		if !task.DueDate.IsZero() {
+			base = task.DueDate.In(now.Location())
+		}
+		return DueTime{base.AddDate(0, 0, days)}, nil
+	}
+	return DueTime{}, &validationError{ErrCodeValidation, "duration or until is required"}
+}
+
+// handleSnoozeTask pushes a task's due date forward
+func (s *Server) handleSnoozeTask(w http.ResponseWriter, r *http.Request) {
+	id, err := s.parseTaskID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidTaskID, "Invalid task ID")
+		return
+	}
+
+	var req snoozeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON")
+		return
+	}
+
+	task, exists := s.store.Get(id)
+	if !exists {
+		writeError(w, http.StatusNotFound, ErrCodeTaskNotFound, "Task not found")
+		return
+	}
+	newDue, err := req.newDueDate(task, s.now().In(s.requestLocation(r)))
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	task, exists, err = s.store.Snooze(r.Context(), id, newDue)
+	if errors.Is(err, ErrTaskCompleted) {
+		writeError(w, http.StatusConflict, ErrCodeTaskCompleted, "Completed tasks can't be snoozed")
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if !exists {
+		writeError(w, http.StatusNotFound, ErrCodeTaskNotFound, "Task not found")
+		return
+	}
+	taskOps.Add("snooze", 1)
+
+	writeJSON(w, http.StatusOK, s.presentTask(task))
+}
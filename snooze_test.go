@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// snooze calls the snooze handler for task id with body
+func snooze(server *Server, id, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/api/v1/tasks/"+id+"/snooze", bytes.NewBufferString(body))
+	req = mux.SetURLVars(req, map[string]string{"id": id})
+	w := httptest.NewRecorder()
+	server.handleSnoozeTask(w, req)
+	return w
+}
+
+func TestSnoozeTask(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.location = time.UTC
+	server.now = func() time.Time { return time.Date(2024, 1, 5, 9, 0, 0, 0, time.UTC) }
+
+	ctx := context.Background()
+	server.store.Add(ctx, "Dated", "", dueIn("2024-01-08", time.UTC), "medium")
+	server.store.Add(ctx, "Undated", "", DueTime{}, "medium")
+
+	tests := []struct {
+		name, id, body string
+		wantDue        string
+		wantCount      int
+	}{
+		{"duration from due date", "1", `{"duration":"1d"}`, "2024-01-09", 1},
+		{"weeks", "1", `{"duration":"2w"}`, "2024-01-23", 2},
+		{"absolute date", "1", `{"until":"2024-02-01"}`, "2024-02-01", 3},
+		{"duration from today", "2", `{"duration":"3d"}`, "2024-01-08", 1},
+	}
+	for _, tt := range tests {
+		w := snooze(server, tt.id, tt.body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d; want %d (%s)", tt.name, w.Code, http.StatusOK, w.Body.String())
+		}
+		var task Task
+		if err := json.NewDecoder(w.Body).Decode(&task); err != nil {
+			t.Fatalf("%s: decode response: %v", tt.name, err)
+		}
+		if task.DueDate.Day(time.UTC) != tt.wantDue || task.SnoozeCount != tt.wantCount {
+			t.Errorf("%s: due = %s, snooze_count = %d; want %s, %d", tt.name, task.DueDate, task.SnoozeCount, tt.wantDue, tt.wantCount)
+		}
+	}
+}
+
+func TestSnoozeRejectsInvalidRequests(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	ctx := context.Background()
+	server.store.Add(ctx, "Open", "", dueOn("2024-01-08"), "medium")
+	done, _ := server.store.Add(ctx, "Done", "", dueOn("2024-01-08"), "medium")
+	server.store.Update(ctx, done.ID, done.Title, "", done.DueDate, done.Priority, "completed")
+
+	tests := []struct {
+		name, id, body string
+		wantStatus     int
+	}{
+		{"completed task", "2", `{"duration":"1d"}`, http.StatusConflict},
+		{"missing task", "9", `{"duration":"1d"}`, http.StatusNotFound},
+		{"malformed JSON", "1", `{`, http.StatusBadRequest},
+		{"empty body", "1", `{}`, http.StatusUnprocessableEntity},
+		{"both fields", "1", `{"duration":"1d","until":"2024-02-01"}`, http.StatusUnprocessableEntity},
+		{"bad duration", "1", `{"duration":"1y"}`, http.StatusUnprocessableEntity},
+		{"until not later", "1", `{"until":"2024-01-07"}`, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		if w := snooze(server, tt.id, tt.body); w.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d; want %d", tt.name, w.Code, tt.wantStatus)
+		}
+	}
+}
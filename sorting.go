@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// taskSortFields maps the sort names accepted by the list endpoints to a
+// comparison returning a negative number when a sorts before b ascending
+var taskSortFields = map[string]func(a, b *Task) int{
+	"id":       func(a, b *Task) int { return a.ID - b.ID },
+	"title":    func(a, b *Task) int { return strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title)) },
+	"due_date": compareDueDates,
+	// priority depends on the store's priority levels; see taskComparison
+	"priority": nil,
+	"status":   func(a, b *Task) int { return strings.Compare(a.Status, b.Status) },
+	"created_at": func(a, b *Task) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	},
+	"updated_at": func(a, b *Task) int {
+		return a.UpdatedAt.Compare(b.UpdatedAt)
+	},
+}
+
+// taskComparison returns the comparison for sort field, which must have
+// passed validateSort, weighing priorities by priorities
+func taskComparison(field string, priorities priorityRanking) func(a, b *Task) int {
+	if field == "" {
+		field = "id"
+	}
+	if field == "priority" {
+		return func(a, b *Task) int { return priorities[a.Priority] - priorities[b.Priority] }
+	}
+	return taskSortFields[field]
+}
+
+// compareDueDates compares due dates; tasks without one sort after all
+// dated tasks
+func compareDueDates(a, b *Task) int {
+	switch {
+	case a.DueDate.Equal(b.DueDate):
+		return 0
+	case a.DueDate.IsZero():
+		return 1
+	case b.DueDate.IsZero():
+		return -1
+	}
+	return a.DueDate.Compare(b.DueDate.Time)
+}
+
+// validateSort reports whether field and order name a supported ordering.
+// Empty values are allowed and mean id and asc.
+func validateSort(field, order string) error {
+	if _, ok := taskSortFields[field]; field != "" && !ok {
+		return fmt.Errorf("unknown sort field %q", field)
+	}
+	if order != "" && order != "asc" && order != "desc" {
+		return fmt.Errorf("unknown sort order %q (want asc or desc)", order)
+	}
+	return nil
+}
+
+// sortTasks orders tasks in place by field and order, which must have
+// passed validateSort, weighing priorities by priorities. Ties keep their
+// existing relative order.
+func sortTasks(tasks []*Task, field, order string, priorities priorityRanking) {
+	compare := taskComparison(field, priorities)
+	desc := order == "desc"
+	sort.SliceStable(tasks, func(i, j int) bool {
+		if desc {
+			return compare(tasks[i], tasks[j]) > 0
+		}
+		return compare(tasks[i], tasks[j]) < 0
+	})
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestListSortDefaultAndOverride(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	ctx := context.Background()
+	server.store.Add(ctx, "Later", "", dueOn("2024-03-01"), "low")
+	server.store.Add(ctx, "Undated", "", DueTime{}, "high")
+	server.store.Add(ctx, "Sooner", "", dueOn("2024-01-15"), "medium")
+	server.config.DefaultSort = "due_date"
+	server.config.DefaultOrder = "asc"
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"Sooner", "Later", "Undated"}},
+		{"?order=desc", []string{"Undated", "Later", "Sooner"}},
+		{"?sort=priority&order=desc", []string{"Undated", "Sooner", "Later"}},
+		{"?sort=id", []string{"Later", "Undated", "Sooner"}},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		server.handleGetTasks(w, httptest.NewRequest("GET", "/api/v1/tasks"+tt.query, nil))
+
+		var tasks []Task
+		if err := json.NewDecoder(w.Body).Decode(&tasks); err != nil {
+			t.Fatalf("%q: decode response: %v", tt.query, err)
+		}
+		var got []string
+		for _, task := range tasks {
+			got = append(got, task.Title)
+		}
+		if len(got) != len(tt.want) {
+			t.Fatalf("%q: got %v; want %v", tt.query, got, tt.want)
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%q: got %v; want %v", tt.query, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestListSortRejectsUnknownValues(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	for _, query := range []string{"?sort=color", "?order=sideways"} {
+		w := httptest.NewRecorder()
+		server.handleGetTasks(w, httptest.NewRequest("GET", "/api/v1/tasks"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%q: status = %d; want %d", query, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestValidateSort(t *testing.T) {
+	tests := []struct {
+		field, order string
+		wantErr      bool
+	}{
+		{"", "", false},
+		{"due_date", "asc", false},
+		{"title", "desc", false},
+		{"color", "", true},
+		{"", "up", true},
+	}
+	for _, tt := range tests {
+		if err := validateSort(tt.field, tt.order); (err != nil) != tt.wantErr {
+			t.Errorf("validateSort(%q, %q) error = %v; wantErr %v", tt.field, tt.order, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+)
+
+// defaultSQLitePath is the database file used when storage is "sqlite" and
+// sqlite_path is unset
+const defaultSQLitePath = "tasks.db"
+
+func init() {
+	RegisterBackend("sqlite", func(config *Config) (Storage, error) {
+		path := config.SQLitePath
+		if path == "" {
+			path = defaultSQLitePath
+		}
+		return openSQLiteBackend(dataPath(path))
+	})
+}
+
+// sqliteBackend stores one row per task, so a mutation only writes the
+// rows it touched. Each row holds the task as JSON, which keeps new Task
+// fields from needing a schema change.
+type sqliteBackend struct {
+	sqliteTasks
+	db *sql.DB
+}
+
+// openSQLiteBackend opens or creates the database at path
+func openSQLiteBackend(path string) (*sqliteBackend, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	// SQLite allows a single writer; one connection avoids lock errors
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS tasks (
+		id   INTEGER PRIMARY KEY,
+		data TEXT NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS projects (
+		id   INTEGER PRIMARY KEY,
+		data TEXT NOT NULL
+	);
+	CREATE TABLE IF NOT EXISTS task_revisions (
+		task_id  INTEGER NOT NULL,
+		revision INTEGER NOT NULL,
+		data     TEXT NOT NULL,
+		PRIMARY KEY (task_id, revision)
+	);
+	CREATE TABLE IF NOT EXISTS task_comments (
+		id      INTEGER PRIMARY KEY,
+		task_id INTEGER NOT NULL,
+		data    TEXT NOT NULL
+	)`); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("create schema in %s: %w", path, err)
+	}
+	return &sqliteBackend{sqliteTasks: sqliteTasks{conn: db}, db: db}, nil
+}
+
+// sqliteTasks reads and writes task rows through conn, the database or a
+// transaction inside Atomically
+type sqliteTasks struct {
+	conn sqlConn
+}
+
+// Add inserts the task's row
+func (t sqliteTasks) Add(ctx context.Context, task *Task) error {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	_, err = t.conn.ExecContext(ctx, `INSERT INTO tasks (id, data) VALUES (?, ?)`, task.ID, string(data))
+	return err
+}
+
+// Get reads one task row
+func (t sqliteTasks) Get(ctx context.Context, id int) (*Task, error) {
+	var data []byte
+	err := t.conn.QueryRowContext(ctx, `SELECT data FROM tasks WHERE id = ?`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrTaskNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseTaskRow(data)
+}
+
+// List reads every task row
+func (t sqliteTasks) List(ctx context.Context) ([]*Task, error) {
+	return t.Query(ctx, StorageQuery{})
+}
+
+// Update rewrites the task's row if it still holds the previous version
+func (t sqliteTasks) Update(ctx context.Context, task *Task) error {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	result, err := t.conn.ExecContext(ctx, `UPDATE tasks SET data = ?
+		WHERE id = ? AND COALESCE(json_extract(data, '$.version'), 0) = ?`, string(data), task.ID, task.Version-1)
+	if err != nil {
+		return err
+	}
+	return checkUpdated(result)
+}
+
+// Delete removes the task's row
+func (t sqliteTasks) Delete(ctx context.Context, id int) error {
+	_, err := t.conn.ExecContext(ctx, `DELETE FROM tasks WHERE id = ?`, id)
+	return err
+}
+
+// Query reads the task rows matching q, filtering on the stored JSON
+func (t sqliteTasks) Query(ctx context.Context, q StorageQuery) ([]*Task, error) {
+	var where []string
+	var args []interface{}
+	switch q.State {
+	case "":
+	case TaskLive:
+		where = append(where, `json_extract(data, '$.deleted_at') IS NULL AND json_extract(data, '$.archived_at') IS NULL`)
+	case TaskTrashed:
+		where = append(where, `json_extract(data, '$.deleted_at') IS NOT NULL`)
+	case TaskArchived:
+		where = append(where, `json_extract(data, '$.deleted_at') IS NULL AND json_extract(data, '$.archived_at') IS NOT NULL`)
+	default:
+		return nil, fmt.Errorf("unknown task state %q", q.State)
+	}
+	if len(q.Statuses) > 0 {
+		where = append(where, `json_extract(data, '$.status') IN (?`+strings.Repeat(", ?", len(q.Statuses)-1)+`)`)
+		for _, status := range q.Statuses {
+			args = append(args, status)
+		}
+	}
+	if q.ProjectID != 0 {
+		where = append(where, `json_extract(data, '$.project_id') = ?`)
+		args = append(args, q.ProjectID)
+	}
+
+	query := `SELECT data FROM tasks`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, ` AND `)
+	}
+	rows, err := t.conn.QueryContext(ctx, query+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanTaskRows(rows)
+}
+
+// Atomically runs fn in a transaction
+func (b *sqliteBackend) Atomically(ctx context.Context, fn func(w TaskWriter) error) error {
+	tx, err := b.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := fn(sqliteTasks{conn: tx}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// LoadProjects reads every project row
+func (b *sqliteBackend) LoadProjects() ([]*Project, error) {
+	rows, err := b.db.Query(`SELECT data FROM projects ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var projects []*Project
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var project Project
+		if err := json.Unmarshal([]byte(data), &project); err != nil {
+			return nil, fmt.Errorf("parse project row: %w", err)
+		}
+		projects = append(projects, &project)
+	}
+	return projects, rows.Err()
+}
+
+// SaveProjects writes the rows of the changed projects in one transaction
+func (b *sqliteBackend) SaveProjects(projects map[int]*Project, changed []int) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, id := range changed {
+		project, exists := projects[id]
+		if !exists {
+			if _, err := tx.Exec(`DELETE FROM projects WHERE id = ?`, id); err != nil {
+				return err
+			}
+			continue
+		}
+		data, err := json.Marshal(project)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`INSERT INTO projects (id, data) VALUES (?, ?)
+			ON CONFLICT (id) DO UPDATE SET data = excluded.data`, id, string(data)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// LoadHistory reads every revision row
+func (b *sqliteBackend) LoadHistory() ([]*TaskRevision, error) {
+	rows, err := b.db.Query(`SELECT data FROM task_revisions ORDER BY task_id, revision`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []*TaskRevision
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var rev TaskRevision
+		if err := json.Unmarshal([]byte(data), &rev); err != nil {
+			return nil, fmt.Errorf("parse revision row: %w", err)
+		}
+		revisions = append(revisions, &rev)
+	}
+	return revisions, rows.Err()
+}
+
+// SaveHistory replaces the revision rows of the changed tasks in one
+// transaction
+func (b *sqliteBackend) SaveHistory(history map[int][]*TaskRevision, changed []int) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, id := range changed {
+		if _, err := tx.Exec(`DELETE FROM task_revisions WHERE task_id = ?`, id); err != nil {
+			return err
+		}
+		for _, rev := range history[id] {
+			data, err := json.Marshal(rev)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(`INSERT INTO task_revisions (task_id, revision, data) VALUES (?, ?, ?)`, id, rev.Revision, string(data)); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// LoadComments reads every comment row
+func (b *sqliteBackend) LoadComments() ([]*Comment, error) {
+	rows, err := b.db.Query(`SELECT data FROM task_comments ORDER BY task_id, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []*Comment
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var comment Comment
+		if err := json.Unmarshal([]byte(data), &comment); err != nil {
+			return nil, fmt.Errorf("parse comment row: %w", err)
+		}
+		comments = append(comments, &comment)
+	}
+	return comments, rows.Err()
+}
+
+// SaveComments replaces the comment rows of the changed tasks in one
+// transaction
+func (b *sqliteBackend) SaveComments(comments map[int][]*Comment, changed []int) error {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, id := range changed {
+		if _, err := tx.Exec(`DELETE FROM task_comments WHERE task_id = ?`, id); err != nil {
+			return err
+		}
+		for _, comment := range comments[id] {
+			data, err := json.Marshal(comment)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(`INSERT INTO task_comments (id, task_id, data) VALUES (?, ?, ?)`, comment.ID, id, string(data)); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// Ping checks the database connection
+func (b *sqliteBackend) Ping(ctx context.Context) error {
+	return b.db.PingContext(ctx)
+}
+
+// Close closes the database
+func (b *sqliteBackend) Close() error {
+	return b.db.Close()
+}
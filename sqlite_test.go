@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// openTestSQLiteStore opens a SQLite-backed store in a temporary directory
+func openTestSQLiteStore(t *testing.T, path string) (*TaskStore, *sqliteBackend) {
+	t.Helper()
+	backend, err := openSQLiteBackend(path)
+	if err != nil {
+		t.Fatalf("openSQLiteBackend() error = %v", err)
+	}
+	t.Cleanup(func() { backend.Close() })
+	store, err := NewTaskStoreWithStorage(backend)
+	if err != nil {
+		t.Fatalf("NewTaskStoreWithStorage() error = %v", err)
+	}
+	return store, backend
+}
+
+func TestSQLiteBackendPersistsChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.db")
+	ctx := context.Background()
+
+	store, backend := openTestSQLiteStore(t, path)
+	first, _ := store.Add(ctx, "First", "Keep me", dueOn("2024-12-31"), "high")
+	second, _ := store.Add(ctx, "Second", "", DueTime{}, "low")
+	store.Add(ctx, "Third", "", DueTime{}, "medium")
+	if _, _, err := store.Update(ctx, first.ID, "First", "Keep me", dueOn("2024-12-31"), "high", "completed"); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if _, err := store.Delete(ctx, second.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	backend.Close()
+
+	reopened, _ := openTestSQLiteStore(t, path)
+	tasks := reopened.GetAll()
+	if len(tasks) != 2 || tasks[0].Title != "First" || tasks[1].Title != "Third" {
+		t.Fatalf("tasks after reopen = %+v; want First and Third", tasks)
+	}
+	if tasks[0].Status != "completed" || tasks[0].CompletedAt == nil || tasks[0].Description != "Keep me" {
+		t.Errorf("first task = %+v; want completed with description", tasks[0])
+	}
+
+	// IDs continue after the highest stored one
+	task, err := reopened.Add(ctx, "Fourth", "", DueTime{}, "medium")
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if task.ID != 4 {
+		t.Errorf("ID after reopen = %d; want 4", task.ID)
+	}
+}
+
+func TestSQLiteBackendReplaceAndRetention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.db")
+	ctx := context.Background()
+
+	store, backend := openTestSQLiteStore(t, path)
+	store.Add(ctx, "Old", "", DueTime{}, "medium")
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	imported := []*Task{
+		{ID: 7, Title: "Imported", Status: "pending", CreatedAt: now, UpdatedAt: now},
+		{ID: 9, Title: "Done", Status: "completed", CreatedAt: now, UpdatedAt: now, CompletedAt: &now},
+	}
+	if err := store.Replace(ctx, imported); err != nil {
+		t.Fatalf("Replace() error = %v", err)
+	}
+	if n, err := store.DeleteCompletedBefore(ctx, now.Add(time.Hour)); err != nil || n != 1 {
+		t.Fatalf("DeleteCompletedBefore() = %d, %v; want 1, nil", n, err)
+	}
+	backend.Close()
+
+	reopened, _ := openTestSQLiteStore(t, path)
+	tasks := reopened.GetAll()
+	if len(tasks) != 1 || tasks[0].ID != 7 {
+		t.Errorf("tasks after reopen = %+v; want only task 7", tasks)
+	}
+}
+
+func TestOpenStoreRejectsUnknownStorage(t *testing.T) {
+	if _, err := OpenStore(&Config{Storage: "floppy"}, "test_tasks.json"); err == nil {
+		t.Error("OpenStore() error = nil; want error for unknown storage")
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"os"
+)
+
+// embeddedStatic holds the web UI, so the binary serves it from any
+// working directory
+//
+//go:embed static
+var embeddedStatic embed.FS
+
+// staticFiles returns the web UI files: those embedded in the binary, or
+// with dir set, the files in dir on disk, so edits show up on reload
+// without a rebuild
+func staticFiles(dir string) fs.FS {
+	if dir != "" {
+		return os.DirFS(dir)
+	}
+	files, err := fs.Sub(embeddedStatic, "static")
+	if err != nil {
+		// Only possible if the embed pattern above changes
+		panic(err)
+	}
+	return files
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStaticFiles(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	get := func(path string) *httptest.ResponseRecorder {
+		r, err := server.Router()
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	// The embedded copy is served whatever the working directory holds
+	index, err := os.ReadFile(filepath.Join("static", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := get("/"); w.Code != http.StatusOK || w.Body.String() != string(index) {
+		t.Errorf("GET /: status %d; want the embedded index.html", w.Code)
+	}
+	if w := get("/static/missing.js"); w.Code != http.StatusNotFound {
+		t.Errorf("GET /static/missing.js: status %d; want 404", w.Code)
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte("<p>dev</p>"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "app.js"), []byte("console.log('dev')"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	server.static = staticFiles(dir)
+	if w := get("/"); w.Body.String() != "<p>dev</p>" {
+		t.Errorf("GET / from disk = %q; want the file in the static dir", w.Body.String())
+	}
+	if w := get("/static/app.js"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "dev") {
+		t.Errorf("GET /static/app.js from disk: status %d: %s", w.Code, w.Body.String())
+	}
+}
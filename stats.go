@@ -0,0 +1,399 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// StreakStats describes runs of consecutive days with at least one completed task
+type StreakStats struct {
+	Current       int        `json:"current"`
+	Longest       int        `json:"longest"`
+	LastCompleted *time.Time `json:"last_completed"`
+}
+
+// CompletionStreak computes the current and longest completion streaks,
+// archived tasks included. Day boundaries are taken from now's location.
+// The current streak stays alive until the end of the day after the last
+// completion, so a streak isn't reported as broken before the user had a
+// chance to extend it today.
+func (ts *TaskStore) CompletionStreak(now time.Time) StreakStats {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	loc := now.Location()
+	days := make(map[time.Time]bool)
+	var stats StreakStats
+	for _, partition := range []map[int]*Task{ts.tasks, ts.archive} {
+		for _, task := range partition {
+			if task.Status != "completed" || task.CompletedAt == nil {
+				continue
+			}
+			days[startOfDay(task.CompletedAt.In(loc))] = true
+			if stats.LastCompleted == nil || task.CompletedAt.After(*stats.LastCompleted) {
+				completed := *task.CompletedAt
+				stats.LastCompleted = &completed
+			}
+		}
+	}
+
+	for day := range days {
+		// Only start counting at the first day of each run
+		if days[day.AddDate(0, 0, -1)] {
+			continue
+		}
+		length := 1
+		for days[day.AddDate(0, 0, length)] {
+			length++
+		}
+		if length > stats.Longest {
+			stats.Longest = length
+		}
+	}
+
+	today := startOfDay(now)
+	day := today
+	if !days[day] {
+		day = today.AddDate(0, 0, -1)
+	}
+	for days[day] {
+		stats.Current++
+		day = day.AddDate(0, 0, -1)
+	}
+
+	return stats
+}
+
+// startOfDay truncates t to midnight in t's location
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+// handleGetStreak returns the completion streak in the configured time zone
+func (s *Server) handleGetStreak(w http.ResponseWriter, r *http.Request) {
+	stats := s.store.CompletionStreak(s.now().In(s.location))
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// TaskStats summarizes the task collection
+type TaskStats struct {
+	Total         int            `json:"total"`
+	ByStatus      map[string]int `json:"by_status"`
+	ByPriority    map[string]int `json:"by_priority"`
+	ByTag         map[string]int `json:"by_tag"`
+	CompletedLate int            `json:"completed_late"`
+	Quota         QuotaUsage     `json:"quota"`
+	Activity      ActivityStats  `json:"activity"`
+}
+
+// ActivityStats describes the tasks created and completed in a period,
+// archived ones included
+type ActivityStats struct {
+	// From and To are the first and last day of the period, YYYY-MM-DD
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Interval  string `json:"interval"`
+	Created   int    `json:"created"`
+	Completed int    `json:"completed"`
+	// CompletionRate is the share of the tasks created in the period that
+	// are completed, from 0 to 1
+	CompletionRate float64 `json:"completion_rate"`
+	// AverageCompletionHours is the mean time from creation to completion
+	// of the tasks completed in the period; 0 when there are none
+	AverageCompletionHours float64 `json:"average_completion_hours"`
+	// Buckets split the period by Interval, oldest first
+	Buckets []ActivityBucket `json:"buckets"`
+}
+
+// ActivityBucket counts the tasks created and completed in a day or week
+type ActivityBucket struct {
+	// Start is the bucket's first day, YYYY-MM-DD; weeks start on Monday
+	Start     string `json:"start"`
+	Created   int    `json:"created"`
+	Completed int    `json:"completed"`
+}
+
+// StatsPeriod is the range of whole days in a time zone that activity
+// statistics cover
+type StatsPeriod struct {
+	// From is the start of the first day and To the start of the day
+	// after the last
+	From, To time.Time
+	// Interval is "day" or "week"
+	Interval string
+}
+
+// maxStatsBuckets bounds the buckets a stats request can ask for
+const maxStatsBuckets = 366
+
+// parseStatsPeriod reads ?from=, ?to= (YYYY-MM-DD days in loc, both
+// included) and ?interval= (day or week). Without them the period is the
+// 30 days up to and including now's day, by day.
+func parseStatsPeriod(query url.Values, now time.Time, loc *time.Location) (StatsPeriod, error) {
+	period := StatsPeriod{Interval: query.Get("interval")}
+	if period.Interval == "" {
+		period.Interval = "day"
+	}
+	if period.Interval != "day" && period.Interval != "week" {
+		return StatsPeriod{}, errors.New("interval must be day or week")
+	}
+	var err error
+	if period.From, period.To, err = parseDayRange(query, now, loc, 30); err != nil {
+		return StatsPeriod{}, err
+	}
+	if buckets := len(period.bucketStarts()); buckets > maxStatsBuckets {
+		return StatsPeriod{}, fmt.Errorf("the period has %d %ss; at most %d are allowed", buckets, period.Interval, maxStatsBuckets)
+	}
+	return period, nil
+}
+
+// parseDayRange reads ?from= and ?to=, YYYY-MM-DD days in loc that are
+// both included, returning the start of the first day and of the day after
+// the last. Without them the range is the given number of days up to and
+// including now's day.
+func parseDayRange(query url.Values, now time.Time, loc *time.Location, days int) (from, to time.Time, err error) {
+	last := startOfDay(now.In(loc))
+	if raw := query.Get("to"); raw != "" {
+		if last, err = time.ParseInLocation(dueDateLayout, raw, loc); err != nil {
+			return time.Time{}, time.Time{}, errors.New("to must be a date in YYYY-MM-DD format")
+		}
+	}
+	first := last.AddDate(0, 0, 1-days)
+	if raw := query.Get("from"); raw != "" {
+		if first, err = time.ParseInLocation(dueDateLayout, raw, loc); err != nil {
+			return time.Time{}, time.Time{}, errors.New("from must be a date in YYYY-MM-DD format")
+		}
+	}
+	if first.After(last) {
+		return time.Time{}, time.Time{}, errors.New("from must not be after to")
+	}
+	return first, last.AddDate(0, 0, 1), nil
+}
+
+// bucketStart returns the start of the bucket holding t
+func (p StatsPeriod) bucketStart(t time.Time) time.Time {
+	day := startOfDay(t.In(p.From.Location()))
+	if p.Interval == "week" {
+		// Weeks start on Monday
+		day = day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	}
+	return day
+}
+
+// bucketStarts returns the starts of the buckets covering the period; the
+// first week may start before From
+func (p StatsPeriod) bucketStarts() []time.Time {
+	step := 1
+	if p.Interval == "week" {
+		step = 7
+	}
+	var starts []time.Time
+	for start := p.bucketStart(p.From); start.Before(p.To); start = start.AddDate(0, 0, step) {
+		starts = append(starts, start)
+		if len(starts) > maxStatsBuckets {
+			break
+		}
+	}
+	return starts
+}
+
+// contains reports whether t falls within the period
+func (p StatsPeriod) contains(t time.Time) bool {
+	return !t.Before(p.From) && t.Before(p.To)
+}
+
+// Stats counts tasks by status, priority and tag (ignoring case), along
+// with completed tasks that were finished after their due date and the
+// weighted quota usage, and describes the activity in period
+func (ts *TaskStore) Stats(period StatsPeriod) TaskStats {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	stats := TaskStats{
+		ByStatus:   make(map[string]int),
+		ByPriority: make(map[string]int),
+		ByTag:      make(map[string]int),
+		Quota:      QuotaUsage{Used: ts.quotaUsedLocked(), Limit: ts.quota.limit},
+	}
+	for _, task := range ts.tasks {
+		stats.Total++
+		stats.ByStatus[task.Status]++
+		stats.ByPriority[task.Priority]++
+		for _, tag := range task.Tags {
+			stats.ByTag[tagKey(tag)]++
+		}
+		if completedLate(task) {
+			stats.CompletedLate++
+		}
+	}
+	stats.Activity = ts.activityLocked(period)
+	return stats
+}
+
+// activityLocked counts the live and archived tasks created and completed
+// in period. The caller must hold the read lock.
+func (ts *TaskStore) activityLocked(period StatsPeriod) ActivityStats {
+	activity := ActivityStats{
+		From:     period.From.Format(dueDateLayout),
+		To:       period.To.AddDate(0, 0, -1).Format(dueDateLayout),
+		Interval: period.Interval,
+		Buckets:  []ActivityBucket{},
+	}
+	index := make(map[string]int)
+	for _, start := range period.bucketStarts() {
+		index[start.Format(dueDateLayout)] = len(activity.Buckets)
+		activity.Buckets = append(activity.Buckets, ActivityBucket{Start: start.Format(dueDateLayout)})
+	}
+	bucket := func(t time.Time) *ActivityBucket {
+		return &activity.Buckets[index[period.bucketStart(t).Format(dueDateLayout)]]
+	}
+
+	var createdCompleted int
+	var completionTime time.Duration
+	count := func(task *Task) {
+		completed := task.Status == "completed" && task.CompletedAt != nil
+		if period.contains(task.CreatedAt) {
+			activity.Created++
+			bucket(task.CreatedAt).Created++
+			if completed {
+				createdCompleted++
+			}
+		}
+		if completed && period.contains(*task.CompletedAt) {
+			activity.Completed++
+			bucket(*task.CompletedAt).Completed++
+			completionTime += task.CompletedAt.Sub(task.CreatedAt)
+		}
+	}
+	for _, task := range ts.tasks {
+		count(task)
+	}
+	for _, task := range ts.archive {
+		count(task)
+	}
+	if activity.Created > 0 {
+		activity.CompletionRate = float64(createdCompleted) / float64(activity.Created)
+	}
+	if activity.Completed > 0 {
+		activity.AverageCompletionHours = completionTime.Hours() / float64(activity.Completed)
+	}
+	return activity
+}
+
+// completedLate reports whether task was completed after its due date.
+// Tasks without a due date are never late.
+func completedLate(task *Task) bool {
+	if task.Status != "completed" || task.CompletedAt == nil || task.DueDate.IsZero() {
+		return false
+	}
+	return task.CompletedAt.After(task.DueDate.Time)
+}
+
+// GroupStats holds task counts for one value of a grouping dimension
+type GroupStats struct {
+	Key       string `json:"key"`
+	Total     int    `json:"total"`
+	Pending   int    `json:"pending"`
+	Completed int    `json:"completed"`
+	Overdue   int    `json:"overdue"`
+}
+
+// statsDimensions maps each supported ?group_by= value to the keys a task
+// is counted under
+var statsDimensions = map[string]func(*Task) []string{
+	"assignee": func(t *Task) []string {
+		if t.Assignee == "" {
+			return nil
+		}
+		return []string{t.Assignee}
+	},
+	"priority": func(t *Task) []string { return []string{t.Priority} },
+	"status":   func(t *Task) []string { return []string{t.Status} },
+	"tag": func(t *Task) []string {
+		keys := make([]string, len(t.Tags))
+		for i, tag := range t.Tags {
+			keys[i] = tagKey(tag)
+		}
+		return keys
+	},
+}
+
+// StatsGrouped counts tasks per value of dimension, sorted by total
+// descending (then key) so the order is stable. Tasks are overdue as of
+// now. ok is false for an unknown dimension.
+func (ts *TaskStore) StatsGrouped(dimension string, now time.Time) (groups []GroupStats, ok bool) {
+	keysOf, ok := statsDimensions[dimension]
+	if !ok {
+		return nil, false
+	}
+
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	byKey := make(map[string]*GroupStats)
+	for _, task := range ts.tasks {
+		for _, key := range keysOf(task) {
+			group, exists := byKey[key]
+			if !exists {
+				group = &GroupStats{Key: key}
+				byKey[key] = group
+			}
+			group.Total++
+			switch task.Status {
+			case "pending":
+				group.Pending++
+			case "completed":
+				group.Completed++
+			}
+			if isOverdue(task, now) {
+				group.Overdue++
+			}
+		}
+	}
+
+	groups = make([]GroupStats, 0, len(byKey))
+	for _, group := range byKey {
+		groups = append(groups, *group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Total != groups[j].Total {
+			return groups[i].Total > groups[j].Total
+		}
+		return groups[i].Key < groups[j].Key
+	})
+	return groups, true
+}
+
+// isOverdue reports whether an open task's due date passed before now
+func isOverdue(task *Task, now time.Time) bool {
+	if task.Status == "completed" || task.DueDate.IsZero() {
+		return false
+	}
+	return now.After(task.DueDate.Time)
+}
+
+// handleGetStats returns task counts for the whole collection and its
+// activity over ?from= to ?to= in the request's time zone, or counts per
+// group with ?group_by=
+func (s *Server) handleGetStats(w http.ResponseWriter, r *http.Request) {
+	if dimension := r.URL.Query().Get("group_by"); dimension != "" {
+		groups, ok := s.store.StatsGrouped(dimension, s.now())
+		if !ok {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidQuery, "Invalid group_by")
+			return
+		}
+		writeJSON(w, http.StatusOK, groups)
+		return
+	}
+	period, err := parseStatsPeriod(r.URL.Query(), s.now(), s.requestLocation(r))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidQuery, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, s.store.Stats(period))
+}
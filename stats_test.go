@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// completeAt adds a task and marks it completed at the given time
+func completeAt(t *testing.T, store *TaskStore, at time.Time) {
+	t.Helper()
+	ctx := context.Background()
+	store.now = func() time.Time { return at }
+	task, err := store.Add(ctx, "Task", "", DueTime{}, "medium")
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if _, _, err := store.Update(ctx, task.ID, task.Title, "", DueTime{}, "medium", "completed"); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+}
+
+func TestCompletionStreak(t *testing.T) {
+	tmpFile := "test_streak.json"
+	defer os.Remove(tmpFile)
+	defer os.Remove("test_streak_history.json")
+
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	day := func(d, hour int) time.Time {
+		return time.Date(2024, time.March, d, hour, 0, 0, 0, loc)
+	}
+
+	store := NewTaskStore(tmpFile)
+	// Run of 3 days (1-3), gap, then run of 2 days (5-6) with two completions on the 6th
+	completeAt(t, store, day(1, 9))
+	completeAt(t, store, day(2, 9))
+	completeAt(t, store, day(3, 23))
+	completeAt(t, store, day(5, 9))
+	completeAt(t, store, day(6, 8))
+	completeAt(t, store, day(6, 18))
+
+	tests := []struct {
+		name    string
+		now     time.Time
+		current int
+	}{
+		{"same day as last completion", day(6, 20), 2},
+		{"day after last completion", day(7, 12), 2},
+		{"streak broken", day(8, 12), 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats := store.CompletionStreak(tt.now)
+			if stats.Current != tt.current {
+				t.Errorf("Current = %d; want %d", stats.Current, tt.current)
+			}
+			if stats.Longest != 3 {
+				t.Errorf("Longest = %d; want 3", stats.Longest)
+			}
+			if stats.LastCompleted == nil || !stats.LastCompleted.Equal(day(6, 18)) {
+				t.Errorf("LastCompleted = %v; want %v", stats.LastCompleted, day(6, 18))
+			}
+		})
+	}
+}
+
+func TestCompletionStreakUsesLocationForDayBoundaries(t *testing.T) {
+	tmpFile := "test_streak_tz.json"
+	defer os.Remove(tmpFile)
+	defer os.Remove("test_streak_tz_history.json")
+
+	store := NewTaskStore(tmpFile)
+	// 23:30 and 00:30 UTC are different UTC days but the same day in UTC-5
+	completeAt(t, store, time.Date(2024, time.March, 1, 23, 30, 0, 0, time.UTC))
+	completeAt(t, store, time.Date(2024, time.March, 2, 0, 30, 0, 0, time.UTC))
+
+	now := time.Date(2024, time.March, 2, 12, 0, 0, 0, time.UTC)
+	if got := store.CompletionStreak(now).Current; got != 2 {
+		t.Errorf("UTC Current = %d; want 2", got)
+	}
+
+	est := time.FixedZone("UTC-5", -5*60*60)
+	if got := store.CompletionStreak(now.In(est)).Current; got != 1 {
+		t.Errorf("UTC-5 Current = %d; want 1", got)
+	}
+}
+
+func TestCompletionStreakCountsArchivedTasks(t *testing.T) {
+	tmpFile := "test_streak_archive.json"
+	defer os.Remove(tmpFile)
+	defer os.Remove("test_streak_archive_history.json")
+
+	day := func(d int) time.Time {
+		return time.Date(2024, time.March, d, 9, 0, 0, 0, time.UTC)
+	}
+	store := NewTaskStore(tmpFile)
+	completeAt(t, store, day(1))
+	completeAt(t, store, day(2))
+	completeAt(t, store, day(3))
+	for _, id := range []int{1, 3} {
+		if _, _, err := store.Archive(context.Background(), id); err != nil {
+			t.Fatalf("Archive(%d) error = %v", id, err)
+		}
+	}
+
+	stats := store.CompletionStreak(day(3))
+	if stats.Current != 3 || stats.Longest != 3 {
+		t.Errorf("CompletionStreak() = %+v; want current and longest 3", stats)
+	}
+	if stats.LastCompleted == nil || !stats.LastCompleted.Equal(day(3)) {
+		t.Errorf("LastCompleted = %v; want %v", stats.LastCompleted, day(3))
+	}
+}
+
+func TestCompletionStreakIgnoresReopenedTasks(t *testing.T) {
+	tmpFile := "test_streak_reopen.json"
+	defer os.Remove(tmpFile)
+	defer os.Remove("test_streak_reopen_history.json")
+
+	ctx := context.Background()
+	store := NewTaskStore(tmpFile)
+	completeAt(t, store, time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC))
+	if _, _, err := store.Update(ctx, 1, "Task", "", DueTime{}, "medium", "pending"); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	stats := store.CompletionStreak(time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC))
+	if stats.Current != 0 || stats.Longest != 0 || stats.LastCompleted != nil {
+		t.Errorf("CompletionStreak() = %+v; want zero value", stats)
+	}
+}
+
+func TestGetStreakEndpoint(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	now := time.Date(2024, time.March, 2, 12, 0, 0, 0, time.UTC)
+	server.location = time.UTC
+	server.now = func() time.Time { return now }
+	completeAt(t, server.store, now.AddDate(0, 0, -1))
+	completeAt(t, server.store, now)
+
+	w := httptest.NewRecorder()
+	server.handleGetStreak(w, httptest.NewRequest("GET", "/api/v1/stats/streak", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /stats/streak status = %d; want %d", w.Code, http.StatusOK)
+	}
+	var stats StreakStats
+	if err := json.NewDecoder(w.Body).Decode(&stats); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if stats.Current != 2 || stats.Longest != 2 {
+		t.Errorf("streak = %+v; want current 2, longest 2", stats)
+	}
+}
+
+func TestOverdueOnCompletion(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.location = time.UTC
+
+	ctx := context.Background()
+	server.store.Add(ctx, "On time", "", dueIn("2024-03-10", time.UTC), "medium")
+	server.store.Add(ctx, "Late", "", dueIn("2024-03-10", time.UTC), "medium")
+	server.store.Add(ctx, "No due date", "", DueTime{}, "medium")
+
+	complete := func(id int, at time.Time) map[string]interface{} {
+		t.Helper()
+		server.store.now = func() time.Time { return at }
+		task, _ := server.store.Get(id)
+		body := fmt.Sprintf(`{"title":%q,"due_date":%q,"priority":"medium","status":"completed"}`, task.Title, task.DueDate)
+		req := httptest.NewRequest("PUT", "/api/v1/tasks/"+strconv.Itoa(id), strings.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(id)})
+		w := httptest.NewRecorder()
+		server.handleUpdateTask(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("update status = %d; want %d", w.Code, http.StatusOK)
+		}
+		var resp map[string]interface{}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return resp
+	}
+
+	// Any time on the due date itself still counts as on time
+	if resp := complete(1, time.Date(2024, time.March, 10, 23, 59, 0, 0, time.UTC)); resp["overdue_on_completion"] != false {
+		t.Errorf("on-time overdue_on_completion = %v; want false", resp["overdue_on_completion"])
+	}
+	if resp := complete(2, time.Date(2024, time.March, 11, 0, 0, 0, 0, time.UTC)); resp["overdue_on_completion"] != true {
+		t.Errorf("late overdue_on_completion = %v; want true", resp["overdue_on_completion"])
+	}
+	if resp := complete(3, time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)); resp["overdue_on_completion"] != false {
+		t.Errorf("no-due-date overdue_on_completion = %v; want false", resp["overdue_on_completion"])
+	}
+
+	w := httptest.NewRecorder()
+	server.handleGetStats(w, httptest.NewRequest("GET", "/api/v1/stats", nil))
+	var stats TaskStats
+	if err := json.NewDecoder(w.Body).Decode(&stats); err != nil {
+		t.Fatalf("Failed to decode stats: %v", err)
+	}
+	if stats.CompletedLate != 1 || stats.Total != 3 || stats.ByStatus["completed"] != 3 {
+		t.Errorf("stats = %+v; want 3 completed, 1 late", stats)
+	}
+}
+
+func TestStatsGrouped(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	now := time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC)
+	server.location = time.UTC
+	server.now = func() time.Time { return now }
+	ctx := context.Background()
+	server.store.Add(ctx, "a", "", dueIn("2024-03-01", time.UTC), "high") // overdue
+	server.store.Add(ctx, "b", "", dueIn("2024-03-10", time.UTC), "high") // due today, not overdue
+	server.store.Add(ctx, "c", "", dueIn("2024-03-01", time.UTC), "low")
+	server.store.Add(ctx, "d", "", DueTime{}, "low")
+	server.store.Add(ctx, "e", "", DueTime{}, "medium")
+	server.store.Update(ctx, 3, "c", "", dueIn("2024-03-01", time.UTC), "low", "completed") // completed, not overdue
+
+	groups, ok := server.store.StatsGrouped("priority", now)
+	if !ok {
+		t.Fatal("StatsGrouped(priority) ok = false")
+	}
+	want := []GroupStats{
+		{Key: "high", Total: 2, Pending: 2, Overdue: 1},
+		{Key: "low", Total: 2, Pending: 1, Completed: 1},
+		{Key: "medium", Total: 1, Pending: 1},
+	}
+	if !reflect.DeepEqual(groups, want) {
+		t.Errorf("StatsGrouped(priority) = %+v; want %+v", groups, want)
+	}
+
+	w := httptest.NewRecorder()
+	server.handleGetStats(w, httptest.NewRequest("GET", "/api/v1/stats?group_by=status", nil))
+	var byStatus []GroupStats
+	if err := json.NewDecoder(w.Body).Decode(&byStatus); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(byStatus) != 2 || byStatus[0].Key != "pending" || byStatus[0].Total != 4 {
+		t.Errorf("group_by=status = %+v; want pending first with 4", byStatus)
+	}
+
+	w = httptest.NewRecorder()
+	server.handleGetStats(w, httptest.NewRequest("GET", "/api/v1/stats?group_by=color", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("unknown group_by status = %d; want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestStatsActivity(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.now = func() time.Time { return time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC) }
+	store := server.store
+	ctx := context.Background()
+	at := func(day, hour int) time.Time { return time.Date(2024, 3, day, hour, 0, 0, 0, time.UTC) }
+	add := func(created time.Time, priority string, tags ...string) *Task {
+		store.now = func() time.Time { return created }
+		task, _ := store.Add(ctx, "Task", "", DueTime{}, priority, tags...)
+		return task
+	}
+	complete := func(task *Task, completed time.Time) {
+		store.now = func() time.Time { return completed }
+		store.Update(ctx, task.ID, task.Title, "", DueTime{}, "", "completed")
+	}
+	complete(add(at(11, 9), "high", "Work"), at(12, 9))
+	second := add(at(11, 10), "medium", "work")
+	complete(second, at(14, 10))
+	add(at(13, 10), "low")
+	add(time.Date(2024, 2, 1, 10, 0, 0, 0, time.UTC), "low")
+	// Archived tasks still count as done work
+	store.Archive(ctx, second.ID)
+
+	stats := func(query string) (TaskStats, int) {
+		req := httptest.NewRequest("GET", "/api/v1/stats"+query, nil)
+		req = req.WithContext(context.WithValue(req.Context(), timeZoneKey{}, time.UTC))
+		w := httptest.NewRecorder()
+		server.handleGetStats(w, req)
+		var stats TaskStats
+		json.NewDecoder(w.Body).Decode(&stats)
+		return stats, w.Code
+	}
+
+	got, _ := stats("?from=2024-03-11&to=2024-03-15")
+	activity := got.Activity
+	if activity.Created != 3 || activity.Completed != 2 || activity.AverageCompletionHours != 48 {
+		t.Errorf("activity = %+v; want 3 created, 2 completed in 48 hours on average", activity)
+	}
+	if activity.CompletionRate < 0.66 || activity.CompletionRate > 0.67 {
+		t.Errorf("completion_rate = %v; want 2/3", activity.CompletionRate)
+	}
+	wantBuckets := []ActivityBucket{
+		{Start: "2024-03-11", Created: 2},
+		{Start: "2024-03-12", Completed: 1},
+		{Start: "2024-03-13", Created: 1},
+		{Start: "2024-03-14", Completed: 1},
+		{Start: "2024-03-15"},
+	}
+	if !reflect.DeepEqual(activity.Buckets, wantBuckets) {
+		t.Errorf("buckets = %+v; want %+v", activity.Buckets, wantBuckets)
+	}
+	if got.ByPriority["low"] != 2 || got.ByTag["work"] != 1 || got.Total != 3 {
+		t.Errorf("stats = %+v; want 2 low, 1 live task tagged work, 3 live tasks", got)
+	}
+
+	got, _ = stats("?from=2024-03-13&interval=week")
+	want := []ActivityBucket{{Start: "2024-03-11", Created: 1, Completed: 1}}
+	if got.Activity.From != "2024-03-13" || got.Activity.To != "2024-03-15" || !reflect.DeepEqual(got.Activity.Buckets, want) {
+		t.Errorf("weekly activity = %+v; want one week from Monday counting only days in the period", got.Activity)
+	}
+
+	got, _ = stats("")
+	if got.Activity.From != "2024-02-15" || len(got.Activity.Buckets) != 30 || got.Activity.Created != 3 {
+		t.Errorf("default activity = %s to %s with %d buckets and %d created; want the last 30 days without February",
+			got.Activity.From, got.Activity.To, len(got.Activity.Buckets), got.Activity.Created)
+	}
+
+	for _, query := range []string{"?interval=month", "?from=2024-03-16&to=2024-03-15", "?from=15.03.2024", "?from=2020-01-01"} {
+		if _, code := stats(query); code != http.StatusBadRequest {
+			t.Errorf("stats%s status = %d; want 400", query, code)
+		}
+	}
+}
@@ -0,0 +1,650 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Storage keeps the tasks of a TaskStore and is where they are read from
+// at startup and written to on every change. The JSON file, SQLite and
+// Postgres backends implement it, and new ones are added with
+// RegisterBackend. TaskStore holds its write lock around every call, so an
+// implementation needs no locking of its own. Business rules (status
+// changes, quotas, the change log) stay in TaskStore, and so does ID
+// allocation unless the storage implements IDAllocator.
+//
+// Tasks are passed by pointer but belong to the caller: an implementation
+// must not keep the tasks it is given or hand out ones it keeps.
+type Storage interface {
+	// Add stores a new task under task.ID, failing if the ID is taken
+	Add(ctx context.Context, task *Task) error
+	// Get returns the stored task with the given ID, or ErrTaskNotFound
+	Get(ctx context.Context, id int) (*Task, error)
+	// List returns every stored task, trashed and archived ones included,
+	// in ID order
+	List(ctx context.Context) ([]*Task, error)
+	// Update replaces the stored task with the same ID. task.Version must
+	// be one more than the stored task's; otherwise the task was changed
+	// or deleted since it was read and Update fails with
+	// ErrStorageConflict.
+	Update(ctx context.Context, task *Task) error
+	// Delete removes a stored task for good; a missing task is no error
+	Delete(ctx context.Context, id int) error
+	// Query returns the stored tasks matching q in ID order
+	Query(ctx context.Context, q StorageQuery) ([]*Task, error)
+	// Ping reports whether the storage is usable
+	Ping(ctx context.Context) error
+}
+
+// TaskWriter is the part of Storage that changes tasks
+type TaskWriter interface {
+	Add(ctx context.Context, task *Task) error
+	Update(ctx context.Context, task *Task) error
+	Delete(ctx context.Context, id int) error
+}
+
+// Transactor is implemented by storage that can make several writes at
+// once. A change touching more than one task is written through
+// Atomically, so it is stored completely or not at all; on storage without
+// it the writes are made one by one and a failure can leave the earlier
+// ones stored.
+type Transactor interface {
+	// Atomically calls fn and keeps the writes it made through w only if
+	// it returns nil
+	Atomically(ctx context.Context, fn func(w TaskWriter) error) error
+}
+
+// ErrStorageConflict is returned by Storage.Update when the stored task is
+// not the version the update was based on
+var ErrStorageConflict = errors.New("stored task changed")
+
+// SharedStorage is implemented by storage that several instances use at
+// once, such as Postgres. A TaskStore on it asks before serving each
+// request whether another instance wrote since it last looked, and if so
+// reads what was written.
+type SharedStorage interface {
+	// Revision returns a number that grows with every committed write
+	Revision(ctx context.Context) (int64, error)
+	// ChangesSince returns what was written after revision
+	ChangesSince(ctx context.Context, revision int64) (*StorageChanges, error)
+}
+
+// StorageChanges holds what was written to shared storage after some
+// revision, as of Revision. A nil task or project was deleted. History and
+// Comments hold all of a task's rows, none if they were deleted.
+type StorageChanges struct {
+	Revision int64
+	Tasks    map[int]*Task
+	Projects map[int]*Project
+	History  map[int][]*TaskRevision
+	Comments map[int][]*Comment
+}
+
+// IDAllocator is implemented by shared storage that hands out IDs, so that
+// instances adding tasks, projects or comments at the same time never pick
+// the same ID
+type IDAllocator interface {
+	// AllocateIDs reserves n consecutive IDs of kind, all above any
+	// stored one, and returns the first
+	AllocateIDs(ctx context.Context, kind IDKind, n int) (int, error)
+}
+
+// IDKind names the IDs an IDAllocator hands out
+type IDKind string
+
+// The kinds of ID TaskStore allocates
+const (
+	TaskIDs    IDKind = "tasks"
+	ProjectIDs IDKind = "projects"
+	CommentIDs IDKind = "comments"
+)
+
+// TaskState is where a stored task is: with the live tasks, in the trash
+// or in the archive
+type TaskState string
+
+// The states a StorageQuery can select
+const (
+	TaskLive     TaskState = "live"
+	TaskTrashed  TaskState = "trashed"
+	TaskArchived TaskState = "archived"
+)
+
+// StorageQuery selects tasks for Storage.Query. Zero fields match every
+// task.
+type StorageQuery struct {
+	State TaskState
+	// Statuses matches tasks with any of these statuses
+	Statuses []string
+	// ProjectID matches the tasks of one project
+	ProjectID int
+}
+
+// Matches reports whether task is selected by q, for storage that
+// filters tasks in memory
+func (q StorageQuery) Matches(task *Task) bool {
+	if q.State != "" && taskState(task) != q.State {
+		return false
+	}
+	if len(q.Statuses) > 0 && !containsString(q.Statuses, task.Status) {
+		return false
+	}
+	return q.ProjectID == 0 || task.ProjectID == q.ProjectID
+}
+
+// taskState is the state of a stored task, marked by DeletedAt and
+// ArchivedAt
+func taskState(task *Task) TaskState {
+	switch {
+	case task.DeletedAt != nil:
+		return TaskTrashed
+	case task.ArchivedAt != nil:
+		return TaskArchived
+	}
+	return TaskLive
+}
+
+// TaskSet is every task a TaskStore stores, split across the maps it keeps
+// live, trashed and archived tasks in so that a save needn't merge them.
+// An ID is in at most one of the maps.
+type TaskSet []map[int]*Task
+
+// Get returns the task with the given ID
+func (s TaskSet) Get(id int) (*Task, bool) {
+	for _, tasks := range s {
+		if task, exists := tasks[id]; exists {
+			return task, true
+		}
+	}
+	return nil, false
+}
+
+// ProjectBackend is implemented by backends that also persist projects.
+// It is separate from Storage so that existing third-party backends keep
+// working; on those, project changes fail to save.
+type ProjectBackend interface {
+	// LoadProjects returns every stored project
+	LoadProjects() ([]*Project, error)
+	// SaveProjects stores the projects with the changed IDs, deleting
+	// those no longer in projects
+	SaveProjects(projects map[int]*Project, changed []int) error
+}
+
+// jsonBackend stores all tasks as one JSON array, rewriting the file on
+// every change. It keeps the encoding of every task, read from the file on
+// first use, so a change only encodes the tasks it touched.
+type jsonBackend struct {
+	path string
+	// rows holds the stored tasks by ID; nil until the file is read
+	rows map[int]jsonRow
+	// undo holds the rows as they were before the writes of the current
+	// Atomically call, nil for rows that were added; the file is written
+	// once at its end
+	undo map[int]*jsonRow
+}
+
+// jsonRow is a stored task, indented for its place in the file's array
+type jsonRow struct {
+	version int
+	data    []byte
+}
+
+// newJSONRow encodes task
+func newJSONRow(task *Task) (jsonRow, error) {
+	data, err := json.MarshalIndent(task, "  ", "  ")
+	if err != nil {
+		return jsonRow{}, err
+	}
+	return jsonRow{version: task.Version, data: data}, nil
+}
+
+// task decodes the row into a new Task
+func (r jsonRow) task() (*Task, error) {
+	var task Task
+	if err := json.Unmarshal(r.data, &task); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// load reads the tasks file unless it was read already; a missing file
+// holds no tasks
+func (b *jsonBackend) load() error {
+	if b.rows != nil {
+		return nil
+	}
+	data, err := os.ReadFile(b.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		b.rows = make(map[int]jsonRow)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// Rows are kept as read rather than re-encoded, so that due days
+	// saved by earlier versions are still recognizable when decoded
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("parse %s: %w", b.path, err)
+	}
+	rows := make(map[int]jsonRow, len(raw))
+	for _, data := range raw {
+		var task Task
+		if err := json.Unmarshal(data, &task); err != nil {
+			return fmt.Errorf("parse %s: %w", b.path, err)
+		}
+		rows[task.ID] = jsonRow{version: task.Version, data: data}
+	}
+	b.rows = rows
+	return nil
+}
+
+// Add stores task and rewrites the file
+func (b *jsonBackend) Add(ctx context.Context, task *Task) error {
+	return b.write(func() error {
+		if _, exists := b.rows[task.ID]; exists {
+			return fmt.Errorf("task %d is already stored", task.ID)
+		}
+		return b.put(task)
+	})
+}
+
+// Get decodes the stored task
+func (b *jsonBackend) Get(ctx context.Context, id int) (*Task, error) {
+	if err := b.load(); err != nil {
+		return nil, err
+	}
+	row, exists := b.rows[id]
+	if !exists {
+		return nil, ErrTaskNotFound
+	}
+	return row.task()
+}
+
+// List decodes every stored task
+func (b *jsonBackend) List(ctx context.Context) ([]*Task, error) {
+	return b.Query(ctx, StorageQuery{})
+}
+
+// Update replaces the stored task and rewrites the file
+func (b *jsonBackend) Update(ctx context.Context, task *Task) error {
+	return b.write(func() error {
+		if row, exists := b.rows[task.ID]; !exists || row.version != task.Version-1 {
+			return ErrStorageConflict
+		}
+		return b.put(task)
+	})
+}
+
+// Delete removes the stored task and rewrites the file
+func (b *jsonBackend) Delete(ctx context.Context, id int) error {
+	return b.write(func() error {
+		if row, exists := b.rows[id]; exists {
+			b.remember(id, &row)
+			delete(b.rows, id)
+		}
+		return nil
+	})
+}
+
+// Query decodes the stored tasks and returns those matching q
+func (b *jsonBackend) Query(ctx context.Context, q StorageQuery) ([]*Task, error) {
+	if err := b.load(); err != nil {
+		return nil, err
+	}
+	tasks := make([]*Task, 0, len(b.rows))
+	for _, row := range b.rows {
+		task, err := row.task()
+		if err != nil {
+			return nil, err
+		}
+		if q.Matches(task) {
+			tasks = append(tasks, task)
+		}
+	}
+	sortByID(tasks)
+	return tasks, nil
+}
+
+// Atomically makes the writes of fn and rewrites the file once; if fn or
+// the write fails, the rows are put back as they were
+func (b *jsonBackend) Atomically(ctx context.Context, fn func(w TaskWriter) error) error {
+	return b.write(func() error { return fn(b) })
+}
+
+// write makes a change to the rows with change and rewrites the file,
+// putting the rows back if either fails. Inside Atomically the file is
+// written at its end instead.
+func (b *jsonBackend) write(change func() error) error {
+	if err := b.load(); err != nil {
+		return err
+	}
+	if b.undo != nil {
+		return change()
+	}
+	b.undo = make(map[int]*jsonRow)
+	defer func() { b.undo = nil }()
+
+	err := change()
+	if err == nil {
+		err = b.writeFile()
+	}
+	if err != nil {
+		for id, row := range b.undo {
+			if row == nil {
+				delete(b.rows, id)
+			} else {
+				b.rows[id] = *row
+			}
+		}
+	}
+	return err
+}
+
+// put stores the encoding of task
+func (b *jsonBackend) put(task *Task) error {
+	row, err := newJSONRow(task)
+	if err != nil {
+		return err
+	}
+	if prev, exists := b.rows[task.ID]; exists {
+		b.remember(task.ID, &prev)
+	} else {
+		b.remember(task.ID, nil)
+	}
+	b.rows[task.ID] = row
+	return nil
+}
+
+// remember records row as the state of id to put back, unless the current
+// write already changed id
+func (b *jsonBackend) remember(id int, row *jsonRow) {
+	if _, seen := b.undo[id]; !seen {
+		b.undo[id] = row
+	}
+}
+
+// writeFile rewrites the whole file sorted by ID, in the layout of
+// json.MarshalIndent
+func (b *jsonBackend) writeFile() error {
+	ids := make([]int, 0, len(b.rows))
+	for id := range b.rows {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, id := range ids {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString("\n  ")
+		buf.Write(b.rows[id].data)
+	}
+	if len(ids) > 0 {
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte(']')
+	return os.WriteFile(b.path, buf.Bytes(), 0600)
+}
+
+// projectsPath is the file holding projects next to the tasks file, e.g.
+// tasks_projects.json for tasks.json
+func (b *jsonBackend) projectsPath() string {
+	return strings.TrimSuffix(b.path, filepath.Ext(b.path)) + "_projects.json"
+}
+
+// LoadProjects reads the projects file; a missing file holds no projects
+func (b *jsonBackend) LoadProjects() ([]*Project, error) {
+	data, err := os.ReadFile(b.projectsPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var projects []*Project
+	if err := json.Unmarshal(data, &projects); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", b.projectsPath(), err)
+	}
+	return projects, nil
+}
+
+// SaveProjects rewrites the projects file with every project
+func (b *jsonBackend) SaveProjects(projects map[int]*Project, _ []int) error {
+	list := make([]*Project, 0, len(projects))
+	for _, project := range projects {
+		list = append(list, project)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(b.projectsPath(), data, 0600)
+}
+
+// historyPath is the file holding task history next to the tasks file,
+// e.g. tasks_history.json for tasks.json
+func (b *jsonBackend) historyPath() string {
+	return strings.TrimSuffix(b.path, filepath.Ext(b.path)) + "_history.json"
+}
+
+// LoadHistory reads the history file; a missing file holds no history
+func (b *jsonBackend) LoadHistory() ([]*TaskRevision, error) {
+	data, err := os.ReadFile(b.historyPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var revisions []*TaskRevision
+	if err := json.Unmarshal(data, &revisions); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", b.historyPath(), err)
+	}
+	return revisions, nil
+}
+
+// SaveHistory rewrites the whole history file, ordered by task and
+// revision
+func (b *jsonBackend) SaveHistory(history map[int][]*TaskRevision, _ []int) error {
+	ids := make([]int, 0, len(history))
+	for id := range history {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	list := make([]*TaskRevision, 0)
+	for _, id := range ids {
+		list = append(list, history[id]...)
+	}
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(b.historyPath(), data, 0600)
+}
+
+// commentsPath is the file holding comments next to the tasks file, e.g.
+// tasks_comments.json for tasks.json
+func (b *jsonBackend) commentsPath() string {
+	return strings.TrimSuffix(b.path, filepath.Ext(b.path)) + "_comments.json"
+}
+
+// LoadComments reads the comments file; a missing file holds no comments
+func (b *jsonBackend) LoadComments() ([]*Comment, error) {
+	data, err := os.ReadFile(b.commentsPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var comments []*Comment
+	if err := json.Unmarshal(data, &comments); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", b.commentsPath(), err)
+	}
+	return comments, nil
+}
+
+// SaveComments rewrites the whole comments file, ordered by task and
+// comment
+func (b *jsonBackend) SaveComments(comments map[int][]*Comment, _ []int) error {
+	ids := make([]int, 0, len(comments))
+	for id := range comments {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	list := make([]*Comment, 0)
+	for _, id := range ids {
+		list = append(list, comments[id]...)
+	}
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(b.commentsPath(), data, 0600)
+}
+
+// Ping verifies the directory holding the tasks file is still available
+func (b *jsonBackend) Ping(ctx context.Context) error {
+	info, err := os.Stat(filepath.Dir(b.path))
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", filepath.Dir(b.path))
+	}
+	return ctx.Err()
+}
+
+// sqlConn is what the SQL backends run statements on: the database, or a
+// transaction inside Atomically
+type sqlConn interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// parseTaskRow decodes a task stored as JSON by a SQL backend
+func parseTaskRow(data []byte) (*Task, error) {
+	var task Task
+	if err := json.Unmarshal(data, &task); err != nil {
+		return nil, fmt.Errorf("parse task row: %w", err)
+	}
+	return &task, nil
+}
+
+// scanTaskRows decodes and closes rows selecting one JSON task each
+func scanTaskRows(rows *sql.Rows) ([]*Task, error) {
+	defer rows.Close()
+
+	tasks := make([]*Task, 0)
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		task, err := parseTaskRow(data)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, rows.Err()
+}
+
+// checkUpdated turns a version-checked UPDATE that matched no row into
+// ErrStorageConflict
+func checkUpdated(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrStorageConflict
+	}
+	return nil
+}
+
+// BackendOpener opens a storage backend configured by config
+type BackendOpener func(config *Config) (Storage, error)
+
+// backendOpeners holds the backends selectable with Config.Storage besides
+// the built-in JSON file
+var backendOpeners = make(map[string]BackendOpener)
+
+// RegisterBackend makes a backend selectable with "storage": name. It is
+// meant to be called from an init function, so a new backend can live in
+// its own file; a backend that implements io.Closer is closed if loading
+// its tasks fails. Registering a name twice panics.
+func RegisterBackend(name string, open BackendOpener) {
+	if name == "" || name == "json" {
+		panic("storage: reserved backend name " + name)
+	}
+	if _, dup := backendOpeners[name]; dup {
+		panic("storage: backend " + name + " registered twice")
+	}
+	backendOpeners[name] = open
+}
+
+// validateStorage rejects unknown storage backends
+func validateStorage(storage string) error {
+	if _, ok := backendOpeners[storage]; ok || storage == "" || storage == "json" {
+		return nil
+	}
+	names := make([]string, 0, len(backendOpeners)+1)
+	names = append(names, "json")
+	for name := range backendOpeners {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Errorf("unknown storage %q (want one of %s)", storage, strings.Join(names, ", "))
+}
+
+// OpenStore returns a TaskStore on the backend selected by config.Storage.
+// dataFile is the tasks file used by the default JSON backend. Tasks that
+// can't be loaded are an error for every backend, so a damaged tasks file
+// stops the server instead of being overwritten by the next change. Due
+// days saved by earlier versions are read in config's time zone.
+func OpenStore(config *Config, dataFile string) (*TaskStore, error) {
+	loc, err := config.Location()
+	if err != nil {
+		loc = time.Local
+	}
+	var backend Storage = &jsonBackend{path: dataFile}
+	if config.Storage != "" && config.Storage != "json" {
+		open, ok := backendOpeners[config.Storage]
+		if !ok {
+			return nil, validateStorage(config.Storage)
+		}
+		if backend, err = open(config); err != nil {
+			return nil, err
+		}
+	}
+
+	store, err := newTaskStore(backend, loc)
+	if err != nil {
+		if closer, ok := backend.(io.Closer); ok {
+			_ = closer.Close()
+		}
+		return nil, fmt.Errorf("load tasks: %w", err)
+	}
+	return store, nil
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memoryBackend is a Storage that keeps rows in a map, standing in for a
+// third-party backend. It records its writes as "add 8", "update 7" or
+// "delete 7".
+type memoryBackend struct {
+	rows    map[int]Task
+	writes  []string
+	failing bool
+}
+
+func (b *memoryBackend) write(op string, id int) error {
+	if b.failing {
+		return errors.New("backend unavailable")
+	}
+	b.writes = append(b.writes, fmt.Sprintf("%s %d", op, id))
+	return nil
+}
+
+func (b *memoryBackend) Add(ctx context.Context, task *Task) error {
+	if _, exists := b.rows[task.ID]; exists {
+		return fmt.Errorf("task %d exists", task.ID)
+	}
+	if err := b.write("add", task.ID); err != nil {
+		return err
+	}
+	b.rows[task.ID] = *task
+	return nil
+}
+
+func (b *memoryBackend) Get(ctx context.Context, id int) (*Task, error) {
+	row, exists := b.rows[id]
+	if !exists {
+		return nil, ErrTaskNotFound
+	}
+	return &row, nil
+}
+
+func (b *memoryBackend) List(ctx context.Context) ([]*Task, error) {
+	return b.Query(ctx, StorageQuery{})
+}
+
+func (b *memoryBackend) Update(ctx context.Context, task *Task) error {
+	if row, exists := b.rows[task.ID]; !exists || row.Version != task.Version-1 {
+		return ErrStorageConflict
+	}
+	if err := b.write("update", task.ID); err != nil {
+		return err
+	}
+	b.rows[task.ID] = *task
+	return nil
+}
+
+func (b *memoryBackend) Delete(ctx context.Context, id int) error {
+	if err := b.write("delete", id); err != nil {
+		return err
+	}
+	delete(b.rows, id)
+	return nil
+}
+
+func (b *memoryBackend) Query(ctx context.Context, q StorageQuery) ([]*Task, error) {
+	tasks := make([]*Task, 0, len(b.rows))
+	for _, row := range b.rows {
+		task := row
+		if q.Matches(&task) {
+			tasks = append(tasks, &task)
+		}
+	}
+	sortByID(tasks)
+	return tasks, nil
+}
+
+func (b *memoryBackend) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// testMemoryBackend is shared with the "memory-test" registration below
+var testMemoryBackend = &memoryBackend{rows: map[int]Task{7: {ID: 7, Title: "Preloaded", Status: "pending"}}}
+
+func init() {
+	RegisterBackend("memory-test", func(*Config) (Storage, error) {
+		return testMemoryBackend, nil
+	})
+}
+
+func TestRegisteredBackendIsSelectable(t *testing.T) {
+	store, err := OpenStore(&Config{Storage: "memory-test"}, "test_tasks.json")
+	if err != nil {
+		t.Fatalf("OpenStore() error = %v", err)
+	}
+	if task, ok := store.Get(7); !ok || task.Title != "Preloaded" {
+		t.Fatalf("Get(7) = %+v, %v; want the preloaded task", task, ok)
+	}
+
+	ctx := context.Background()
+	task, err := store.Add(ctx, "New", "", DueTime{}, "medium")
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if task.ID != 8 {
+		t.Errorf("new ID = %d; want 8", task.ID)
+	}
+	if _, err := store.Delete(ctx, 7); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	// Deleted tasks stay stored, marked as in the trash
+	if row, ok := testMemoryBackend.rows[7]; !ok || row.DeletedAt == nil {
+		t.Errorf("deleted row = %+v, %v; want it stored with deleted_at", row, ok)
+	}
+	if got := strings.Join(testMemoryBackend.writes, ", "); got != "add 8, update 7" {
+		t.Errorf("writes = %q; want %q", got, "add 8, update 7")
+	}
+
+	testMemoryBackend.failing = true
+	defer func() { testMemoryBackend.failing = false }()
+	if _, err := store.Add(ctx, "Lost", "", DueTime{}, "medium"); err == nil {
+		t.Error("Add() error = nil; want the backend's error")
+	}
+}
+
+func TestValidateStorageListsBackends(t *testing.T) {
+	for _, name := range []string{"", "json", "sqlite", "postgres", "memory-test"} {
+		if err := validateStorage(name); err != nil {
+			t.Errorf("validateStorage(%q) error = %v", name, err)
+		}
+	}
+	err := validateStorage("floppy")
+	if err == nil || !strings.Contains(err.Error(), "json, memory-test, postgres, sqlite") {
+		t.Errorf("validateStorage(floppy) error = %v; want the list of backends", err)
+	}
+}
+
+func TestRegisterBackendRejectsDuplicates(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("registering sqlite twice did not panic")
+		}
+	}()
+	RegisterBackend("sqlite", func(*Config) (Storage, error) { return nil, nil })
+}
+
+func TestOpenStoreRefusesUnreadableTasksFile(t *testing.T) {
+	dataFile := filepath.Join(t.TempDir(), "tasks.json")
+	if err := os.WriteFile(dataFile, []byte(`[{"id": 1, "title": "Half`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenStore(&Config{}, dataFile); err == nil {
+		t.Fatal("OpenStore() error = nil; want the parse error")
+	}
+	if data, _ := os.ReadFile(dataFile); string(data) != `[{"id": 1, "title": "Half` {
+		t.Errorf("tasks file changed to %q", data)
+	}
+}
+
+func TestOpenStoreReadsSavedDaysInItsTimeZone(t *testing.T) {
+	dataFile := filepath.Join(t.TempDir(), "tasks.json")
+	if err := os.WriteFile(dataFile, []byte(`[{"id": 1, "title": "Old", "due_date": "2030-01-02"}]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for zone, want := range map[string]string{
+		"Asia/Tokyo": "2030-01-02T23:59:59+09:00",
+		"UTC":        "2030-01-02T23:59:59Z",
+	} {
+		store, err := OpenStore(&Config{TimeZone: zone}, dataFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if task, _ := store.Get(1); task.DueDate.String() != want {
+			t.Errorf("due date with time_zone %s = %q; want %q", zone, task.DueDate, want)
+		}
+	}
+}
+
+func TestStorageBackends(t *testing.T) {
+	for name, open := range map[string]func(t *testing.T) Storage{
+		"json": func(t *testing.T) Storage {
+			return &jsonBackend{path: filepath.Join(t.TempDir(), "tasks.json")}
+		},
+		"sqlite": func(t *testing.T) Storage {
+			backend, err := openSQLiteBackend(filepath.Join(t.TempDir(), "tasks.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { backend.Close() })
+			return backend
+		},
+		"memory": func(*testing.T) Storage {
+			return &memoryBackend{rows: map[int]Task{}}
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			storage := open(t)
+			ctx := context.Background()
+			deletedAt := time.Date(2030, 1, 2, 0, 0, 0, 0, time.UTC)
+			for _, task := range []*Task{
+				{ID: 1, Title: "Open", Status: "pending", ProjectID: 4, Version: 1},
+				{ID: 2, Title: "Done", Status: "completed", Version: 1},
+				{ID: 3, Title: "Trashed", Status: "completed", ProjectID: 4, DeletedAt: &deletedAt, Version: 1},
+			} {
+				if err := storage.Add(ctx, task); err != nil {
+					t.Fatalf("Add(%d) error = %v", task.ID, err)
+				}
+			}
+			if err := storage.Add(ctx, &Task{ID: 1, Title: "Again"}); err == nil {
+				t.Error("Add() of a stored ID error = nil; want error")
+			}
+
+			task, err := storage.Get(ctx, 2)
+			if err != nil || task.Title != "Done" {
+				t.Fatalf("Get(2) = %+v, %v; want Done", task, err)
+			}
+			if _, err := storage.Get(ctx, 9); !errors.Is(err, ErrTaskNotFound) {
+				t.Errorf("Get(9) error = %v; want ErrTaskNotFound", err)
+			}
+
+			task.Title, task.Version = "Done again", 2
+			if err := storage.Update(ctx, task); err != nil {
+				t.Fatalf("Update() error = %v", err)
+			}
+			stale := *task
+			stale.Title = "Stale"
+			if err := storage.Update(ctx, &stale); !errors.Is(err, ErrStorageConflict) {
+				t.Errorf("Update() of a stale version error = %v; want ErrStorageConflict", err)
+			}
+			if err := storage.Update(ctx, &Task{ID: 9, Version: 1}); !errors.Is(err, ErrStorageConflict) {
+				t.Errorf("Update() of a missing task error = %v; want ErrStorageConflict", err)
+			}
+
+			for _, tt := range []struct {
+				query StorageQuery
+				want  string
+			}{
+				{StorageQuery{}, "Open, Done again, Trashed"},
+				{StorageQuery{State: TaskLive}, "Open, Done again"},
+				{StorageQuery{State: TaskTrashed}, "Trashed"},
+				{StorageQuery{State: TaskArchived}, ""},
+				{StorageQuery{Statuses: []string{"completed"}}, "Done again, Trashed"},
+				{StorageQuery{State: TaskLive, ProjectID: 4}, "Open"},
+			} {
+				tasks, err := storage.Query(ctx, tt.query)
+				if err != nil {
+					t.Fatalf("Query(%+v) error = %v", tt.query, err)
+				}
+				if got := taskTitles(tasks); got != tt.want {
+					t.Errorf("Query(%+v) = %q; want %q", tt.query, got, tt.want)
+				}
+			}
+
+			if err := storage.Delete(ctx, 1); err != nil {
+				t.Fatalf("Delete() error = %v", err)
+			}
+			if err := storage.Delete(ctx, 1); err != nil {
+				t.Errorf("Delete() of a missing task error = %v", err)
+			}
+			tasks, err := storage.List(ctx)
+			if err != nil || taskTitles(tasks) != "Done again, Trashed" {
+				t.Errorf("List() = %q, %v; want Done again, Trashed", taskTitles(tasks), err)
+			}
+		})
+	}
+}
+
+// taskTitles joins the titles of tasks with commas
+func taskTitles(tasks []*Task) string {
+	titles := make([]string, len(tasks))
+	for i, task := range tasks {
+		titles[i] = task.Title
+	}
+	return strings.Join(titles, ", ")
+}
+
+func TestJSONBackendAtomicallyKeepsAllOrNothing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.json")
+	backend := &jsonBackend{path: path}
+	ctx := context.Background()
+	if err := backend.Add(ctx, &Task{ID: 1, Title: "Kept", Version: 1}); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := os.ReadFile(path)
+
+	err := backend.Atomically(ctx, func(w TaskWriter) error {
+		if err := w.Add(ctx, &Task{ID: 2, Title: "Lost", Version: 1}); err != nil {
+			return err
+		}
+		if err := w.Delete(ctx, 1); err != nil {
+			return err
+		}
+		return w.Update(ctx, &Task{ID: 1, Version: 2})
+	})
+	if !errors.Is(err, ErrStorageConflict) {
+		t.Fatalf("Atomically() error = %v; want ErrStorageConflict", err)
+	}
+	if after, _ := os.ReadFile(path); string(after) != string(before) {
+		t.Errorf("file changed by a failed batch:\n%s", after)
+	}
+	if tasks, _ := backend.List(ctx); taskTitles(tasks) != "Kept" {
+		t.Errorf("tasks after a failed batch = %q; want Kept", taskTitles(tasks))
+	}
+
+	if err := backend.Atomically(ctx, func(w TaskWriter) error {
+		if err := w.Add(ctx, &Task{ID: 2, Title: "Second", Version: 1}); err != nil {
+			return err
+		}
+		return w.Update(ctx, &Task{ID: 1, Title: "First", Version: 2})
+	}); err != nil {
+		t.Fatalf("Atomically() error = %v", err)
+	}
+	reopened := &jsonBackend{path: path}
+	if tasks, _ := reopened.List(ctx); taskTitles(tasks) != "First, Second" {
+		t.Errorf("tasks in the file = %q; want First, Second", taskTitles(tasks))
+	}
+}
+
+func TestStoreReportsStorageConflicts(t *testing.T) {
+	backend := &memoryBackend{rows: map[int]Task{1: {ID: 1, Title: "Shared", Status: "pending", Version: 1}}}
+	first, _ := NewTaskStoreWithStorage(backend)
+	second, _ := NewTaskStoreWithStorage(backend)
+	ctx := context.Background()
+
+	if _, _, err := first.Patch(ctx, 1, map[string]string{"title": "First"}); err != nil {
+		t.Fatalf("Patch() error = %v", err)
+	}
+	_, _, err := second.Patch(ctx, 1, map[string]string{"title": "Second"})
+	if !errors.Is(err, ErrStorageConflict) {
+		t.Fatalf("Patch() of a stale task error = %v; want ErrStorageConflict", err)
+	}
+	if backend.rows[1].Title != "First" {
+		t.Errorf("stored title = %q; want the first write kept", backend.rows[1].Title)
+	}
+	if task, _ := second.Get(1); task.Title != "Shared" || task.Version != 1 {
+		t.Errorf("task after the conflict = %+v; want it as read", task)
+	}
+
+	w := httptest.NewRecorder()
+	writeStoreError(w, fmt.Errorf("save tasks: %w", err))
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), ErrCodeTaskConflict) {
+		t.Errorf("response = %d %s; want 409 %s", w.Code, w.Body, ErrCodeTaskConflict)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Subtask is a checklist item within a task. IDs are unique within their
+// task only.
+type Subtask struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+	Done  bool   `json:"done"`
+}
+
+// ErrSubtaskNotFound is returned when a task has no subtask with the given ID
+var ErrSubtaskNotFound = errors.New("subtask not found")
+
+// changeSubtasks replaces the task's subtasks with the result of change,
+// which must return a new slice rather than modify the current one: the
+// previous slice is kept for rollback and shared with change log
+// snapshots. Like Update, the bool reports whether the task exists.
+func (ts *TaskStore) changeSubtasks(ctx context.Context, id int, change func([]Subtask) ([]Subtask, error)) (*Task, bool, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	task, exists := ts.tasks[id]
+	if !exists {
+		return nil, false, nil
+	}
+	if err := ts.checkProjectLocked(ctx, task.ProjectID, PermissionEdit); err != nil {
+		return nil, true, err
+	}
+	subtasks, err := change(task.Subtasks)
+	if err != nil {
+		return nil, true, err
+	}
+
+	prev := *task
+	task.Subtasks = subtasks
+	task.UpdatedAt = ts.now()
+	if err := ts.save(ctx, id); err != nil {
+		*task = prev
+		return nil, true, fmt.Errorf("save tasks: %w", err)
+	}
+	ts.recordChange(ctx, ChangeUpdated, task)
+	ts.recordMutation(ctx, AuditUpdate, auditTask, id, &prev, task)
+	return task, true, nil
+}
+
+// AddSubtask appends an unfinished subtask to a task
+func (ts *TaskStore) AddSubtask(ctx context.Context, id int, title string) (*Subtask, bool, error) {
+	var added Subtask
+	_, exists, err := ts.changeSubtasks(ctx, id, func(current []Subtask) ([]Subtask, error) {
+		added = Subtask{ID: 1, Title: title}
+		for _, sub := range current {
+			if sub.ID >= added.ID {
+				added.ID = sub.ID + 1
+			}
+		}
+		return append(append(make([]Subtask, 0, len(current)+1), current...), added), nil
+	})
+	if err != nil || !exists {
+		return nil, exists, err
+	}
+	return &added, true, nil
+}
+
+// UpdateSubtask sets a subtask's title and done flag. It returns
+// ErrSubtaskNotFound if the task has no such subtask.
+func (ts *TaskStore) UpdateSubtask(ctx context.Context, id, subtaskID int, title string, done bool) (*Subtask, bool, error) {
+	var updated Subtask
+	_, exists, err := ts.changeSubtasks(ctx, id, func(current []Subtask) ([]Subtask, error) {
+		subtasks := append([]Subtask(nil), current...)
+		for i := range subtasks {
+			if subtasks[i].ID == subtaskID {
+				subtasks[i].Title = title
+				subtasks[i].Done = done
+				updated = subtasks[i]
+				return subtasks, nil
+			}
+		}
+		return nil, ErrSubtaskNotFound
+	})
+	if err != nil || !exists {
+		return nil, exists, err
+	}
+	return &updated, true, nil
+}
+
+// DeleteSubtask removes a subtask. It returns ErrSubtaskNotFound if the
+// task has no such subtask.
+func (ts *TaskStore) DeleteSubtask(ctx context.Context, id, subtaskID int) (bool, error) {
+	_, exists, err := ts.changeSubtasks(ctx, id, func(current []Subtask) ([]Subtask, error) {
+		subtasks := make([]Subtask, 0, len(current))
+		for _, sub := range current {
+			if sub.ID != subtaskID {
+				subtasks = append(subtasks, sub)
+			}
+		}
+		if len(subtasks) == len(current) {
+			return nil, ErrSubtaskNotFound
+		}
+		return subtasks, nil
+	})
+	return exists, err
+}
+
+// subtaskRequest is the body accepted when creating or replacing a subtask
+type subtaskRequest struct {
+	Title string `json:"title"`
+	Done  bool   `json:"done"`
+}
+
+// parseSubtaskRequest decodes and validates a subtask body, writing the
+// error response itself when it fails
+func parseSubtaskRequest(w http.ResponseWriter, r *http.Request) (subtaskRequest, bool) {
+	var req subtaskRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON")
+		return req, false
+	}
+	if strings.TrimSpace(req.Title) == "" {
+		writeError(w, http.StatusUnprocessableEntity, ErrCodeTitleRequired, "Title is required")
+		return req, false
+	}
+	return req, true
+}
+
+// parseSubtaskIDs reads the task and subtask IDs from the URL, writing a
+// 400 response when either is invalid
+func (s *Server) parseSubtaskIDs(w http.ResponseWriter, r *http.Request) (id, subtaskID int, ok bool) {
+	id, err := s.parseTaskID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidTaskID, "Invalid task ID")
+		return 0, 0, false
+	}
+	subtaskID, err = strconv.Atoi(mux.Vars(r)["sid"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidTaskID, "Invalid subtask ID")
+		return 0, 0, false
+	}
+	return id, subtaskID, true
+}
+
+// writeSubtaskError maps errors from the subtask store methods to responses
+func writeSubtaskError(w http.ResponseWriter, exists bool, err error) {
+	switch {
+	case errors.Is(err, ErrSubtaskNotFound):
+		writeError(w, http.StatusNotFound, ErrCodeSubtaskNotFound, "Subtask not found")
+	case err != nil:
+		writeStoreError(w, err)
+	case !exists:
+		writeError(w, http.StatusNotFound, ErrCodeTaskNotFound, "Task not found")
+	}
+}
+
+// handleCreateSubtask adds a checklist item to a task
+func (s *Server) handleCreateSubtask(w http.ResponseWriter, r *http.Request) {
+	id, err := s.parseTaskID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidTaskID, "Invalid task ID")
+		return
+	}
+	req, ok := parseSubtaskRequest(w, r)
+	if !ok {
+		return
+	}
+
+	subtask, exists, err := s.store.AddSubtask(r.Context(), id, req.Title)
+	if err != nil || !exists {
+		writeSubtaskError(w, exists, err)
+		return
+	}
+	taskOps.Add("update", 1)
+	writeJSON(w, http.StatusCreated, subtask)
+}
+
+// handleUpdateSubtask replaces a checklist item's title and done flag
+func (s *Server) handleUpdateSubtask(w http.ResponseWriter, r *http.Request) {
+	id, subtaskID, ok := s.parseSubtaskIDs(w, r)
+	if !ok {
+		return
+	}
+	req, ok := parseSubtaskRequest(w, r)
+	if !ok {
+		return
+	}
+
+	subtask, exists, err := s.store.UpdateSubtask(r.Context(), id, subtaskID, req.Title, req.Done)
+	if err != nil || !exists {
+		writeSubtaskError(w, exists, err)
+		return
+	}
+	taskOps.Add("update", 1)
+	writeJSON(w, http.StatusOK, subtask)
+}
+
+// handleDeleteSubtask removes a checklist item
+func (s *Server) handleDeleteSubtask(w http.ResponseWriter, r *http.Request) {
+	id, subtaskID, ok := s.parseSubtaskIDs(w, r)
+	if !ok {
+		return
+	}
+
+	exists, err := s.store.DeleteSubtask(r.Context(), id, subtaskID)
+	if err != nil || !exists {
+		writeSubtaskError(w, exists, err)
+		return
+	}
+	taskOps.Add("update", 1)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestSubtaskLifecycle(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	ctx := context.Background()
+	task, _ := server.store.Add(ctx, "Pack", "", DueTime{}, "medium")
+
+	for _, title := range []string{"Socks", "Charger"} {
+		req := mux.SetURLVars(httptest.NewRequest("POST", "/api/v1/tasks/1/subtasks",
+			strings.NewReader(`{"title":"`+title+`"}`)), map[string]string{"id": "1"})
+		w := httptest.NewRecorder()
+		server.handleCreateSubtask(w, req)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create %q: status code = %d; want %d", title, w.Code, http.StatusCreated)
+		}
+	}
+
+	req := mux.SetURLVars(httptest.NewRequest("PUT", "/api/v1/tasks/1/subtasks/2",
+		strings.NewReader(`{"title":"Phone charger","done":true}`)), map[string]string{"id": "1", "sid": "2"})
+	w := httptest.NewRecorder()
+	server.handleUpdateSubtask(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update: status code = %d; want %d", w.Code, http.StatusOK)
+	}
+	var updated Subtask
+	if err := json.NewDecoder(w.Body).Decode(&updated); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if updated != (Subtask{ID: 2, Title: "Phone charger", Done: true}) {
+		t.Errorf("updated subtask = %+v", updated)
+	}
+
+	req = mux.SetURLVars(httptest.NewRequest("DELETE", "/api/v1/tasks/1/subtasks/1", nil),
+		map[string]string{"id": "1", "sid": "1"})
+	w = httptest.NewRecorder()
+	server.handleDeleteSubtask(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("delete: status code = %d; want %d", w.Code, http.StatusNoContent)
+	}
+
+	got, _ := server.store.Get(task.ID)
+	if len(got.Subtasks) != 1 || got.Subtasks[0].ID != 2 || !got.Subtasks[0].Done {
+		t.Errorf("subtasks = %+v; want only the done charger", got.Subtasks)
+	}
+
+	// IDs are not reused after a delete
+	sub, _, err := server.store.AddSubtask(ctx, task.ID, "Passport")
+	if err != nil || sub.ID != 3 {
+		t.Errorf("AddSubtask = %+v, %v; want ID 3", sub, err)
+	}
+}
+
+func TestSubtaskErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		vars     map[string]string
+		body     string
+		wantCode int
+		wantErr  string
+	}{
+		{"missing task", "POST", map[string]string{"id": "9"}, `{"title":"x"}`, http.StatusNotFound, ErrCodeTaskNotFound},
+		{"empty title", "POST", map[string]string{"id": "1"}, `{"title":" "}`, http.StatusUnprocessableEntity, ErrCodeTitleRequired},
+		{"missing subtask", "PUT", map[string]string{"id": "1", "sid": "7"}, `{"title":"x"}`, http.StatusNotFound, ErrCodeSubtaskNotFound},
+		{"invalid subtask id", "DELETE", map[string]string{"id": "1", "sid": "abc"}, "", http.StatusBadRequest, ErrCodeInvalidTaskID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, cleanup := setupTestServer()
+			defer cleanup()
+			server.store.Add(context.Background(), "Task", "", DueTime{}, "medium")
+
+			req := mux.SetURLVars(httptest.NewRequest(tt.method, "/", strings.NewReader(tt.body)), tt.vars)
+			w := httptest.NewRecorder()
+			switch tt.method {
+			case "POST":
+				server.handleCreateSubtask(w, req)
+			case "PUT":
+				server.handleUpdateSubtask(w, req)
+			case "DELETE":
+				server.handleDeleteSubtask(w, req)
+			}
+			if w.Code != tt.wantCode {
+				t.Fatalf("status code = %d; want %d", w.Code, tt.wantCode)
+			}
+			var body struct {
+				Code string `json:"code"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if body.Code != tt.wantErr {
+				t.Errorf("error code = %q; want %q", body.Code, tt.wantErr)
+			}
+		})
+	}
+}
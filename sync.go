@@ -0,0 +1,382 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// syncPingInterval is how often the server pings a sync connection. A
+// client that sends nothing, not even a pong, for twice as long is dropped.
+const syncPingInterval = 30 * time.Second
+
+// ErrTaskConflict is returned by the IfUnchanged store methods when the
+// task has changed after the client's base revision. A base revision of
+// zero skips the check.
+var ErrTaskConflict = errors.New("task changed since base revision")
+
+// changedSinceLocked reports whether the task may have changed after
+// revision since: the change log has a change to it, or no longer reaches
+// back that far. The caller must hold a lock.
+func (ts *TaskStore) changedSinceLocked(id int, since int64) bool {
+	changes, complete := ts.changesSinceLocked(since)
+	if !complete {
+		return true
+	}
+	for _, change := range changes {
+		if change.TaskID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// PatchIfUnchanged is Patch, but fails with ErrTaskConflict if the task has
+// changed after revision since. The check and the patch happen under the
+// same write lock.
+func (ts *TaskStore) PatchIfUnchanged(ctx context.Context, id int, since int64, fields map[string]string) (*Task, bool, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	task, exists := ts.tasks[id]
+	if !exists {
+		return nil, false, nil
+	}
+	if since > 0 && ts.changedSinceLocked(id, since) {
+		return nil, true, ErrTaskConflict
+	}
+	return ts.patchLocked(ctx, task, fields)
+}
+
+// DeleteIfUnchanged is Delete, but fails with ErrTaskConflict if the task
+// has changed after revision since
+func (ts *TaskStore) DeleteIfUnchanged(ctx context.Context, id int, since int64) (bool, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	if _, exists := ts.tasks[id]; !exists {
+		return false, nil
+	}
+	if since > 0 && ts.changedSinceLocked(id, since) {
+		return true, ErrTaskConflict
+	}
+	return ts.deleteLocked(ctx, id)
+}
+
+// syncMessage is a message from a sync client. Type is one of auth,
+// subscribe, create, patch and delete; Ref is echoed in the reply so the
+// client can match replies to requests.
+type syncMessage struct {
+	Type string `json:"type"`
+	Ref  string `json:"ref,omitempty"`
+	// Token authenticates the connection (auth)
+	Token string `json:"token,omitempty"`
+	// Since is the revision to stream changes after (subscribe); omitted
+	// means the current revision
+	Since *int64 `json:"since,omitempty"`
+	// ID is the task to change (patch, delete)
+	ID json.RawMessage `json:"id,omitempty"`
+	// BaseRevision is the revision the client last saw the task at. If the
+	// task changed after it, the mutation is refused with a conflict reply;
+	// zero skips the check (patch, delete)
+	BaseRevision int64 `json:"base_revision,omitempty"`
+	// Task is a create request body (create) or a JSON merge patch (patch)
+	Task json.RawMessage `json:"task,omitempty"`
+}
+
+// syncReply is a message to a sync client
+type syncReply struct {
+	Type     string      `json:"type"`
+	Ref      string      `json:"ref,omitempty"`
+	Revision int64       `json:"revision,omitempty"`
+	Change   *pollChange `json:"change,omitempty"`
+	Task     *publicTask `json:"task,omitempty"`
+	Code     string      `json:"code,omitempty"`
+	Error    string      `json:"error,omitempty"`
+}
+
+// syncSession is the state of one sync connection
+type syncSession struct {
+	server   *Server
+	conn     *wsConn
+	token    tokenInfo
+	disabled map[string]bool
+	// loc is the time zone of the handshake, which due days are read in
+	loc *time.Location
+
+	// cancel stops the current subscription; wg waits for it
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// handleSync serves the WebSocket sync protocol. A client subscribes to
+// receive every task change as it happens, and can create, patch and
+// delete tasks over the same connection once authenticated with a
+// tasks:write token, sent either as an X-API-Token header on the handshake or in an
+// auth message. Patches and
+// deletes may carry a base_revision; if the task has changed since, the
+// client gets a conflict reply with the current task instead.
+func (s *Server) handleSync(w http.ResponseWriter, r *http.Request) {
+	select {
+	case s.eventStreams <- struct{}{}:
+		defer func() { <-s.eventStreams }()
+	default:
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusServiceUnavailable, ErrCodeServerBusy, "Too many open event streams")
+		return
+	}
+
+	conn, err := upgradeWebsocket(w, r)
+	if err != nil {
+		return
+	}
+	info, _ := s.lookupToken(r.Header.Get("X-API-Token"))
+	s.touchToken(info.hash)
+	session := &syncSession{
+		server:   s,
+		conn:     conn,
+		token:    info,
+		disabled: make(map[string]bool),
+		loc:      s.requestLocation(r),
+	}
+	for _, name := range s.config.DisabledEndpoints {
+		session.disabled[name] = true
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer func() {
+		cancel()
+		session.unsubscribe()
+		conn.close(wsCloseNormal)
+	}()
+	// Closing the connection on shutdown ends the read loop below
+	go func() {
+		select {
+		case <-s.closing:
+			conn.close(wsCloseGoingAway)
+		case <-ctx.Done():
+		}
+	}()
+	go func() {
+		ticker := time.NewTicker(syncPingInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if conn.writeFrame(wsPing, nil) != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		data, err := conn.readMessage(2 * syncPingInterval)
+		if err != nil {
+			return
+		}
+		var msg syncMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			conn.writeJSON(syncReply{Type: "error", Code: ErrCodeInvalidJSON, Error: "Invalid JSON"})
+			continue
+		}
+		reply := session.handle(ctx, msg)
+		if reply == nil {
+			continue
+		}
+		if err := conn.writeJSON(reply); err != nil {
+			return
+		}
+	}
+}
+
+// handle processes one message and returns the reply, or nil when the
+// reply is sent elsewhere
+func (ss *syncSession) handle(ctx context.Context, msg syncMessage) *syncReply {
+	s := ss.server
+	switch msg.Type {
+	case "auth":
+		info, err := s.lookupToken(msg.Token)
+		if errors.Is(err, errTokenExpired) {
+			return &syncReply{Type: "error", Ref: msg.Ref, Code: ErrCodeTokenExpired, Error: "Token expired"}
+		}
+		if err != nil {
+			return &syncReply{Type: "error", Ref: msg.Ref, Code: ErrCodeInvalidToken, Error: "Invalid token"}
+		}
+		s.touchToken(info.hash)
+		ss.token = info
+		return &syncReply{Type: "authenticated", Ref: msg.Ref}
+	case "subscribe":
+		revision := s.store.Revision()
+		if msg.Since != nil {
+			if *msg.Since < 0 {
+				return &syncReply{Type: "error", Ref: msg.Ref, Code: ErrCodeInvalidMessage, Error: "since must be a revision number"}
+			}
+			revision = *msg.Since
+		}
+		ss.subscribe(ctx, msg.Ref, revision)
+		return nil
+	case "create", "patch", "delete":
+		if ss.token.role == "" {
+			return &syncReply{Type: "error", Ref: msg.Ref, Code: ErrCodeTokenRequired, Error: "Token required"}
+		}
+		if !ss.token.hasScope(ScopeTasksWrite) {
+			return &syncReply{Type: "error", Ref: msg.Ref, Code: ErrCodeForbidden, Error: "Requires the tasks:write scope"}
+		}
+		if ss.disabled["tasks."+msg.Type] {
+			return &syncReply{Type: "error", Ref: msg.Ref, Code: ErrCodeOperationDisabled, Error: "Operation disabled"}
+		}
+		// Project permissions are checked against the session's token
+		reply := ss.mutate(context.WithValue(ctx, tokenKey{}, ss.token), msg)
+		return &reply
+	}
+	return &syncReply{Type: "error", Ref: msg.Ref, Code: ErrCodeInvalidMessage, Error: "Unknown message type"}
+}
+
+// subscribe streams changes after since to the client, replacing any
+// earlier subscription. The subscribed reply is sent from the streaming
+// goroutine so that it always comes before the first change.
+func (ss *syncSession) subscribe(ctx context.Context, ref string, since int64) {
+	ss.unsubscribe()
+	ctx, ss.cancel = context.WithCancel(ctx)
+	ss.wg.Add(1)
+	go func() {
+		defer ss.wg.Done()
+		if ss.conn.writeJSON(syncReply{Type: "subscribed", Ref: ref, Revision: since}) != nil {
+			return
+		}
+		for {
+			changes, revision, complete := ss.server.store.WaitForChanges(ctx, since)
+			if ctx.Err() != nil {
+				return
+			}
+			if !complete {
+				if ss.conn.writeJSON(syncReply{Type: "resync", Revision: revision}) != nil {
+					return
+				}
+			}
+			for _, change := range changes {
+				item := ss.server.presentChange(change)
+				if ss.conn.writeJSON(syncReply{Type: "change", Revision: change.Revision, Change: &item}) != nil {
+					return
+				}
+			}
+			since = revision
+		}
+	}()
+}
+
+// unsubscribe stops the current subscription, if any, and waits for it
+func (ss *syncSession) unsubscribe() {
+	if ss.cancel != nil {
+		ss.cancel()
+		ss.cancel = nil
+	}
+	ss.wg.Wait()
+}
+
+// mutate applies a create, patch or delete message
+func (ss *syncSession) mutate(ctx context.Context, msg syncMessage) syncReply {
+	s := ss.server
+	if msg.Type == "create" {
+		var req createTaskRequest
+		if err := json.Unmarshal(msg.Task, &req); err != nil {
+			return syncReply{Type: "error", Ref: msg.Ref, Code: ErrCodeInvalidJSON, Error: "Invalid JSON"}
+		}
+		fields, err := s.newTaskFields(&req, ss.loc)
+		if err != nil {
+			return syncError(msg.Ref, err)
+		}
+		task, err := s.store.AddTask(ctx, fields)
+		if err != nil {
+			return syncError(msg.Ref, err)
+		}
+		taskOps.Add("create", 1)
+		presented := s.presentTask(task)
+		return syncReply{Type: "ok", Ref: msg.Ref, Task: &presented}
+	}
+
+	// IDs may be sent as numbers or, when obfuscated, as strings
+	id, err := s.decodeTaskID(strings.Trim(string(msg.ID), `"`))
+	if err != nil {
+		return syncReply{Type: "error", Ref: msg.Ref, Code: ErrCodeInvalidTaskID, Error: "Invalid task ID"}
+	}
+
+	var task *Task
+	var exists bool
+	if msg.Type == "patch" {
+		fields, perr := s.parseTaskPatch(msg.Task, ss.loc)
+		if perr != nil {
+			var verr *validationError
+			if !errors.As(perr, &verr) {
+				return syncReply{Type: "error", Ref: msg.Ref, Code: ErrCodeInvalidJSON, Error: "Invalid JSON"}
+			}
+			return syncError(msg.Ref, perr)
+		}
+		task, exists, err = s.store.PatchIfUnchanged(ctx, id, msg.BaseRevision, fields)
+	} else {
+		exists, err = s.store.DeleteIfUnchanged(ctx, id, msg.BaseRevision)
+	}
+	if errors.Is(err, ErrTaskConflict) {
+		reply := syncReply{Type: "conflict", Ref: msg.Ref, Code: ErrCodeTaskConflict, Error: "Task changed after base_revision"}
+		if current, ok := s.store.Get(id); ok {
+			presented := s.presentTask(current)
+			reply.Task = &presented
+		}
+		return reply
+	}
+	if err != nil {
+		return syncError(msg.Ref, err)
+	}
+	if !exists {
+		return syncReply{Type: "error", Ref: msg.Ref, Code: ErrCodeTaskNotFound, Error: "Task not found"}
+	}
+
+	if msg.Type == "delete" {
+		taskOps.Add("delete", 1)
+		return syncReply{Type: "ok", Ref: msg.Ref}
+	}
+	taskOps.Add("update", 1)
+	presented := s.presentTask(task)
+	return syncReply{Type: "ok", Ref: msg.Ref, Task: &presented}
+}
+
+// syncError converts an error from validation or a store mutation to an
+// error reply with the code the HTTP API would use
+func syncError(ref string, err error) syncReply {
+	reply := syncReply{Type: "error", Ref: ref}
+	var verr *validationError
+	switch {
+	case errors.As(err, &verr):
+		reply.Code, reply.Error = verr.code, verr.message
+	case errors.Is(err, ErrProjectNotFound):
+		reply.Code, reply.Error = ErrCodeProjectNotFound, "Project not found"
+	case errors.Is(err, ErrProjectForbidden):
+		reply.Code, reply.Error = ErrCodeForbidden, "Not permitted in this project"
+	case errors.Is(err, ErrQuotaExceeded):
+		reply.Code, reply.Error = ErrCodeQuotaExceeded, "Task quota exceeded"
+	case errors.Is(err, ErrTaskBlocked):
+		reply.Code, reply.Error = ErrCodeTaskBlocked, "Task is blocked by open tasks"
+	case errors.Is(err, ErrTransitionNotAllowed):
+		reply.Code, reply.Error = ErrCodeTransitionNotAllowed, transitionMessage(err)
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		reply.Code, reply.Error = ErrCodeRequestCancelled, "Request cancelled"
+	default:
+		slog.Error("Failed to save tasks", "error", err)
+		reply.Code, reply.Error = ErrCodeSaveFailed, "Failed to save tasks"
+	}
+	return reply
+}
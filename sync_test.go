@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// wsTestClient is a minimal WebSocket client for exercising /api/v1/ws
+type wsTestClient struct {
+	t    *testing.T
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+func dialSync(t *testing.T, server *Server, token string) *wsTestClient {
+	t.Helper()
+	router, err := server.Router()
+	if err != nil {
+		t.Fatalf("Router() error = %v", err)
+	}
+	ts := httptest.NewServer(router)
+	t.Cleanup(ts.Close)
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(ts.URL, "http://"))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	req, _ := http.NewRequest("GET", ts.URL+"/api/v1/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	if token != "" {
+		req.Header.Set("X-API-Token", token)
+	}
+	if err := req.Write(conn); err != nil {
+		t.Fatalf("write handshake: %v", err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		t.Fatalf("read handshake: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake status = %d; want 101", resp.StatusCode)
+	}
+	// Example key and accept value from RFC 6455 section 1.3
+	if accept := resp.Header.Get("Sec-WebSocket-Accept"); accept != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("Sec-WebSocket-Accept = %q", accept)
+	}
+	return &wsTestClient{t: t, conn: conn, br: br}
+}
+
+// send writes v as a masked text frame
+func (c *wsTestClient) send(v interface{}) {
+	c.t.Helper()
+	payload, _ := json.Marshal(v)
+	frame := []byte{0x81}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, 0x80|byte(len(payload)))
+	default:
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	}
+	mask := []byte{1, 2, 3, 4}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := c.conn.Write(frame); err != nil {
+		c.t.Fatalf("send: %v", err)
+	}
+}
+
+// receive reads the next text message, skipping pings
+func (c *wsTestClient) receive() syncReply {
+	c.t.Helper()
+	for {
+		var header [2]byte
+		if _, err := io.ReadFull(c.br, header[:]); err != nil {
+			c.t.Fatalf("receive: %v", err)
+		}
+		length := int(header[1] & 0x7F)
+		if length == 126 {
+			var ext [2]byte
+			io.ReadFull(c.br, ext[:])
+			length = int(binary.BigEndian.Uint16(ext[:]))
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(c.br, payload); err != nil {
+			c.t.Fatalf("receive: %v", err)
+		}
+		if header[0]&0x0F != wsText {
+			continue
+		}
+		var reply syncReply
+		if err := json.Unmarshal(payload, &reply); err != nil {
+			c.t.Fatalf("decode %s: %v", payload, err)
+		}
+		return reply
+	}
+}
+
+func TestSyncSubscribeReceivesChanges(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	c := dialSync(t, server, "")
+	c.send(syncMessage{Type: "subscribe", Ref: "s"})
+	if reply := c.receive(); reply.Type != "subscribed" || reply.Ref != "s" {
+		t.Fatalf("reply = %+v; want subscribed", reply)
+	}
+
+	if _, err := server.store.Add(context.Background(), "Pushed", "", DueTime{}, "medium"); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	reply := c.receive()
+	if reply.Type != "change" || reply.Change == nil || reply.Change.Type != ChangeCreated || reply.Change.Task.Title != "Pushed" {
+		t.Errorf("reply = %+v; want created change for Pushed", reply)
+	}
+}
+
+func TestSyncMutationsRequireToken(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.TokenHashes = []string{hashString("secret")}
+
+	c := dialSync(t, server, "")
+	c.send(map[string]interface{}{"type": "create", "ref": "1", "task": map[string]string{"title": "Nope"}})
+	if reply := c.receive(); reply.Type != "error" || reply.Code != ErrCodeTokenRequired {
+		t.Errorf("reply = %+v; want TOKEN_REQUIRED", reply)
+	}
+
+	c.send(syncMessage{Type: "auth", Token: "wrong"})
+	if reply := c.receive(); reply.Code != ErrCodeInvalidToken {
+		t.Errorf("reply = %+v; want INVALID_TOKEN", reply)
+	}
+	c.send(syncMessage{Type: "auth", Token: "secret"})
+	if reply := c.receive(); reply.Type != "authenticated" {
+		t.Fatalf("reply = %+v; want authenticated", reply)
+	}
+	c.send(map[string]interface{}{"type": "create", "ref": "2", "task": map[string]string{"title": "Yes"}})
+	if reply := c.receive(); reply.Type != "ok" || reply.Ref != "2" || reply.Task == nil || reply.Task.Title != "Yes" {
+		t.Errorf("reply = %+v; want created task", reply)
+	}
+}
+
+func TestSyncPatchConflict(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.TokenHashes = []string{hashString("secret")}
+
+	ctx := context.Background()
+	task, _ := server.store.Add(ctx, "Shared", "", DueTime{}, "medium")
+	base := server.store.Revision()
+
+	c := dialSync(t, server, "secret")
+	patch := func(ref, title string) syncReply {
+		c.send(map[string]interface{}{
+			"type": "patch", "ref": ref, "id": task.ID, "base_revision": base,
+			"task": map[string]string{"title": title},
+		})
+		return c.receive()
+	}
+	if reply := patch("1", "Mine"); reply.Type != "ok" || reply.Task.Title != "Mine" {
+		t.Fatalf("reply = %+v; want ok", reply)
+	}
+
+	// The first patch moved the task past base, so a second patch from the
+	// same base conflicts and gets the current task back
+	reply := patch("2", "Stale")
+	if reply.Type != "conflict" || reply.Code != ErrCodeTaskConflict || reply.Task == nil || reply.Task.Title != "Mine" {
+		t.Errorf("reply = %+v; want conflict with current task", reply)
+	}
+	if current, _ := server.store.Get(task.ID); current.Title != "Mine" {
+		t.Errorf("title = %q; want the conflicting patch not applied", current.Title)
+	}
+
+	c.send(map[string]interface{}{"type": "delete", "ref": "3", "id": task.ID, "base_revision": base})
+	if reply := c.receive(); reply.Type != "conflict" {
+		t.Errorf("reply = %+v; want conflict", reply)
+	}
+	c.send(map[string]interface{}{"type": "delete", "ref": "4", "id": task.ID})
+	if reply := c.receive(); reply.Type != "ok" {
+		t.Errorf("reply = %+v; want ok", reply)
+	}
+}
+
+func TestSyncRespectsDisabledEndpoints(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.TokenHashes = []string{hashString("secret")}
+	server.config.DisabledEndpoints = []string{"tasks.create"}
+
+	c := dialSync(t, server, "secret")
+	c.send(map[string]interface{}{"type": "create", "task": map[string]string{"title": "x"}})
+	if reply := c.receive(); reply.Code != ErrCodeOperationDisabled {
+		t.Errorf("reply = %+v; want OPERATION_DISABLED", reply)
+	}
+}
+
+func TestSyncRejectsPlainRequest(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	req := httptest.NewRequest("GET", "/api/v1/ws", nil)
+	w := httptest.NewRecorder()
+	server.handleSync(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d; want 400", w.Code)
+	}
+	var body struct {
+		Code string `json:"code"`
+	}
+	json.NewDecoder(w.Body).Decode(&body)
+	if body.Code != ErrCodeInvalidUpgrade {
+		t.Errorf("code = %q; want %s", body.Code, ErrCodeInvalidUpgrade)
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// maxTagLength is the longest tag accepted, in runes
+const maxTagLength = 32
+
+// ErrTagNotFound is returned when removing a tag a task doesn't have
+var ErrTagNotFound = errors.New("tag not found")
+
+// tagPolicy normalizes and limits the tags written to tasks
+type tagPolicy struct {
+	// max caps the distinct tags on a task; 0 means no limit
+	max int
+	// preserveCase stores tags as sent instead of lowercased. Matching is
+	// case-insensitive either way.
+	preserveCase bool
+}
+
+// tagKey is the canonical form of a tag used for matching and counting
+func tagKey(tag string) string {
+	return strings.ToLower(tag)
+}
+
+// normalize trims, validates and de-duplicates tags, keeping the first
+// spelling of each. The limit applies after de-duplication, so repeats
+// don't count twice. Errors are *validationError.
+func (p tagPolicy) normalize(tags []string) ([]string, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || strings.Contains(tag, ",") || len([]rune(tag)) > maxTagLength {
+			return nil, &validationError{
+				code:    ErrCodeInvalidTag,
+				message: fmt.Sprintf("Tags must be 1-%d characters without commas", maxTagLength),
+			}
+		}
+		if !p.preserveCase {
+			tag = tagKey(tag)
+		}
+		if seen[tagKey(tag)] {
+			continue
+		}
+		seen[tagKey(tag)] = true
+		normalized = append(normalized, tag)
+	}
+	if p.max > 0 && len(normalized) > p.max {
+		return nil, &validationError{
+			code:    ErrCodeTooManyTags,
+			message: fmt.Sprintf("A task can have at most %d tags", p.max),
+		}
+	}
+	return normalized, nil
+}
+
+// hasTag reports whether task has tag, ignoring case
+func hasTag(task *Task, tag string) bool {
+	key := tagKey(tag)
+	for _, t := range task.Tags {
+		if tagKey(t) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// AddTags adds tags to a task, skipping ones it already has. Like Update,
+// the bool reports whether the task exists.
+func (ts *TaskStore) AddTags(ctx context.Context, id int, tags []string) (*Task, bool, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	task, exists := ts.tasks[id]
+	if !exists {
+		return nil, false, nil
+	}
+	if err := ts.checkProjectLocked(ctx, task.ProjectID, PermissionEdit); err != nil {
+		return nil, true, err
+	}
+	// normalize builds a new slice, so prev and change log snapshots keep
+	// the old one
+	merged, err := ts.tags.normalize(append(append([]string(nil), task.Tags...), tags...))
+	if err != nil {
+		return nil, true, err
+	}
+
+	prev := *task
+	task.Tags = merged
+	task.UpdatedAt = ts.now()
+	if err := ts.save(ctx, id); err != nil {
+		*task = prev
+		return nil, true, fmt.Errorf("save tasks: %w", err)
+	}
+	ts.recordChange(ctx, ChangeUpdated, task)
+	ts.recordMutation(ctx, AuditUpdate, auditTask, id, &prev, task)
+	return task, true, nil
+}
+
+// RemoveTag removes a tag from a task, ignoring case. It returns
+// ErrTagNotFound if the task doesn't have the tag.
+func (ts *TaskStore) RemoveTag(ctx context.Context, id int, tag string) (*Task, bool, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	task, exists := ts.tasks[id]
+	if !exists {
+		return nil, false, nil
+	}
+	if err := ts.checkProjectLocked(ctx, task.ProjectID, PermissionEdit); err != nil {
+		return nil, true, err
+	}
+	if !hasTag(task, tag) {
+		return nil, true, ErrTagNotFound
+	}
+	var remaining []string
+	for _, t := range task.Tags {
+		if tagKey(t) != tagKey(tag) {
+			remaining = append(remaining, t)
+		}
+	}
+
+	prev := *task
+	task.Tags = remaining
+	task.UpdatedAt = ts.now()
+	if err := ts.save(ctx, id); err != nil {
+		*task = prev
+		return nil, true, fmt.Errorf("save tasks: %w", err)
+	}
+	ts.recordChange(ctx, ChangeUpdated, task)
+	ts.recordMutation(ctx, AuditUpdate, auditTask, id, &prev, task)
+	return task, true, nil
+}
+
+// GetByTag returns the tasks with tag, ignoring case, in ID order
+func (ts *TaskStore) GetByTag(tag string) []*Task {
+	return ts.List(TaskFilter{Tags: []string{tag}})
+}
+
+// TagCount is the number of tasks carrying a tag
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// TagCounts returns every tag in use with its task count, most used first
+// (then by tag). Tags differing only in case are counted together under
+// their lowercase form.
+func (ts *TaskStore) TagCounts() []TagCount {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, task := range ts.tasks {
+		for _, tag := range task.Tags {
+			counts[tagKey(tag)]++
+		}
+	}
+
+	result := make([]TagCount, 0, len(counts))
+	for tag, count := range counts {
+		result = append(result, TagCount{Tag: tag, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Tag < result[j].Tag
+	})
+	return result
+}
+
+// handleGetTags returns tag usage counts
+func (s *Server) handleGetTags(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.store.TagCounts())
+}
+
+// tagsRequest is the body of a request adding tags to a task
+type tagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// handleAddTags adds the tags in {"tags": [...]} to a task
+func (s *Server) handleAddTags(w http.ResponseWriter, r *http.Request) {
+	id, err := s.parseTaskID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidTaskID, "Invalid task ID")
+		return
+	}
+	var req tagsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON")
+		return
+	}
+
+	task, exists, err := s.store.AddTags(r.Context(), id, req.Tags)
+	var verr *validationError
+	switch {
+	case errors.As(err, &verr):
+		writeValidationError(w, err)
+		return
+	case err != nil:
+		writeStoreError(w, err)
+		return
+	case !exists:
+		writeError(w, http.StatusNotFound, ErrCodeTaskNotFound, "Task not found")
+		return
+	}
+	taskOps.Add("update", 1)
+	writeJSON(w, http.StatusOK, s.presentTask(task))
+}
+
+// handleRemoveTag removes one tag from a task
+func (s *Server) handleRemoveTag(w http.ResponseWriter, r *http.Request) {
+	id, err := s.parseTaskID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidTaskID, "Invalid task ID")
+		return
+	}
+
+	task, exists, err := s.store.RemoveTag(r.Context(), id, mux.Vars(r)["tag"])
+	switch {
+	case errors.Is(err, ErrTagNotFound):
+		writeError(w, http.StatusNotFound, ErrCodeTagNotFound, "Tag not found")
+		return
+	case err != nil:
+		writeStoreError(w, err)
+		return
+	case !exists:
+		writeError(w, http.StatusNotFound, ErrCodeTaskNotFound, "Task not found")
+		return
+	}
+	taskOps.Add("update", 1)
+	writeJSON(w, http.StatusOK, s.presentTask(task))
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestTagPolicyNormalize(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  tagPolicy
+		tags    []string
+		want    []string
+		wantErr string
+	}{
+		{"lowercases and trims", tagPolicy{}, []string{" Work ", "home"}, []string{"work", "home"}, ""},
+		{"preserves case", tagPolicy{preserveCase: true}, []string{"Work", "work"}, []string{"Work"}, ""},
+		{"duplicates collapse under limit", tagPolicy{max: 2}, []string{"a", "A", "b", "a"}, []string{"a", "b"}, ""},
+		{"over limit", tagPolicy{max: 2}, []string{"a", "b", "c"}, nil, ErrCodeTooManyTags},
+		{"empty tag", tagPolicy{}, []string{" "}, nil, ErrCodeInvalidTag},
+		{"comma", tagPolicy{}, []string{"a,b"}, nil, ErrCodeInvalidTag},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.policy.normalize(tt.tags)
+			if tt.wantErr != "" {
+				verr, ok := err.(*validationError)
+				if !ok || verr.code != tt.wantErr {
+					t.Fatalf("err = %v; want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("normalize: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tags = %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTagFilterIgnoresCase(t *testing.T) {
+	for _, preserve := range []bool{false, true} {
+		server, cleanup := setupTestServer()
+		server.store.tags.preserveCase = preserve
+
+		ctx := context.Background()
+		server.store.Add(ctx, "Report", "", DueTime{}, "medium", "Work")
+		server.store.Add(ctx, "Groceries", "", DueTime{}, "medium", "home")
+
+		w := httptest.NewRecorder()
+		server.handleGetTasks(w, httptest.NewRequest("GET", "/api/v1/tasks?tag=WORK", nil))
+		var tasks []Task
+		if err := json.NewDecoder(w.Body).Decode(&tasks); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		wantTag := "work"
+		if preserve {
+			wantTag = "Work"
+		}
+		if len(tasks) != 1 || tasks[0].Title != "Report" || !reflect.DeepEqual(tasks[0].Tags, []string{wantTag}) {
+			t.Errorf("preserve=%v: tasks = %+v; want Report tagged %q", preserve, tasks, wantTag)
+		}
+		if got := server.store.GetByTag("work"); len(got) != 1 {
+			t.Errorf("preserve=%v: GetByTag = %d tasks; want 1", preserve, len(got))
+		}
+		cleanup()
+	}
+}
+
+func TestAddAndRemoveTags(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.store.tags.max = 2
+	server.store.Add(context.Background(), "Task", "", DueTime{}, "medium", "work")
+
+	add := func(body string) *httptest.ResponseRecorder {
+		req := mux.SetURLVars(httptest.NewRequest("POST", "/api/v1/tasks/1/tags", bytes.NewBufferString(body)),
+			map[string]string{"id": "1"})
+		w := httptest.NewRecorder()
+		server.handleAddTags(w, req)
+		return w
+	}
+	if w := add(`{"tags":["Work","urgent"]}`); w.Code != http.StatusOK {
+		t.Fatalf("add status = %d; want %d", w.Code, http.StatusOK)
+	}
+	if w := add(`{"tags":["later"]}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("add over limit status = %d; want %d", w.Code, http.StatusBadRequest)
+	}
+	task, _ := server.store.Get(1)
+	if !reflect.DeepEqual(task.Tags, []string{"work", "urgent"}) {
+		t.Errorf("tags = %q; want [work urgent]", task.Tags)
+	}
+
+	remove := func(tag string) int {
+		req := mux.SetURLVars(httptest.NewRequest("DELETE", "/api/v1/tasks/1/tags/"+tag, nil),
+			map[string]string{"id": "1", "tag": tag})
+		w := httptest.NewRecorder()
+		server.handleRemoveTag(w, req)
+		return w.Code
+	}
+	if code := remove("URGENT"); code != http.StatusOK {
+		t.Fatalf("remove status = %d; want %d", code, http.StatusOK)
+	}
+	if code := remove("urgent"); code != http.StatusNotFound {
+		t.Fatalf("remove missing tag status = %d; want %d", code, http.StatusNotFound)
+	}
+	task, _ = server.store.Get(1)
+	if !reflect.DeepEqual(task.Tags, []string{"work"}) {
+		t.Errorf("tags = %q; want [work]", task.Tags)
+	}
+}
+
+func TestTagCounts(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.store.tags.preserveCase = true
+
+	ctx := context.Background()
+	server.store.Add(ctx, "One", "", DueTime{}, "medium", "Work", "home")
+	server.store.Add(ctx, "Two", "", DueTime{}, "medium", "work")
+	server.store.Add(ctx, "Three", "", DueTime{}, "medium", "errand")
+
+	w := httptest.NewRecorder()
+	server.handleGetTags(w, httptest.NewRequest("GET", "/api/v1/tags", nil))
+	var counts []TagCount
+	if err := json.NewDecoder(w.Body).Decode(&counts); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	want := []TagCount{{"work", 2}, {"errand", 1}, {"home", 1}}
+	if !reflect.DeepEqual(counts, want) {
+		t.Errorf("counts = %+v; want %+v", counts, want)
+	}
+}
+
+func TestCreateTaskTags(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.TaskDefaults = TaskDefaults{Tags: []string{"inbox"}}
+
+	w := httptest.NewRecorder()
+	server.handleCreateTask(w, httptest.NewRequest("POST", "/api/v1/tasks",
+		bytes.NewBufferString(`{"title":"Tagged","tags":["Work","inbox"]}`)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create status = %d; want %d", w.Code, http.StatusCreated)
+	}
+	var task Task
+	if err := json.NewDecoder(w.Body).Decode(&task); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if !reflect.DeepEqual(task.Tags, []string{"work", "inbox"}) {
+		t.Errorf("tags = %q; want request tags merged with defaults", task.Tags)
+	}
+
+	results := server.store.SearchAll("wor")
+	if len(results) != 1 || !reflect.DeepEqual(results[0].MatchedFields, []string{"tags"}) {
+		t.Errorf("SearchAll = %+v; want a tags match", results)
+	}
+	groups, _ := server.store.StatsGrouped("tag", server.now())
+	if len(groups) != 2 || groups[0].Total != 1 {
+		t.Errorf("groups = %+v; want inbox and work", groups)
+	}
+}
+
+func TestCreateTaskTagLimit(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.store.tags.max = 2
+
+	create := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.handleCreateTask(w, httptest.NewRequest("POST", "/api/v1/tasks", bytes.NewBufferString(body)))
+		return w
+	}
+	// Repeats collapse before the limit is checked
+	if w := create(`{"title":"At limit","tags":["Work","work "," home","HOME"]}`); w.Code != http.StatusCreated {
+		t.Fatalf("create at limit status = %d; want %d: %s", w.Code, http.StatusCreated, w.Body)
+	}
+	w := create(`{"title":"Over limit","tags":["work","home","errand"]}`)
+	var resp struct {
+		Code string `json:"code"`
+	}
+	json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusBadRequest || resp.Code != ErrCodeTooManyTags {
+		t.Errorf("create over limit = %d %s; want %d %s", w.Code, resp.Code, http.StatusBadRequest, ErrCodeTooManyTags)
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// telegramAPI is the Bot API the bot talks to
+	telegramAPI = "https://api.telegram.org"
+	// telegramPollSeconds is how long a getUpdates long poll waits for
+	// messages
+	telegramPollSeconds = 30
+	// telegramRetryInterval is the wait after a failed poll
+	telegramRetryInterval = 5 * time.Second
+)
+
+// telegramHelp is the reply to /start, /help and unknown commands
+const telegramHelp = `Commands:
+/add <title> - Create a task
+/today - List your open tasks due today
+/done <id> - Mark a task completed`
+
+// TelegramConfig controls the Telegram bot. It runs when
+// TASKMATE_TELEGRAM_TOKEN holds a bot token.
+type TelegramConfig struct {
+	// BotToken comes from TASKMATE_TELEGRAM_TOKEN only
+	BotToken string `json:"-"`
+	// Users maps Telegram user IDs to the TaskMate users they act as,
+	// named as in the audit log ("token:<id>" or "user:<subject>"); other
+	// Telegram users are refused
+	Users map[string]string `json:"users,omitempty"`
+}
+
+// validateTelegram checks that the user mapping names TaskMate users
+func validateTelegram(config TelegramConfig) error {
+	for telegramID, user := range config.Users {
+		if _, err := strconv.ParseInt(telegramID, 10, 64); err != nil {
+			return fmt.Errorf("invalid telegram: user ID %q is not a number", telegramID)
+		}
+		if !strings.HasPrefix(user, "token:") && !strings.HasPrefix(user, "user:") {
+			return fmt.Errorf("invalid telegram: %s must map to token:<id> or user:<subject>", telegramID)
+		}
+	}
+	return nil
+}
+
+// actorToken returns what the TaskMate user named actor, as in the audit
+// log, may do: a stored token's role and scopes, or for an OIDC user the
+// role oidc.users gives them, falling back to oidc.default_role and then
+// editor. It fails for a token that no longer exists or has expired.
+func (s *Server) actorToken(actor string) (tokenInfo, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if id, ok := strings.CutPrefix(actor, "token:"); ok {
+		for _, hash := range s.config.TokenHashes {
+			if tokenID(hash) != id {
+				continue
+			}
+			info := s.storedTokenLocked(hash)
+			if !info.expiresAt.IsZero() && !s.now().Before(info.expiresAt) {
+				return tokenInfo{}, false
+			}
+			return info, true
+		}
+		return tokenInfo{}, false
+	}
+	subject, ok := strings.CutPrefix(actor, "user:")
+	if !ok || subject == "" {
+		return tokenInfo{}, false
+	}
+	role, ok := s.config.OIDC.Users[subject]
+	if !ok {
+		role = s.config.OIDC.DefaultRole
+	}
+	if role == "" {
+		role = RoleEditor
+	}
+	return tokenInfo{role: role, scopes: roleScopes(role), subject: subject}, true
+}
+
+// telegramUpdate is the part of a Bot API update the bot reads
+type telegramUpdate struct {
+	UpdateID int64 `json:"update_id"`
+	Message  *struct {
+		From struct {
+			ID int64 `json:"id"`
+		} `json:"from"`
+		Chat struct {
+			ID int64 `json:"id"`
+		} `json:"chat"`
+		Text string `json:"text"`
+	} `json:"message"`
+}
+
+// telegramBot answers chat commands through the Bot API
+type telegramBot struct {
+	server *Server
+	// api is the Bot API base URL including the bot token
+	api    string
+	client *http.Client
+	// offset is the ID of the next update to fetch
+	offset int64
+}
+
+// newTelegramBot returns a bot using token at the Bot API base URL
+func newTelegramBot(server *Server, base, token string) *telegramBot {
+	return &telegramBot{
+		server: server,
+		api:    base + "/bot" + token,
+		client: &http.Client{Timeout: (telegramPollSeconds + 10) * time.Second},
+	}
+}
+
+// call makes a Bot API request with a JSON body and decodes its result
+func (b *telegramBot) call(ctx context.Context, method string, params, result interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", b.api+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := b.client.Do(req)
+	if err != nil {
+		// The error quotes the URL, which holds the bot token
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	var reply struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		return fmt.Errorf("%s: %s", method, resp.Status)
+	}
+	if !reply.OK {
+		return fmt.Errorf("%s: %s", method, reply.Description)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(reply.Result, result)
+}
+
+// poll fetches the pending updates and handles each in turn
+func (b *telegramBot) poll(ctx context.Context) error {
+	var updates []telegramUpdate
+	params := map[string]interface{}{"offset": b.offset, "timeout": telegramPollSeconds, "allowed_updates": []string{"message"}}
+	if err := b.call(ctx, "getUpdates", params, &updates); err != nil {
+		return err
+	}
+	for _, update := range updates {
+		b.offset = update.UpdateID + 1
+		if update.Message == nil || update.Message.Text == "" {
+			continue
+		}
+		reply := b.handle(ctx, strconv.FormatInt(update.Message.From.ID, 10), update.Message.Text)
+		if err := b.call(ctx, "sendMessage", map[string]interface{}{"chat_id": update.Message.Chat.ID, "text": reply}, nil); err != nil {
+			slog.Warn("Telegram reply failed", "error", err)
+		}
+	}
+	return nil
+}
+
+// handle runs the command in text for the Telegram user telegramID and
+// returns the reply
+func (b *telegramBot) handle(ctx context.Context, telegramID, text string) string {
+	s := b.server
+	s.mu.RLock()
+	actor, linked := s.config.Telegram.Users[telegramID]
+	s.mu.RUnlock()
+	if !linked {
+		return fmt.Sprintf("Your Telegram account isn't linked to TaskMate. Ask an admin to add your ID %s to telegram.users.", telegramID)
+	}
+	info, ok := s.actorToken(actor)
+	if !ok {
+		return "The TaskMate user your Telegram account is linked to no longer exists."
+	}
+	ctx = context.WithValue(ctx, tokenKey{}, info)
+
+	command, args, _ := strings.Cut(strings.TrimSpace(text), " ")
+	// In groups, commands may be addressed as /add@SomeBot
+	command, _, _ = strings.Cut(command, "@")
+	args = strings.TrimSpace(args)
+	switch command {
+	case "/add":
+		if !info.hasScope(ScopeTasksWrite) {
+			return "You don't have permission to add tasks."
+		}
+		return b.add(ctx, args)
+	case "/today":
+		if !info.hasScope(ScopeTasksRead) {
+			return "You don't have permission to list tasks."
+		}
+		return b.today(s.actorLocation(actor))
+	case "/done":
+		if !info.hasScope(ScopeTasksWrite) {
+			return "You don't have permission to complete tasks."
+		}
+		return b.done(ctx, args)
+	}
+	return telegramHelp
+}
+
+// add creates a task titled title with the configured defaults
+func (b *telegramBot) add(ctx context.Context, title string) string {
+	s := b.server
+	fields, err := s.newTaskFields(&createTaskRequest{Title: title}, s.location)
+	if err != nil {
+		return "Usage: /add <title>"
+	}
+	task, err := s.store.AddTask(ctx, fields)
+	if errors.Is(err, ErrQuotaExceeded) {
+		return "The task quota is used up."
+	}
+	if errors.Is(err, ErrProjectForbidden) {
+		return "You don't have permission to add tasks to the default project."
+	}
+	if err != nil {
+		slog.Error("Telegram add failed", "error", err)
+		return "Couldn't save the task."
+	}
+	taskOps.Add("create", 1)
+	return fmt.Sprintf("Added #%v: %s", s.publicID(task.ID), task.Title)
+}
+
+// today lists the open tasks due today in loc
+func (b *telegramBot) today(loc *time.Location) string {
+	s := b.server
+	day := s.now().In(loc).Format(dueDateLayout)
+	var lines []string
+	for _, task := range s.store.List(TaskFilter{}) {
+		if task.Status != "completed" && task.DueDate.Day(loc) == day {
+			lines = append(lines, fmt.Sprintf("#%v %s", s.publicID(task.ID), task.Title))
+		}
+	}
+	if len(lines) == 0 {
+		return "Nothing due today."
+	}
+	return "Due today:\n" + strings.Join(lines, "\n")
+}
+
+// done completes the task with the ID in arg
+func (b *telegramBot) done(ctx context.Context, arg string) string {
+	s := b.server
+	id, err := s.decodeTaskID(strings.TrimPrefix(arg, "#"))
+	if err != nil {
+		return "Usage: /done <id>"
+	}
+	task, exists, err := s.store.Patch(ctx, id, map[string]string{"status": "completed"})
+	switch {
+	case errors.Is(err, ErrTaskBlocked):
+		return "That task is blocked by tasks that aren't completed yet."
+	case errors.Is(err, ErrTransitionNotAllowed):
+		return err.Error()
+	case errors.Is(err, ErrProjectForbidden):
+		return "You don't have permission to change tasks in that project."
+	case err != nil:
+		slog.Error("Telegram done failed", "error", err)
+		return "Couldn't save the task."
+	case !exists:
+		return "No such task."
+	}
+	taskOps.Add("update", 1)
+	return fmt.Sprintf("Completed #%v: %s", s.publicID(task.ID), task.Title)
+}
+
+// runTelegramBot answers Telegram messages until ctx is cancelled. It does
+// nothing without a bot token.
+func (s *Server) runTelegramBot(ctx context.Context) {
+	if s.config.Telegram.BotToken == "" {
+		return
+	}
+	bot := newTelegramBot(s, telegramAPI, s.config.Telegram.BotToken)
+	slog.Info("Telegram bot started", "linked_users", len(s.config.Telegram.Users))
+	for ctx.Err() == nil {
+		if err := bot.poll(ctx); err != nil && ctx.Err() == nil {
+			slog.Warn("Telegram poll failed", "error", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(telegramRetryInterval):
+			}
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTelegramCommands(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.location = time.UTC
+	now := time.Date(2024, 3, 11, 9, 0, 0, 0, time.UTC)
+	server.now = func() time.Time { return now }
+	viewer := hashString("viewer-token")
+	server.config.TokenHashes = []string{viewer}
+	server.config.TokenRoles = map[string]string{viewer: RoleViewer}
+	server.config.Telegram.Users = map[string]string{"100": "user:alice", "200": "token:" + tokenID(viewer), "300": "token:gone"}
+	ctx := context.Background()
+	server.store.Add(ctx, "Due today", "", dueIn("2024-03-11", time.UTC), "medium")
+	server.store.Add(ctx, "Due tomorrow", "", dueIn("2024-03-12", time.UTC), "medium")
+	bot := newTelegramBot(server, "", "")
+
+	tests := []struct {
+		from, text string
+		want       string
+	}{
+		{"100", "/add Buy milk", "Added #3: Buy milk"},
+		{"100", "/add", "Usage: /add <title>"},
+		{"100", "/today@TaskMateBot", "Due today:\n#1 Due today"},
+		{"100", "/done 1", "Completed #1: Due today"},
+		{"100", "/today", "Nothing due today."},
+		{"100", "/done 99", "No such task."},
+		{"100", "/done one", "Usage: /done <id>"},
+		{"100", "/help", telegramHelp},
+		{"200", "/add Sneaky", "You don't have permission to add tasks."},
+		{"200", "/today", "Nothing due today."},
+		{"300", "/today", "The TaskMate user your Telegram account is linked to no longer exists."},
+		{"999", "/today", "Your Telegram account isn't linked to TaskMate. Ask an admin to add your ID 999 to telegram.users."},
+	}
+	for _, tt := range tests {
+		if got := bot.handle(ctx, tt.from, tt.text); got != tt.want {
+			t.Errorf("%s %q: reply %q; want %q", tt.from, tt.text, got, tt.want)
+		}
+	}
+
+	// Changes are made as the linked user
+	revisions, _ := server.store.History(1)
+	if len(revisions) == 0 || revisions[0].Actor != "user:alice" {
+		t.Errorf("history of the completed task = %+v; want the newest change by user:alice", revisions)
+	}
+}
+
+func TestTelegramPoll(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.Telegram.Users = map[string]string{"100": "user:alice"}
+
+	var mu sync.Mutex
+	var replies []map[string]interface{}
+	var offsets []float64
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var params map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&params)
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/botsecret/getUpdates":
+			offsets = append(offsets, params["offset"].(float64))
+			w.Write([]byte(`{"ok": true, "result": [
+				{"update_id": 7, "message": {"from": {"id": 100}, "chat": {"id": 55}, "text": "/add Call the bank"}},
+				{"update_id": 8, "edited_message": {}}
+			]}`))
+		case "/botsecret/sendMessage":
+			replies = append(replies, params)
+			w.Write([]byte(`{"ok": true, "result": {}}`))
+		default:
+			w.Write([]byte(`{"ok": false, "description": "Not Found"}`))
+		}
+	}))
+	defer api.Close()
+
+	bot := newTelegramBot(server, api.URL, "secret")
+	if err := bot.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := bot.poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	if len(offsets) != 2 || offsets[0] != 0 || offsets[1] != 9 {
+		t.Errorf("getUpdates offsets = %v; want [0 9]", offsets)
+	}
+	if len(replies) != 2 || replies[0]["chat_id"] != 55.0 || !strings.HasPrefix(replies[0]["text"].(string), "Added #1: Call the bank") {
+		t.Errorf("replies = %v", replies)
+	}
+	mu.Unlock()
+
+	bot = newTelegramBot(server, api.URL, "wrong")
+	if err := bot.poll(context.Background()); err == nil || !strings.Contains(err.Error(), "Not Found") {
+		t.Errorf("poll with a bad token: %v; want the API's description", err)
+	}
+}
+
+func TestValidateTelegram(t *testing.T) {
+	if err := validateTelegram(TelegramConfig{Users: map[string]string{"12345": "user:alice", "678": "token:abc"}}); err != nil {
+		t.Errorf("valid config: %v", err)
+	}
+	for _, users := range []map[string]string{{"alice": "user:alice"}, {"12345": "alice"}} {
+		if err := validateTelegram(TelegramConfig{Users: users}); err == nil {
+			t.Errorf("%v: no error", users)
+		}
+	}
+}
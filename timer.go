@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// TimeEntry is a span of time tracked on a task. IDs are unique within
+// their task only.
+type TimeEntry struct {
+	ID int `json:"id"`
+	// User is who tracked the time, named as in the audit log
+	User  string    `json:"user"`
+	Start time.Time `json:"start"`
+	// End is nil while the timer runs
+	End *time.Time `json:"end,omitempty"`
+}
+
+// Errors returned when starting or stopping a timer
+var (
+	ErrTimerRunning    = errors.New("timer already running")
+	ErrTimerNotRunning = errors.New("no timer running")
+)
+
+// trackedTime adds up the time tracked on task, counting running timers up
+// to now
+func trackedTime(task *Task, now time.Time) time.Duration {
+	var total time.Duration
+	for _, entry := range task.TimeEntries {
+		end := now
+		if entry.End != nil {
+			end = *entry.End
+		}
+		if end.After(entry.Start) {
+			total += end.Sub(entry.Start)
+		}
+	}
+	return total
+}
+
+// runningEntry returns the index of user's running timer in entries, or -1
+func runningEntry(entries []TimeEntry, user string) int {
+	for i, entry := range entries {
+		if entry.End == nil && entry.User == user {
+			return i
+		}
+	}
+	return -1
+}
+
+// changeTimeEntries replaces the task's time entries with the result of
+// change, which gets the current time and must return a new slice, as for
+// changeSubtasks. Like Update, the bool reports whether the task exists.
+func (ts *TaskStore) changeTimeEntries(ctx context.Context, id int, change func(current []TimeEntry, now time.Time) ([]TimeEntry, error)) (*Task, bool, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	task, exists := ts.tasks[id]
+	if !exists {
+		return nil, false, nil
+	}
+	if err := ts.checkProjectLocked(ctx, task.ProjectID, PermissionEdit); err != nil {
+		return nil, true, err
+	}
+	now := ts.now()
+	entries, err := change(task.TimeEntries, now)
+	if err != nil {
+		return nil, true, err
+	}
+
+	prev := *task
+	task.TimeEntries = entries
+	task.UpdatedAt = now
+	if err := ts.save(ctx, id); err != nil {
+		*task = prev
+		return nil, true, fmt.Errorf("save tasks: %w", err)
+	}
+	ts.recordChange(ctx, ChangeUpdated, task)
+	ts.recordMutation(ctx, AuditUpdate, auditTask, id, &prev, task)
+	return task, true, nil
+}
+
+// StartTimer starts a timer on a task for the actor of ctx. It returns
+// ErrTimerRunning if they already have one running on the task.
+func (ts *TaskStore) StartTimer(ctx context.Context, id int) (*TimeEntry, bool, error) {
+	user := auditActor(ctx)
+	var started TimeEntry
+	_, exists, err := ts.changeTimeEntries(ctx, id, func(current []TimeEntry, now time.Time) ([]TimeEntry, error) {
+		if runningEntry(current, user) >= 0 {
+			return nil, ErrTimerRunning
+		}
+		started = TimeEntry{ID: 1, User: user, Start: now}
+		for _, entry := range current {
+			if entry.ID >= started.ID {
+				started.ID = entry.ID + 1
+			}
+		}
+		return append(append(make([]TimeEntry, 0, len(current)+1), current...), started), nil
+	})
+	if err != nil || !exists {
+		return nil, exists, err
+	}
+	return &started, true, nil
+}
+
+// StopTimer stops the actor of ctx's running timer on a task. It returns
+// ErrTimerNotRunning if they have none.
+func (ts *TaskStore) StopTimer(ctx context.Context, id int) (*TimeEntry, bool, error) {
+	user := auditActor(ctx)
+	var stopped TimeEntry
+	_, exists, err := ts.changeTimeEntries(ctx, id, func(current []TimeEntry, now time.Time) ([]TimeEntry, error) {
+		entries := append(make([]TimeEntry, 0, len(current)), current...)
+		i := runningEntry(entries, user)
+		if i < 0 {
+			return nil, ErrTimerNotRunning
+		}
+		end := now
+		entries[i].End = &end
+		stopped = entries[i]
+		return entries, nil
+	})
+	if err != nil || !exists {
+		return nil, exists, err
+	}
+	return &stopped, true, nil
+}
+
+// trackedSpan is time tracked on a task within a timesheet's range
+type trackedSpan struct {
+	TaskID, ProjectID int
+	Title             string
+	Start, End        time.Time
+}
+
+// TrackedSpans returns the time tracked on live and archived tasks between
+// from and to, with entries clipped to that range and running timers
+// counted up to now. A non-empty user limits it to that user's entries.
+func (ts *TaskStore) TrackedSpans(from, to, now time.Time, user string) []trackedSpan {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	var spans []trackedSpan
+	collect := func(task *Task) {
+		for _, entry := range task.TimeEntries {
+			if user != "" && entry.User != user {
+				continue
+			}
+			start, end := entry.Start, now
+			if entry.End != nil {
+				end = *entry.End
+			}
+			if start.Before(from) {
+				start = from
+			}
+			if end.After(to) {
+				end = to
+			}
+			if end.After(start) {
+				spans = append(spans, trackedSpan{TaskID: task.ID, ProjectID: task.ProjectID, Title: task.Title, Start: start, End: end})
+			}
+		}
+	}
+	for _, task := range ts.tasks {
+		collect(task)
+	}
+	for _, task := range ts.archive {
+		collect(task)
+	}
+	return spans
+}
+
+// handleStartTimer starts tracking time on a task for the caller
+func (s *Server) handleStartTimer(w http.ResponseWriter, r *http.Request) {
+	s.handleTimer(w, r, s.store.StartTimer, http.StatusCreated)
+}
+
+// handleStopTimer stops the caller's timer on a task
+func (s *Server) handleStopTimer(w http.ResponseWriter, r *http.Request) {
+	s.handleTimer(w, r, s.store.StopTimer, http.StatusOK)
+}
+
+// handleTimer applies a timer change to the task in the path and responds
+// with the entry it started or stopped
+func (s *Server) handleTimer(w http.ResponseWriter, r *http.Request, change func(context.Context, int) (*TimeEntry, bool, error), status int) {
+	id, err := s.parseTaskID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidTaskID, "Invalid task ID")
+		return
+	}
+	entry, exists, err := change(r.Context(), id)
+	if errors.Is(err, ErrTimerRunning) {
+		writeError(w, http.StatusConflict, ErrCodeTimerRunning, "A timer is already running on this task; stop it first")
+		return
+	}
+	if errors.Is(err, ErrTimerNotRunning) {
+		writeError(w, http.StatusConflict, ErrCodeTimerNotRunning, "No timer is running on this task")
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if !exists {
+		writeError(w, http.StatusNotFound, ErrCodeTaskNotFound, "Task not found")
+		return
+	}
+	writeJSON(w, status, entry)
+}
+
+// timesheetResponse is the body of GET /timesheet
+type timesheetResponse struct {
+	From         string         `json:"from"`
+	To           string         `json:"to"`
+	TotalSeconds int64          `json:"total_seconds"`
+	Days         []timesheetDay `json:"days"`
+}
+
+// timesheetDay is the time tracked on one day, by project
+type timesheetDay struct {
+	Date         string             `json:"date"`
+	TotalSeconds int64              `json:"total_seconds"`
+	Projects     []timesheetProject `json:"projects"`
+}
+
+// timesheetProject is the time tracked on a project's tasks in a day;
+// ProjectID 0 holds the tasks without a project
+type timesheetProject struct {
+	ProjectID int             `json:"project_id"`
+	Name      string          `json:"name,omitempty"`
+	Seconds   int64           `json:"seconds"`
+	Tasks     []timesheetTask `json:"tasks"`
+}
+
+// timesheetTask is the time tracked on a task in a day
+type timesheetTask struct {
+	ID      interface{} `json:"id"`
+	Title   string      `json:"title"`
+	Seconds int64       `json:"seconds"`
+}
+
+// handleGetTimesheet reports the time tracked between ?from= and ?to= in
+// the request's time zone by day, then project, then task; ?user= limits
+// it to one user's time
+func (s *Server) handleGetTimesheet(w http.ResponseWriter, r *http.Request) {
+	loc := s.requestLocation(r)
+	from, to, err := parseDayRange(r.URL.Query(), s.now(), loc, 7)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidQuery, err.Error())
+		return
+	}
+
+	// Split spans at midnight so each day gets its share
+	type timesheetKey struct {
+		day               string
+		projectID, taskID int
+	}
+	seconds := make(map[timesheetKey]int64)
+	titles := make(map[int]string)
+	for _, span := range s.store.TrackedSpans(from, to, s.now(), r.URL.Query().Get("user")) {
+		titles[span.TaskID] = span.Title
+		for start := span.Start; start.Before(span.End); {
+			end := startOfDay(start.In(loc)).AddDate(0, 0, 1)
+			if end.After(span.End) {
+				end = span.End
+			}
+			key := timesheetKey{start.In(loc).Format(dueDateLayout), span.ProjectID, span.TaskID}
+			seconds[key] += int64(end.Sub(start).Seconds())
+			start = end
+		}
+	}
+	keys := make([]timesheetKey, 0, len(seconds))
+	for key := range seconds {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.day != b.day {
+			return a.day < b.day
+		}
+		if a.projectID != b.projectID {
+			return a.projectID < b.projectID
+		}
+		return a.taskID < b.taskID
+	})
+
+	resp := timesheetResponse{
+		From: from.Format(dueDateLayout),
+		To:   to.AddDate(0, 0, -1).Format(dueDateLayout),
+		Days: []timesheetDay{},
+	}
+	for _, key := range keys {
+		if n := len(resp.Days); n == 0 || resp.Days[n-1].Date != key.day {
+			resp.Days = append(resp.Days, timesheetDay{Date: key.day, Projects: []timesheetProject{}})
+		}
+		day := &resp.Days[len(resp.Days)-1]
+		if n := len(day.Projects); n == 0 || day.Projects[n-1].ProjectID != key.projectID {
+			project := timesheetProject{ProjectID: key.projectID, Tasks: []timesheetTask{}}
+			if p, exists := s.store.GetProject(key.projectID); exists {
+				project.Name = p.Name
+			}
+			day.Projects = append(day.Projects, project)
+		}
+		project := &day.Projects[len(day.Projects)-1]
+		tracked := seconds[key]
+		project.Tasks = append(project.Tasks, timesheetTask{ID: s.publicID(key.taskID), Title: titles[key.taskID], Seconds: tracked})
+		project.Seconds += tracked
+		day.TotalSeconds += tracked
+		resp.TotalSeconds += tracked
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
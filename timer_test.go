@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimerEndpoints(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.TokenHashes = []string{hashString("secret-token")}
+	server.store.Add(context.Background(), "Write report", "", DueTime{}, "medium")
+	r, err := server.Router()
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 3, 11, 9, 0, 0, 0, time.UTC)
+	server.store.now = func() time.Time { return start }
+	server.now = func() time.Time { return start.Add(10 * time.Minute) }
+
+	send := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, nil)
+		req.Header.Set("X-API-Token", "secret-token")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	w := send("/api/v1/tasks/1/timer/start")
+	var entry TimeEntry
+	json.NewDecoder(w.Body).Decode(&entry)
+	if w.Code != http.StatusCreated || entry.ID != 1 || entry.User != "token:"+tokenID(hashString("secret-token")) || entry.End != nil {
+		t.Fatalf("start: status %d, entry %+v", w.Code, entry)
+	}
+	if w := send("/api/v1/tasks/1/timer/start"); w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), ErrCodeTimerRunning) {
+		t.Errorf("second start: status %d: %s", w.Code, w.Body.String())
+	}
+
+	task, _ := server.store.Get(1)
+	if got := server.presentTask(task).TrackedSeconds; got != 600 {
+		t.Errorf("tracked_seconds with a running timer = %d; want 600", got)
+	}
+
+	server.store.now = func() time.Time { return start.Add(25 * time.Minute) }
+	w = send("/api/v1/tasks/1/timer/stop")
+	entry = TimeEntry{}
+	json.NewDecoder(w.Body).Decode(&entry)
+	if w.Code != http.StatusOK || entry.End == nil || entry.End.Sub(entry.Start) != 25*time.Minute {
+		t.Fatalf("stop: status %d, entry %+v", w.Code, entry)
+	}
+	if w := send("/api/v1/tasks/1/timer/stop"); w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), ErrCodeTimerNotRunning) {
+		t.Errorf("second stop: status %d: %s", w.Code, w.Body.String())
+	}
+	if w := send("/api/v1/tasks/9/timer/start"); w.Code != http.StatusNotFound {
+		t.Errorf("start on a missing task: status %d; want 404", w.Code)
+	}
+
+	task, _ = server.store.Get(1)
+	if got := server.presentTask(task).TrackedSeconds; got != 1500 || len(task.TimeEntries) != 1 {
+		t.Errorf("tracked_seconds = %d with %d entries; want 1500 with 1", got, len(task.TimeEntries))
+	}
+}
+
+func TestTimesheet(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	store := server.store
+	ctx := context.Background()
+	alice := context.WithValue(ctx, tokenKey{}, tokenInfo{subject: "alice"})
+	project, _ := store.AddProject(ctx, "Website", "")
+	store.Add(ctx, "Landing page", "", DueTime{}, "medium")
+	store.Add(ctx, "Email", "", DueTime{}, "medium")
+	store.PatchIfMatch(ctx, 1, nil, map[string]string{"project_id": "1"})
+
+	at := func(day, hour, minute int) time.Time { return time.Date(2024, 3, day, hour, minute, 0, 0, time.UTC) }
+	track := func(ctx context.Context, id int, from, to time.Time) {
+		store.now = func() time.Time { return from }
+		if _, _, err := store.StartTimer(ctx, id); err != nil {
+			t.Fatal(err)
+		}
+		if !to.IsZero() {
+			store.now = func() time.Time { return to }
+			store.StopTimer(ctx, id)
+		}
+	}
+	track(ctx, 1, at(11, 23, 0), at(12, 1, 30))
+	track(alice, 2, at(12, 9, 0), at(12, 10, 0))
+	track(alice, 1, at(12, 11, 0), time.Time{})
+	server.now = func() time.Time { return at(12, 11, 30) }
+
+	get := func(query string) timesheetResponse {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/api/v1/timesheet"+query, nil)
+		req = req.WithContext(context.WithValue(req.Context(), timeZoneKey{}, time.UTC))
+		w := httptest.NewRecorder()
+		server.handleGetTimesheet(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("timesheet%s: status %d: %s", query, w.Code, w.Body.String())
+		}
+		var resp timesheetResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+		return resp
+	}
+
+	resp := get("?from=2024-03-11&to=2024-03-12")
+	want := []timesheetDay{
+		{Date: "2024-03-11", TotalSeconds: 3600, Projects: []timesheetProject{
+			{ProjectID: project.ID, Name: "Website", Seconds: 3600, Tasks: []timesheetTask{{ID: 1.0, Title: "Landing page", Seconds: 3600}}},
+		}},
+		{Date: "2024-03-12", TotalSeconds: 10800, Projects: []timesheetProject{
+			{ProjectID: 0, Seconds: 3600, Tasks: []timesheetTask{{ID: 2.0, Title: "Email", Seconds: 3600}}},
+			{ProjectID: project.ID, Name: "Website", Seconds: 7200, Tasks: []timesheetTask{{ID: 1.0, Title: "Landing page", Seconds: 7200}}},
+		}},
+	}
+	if resp.TotalSeconds != 14400 || !reflect.DeepEqual(resp.Days, want) {
+		t.Errorf("timesheet = %+v; want %+v", resp, want)
+	}
+
+	resp = get("?from=2024-03-12&to=2024-03-12&user=user:alice")
+	if resp.TotalSeconds != 5400 || len(resp.Days) != 1 || len(resp.Days[0].Projects) != 2 {
+		t.Errorf("alice's timesheet = %+v; want 5400 seconds over two projects on one day", resp)
+	}
+
+	// Without a range, the timesheet covers the last seven days
+	resp = get("")
+	if resp.From != "2024-03-06" || resp.To != "2024-03-12" || resp.TotalSeconds != 14400 {
+		t.Errorf("default timesheet = %s to %s with %d seconds", resp.From, resp.To, resp.TotalSeconds)
+	}
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+const (
+	// certRenewBefore is how long before expiry an ACME certificate is renewed
+	certRenewBefore = 30 * 24 * time.Hour
+	// certObtainTimeout bounds getting a certificate from the ACME server
+	certObtainTimeout = 2 * time.Minute
+	// defaultAutocertCacheDir holds the account key and certificate
+	defaultAutocertCacheDir = "certs"
+)
+
+// TLSConfig serves the API over HTTPS, either with a certificate from files
+// or with one obtained from Let's Encrypt. Config.Port is then the HTTPS
+// port.
+type TLSConfig struct {
+	// CertFile and KeyFile are the PEM certificate chain and private key
+	CertFile string `json:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty"`
+	// AutocertHost is the hostname to get a certificate for from Let's
+	// Encrypt; setting it accepts their terms of service. The ACME
+	// challenge is answered on HTTPPort, which must be reachable as port 80.
+	AutocertHost string `json:"autocert_host,omitempty"`
+	// AutocertEmail is given to Let's Encrypt for expiry notices (optional)
+	AutocertEmail string `json:"autocert_email,omitempty"`
+	// AutocertCacheDir stores the ACME account key and the certificate so
+	// they survive restarts (default: certs)
+	AutocertCacheDir string `json:"autocert_cache_dir,omitempty"`
+	// AutocertDirectoryURL is the ACME server (default: Let's Encrypt
+	// production; use their staging URL for testing)
+	AutocertDirectoryURL string `json:"autocert_directory_url,omitempty"`
+	// HTTPPort also serves plain HTTP, e.g. "80"; with autocert it defaults
+	// to 80. Without RedirectHTTP it serves the API as on the HTTPS port.
+	HTTPPort string `json:"http_port,omitempty"`
+	// RedirectHTTP sends requests on HTTPPort to HTTPS instead
+	RedirectHTTP bool `json:"redirect_http,omitempty"`
+}
+
+// enabled reports whether the API is served over HTTPS
+func (c TLSConfig) enabled() bool {
+	return c.CertFile != "" || c.AutocertHost != ""
+}
+
+// validateTLS checks that HTTPS is configured one way, completely
+func validateTLS(c TLSConfig) error {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return errors.New("cert_file and key_file must be set together")
+	}
+	if c.CertFile != "" && c.AutocertHost != "" {
+		return errors.New("use either cert_file or autocert_host, not both")
+	}
+	if c.RedirectHTTP && !c.enabled() {
+		return errors.New("redirect_http needs cert_file or autocert_host")
+	}
+	return nil
+}
+
+// serveHTTP starts srv as Config.TLS asks: plain HTTP, HTTPS from files, or
+// HTTPS from Let's Encrypt, plus the optional plain HTTP listener. Like
+// http.Server.ListenAndServe it returns http.ErrServerClosed after a
+// shutdown.
+func serveHTTP(srv *http.Server, c TLSConfig) error {
+	if !c.enabled() {
+		return srv.ListenAndServe()
+	}
+
+	plain := srv.Handler
+	if c.RedirectHTTP {
+		plain = httpsRedirect(srv.Addr)
+	}
+	srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	httpPort := c.HTTPPort
+	if c.AutocertHost != "" {
+		certs, err := newCertManager(c)
+		if err != nil {
+			return err
+		}
+		srv.TLSConfig.GetCertificate = certs.GetCertificate
+		plain = certs.challengeHandler(plain)
+		if httpPort == "" {
+			httpPort = "80"
+		}
+	}
+
+	if httpPort != "" {
+		httpSrv := &http.Server{
+			Addr:         ":" + httpPort,
+			Handler:      plain,
+			ReadTimeout:  srv.ReadTimeout,
+			WriteTimeout: srv.WriteTimeout,
+			IdleTimeout:  srv.IdleTimeout,
+		}
+		srv.RegisterOnShutdown(func() { httpSrv.Close() })
+		go func() {
+			if err := httpSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				slog.Error("HTTP listener failed", "port", httpPort, "error", err)
+			}
+		}()
+	}
+	return srv.ListenAndServeTLS(c.CertFile, c.KeyFile)
+}
+
+// httpsRedirect redirects every request to the same URL over HTTPS on the
+// port of httpsAddr. 308 keeps the method and body, so API clients that
+// follow redirects still work.
+func httpsRedirect(httpsAddr string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
+// certManager gets and renews the certificate for TLSConfig.AutocertHost
+// with the ACME http-01 challenge
+type certManager struct {
+	host     string
+	email    string
+	cacheDir string
+	client   *acme.Client
+
+	// obtain serializes getting certificates
+	obtain sync.Mutex
+
+	mu   sync.Mutex
+	cert *tls.Certificate
+	// challenges maps http-01 tokens to their responses
+	challenges map[string]string
+	renewing   bool
+}
+
+// newCertManager loads the ACME account key and any cached certificate,
+// creating the account key if there isn't one
+func newCertManager(c TLSConfig) (*certManager, error) {
+	cacheDir := c.AutocertCacheDir
+	if cacheDir == "" {
+		cacheDir = defaultAutocertCacheDir
+	}
+	cacheDir = dataPath(cacheDir)
+	if err := os.MkdirAll(cacheDir, 0700); err != nil {
+		return nil, err
+	}
+	key, err := loadOrCreateKey(filepath.Join(cacheDir, "acme_account.key"))
+	if err != nil {
+		return nil, fmt.Errorf("acme account key: %w", err)
+	}
+	m := &certManager{
+		host:       c.AutocertHost,
+		email:      c.AutocertEmail,
+		cacheDir:   cacheDir,
+		client:     &acme.Client{Key: key, DirectoryURL: c.AutocertDirectoryURL},
+		challenges: make(map[string]string),
+	}
+	if data, err := os.ReadFile(m.certPath()); err == nil {
+		if cert, err := parseKeyPair(data); err == nil {
+			m.cert = cert
+		}
+	}
+	return m, nil
+}
+
+// parseKeyPair parses a PEM private key and certificate chain, with the
+// leaf certificate parsed too so its expiry can be checked
+func parseKeyPair(data []byte) (*tls.Certificate, error) {
+	cert, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return nil, err
+	}
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+// certPath is where the certificate and its key are cached
+func (m *certManager) certPath() string {
+	return filepath.Join(m.cacheDir, m.host+".pem")
+}
+
+// GetCertificate returns the certificate for the configured host, getting
+// one first if there is none. A certificate close to expiry is still
+// served while a new one is fetched in the background.
+func (m *certManager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if hello.ServerName != "" && !strings.EqualFold(hello.ServerName, m.host) {
+		return nil, fmt.Errorf("no certificate for %q", hello.ServerName)
+	}
+	m.mu.Lock()
+	cert := m.cert
+	renew := cert != nil && !m.renewing && time.Until(cert.Leaf.NotAfter) < certRenewBefore
+	if renew {
+		m.renewing = true
+	}
+	m.mu.Unlock()
+
+	if renew {
+		go func() {
+			if _, err := m.obtainCert(); err != nil {
+				slog.Error("Failed to renew certificate", "host", m.host, "error", err)
+			}
+			m.mu.Lock()
+			m.renewing = false
+			m.mu.Unlock()
+		}()
+	}
+	if cert != nil && time.Now().Before(cert.Leaf.NotAfter) {
+		return cert, nil
+	}
+	return m.obtainCert()
+}
+
+// obtainCert gets a new certificate from the ACME server and caches it. A
+// caller that waited for another to finish gets that certificate instead.
+func (m *certManager) obtainCert() (*tls.Certificate, error) {
+	m.obtain.Lock()
+	defer m.obtain.Unlock()
+	m.mu.Lock()
+	current := m.cert
+	m.mu.Unlock()
+	if current != nil && time.Until(current.Leaf.NotAfter) >= certRenewBefore {
+		return current, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), certObtainTimeout)
+	defer cancel()
+	account := &acme.Account{}
+	if m.email != "" {
+		account.Contact = []string{"mailto:" + m.email}
+	}
+	if _, err := m.client.Register(ctx, account, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return nil, fmt.Errorf("register acme account: %w", err)
+	}
+
+	order, err := m.client.AuthorizeOrder(ctx, acme.DomainIDs(m.host))
+	if err != nil {
+		return nil, err
+	}
+	for _, url := range order.AuthzURLs {
+		if err := m.authorize(ctx, url); err != nil {
+			return nil, err
+		}
+	}
+	if order, err = m.client.WaitOrder(ctx, order.URI); err != nil {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: []string{m.host}}, key)
+	if err != nil {
+		return nil, err
+	}
+	chain, _, err := m.client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := m.storeCert(key, chain)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("Obtained certificate", "host", m.host, "valid_until", cert.Leaf.NotAfter)
+	return cert, nil
+}
+
+// authorize proves control of the host for one authorization by answering
+// its http-01 challenge
+func (m *certManager) authorize(ctx context.Context, url string) error {
+	authz, err := m.client.GetAuthorization(ctx, url)
+	if err != nil {
+		return err
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+	var challenge *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == "http-01" {
+			challenge = c
+		}
+	}
+	if challenge == nil {
+		return errors.New("acme server offered no http-01 challenge")
+	}
+	response, err := m.client.HTTP01ChallengeResponse(challenge.Token)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.challenges[challenge.Token] = response
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.challenges, challenge.Token)
+		m.mu.Unlock()
+	}()
+
+	if _, err := m.client.Accept(ctx, challenge); err != nil {
+		return err
+	}
+	_, err = m.client.WaitAuthorization(ctx, authz.URI)
+	return err
+}
+
+// storeCert caches key and chain on disk and makes them the current
+// certificate
+func (m *certManager) storeCert(key *ecdsa.PrivateKey, chain [][]byte) (*tls.Certificate, error) {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	for _, der := range chain {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	cert, err := parseKeyPair(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(m.certPath(), data, 0600); err != nil {
+		return nil, err
+	}
+	m.mu.Lock()
+	m.cert = cert
+	m.mu.Unlock()
+	return cert, nil
+}
+
+// challengeHandler answers http-01 challenges in progress and passes every
+// other request to next
+func (m *certManager) challengeHandler(next http.Handler) http.Handler {
+	const prefix = "/.well-known/acme-challenge/"
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, prefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		m.mu.Lock()
+		response, ok := m.challenges[strings.TrimPrefix(r.URL.Path, prefix)]
+		m.mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte(response))
+	})
+}
+
+// loadOrCreateKey reads a PEM EC private key from path, or generates one
+// and writes it there
+func loadOrCreateKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("%s: no PEM data", path)
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return key, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestValidateTLS(t *testing.T) {
+	tests := []struct {
+		name   string
+		config TLSConfig
+		valid  bool
+	}{
+		{"disabled", TLSConfig{}, true},
+		{"files", TLSConfig{CertFile: "cert.pem", KeyFile: "key.pem", RedirectHTTP: true, HTTPPort: "80"}, true},
+		{"autocert", TLSConfig{AutocertHost: "tasks.example.com"}, true},
+		{"cert without key", TLSConfig{CertFile: "cert.pem"}, false},
+		{"files and autocert", TLSConfig{CertFile: "cert.pem", KeyFile: "key.pem", AutocertHost: "tasks.example.com"}, false},
+		{"redirect without tls", TLSConfig{RedirectHTTP: true}, false},
+	}
+	for _, tt := range tests {
+		if err := validateTLS(tt.config); (err == nil) != tt.valid {
+			t.Errorf("%s: validateTLS() error = %v; want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestHTTPSRedirect(t *testing.T) {
+	tests := []struct {
+		addr, host, want string
+	}{
+		{":443", "tasks.example.com", "https://tasks.example.com/api/v1/tasks?status=open"},
+		{":8443", "tasks.example.com:8080", "https://tasks.example.com:8443/api/v1/tasks?status=open"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/api/v1/tasks?status=open", nil)
+		req.Host = tt.host
+		httpsRedirect(tt.addr).ServeHTTP(w, req)
+		if w.Code != http.StatusPermanentRedirect || w.Header().Get("Location") != tt.want {
+			t.Errorf("addr %s: status %d, Location %q; want 308 %q", tt.addr, w.Code, w.Header().Get("Location"), tt.want)
+		}
+	}
+}
+
+// selfSignedChain returns a certificate for host valid until notAfter
+func selfSignedChain(t *testing.T, host string, notAfter time.Time) (*ecdsa.PrivateKey, [][]byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error = %v", err)
+	}
+	return key, [][]byte{der}
+}
+
+func TestCertManagerUsesCachedCertificate(t *testing.T) {
+	config := TLSConfig{AutocertHost: "tasks.example.com", AutocertCacheDir: t.TempDir()}
+	m, err := newCertManager(config)
+	if err != nil {
+		t.Fatalf("newCertManager() error = %v", err)
+	}
+	key, chain := selfSignedChain(t, "tasks.example.com", time.Now().Add(90*24*time.Hour))
+	if _, err := m.storeCert(key, chain); err != nil {
+		t.Fatalf("storeCert() error = %v", err)
+	}
+
+	// A restarted server picks up the cached certificate and account key
+	// without contacting the ACME server
+	m, err = newCertManager(config)
+	if err != nil {
+		t.Fatalf("newCertManager() after restart error = %v", err)
+	}
+	cert, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "tasks.example.com"})
+	if err != nil {
+		t.Fatalf("GetCertificate() error = %v", err)
+	}
+	if cert.Leaf == nil || cert.Leaf.Subject.CommonName != "tasks.example.com" {
+		t.Errorf("GetCertificate() leaf = %v; want the cached certificate", cert.Leaf)
+	}
+	if _, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "other.example.com"}); err == nil {
+		t.Error("GetCertificate() returned a certificate for another host")
+	}
+}
+
+func TestChallengeHandler(t *testing.T) {
+	m := &certManager{challenges: map[string]string{"tok": "tok.thumbprint"}}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	handler := m.challengeHandler(next)
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/.well-known/acme-challenge/tok", http.StatusOK, "tok.thumbprint"},
+		{"/.well-known/acme-challenge/other", http.StatusNotFound, ""},
+		{"/api/v1/tasks", http.StatusTeapot, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.code || (tt.body != "" && w.Body.String() != tt.body) {
+			t.Errorf("GET %s: status %d, body %q; want %d %q", tt.path, w.Code, w.Body.String(), tt.code, tt.body)
+		}
+	}
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// lastUsedGranularity limits how often a token's last use is written to
+// config.json; last_used is accurate to within this interval
+const lastUsedGranularity = time.Hour
+
+// TokenMetadata is what is known about a stored token besides its hash
+// and role
+type TokenMetadata struct {
+	Label     string     `json:"label,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	LastUsed  *time.Time `json:"last_used,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// expiresAt returns when the token expires, or zero if it never does
+func (m TokenMetadata) expiresAt() time.Time {
+	if m.ExpiresAt == nil {
+		return time.Time{}
+	}
+	return *m.ExpiresAt
+}
+
+// tokenTTL returns how long stored tokens stay valid, or 0 if they don't
+// expire
+func (c *Config) tokenTTL() time.Duration {
+	return time.Duration(c.TokenTTLMinutes) * time.Minute
+}
+
+// tokenResponse is the body returned for a newly issued token. This is the
+// only time the token itself is shown. Scopes are listed only for tokens
+// limited to them.
+func tokenResponse(token, id, role string, scopes []string, expiresAt time.Time) map[string]interface{} {
+	response := map[string]interface{}{
+		"token":   token,
+		"id":      id,
+		"role":    role,
+		"message": "Token generated successfully. Save this token securely, it won't be shown again.",
+	}
+	if scopes != nil {
+		response["scopes"] = scopes
+	}
+	if !expiresAt.IsZero() {
+		response["expires_at"] = expiresAt.UTC().Format(time.RFC3339)
+	}
+	return response
+}
+
+// storeTokenLocked adds a token hash with its role, scopes (nil for all
+// those of the role) and metadata and saves the config, first removing the
+// token with hash replace if that isn't empty. The token works in the
+// server's workspace only. The config is left unchanged if the save fails.
+// The caller must hold s.mu for writing.
+func (s *Server) storeTokenLocked(hash, role string, scopes []string, label, replace string) (TokenMetadata, error) {
+	now := s.now()
+	meta := TokenMetadata{Label: label, CreatedAt: now}
+	if ttl := s.config.tokenTTL(); ttl > 0 {
+		expiresAt := now.Add(ttl)
+		meta.ExpiresAt = &expiresAt
+	}
+
+	prev := *s.config
+	s.config.TokenHashes = make([]string, 0, len(prev.TokenHashes)+1)
+	for _, storedHash := range prev.TokenHashes {
+		if storedHash != replace {
+			s.config.TokenHashes = append(s.config.TokenHashes, storedHash)
+		}
+	}
+	s.config.TokenHashes = append(s.config.TokenHashes, hash)
+	s.config.TokenRoles = make(map[string]string, len(prev.TokenRoles)+1)
+	for storedHash, storedRole := range prev.TokenRoles {
+		if storedHash != replace {
+			s.config.TokenRoles[storedHash] = storedRole
+		}
+	}
+	s.config.TokenRoles[hash] = role
+	s.config.TokenScopes = make(map[string][]string, len(prev.TokenScopes)+1)
+	for storedHash, storedScopes := range prev.TokenScopes {
+		if storedHash != replace {
+			s.config.TokenScopes[storedHash] = storedScopes
+		}
+	}
+	if scopes != nil {
+		s.config.TokenScopes[hash] = scopes
+	}
+	s.config.TokenMetadata = make(map[string]TokenMetadata, len(prev.TokenMetadata)+1)
+	for storedHash, storedMeta := range prev.TokenMetadata {
+		if storedHash != replace {
+			s.config.TokenMetadata[storedHash] = storedMeta
+		}
+	}
+	s.config.TokenMetadata[hash] = meta
+	s.config.TokenWorkspaces = make(map[string]string, len(prev.TokenWorkspaces)+1)
+	for storedHash, workspace := range prev.TokenWorkspaces {
+		if storedHash != replace {
+			s.config.TokenWorkspaces[storedHash] = workspace
+		}
+	}
+	if s.workspace != "" {
+		s.config.TokenWorkspaces[hash] = s.workspace
+	}
+	if err := SaveConfig(s.config); err != nil {
+		*s.config = prev
+		return TokenMetadata{}, err
+	}
+	return meta, nil
+}
+
+// dropTokensLocked removes the stored tokens whose hash drop reports,
+// with their roles, scopes, metadata and workspaces. The maps are replaced
+// rather than changed, so a copy of the config taken before still restores
+// it. The caller must hold s.mu for writing and save the config.
+func (s *Server) dropTokensLocked(drop func(hash string) bool) {
+	prev := *s.config
+	s.config.TokenHashes = make([]string, 0, len(prev.TokenHashes))
+	for _, hash := range prev.TokenHashes {
+		if !drop(hash) {
+			s.config.TokenHashes = append(s.config.TokenHashes, hash)
+		}
+	}
+	s.config.TokenRoles = make(map[string]string, len(prev.TokenRoles))
+	for hash, role := range prev.TokenRoles {
+		if !drop(hash) {
+			s.config.TokenRoles[hash] = role
+		}
+	}
+	s.config.TokenScopes = make(map[string][]string, len(prev.TokenScopes))
+	for hash, scopes := range prev.TokenScopes {
+		if !drop(hash) {
+			s.config.TokenScopes[hash] = scopes
+		}
+	}
+	s.config.TokenMetadata = make(map[string]TokenMetadata, len(prev.TokenMetadata))
+	for hash, meta := range prev.TokenMetadata {
+		if !drop(hash) {
+			s.config.TokenMetadata[hash] = meta
+		}
+	}
+	s.config.TokenWorkspaces = make(map[string]string, len(prev.TokenWorkspaces))
+	for hash, workspace := range prev.TokenWorkspaces {
+		if !drop(hash) {
+			s.config.TokenWorkspaces[hash] = workspace
+		}
+	}
+}
+
+// revokeJWTLocked adds subject to the revoked JWTs, dropping entries whose
+// JWTs have expired since. The caller must hold s.mu for writing and save
+// the config.
+func (s *Server) revokeJWTLocked(subject string, now time.Time) {
+	revoked := map[string]int64{subject: now.Add(s.config.jwtTTL()).Unix()}
+	for storedSubject, expiresAt := range s.config.RevokedJWTs {
+		if expiresAt > now.Unix() {
+			revoked[storedSubject] = expiresAt
+		}
+	}
+	s.config.RevokedJWTs = revoked
+}
+
+// tokenID returns the public ID of a stored token: the same short
+// fingerprint of its hash that the admin config shows
+func tokenID(hash string) string {
+	return hashString(hash)[:8]
+}
+
+// touchToken records that the token with hash was just used. The write to
+// config.json is skipped if the recorded use is recent enough.
+func (s *Server) touchToken(hash string) {
+	if hash == "" {
+		return
+	}
+	now := s.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	meta := s.config.TokenMetadata[hash]
+	if meta.LastUsed != nil && now.Sub(*meta.LastUsed) < lastUsedGranularity {
+		return
+	}
+	meta.LastUsed = &now
+	if s.config.TokenMetadata == nil {
+		s.config.TokenMetadata = make(map[string]TokenMetadata)
+	}
+	s.config.TokenMetadata[hash] = meta
+	// The use is still recorded in memory if the save fails
+	if err := SaveConfig(s.config); err != nil {
+		slog.Error("Failed to save token last use", "error", err)
+	}
+}
+
+// jwtRevoked reports whether the JWT with subject has been revoked
+func (s *Server) jwtRevoked(subject string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, revoked := s.config.RevokedJWTs[subject]
+	return revoked
+}
+
+// tokenListItem is a stored token as shown by GET /auth/tokens
+type tokenListItem struct {
+	ID        string     `json:"id"`
+	Label     string     `json:"label,omitempty"`
+	Workspace string     `json:"workspace,omitempty"`
+	Role      string     `json:"role"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	LastUsed  *time.Time `json:"last_used,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// handleListTokens lists the stored tokens in the order they were issued.
+// Tokens issued before metadata was kept have no created_at or label, and
+// those of other workspaces than the default name theirs. JWTs aren't
+// stored and so aren't listed.
+func (s *Server) handleListTokens(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	items := make([]tokenListItem, len(s.config.TokenHashes))
+	for i, hash := range s.config.TokenHashes {
+		item := tokenListItem{ID: tokenID(hash), Role: RoleAdmin}
+		if role, ok := s.config.TokenRoles[hash]; ok {
+			item.Role = role
+		}
+		item.Scopes = s.config.TokenScopes[hash]
+		if item.Scopes == nil {
+			item.Scopes = roleScopes(item.Role)
+		}
+		meta := s.config.TokenMetadata[hash]
+		item.Label, item.LastUsed, item.ExpiresAt = meta.Label, meta.LastUsed, meta.ExpiresAt
+		item.Workspace = s.config.TokenWorkspaces[hash]
+		if !meta.CreatedAt.IsZero() {
+			createdAt := meta.CreatedAt
+			item.CreatedAt = &createdAt
+		}
+		items[i] = item
+	}
+	s.mu.RUnlock()
+
+	writeJSON(w, http.StatusOK, items)
+}
+
+// handleRevokeToken deletes a stored token by its ID, or revokes a JWT by
+// its sub claim. Revoked JWT subjects are kept until the JWT would have
+// expired anyway.
+func (s *Server) handleRevokeToken(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	now := s.now()
+
+	s.mu.Lock()
+	prev := *s.config
+	if strings.HasPrefix(id, "tok_") {
+		if s.config.JWTSecret == "" {
+			s.mu.Unlock()
+			writeError(w, http.StatusNotFound, ErrCodeTokenNotFound, "Token not found")
+			return
+		}
+		s.revokeJWTLocked(id, now)
+	} else {
+		var hash string
+		for _, storedHash := range prev.TokenHashes {
+			if tokenID(storedHash) == id {
+				hash = storedHash
+			}
+		}
+		if hash == "" {
+			s.mu.Unlock()
+			writeError(w, http.StatusNotFound, ErrCodeTokenNotFound, "Token not found")
+			return
+		}
+		s.dropTokensLocked(func(storedHash string) bool { return storedHash == hash })
+	}
+	if err := SaveConfig(s.config); err != nil {
+		*s.config = prev
+		s.mu.Unlock()
+		writeError(w, http.StatusInternalServerError, ErrCodeSaveFailed, "Failed to save tokens")
+		return
+	}
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleRefreshToken replaces the request's token with a new one with the
+// same role, scopes and label and a fresh expiry. The old token stops working
+// straight away, so clients can rotate tokens before they expire without an
+// admin. An already expired token can't be refreshed.
+func (s *Server) handleRefreshToken(w http.ResponseWriter, r *http.Request) {
+	info := requestToken(r)
+	now := s.now()
+
+	if info.subject != "" {
+		token, claims, err := issueJWT(s.config, info.role, info.scopes, now)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to generate token")
+			return
+		}
+		s.mu.Lock()
+		prev := *s.config
+		s.revokeJWTLocked(info.subject, now)
+		if err := SaveConfig(s.config); err != nil {
+			*s.config = prev
+			s.mu.Unlock()
+			writeError(w, http.StatusInternalServerError, ErrCodeSaveFailed, "Failed to save tokens")
+			return
+		}
+		s.mu.Unlock()
+		writeJSON(w, http.StatusCreated, tokenResponse(token, claims.Subject, info.role, claims.Scopes, time.Unix(claims.ExpiresAt, 0)))
+		return
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to generate token")
+		return
+	}
+	tokenHash := hashString(token)
+
+	s.mu.Lock()
+	// A concurrent refresh or revocation may have removed the old token
+	stillValid := false
+	for _, storedHash := range s.config.TokenHashes {
+		stillValid = stillValid || storedHash == info.hash
+	}
+	if !stillValid {
+		s.mu.Unlock()
+		writeError(w, http.StatusUnauthorized, ErrCodeInvalidToken, "Invalid token")
+		return
+	}
+	scopes := s.config.TokenScopes[info.hash]
+	meta, err := s.storeTokenLocked(tokenHash, info.role, scopes, s.config.TokenMetadata[info.hash].Label, info.hash)
+	s.mu.Unlock()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrCodeSaveFailed, "Failed to save token")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, tokenResponse(token, tokenID(tokenHash), info.role, scopes, meta.expiresAt()))
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestListAndRevokeTokens(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	server.now = func() time.Time { return now }
+	// A token from before metadata was kept
+	server.config.TokenHashes = []string{hashString("legacy")}
+	r, err := server.Router()
+	if err != nil {
+		t.Fatalf("Router() error = %v", err)
+	}
+
+	do := func(method, path, body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		if token != "" {
+			req.Header.Set("X-API-Token", token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("POST", "/api/v1/auth/token", `{"label":"ci","role":"viewer"}`, "")
+	var issued map[string]string
+	json.NewDecoder(w.Body).Decode(&issued)
+	if w.Code != http.StatusCreated || issued["id"] == "" {
+		t.Fatalf("issue: status %d, body %v", w.Code, issued)
+	}
+
+	now = now.Add(time.Minute)
+	do("GET", "/api/v1/auth/verify", "", issued["token"])
+
+	w = do("GET", "/api/v1/auth/tokens", "", "legacy")
+	var items []tokenListItem
+	if err := json.NewDecoder(w.Body).Decode(&items); err != nil {
+		t.Fatalf("decode list: %v", err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("listed %d tokens; want 2", len(items))
+	}
+	if items[0].ID != tokenID(hashString("legacy")) || items[0].Role != RoleAdmin || items[0].CreatedAt != nil {
+		t.Errorf("legacy token = %+v; want admin without created_at", items[0])
+	}
+	got := items[1]
+	if got.ID != issued["id"] || got.Label != "ci" || got.Role != RoleViewer {
+		t.Errorf("issued token = %+v; want id %s, label ci, viewer", got, issued["id"])
+	}
+	if got.CreatedAt == nil || !got.CreatedAt.Equal(now.Add(-time.Minute)) {
+		t.Errorf("created_at = %v; want %v", got.CreatedAt, now.Add(-time.Minute))
+	}
+	if got.LastUsed == nil || !got.LastUsed.Equal(now) {
+		t.Errorf("last_used = %v; want %v", got.LastUsed, now)
+	}
+
+	if w := do("GET", "/api/v1/auth/tokens", "", issued["token"]); w.Code != http.StatusForbidden {
+		t.Errorf("list as viewer: status %d; want 403", w.Code)
+	}
+	if w := do("DELETE", "/api/v1/auth/tokens/"+issued["id"], "", "legacy"); w.Code != http.StatusNoContent {
+		t.Fatalf("revoke: status %d; want 204", w.Code)
+	}
+	if w := do("GET", "/api/v1/auth/verify", "", issued["token"]); w.Code != http.StatusUnauthorized {
+		t.Errorf("revoked token: status %d; want 401", w.Code)
+	}
+	if w := do("DELETE", "/api/v1/auth/tokens/"+issued["id"], "", "legacy"); w.Code != http.StatusNotFound {
+		t.Errorf("revoke again: status %d; want 404", w.Code)
+	}
+}
+
+func TestRevokeJWT(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.JWTSecret = "test-secret"
+	r, _ := server.Router()
+
+	admin, _, _ := issueJWT(server.config, RoleAdmin, nil, server.now())
+	editor, claims, _ := issueJWT(server.config, RoleEditor, nil, server.now())
+
+	req := httptest.NewRequest("DELETE", "/api/v1/auth/tokens/"+claims.Subject, nil)
+	req.Header.Set("X-API-Token", admin)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("revoke JWT: status %d; want 204", w.Code)
+	}
+
+	if _, err := server.lookupToken(editor); err != errInvalidToken {
+		t.Errorf("lookupToken(revoked) error = %v; want %v", err, errInvalidToken)
+	}
+	if _, err := server.lookupToken(admin); err != nil {
+		t.Errorf("lookupToken(admin) error = %v; other JWTs should still work", err)
+	}
+}
+
+func TestTokenExpiryAndRefresh(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	now := time.Date(2024, 1, 10, 12, 0, 0, 0, time.UTC)
+	server.now = func() time.Time { return now }
+	server.config.TokenTTLMinutes = 60
+	r, _ := server.Router()
+
+	do := func(method, path, body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		if token != "" {
+			req.Header.Set("X-API-Token", token)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	decode := func(w *httptest.ResponseRecorder) map[string]string {
+		var body map[string]string
+		json.NewDecoder(w.Body).Decode(&body)
+		return body
+	}
+
+	issued := decode(do("POST", "/api/v1/auth/token", `{"label":"ci","role":"admin"}`, ""))
+	if want := now.Add(time.Hour).Format(time.RFC3339); issued["expires_at"] != want {
+		t.Fatalf("expires_at = %q; want %q", issued["expires_at"], want)
+	}
+
+	now = now.Add(50 * time.Minute)
+	w := do("POST", "/api/v1/auth/token/refresh", "", issued["token"])
+	if w.Code != http.StatusCreated {
+		t.Fatalf("refresh: status %d; want 201", w.Code)
+	}
+	refreshed := decode(w)
+	if refreshed["role"] != RoleAdmin || refreshed["id"] == issued["id"] {
+		t.Errorf("refreshed = %v; want a new admin token", refreshed)
+	}
+	if want := now.Add(time.Hour).Format(time.RFC3339); refreshed["expires_at"] != want {
+		t.Errorf("refreshed expires_at = %q; want %q", refreshed["expires_at"], want)
+	}
+	if w := do("GET", "/api/v1/auth/verify", "", issued["token"]); w.Code != http.StatusUnauthorized {
+		t.Errorf("old token after refresh: status %d; want 401", w.Code)
+	}
+
+	var items []tokenListItem
+	json.NewDecoder(do("GET", "/api/v1/auth/tokens", "", refreshed["token"]).Body).Decode(&items)
+	if len(items) != 1 || items[0].ID != refreshed["id"] || items[0].Label != "ci" || items[0].ExpiresAt == nil {
+		t.Errorf("tokens = %+v; want only the refreshed token, labelled ci, with an expiry", items)
+	}
+
+	now = now.Add(time.Hour)
+	w = do("POST", "/api/v1/auth/token/refresh", "", refreshed["token"])
+	if w.Code != http.StatusUnauthorized || decode(w)["code"] != ErrCodeTokenExpired {
+		t.Errorf("refresh expired token: status %d; want 401 TOKEN_EXPIRED", w.Code)
+	}
+}
+
+func TestRefreshJWT(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.JWTSecret = "test-secret"
+	r, _ := server.Router()
+
+	old, _, _ := issueJWT(server.config, RoleViewer, nil, server.now())
+	req := httptest.NewRequest("POST", "/api/v1/auth/token/refresh", nil)
+	req.Header.Set("X-API-Token", old)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("refresh: status %d; want 201", w.Code)
+	}
+	var body map[string]string
+	json.NewDecoder(w.Body).Decode(&body)
+
+	if _, err := server.lookupToken(old); err != errInvalidToken {
+		t.Errorf("lookupToken(old) error = %v; want %v", err, errInvalidToken)
+	}
+	info, err := server.lookupToken(body["token"])
+	if err != nil || info.role != RoleViewer {
+		t.Errorf("lookupToken(new) = %+v, %v; want viewer", info, err)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// tracing exports spans when tracing is configured, and is nil otherwise
+var tracing *sdktrace.TracerProvider
+
+// newTracingFromEnv sets up the OpenTelemetry SDK with an OTLP exporter,
+// configured by the standard environment variables. It returns nil when no
+// OTLP endpoint is set or OTEL_SDK_DISABLED is true. Spans are sent in
+// batches and, unless a traceparent header says otherwise, every request
+// is sampled.
+func newTracingFromEnv(ctx context.Context) (*sdktrace.TracerProvider, error) {
+	if strings.EqualFold(os.Getenv("OTEL_SDK_DISABLED"), "true") {
+		return nil, nil
+	}
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return nil, nil
+	}
+	protocol := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL")
+	if protocol == "" {
+		protocol = os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL")
+	}
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch protocol {
+	case "", "http/protobuf":
+		exporter, err = otlptracehttp.New(ctx)
+	case "grpc":
+		exporter, err = otlptracegrpc.New(ctx)
+	default:
+		return nil, fmt.Errorf("OTLP protocol %q is not supported (want http/protobuf or grpc)", protocol)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create OTLP exporter: %w", err)
+	}
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the default
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", "taskmate")),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("read OpenTelemetry resource: %w", err)
+	}
+	return sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res)), nil
+}
+
+// tracer returns the tracer TaskMate's own spans are started from, one
+// that records nothing while tracing is off
+func tracer() trace.Tracer {
+	if tracing == nil {
+		return noop.NewTracerProvider().Tracer("taskmate")
+	}
+	return tracing.Tracer("taskmate")
+}
+
+// startSpan starts an internal span named name as a child of the span in
+// ctx
+func startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return tracer().Start(ctx, name, trace.WithSpanKind(trace.SpanKindInternal))
+}
+
+// spanError marks span as failed with err, if there is one
+func spanError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// tracingMiddleware starts a server span for every request with otelhttp,
+// continuing the trace of an incoming traceparent header, e.g. from an API
+// gateway. The span is named after the route once one matches (see
+// traceRoute).
+func tracingMiddleware(next http.Handler) http.Handler {
+	if tracing == nil {
+		return next
+	}
+	return otelhttp.NewHandler(next, "http.server",
+		otelhttp.WithTracerProvider(tracing),
+		otelhttp.WithPropagators(propagation.TraceContext{}),
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method
+		}),
+	)
+}
+
+// traceRoute names the request's span after its route, e.g.
+// "GET /api/v1/tasks/{id}"
+func traceRoute(method, route string, next http.HandlerFunc) http.HandlerFunc {
+	if tracing == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		span := trace.SpanFromContext(r.Context())
+		span.SetName(method + " " + route)
+		span.SetAttributes(attribute.String("http.route", route))
+		next(w, r)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeCollector records the spans POSTed to it over OTLP/HTTP
+type fakeCollector struct {
+	*httptest.Server
+	mu      sync.Mutex
+	headers http.Header
+	spans   []*tracepb.Span
+	service string
+}
+
+func newFakeCollector(t *testing.T) *fakeCollector {
+	c := &fakeCollector{}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		var req coltracepb.ExportTraceServiceRequest
+		if r.URL.Path != "/v1/traces" || err != nil || proto.Unmarshal(body, &req) != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.headers = r.Header
+		for _, rs := range req.ResourceSpans {
+			for _, attr := range rs.Resource.Attributes {
+				if attr.Key == "service.name" {
+					c.service = attr.Value.GetStringValue()
+				}
+			}
+			for _, ss := range rs.ScopeSpans {
+				c.spans = append(c.spans, ss.Spans...)
+			}
+		}
+		w.Header().Set("Content-Type", "application/x-protobuf")
+	}))
+	t.Cleanup(c.Close)
+	return c
+}
+
+// useTracing makes the tracing configured by env active until the test
+// ends
+func useTracing(t *testing.T, env map[string]string) {
+	t.Helper()
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+	tp, err := newTracingFromEnv(context.Background())
+	if err != nil || tp == nil {
+		t.Fatalf("newTracingFromEnv() = %v, %v; want tracing on", tp, err)
+	}
+	tracing = tp
+	t.Cleanup(func() {
+		tp.Shutdown(context.Background())
+		tracing = nil
+	})
+}
+
+func TestTracingExportsRequestAndStorageSpans(t *testing.T) {
+	collector := newFakeCollector(t)
+	useTracing(t, map[string]string{
+		"OTEL_EXPORTER_OTLP_ENDPOINT": collector.URL,
+		"OTEL_EXPORTER_OTLP_HEADERS":  "authorization=Bearer%20abc",
+		"OTEL_SERVICE_NAME":           "tasks-test",
+	})
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.TokenHashes = []string{hashString("secret-token")}
+	r, _ := server.Router()
+
+	const parentTrace, parentSpan = "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+	req := httptest.NewRequest("POST", "/api/v1/tasks", strings.NewReader(`{"title":"Traced"}`))
+	req.Header.Set("X-API-Token", "secret-token")
+	req.Header.Set("traceparent", "00-"+parentTrace+"-"+parentSpan+"-01")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: status %d; want 201", w.Code)
+	}
+	if err := tracing.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	if collector.service != "tasks-test" || collector.headers.Get("Authorization") != "Bearer abc" {
+		t.Errorf("service %q, Authorization %q; want tasks-test, Bearer abc", collector.service, collector.headers.Get("Authorization"))
+	}
+	spans := make(map[string]*tracepb.Span)
+	for _, s := range collector.spans {
+		spans[s.Name] = s
+	}
+	serverSpan, ok := spans["POST /api/v1/tasks"]
+	if !ok {
+		t.Fatalf("spans = %+v; want one named after the route", collector.spans)
+	}
+	if hex.EncodeToString(serverSpan.TraceId) != parentTrace || hex.EncodeToString(serverSpan.ParentSpanId) != parentSpan || serverSpan.Kind != tracepb.Span_SPAN_KIND_SERVER {
+		t.Errorf("server span = %+v; want child of the traceparent", serverSpan)
+	}
+	save, ok := spans["storage.save"]
+	if !ok || hex.EncodeToString(save.TraceId) != parentTrace || string(save.ParentSpanId) != string(serverSpan.SpanId) {
+		t.Errorf("storage span = %+v; want child of the server span", save)
+	}
+}
+
+func TestTracingHonorsUnsampledParent(t *testing.T) {
+	collector := newFakeCollector(t)
+	useTracing(t, map[string]string{"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": collector.URL + "/v1/traces"})
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	r, _ := server.Router()
+
+	req := httptest.NewRequest("GET", "/api/v1/tasks", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	tracing.Shutdown(context.Background())
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	if len(collector.spans) != 0 {
+		t.Errorf("exported %d spans for an unsampled trace; want 0", len(collector.spans))
+	}
+}
+
+func TestNewTracingFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		enabled bool
+		valid   bool
+	}{
+		{"unset", map[string]string{}, false, true},
+		{"disabled", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318", "OTEL_SDK_DISABLED": "true"}, false, true},
+		{"endpoint", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318"}, true, true},
+		{"grpc", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4317", "OTEL_EXPORTER_OTLP_PROTOCOL": "grpc"}, true, true},
+		{"json", map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318", "OTEL_EXPORTER_OTLP_PROTOCOL": "http/json"}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"OTEL_SDK_DISABLED", "OTEL_EXPORTER_OTLP_ENDPOINT", "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "OTEL_EXPORTER_OTLP_PROTOCOL", "OTEL_EXPORTER_OTLP_TRACES_PROTOCOL"} {
+				t.Setenv(key, tt.env[key])
+			}
+			tp, err := newTracingFromEnv(context.Background())
+			if (err == nil) != tt.valid || (tp != nil) != tt.enabled {
+				t.Errorf("tracing %v, error %v; want enabled %v, valid %v", tp != nil, err, tt.enabled, tt.valid)
+			}
+			if tp != nil {
+				tp.Shutdown(context.Background())
+			}
+		})
+	}
+}
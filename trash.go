@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// trashPurgeInterval is how often the trash is checked for expired tasks
+const trashPurgeInterval = time.Hour
+
+// defaultTrashRetentionDays is how long deleted tasks stay in the trash
+// when trash_retention_days is unset
+const defaultTrashRetentionDays = 30
+
+// persistedLocked returns the tasks kept in storage: the live ones and
+// those in the trash and the archive. The caller must hold the lock.
+func (ts *TaskStore) persistedLocked() TaskSet {
+	return TaskSet{ts.tasks, ts.trash, ts.archive}
+}
+
+// Trash returns the deleted tasks that can still be restored, most
+// recently deleted first
+func (ts *TaskStore) Trash() []*Task {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	tasks := make([]*Task, 0, len(ts.trash))
+	for _, task := range ts.trash {
+		tasks = append(tasks, task)
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		if !tasks[i].DeletedAt.Equal(*tasks[j].DeletedAt) {
+			return tasks[i].DeletedAt.After(*tasks[j].DeletedAt)
+		}
+		return tasks[i].ID < tasks[j].ID
+	})
+	return tasks
+}
+
+// RestoreTask moves a task out of the trash. It reports false if the task
+// isn't in the trash. A task whose project was deleted meanwhile comes back
+// without a project. Restoring an open task counts against the quota.
+func (ts *TaskStore) RestoreTask(ctx context.Context, id int) (*Task, bool, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	task, exists := ts.trash[id]
+	if !exists {
+		return nil, false, nil
+	}
+	if err := ts.checkProjectLocked(ctx, task.ProjectID, PermissionEdit); err != nil {
+		return nil, true, err
+	}
+	if ts.quota.limit > 0 && task.Status != "completed" && ts.quotaUsedLocked()+ts.quota.weight(task.Priority) > ts.quota.limit {
+		return nil, true, ErrQuotaExceeded
+	}
+
+	prev := *task
+	task.DeletedAt = nil
+	task.UpdatedAt = ts.now()
+	if _, exists := ts.projects[task.ProjectID]; task.ProjectID != 0 && !exists {
+		task.ProjectID = 0
+	}
+	delete(ts.trash, id)
+	ts.tasks[id] = task
+	if err := ts.save(ctx, id); err != nil {
+		delete(ts.tasks, id)
+		*task = prev
+		ts.trash[id] = task
+		return nil, true, fmt.Errorf("save tasks: %w", err)
+	}
+	ts.recordChange(ctx, ChangeCreated, task)
+	ts.recordMutation(ctx, AuditRestore, auditTask, id, &prev, task)
+	return task, true, nil
+}
+
+// PurgeTrashBefore permanently removes the tasks deleted before cutoff and
+// returns how many were removed
+func (ts *TaskStore) PurgeTrashBefore(ctx context.Context, cutoff time.Time) (int, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	if err := ts.refreshLocked(ctx); err != nil {
+		return 0, err
+	}
+	trashed, err := ts.storage.Query(ctx, StorageQuery{State: TaskTrashed})
+	if err != nil {
+		return 0, fmt.Errorf("query trash: %w", err)
+	}
+	removed := make(map[int]*Task)
+	for _, found := range trashed {
+		if task, exists := ts.trash[found.ID]; exists && task.DeletedAt.Before(cutoff) {
+			removed[task.ID] = task
+			delete(ts.trash, task.ID)
+		}
+	}
+	if len(removed) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]int, 0, len(removed))
+	for id := range removed {
+		ids = append(ids, id)
+	}
+	if err := ts.save(ctx, ids...); err != nil {
+		for id, task := range removed {
+			ts.trash[id] = task
+		}
+		return 0, fmt.Errorf("save tasks: %w", err)
+	}
+	for id, task := range removed {
+		ts.recordMutation(ctx, AuditPurge, auditTask, id, task, nil)
+	}
+	return len(removed), nil
+}
+
+// trashRetention is how long deleted tasks stay in the trash
+func (c *Config) trashRetention() time.Duration {
+	days := c.TrashRetentionDays
+	if days == 0 {
+		days = defaultTrashRetentionDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// purgeTrash permanently removes tasks that have been in the trash longer
+// than the configured retention, logging how many were removed
+func (s *Server) purgeTrash(ctx context.Context) {
+	count, err := s.store.PurgeTrashBefore(ctx, s.now().Add(-s.config.trashRetention()))
+	if err != nil {
+		slog.Error("Trash purge failed", "error", err)
+		return
+	}
+	if count > 0 {
+		slog.Info("Trash purge removed deleted tasks", "count", count)
+	}
+}
+
+// runTrashPurger purges once immediately and then on every tick of interval
+// until ctx is cancelled
+func (s *Server) runTrashPurger(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	s.purgeTrash(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.purgeTrash(ctx)
+		}
+	}
+}
+
+// handleGetTrash lists the deleted tasks that can still be restored, most
+// recently deleted first
+func (s *Server) handleGetTrash(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.presentTasks(s.store.Trash()))
+}
+
+// handleRestoreTask moves a task out of the trash
+func (s *Server) handleRestoreTask(w http.ResponseWriter, r *http.Request) {
+	id, err := s.parseTaskID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidTaskID, "Invalid task ID")
+		return
+	}
+
+	task, exists, err := s.store.RestoreTask(r.Context(), id)
+	if errors.Is(err, ErrQuotaExceeded) {
+		writeError(w, http.StatusInsufficientStorage, ErrCodeQuotaExceeded, "Task quota exceeded")
+		return
+	}
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	if !exists {
+		writeError(w, http.StatusNotFound, ErrCodeTaskNotFound, "Task not in trash")
+		return
+	}
+	taskOps.Add("restore", 1)
+
+	writeJSON(w, http.StatusOK, s.presentTask(task))
+}
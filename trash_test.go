@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDeleteMovesTaskToTrash(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.TokenHashes = []string{hashString("secret-token")}
+	r, err := server.Router()
+	if err != nil {
+		t.Fatalf("Router() error = %v", err)
+	}
+
+	ctx := context.Background()
+	server.store.Add(ctx, "Keep", "", DueTime{}, "medium")
+	server.store.Add(ctx, "Oops", "", DueTime{}, "medium")
+
+	req := httptest.NewRequest("DELETE", "/api/v1/tasks/2", nil)
+	req.Header.Set("X-API-Token", "secret-token")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("delete status = %d; want %d", w.Code, http.StatusNoContent)
+	}
+
+	if _, exists := server.store.Get(2); exists {
+		t.Error("trashed task still returned by Get")
+	}
+	if tasks := server.store.GetAll(); len(tasks) != 1 {
+		t.Errorf("GetAll() = %d tasks; want 1", len(tasks))
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/tasks/trash", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("trash status = %d; want %d", w.Code, http.StatusOK)
+	}
+	var trash []map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&trash)
+	if len(trash) != 1 || trash[0]["title"] != "Oops" || trash[0]["deleted_at"] == nil {
+		t.Fatalf("trash = %v; want Oops with deleted_at", trash)
+	}
+
+	req = httptest.NewRequest("POST", "/api/v1/tasks/2/restore", nil)
+	req.Header.Set("X-API-Token", "secret-token")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("restore status = %d; want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var restored map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&restored)
+	if restored["title"] != "Oops" || restored["deleted_at"] != nil {
+		t.Errorf("restored = %v; want Oops without deleted_at", restored)
+	}
+	if _, exists := server.store.Get(2); !exists {
+		t.Error("restored task not returned by Get")
+	}
+	if trash := server.store.Trash(); len(trash) != 0 {
+		t.Errorf("trash after restore = %+v; want empty", trash)
+	}
+
+	// A task that isn't in the trash can't be restored
+	req = httptest.NewRequest("POST", "/api/v1/tasks/1/restore", nil)
+	req.Header.Set("X-API-Token", "secret-token")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("restore of live task status = %d; want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestTrashSurvivesReload(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	ctx := context.Background()
+	server.store.Add(ctx, "Oops", "", DueTime{}, "medium")
+	server.store.Delete(ctx, 1)
+
+	reloaded := NewTaskStore("test_tasks.json")
+	if _, exists := reloaded.Get(1); exists {
+		t.Error("trashed task is live after reload")
+	}
+	if trash := reloaded.Trash(); len(trash) != 1 || trash[0].Title != "Oops" {
+		t.Fatalf("trash after reload = %+v; want Oops", trash)
+	}
+	if task, _ := reloaded.Add(ctx, "Next", "", DueTime{}, "medium"); task.ID != 2 {
+		t.Errorf("next ID = %d; want 2, past the trashed task", task.ID)
+	}
+}
+
+func TestRestoreTaskClearsDeletedProject(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	ctx := context.Background()
+	project, _ := server.store.AddProject(ctx, "Gone", "")
+	server.store.AddTask(ctx, Task{Title: "In project", ProjectID: project.ID})
+	server.store.Delete(ctx, 1)
+	if _, err := server.store.DeleteProject(ctx, project.ID); err != nil {
+		t.Fatalf("DeleteProject() error = %v", err)
+	}
+
+	task, exists, err := server.store.RestoreTask(ctx, 1)
+	if err != nil || !exists {
+		t.Fatalf("RestoreTask() = %v, %v; want restored", exists, err)
+	}
+	if task.ProjectID != 0 {
+		t.Errorf("project_id = %d; want 0", task.ProjectID)
+	}
+}
+
+func TestRestoreTaskRespectsQuota(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	ctx := context.Background()
+	server.store.Add(ctx, "Trashed", "", DueTime{}, "medium")
+	server.store.Delete(ctx, 1)
+	server.store.quota = taskQuota{limit: 1}
+	server.store.Add(ctx, "Fills the quota", "", DueTime{}, "medium")
+
+	if _, _, err := server.store.RestoreTask(ctx, 1); err != ErrQuotaExceeded {
+		t.Errorf("RestoreTask() error = %v; want ErrQuotaExceeded", err)
+	}
+	if trash := server.store.Trash(); len(trash) != 1 {
+		t.Errorf("trash = %+v; want the task still there", trash)
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.TrashRetentionDays = 7
+
+	now := time.Date(2024, time.March, 20, 12, 0, 0, 0, time.UTC)
+	server.now = func() time.Time { return now }
+	ctx := context.Background()
+	server.store.Add(ctx, "Old", "", DueTime{}, "medium")
+	server.store.Add(ctx, "Recent", "", DueTime{}, "medium")
+	server.store.now = func() time.Time { return now.AddDate(0, 0, -10) }
+	server.store.Delete(ctx, 1)
+	server.store.now = func() time.Time { return now.AddDate(0, 0, -2) }
+	server.store.Delete(ctx, 2)
+
+	server.purgeTrash(ctx)
+
+	trash := server.store.Trash()
+	if len(trash) != 1 || trash[0].Title != "Recent" {
+		t.Fatalf("trash after purge = %+v; want Recent", trash)
+	}
+	if _, exists, _ := server.store.RestoreTask(ctx, 1); exists {
+		t.Error("purged task can still be restored")
+	}
+	reloaded := NewTaskStore("test_tasks.json")
+	if trash := reloaded.Trash(); len(trash) != 1 {
+		t.Errorf("trash after reload = %+v; want only Recent", trash)
+	}
+}
+
+func TestTrashRetentionDefault(t *testing.T) {
+	if got := (&Config{}).trashRetention(); got != 30*24*time.Hour {
+		t.Errorf("default trash retention = %v; want 30 days", got)
+	}
+	if got := (&Config{TrashRetentionDays: 2}).trashRetention(); got != 48*time.Hour {
+		t.Errorf("trash retention = %v; want 48h", got)
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/spf13/cobra"
+)
+
+// tuiMode is what keys currently do in the terminal UI
+type tuiMode int
+
+const (
+	tuiBrowse tuiMode = iota
+	// tuiAdding and tuiEditing read a title into the input line
+	tuiAdding
+	tuiEditing
+	// tuiConfirmDelete waits for y to delete the selected task
+	tuiConfirmDelete
+)
+
+// tuiModel is the state of the terminal UI, run by bubbletea. Keys go to
+// update, which calls the API through client, and view renders the screen;
+// both work on plain strings so they can be tested without a terminal.
+type tuiModel struct {
+	ctx    context.Context
+	client taskClient
+	tasks  []publicTask
+	cursor int
+	// showAll includes completed tasks in the list
+	showAll bool
+	mode    tuiMode
+	input   []rune
+	// message is shown below the list until the next key
+	message string
+	quit    bool
+}
+
+func newTUIModel(ctx context.Context, client taskClient) *tuiModel {
+	m := &tuiModel{ctx: ctx, client: client}
+	m.refresh()
+	return m
+}
+
+// refresh reloads the task list, keeping the cursor in range
+func (m *tuiModel) refresh() {
+	query := url.Values{}
+	if !m.showAll {
+		query.Set("status", "pending,in_progress")
+	}
+	tasks, err := m.client.List(m.ctx, query)
+	if err != nil {
+		m.message = "Error: " + err.Error()
+		return
+	}
+	m.tasks = tasks
+	if m.cursor >= len(m.tasks) {
+		m.cursor = len(m.tasks) - 1
+	}
+	if m.cursor < 0 {
+		m.cursor = 0
+	}
+}
+
+// selected returns the task under the cursor
+func (m *tuiModel) selected() (publicTask, bool) {
+	if m.cursor < len(m.tasks) {
+		return m.tasks[m.cursor], true
+	}
+	return publicTask{}, false
+}
+
+// update handles a key: a single character, or one of "up", "down",
+// "enter", "backspace", "esc" and "ctrl+c"
+func (m *tuiModel) update(key string) {
+	if key == "ctrl+c" {
+		m.quit = true
+		return
+	}
+	m.message = ""
+	switch m.mode {
+	case tuiAdding, tuiEditing:
+		m.updateInput(key)
+	case tuiConfirmDelete:
+		m.mode = tuiBrowse
+		task, ok := m.selected()
+		if key != "y" || !ok {
+			return
+		}
+		if err := m.client.Delete(m.ctx, fmt.Sprint(task.ID)); err != nil {
+			m.message = "Error: " + err.Error()
+			return
+		}
+		m.message = "Deleted " + task.Title
+		m.refresh()
+	default:
+		m.updateBrowse(key)
+	}
+}
+
+func (m *tuiModel) updateBrowse(key string) {
+	switch key {
+	case "q":
+		m.quit = true
+	case "up", "k":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+	case "down", "j":
+		if m.cursor < len(m.tasks)-1 {
+			m.cursor++
+		}
+	case " ", "x":
+		// Toggle between completed and pending
+		task, ok := m.selected()
+		if !ok {
+			return
+		}
+		status := "completed"
+		if task.Status == "completed" {
+			status = "pending"
+		}
+		if _, err := m.client.Patch(m.ctx, fmt.Sprint(task.ID), map[string]interface{}{"status": status}); err != nil {
+			m.message = "Error: " + err.Error()
+			return
+		}
+		m.refresh()
+	case "s":
+		// Start or stop working on the task
+		task, ok := m.selected()
+		if !ok || task.Status == "completed" {
+			return
+		}
+		status := "in_progress"
+		if task.Status == "in_progress" {
+			status = "pending"
+		}
+		if _, err := m.client.Patch(m.ctx, fmt.Sprint(task.ID), map[string]interface{}{"status": status}); err != nil {
+			m.message = "Error: " + err.Error()
+			return
+		}
+		m.refresh()
+	case "a":
+		m.mode, m.input = tuiAdding, nil
+	case "e", "enter":
+		if task, ok := m.selected(); ok {
+			m.mode, m.input = tuiEditing, []rune(task.Title)
+		}
+	case "d":
+		if _, ok := m.selected(); ok {
+			m.mode = tuiConfirmDelete
+		}
+	case "c":
+		m.showAll = !m.showAll
+		m.refresh()
+	case "r":
+		m.refresh()
+	}
+}
+
+// updateInput edits the title being typed; enter saves it and esc
+// cancels
+func (m *tuiModel) updateInput(key string) {
+	switch key {
+	case "esc":
+		m.mode = tuiBrowse
+	case "backspace":
+		if len(m.input) > 0 {
+			m.input = m.input[:len(m.input)-1]
+		}
+	case "enter":
+		title := strings.TrimSpace(string(m.input))
+		mode := m.mode
+		m.mode = tuiBrowse
+		if title == "" {
+			return
+		}
+		var err error
+		if mode == tuiAdding {
+			_, err = m.client.Add(m.ctx, createTaskRequest{Title: title})
+		} else if task, ok := m.selected(); ok {
+			_, err = m.client.Patch(m.ctx, fmt.Sprint(task.ID), map[string]interface{}{"title": title})
+		}
+		if err != nil {
+			m.message = "Error: " + err.Error()
+			return
+		}
+		m.refresh()
+	default:
+		if utf8.RuneCountInString(key) == 1 {
+			m.input = append(m.input, []rune(key)...)
+		}
+	}
+}
+
+// tuiStatusMarks show task statuses in the list
+var tuiStatusMarks = map[string]string{"pending": "[ ]", "in_progress": "[~]", "completed": "[x]"}
+
+// view renders the screen
+func (m *tuiModel) view() string {
+	var b strings.Builder
+	title := "TaskMate - open tasks"
+	if m.showAll {
+		title = "TaskMate - all tasks"
+	}
+	b.WriteString(title + "\n\n")
+	if len(m.tasks) == 0 {
+		b.WriteString("  No tasks. Press a to add one.\n")
+	}
+	for i, task := range m.tasks {
+		cursor := "  "
+		if i == m.cursor {
+			cursor = "> "
+		}
+		due := ""
+		if !task.DueDate.IsZero() {
+			due = " (due " + task.DueDate.Day(time.Local) + ")"
+		}
+		fmt.Fprintf(&b, "%s%s %-6s %s%s\n", cursor, tuiStatusMarks[task.Status], task.Priority, task.Title, due)
+	}
+	b.WriteString("\n")
+	switch m.mode {
+	case tuiAdding:
+		b.WriteString("New task: " + string(m.input) + "_\n")
+		b.WriteString("enter save  esc cancel\n")
+	case tuiEditing:
+		b.WriteString("Title: " + string(m.input) + "_\n")
+		b.WriteString("enter save  esc cancel\n")
+	case tuiConfirmDelete:
+		task, _ := m.selected()
+		b.WriteString("Delete " + task.Title + "? (y/n)\n")
+	default:
+		b.WriteString("j/k move  space done  s start  a add  e edit  d delete  c show completed  r refresh  q quit\n")
+	}
+	if m.message != "" {
+		b.WriteString(m.message + "\n")
+	}
+	return b.String()
+}
+
+// Init is part of tea.Model; the task list is loaded by newTUIModel
+func (m *tuiModel) Init() tea.Cmd {
+	return nil
+}
+
+// Update passes key presses on to update. Characters that arrive in one
+// message, such as pasted text, are passed one at a time.
+func (m *tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	key, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return m, nil
+	}
+	if key.Type == tea.KeyRunes && !key.Alt {
+		for _, r := range key.Runes {
+			m.update(string(r))
+		}
+	} else {
+		m.update(key.String())
+	}
+	if m.quit {
+		return m, tea.Quit
+	}
+	return m, nil
+}
+
+// View is part of tea.Model
+func (m *tuiModel) View() string {
+	return m.view()
+}
+
+// runTUI runs the terminal UI on the terminal attached to stdin until the
+// user quits
+func runTUI(ctx context.Context, client taskClient, out io.Writer) error {
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return errors.New("tui needs a terminal")
+	}
+	// The alternate screen gives the shell's output back afterwards
+	p := tea.NewProgram(newTUIModel(ctx, client), tea.WithAltScreen(), tea.WithContext(ctx), tea.WithOutput(out))
+	_, err := p.Run()
+	if errors.Is(err, tea.ErrProgramKilled) && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+func cliTUI(env *cliEnv) *cobra.Command {
+	return &cobra.Command{
+		Use:   "tui [flags]",
+		Short: "Browse and edit tasks interactively",
+		Args:  usageArgs(cobra.NoArgs),
+		RunE: env.run(func(ctx context.Context, c taskClient, _ []string, out io.Writer) error {
+			return runTUI(ctx, c, out)
+		}),
+	}
+}
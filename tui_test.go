@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// pressKeys sends each key to m
+func pressKeys(m *tuiModel, keys ...string) {
+	for _, key := range keys {
+		m.update(key)
+	}
+}
+
+func TestTUIModel(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	ctx := context.Background()
+	server.store.Add(ctx, "First", "", DueTime{}, "low")
+	server.store.Add(ctx, "Second", "", dueOn("2030-01-01"), "high")
+	m := newTUIModel(ctx, &localClient{server: server})
+
+	if view := m.view(); !strings.Contains(view, "> [ ] low    First") || !strings.Contains(view, "(due 2030-01-01)") {
+		t.Errorf("view = %q; want both tasks with the cursor on the first", view)
+	}
+
+	// Complete the second task; it leaves the list of open tasks
+	pressKeys(m, "down", " ")
+	if task, _ := server.store.Get(2); task.Status != "completed" {
+		t.Errorf("after space, status = %q; want completed", task.Status)
+	}
+	if len(m.tasks) != 1 || m.cursor != 0 {
+		t.Errorf("after completing, %d tasks with cursor %d; want 1 and 0", len(m.tasks), m.cursor)
+	}
+	pressKeys(m, "c")
+	if len(m.tasks) != 2 {
+		t.Errorf("with completed shown, %d tasks; want 2", len(m.tasks))
+	}
+
+	// Edit the first title inline
+	pressKeys(m, "e", "backspace", "backspace", "backspace", "backspace", "backspace", "T", "o", "p", "enter")
+	if task, _ := server.store.Get(1); task.Title != "Top" {
+		t.Errorf("after edit, title = %q; want Top", task.Title)
+	}
+
+	// Add a task, then cancel an add
+	pressKeys(m, "a", "N", "e", "w", "enter", "a", "X", "esc")
+	if len(server.store.GetAll()) != 3 {
+		t.Errorf("%d tasks after adding one and cancelling one; want 3", len(server.store.GetAll()))
+	}
+
+	// Delete needs confirmation
+	pressKeys(m, "d", "n")
+	if _, ok := server.store.Get(1); !ok {
+		t.Error("d then n deleted the task")
+	}
+	pressKeys(m, "d", "y")
+	if _, ok := server.store.Get(1); ok {
+		t.Error("d then y kept the task")
+	}
+
+	pressKeys(m, "q")
+	if !m.quit {
+		t.Error("q didn't quit")
+	}
+}
+
+func TestTUIUpdateKeyMessages(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	ctx := context.Background()
+	server.store.Add(ctx, "First", "", DueTime{}, "low")
+	server.store.Add(ctx, "Second", "", DueTime{}, "low")
+	m := newTUIModel(ctx, &localClient{server: server})
+
+	send := func(msgs ...tea.Msg) tea.Cmd {
+		var cmd tea.Cmd
+		for _, msg := range msgs {
+			_, cmd = m.Update(msg)
+		}
+		return cmd
+	}
+	send(tea.KeyMsg{Type: tea.KeyDown})
+	if m.cursor != 1 {
+		t.Errorf("after down, cursor = %d; want 1", m.cursor)
+	}
+	send(tea.KeyMsg{Type: tea.KeyUp}, tea.KeyMsg{Type: tea.KeySpace})
+	if task, _ := server.store.Get(1); task.Status != "completed" {
+		t.Errorf("after space, status = %q; want completed", task.Status)
+	}
+
+	// Pasted text arrives as one message with several runes
+	send(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("a")}, tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune("Pasté")}, tea.KeyMsg{Type: tea.KeyBackspace})
+	if got := string(m.input); got != "Past" {
+		t.Errorf("input = %q; want Past", got)
+	}
+	send(tea.KeyMsg{Type: tea.KeyEsc}, tea.WindowSizeMsg{Width: 80, Height: 24})
+	if m.mode != tuiBrowse {
+		t.Errorf("after esc, mode = %v; want browsing", m.mode)
+	}
+
+	if cmd := send(tea.KeyMsg{Type: tea.KeyCtrlC}); cmd == nil || !reflect.DeepEqual(cmd(), tea.Quit()) {
+		t.Error("ctrl+c didn't quit the program")
+	}
+}
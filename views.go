@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// handleGetOverdueTasks returns the open tasks whose due time has passed.
+// The other list parameters work as for /tasks.
+func (s *Server) handleGetOverdueTasks(w http.ResponseWriter, r *http.Request) {
+	s.writeDueView(w, r, func(task *Task, now time.Time, loc *time.Location) bool {
+		return isOverdue(task, now)
+	})
+}
+
+// handleGetTodayTasks returns the open tasks due today in the request's
+// time zone, including those whose due time earlier today has passed
+func (s *Server) handleGetTodayTasks(w http.ResponseWriter, r *http.Request) {
+	s.writeDueView(w, r, func(task *Task, now time.Time, loc *time.Location) bool {
+		return task.Status != "completed" && task.DueDate.Day(loc) == now.In(loc).Format(dueDateLayout)
+	})
+}
+
+// writeDueView lists the tasks matching the request's filter for which
+// include reports true, given the current time and the request's zone
+func (s *Server) writeDueView(w http.ResponseWriter, r *http.Request, include func(task *Task, now time.Time, loc *time.Location) bool) {
+	loc := s.requestLocation(r)
+	filter, err := parseTaskFilter(r.URL.Query(), loc)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidQuery, err.Error())
+		return
+	}
+	now := s.now()
+	tasks := make([]*Task, 0)
+	for _, task := range s.store.List(filter) {
+		if include(task, now, loc) {
+			tasks = append(tasks, task)
+		}
+	}
+	s.writeTaskList(w, r, tasks)
+}
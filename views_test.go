@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOverdueAndTodayViews(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	// Evening of March 10 in UTC, early morning of March 11 in Tokyo
+	server.now = func() time.Time { return time.Date(2024, 3, 10, 20, 0, 0, 0, time.UTC) }
+	ctx := context.Background()
+	store := server.store
+	store.Add(ctx, "Yesterday", "", dueIn("2024-03-09", time.UTC), "low")
+	store.Add(ctx, "Morning", "", DueTime{time.Date(2024, 3, 10, 9, 0, 0, 0, time.UTC)}, "high")
+	store.Add(ctx, "Tonight", "", dueIn("2024-03-10", time.UTC), "medium")
+	store.Add(ctx, "Tomorrow", "", dueIn("2024-03-11", time.UTC), "medium")
+	done, _ := store.Add(ctx, "Done", "", dueIn("2024-03-09", time.UTC), "medium")
+	store.Update(ctx, done.ID, "Done", "", done.DueDate, "", "completed")
+	store.Add(ctx, "Someday", "", DueTime{}, "medium")
+	r, err := server.Router()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path, zone string
+		want       []string
+	}{
+		{"/api/v1/tasks/overdue", "", []string{"Yesterday", "Morning"}},
+		{"/api/v1/tasks/overdue", "Asia/Tokyo", []string{"Yesterday", "Morning"}},
+		{"/api/v1/tasks/overdue?priority=high", "", []string{"Morning"}},
+		{"/api/v1/tasks/today", "UTC", []string{"Morning", "Tonight"}},
+		{"/api/v1/tasks/today", "Asia/Tokyo", []string{"Tonight"}},
+		{"/api/v1/tasks/today?sort=title&order=desc", "UTC", []string{"Tonight", "Morning"}},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		if tt.zone != "" {
+			req.Header.Set(timeZoneHeader, tt.zone)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s (%s): status %d: %s", tt.path, tt.zone, w.Code, w.Body.String())
+		}
+		var tasks []Task
+		json.NewDecoder(w.Body).Decode(&tasks)
+		titles := []string{}
+		for _, task := range tasks {
+			titles = append(titles, task.Title)
+		}
+		if !reflect.DeepEqual(titles, tt.want) {
+			t.Errorf("%s (%s) = %q; want %q", tt.path, tt.zone, titles, tt.want)
+		}
+	}
+}
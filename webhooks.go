@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Webhook events, sent in the "event" field and X-Taskmate-Event header
+const (
+	EventTaskCreated   = "task.created"
+	EventTaskUpdated   = "task.updated"
+	EventTaskDeleted   = "task.deleted"
+	EventTaskCompleted = "task.completed"
+)
+
+// webhookEvents lists every event a webhook can subscribe to
+var webhookEvents = []string{EventTaskCreated, EventTaskUpdated, EventTaskDeleted, EventTaskCompleted}
+
+// webhookMaxAttempts is how many times a delivery is tried before it is
+// dropped; the wait doubles after each failure starting at webhookRetryBase
+const webhookMaxAttempts = 5
+
+// webhookRetryBase is the wait after the first failed delivery. It is a
+// variable so tests can shorten it.
+var webhookRetryBase = time.Second
+
+// Webhook is a registered receiver of task events. The secret signs
+// deliveries and is only shown when the webhook is created.
+type Webhook struct {
+	ID     int    `json:"id"`
+	URL    string `json:"url"`
+	Secret string `json:"secret,omitempty"`
+	// Events filters the deliveries; empty means every event
+	Events    []string  `json:"events,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// wants reports whether the webhook subscribes to event
+func (h Webhook) wants(event string) bool {
+	return len(h.Events) == 0 || containsString(h.Events, event)
+}
+
+// webhookPayload is the signed JSON body of a delivery. RequestID is that
+// of the API request that made the change, and is absent for changes made
+// by the server itself, such as retention sweeps.
+type webhookPayload struct {
+	ID         string      `json:"id"`
+	Event      string      `json:"event"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	Revision   int64       `json:"revision"`
+	TaskID     interface{} `json:"task_id"`
+	Task       *publicTask `json:"task,omitempty"`
+	RequestID  string      `json:"request_id,omitempty"`
+}
+
+// signWebhook returns the X-Taskmate-Signature value for body: the hex
+// HMAC-SHA256 of the body keyed by the webhook secret
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// changeEvents maps a store change to webhook events. statuses holds the
+// last known status of each task and is updated; a task becoming
+// completed produces task.completed in addition to task.updated.
+func changeEvents(change Change, statuses map[int]string) []string {
+	switch change.Type {
+	case ChangeCreated:
+		statuses[change.TaskID] = change.Task.Status
+		return []string{EventTaskCreated}
+	case ChangeDeleted:
+		delete(statuses, change.TaskID)
+		return []string{EventTaskDeleted}
+	}
+	events := []string{EventTaskUpdated}
+	if change.Task.Status == "completed" && statuses[change.TaskID] != "completed" {
+		events = append(events, EventTaskCompleted)
+	}
+	statuses[change.TaskID] = change.Task.Status
+	return events
+}
+
+// taskStatuses returns the current status of every task
+func (ts *TaskStore) taskStatuses() map[int]string {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	statuses := make(map[int]string, len(ts.tasks))
+	for id, task := range ts.tasks {
+		statuses[id] = task.Status
+	}
+	return statuses
+}
+
+// webhooks returns a copy of the registered webhooks
+func (s *Server) webhooks() []Webhook {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Webhook(nil), s.config.Webhooks...)
+}
+
+// runWebhookDispatcher delivers every change from now on to the
+// subscribed webhooks and project integrations until ctx is cancelled
+func (s *Server) runWebhookDispatcher(ctx context.Context) {
+	s.dispatchWebhooksSince(ctx, s.store.Revision(), s.store.taskStatuses())
+}
+
+// dispatchWebhooksSince follows the store's change log after revision,
+// given each task's status at that revision. Changes that fell out of the
+// log (after an import, or if the dispatcher lagged by more than
+// maxChangeLog) can't be delivered and are logged instead.
+func (s *Server) dispatchWebhooksSince(ctx context.Context, revision int64, statuses map[int]string) {
+	for {
+		changes, current, complete := s.store.WaitForChanges(ctx, revision)
+		if ctx.Err() != nil {
+			return
+		}
+		if !complete {
+			slog.Warn("Webhook events were lost", "from_revision", revision, "to_revision", current)
+			statuses = s.store.taskStatuses()
+		}
+		for _, change := range changes {
+			for _, event := range changeEvents(change, statuses) {
+				s.dispatchWebhookEvent(ctx, event, change)
+				s.dispatchIntegrations(ctx, event, change.Task)
+			}
+		}
+		revision = current
+	}
+}
+
+// dispatchWebhookEvent starts a delivery to every webhook subscribed to
+// event. Deliveries run concurrently, so a slow receiver doesn't hold up
+// the others, and events can arrive out of order.
+func (s *Server) dispatchWebhookEvent(ctx context.Context, event string, change Change) {
+	payload := webhookPayload{
+		Event:      event,
+		OccurredAt: s.now(),
+		Revision:   change.Revision,
+		TaskID:     s.presentTask(&Task{ID: change.TaskID}).ID,
+		RequestID:  change.RequestID,
+	}
+	if change.Task != nil {
+		task := s.presentTask(change.Task)
+		payload.Task = &task
+		payload.OccurredAt = change.Task.UpdatedAt
+	}
+	for _, hook := range s.webhooks() {
+		if !hook.wants(event) {
+			continue
+		}
+		payload.ID = strconv.FormatInt(change.Revision, 10) + "-" + event + "-" + strconv.Itoa(hook.ID)
+		body, err := json.Marshal(payload)
+		if err != nil {
+			slog.Error("Encoding webhook payload failed", "error", err)
+			return
+		}
+		go s.deliverWebhook(ctx, hook, event, payload.ID, payload.RequestID, body)
+	}
+}
+
+// deliverWebhook POSTs body to hook, retrying failures with exponential
+// backoff up to webhookMaxAttempts
+func (s *Server) deliverWebhook(ctx context.Context, hook Webhook, event, deliveryID, requestID string, body []byte) {
+	attempts, err := retryDelivery(ctx, func() error {
+		return postWebhook(ctx, hook, event, deliveryID, requestID, body)
+	})
+	if err != nil {
+		slog.Warn("Webhook delivery failed", "webhook_id", hook.ID, "delivery_id", deliveryID, "attempts", attempts, "error", err)
+	}
+}
+
+// retryDelivery calls deliver until it succeeds, waiting webhookRetryBase
+// after the first failure and doubling the wait after each one, for up to
+// webhookMaxAttempts. It returns the attempts made and the last error,
+// which is nil on success and when ctx was cancelled while waiting.
+func retryDelivery(ctx context.Context, deliver func() error) (int, error) {
+	wait := webhookRetryBase
+	for attempt := 1; ; attempt++ {
+		err := deliver()
+		if err == nil || attempt == webhookMaxAttempts {
+			return attempt, err
+		}
+		select {
+		case <-ctx.Done():
+			return attempt, nil
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// postWebhook makes one delivery attempt; any non-2xx response is a failure
+func postWebhook(ctx context.Context, hook Webhook, event, deliveryID, requestID string, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, notifierTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Taskmate-Event", event)
+	req.Header.Set("X-Taskmate-Delivery", deliveryID)
+	req.Header.Set("X-Taskmate-Signature", signWebhook(hook.Secret, body))
+	if requestID != "" {
+		req.Header.Set("X-Taskmate-Request-ID", requestID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("receiver returned %s", resp.Status)
+	}
+	return nil
+}
+
+// validateWebhook checks a webhook's URL and event filter
+func validateWebhook(hook Webhook) error {
+	u, err := url.Parse(hook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return &validationError{code: ErrCodeValidation, message: "url must be an absolute http or https URL"}
+	}
+	for _, event := range hook.Events {
+		if !containsString(webhookEvents, event) {
+			return &validationError{
+				code:    ErrCodeValidation,
+				message: fmt.Sprintf("Unknown event %q (want one of %s)", event, strings.Join(webhookEvents, ", ")),
+			}
+		}
+	}
+	return nil
+}
+
+// webhookRequest is the body of a webhook registration
+type webhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+// handleCreateWebhook registers a webhook and returns it with its signing
+// secret, which is not shown again
+func (s *Server) handleCreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	hook := Webhook{URL: req.URL, Events: req.Events, CreatedAt: s.now()}
+	if err := validateWebhook(hook); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	secret, err := generateToken()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to generate secret")
+		return
+	}
+	hook.Secret = secret
+
+	s.mu.Lock()
+	hook.ID = 1
+	for _, existing := range s.config.Webhooks {
+		if existing.ID >= hook.ID {
+			hook.ID = existing.ID + 1
+		}
+	}
+	prev := s.config.Webhooks
+	s.config.Webhooks = append(append([]Webhook(nil), prev...), hook)
+	if err := SaveConfig(s.config); err != nil {
+		s.config.Webhooks = prev
+		s.mu.Unlock()
+		writeError(w, http.StatusInternalServerError, ErrCodeSaveFailed, "Failed to save webhook")
+		return
+	}
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusCreated, hook)
+}
+
+// handleGetWebhooks lists the registered webhooks without their secrets
+func (s *Server) handleGetWebhooks(w http.ResponseWriter, r *http.Request) {
+	hooks := s.webhooks()
+	for i := range hooks {
+		hooks[i].Secret = ""
+	}
+	writeJSON(w, http.StatusOK, hooks)
+}
+
+// handleDeleteWebhook unregisters a webhook. Deliveries already in
+// progress still finish their retries.
+func (s *Server) handleDeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidQuery, "Invalid webhook ID")
+		return
+	}
+
+	s.mu.Lock()
+	prev := s.config.Webhooks
+	remaining := make([]Webhook, 0, len(prev))
+	for _, hook := range prev {
+		if hook.ID != id {
+			remaining = append(remaining, hook)
+		}
+	}
+	if len(remaining) == len(prev) {
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, ErrCodeWebhookNotFound, "Webhook not found")
+		return
+	}
+	s.config.Webhooks = remaining
+	if err := SaveConfig(s.config); err != nil {
+		s.config.Webhooks = prev
+		s.mu.Unlock()
+		writeError(w, http.StatusInternalServerError, ErrCodeSaveFailed, "Failed to save webhooks")
+		return
+	}
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
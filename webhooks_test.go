@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestChangeEvents(t *testing.T) {
+	statuses := map[int]string{}
+	steps := []struct {
+		change Change
+		want   []string
+	}{
+		{Change{Type: ChangeCreated, TaskID: 1, Task: &Task{ID: 1, Status: "pending"}}, []string{EventTaskCreated}},
+		{Change{Type: ChangeUpdated, TaskID: 1, Task: &Task{ID: 1, Status: "completed"}}, []string{EventTaskUpdated, EventTaskCompleted}},
+		{Change{Type: ChangeUpdated, TaskID: 1, Task: &Task{ID: 1, Status: "completed"}}, []string{EventTaskUpdated}},
+		{Change{Type: ChangeDeleted, TaskID: 1}, []string{EventTaskDeleted}},
+	}
+	for i, step := range steps {
+		if got := changeEvents(step.change, statuses); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("step %d: events = %q; want %q", i, got, step.want)
+		}
+	}
+}
+
+// webhookReceiver records deliveries, failing the first failures of them
+type webhookReceiver struct {
+	mu         sync.Mutex
+	failures   int
+	attempts   int
+	deliveries []*http.Request
+	bodies     [][]byte
+}
+
+func (rcv *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	rcv.attempts++
+	if rcv.attempts <= rcv.failures {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+	rcv.deliveries = append(rcv.deliveries, r)
+	rcv.bodies = append(rcv.bodies, body)
+}
+
+func (rcv *webhookReceiver) waitFor(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		rcv.mu.Lock()
+		got := len(rcv.deliveries)
+		rcv.mu.Unlock()
+		if got >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d deliveries; want %d", got, n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	defer func(base time.Duration) { webhookRetryBase = base }(webhookRetryBase)
+	webhookRetryBase = time.Millisecond
+
+	receiver := &webhookReceiver{failures: 2}
+	ts := httptest.NewServer(receiver)
+	defer ts.Close()
+
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.config.Webhooks = []Webhook{{ID: 1, URL: ts.URL, Secret: "s3cret", Events: []string{EventTaskCompleted}}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.dispatchWebhooksSince(ctx, 0, map[int]string{})
+
+	task, _ := server.store.Add(ctx, "Ship it", "", DueTime{}, "high")
+	server.store.Update(withRequestID(ctx, "req-42"), task.ID, task.Title, "", DueTime{}, task.Priority, "completed")
+	receiver.waitFor(t, 1)
+
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	if receiver.attempts != 3 {
+		t.Errorf("attempts = %d; want 3 (two retries)", receiver.attempts)
+	}
+	req, body := receiver.deliveries[0], receiver.bodies[0]
+	if got := req.Header.Get("X-Taskmate-Event"); got != EventTaskCompleted {
+		t.Errorf("X-Taskmate-Event = %q; want %q", got, EventTaskCompleted)
+	}
+	if got, want := req.Header.Get("X-Taskmate-Signature"), signWebhook("s3cret", body); got != want {
+		t.Errorf("signature = %q; want %q", got, want)
+	}
+	if got := req.Header.Get("X-Taskmate-Request-ID"); got != "req-42" {
+		t.Errorf("X-Taskmate-Request-ID = %q; want %q", got, "req-42")
+	}
+	var payload struct {
+		Event     string `json:"event"`
+		Task      Task   `json:"task"`
+		RequestID string `json:"request_id"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	if payload.Event != EventTaskCompleted || payload.Task.Title != "Ship it" || payload.RequestID != "req-42" {
+		t.Errorf("payload = %+v", payload)
+	}
+}
+
+func TestWebhookRegistration(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	defer os.Remove("config.json")
+
+	create := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.handleCreateWebhook(w, httptest.NewRequest("POST", "/api/v1/webhooks", bytes.NewBufferString(body)))
+		return w
+	}
+	for _, body := range []string{`{"url":"ftp://example.com"}`, `{"url":"https://example.com","events":["task.moved"]}`} {
+		if w := create(body); w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: status = %d; want %d", body, w.Code, http.StatusUnprocessableEntity)
+		}
+	}
+
+	w := create(`{"url":"https://example.com/hook","events":["task.created"]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create status = %d; want %d", w.Code, http.StatusCreated)
+	}
+	var created Webhook
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if created.ID != 1 || created.Secret == "" {
+		t.Errorf("created = %+v; want ID 1 with a secret", created)
+	}
+
+	w = httptest.NewRecorder()
+	server.handleGetWebhooks(w, httptest.NewRequest("GET", "/api/v1/webhooks", nil))
+	var listed []Webhook
+	if err := json.NewDecoder(w.Body).Decode(&listed); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(listed) != 1 || listed[0].Secret != "" {
+		t.Errorf("listed = %+v; want one webhook without its secret", listed)
+	}
+	if server.config.Webhooks[0].Secret == "" {
+		t.Error("listing cleared the stored secret")
+	}
+}
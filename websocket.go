@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// websocketGUID is appended to the client's key to compute the handshake
+// accept value (RFC 6455 section 1.3)
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// maxWebsocketMessage caps the size of one client message
+const maxWebsocketMessage = 1 << 20
+
+// websocketWriteTimeout bounds how long one frame may take to send
+const websocketWriteTimeout = 10 * time.Second
+
+// WebSocket opcodes
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+// WebSocket close codes
+const (
+	wsCloseNormal          = 1000
+	wsCloseGoingAway       = 1001
+	wsCloseProtocolError   = 1002
+	wsCloseUnsupportedData = 1003
+	wsCloseTooBig          = 1009
+)
+
+// errWebsocketClosed is returned by readMessage once the peer has closed
+// the connection
+var errWebsocketClosed = errors.New("websocket closed")
+
+// wsConn is a server-side WebSocket connection. Only text messages are
+// supported. readMessage must be called from a single goroutine; writes
+// are safe from any goroutine.
+type wsConn struct {
+	conn net.Conn
+	br   *bufio.Reader
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// upgradeWebsocket performs the WebSocket handshake and takes over the
+// connection. On a request that isn't a valid handshake it writes a 400
+// and returns an error.
+func upgradeWebsocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet || key == "" ||
+		!headerHasToken(r.Header, "Connection", "upgrade") ||
+		!headerHasToken(r.Header, "Upgrade", "websocket") {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidUpgrade, "Expected a WebSocket handshake")
+		return nil, errors.New("not a websocket handshake")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidUpgrade, "Unsupported WebSocket version")
+		return nil, errors.New("unsupported websocket version")
+	}
+
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "WebSocket not supported")
+		return nil, err
+	}
+	// The server's read and write timeouts don't apply to a long-lived
+	// connection; wsConn sets its own deadlines
+	conn.SetDeadline(time.Time{})
+
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(response)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, br: rw.Reader}, nil
+}
+
+// headerHasToken reports whether a comma-separated header contains token,
+// ignoring case
+func headerHasToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// readMessage returns the next text message, answering pings and
+// reassembling fragments along the way. idle bounds how long to wait for
+// each frame. After the peer closes it returns errWebsocketClosed; on a
+// protocol violation it closes the connection with the matching code.
+func (c *wsConn) readMessage(idle time.Duration) ([]byte, error) {
+	var message []byte
+	fragmented := false
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(idle))
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			var closeErr *wsCloseError
+			if errors.As(err, &closeErr) {
+				c.close(closeErr.code)
+			}
+			return nil, err
+		}
+
+		switch opcode {
+		case wsPing:
+			if err := c.writeFrame(wsPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case wsPong:
+			continue
+		case wsClose:
+			c.close(wsCloseNormal)
+			return nil, errWebsocketClosed
+		case wsBinary:
+			c.close(wsCloseUnsupportedData)
+			return nil, errors.New("binary messages are not supported")
+		case wsText:
+			if fragmented {
+				c.close(wsCloseProtocolError)
+				return nil, errors.New("new message before previous one finished")
+			}
+			message = payload
+		case wsContinuation:
+			if !fragmented {
+				c.close(wsCloseProtocolError)
+				return nil, errors.New("continuation without a message")
+			}
+			if len(message)+len(payload) > maxWebsocketMessage {
+				c.close(wsCloseTooBig)
+				return nil, errors.New("message too large")
+			}
+			message = append(message, payload...)
+		default:
+			c.close(wsCloseProtocolError)
+			return nil, fmt.Errorf("unknown opcode %d", opcode)
+		}
+
+		if fin {
+			return message, nil
+		}
+		fragmented = true
+	}
+}
+
+// wsCloseError is a protocol violation found while reading a frame, with
+// the close code to send
+type wsCloseError struct {
+	code    uint16
+	message string
+}
+
+func (e *wsCloseError) Error() string {
+	return e.message
+}
+
+// readFrame reads one frame and unmasks its payload. Client frames must be
+// masked, and control frames must be short and unfragmented.
+func (c *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = header[0]&0x80 != 0
+	opcode = header[0] & 0x0F
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, &wsCloseError{wsCloseProtocolError, "reserved bits set"}
+	}
+	if header[1]&0x80 == 0 {
+		return false, 0, nil, &wsCloseError{wsCloseProtocolError, "client frame not masked"}
+	}
+
+	length := uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if opcode >= wsClose && (length > 125 || !fin) {
+		return false, 0, nil, &wsCloseError{wsCloseProtocolError, "invalid control frame"}
+	}
+	if length > maxWebsocketMessage {
+		return false, 0, nil, &wsCloseError{wsCloseTooBig, "message too large"}
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// writeFrame sends one unfragmented, unmasked frame
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	frame := make([]byte, 0, len(payload)+10)
+	frame = append(frame, 0x80|opcode)
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+	frame = append(frame, payload...)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return errWebsocketClosed
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(websocketWriteTimeout))
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// writeJSON sends v as a text message
+func (c *wsConn) writeJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.writeFrame(wsText, data)
+}
+
+// close sends a close frame with code, unless one was already sent, and
+// closes the connection
+func (c *wsConn) close(code uint16) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.conn.SetWriteDeadline(time.Now().Add(websocketWriteTimeout))
+	c.conn.Write([]byte{0x80 | wsClose, 2, byte(code >> 8), byte(code)})
+	c.conn.Close()
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrTransitionNotAllowed is matched by the *TransitionError returned when
+// a task would move to a status the workflow doesn't allow from its
+// current one
+var ErrTransitionNotAllowed = errors.New("status transition not allowed")
+
+// TransitionError names the status change a workflow refused
+type TransitionError struct {
+	From, To string
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("status transition from %s to %s not allowed", e.From, e.To)
+}
+
+func (e *TransitionError) Unwrap() error {
+	return ErrTransitionNotAllowed
+}
+
+// defaultStatuses are the statuses of the workflow used when none is
+// configured
+var defaultStatuses = []string{"pending", "in_progress", "completed"}
+
+// WorkflowConfig sets the statuses a task can have and the moves allowed
+// between them. New tasks start as pending, and completed is the status
+// that completes a task, so both must be listed.
+type WorkflowConfig struct {
+	// Statuses in the order they are shown (default: pending, in_progress,
+	// completed)
+	Statuses []string `json:"statuses,omitempty"`
+	// Transitions maps a status to those a task may move to from it. When
+	// empty, a task may move between any two statuses.
+	Transitions map[string][]string `json:"transitions,omitempty"`
+}
+
+// workflow is the state machine that task statuses follow
+type workflow struct {
+	statuses []string
+	// transitions is nil when every move is allowed
+	transitions map[string]map[string]bool
+}
+
+// newWorkflow returns the workflow config describes, which must have
+// passed validateWorkflow
+func newWorkflow(config WorkflowConfig) workflow {
+	wf := workflow{statuses: config.Statuses}
+	if len(wf.statuses) == 0 {
+		wf.statuses = defaultStatuses
+	}
+	if len(config.Transitions) > 0 {
+		wf.transitions = make(map[string]map[string]bool, len(config.Transitions))
+		for from, targets := range config.Transitions {
+			wf.transitions[from] = make(map[string]bool, len(targets))
+			for _, to := range targets {
+				wf.transitions[from][to] = true
+			}
+		}
+	}
+	return wf
+}
+
+// known reports whether status is one of the workflow's statuses
+func (wf workflow) known(status string) bool {
+	return containsString(wf.statuses, status)
+}
+
+// checkStatus returns a *validationError unless status is one of the
+// workflow's statuses
+func (wf workflow) checkStatus(status string) error {
+	if wf.known(status) {
+		return nil
+	}
+	return &validationError{ErrCodeInvalidStatus, "status must be one of: " + strings.Join(wf.statuses, ", ")}
+}
+
+// allows reports whether a task may move from one status to another.
+// Staying put is always allowed, as is leaving a status that is no longer
+// in the workflow.
+func (wf workflow) allows(from, to string) bool {
+	if from == to || wf.transitions == nil || !wf.known(from) {
+		return true
+	}
+	return wf.transitions[from][to]
+}
+
+// next returns the statuses a task may move to from status, in workflow
+// order
+func (wf workflow) next(status string) []string {
+	targets := []string{}
+	for _, to := range wf.statuses {
+		if to != status && wf.allows(status, to) {
+			targets = append(targets, to)
+		}
+	}
+	return targets
+}
+
+// checkTransition returns a *TransitionError if task may not move to
+// status. An empty status keeps the current one.
+func (wf workflow) checkTransition(task *Task, status string) error {
+	if status == "" || wf.allows(task.Status, status) {
+		return nil
+	}
+	return &TransitionError{From: task.Status, To: status}
+}
+
+// validateWorkflow checks the configured workflow: statuses must be
+// lowercase, without commas, listed once and include pending and
+// completed, and transitions may only name listed statuses
+func validateWorkflow(config WorkflowConfig) error {
+	statuses := config.Statuses
+	if len(statuses) == 0 {
+		statuses = defaultStatuses
+	}
+	seen := make(map[string]bool, len(statuses))
+	for _, status := range statuses {
+		switch {
+		case status == "":
+			return errors.New("statuses must not be empty")
+		case status != strings.ToLower(strings.TrimSpace(status)) || strings.Contains(status, ","):
+			return fmt.Errorf("status %q must be lowercase, without commas or surrounding spaces", status)
+		case seen[status]:
+			return fmt.Errorf("status %q is listed twice", status)
+		}
+		seen[status] = true
+	}
+	if !seen["pending"] || !seen["completed"] {
+		return errors.New("statuses must include pending and completed")
+	}
+	for from, targets := range config.Transitions {
+		if !seen[from] {
+			return fmt.Errorf("transitions name unknown status %q", from)
+		}
+		for _, to := range targets {
+			if !seen[to] {
+				return fmt.Errorf("transitions from %s name unknown status %q", from, to)
+			}
+		}
+	}
+	return nil
+}
+
+// writeTransitionNotAllowed sends the 409 for a status change the workflow
+// doesn't allow
+func writeTransitionNotAllowed(w http.ResponseWriter, err error) {
+	writeError(w, http.StatusConflict, ErrCodeTransitionNotAllowed, transitionMessage(err))
+}
+
+// transitionMessage describes a refused status change for an error
+// response
+func transitionMessage(err error) string {
+	var terr *TransitionError
+	if !errors.As(err, &terr) {
+		return "Status transition not allowed"
+	}
+	return fmt.Sprintf("Task can't move from %s to %s; see /api/v1/workflow", terr.From, terr.To)
+}
+
+// workflowResponse is the body of GET /workflow
+type workflowResponse struct {
+	Statuses []string `json:"statuses"`
+	// Initial is the status of new tasks and Completed the one that
+	// completes a task
+	Initial   string `json:"initial"`
+	Completed string `json:"completed"`
+	// Transitions maps every status to those a task may move to from it
+	Transitions map[string][]string `json:"transitions"`
+}
+
+// handleGetWorkflow describes the statuses tasks can have and the moves
+// allowed between them
+func (s *Server) handleGetWorkflow(w http.ResponseWriter, r *http.Request) {
+	wf := s.store.workflow
+	resp := workflowResponse{
+		Statuses:    wf.statuses,
+		Initial:     "pending",
+		Completed:   "completed",
+		Transitions: make(map[string][]string, len(wf.statuses)),
+	}
+	for _, status := range wf.statuses {
+		resp.Transitions[status] = wf.next(status)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
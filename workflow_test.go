@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// reviewWorkflow is a workflow in which tasks go through review before
+// they are completed
+var reviewWorkflow = WorkflowConfig{
+	Statuses: []string{"pending", "in_progress", "review", "completed"},
+	Transitions: map[string][]string{
+		"pending":     {"in_progress"},
+		"in_progress": {"review", "pending"},
+		"review":      {"completed", "in_progress"},
+		"completed":   {"pending"},
+	},
+}
+
+func TestWorkflowTransitions(t *testing.T) {
+	_, cleanup := setupTestServer()
+	defer cleanup()
+	store := NewTaskStore("test_tasks.json")
+	server := NewServerWithStore(&Config{TokenHashes: []string{hashString("secret-token")}, Workflow: reviewWorkflow}, store)
+	r, err := server.Router()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	store.Add(ctx, "Feature", "", DueTime{}, "medium")
+	store.Add(ctx, "Other", "", DueTime{}, "medium")
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-API-Token", "secret-token")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	tests := []struct {
+		name, method, path, body string
+		status                   int
+		code                     string
+	}{
+		{"skip to review", "PUT", "/api/v1/tasks/1", `{"title":"Feature","status":"review"}`, http.StatusConflict, ErrCodeTransitionNotAllowed},
+		{"unknown status", "PATCH", "/api/v1/tasks/1", `{"status":"done"}`, http.StatusUnprocessableEntity, ErrCodeInvalidStatus},
+		{"start", "PATCH", "/api/v1/tasks/1", `{"status":"in_progress"}`, http.StatusOK, ""},
+		{"to review", "PUT", "/api/v1/tasks/1", `{"title":"Feature","status":"review"}`, http.StatusOK, ""},
+		{"edit in review", "PUT", "/api/v1/tasks/1", `{"title":"Feature v2"}`, http.StatusOK, ""},
+		{"complete", "PATCH", "/api/v1/tasks/1", `{"status":"completed"}`, http.StatusOK, ""},
+		{"reopen to in_progress", "POST", "/api/v1/tasks/1/reopen?to=in_progress", "", http.StatusConflict, ErrCodeTransitionNotAllowed},
+		{"reopen", "POST", "/api/v1/tasks/1/reopen", "", http.StatusOK, ""},
+		{"bulk complete", "POST", "/api/v1/tasks/bulk", `{"operations":[{"op":"complete","id":2}]}`, http.StatusUnprocessableEntity, ErrCodeBulkFailed},
+	}
+	for _, tt := range tests {
+		w := send(tt.method, tt.path, tt.body)
+		if w.Code != tt.status || !strings.Contains(w.Body.String(), tt.code) {
+			t.Errorf("%s: %d %s; want %d %s", tt.name, w.Code, w.Body.String(), tt.status, tt.code)
+		}
+	}
+	if task, _ := store.Get(2); task.Status != "pending" {
+		t.Errorf("task 2 status = %q; want pending after the refused bulk completion", task.Status)
+	}
+}
+
+func TestGetWorkflow(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+
+	get := func() workflowResponse {
+		t.Helper()
+		w := httptest.NewRecorder()
+		server.handleGetWorkflow(w, httptest.NewRequest("GET", "/api/v1/workflow", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d; want %d", w.Code, http.StatusOK)
+		}
+		var resp workflowResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := get()
+	if !reflect.DeepEqual(resp.Statuses, defaultStatuses) || resp.Initial != "pending" || resp.Completed != "completed" {
+		t.Errorf("default workflow = %+v", resp)
+	}
+	if got := resp.Transitions["in_progress"]; !reflect.DeepEqual(got, []string{"pending", "completed"}) {
+		t.Errorf("default transitions from in_progress = %q; want every other status", got)
+	}
+
+	server.store.workflow = newWorkflow(reviewWorkflow)
+	resp = get()
+	want := map[string][]string{
+		"pending":     {"in_progress"},
+		"in_progress": {"pending", "review"},
+		"review":      {"in_progress", "completed"},
+		"completed":   {"pending"},
+	}
+	if !reflect.DeepEqual(resp.Transitions, want) {
+		t.Errorf("transitions = %v; want %v in workflow order", resp.Transitions, want)
+	}
+}
+
+func TestAutoProgressFollowsWorkflow(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	server.store.autoProgressOnEdit = true
+	server.store.workflow = newWorkflow(WorkflowConfig{Statuses: []string{"pending", "review", "completed"}})
+	ctx := context.Background()
+	task, _ := server.store.Add(ctx, "Draft", "", DueTime{}, "medium")
+
+	server.store.Update(ctx, task.ID, "Draft v2", "", DueTime{}, "", "")
+	if got, _ := server.store.Get(task.ID); got.Status != "pending" {
+		t.Errorf("status = %q; want pending in a workflow without in_progress", got.Status)
+	}
+}
+
+func TestValidateWorkflow(t *testing.T) {
+	for _, config := range []WorkflowConfig{{}, reviewWorkflow} {
+		if err := validateWorkflow(config); err != nil {
+			t.Errorf("validateWorkflow(%+v) error = %v; want nil", config, err)
+		}
+	}
+	for _, config := range []WorkflowConfig{
+		{Statuses: []string{"todo", "done"}},
+		{Statuses: []string{"pending", "Review", "completed"}},
+		{Statuses: []string{"pending", "pending", "completed"}},
+		{Statuses: []string{"pending", "completed"}, Transitions: map[string][]string{"pending": {"done"}}},
+		{Transitions: map[string][]string{"review": {"completed"}}},
+	} {
+		if err := validateWorkflow(config); err == nil {
+			t.Errorf("validateWorkflow(%+v) error = nil; want an error", config)
+		}
+	}
+}
@@ -0,0 +1,699 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// workspacesDir holds one directory of tasks per workspace
+const workspacesDir = "workspaces"
+
+// workspaceHeader names the workspace a request is for; ?workspace= does
+// the same for links that can't carry headers
+const workspaceHeader = "X-Workspace"
+
+// workspaceIDPattern is what workspace IDs look like; they name
+// directories, so nothing else is allowed
+var workspaceIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// defaultWorkspaceID names the default workspace where an ID is needed, as
+// in X-Workspace or the move endpoint. No other workspace can take it.
+const defaultWorkspaceID = "default"
+
+// Workspace is a team with its own tasks, projects and tokens, separate
+// from the default workspace and from every other one
+type Workspace struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// rootOnlyRoutes are the endpoints that act on the server-wide config, and
+// so are only served in the default workspace
+var rootOnlyRoutes = map[string]bool{
+	"auth.token":          true,
+	"auth.password":       true,
+	"auth.tokens":         true,
+	"auth.revoke":         true,
+	"auth.oidc.login":     true,
+	"auth.oidc.callback":  true,
+	"webhooks.list":       true,
+	"webhooks.create":     true,
+	"webhooks.delete":     true,
+	"integrations.list":   true,
+	"integrations.create": true,
+	"integrations.delete": true,
+	"admin.config":        true,
+	"admin.export":        true,
+	"admin.import":        true,
+	"admin.backup":        true,
+	"admin.restore":       true,
+	"audit":               true,
+	"workspaces.list":     true,
+	"workspaces.create":   true,
+	"workspaces.delete":   true,
+	"workspaces.tokens":   true,
+	"workspaces.move":     true,
+	"workspaces.changes":  true,
+}
+
+// errWorkspaceNotFound is returned for requests to workspaces that don't
+// exist
+var errWorkspaceNotFound = errors.New("workspace not found")
+
+// errMoveAttachments is returned when a moved task's attachment files
+// can't be copied to the target workspace
+var errMoveAttachments = errors.New("copy attachment files")
+
+// linkRoutes are the routes reached through links that carry their own
+// signature, and so are served in a workspace without one of its tokens
+var linkRoutes = map[string]bool{
+	"shared.get":    true,
+	"calendar.feed": true,
+}
+
+// workspaceServer is an open workspace: its server and that server's routes
+type workspaceServer struct {
+	server  *Server
+	handler *mux.Router
+}
+
+// isLink reports whether r is for one of the workspace's linkRoutes
+func (ws *workspaceServer) isLink(r *http.Request) bool {
+	var match mux.RouteMatch
+	return ws.handler.Match(r, &match) && match.Route != nil && linkRoutes[match.Route.GetName()]
+}
+
+// validateWorkspaces checks workspace IDs, that tokens belong to workspaces
+// that exist, and that the storage can keep workspaces apart
+func validateWorkspaces(config *Config) error {
+	ids := make(map[string]bool, len(config.Workspaces))
+	for _, ws := range config.Workspaces {
+		if !workspaceIDPattern.MatchString(ws.ID) {
+			return fmt.Errorf("invalid workspaces: id %q must be lowercase letters, digits and dashes", ws.ID)
+		}
+		if ids[ws.ID] {
+			return fmt.Errorf("invalid workspaces: duplicate id %q", ws.ID)
+		}
+		if ws.ID == defaultWorkspaceID {
+			return fmt.Errorf("invalid workspaces: id %q is reserved", ws.ID)
+		}
+		ids[ws.ID] = true
+	}
+	for hash, id := range config.TokenWorkspaces {
+		if !ids[id] {
+			return fmt.Errorf("invalid token_workspaces: token %s is in unknown workspace %q", tokenID(hash), id)
+		}
+	}
+	if len(config.Workspaces) > 0 && !workspaceStorage(config.Storage) {
+		return fmt.Errorf("invalid workspaces: storage %q doesn't support workspaces", config.Storage)
+	}
+	return nil
+}
+
+// workspaceStorage reports whether storage keeps each workspace in its own
+// files
+func workspaceStorage(storage string) bool {
+	return storage == "" || storage == "json" || storage == "sqlite"
+}
+
+// workspaceLocked returns the workspace with id. The caller must hold s.mu.
+func (s *Server) workspaceLocked(id string) (Workspace, bool) {
+	for _, ws := range s.config.Workspaces {
+		if ws.ID == id {
+			return ws, true
+		}
+	}
+	return Workspace{}, false
+}
+
+// openWorkspaceStore opens the tasks of workspace id, in their own
+// directory under workspacesDir in the data directory and with the
+// configured backend
+func openWorkspaceStore(config *Config, id string) (*TaskStore, error) {
+	if !workspaceStorage(config.Storage) {
+		return nil, fmt.Errorf("storage %q doesn't support workspaces", config.Storage)
+	}
+	dir := filepath.Join(workspacesDir, id)
+	if err := os.MkdirAll(dataPath(dir), 0700); err != nil {
+		return nil, err
+	}
+	scoped := *config
+	// The SQLite backend resolves its path against the data directory
+	scoped.SQLitePath = filepath.Join(dir, defaultSQLitePath)
+	return OpenStore(&scoped, dataPath(filepath.Join(dir, "tasks.json")))
+}
+
+// prefixedAttachmentStore keeps a workspace's files under its own prefix
+// of the shared attachment store
+type prefixedAttachmentStore struct {
+	AttachmentStore
+	prefix string
+}
+
+func (p prefixedAttachmentStore) Put(ctx context.Context, key string, body io.Reader, attachment Attachment) error {
+	return p.AttachmentStore.Put(ctx, p.prefix+key, body, attachment)
+}
+
+func (p prefixedAttachmentStore) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	return p.AttachmentStore.Open(ctx, p.prefix+key)
+}
+
+func (p prefixedAttachmentStore) Delete(ctx context.Context, key string) error {
+	return p.AttachmentStore.Delete(ctx, p.prefix+key)
+}
+
+// newWorkspaceServer returns the server for workspace id around store. It
+// shares s's config, lock, clock, mail and event stream slots, and signs
+// links with a key of its own so they don't work in other workspaces.
+func (s *Server) newWorkspaceServer(id string, store *TaskStore) *Server {
+	server := NewServerWithStore(s.config, store)
+	server.workspace = id
+	server.mu = s.mu
+	server.now = func() time.Time { return s.now() }
+	server.shareKey = s.shareMAC([]byte("workspace." + id))
+	server.eventStreams = s.eventStreams
+	server.sendMail = s.sendMail
+	server.closing = s.closing
+	server.static = s.static
+	if store.files != nil {
+		store.files = prefixedAttachmentStore{store.files, workspacesDir + "/" + id + "/"}
+	}
+	return server
+}
+
+// openWorkspace returns workspace id, opening its store and starting its
+// background workers on first use. It returns errWorkspaceNotFound for
+// workspaces that don't exist.
+func (s *Server) openWorkspace(id string) (*workspaceServer, error) {
+	s.workspacesMu.Lock()
+	defer s.workspacesMu.Unlock()
+	if ws, ok := s.workspaces[id]; ok {
+		return ws, nil
+	}
+	s.mu.RLock()
+	_, exists := s.workspaceLocked(id)
+	s.mu.RUnlock()
+	if !exists {
+		return nil, errWorkspaceNotFound
+	}
+
+	store, err := openWorkspaceStore(s.config, id)
+	if err != nil {
+		return nil, fmt.Errorf("open workspace %s: %w", id, err)
+	}
+	server := s.newWorkspaceServer(id, store)
+	handler, err := server.routes()
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	if s.workspaces == nil {
+		s.workspaces = make(map[string]*workspaceServer)
+	}
+	ws := &workspaceServer{server: server, handler: handler}
+	s.workspaces[id] = ws
+	if s.backgroundStarted {
+		server.startBackground()
+	}
+	return ws, nil
+}
+
+// workspaceServerFor returns the server of workspace id, which is s itself
+// for defaultWorkspaceID. Like openWorkspace it returns
+// errWorkspaceNotFound for workspaces that don't exist.
+func (s *Server) workspaceServerFor(id string) (*Server, error) {
+	if id == defaultWorkspaceID {
+		return s, nil
+	}
+	ws, err := s.openWorkspace(id)
+	if err != nil {
+		return nil, err
+	}
+	return ws.server, nil
+}
+
+// openWorkspaces opens every configured workspace, so their background
+// workers run from startup
+func (s *Server) openWorkspaces() error {
+	s.mu.RLock()
+	workspaces := append([]Workspace(nil), s.config.Workspaces...)
+	s.mu.RUnlock()
+	for _, ws := range workspaces {
+		if _, err := s.openWorkspace(ws.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// closeWorkspace stops workspace id's background workers and closes its
+// store, if it is open
+func (s *Server) closeWorkspace(id string) error {
+	s.workspacesMu.Lock()
+	ws, ok := s.workspaces[id]
+	delete(s.workspaces, id)
+	s.workspacesMu.Unlock()
+	if !ok {
+		return nil
+	}
+	if ws.server.stopBackground != nil {
+		ws.server.stopBackground()
+	}
+	ws.server.background.Wait()
+	return ws.server.store.Close()
+}
+
+// closeWorkspaces closes every open workspace
+func (s *Server) closeWorkspaces() error {
+	s.workspacesMu.Lock()
+	ids := make([]string, 0, len(s.workspaces))
+	for id := range s.workspaces {
+		ids = append(ids, id)
+	}
+	s.workspacesMu.Unlock()
+	var errs []error
+	for _, id := range ids {
+		if err := s.closeWorkspace(id); err != nil {
+			errs = append(errs, fmt.Errorf("close workspace %s: %w", id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// linkURL returns path with the query naming the server's workspace, for
+// links that are followed without the caller's token
+func (s *Server) linkURL(path string) string {
+	if s.workspace == "" {
+		return path
+	}
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return path + sep + "workspace=" + s.workspace
+}
+
+// workspaceMiddleware hands requests for another workspace to its server.
+// A token issued in a workspace always goes to that workspace; other
+// requests name theirs with X-Workspace or ?workspace=, and without either
+// are served by the default workspace. Another workspace serves only its
+// own tokens, reads included, and the signed links in linkRoutes.
+func (s *Server) workspaceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(workspaceHeader)
+		if id == "" {
+			id = r.URL.Query().Get("workspace")
+		}
+		token := r.Header.Get("X-API-Token")
+		scoped := false
+		if token != "" {
+			s.mu.RLock()
+			var tokenWorkspace string
+			tokenWorkspace, scoped = s.config.TokenWorkspaces[hashString(token)]
+			s.mu.RUnlock()
+			if scoped {
+				if id != "" && id != tokenWorkspace {
+					writeError(w, http.StatusForbidden, ErrCodeForbidden, "Token belongs to another workspace")
+					return
+				}
+				id = tokenWorkspace
+			}
+		}
+		if id == "" || id == defaultWorkspaceID {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ws, err := s.openWorkspace(id)
+		if errors.Is(err, errWorkspaceNotFound) {
+			writeError(w, http.StatusNotFound, ErrCodeWorkspaceNotFound, "Workspace not found")
+			return
+		}
+		if err != nil {
+			requestLogger(r.Context()).Error("Failed to open workspace", "workspace", id, "error", err)
+			writeError(w, http.StatusServiceUnavailable, ErrCodeInternal, "Workspace unavailable")
+			return
+		}
+		if !scoped {
+			if !ws.isLink(r) {
+				if token == "" {
+					writeError(w, http.StatusUnauthorized, ErrCodeTokenRequired, "A token issued for the workspace is required")
+				} else {
+					writeError(w, http.StatusUnauthorized, ErrCodeInvalidToken, "Token wasn't issued for this workspace")
+				}
+				return
+			}
+			// The link's signature is all that is checked, so another
+			// workspace's token mustn't count for anything
+			r = r.Clone(r.Context())
+			r.Header.Del("X-API-Token")
+		}
+		ws.handler.ServeHTTP(w, r)
+	})
+}
+
+// workspaceRequest is the body accepted by POST /workspaces
+type workspaceRequest struct {
+	// ID names the workspace in X-Workspace and its data directory:
+	// lowercase letters, digits and dashes
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// workspaceTokenRequest is the body accepted by POST /workspaces/{id}/tokens
+type workspaceTokenRequest struct {
+	// Role is viewer or editor (default); workspaces have no admins
+	Role   string   `json:"role"`
+	Scopes []string `json:"scopes"`
+	Label  string   `json:"label"`
+}
+
+// workspaceMoveRequest is the body accepted by
+// POST /workspaces/{src}/tasks/{id}/move
+type workspaceMoveRequest struct {
+	// Target is the workspace to move the task to; defaultWorkspaceID
+	// names the default one
+	Target string `json:"target"`
+}
+
+// handleGetWorkspaces lists the workspaces besides the default one
+func (s *Server) handleGetWorkspaces(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	workspaces := append([]Workspace{}, s.config.Workspaces...)
+	s.mu.RUnlock()
+	writeJSON(w, http.StatusOK, workspaces)
+}
+
+// handleCreateWorkspace adds a workspace. Its tasks are kept apart from the
+// first request that uses it.
+func (s *Server) handleCreateWorkspace(w http.ResponseWriter, r *http.Request) {
+	var req workspaceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if !workspaceIDPattern.MatchString(req.ID) {
+		writeError(w, http.StatusUnprocessableEntity, ErrCodeInvalidWorkspace, "Workspace id must be up to 32 lowercase letters, digits and dashes")
+		return
+	}
+	if req.ID == defaultWorkspaceID {
+		writeError(w, http.StatusUnprocessableEntity, ErrCodeInvalidWorkspace, "Workspace id default is reserved")
+		return
+	}
+	if req.Name == "" {
+		req.Name = req.ID
+	}
+	if !workspaceStorage(s.config.Storage) {
+		writeError(w, http.StatusConflict, ErrCodeOperationDisabled, "Workspaces need json or sqlite storage")
+		return
+	}
+
+	ws := Workspace{ID: req.ID, Name: req.Name, CreatedAt: s.now()}
+	s.mu.Lock()
+	if _, exists := s.workspaceLocked(req.ID); exists {
+		s.mu.Unlock()
+		writeError(w, http.StatusConflict, ErrCodeWorkspaceExists, "Workspace already exists")
+		return
+	}
+	prev := *s.config
+	s.config.Workspaces = append(append([]Workspace(nil), prev.Workspaces...), ws)
+	if err := SaveConfig(s.config); err != nil {
+		*s.config = prev
+		s.mu.Unlock()
+		writeError(w, http.StatusInternalServerError, ErrCodeSaveFailed, "Failed to save workspace")
+		return
+	}
+	s.mu.Unlock()
+	slog.Info("Workspace created", "workspace", ws.ID)
+
+	writeJSON(w, http.StatusCreated, ws)
+}
+
+// handleDeleteWorkspace removes a workspace and revokes its tokens. Its
+// tasks are left on disk under workspaces/<id>.
+func (s *Server) handleDeleteWorkspace(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	s.mu.Lock()
+	if _, exists := s.workspaceLocked(id); !exists {
+		s.mu.Unlock()
+		writeError(w, http.StatusNotFound, ErrCodeWorkspaceNotFound, "Workspace not found")
+		return
+	}
+	prev := *s.config
+	s.config.Workspaces = make([]Workspace, 0, len(prev.Workspaces))
+	for _, ws := range prev.Workspaces {
+		if ws.ID != id {
+			s.config.Workspaces = append(s.config.Workspaces, ws)
+		}
+	}
+	s.dropTokensLocked(func(hash string) bool { return prev.TokenWorkspaces[hash] == id })
+	if err := SaveConfig(s.config); err != nil {
+		*s.config = prev
+		s.mu.Unlock()
+		writeError(w, http.StatusInternalServerError, ErrCodeSaveFailed, "Failed to save workspaces")
+		return
+	}
+	s.mu.Unlock()
+
+	if err := s.closeWorkspace(id); err != nil {
+		slog.Warn("Closing deleted workspace failed", "workspace", id, "error", err)
+	}
+	slog.Info("Workspace deleted", "workspace", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleCreateWorkspaceToken issues a stored token that only works in the
+// workspace. Workspace tokens are viewers or editors: the admin endpoints
+// act on the whole server.
+func (s *Server) handleCreateWorkspaceToken(w http.ResponseWriter, r *http.Request) {
+	var req workspaceTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	if req.Role == "" {
+		req.Role = RoleEditor
+		if len(req.Scopes) > 0 {
+			req.Role = scopesRole(req.Scopes)
+		}
+	}
+	if req.Role != RoleViewer && req.Role != RoleEditor {
+		writeError(w, http.StatusUnprocessableEntity, ErrCodeInvalidRole, "Workspace tokens must be viewer or editor")
+		return
+	}
+	var scopes []string
+	if len(req.Scopes) > 0 {
+		var ok bool
+		if scopes, ok = normalizeScopes(req.Scopes, req.Role); !ok {
+			writeError(w, http.StatusUnprocessableEntity, ErrCodeInvalidScope, "Scopes must be tasks:read or tasks:write and allowed for the role")
+			return
+		}
+	}
+
+	ws, err := s.openWorkspace(mux.Vars(r)["id"])
+	if errors.Is(err, errWorkspaceNotFound) {
+		writeError(w, http.StatusNotFound, ErrCodeWorkspaceNotFound, "Workspace not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to open workspace")
+		return
+	}
+	token, err := generateToken()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to generate token")
+		return
+	}
+	tokenHash := hashString(token)
+
+	s.mu.Lock()
+	meta, err := ws.server.storeTokenLocked(tokenHash, req.Role, scopes, req.Label, "")
+	s.mu.Unlock()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrCodeSaveFailed, "Failed to save token")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, tokenResponse(token, tokenID(tokenHash), req.Role, scopes, meta.expiresAt()))
+}
+
+// moveTask moves live task id from the store of from to that of to. Both
+// stores are write-locked for the whole move, in the order of their
+// workspace IDs so that two moves in opposite directions can't deadlock.
+// Like Update, the bool reports whether the task exists.
+func moveTask(ctx context.Context, from, to *Server, id int) (*Task, bool, error) {
+	first, second := from.store, to.store
+	if to.workspace < from.workspace {
+		first, second = second, first
+	}
+	first.mu.Lock()
+	defer first.mu.Unlock()
+	second.mu.Lock()
+	defer second.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+	return moveTaskLocked(ctx, from.store, to.store, id)
+}
+
+// moveTaskLocked moves live task id from src to dst, where it gets dst's
+// next ID and keeps its other fields and timestamps. Its project and
+// blockers are cleared, as their IDs mean nothing in dst, and its comments
+// and history stay behind and are dropped. The attachment files are copied
+// to dst's storage first and deleted from src's once both stores are
+// saved. The caller must hold both stores' write locks.
+func moveTaskLocked(ctx context.Context, src, dst *TaskStore, id int) (*Task, bool, error) {
+	task, exists := src.tasks[id]
+	if !exists {
+		return nil, false, nil
+	}
+	if err := src.checkProjectLocked(ctx, task.ProjectID, PermissionEdit); err != nil {
+		return nil, true, err
+	}
+	if dst.quota.limit > 0 && task.Status != "completed" && dst.quotaUsedLocked()+dst.quota.weight(task.Priority) > dst.quota.limit {
+		return nil, true, ErrQuotaExceeded
+	}
+
+	moved := *task
+	moved.ID = dst.nextID
+	moved.ProjectID = 0
+	moved.BlockedBy = nil
+	copied, err := copyAttachmentFiles(ctx, src.files, dst.files, task.Attachments)
+	removeCopies := func() {
+		for _, key := range copied {
+			if err := dst.files.Delete(ctx, key); err != nil {
+				requestLogger(ctx).Error("Failed to delete copied attachment file", "key", key, "error", err)
+			}
+		}
+	}
+	if err != nil {
+		removeCopies()
+		return nil, true, err
+	}
+
+	dst.tasks[moved.ID] = &moved
+	dst.nextID++
+	if err := dst.save(ctx, moved.ID); err != nil {
+		delete(dst.tasks, moved.ID)
+		dst.nextID = moved.ID
+		removeCopies()
+		return nil, true, fmt.Errorf("save target tasks: %w", err)
+	}
+	delete(src.tasks, id)
+	if err := src.save(ctx, id); err != nil {
+		src.tasks[id] = task
+		delete(dst.tasks, moved.ID)
+		dst.nextID = moved.ID
+		if err := dst.save(ctx, moved.ID); err != nil {
+			requestLogger(ctx).Error("Failed to take back moved task", "task_id", moved.ID, "error", err)
+		}
+		removeCopies()
+		return nil, true, fmt.Errorf("save source tasks: %w", err)
+	}
+
+	dst.recordChange(ctx, ChangeCreated, &moved)
+	dst.recordMutation(ctx, AuditCreate, auditTask, moved.ID, nil, &moved)
+	src.recordChange(ctx, ChangeDeleted, task)
+	src.recordMutation(ctx, AuditPurge, auditTask, id, task, nil)
+	return &moved, true, nil
+}
+
+// copyAttachmentFiles copies the files of attachments from one store to
+// another under the same keys, returning the keys copied so far even on
+// error. Files already missing from src are skipped.
+func copyAttachmentFiles(ctx context.Context, src, dst AttachmentStore, attachments []Attachment) ([]string, error) {
+	if len(attachments) == 0 {
+		return nil, nil
+	}
+	if src == nil || dst == nil {
+		return nil, fmt.Errorf("%w: attachment storage is not available", errMoveAttachments)
+	}
+	var copied []string
+	for _, attachment := range attachments {
+		file, err := src.Open(ctx, attachment.Key)
+		if errors.Is(err, ErrAttachmentNotFound) {
+			continue
+		}
+		if err != nil {
+			return copied, fmt.Errorf("%w: %s: %v", errMoveAttachments, attachment.Key, err)
+		}
+		err = dst.Put(ctx, attachment.Key, file, attachment)
+		file.Close()
+		if err != nil {
+			return copied, fmt.Errorf("%w: %s: %v", errMoveAttachments, attachment.Key, err)
+		}
+		copied = append(copied, attachment.Key)
+	}
+	return copied, nil
+}
+
+// handleMoveWorkspaceTask moves a live task to another workspace, where it
+// gets a new ID, and returns it as it is there
+func (s *Server) handleMoveWorkspaceTask(w http.ResponseWriter, r *http.Request) {
+	var req workspaceMoveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidJSON, "Invalid JSON")
+		return
+	}
+	srcID := mux.Vars(r)["src"]
+	if req.Target == "" {
+		writeError(w, http.StatusUnprocessableEntity, ErrCodeInvalidWorkspace, "Target workspace is required")
+		return
+	}
+	if req.Target == srcID {
+		writeError(w, http.StatusUnprocessableEntity, ErrCodeInvalidWorkspace, "Target must be another workspace")
+		return
+	}
+
+	servers := make([]*Server, 2)
+	for i, id := range []string{srcID, req.Target} {
+		server, err := s.workspaceServerFor(id)
+		if errors.Is(err, errWorkspaceNotFound) {
+			writeError(w, http.StatusNotFound, ErrCodeWorkspaceNotFound, "Workspace not found")
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to open workspace")
+			return
+		}
+		servers[i] = server
+	}
+	src, dst := servers[0], servers[1]
+	id, err := src.parseTaskID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidTaskID, "Invalid task ID")
+		return
+	}
+
+	task, exists, err := moveTask(r.Context(), src, dst, id)
+	switch {
+	case errors.Is(err, ErrQuotaExceeded):
+		writeError(w, http.StatusInsufficientStorage, ErrCodeQuotaExceeded, "Task quota exceeded")
+	case errors.Is(err, errMoveAttachments):
+		requestLogger(r.Context()).Error("Failed to move attachments", "task_id", id, "error", err)
+		writeError(w, http.StatusBadGateway, ErrCodeAttachmentStorage, "Failed to copy the attachments")
+	case err != nil:
+		writeStoreError(w, err)
+	case !exists:
+		writeError(w, http.StatusNotFound, ErrCodeTaskNotFound, "Task not found")
+	default:
+		slog.Info("Task moved", "from", srcID, "to", req.Target, "task_id", id, "new_id", task.ID)
+		writeJSON(w, http.StatusOK, dst.presentTask(task))
+	}
+}
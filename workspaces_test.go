@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWorkspaces(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	defer os.RemoveAll(workspacesDir)
+	defer os.Remove("config.json")
+	defer server.closeWorkspaces()
+	server.config.TokenHashes = append(server.config.TokenHashes, hashString("admin-token"))
+	r, err := server.Router()
+	if err != nil {
+		t.Fatal(err)
+	}
+	send := func(token, method, path, body string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("X-API-Token", token)
+		}
+		if len(header) > 0 {
+			req.Header.Set(workspaceHeader, header[0])
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	expect := func(w *httptest.ResponseRecorder, status int, what string) {
+		t.Helper()
+		if w.Code != status {
+			t.Fatalf("%s: status %d; want %d: %s", what, w.Code, status, w.Body.String())
+		}
+	}
+	titles := func(w *httptest.ResponseRecorder) []string {
+		t.Helper()
+		var tasks []publicTask
+		if err := json.NewDecoder(w.Body).Decode(&tasks); err != nil {
+			t.Fatal(err)
+		}
+		var titles []string
+		for _, task := range tasks {
+			titles = append(titles, task.Title)
+		}
+		return titles
+	}
+
+	expect(send("admin-token", "POST", "/api/v1/workspaces", `{"id": "acme", "name": "Acme"}`), http.StatusCreated, "create acme")
+	expect(send("admin-token", "POST", "/api/v1/workspaces", `{"id": "acme"}`), http.StatusConflict, "create acme again")
+	expect(send("admin-token", "POST", "/api/v1/workspaces", `{"id": "Acme Inc"}`), http.StatusUnprocessableEntity, "invalid id")
+	expect(send("admin-token", "POST", "/api/v1/workspaces/acme/tokens", `{"role": "admin"}`), http.StatusUnprocessableEntity, "admin workspace token")
+	expect(send("admin-token", "POST", "/api/v1/workspaces/nope/tokens", `{}`), http.StatusNotFound, "token for a missing workspace")
+	w := send("admin-token", "POST", "/api/v1/workspaces/acme/tokens", `{"label": "ci"}`)
+	expect(w, http.StatusCreated, "acme token")
+	var issued struct{ Token, Role string }
+	json.NewDecoder(w.Body).Decode(&issued)
+	acme := issued.Token
+	if issued.Role != RoleEditor {
+		t.Errorf("workspace token role = %q; want editor", issued.Role)
+	}
+
+	// Each workspace only sees its own tasks
+	expect(send(acme, "POST", "/api/v1/tasks", `{"title": "Acme task"}`), http.StatusCreated, "acme creates a task")
+	expect(send("admin-token", "POST", "/api/v1/tasks", `{"title": "Default task"}`), http.StatusCreated, "default creates a task")
+	if got := titles(send(acme, "GET", "/api/v1/tasks", "")); len(got) != 1 || got[0] != "Acme task" {
+		t.Errorf("acme tasks = %v; want only Acme task", got)
+	}
+	if got := titles(send(acme, "GET", "/api/v1/tasks", "", "acme")); len(got) != 1 || got[0] != "Acme task" {
+		t.Errorf("X-Workspace tasks = %v; want only Acme task", got)
+	}
+	// Naming a workspace reads nothing without one of its tokens
+	expect(send("", "GET", "/api/v1/tasks", "", "acme"), http.StatusUnauthorized, "X-Workspace read without a token")
+	expect(send("", "GET", "/api/v1/tasks?workspace=acme", ""), http.StatusUnauthorized, "?workspace= read without a token")
+	expect(send("", "GET", "/api/v1/tasks/1", "", "acme"), http.StatusUnauthorized, "task read without a token")
+	expect(send("", "GET", "/api/v1/tasks/export.ics", "", "acme"), http.StatusForbidden, "calendar feed without its token")
+	expect(send("admin-token", "GET", "/api/v1/tasks/export.ics", "", "acme"), http.StatusForbidden, "calendar feed with a default token")
+	expect(send("admin-token", "GET", "/api/v1/tasks", "", "acme"), http.StatusUnauthorized, "default token reading acme")
+	w = send(acme, "GET", "/api/v1/calendar/token", "")
+	expect(w, http.StatusOK, "acme calendar token")
+	var feed struct{ URL string }
+	json.NewDecoder(w.Body).Decode(&feed)
+	expect(send("", "GET", feed.URL, ""), http.StatusOK, "acme calendar feed link")
+	if got := titles(send("", "GET", "/api/v1/tasks", "")); len(got) != 1 || got[0] != "Default task" {
+		t.Errorf("default tasks = %v; want only Default task", got)
+	}
+	if _, err := os.Stat(filepath.Join(workspacesDir, "acme", "tasks.json")); err != nil {
+		t.Errorf("acme tasks file: %v", err)
+	}
+
+	// Tokens stay in their workspace
+	expect(send(acme, "GET", "/api/v1/tasks", "", "other"), http.StatusForbidden, "acme token in another workspace")
+	expect(send("", "GET", "/api/v1/tasks", "", "other"), http.StatusNotFound, "missing workspace")
+	expect(send("admin-token", "POST", "/api/v1/tasks", `{"title": "Intruder"}`, "acme"), http.StatusUnauthorized, "default token in acme")
+	expect(send(acme, "GET", "/api/v1/workspaces", ""), http.StatusNotFound, "workspace admin endpoint from acme")
+	w = send("admin-token", "GET", "/api/v1/auth/tokens", "")
+	if !strings.Contains(w.Body.String(), `"workspace":"acme"`) {
+		t.Errorf("token list doesn't show the workspace: %s", w.Body.String())
+	}
+
+	// Share links carry their workspace and only work in it
+	w = send(acme, "GET", "/api/v1/tasks/1/share", "")
+	expect(w, http.StatusOK, "share acme task")
+	var link struct{ URL string }
+	json.NewDecoder(w.Body).Decode(&link)
+	if !strings.HasSuffix(link.URL, "?workspace=acme") {
+		t.Fatalf("share url = %q; want it to name the workspace", link.URL)
+	}
+	w = send("", "GET", link.URL, "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Acme task") {
+		t.Errorf("shared acme task: status %d: %s", w.Code, w.Body.String())
+	}
+	if w := send("", "GET", strings.TrimSuffix(link.URL, "?workspace=acme"), ""); w.Code == http.StatusOK {
+		t.Errorf("acme share link worked in the default workspace: %s", w.Body.String())
+	}
+
+	expect(send("admin-token", "DELETE", "/api/v1/workspaces/acme", ""), http.StatusNoContent, "delete acme")
+	expect(send("admin-token", "DELETE", "/api/v1/workspaces/acme", ""), http.StatusNotFound, "delete acme again")
+	expect(send(acme, "POST", "/api/v1/tasks", `{"title": "After"}`), http.StatusUnauthorized, "acme token after delete")
+	if len(server.config.TokenWorkspaces) != 0 || len(server.config.TokenHashes) != 1 {
+		t.Errorf("tokens after delete: %v, %v; want only the admin token", server.config.TokenHashes, server.config.TokenWorkspaces)
+	}
+}
+
+func TestMoveTaskBetweenWorkspaces(t *testing.T) {
+	server, cleanup := setupTestServer()
+	defer cleanup()
+	defer os.RemoveAll(workspacesDir)
+	defer os.Remove("config.json")
+	defer server.closeWorkspaces()
+	dir := t.TempDir()
+	server.config.Attachments.Dir = dir
+	server.store.files = diskAttachmentStore{dir: dir}
+	server.config.TokenHashes = append(server.config.TokenHashes, hashString("secret-token"))
+	r, err := server.Router()
+	if err != nil {
+		t.Fatal(err)
+	}
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-API-Token", "secret-token")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	move := func(path, target string, status int) Task {
+		t.Helper()
+		w := send("POST", path, `{"target": "`+target+`"}`)
+		if w.Code != status {
+			t.Fatalf("move %s to %q: status %d; want %d: %s", path, target, w.Code, status, w.Body.String())
+		}
+		var task Task
+		json.NewDecoder(w.Body).Decode(&task)
+		return task
+	}
+
+	if w := send("POST", "/api/v1/workspaces", `{"id": "acme"}`); w.Code != http.StatusCreated {
+		t.Fatalf("create acme: status %d: %s", w.Code, w.Body.String())
+	}
+	ws, err := server.openWorkspace("acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acme := ws.server.store
+	ctx := context.Background()
+	acme.Add(ctx, "Acme task", "", DueTime{}, "medium")
+	project, _ := server.store.AddProject(ctx, "Home", "")
+	server.store.Add(ctx, "Stays", "", DueTime{}, "medium")
+	server.store.AddTask(ctx, Task{Title: "Moves", Priority: "high", Tags: []string{"q3"}, ProjectID: project.ID, BlockedBy: []int{1}})
+	server.store.AddComment(ctx, 2, "left behind")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, uploadRequest(t, "/api/v1/tasks/2/attachments", "notes.txt", "text/plain", []byte("hello")))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("upload: status %d: %s", w.Code, w.Body.String())
+	}
+	before, _ := server.store.Get(2)
+	original := *before
+
+	moved := move("/api/v1/workspaces/default/tasks/2/move", "acme", http.StatusOK)
+	if moved.ID != 2 || moved.Title != "Moves" || moved.Priority != "high" || len(moved.Tags) != 1 ||
+		!moved.CreatedAt.Equal(original.CreatedAt) || !moved.UpdatedAt.Equal(original.UpdatedAt) {
+		t.Errorf("moved task = %+v; want Moves as acme task 2 with its fields and timestamps", moved)
+	}
+	if moved.ProjectID != 0 || len(moved.BlockedBy) != 0 {
+		t.Errorf("moved task keeps project %d and blockers %v; want them cleared", moved.ProjectID, moved.BlockedBy)
+	}
+	if _, exists := server.store.Get(2); exists {
+		t.Error("moved task is still in the default workspace")
+	}
+	if comments, _ := server.store.Comments(2); len(comments) != 0 {
+		t.Errorf("comments of the moved task left in the default workspace: %v", comments)
+	}
+	if task, exists := acme.Get(2); !exists || task.Title != "Moves" {
+		t.Errorf("acme task 2 = %+v; want Moves", task)
+	}
+	if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(original.Attachments[0].Key))); !os.IsNotExist(err) {
+		t.Errorf("attachment file left in the default workspace: %v", err)
+	}
+	w = send("POST", "/api/v1/workspaces/acme/tokens", `{"role": "viewer"}`)
+	var issued struct{ Token string }
+	json.NewDecoder(w.Body).Decode(&issued)
+	req := httptest.NewRequest("GET", "/api/v1/tasks/2/attachments/1", nil)
+	req.Header.Set("X-API-Token", issued.Token)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "hello" {
+		t.Errorf("attachment in acme = %d %q; want %d hello", w.Code, w.Body.String(), http.StatusOK)
+	}
+
+	// And back, where it gets the next default ID
+	back := move("/api/v1/workspaces/acme/tasks/2/move", "default", http.StatusOK)
+	if back.ID != 3 || back.Title != "Moves" {
+		t.Errorf("task moved back = %+v; want Moves as task 3", back)
+	}
+
+	move("/api/v1/workspaces/default/tasks/3/move", "default", http.StatusUnprocessableEntity)
+	move("/api/v1/workspaces/default/tasks/3/move", "", http.StatusUnprocessableEntity)
+	move("/api/v1/workspaces/default/tasks/3/move", "nope", http.StatusNotFound)
+	move("/api/v1/workspaces/nope/tasks/3/move", "acme", http.StatusNotFound)
+	move("/api/v1/workspaces/default/tasks/99/move", "acme", http.StatusNotFound)
+
+	server.config.MaxTasks = 1
+	acme.quota.limit = 1
+	move("/api/v1/workspaces/default/tasks/3/move", "acme", http.StatusInsufficientStorage)
+	if _, exists := server.store.Get(3); !exists {
+		t.Error("task left the default workspace although the move was refused")
+	}
+}
+
+func TestValidateWorkspaces(t *testing.T) {
+	acme := []Workspace{{ID: "acme", Name: "Acme"}}
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{"none", Config{}, false},
+		{"one", Config{Workspaces: acme, TokenWorkspaces: map[string]string{"h": "acme"}}, false},
+		{"sqlite", Config{Workspaces: acme, Storage: "sqlite"}, false},
+		{"bad id", Config{Workspaces: []Workspace{{ID: "../acme"}}}, true},
+		{"duplicate", Config{Workspaces: append(acme, acme...)}, true},
+		{"reserved id", Config{Workspaces: []Workspace{{ID: defaultWorkspaceID}}}, true},
+		{"unknown token workspace", Config{Workspaces: acme, TokenWorkspaces: map[string]string{"h": "other"}}, true},
+		{"postgres", Config{Workspaces: acme, Storage: "postgres"}, true},
+	}
+	for _, tt := range tests {
+		if err := validateWorkspaces(&tt.config); (err != nil) != tt.wantErr {
+			t.Errorf("%s: error %v; want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}